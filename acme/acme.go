@@ -0,0 +1,464 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package acme provides a minimal client for the ACME protocol (RFC 8555),
+// able to register an account and to obtain certificates using the HTTP-01
+// challenge.
+package acme
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	StatusPending    = "pending"
+	StatusProcessing = "processing"
+	StatusReady      = "ready"
+	StatusValid      = "valid"
+	StatusInvalid    = "invalid"
+
+	ChallengeHTTP01 = "http-01"
+
+	badNonceError = "urn:ietf:params:acme:error:badNonce"
+)
+
+var (
+	ErrNoHTTP01Challenge = errors.New("no http-01 challenge offered by the server")
+	ErrNotRegistered     = errors.New("account not registered")
+)
+
+// Error is a problem document returned by the ACME server.
+type Error struct {
+	Status int    `json:"status"`
+	Type   string `json:"type"`
+	Detail string `json:"detail"`
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("acme error (%d) %s: %s", e.Status, e.Type, e.Detail)
+}
+
+// ChallengeSolver makes the key authorization of a challenge available for
+// the ACME server, in the HTTP-01 challenge it must be served at
+// http://<domain>/.well-known/acme-challenge/<token>.
+type ChallengeSolver interface {
+	Present(domain, token, keyAuth string) error
+	CleanUp(domain, token string) error
+}
+
+type directory struct {
+	NewNonce   string `json:"newNonce"`
+	NewAccount string `json:"newAccount"`
+	NewOrder   string `json:"newOrder"`
+}
+
+type identifier struct {
+	Type  string `json:"type"`
+	Value string `json:"value"`
+}
+
+type order struct {
+	Status         string       `json:"status"`
+	Identifiers    []identifier `json:"identifiers"`
+	Authorizations []string     `json:"authorizations"`
+	Finalize       string       `json:"finalize"`
+	Certificate    string       `json:"certificate"`
+	Error          *Error       `json:"error"`
+}
+
+type authorization struct {
+	Status     string      `json:"status"`
+	Identifier identifier  `json:"identifier"`
+	Challenges []challenge `json:"challenges"`
+}
+
+type challenge struct {
+	Type   string `json:"type"`
+	URL    string `json:"url"`
+	Token  string `json:"token"`
+	Status string `json:"status"`
+	Error  *Error `json:"error"`
+}
+
+// Client is an ACME client bound to an account key.
+type Client struct {
+	DirectoryURL string
+	HTTPClient   *http.Client
+	// PollInterval is the interval between checks of pending
+	// authorizations and orders.
+	PollInterval time.Duration
+	// PollTimeout is the maximum time waiting for an authorization or an
+	// order to leave the pending state.
+	PollTimeout time.Duration
+	// AccountURL identifies the account in the server, it's set by
+	// Register and may be set directly for accounts already registered.
+	AccountURL string
+
+	key    *ecdsa.PrivateKey
+	dir    *directory
+	mu     sync.Mutex
+	nonces []string
+}
+
+// NewClient returns a client for the ACME server in the given directory URL,
+// signing requests with the given account key.
+func NewClient(directoryURL string, key *ecdsa.PrivateKey) *Client {
+	return &Client{
+		DirectoryURL: directoryURL,
+		HTTPClient:   http.DefaultClient,
+		PollInterval: time.Second,
+		PollTimeout:  2 * time.Minute,
+		key:          key,
+	}
+}
+
+// GenerateKey generates a new P-256 key, suitable for accounts and
+// certificates.
+func GenerateKey() (*ecdsa.PrivateKey, error) {
+	return ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+}
+
+func (c *Client) directory() (*directory, error) {
+	if c.dir != nil {
+		return c.dir, nil
+	}
+	resp, err := c.HTTPClient.Get(c.DirectoryURL)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, responseError(resp)
+	}
+	var dir directory
+	err = json.NewDecoder(resp.Body).Decode(&dir)
+	if err != nil {
+		return nil, err
+	}
+	c.dir = &dir
+	return c.dir, nil
+}
+
+// Register creates an account in the server, or retrieves the existing
+// account for the key, agreeing to the terms of service.
+func (c *Client) Register(email string) error {
+	dir, err := c.directory()
+	if err != nil {
+		return err
+	}
+	payload := map[string]interface{}{"termsOfServiceAgreed": true}
+	if email != "" {
+		payload["contact"] = []string{"mailto:" + email}
+	}
+	resp, err := c.post(dir.NewAccount, payload, false)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	c.AccountURL = resp.Header.Get("Location")
+	if c.AccountURL == "" {
+		return errors.New("account URL not returned by the server")
+	}
+	return nil
+}
+
+// ObtainCertificate orders a certificate for the domains, solving the
+// HTTP-01 challenges using the given solver. It returns the certificate
+// chain in the PEM format.
+func (c *Client) ObtainCertificate(domains []string, key crypto.Signer, solver ChallengeSolver) (string, error) {
+	if c.AccountURL == "" {
+		return "", ErrNotRegistered
+	}
+	dir, err := c.directory()
+	if err != nil {
+		return "", err
+	}
+	ids := make([]identifier, len(domains))
+	for i, d := range domains {
+		ids[i] = identifier{Type: "dns", Value: d}
+	}
+	var o order
+	resp, err := c.postJSON(dir.NewOrder, map[string]interface{}{"identifiers": ids}, &o)
+	if err != nil {
+		return "", err
+	}
+	orderURL := resp.Header.Get("Location")
+	for _, authzURL := range o.Authorizations {
+		err = c.authorize(authzURL, solver)
+		if err != nil {
+			return "", err
+		}
+	}
+	csr, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject:  pkix.Name{CommonName: domains[0]},
+		DNSNames: domains,
+	}, key)
+	if err != nil {
+		return "", err
+	}
+	_, err = c.postJSON(o.Finalize, map[string]string{"csr": encode(csr)}, &o)
+	if err != nil {
+		return "", err
+	}
+	err = c.poll(func() (bool, error) {
+		if o.Status == StatusValid {
+			return true, nil
+		}
+		if o.Status == StatusInvalid {
+			return false, fmt.Errorf("order for %s is invalid: %v", strings.Join(domains, ", "), o.Error)
+		}
+		_, err := c.postJSON(orderURL, nil, &o)
+		return false, err
+	})
+	if err != nil {
+		return "", err
+	}
+	resp, err = c.post(o.Certificate, nil, true)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+func (c *Client) authorize(authzURL string, solver ChallengeSolver) error {
+	var authz authorization
+	_, err := c.postJSON(authzURL, nil, &authz)
+	if err != nil {
+		return err
+	}
+	if authz.Status == StatusValid {
+		return nil
+	}
+	var chal *challenge
+	for i := range authz.Challenges {
+		if authz.Challenges[i].Type == ChallengeHTTP01 {
+			chal = &authz.Challenges[i]
+			break
+		}
+	}
+	if chal == nil {
+		return ErrNoHTTP01Challenge
+	}
+	domain := authz.Identifier.Value
+	err = solver.Present(domain, chal.Token, c.keyAuthorization(chal.Token))
+	if err != nil {
+		return err
+	}
+	defer solver.CleanUp(domain, chal.Token)
+	_, err = c.postJSON(chal.URL, struct{}{}, nil)
+	if err != nil {
+		return err
+	}
+	return c.poll(func() (bool, error) {
+		_, err := c.postJSON(authzURL, nil, &authz)
+		if err != nil {
+			return false, err
+		}
+		switch authz.Status {
+		case StatusValid:
+			return true, nil
+		case StatusPending, StatusProcessing:
+			return false, nil
+		}
+		for _, ch := range authz.Challenges {
+			if ch.Type == ChallengeHTTP01 && ch.Error != nil {
+				return false, fmt.Errorf("authorization for %s failed: %s", domain, ch.Error)
+			}
+		}
+		return false, fmt.Errorf("authorization for %s is %s", domain, authz.Status)
+	})
+}
+
+func (c *Client) poll(check func() (bool, error)) error {
+	deadline := time.Now().Add(c.PollTimeout)
+	for {
+		done, err := check()
+		if err != nil || done {
+			return err
+		}
+		if time.Now().After(deadline) {
+			return errors.New("timeout waiting for the ACME server")
+		}
+		time.Sleep(c.PollInterval)
+	}
+}
+
+// keyAuthorization returns the key authorization of a token, which is the
+// token followed by the thumbprint of the account key.
+func (c *Client) keyAuthorization(token string) string {
+	data, _ := json.Marshal(c.jwk())
+	sum := sha256.Sum256(data)
+	return token + "." + encode(sum[:])
+}
+
+// jwk returns the JSON Web Key of the account key, with members in the
+// lexicographic order required by the thumbprint.
+func (c *Client) jwk() interface{} {
+	size := (c.key.Curve.Params().BitSize + 7) / 8
+	return struct {
+		Crv string `json:"crv"`
+		Kty string `json:"kty"`
+		X   string `json:"x"`
+		Y   string `json:"y"`
+	}{
+		Crv: c.key.Curve.Params().Name,
+		Kty: "EC",
+		X:   encode(padded(c.key.X, size)),
+		Y:   encode(padded(c.key.Y, size)),
+	}
+}
+
+func (c *Client) postJSON(url string, payload interface{}, result interface{}) (*http.Response, error) {
+	resp, err := c.post(url, payload, false)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if result != nil {
+		err = json.NewDecoder(resp.Body).Decode(result)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return resp, nil
+}
+
+// post sends a signed request, a nil payload is sent as a POST-as-GET
+// request. Requests failing due to invalid nonces are retried once.
+func (c *Client) post(url string, payload interface{}, retried bool) (*http.Response, error) {
+	body, err := c.sign(url, payload)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.HTTPClient.Post(url, "application/jose+json", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	c.saveNonce(resp)
+	if resp.StatusCode < 400 {
+		return resp, nil
+	}
+	defer resp.Body.Close()
+	err = responseError(resp)
+	if e, ok := err.(*Error); ok && e.Type == badNonceError && !retried {
+		return c.post(url, payload, true)
+	}
+	return nil, err
+}
+
+func (c *Client) sign(url string, payload interface{}) ([]byte, error) {
+	nonce, err := c.nonce()
+	if err != nil {
+		return nil, err
+	}
+	protected := map[string]interface{}{"alg": "ES256", "nonce": nonce, "url": url}
+	if c.AccountURL != "" {
+		protected["kid"] = c.AccountURL
+	} else {
+		protected["jwk"] = c.jwk()
+	}
+	protectedData, err := json.Marshal(protected)
+	if err != nil {
+		return nil, err
+	}
+	var payloadData []byte
+	if payload != nil {
+		payloadData, err = json.Marshal(payload)
+		if err != nil {
+			return nil, err
+		}
+	}
+	signingInput := encode(protectedData) + "." + encode(payloadData)
+	hash := sha256.Sum256([]byte(signingInput))
+	r, s, err := ecdsa.Sign(rand.Reader, c.key, hash[:])
+	if err != nil {
+		return nil, err
+	}
+	size := (c.key.Curve.Params().BitSize + 7) / 8
+	signature := append(padded(r, size), padded(s, size)...)
+	return json.Marshal(map[string]string{
+		"protected": encode(protectedData),
+		"payload":   encode(payloadData),
+		"signature": encode(signature),
+	})
+}
+
+func (c *Client) nonce() (string, error) {
+	c.mu.Lock()
+	if len(c.nonces) > 0 {
+		nonce := c.nonces[len(c.nonces)-1]
+		c.nonces = c.nonces[:len(c.nonces)-1]
+		c.mu.Unlock()
+		return nonce, nil
+	}
+	c.mu.Unlock()
+	dir, err := c.directory()
+	if err != nil {
+		return "", err
+	}
+	resp, err := c.HTTPClient.Head(dir.NewNonce)
+	if err != nil {
+		return "", err
+	}
+	resp.Body.Close()
+	nonce := resp.Header.Get("Replay-Nonce")
+	if nonce == "" {
+		return "", errors.New("nonce not returned by the server")
+	}
+	return nonce, nil
+}
+
+func (c *Client) saveNonce(resp *http.Response) {
+	if nonce := resp.Header.Get("Replay-Nonce"); nonce != "" {
+		c.mu.Lock()
+		c.nonces = append(c.nonces, nonce)
+		c.mu.Unlock()
+	}
+}
+
+func responseError(resp *http.Response) error {
+	data, _ := ioutil.ReadAll(resp.Body)
+	var e Error
+	if json.Unmarshal(data, &e) != nil || e.Type == "" {
+		return &Error{Status: resp.StatusCode, Detail: strings.TrimSpace(string(data))}
+	}
+	if e.Status == 0 {
+		e.Status = resp.StatusCode
+	}
+	return &e
+}
+
+func encode(data []byte) string {
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func padded(n *big.Int, size int) []byte {
+	data := n.Bytes()
+	if len(data) >= size {
+		return data
+	}
+	return append(make([]byte, size-len(data)), data...)
+}
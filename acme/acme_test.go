@@ -0,0 +1,151 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package acme
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/tsuru/tsuru/acme/acmetest"
+	"gopkg.in/check.v1"
+)
+
+func Test(t *testing.T) {
+	check.TestingT(t)
+}
+
+type S struct {
+	server *acmetest.Server
+	solver *mapSolver
+}
+
+var _ = check.Suite(&S{})
+
+type mapSolver struct {
+	sync.Mutex
+	challenges map[string]string
+	cleaned    []string
+}
+
+func (s *mapSolver) Present(domain, token, keyAuth string) error {
+	s.Lock()
+	defer s.Unlock()
+	s.challenges[domain+"/"+token] = keyAuth
+	return nil
+}
+
+func (s *mapSolver) CleanUp(domain, token string) error {
+	s.Lock()
+	defer s.Unlock()
+	delete(s.challenges, domain+"/"+token)
+	s.cleaned = append(s.cleaned, domain)
+	return nil
+}
+
+func (s *mapSolver) get(domain, token string) (string, error) {
+	s.Lock()
+	defer s.Unlock()
+	keyAuth, ok := s.challenges[domain+"/"+token]
+	if !ok {
+		return "", errors.New("challenge not found")
+	}
+	return keyAuth, nil
+}
+
+func (s *S) SetUpTest(c *check.C) {
+	var err error
+	s.server, err = acmetest.NewServer()
+	c.Assert(err, check.IsNil)
+	s.solver = &mapSolver{challenges: make(map[string]string)}
+	s.server.Validate = s.solver.get
+}
+
+func (s *S) TearDownTest(c *check.C) {
+	s.server.Close()
+}
+
+func (s *S) newClient(c *check.C) *Client {
+	key, err := GenerateKey()
+	c.Assert(err, check.IsNil)
+	client := NewClient(s.server.DirectoryURL(), key)
+	client.PollInterval = 10 * time.Millisecond
+	client.PollTimeout = time.Second
+	return client
+}
+
+func (s *S) TestRegister(c *check.C) {
+	client := s.newClient(c)
+	err := client.Register("admin@example.com")
+	c.Assert(err, check.IsNil)
+	c.Assert(client.AccountURL, check.Matches, s.server.URL+"/account/.+")
+	accountURL := client.AccountURL
+	client.AccountURL = ""
+	err = client.Register("admin@example.com")
+	c.Assert(err, check.IsNil)
+	c.Assert(client.AccountURL, check.Equals, accountURL)
+}
+
+func (s *S) TestObtainCertificate(c *check.C) {
+	client := s.newClient(c)
+	err := client.Register("")
+	c.Assert(err, check.IsNil)
+	key, err := GenerateKey()
+	c.Assert(err, check.IsNil)
+	chain, err := client.ObtainCertificate([]string{"myapp.io", "www.myapp.io"}, key, s.solver)
+	c.Assert(err, check.IsNil)
+	block, _ := pem.Decode([]byte(chain))
+	c.Assert(block, check.NotNil)
+	cert, err := x509.ParseCertificate(block.Bytes)
+	c.Assert(err, check.IsNil)
+	c.Assert(cert.DNSNames, check.DeepEquals, []string{"myapp.io", "www.myapp.io"})
+	c.Assert(cert.VerifyHostname("www.myapp.io"), check.IsNil)
+	c.Assert(s.solver.challenges, check.HasLen, 0)
+	c.Assert(s.solver.cleaned, check.DeepEquals, []string{"myapp.io", "www.myapp.io"})
+}
+
+func (s *S) TestObtainCertificateNotRegistered(c *check.C) {
+	client := s.newClient(c)
+	key, err := GenerateKey()
+	c.Assert(err, check.IsNil)
+	_, err = client.ObtainCertificate([]string{"myapp.io"}, key, s.solver)
+	c.Assert(err, check.Equals, ErrNotRegistered)
+}
+
+func (s *S) TestObtainCertificateInvalidChallenge(c *check.C) {
+	s.server.Validate = func(domain, token string) (string, error) {
+		return "wrong", nil
+	}
+	client := s.newClient(c)
+	err := client.Register("")
+	c.Assert(err, check.IsNil)
+	key, err := GenerateKey()
+	c.Assert(err, check.IsNil)
+	_, err = client.ObtainCertificate([]string{"myapp.io"}, key, s.solver)
+	c.Assert(err, check.ErrorMatches, `authorization for myapp.io failed: acme error \(0\) urn:ietf:params:acme:error:unauthorized: key authorization "wrong" doesn't match .*`)
+	c.Assert(s.solver.cleaned, check.DeepEquals, []string{"myapp.io"})
+}
+
+func (s *S) TestRetryBadNonce(c *check.C) {
+	client := s.newClient(c)
+	s.server.RejectNonces(1)
+	err := client.Register("")
+	c.Assert(err, check.IsNil)
+	s.server.RejectNonces(2)
+	err = client.Register("")
+	c.Assert(err, check.FitsTypeOf, &Error{})
+	c.Assert(err.(*Error).Type, check.Equals, badNonceError)
+	c.Assert(err.(*Error).Status, check.Equals, 400)
+}
+
+func (s *S) TestKeyAuthorization(c *check.C) {
+	client := s.newClient(c)
+	keyAuth := client.keyAuthorization("mytoken")
+	c.Assert(keyAuth, check.Matches, `mytoken\.[A-Za-z0-9_-]{43}`)
+	c.Assert(client.keyAuthorization("mytoken"), check.Equals, keyAuth)
+}
@@ -0,0 +1,544 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package acmetest provides a fake ACME server, issuing certificates signed
+// by a throwaway CA after validating HTTP-01 challenges.
+package acmetest
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Server is a fake ACME server. Challenges are validated synchronously when
+// the client answers them.
+type Server struct {
+	*httptest.Server
+	// Validate fetches the key authorization of a challenge. By default
+	// it's fetched from http://<domain>/.well-known/acme-challenge/<token>.
+	Validate func(domain, token string) (string, error)
+	// CertificateDuration is the validity of the issued certificates.
+	CertificateDuration time.Duration
+
+	mu           sync.Mutex
+	caKey        *ecdsa.PrivateKey
+	caCert       *x509.Certificate
+	nonces       map[string]bool
+	badNonces    int
+	accounts     map[string]*ecdsa.PublicKey
+	orders       map[string]*order
+	authzs       map[string]*authz
+	certificates map[string]string
+	seq          int
+}
+
+type order struct {
+	status      string
+	domains     []string
+	authzs      []string
+	certificate string
+}
+
+type authz struct {
+	domain     string
+	token      string
+	status     string
+	thumbprint string
+	err        string
+}
+
+type jws struct {
+	Protected string `json:"protected"`
+	Payload   string `json:"payload"`
+	Signature string `json:"signature"`
+}
+
+type jwk struct {
+	Crv string `json:"crv"`
+	Kty string `json:"kty"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+type protectedHeader struct {
+	Alg   string `json:"alg"`
+	Nonce string `json:"nonce"`
+	URL   string `json:"url"`
+	Kid   string `json:"kid"`
+	JWK   *jwk   `json:"jwk"`
+}
+
+// NewServer starts a new fake ACME server, the directory is available at
+// s.URL + "/directory".
+func NewServer() (*Server, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	template := x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "acmetest CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(10 * 365 * 24 * time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, &template, &template, &key.PublicKey, key)
+	if err != nil {
+		return nil, err
+	}
+	caCert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, err
+	}
+	s := &Server{
+		CertificateDuration: 90 * 24 * time.Hour,
+		caKey:               key,
+		caCert:              caCert,
+		nonces:              make(map[string]bool),
+		accounts:            make(map[string]*ecdsa.PublicKey),
+		orders:              make(map[string]*order),
+		authzs:              make(map[string]*authz),
+		certificates:        make(map[string]string),
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	return s, nil
+}
+
+// DirectoryURL returns the URL of the directory of the server.
+func (s *Server) DirectoryURL() string {
+	return s.URL + "/directory"
+}
+
+// RejectNonces makes the server reject the next n nonces with a badNonce
+// error.
+func (s *Server) RejectNonces(n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.badNonces = n
+}
+
+// Orders returns the number of orders created in the server.
+func (s *Server) Orders() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.orders)
+}
+
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Replay-Nonce", s.newNonce())
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	if parts[0] == "directory" {
+		json.NewEncoder(w).Encode(map[string]string{
+			"newNonce":   s.URL + "/nonce",
+			"newAccount": s.URL + "/account",
+			"newOrder":   s.URL + "/order",
+		})
+		return
+	}
+	if parts[0] == "nonce" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	if r.Method != "POST" {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	header, payload, key, err := s.verify(r)
+	if err != nil {
+		problem(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	switch parts[0] {
+	case "account":
+		if len(parts) == 1 {
+			s.newAccount(w, header, key)
+			return
+		}
+	case "order":
+		if len(parts) == 1 {
+			s.newOrder(w, header, payload)
+			return
+		}
+		s.getOrder(w, parts[1])
+		return
+	case "authz":
+		s.getAuthz(w, parts[1])
+		return
+	case "chal":
+		s.answerChallenge(w, parts[1])
+		return
+	case "finalize":
+		s.finalize(w, parts[1], payload)
+		return
+	case "cert":
+		w.Header().Set("Content-Type", "application/pem-certificate-chain")
+		w.Write([]byte(s.certificates[parts[1]]))
+		return
+	}
+	http.NotFound(w, r)
+}
+
+func (s *Server) newNonce() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.seq++
+	nonce := "nonce-" + strconv.Itoa(s.seq)
+	s.nonces[nonce] = true
+	return nonce
+}
+
+func (s *Server) nextID() string {
+	s.seq++
+	return strconv.Itoa(s.seq)
+}
+
+// verify checks the nonce and the signature of a request, returning the
+// protected header, the payload and the key used in the signature.
+func (s *Server) verify(r *http.Request) (*protectedHeader, []byte, *ecdsa.PublicKey, error) {
+	var msg jws
+	err := json.NewDecoder(r.Body).Decode(&msg)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	var header protectedHeader
+	err = decodeJSON(msg.Protected, &header)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if !s.nonces[header.Nonce] {
+		return nil, nil, nil, fmt.Errorf("badNonce: invalid nonce %q", header.Nonce)
+	}
+	delete(s.nonces, header.Nonce)
+	if s.badNonces > 0 {
+		s.badNonces--
+		return nil, nil, nil, fmt.Errorf("badNonce: nonce %q rejected", header.Nonce)
+	}
+	if header.URL != s.URL+r.URL.Path {
+		return nil, nil, nil, fmt.Errorf("url %q doesn't match the request", header.URL)
+	}
+	var key *ecdsa.PublicKey
+	if header.JWK != nil {
+		key, err = header.JWK.publicKey()
+		if err != nil {
+			return nil, nil, nil, err
+		}
+	} else {
+		key = s.accounts[header.Kid]
+		if key == nil {
+			return nil, nil, nil, fmt.Errorf("account %q not found", header.Kid)
+		}
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(msg.Signature)
+	if err != nil || len(signature) != 64 {
+		return nil, nil, nil, fmt.Errorf("invalid signature")
+	}
+	hash := sha256.Sum256([]byte(msg.Protected + "." + msg.Payload))
+	rInt := new(big.Int).SetBytes(signature[:32])
+	sInt := new(big.Int).SetBytes(signature[32:])
+	if !ecdsa.Verify(key, hash[:], rInt, sInt) {
+		return nil, nil, nil, fmt.Errorf("invalid signature")
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(msg.Payload)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return &header, payload, key, nil
+}
+
+func (s *Server) newAccount(w http.ResponseWriter, header *protectedHeader, key *ecdsa.PublicKey) {
+	if header.JWK == nil {
+		problem(w, http.StatusBadRequest, "malformed: jwk required")
+		return
+	}
+	for url, k := range s.accounts {
+		if k.X.Cmp(key.X) == 0 && k.Y.Cmp(key.Y) == 0 {
+			w.Header().Set("Location", url)
+			w.WriteHeader(http.StatusOK)
+			w.Write([]byte(`{"status":"valid"}`))
+			return
+		}
+	}
+	url := s.URL + "/account/" + s.nextID()
+	s.accounts[url] = key
+	w.Header().Set("Location", url)
+	w.WriteHeader(http.StatusCreated)
+	w.Write([]byte(`{"status":"valid"}`))
+}
+
+func (s *Server) newOrder(w http.ResponseWriter, header *protectedHeader, payload []byte) {
+	var req struct {
+		Identifiers []struct {
+			Type  string `json:"type"`
+			Value string `json:"value"`
+		} `json:"identifiers"`
+	}
+	err := json.Unmarshal(payload, &req)
+	if err != nil || len(req.Identifiers) == 0 {
+		problem(w, http.StatusBadRequest, "malformed: identifiers required")
+		return
+	}
+	o := &order{status: "pending"}
+	thumbprint := s.thumbprint(header.Kid)
+	for _, id := range req.Identifiers {
+		authzID := s.nextID()
+		s.authzs[authzID] = &authz{
+			domain:     id.Value,
+			token:      "token-" + authzID,
+			status:     "pending",
+			thumbprint: thumbprint,
+		}
+		o.domains = append(o.domains, id.Value)
+		o.authzs = append(o.authzs, authzID)
+	}
+	id := s.nextID()
+	s.orders[id] = o
+	w.Header().Set("Location", s.URL+"/order/"+id)
+	w.WriteHeader(http.StatusCreated)
+	s.writeOrder(w, id)
+}
+
+func (s *Server) getOrder(w http.ResponseWriter, id string) {
+	if s.orders[id] == nil {
+		problem(w, http.StatusNotFound, "order not found")
+		return
+	}
+	s.writeOrder(w, id)
+}
+
+func (s *Server) writeOrder(w http.ResponseWriter, id string) {
+	o := s.orders[id]
+	s.updateOrderStatus(o)
+	data := map[string]interface{}{
+		"status":   o.status,
+		"finalize": s.URL + "/finalize/" + id,
+	}
+	var authzURLs []string
+	for _, a := range o.authzs {
+		authzURLs = append(authzURLs, s.URL+"/authz/"+a)
+	}
+	data["authorizations"] = authzURLs
+	if o.certificate != "" {
+		data["certificate"] = s.URL + "/cert/" + o.certificate
+	}
+	json.NewEncoder(w).Encode(data)
+}
+
+func (s *Server) getAuthz(w http.ResponseWriter, id string) {
+	a := s.authzs[id]
+	if a == nil {
+		problem(w, http.StatusNotFound, "authorization not found")
+		return
+	}
+	chal := map[string]interface{}{
+		"type":   "http-01",
+		"url":    s.URL + "/chal/" + id,
+		"token":  a.token,
+		"status": a.status,
+	}
+	if a.err != "" {
+		chal["error"] = map[string]interface{}{"type": "urn:ietf:params:acme:error:unauthorized", "detail": a.err}
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":     a.status,
+		"identifier": map[string]string{"type": "dns", "value": a.domain},
+		"challenges": []interface{}{chal},
+	})
+}
+
+func (s *Server) answerChallenge(w http.ResponseWriter, id string) {
+	a := s.authzs[id]
+	if a == nil {
+		problem(w, http.StatusNotFound, "challenge not found")
+		return
+	}
+	validate := s.Validate
+	if validate == nil {
+		validate = fetchKeyAuthorization
+	}
+	keyAuth, err := validate(a.domain, a.token)
+	expected := a.token + "." + a.thumbprint
+	switch {
+	case err != nil:
+		a.status = "invalid"
+		a.err = err.Error()
+	case strings.TrimSpace(keyAuth) != expected:
+		a.status = "invalid"
+		a.err = fmt.Sprintf("key authorization %q doesn't match %q", keyAuth, expected)
+	default:
+		a.status = "valid"
+	}
+	json.NewEncoder(w).Encode(map[string]string{"type": "http-01", "status": a.status})
+}
+
+func (s *Server) finalize(w http.ResponseWriter, id string, payload []byte) {
+	o := s.orders[id]
+	if o == nil {
+		problem(w, http.StatusNotFound, "order not found")
+		return
+	}
+	s.updateOrderStatus(o)
+	if o.status != "ready" {
+		problem(w, http.StatusForbidden, "orderNotReady: order is "+o.status)
+		return
+	}
+	var req struct {
+		CSR string `json:"csr"`
+	}
+	err := json.Unmarshal(payload, &req)
+	if err != nil {
+		problem(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	der, err := base64.RawURLEncoding.DecodeString(req.CSR)
+	if err != nil {
+		problem(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	csr, err := x509.ParseCertificateRequest(der)
+	if err == nil {
+		err = csr.CheckSignature()
+	}
+	if err != nil {
+		problem(w, http.StatusBadRequest, "badCSR: "+err.Error())
+		return
+	}
+	if strings.Join(csr.DNSNames, ",") != strings.Join(o.domains, ",") {
+		problem(w, http.StatusBadRequest, "badCSR: names don't match the order")
+		return
+	}
+	template := x509.Certificate{
+		SerialNumber: big.NewInt(int64(s.seq + 1)),
+		Subject:      pkix.Name{CommonName: o.domains[0]},
+		DNSNames:     o.domains,
+		NotBefore:    time.Now().Add(-time.Minute),
+		NotAfter:     time.Now().Add(s.CertificateDuration),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	certDer, err := x509.CreateCertificate(rand.Reader, &template, s.caCert, csr.PublicKey, s.caKey)
+	if err != nil {
+		problem(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	certID := s.nextID()
+	s.certificates[certID] = string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certDer})) +
+		string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: s.caCert.Raw}))
+	o.certificate = certID
+	o.status = "valid"
+	s.writeOrder(w, id)
+}
+
+// updateOrderStatus moves a pending order to ready when all its
+// authorizations are valid, or to invalid when any of them is invalid.
+func (s *Server) updateOrderStatus(o *order) {
+	if o.status != "pending" {
+		return
+	}
+	ready := true
+	for _, a := range o.authzs {
+		switch s.authzs[a].status {
+		case "invalid":
+			o.status = "invalid"
+			return
+		case "valid":
+		default:
+			ready = false
+		}
+	}
+	if ready {
+		o.status = "ready"
+	}
+}
+
+func (s *Server) thumbprint(kid string) string {
+	key := s.accounts[kid]
+	if key == nil {
+		return ""
+	}
+	data, _ := json.Marshal(jwk{
+		Crv: "P-256",
+		Kty: "EC",
+		X:   base64.RawURLEncoding.EncodeToString(padded(key.X.Bytes())),
+		Y:   base64.RawURLEncoding.EncodeToString(padded(key.Y.Bytes())),
+	})
+	sum := sha256.Sum256(data)
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+func (k *jwk) publicKey() (*ecdsa.PublicKey, error) {
+	if k.Kty != "EC" || k.Crv != "P-256" {
+		return nil, fmt.Errorf("unsupported key %s/%s", k.Kty, k.Crv)
+	}
+	x, err := base64.RawURLEncoding.DecodeString(k.X)
+	if err != nil {
+		return nil, err
+	}
+	y, err := base64.RawURLEncoding.DecodeString(k.Y)
+	if err != nil {
+		return nil, err
+	}
+	return &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}, nil
+}
+
+func fetchKeyAuthorization(domain, token string) (string, error) {
+	resp, err := http.Get(fmt.Sprintf("http://%s/.well-known/acme-challenge/%s", domain, token))
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("unexpected status %d fetching challenge", resp.StatusCode)
+	}
+	return string(data), nil
+}
+
+func problem(w http.ResponseWriter, status int, detail string) {
+	errType := "urn:ietf:params:acme:error:malformed"
+	if idx := strings.Index(detail, ":"); idx != -1 && !strings.Contains(detail[:idx], " ") {
+		errType = "urn:ietf:params:acme:error:" + detail[:idx]
+		detail = strings.TrimSpace(detail[idx+1:])
+	}
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]interface{}{"type": errType, "detail": detail, "status": status})
+}
+
+func decodeJSON(data string, v interface{}) error {
+	raw, err := base64.RawURLEncoding.DecodeString(data)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(raw, v)
+}
+
+func padded(data []byte) []byte {
+	if len(data) >= 32 {
+		return data
+	}
+	return append(make([]byte, 32-len(data)), data...)
+}
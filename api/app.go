@@ -1758,6 +1758,25 @@ func appRebuildRoutes(w http.ResponseWriter, r *http.Request, t auth.Token) (err
 	return json.NewEncoder(w).Encode(&result)
 }
 
+// title: routes drift
+// path: /routes/drift
+// method: GET
+// produce: application/json
+// responses:
+//   200: Ok
+//   401: Unauthorized
+func routesDrift(w http.ResponseWriter, r *http.Request, t auth.Token) error {
+	if !permission.Check(t, permission.PermAppAdminRoutes) {
+		return permission.ErrUnauthorized
+	}
+	summary, err := app.GetRoutesDriftSummary()
+	if err != nil {
+		return err
+	}
+	w.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(summary)
+}
+
 func formToEvents(form url.Values) []map[string]interface{} {
 	ret := make([]map[string]interface{}, 0, len(form))
 	for k, v := range form {
@@ -0,0 +1,145 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	"github.com/tsuru/tsuru/app"
+	"github.com/tsuru/tsuru/event/eventtest"
+	"github.com/tsuru/tsuru/permission"
+	"github.com/tsuru/tsuru/router/routertest"
+	"gopkg.in/check.v1"
+)
+
+func (s *S) TestSetAccessPolicy(c *check.C) {
+	a := s.createRouterApp(c)
+	body := strings.NewReader("allow=192.168.0.1&deny=10.1.0.0/16&ratelimit=10&rateburst=20&user=user&password=secret")
+	request, err := http.NewRequest("POST", "/apps/"+a.Name+"/access-policy", body)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Authorization", "b "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	m := RunServer(true)
+	m.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK, check.Commentf("body: %s", recorder.Body.String()))
+	policy, ok := routertest.FakeRouter.AccessPolicy(a.Name)
+	c.Assert(ok, check.Equals, true)
+	c.Assert(policy.Allow, check.DeepEquals, []string{"192.168.0.1/32"})
+	c.Assert(policy.Deny, check.DeepEquals, []string{"10.1.0.0/16"})
+	c.Assert(policy.RateLimit, check.Equals, 10)
+	c.Assert(policy.RateBurst, check.Equals, 20)
+	c.Assert(policy.BasicAuth.Username, check.Equals, "user")
+	c.Assert(eventtest.EventDesc{
+		Target: appTarget(a.Name),
+		Owner:  s.token.GetUserName(),
+		Kind:   "app.update.access-policy.set",
+		StartCustomData: []map[string]interface{}{
+			{"name": "allow", "value": "192.168.0.1"},
+			{"name": "deny", "value": "10.1.0.0/16"},
+			{"name": "ratelimit", "value": "10"},
+			{"name": "rateburst", "value": "20"},
+			{"name": "user", "value": "user"},
+			{"name": ":app", "value": a.Name},
+		},
+	}, eventtest.HasEvent)
+}
+
+func (s *S) TestSetAccessPolicyInvalid(c *check.C) {
+	a := s.createRouterApp(c)
+	tests := []string{
+		"allow=10.0.0.0/33",
+		"ratelimit=abc",
+		"rateburst=10",
+		"user=user",
+	}
+	for _, body := range tests {
+		request, err := http.NewRequest("POST", "/apps/"+a.Name+"/access-policy", strings.NewReader(body))
+		c.Assert(err, check.IsNil)
+		request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		request.Header.Set("Authorization", "b "+s.token.GetValue())
+		recorder := httptest.NewRecorder()
+		m := RunServer(true)
+		m.ServeHTTP(recorder, request)
+		c.Check(recorder.Code, check.Equals, http.StatusBadRequest, check.Commentf("body: %s", body))
+	}
+	_, ok := routertest.FakeRouter.AccessPolicy(a.Name)
+	c.Assert(ok, check.Equals, false)
+}
+
+func (s *S) TestSetAccessPolicyForbidden(c *check.C) {
+	a := s.createRouterApp(c)
+	token := userWithPermission(c, permission.Permission{
+		Scheme:  permission.PermAppUpdateAccessPolicySet,
+		Context: permission.Context(permission.CtxApp, "-other-app-"),
+	})
+	request, err := http.NewRequest("POST", "/apps/"+a.Name+"/access-policy", strings.NewReader("ratelimit=10"))
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Authorization", "b "+token.GetValue())
+	recorder := httptest.NewRecorder()
+	m := RunServer(true)
+	m.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusForbidden)
+	_, ok := routertest.FakeRouter.AccessPolicy(a.Name)
+	c.Assert(ok, check.Equals, false)
+}
+
+func (s *S) TestUnsetAccessPolicy(c *check.C) {
+	a := s.createRouterApp(c)
+	err := a.SetAccessPolicy(app.AccessPolicy{RateLimit: 10})
+	c.Assert(err, check.IsNil)
+	request, err := http.NewRequest("DELETE", "/apps/"+a.Name+"/access-policy", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "b "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	m := RunServer(true)
+	m.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK, check.Commentf("body: %s", recorder.Body.String()))
+	_, ok := routertest.FakeRouter.AccessPolicy(a.Name)
+	c.Assert(ok, check.Equals, false)
+	dbApp, err := app.GetByName(a.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(dbApp.AccessPolicy, check.IsNil)
+}
+
+func (s *S) TestGetAccessPolicy(c *check.C) {
+	a := s.createRouterApp(c)
+	err := a.SetAccessPolicy(app.AccessPolicy{
+		Deny:              []string{"10.0.0.1"},
+		BasicAuthUser:     "user",
+		BasicAuthPassword: "secret",
+	})
+	c.Assert(err, check.IsNil)
+	request, err := http.NewRequest("GET", "/apps/"+a.Name+"/access-policy", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "b "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	m := RunServer(true)
+	m.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	c.Assert(recorder.Header().Get("Content-Type"), check.Equals, "application/json")
+	var policy map[string]interface{}
+	err = json.Unmarshal(recorder.Body.Bytes(), &policy)
+	c.Assert(err, check.IsNil)
+	c.Assert(policy, check.DeepEquals, map[string]interface{}{
+		"deny":      []interface{}{"10.0.0.1/32"},
+		"basicauth": map[string]interface{}{"username": "user"},
+	})
+}
+
+func (s *S) TestGetAccessPolicyEmpty(c *check.C) {
+	a := s.createRouterApp(c)
+	request, err := http.NewRequest("GET", "/apps/"+a.Name+"/access-policy", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "b "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	m := RunServer(true)
+	m.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusNoContent)
+}
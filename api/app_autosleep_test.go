@@ -0,0 +1,137 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	"github.com/tsuru/tsuru/app"
+	"github.com/tsuru/tsuru/event/eventtest"
+	"github.com/tsuru/tsuru/permission"
+	"github.com/tsuru/tsuru/router/routertest"
+	"gopkg.in/check.v1"
+)
+
+func (s *S) TestSetAutoSleep(c *check.C) {
+	a := s.createRouterApp(c)
+	body := strings.NewReader("idle=30")
+	request, err := http.NewRequest("POST", "/apps/"+a.Name+"/auto-sleep", body)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Authorization", "b "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	m := RunServer(true)
+	m.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK, check.Commentf("body: %s", recorder.Body.String()))
+	dbApp, err := app.GetByName(a.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(dbApp.AutoSleep, check.DeepEquals, &app.AutoSleep{IdleMinutes: 30})
+	c.Assert(eventtest.EventDesc{
+		Target: appTarget(a.Name),
+		Owner:  s.token.GetUserName(),
+		Kind:   "app.update.auto-sleep.set",
+		StartCustomData: []map[string]interface{}{
+			{"name": "idle", "value": "30"},
+			{"name": ":app", "value": a.Name},
+		},
+	}, eventtest.HasEvent)
+}
+
+func (s *S) TestSetAutoSleepInvalid(c *check.C) {
+	a := s.createRouterApp(c)
+	for _, idle := range []string{"", "abc", "-1"} {
+		body := strings.NewReader("idle=" + idle)
+		request, err := http.NewRequest("POST", "/apps/"+a.Name+"/auto-sleep", body)
+		c.Assert(err, check.IsNil)
+		request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		request.Header.Set("Authorization", "b "+s.token.GetValue())
+		recorder := httptest.NewRecorder()
+		m := RunServer(true)
+		m.ServeHTTP(recorder, request)
+		c.Check(recorder.Code, check.Equals, http.StatusBadRequest, check.Commentf("idle: %q", idle))
+	}
+}
+
+func (s *S) TestSetAutoSleepActivityNotTracked(c *check.C) {
+	a := s.createRouterApp(c)
+	routertest.FakeRouter.DisableActivity()
+	body := strings.NewReader("idle=30")
+	request, err := http.NewRequest("POST", "/apps/"+a.Name+"/auto-sleep", body)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Authorization", "b "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	m := RunServer(true)
+	m.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusBadRequest)
+	c.Assert(recorder.Body.String(), check.Equals, app.ErrActivityNotSupported.Error()+"\n")
+	dbApp, err := app.GetByName(a.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(dbApp.AutoSleep, check.IsNil)
+}
+
+func (s *S) TestSetAutoSleepForbidden(c *check.C) {
+	a := s.createRouterApp(c)
+	token := userWithPermission(c, permission.Permission{
+		Scheme:  permission.PermAppUpdateAutoSleepSet,
+		Context: permission.Context(permission.CtxApp, "-other-app-"),
+	})
+	body := strings.NewReader("idle=30")
+	request, err := http.NewRequest("POST", "/apps/"+a.Name+"/auto-sleep", body)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Authorization", "b "+token.GetValue())
+	recorder := httptest.NewRecorder()
+	m := RunServer(true)
+	m.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusForbidden)
+}
+
+func (s *S) TestUnsetAutoSleep(c *check.C) {
+	a := s.createRouterApp(c)
+	err := a.SetAutoSleep(&app.AutoSleep{IdleMinutes: 30})
+	c.Assert(err, check.IsNil)
+	request, err := http.NewRequest("DELETE", "/apps/"+a.Name+"/auto-sleep", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "b "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	m := RunServer(true)
+	m.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK, check.Commentf("body: %s", recorder.Body.String()))
+	dbApp, err := app.GetByName(a.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(dbApp.AutoSleep, check.IsNil)
+	c.Assert(eventtest.EventDesc{
+		Target: appTarget(a.Name),
+		Owner:  s.token.GetUserName(),
+		Kind:   "app.update.auto-sleep.unset",
+		StartCustomData: []map[string]interface{}{
+			{"name": ":app", "value": a.Name},
+		},
+	}, eventtest.HasEvent)
+}
+
+func (s *S) TestGetAutoSleep(c *check.C) {
+	a := s.createRouterApp(c)
+	err := a.SetAutoSleep(&app.AutoSleep{IdleMinutes: 30})
+	c.Assert(err, check.IsNil)
+	request, err := http.NewRequest("GET", "/apps/"+a.Name+"/auto-sleep", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "b "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	m := RunServer(true)
+	m.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK, check.Commentf("body: %s", recorder.Body.String()))
+	c.Assert(recorder.Header().Get("Content-Type"), check.Equals, "application/json")
+	var status app.AutoSleepStatus
+	err = json.NewDecoder(recorder.Body).Decode(&status)
+	c.Assert(err, check.IsNil)
+	c.Assert(status.App, check.Equals, a.Name)
+	c.Assert(status.IdleMinutes, check.Equals, 30)
+	c.Assert(status.Asleep, check.Equals, false)
+}
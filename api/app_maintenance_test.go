@@ -0,0 +1,96 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	"github.com/tsuru/tsuru/app"
+	"github.com/tsuru/tsuru/event/eventtest"
+	"github.com/tsuru/tsuru/permission"
+	"github.com/tsuru/tsuru/router/routertest"
+	"gopkg.in/check.v1"
+)
+
+func (s *S) TestSetMaintenance(c *check.C) {
+	a := s.createRouterApp(c)
+	body := strings.NewReader("page=<h1>brb</h1>")
+	request, err := http.NewRequest("POST", "/apps/"+a.Name+"/maintenance", body)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Authorization", "b "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	m := RunServer(true)
+	m.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK, check.Commentf("body: %s", recorder.Body.String()))
+	page, ok := routertest.FakeRouter.MaintenancePage(a.Name)
+	c.Assert(ok, check.Equals, true)
+	c.Assert(page, check.Equals, "<h1>brb</h1>")
+	dbApp, err := app.GetByName(a.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(dbApp.Maintenance, check.DeepEquals, &app.Maintenance{Page: "<h1>brb</h1>"})
+	c.Assert(eventtest.EventDesc{
+		Target: appTarget(a.Name),
+		Owner:  s.token.GetUserName(),
+		Kind:   "app.update.maintenance.set",
+		StartCustomData: []map[string]interface{}{
+			{"name": "page", "value": "<h1>brb</h1>"},
+			{"name": ":app", "value": a.Name},
+		},
+	}, eventtest.HasEvent)
+}
+
+func (s *S) TestSetMaintenanceForbidden(c *check.C) {
+	a := s.createRouterApp(c)
+	token := userWithPermission(c, permission.Permission{
+		Scheme:  permission.PermAppUpdateMaintenanceSet,
+		Context: permission.Context(permission.CtxApp, "-other-app-"),
+	})
+	request, err := http.NewRequest("POST", "/apps/"+a.Name+"/maintenance", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "b "+token.GetValue())
+	recorder := httptest.NewRecorder()
+	m := RunServer(true)
+	m.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusForbidden)
+	_, ok := routertest.FakeRouter.MaintenancePage(a.Name)
+	c.Assert(ok, check.Equals, false)
+}
+
+func (s *S) TestUnsetMaintenance(c *check.C) {
+	a := s.createRouterApp(c)
+	err := a.SetMaintenance("")
+	c.Assert(err, check.IsNil)
+	request, err := http.NewRequest("DELETE", "/apps/"+a.Name+"/maintenance", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "b "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	m := RunServer(true)
+	m.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK, check.Commentf("body: %s", recorder.Body.String()))
+	_, ok := routertest.FakeRouter.MaintenancePage(a.Name)
+	c.Assert(ok, check.Equals, false)
+	c.Assert(eventtest.EventDesc{
+		Target: appTarget(a.Name),
+		Owner:  s.token.GetUserName(),
+		Kind:   "app.update.maintenance.unset",
+		StartCustomData: []map[string]interface{}{
+			{"name": ":app", "value": a.Name},
+		},
+	}, eventtest.HasEvent)
+}
+
+func (s *S) TestUnsetMaintenanceNotInMaintenance(c *check.C) {
+	a := s.createRouterApp(c)
+	request, err := http.NewRequest("DELETE", "/apps/"+a.Name+"/maintenance", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "b "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	m := RunServer(true)
+	m.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusConflict)
+}
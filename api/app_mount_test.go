@@ -0,0 +1,172 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	"github.com/tsuru/tsuru/app"
+	"github.com/tsuru/tsuru/event/eventtest"
+	"github.com/tsuru/tsuru/permission"
+	"github.com/tsuru/tsuru/router/routertest"
+	"gopkg.in/check.v1"
+)
+
+func (s *S) TestAddAppMount(c *check.C) {
+	a := s.createRouterApp(c)
+	body := strings.NewReader("domain=api.example.com&path=/billing&strip=true")
+	request, err := http.NewRequest("POST", "/apps/"+a.Name+"/mounts", body)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Authorization", "b "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	m := RunServer(true)
+	m.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK, check.Commentf("body: %s", recorder.Body.String()))
+	c.Assert(routertest.FakeRouter.HasMount(a.Name, "api.example.com", "/billing"), check.Equals, true)
+	mounts, err := a.GetMounts()
+	c.Assert(err, check.IsNil)
+	c.Assert(mounts, check.HasLen, 1)
+	c.Assert(mounts[0].StripPrefix, check.Equals, true)
+	c.Assert(eventtest.EventDesc{
+		Target: appTarget(a.Name),
+		Owner:  s.token.GetUserName(),
+		Kind:   "app.update.mount.add",
+		StartCustomData: []map[string]interface{}{
+			{"name": "domain", "value": "api.example.com"},
+			{"name": "path", "value": "/billing"},
+			{"name": "strip", "value": "true"},
+			{"name": ":app", "value": a.Name},
+		},
+	}, eventtest.HasEvent)
+}
+
+func (s *S) TestAddAppMountConflict(c *check.C) {
+	a := s.createRouterApp(c)
+	err := a.AddMount("api.example.com", "/billing", false)
+	c.Assert(err, check.IsNil)
+	body := strings.NewReader("domain=api.example.com&path=/billing")
+	request, err := http.NewRequest("POST", "/apps/"+a.Name+"/mounts", body)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Authorization", "b "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	m := RunServer(true)
+	m.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusConflict)
+}
+
+func (s *S) TestAddAppMountInvalidPath(c *check.C) {
+	a := s.createRouterApp(c)
+	body := strings.NewReader("domain=api.example.com&path=/")
+	request, err := http.NewRequest("POST", "/apps/"+a.Name+"/mounts", body)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Authorization", "b "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	m := RunServer(true)
+	m.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusBadRequest)
+}
+
+func (s *S) TestAddAppMountWithoutDomain(c *check.C) {
+	a := s.createRouterApp(c)
+	request, err := http.NewRequest("POST", "/apps/"+a.Name+"/mounts", strings.NewReader("path=/billing"))
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Authorization", "b "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	m := RunServer(true)
+	m.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusBadRequest)
+	c.Assert(recorder.Body.String(), check.Equals, "You must provide the domain and the path of the mount.\n")
+}
+
+func (s *S) TestAddAppMountForbidden(c *check.C) {
+	a := s.createRouterApp(c)
+	token := userWithPermission(c, permission.Permission{
+		Scheme:  permission.PermAppUpdateMountAdd,
+		Context: permission.Context(permission.CtxApp, "-other-app-"),
+	})
+	body := strings.NewReader("domain=api.example.com&path=/billing")
+	request, err := http.NewRequest("POST", "/apps/"+a.Name+"/mounts", body)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Authorization", "b "+token.GetValue())
+	recorder := httptest.NewRecorder()
+	m := RunServer(true)
+	m.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusForbidden)
+	c.Assert(routertest.FakeRouter.HasMount(a.Name, "api.example.com", "/billing"), check.Equals, false)
+}
+
+func (s *S) TestRemoveAppMount(c *check.C) {
+	a := s.createRouterApp(c)
+	err := a.AddMount("api.example.com", "/billing", false)
+	c.Assert(err, check.IsNil)
+	request, err := http.NewRequest("DELETE", "/apps/"+a.Name+"/mounts?domain=api.example.com&path=/billing", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "b "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	m := RunServer(true)
+	m.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK, check.Commentf("body: %s", recorder.Body.String()))
+	c.Assert(routertest.FakeRouter.HasMount(a.Name, "api.example.com", "/billing"), check.Equals, false)
+	c.Assert(eventtest.EventDesc{
+		Target: appTarget(a.Name),
+		Owner:  s.token.GetUserName(),
+		Kind:   "app.update.mount.remove",
+		StartCustomData: []map[string]interface{}{
+			{"name": "domain", "value": "api.example.com"},
+			{"name": "path", "value": "/billing"},
+			{"name": ":app", "value": a.Name},
+		},
+	}, eventtest.HasEvent)
+}
+
+func (s *S) TestRemoveAppMountNotFound(c *check.C) {
+	a := s.createRouterApp(c)
+	request, err := http.NewRequest("DELETE", "/apps/"+a.Name+"/mounts?domain=api.example.com&path=/billing", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "b "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	m := RunServer(true)
+	m.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusNotFound)
+}
+
+func (s *S) TestListAppMounts(c *check.C) {
+	a := s.createRouterApp(c)
+	err := a.AddMount("api.example.com", "/billing", true)
+	c.Assert(err, check.IsNil)
+	request, err := http.NewRequest("GET", "/apps/"+a.Name+"/mounts", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "b "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	m := RunServer(true)
+	m.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	c.Assert(recorder.Header().Get("Content-Type"), check.Equals, "application/json")
+	var mounts []app.Mount
+	err = json.Unmarshal(recorder.Body.Bytes(), &mounts)
+	c.Assert(err, check.IsNil)
+	c.Assert(mounts, check.DeepEquals, []app.Mount{
+		{App: a.Name, Domain: "api.example.com", Path: "/billing", StripPrefix: true},
+	})
+}
+
+func (s *S) TestListAppMountsEmpty(c *check.C) {
+	a := s.createRouterApp(c)
+	request, err := http.NewRequest("GET", "/apps/"+a.Name+"/mounts", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "b "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	m := RunServer(true)
+	m.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusNoContent)
+}
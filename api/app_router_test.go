@@ -0,0 +1,175 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	"github.com/tsuru/tsuru/app"
+	"github.com/tsuru/tsuru/event/eventtest"
+	"github.com/tsuru/tsuru/permission"
+	"github.com/tsuru/tsuru/provision"
+	"github.com/tsuru/tsuru/router/routertest"
+	"gopkg.in/check.v1"
+)
+
+func (s *S) createRouterApp(c *check.C) *app.App {
+	a := &app.App{
+		Name:      "myapp",
+		Platform:  "zend",
+		Teams:     []string{s.team.Name},
+		TeamOwner: s.team.Name,
+		Plan:      app.Plan{Router: "fake"},
+	}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, check.IsNil)
+	err = s.provisioner.Provision(a)
+	c.Assert(err, check.IsNil)
+	return a
+}
+
+func (s *S) TestAddAppRouter(c *check.C) {
+	a := s.createRouterApp(c)
+	body := strings.NewReader("name=fake-hc&opts.opt1=val1")
+	request, err := http.NewRequest("POST", "/apps/"+a.Name+"/routers", body)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Authorization", "b "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	m := RunServer(true)
+	m.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK, check.Commentf("body: %s", recorder.Body.String()))
+	c.Assert(routertest.HCRouter.HasBackend(a.Name), check.Equals, true)
+	dbApp, err := app.GetByName(a.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(dbApp.Routers, check.DeepEquals, []provision.AppRouter{
+		{Name: "fake-hc", Opts: map[string]string{"opt1": "val1"}},
+	})
+	c.Assert(eventtest.EventDesc{
+		Target: appTarget(a.Name),
+		Owner:  s.token.GetUserName(),
+		Kind:   "app.update.router.add",
+		StartCustomData: []map[string]interface{}{
+			{"name": "name", "value": "fake-hc"},
+			{"name": "opts.opt1", "value": "val1"},
+			{"name": ":app", "value": a.Name},
+		},
+	}, eventtest.HasEvent)
+}
+
+func (s *S) TestAddAppRouterAlreadyAdded(c *check.C) {
+	a := s.createRouterApp(c)
+	request, err := http.NewRequest("POST", "/apps/"+a.Name+"/routers", strings.NewReader("name=fake"))
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Authorization", "b "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	m := RunServer(true)
+	m.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusConflict)
+}
+
+func (s *S) TestAddAppRouterWithoutName(c *check.C) {
+	a := s.createRouterApp(c)
+	request, err := http.NewRequest("POST", "/apps/"+a.Name+"/routers", strings.NewReader(""))
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Authorization", "b "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	m := RunServer(true)
+	m.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusBadRequest)
+	c.Assert(recorder.Body.String(), check.Equals, "You must provide the name of the router.\n")
+}
+
+func (s *S) TestAddAppRouterForbidden(c *check.C) {
+	a := s.createRouterApp(c)
+	token := userWithPermission(c, permission.Permission{
+		Scheme:  permission.PermAppUpdateRouterAdd,
+		Context: permission.Context(permission.CtxApp, "-other-app-"),
+	})
+	request, err := http.NewRequest("POST", "/apps/"+a.Name+"/routers", strings.NewReader("name=fake-hc"))
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Authorization", "b "+token.GetValue())
+	recorder := httptest.NewRecorder()
+	m := RunServer(true)
+	m.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusForbidden)
+	c.Assert(routertest.HCRouter.HasBackend(a.Name), check.Equals, false)
+}
+
+func (s *S) TestRemoveAppRouter(c *check.C) {
+	a := s.createRouterApp(c)
+	err := a.AddRouter(provision.AppRouter{Name: "fake-hc"})
+	c.Assert(err, check.IsNil)
+	request, err := http.NewRequest("DELETE", "/apps/"+a.Name+"/routers/fake-hc", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "b "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	m := RunServer(true)
+	m.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK, check.Commentf("body: %s", recorder.Body.String()))
+	c.Assert(routertest.HCRouter.HasBackend(a.Name), check.Equals, false)
+	dbApp, err := app.GetByName(a.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(dbApp.Routers, check.HasLen, 0)
+	c.Assert(eventtest.EventDesc{
+		Target: appTarget(a.Name),
+		Owner:  s.token.GetUserName(),
+		Kind:   "app.update.router.remove",
+		StartCustomData: []map[string]interface{}{
+			{"name": ":app", "value": a.Name},
+			{"name": ":router", "value": "fake-hc"},
+		},
+	}, eventtest.HasEvent)
+}
+
+func (s *S) TestRemoveAppRouterPlanRouter(c *check.C) {
+	a := s.createRouterApp(c)
+	request, err := http.NewRequest("DELETE", "/apps/"+a.Name+"/routers/fake", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "b "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	m := RunServer(true)
+	m.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusBadRequest)
+	c.Assert(routertest.FakeRouter.HasBackend(a.Name), check.Equals, true)
+}
+
+func (s *S) TestRemoveAppRouterNotFound(c *check.C) {
+	a := s.createRouterApp(c)
+	request, err := http.NewRequest("DELETE", "/apps/"+a.Name+"/routers/fake-hc", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "b "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	m := RunServer(true)
+	m.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusNotFound)
+}
+
+func (s *S) TestListAppRouters(c *check.C) {
+	a := s.createRouterApp(c)
+	err := a.AddRouter(provision.AppRouter{Name: "fake-hc", Opts: map[string]string{"opt1": "val1"}})
+	c.Assert(err, check.IsNil)
+	request, err := http.NewRequest("GET", "/apps/"+a.Name+"/routers", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "b "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	m := RunServer(true)
+	m.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	c.Assert(recorder.Header().Get("Content-Type"), check.Equals, "application/json")
+	var routers []provision.AppRouter
+	err = json.NewDecoder(recorder.Body).Decode(&routers)
+	c.Assert(err, check.IsNil)
+	c.Assert(routers, check.DeepEquals, []provision.AppRouter{
+		{Name: "fake", Address: "myapp.fakerouter.com"},
+		{Name: "fake-hc", Opts: map[string]string{"opt1": "val1"}, Address: "myapp.fakerouter.com"},
+	})
+}
@@ -5092,3 +5092,38 @@ func (s *S) TestRebuildRoutes(c *check.C) {
 	json.Unmarshal(recorder.Body.Bytes(), &parsed)
 	c.Assert(parsed, check.DeepEquals, app.RebuildRoutesResult{})
 }
+
+func (s *S) TestRoutesDrift(c *check.C) {
+	drift := app.RoutesDrift{App: "myapp", Router: "fake", ExtraRoutes: []string{"10.0.0.1:8080"}}
+	err := s.conn.Collection("routes_drift").Insert(drift)
+	c.Assert(err, check.IsNil)
+	request, err := http.NewRequest("GET", "/routes/drift", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	m := RunServer(true)
+	m.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	c.Assert(recorder.Header().Get("Content-Type"), check.Equals, "application/json")
+	var summary app.RoutesDriftSummary
+	err = json.Unmarshal(recorder.Body.Bytes(), &summary)
+	c.Assert(err, check.IsNil)
+	c.Assert(summary.OutOfSync, check.DeepEquals, []string{"myapp"})
+	c.Assert(summary.ExtraRoutes, check.Equals, 1)
+	c.Assert(summary.Drifts, check.HasLen, 1)
+	c.Assert(summary.Drifts[0].ExtraRoutes, check.DeepEquals, []string{"10.0.0.1:8080"})
+}
+
+func (s *S) TestRoutesDriftForbidden(c *check.C) {
+	token := userWithPermission(c, permission.Permission{
+		Scheme:  permission.PermAppAdminRoutes,
+		Context: permission.Context(permission.CtxApp, "myapp"),
+	})
+	request, err := http.NewRequest("GET", "/routes/drift", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+token.GetValue())
+	recorder := httptest.NewRecorder()
+	m := RunServer(true)
+	m.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusForbidden)
+}
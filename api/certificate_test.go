@@ -0,0 +1,289 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package api
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/tsuru/config"
+	"github.com/tsuru/tsuru/app"
+	"github.com/tsuru/tsuru/event/eventtest"
+	"github.com/tsuru/tsuru/permission"
+	"github.com/tsuru/tsuru/router"
+	"github.com/tsuru/tsuru/router/routertest"
+	"gopkg.in/check.v1"
+	"gopkg.in/mgo.v2/bson"
+)
+
+func generateCertificate(c *check.C, hostname string) (string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	c.Assert(err, check.IsNil)
+	template := x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: hostname},
+		DNSNames:     []string{hostname},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(90 * 24 * time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, &template, &template, &key.PublicKey, key)
+	c.Assert(err, check.IsNil)
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	c.Assert(err, check.IsNil)
+	cert := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPem := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer})
+	return string(cert), string(keyPem)
+}
+
+func (s *S) createCertificateApp(c *check.C) *app.App {
+	a := &app.App{
+		Name:      "myapp",
+		Platform:  "zend",
+		Teams:     []string{s.team.Name},
+		TeamOwner: s.team.Name,
+		Ip:        "myapp.fakerouter.com",
+		CName:     []string{"myapp.io"},
+		Plan:      app.Plan{Router: "fake"},
+	}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, check.IsNil)
+	err = s.provisioner.Provision(a)
+	c.Assert(err, check.IsNil)
+	return a
+}
+
+func (s *S) TestSetCertificate(c *check.C) {
+	a := s.createCertificateApp(c)
+	cert, key := generateCertificate(c, "myapp.io")
+	body := strings.NewReader(url.Values{"cname": {"myapp.io"}, "certificate": {cert}, "key": {key}}.Encode())
+	request, err := http.NewRequest("PUT", "/apps/"+a.Name+"/certificate", body)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Authorization", "b "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	m := RunServer(true)
+	m.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK, check.Commentf("body: %s", recorder.Body.String()))
+	routerCert, err := routertest.FakeRouter.Certificate(a.Name, "myapp.io")
+	c.Assert(err, check.IsNil)
+	c.Assert(routerCert, check.Equals, cert)
+	c.Assert(eventtest.EventDesc{
+		Target: appTarget(a.Name),
+		Owner:  s.token.GetUserName(),
+		Kind:   "app.update.certificate.set",
+		StartCustomData: []map[string]interface{}{
+			{"name": "cname", "value": "myapp.io"},
+			{"name": "certificate", "value": cert},
+			{"name": ":app", "value": a.Name},
+		},
+	}, eventtest.HasEvent)
+}
+
+func (s *S) TestSetCertificateInvalidCertificate(c *check.C) {
+	a := s.createCertificateApp(c)
+	cert, key := generateCertificate(c, "other.io")
+	body := strings.NewReader(url.Values{"cname": {"myapp.io"}, "certificate": {cert}, "key": {key}}.Encode())
+	request, err := http.NewRequest("PUT", "/apps/"+a.Name+"/certificate", body)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Authorization", "b "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	m := RunServer(true)
+	m.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusBadRequest)
+	c.Assert(recorder.Body.String(), check.Matches, ".*not myapp.io.*")
+}
+
+func (s *S) TestSetCertificateWithoutKey(c *check.C) {
+	a := s.createCertificateApp(c)
+	body := strings.NewReader("cname=myapp.io&certificate=cert")
+	request, err := http.NewRequest("PUT", "/apps/"+a.Name+"/certificate", body)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Authorization", "b "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	m := RunServer(true)
+	m.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusBadRequest)
+	c.Assert(recorder.Body.String(), check.Equals, "You must provide the cname, the certificate and the key.\n")
+}
+
+func (s *S) TestSetCertificateForbidden(c *check.C) {
+	a := s.createCertificateApp(c)
+	token := userWithPermission(c, permission.Permission{
+		Scheme:  permission.PermAppUpdateCertificateSet,
+		Context: permission.Context(permission.CtxApp, "-other-app-"),
+	})
+	cert, key := generateCertificate(c, "myapp.io")
+	body := strings.NewReader(url.Values{"cname": {"myapp.io"}, "certificate": {cert}, "key": {key}}.Encode())
+	request, err := http.NewRequest("PUT", "/apps/"+a.Name+"/certificate", body)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Authorization", "b "+token.GetValue())
+	recorder := httptest.NewRecorder()
+	m := RunServer(true)
+	m.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusForbidden)
+}
+
+func (s *S) TestUnsetCertificate(c *check.C) {
+	a := s.createCertificateApp(c)
+	cert, key := generateCertificate(c, "myapp.io")
+	err := a.SetCertificate("myapp.io", cert, key)
+	c.Assert(err, check.IsNil)
+	request, err := http.NewRequest("DELETE", "/apps/"+a.Name+"/certificate?cname=myapp.io", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "b "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	m := RunServer(true)
+	m.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	_, err = routertest.FakeRouter.Certificate(a.Name, "myapp.io")
+	c.Assert(err, check.Equals, router.ErrCertificateNotFound)
+	c.Assert(eventtest.EventDesc{
+		Target: appTarget(a.Name),
+		Owner:  s.token.GetUserName(),
+		Kind:   "app.update.certificate.unset",
+		StartCustomData: []map[string]interface{}{
+			{"name": "cname", "value": "myapp.io"},
+			{"name": ":app", "value": a.Name},
+		},
+	}, eventtest.HasEvent)
+}
+
+func (s *S) TestUnsetCertificateNotFound(c *check.C) {
+	a := s.createCertificateApp(c)
+	request, err := http.NewRequest("DELETE", "/apps/"+a.Name+"/certificate?cname=myapp.io", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "b "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	m := RunServer(true)
+	m.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusNotFound)
+}
+
+func (s *S) TestListCertificates(c *check.C) {
+	a := s.createCertificateApp(c)
+	cert, key := generateCertificate(c, "myapp.io")
+	err := a.SetCertificate("myapp.io", cert, key)
+	c.Assert(err, check.IsNil)
+	request, err := http.NewRequest("GET", "/apps/"+a.Name+"/certificate", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "b "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	m := RunServer(true)
+	m.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	c.Assert(recorder.Header().Get("Content-Type"), check.Equals, "application/json")
+	var certs map[string]string
+	err = json.Unmarshal(recorder.Body.Bytes(), &certs)
+	c.Assert(err, check.IsNil)
+	c.Assert(certs, check.DeepEquals, map[string]string{
+		"myapp.fakerouter.com": "",
+		"myapp.io":             cert,
+	})
+}
+
+func (s *S) TestEnableACME(c *check.C) {
+	config.Set("routers:fake:acme-challenge-url", "http://tsuru.example.com")
+	defer config.Unset("routers:fake:acme-challenge-url")
+	a := s.createCertificateApp(c)
+	request, err := http.NewRequest("POST", "/apps/"+a.Name+"/acme", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "b "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	m := RunServer(true)
+	m.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK, check.Commentf("body: %s", recorder.Body.String()))
+	dbApp, err := app.GetByName(a.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(dbApp.ACME, check.Equals, true)
+	c.Assert(eventtest.EventDesc{
+		Target: appTarget(a.Name),
+		Owner:  s.token.GetUserName(),
+		Kind:   "app.update.certificate.acme",
+		StartCustomData: []map[string]interface{}{
+			{"name": "enabled", "value": true},
+		},
+	}, eventtest.HasEvent)
+}
+
+func (s *S) TestEnableACMEForbidden(c *check.C) {
+	a := s.createCertificateApp(c)
+	token := userWithPermission(c, permission.Permission{
+		Scheme:  permission.PermAppUpdateCertificateAcme,
+		Context: permission.Context(permission.CtxApp, "-other-app-"),
+	})
+	request, err := http.NewRequest("POST", "/apps/"+a.Name+"/acme", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "b "+token.GetValue())
+	recorder := httptest.NewRecorder()
+	m := RunServer(true)
+	m.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusForbidden)
+}
+
+func (s *S) TestEnableACMEChallengeNotForwarded(c *check.C) {
+	a := s.createCertificateApp(c)
+	request, err := http.NewRequest("POST", "/apps/"+a.Name+"/acme", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "b "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	m := RunServer(true)
+	m.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusBadRequest)
+	c.Assert(recorder.Body.String(), check.Equals, app.ErrACMENotForwarded.Error()+"\n")
+}
+
+func (s *S) TestDisableACME(c *check.C) {
+	config.Set("routers:fake:acme-challenge-url", "http://tsuru.example.com")
+	defer config.Unset("routers:fake:acme-challenge-url")
+	a := s.createCertificateApp(c)
+	err := a.SetACME(true)
+	c.Assert(err, check.IsNil)
+	request, err := http.NewRequest("DELETE", "/apps/"+a.Name+"/acme", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "b "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	m := RunServer(true)
+	m.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK, check.Commentf("body: %s", recorder.Body.String()))
+	dbApp, err := app.GetByName(a.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(dbApp.ACME, check.Equals, false)
+}
+
+func (s *S) TestACMEChallenge(c *check.C) {
+	err := s.conn.Collection("acme_challenges").Insert(bson.M{"_id": "mytoken", "domain": "myapp.io", "keyauth": "mytoken.thumbprint"})
+	c.Assert(err, check.IsNil)
+	request, err := http.NewRequest("GET", "/.well-known/acme-challenge/mytoken", nil)
+	c.Assert(err, check.IsNil)
+	recorder := httptest.NewRecorder()
+	m := RunServer(true)
+	m.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	c.Assert(recorder.Header().Get("Content-Type"), check.Equals, "text/plain")
+	c.Assert(recorder.Body.String(), check.Equals, "mytoken.thumbprint")
+}
+
+func (s *S) TestACMEChallengeNotFound(c *check.C) {
+	request, err := http.NewRequest("GET", "/.well-known/acme-challenge/unknown", nil)
+	c.Assert(err, check.IsNil)
+	recorder := httptest.NewRecorder()
+	m := RunServer(true)
+	m.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusNotFound)
+}
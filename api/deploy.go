@@ -169,6 +169,8 @@ func permSchemeForDeploy(opts app.DeployOptions) *permission.PermissionScheme {
 		return permission.PermAppDeployArchiveUrl
 	case app.DeployRollback:
 		return permission.PermAppDeployRollback
+	case app.DeployPromote:
+		return permission.PermAppDeployPromote
 	default:
 		return permission.PermAppDeploy
 	}
@@ -287,6 +289,83 @@ func deployRollback(w http.ResponseWriter, r *http.Request, t auth.Token) error
 	return nil
 }
 
+// title: promote
+// path: /apps/{appname}/deploy/promote
+// method: POST
+// consume: application/x-www-form-urlencoded
+// produce: application/x-json-stream
+// responses:
+//   200: OK
+//   400: Invalid data
+//   403: Forbidden
+//   404: Not found
+func deployPromote(w http.ResponseWriter, r *http.Request, t auth.Token) error {
+	appName := r.URL.Query().Get(":appname")
+	instance, err := app.GetByName(appName)
+	if err != nil {
+		return &errors.HTTP{Code: http.StatusNotFound, Message: fmt.Sprintf("App %s not found.", appName)}
+	}
+	sourceName := r.FormValue("from")
+	if sourceName == "" {
+		return &errors.HTTP{
+			Code:    http.StatusBadRequest,
+			Message: "you cannot promote without a source app",
+		}
+	}
+	if sourceName == appName {
+		return &errors.HTTP{
+			Code:    http.StatusBadRequest,
+			Message: "you cannot promote an image to the same app",
+		}
+	}
+	source, err := app.GetByName(sourceName)
+	if err != nil {
+		return &errors.HTTP{Code: http.StatusNotFound, Message: fmt.Sprintf("App %s not found.", sourceName)}
+	}
+	opts := app.DeployOptions{
+		App:         instance,
+		Image:       r.FormValue("image"),
+		User:        t.GetUserName(),
+		Origin:      "promote",
+		PromoteFrom: source.Name,
+	}
+	opts.GetKind()
+	for _, a := range []*app.App{instance, source} {
+		canPromote := permission.Check(t, permSchemeForDeploy(opts),
+			append(permission.Contexts(permission.CtxTeam, a.Teams),
+				permission.Context(permission.CtxApp, a.Name),
+				permission.Context(permission.CtxPool, a.Pool),
+			)...,
+		)
+		if !canPromote {
+			return &errors.HTTP{Code: http.StatusForbidden, Message: permission.ErrUnauthorized.Error()}
+		}
+	}
+	w.Header().Set("Content-Type", "application/x-json-stream")
+	keepAliveWriter := io.NewKeepAliveWriter(w, 30*time.Second, "")
+	defer keepAliveWriter.Stop()
+	writer := &io.SimpleJsonMessageEncoderWriter{Encoder: json.NewEncoder(keepAliveWriter)}
+	opts.OutputStream = writer
+	var imageID string
+	evt, err := event.New(&event.Opts{
+		Target:     appTarget(appName),
+		Kind:       permission.PermAppDeploy,
+		Owner:      t,
+		CustomData: opts,
+		Cancelable: true,
+	})
+	if err != nil {
+		return err
+	}
+	defer func() { evt.DoneCustomData(err, map[string]string{"image": imageID}) }()
+	opts.Event = evt
+	imageID, err = app.Deploy(opts)
+	if err != nil {
+		writer.Encode(io.SimpleJsonMessage{Error: err.Error()})
+	}
+	return nil
+}
+
 // title: deploy list
 // path: /deploys
 // method: GET
@@ -1141,6 +1141,93 @@ func (s *DeploySuite) TestDeployRollbackHandlerWithInexistVersion(c *check.C) {
 	}, eventtest.HasEvent)
 }
 
+func (s *DeploySuite) TestDeployPromoteHandler(c *check.C) {
+	user, _ := s.token.User()
+	a := app.App{Name: "otherapp", Platform: "python", TeamOwner: s.team.Name}
+	err := app.CreateApp(&a, user)
+	c.Assert(err, check.IsNil)
+	b := app.App{Name: "otherapp-staging", Platform: "python", TeamOwner: s.team.Name}
+	err = app.CreateApp(&b, user)
+	c.Assert(err, check.IsNil)
+	v := url.Values{}
+	v.Set("from", b.Name)
+	v.Set("image", "app-image")
+	u := fmt.Sprintf("/apps/%s/deploy/promote", a.Name)
+	request, err := http.NewRequest("POST", u, strings.NewReader(v.Encode()))
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	recorder := httptest.NewRecorder()
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	server := RunServer(true)
+	server.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	c.Assert(recorder.Header().Get("Content-Type"), check.Equals, "application/x-json-stream")
+	c.Assert(recorder.Body.String(), check.Equals, "{\"Message\":\"Promote deploy called\"}\n")
+	c.Assert(eventtest.EventDesc{
+		Target: appTarget(a.Name),
+		Owner:  s.token.GetUserName(),
+		Kind:   "app.deploy",
+		StartCustomData: map[string]interface{}{
+			"app.name":    a.Name,
+			"commit":      "",
+			"filesize":    0,
+			"kind":        "promote",
+			"archiveurl":  "",
+			"user":        s.token.GetUserName(),
+			"image":       "app-image",
+			"origin":      "promote",
+			"build":       false,
+			"rollback":    false,
+			"promotefrom": b.Name,
+		},
+		EndCustomData: map[string]interface{}{
+			"image": "app-image",
+		},
+	}, eventtest.HasEvent)
+}
+
+func (s *DeploySuite) TestDeployPromoteHandlerWithoutSource(c *check.C) {
+	user, _ := s.token.User()
+	a := app.App{Name: "otherapp", Platform: "python", TeamOwner: s.team.Name}
+	err := app.CreateApp(&a, user)
+	c.Assert(err, check.IsNil)
+	u := fmt.Sprintf("/apps/%s/deploy/promote", a.Name)
+	request, err := http.NewRequest("POST", u, nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	recorder := httptest.NewRecorder()
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	server := RunServer(true)
+	server.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusBadRequest)
+	c.Assert(recorder.Body.String(), check.Equals, "you cannot promote without a source app\n")
+}
+
+func (s *DeploySuite) TestDeployPromoteHandlerWithoutPermissionInSource(c *check.C) {
+	user, _ := s.token.User()
+	a := app.App{Name: "otherapp", Platform: "python", TeamOwner: s.team.Name}
+	err := app.CreateApp(&a, user)
+	c.Assert(err, check.IsNil)
+	b := app.App{Name: "otherapp-staging", Platform: "python", TeamOwner: s.team.Name}
+	err = app.CreateApp(&b, user)
+	c.Assert(err, check.IsNil)
+	token := customUserWithPermission(c, "promoteonlytarget", permission.Permission{
+		Scheme:  permission.PermAppDeployPromote,
+		Context: permission.Context(permission.CtxApp, a.Name),
+	})
+	v := url.Values{}
+	v.Set("from", b.Name)
+	u := fmt.Sprintf("/apps/%s/deploy/promote", a.Name)
+	request, err := http.NewRequest("POST", u, strings.NewReader(v.Encode()))
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	recorder := httptest.NewRecorder()
+	request.Header.Set("Authorization", "bearer "+token.GetValue())
+	server := RunServer(true)
+	server.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusForbidden)
+}
+
 func (s *DeploySuite) TestDiffDeploy(c *check.C) {
 	diff := `--- hello.go	2015-11-25 16:04:22.409241045 +0000
 +++ hello.go	2015-11-18 18:40:21.385697080 +0000
@@ -31,6 +31,7 @@ var evtPermMap = map[event.TargetType]evtPermChecker{
 	event.TargetTypeNode:            &nodePermChecker{},
 	event.TargetTypeIaas:            &iaasPermChecker{},
 	event.TargetTypeRole:            &rolePermChecker{},
+	event.TargetTypeNodeContainer:   &nodeContainerPermChecker{},
 }
 
 type checkKind string
@@ -391,6 +392,35 @@ func (c *nodePermChecker) check(t auth.Token, r *http.Request, e *event.Event, k
 	return hasPermission, nil
 }
 
+type nodeContainerPermChecker struct{}
+
+func (c *nodeContainerPermChecker) filter(t auth.Token) (*event.TargetFilter, error) {
+	contexts := permission.ContextsForPermission(t, permission.PermPoolReadEvents)
+	for _, ctx := range contexts {
+		if ctx.CtxType == permission.CtxGlobal {
+			return &event.TargetFilter{Type: event.TargetTypeNodeContainer}, nil
+		}
+	}
+	return nil, nil
+}
+
+func (c *nodeContainerPermChecker) check(t auth.Token, r *http.Request, e *event.Event, kind checkKind) (bool, error) {
+	ctx := []permission.PermissionContext{permission.Context(permission.CtxGlobal, "")}
+	for _, target := range e.ExtraTargets {
+		if target.Type == event.TargetTypePool {
+			ctx = []permission.PermissionContext{permission.Context(permission.CtxPool, target.Value)}
+		}
+	}
+	perms := map[checkKind]*permission.PermissionScheme{
+		readCheckKind:   permission.PermPoolReadEvents,
+		updateCheckKind: permission.PermPoolUpdateEvents,
+	}
+	return permission.Check(
+		t, perms[kind],
+		ctx...,
+	), nil
+}
+
 type rolePermChecker struct{}
 
 func (c *rolePermChecker) filter(t auth.Token) (*event.TargetFilter, error) {
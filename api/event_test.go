@@ -431,6 +431,22 @@ func (s *EventSuite) TestRolePermCheckerFilter(c *check.C) {
 	})
 }
 
+func (s *EventSuite) TestNodeContainerPermCheckerFilter(c *check.C) {
+	runTest := runPermTest(&nodeContainerPermChecker{}, c)
+	runTest(customUserWithPermission(c, "usera"), nil)
+	runTest(customUserWithPermission(c, "userb", permission.Permission{
+		Scheme:  permission.PermPoolReadEvents,
+		Context: permission.Context(permission.CtxPool, "pool1"),
+	}), nil)
+	runTest(customUserWithPermission(c, "userc", permission.Permission{
+		Scheme:  permission.PermPoolReadEvents,
+		Context: permission.Context(permission.CtxGlobal, ""),
+	}), &event.TargetFilter{
+		Type:   event.TargetTypeNodeContainer,
+		Values: nil,
+	})
+}
+
 func (s *EventSuite) TestEventListEmpty(c *check.C) {
 	request, err := http.NewRequest("GET", "/events", nil)
 	c.Assert(err, check.IsNil)
@@ -997,6 +1013,41 @@ func (s *EventSuite) TestEventInfoPoolWithoutPermission(c *check.C) {
 	c.Assert(recorder.Code, check.Equals, http.StatusForbidden)
 }
 
+func (s *EventSuite) TestEventInfoNodeContainerPoolPermission(c *check.C) {
+	token := customUserWithPermission(c, "myuser", permission.Permission{
+		Scheme:  permission.PermPoolReadEvents,
+		Context: permission.Context(permission.CtxPool, "test1"),
+	})
+	evt, err := event.New(&event.Opts{
+		Target:       event.Target{Type: event.TargetTypeNodeContainer, Value: "bs"},
+		ExtraTargets: []event.Target{{Type: event.TargetTypePool, Value: "test1"}},
+		Owner:        s.token,
+		Kind:         permission.PermNodecontainerUpdateUpgrade,
+	})
+	c.Assert(err, check.IsNil)
+	u := fmt.Sprintf("/events/%s", evt.UniqueID.Hex())
+	request, err := http.NewRequest("GET", u, nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+token.GetValue())
+	recorder := httptest.NewRecorder()
+	server := RunServer(true)
+	server.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	evt2, err := event.New(&event.Opts{
+		Target: event.Target{Type: event.TargetTypeNodeContainer, Value: "bs2"},
+		Owner:  s.token,
+		Kind:   permission.PermNodecontainerUpdateUpgrade,
+	})
+	c.Assert(err, check.IsNil)
+	u = fmt.Sprintf("/events/%s", evt2.UniqueID.Hex())
+	request, err = http.NewRequest("GET", u, nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+token.GetValue())
+	recorder = httptest.NewRecorder()
+	server.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusForbidden)
+}
+
 func (s *EventSuite) TestEventInfoUserPermission(c *check.C) {
 	token := customUserWithPermission(c, "myuser", permission.Permission{
 		Scheme:  permission.PermUserRead,
@@ -114,7 +114,8 @@ func templatesList(w http.ResponseWriter, r *http.Request, token auth.Token) err
 		}
 	}
 	for i := 0; allowedIaaS != nil && i < len(templates); i++ {
-		if _, ok := allowedIaaS[templates[i].IaaSName]; !ok {
+		iaasName, _ := templates[i].ResolveIaaSName()
+		if _, ok := allowedIaaS[iaasName]; !ok {
 			templates = append(templates[:i], templates[i+1:]...)
 			i--
 		}
@@ -143,14 +144,18 @@ func templateCreate(w http.ResponseWriter, r *http.Request, token auth.Token) (e
 	if err != nil {
 		return &errors.HTTP{Code: http.StatusBadRequest, Message: err.Error()}
 	}
+	iaasName, err := paramTemplate.ResolveIaaSName()
+	if err != nil {
+		return &errors.HTTP{Code: http.StatusBadRequest, Message: err.Error()}
+	}
 	allowed := permission.Check(token, permission.PermMachineTemplateCreate,
-		permission.Context(permission.CtxIaaS, paramTemplate.IaaSName),
+		permission.Context(permission.CtxIaaS, iaasName),
 	)
 	if !allowed {
 		return permission.ErrUnauthorized
 	}
 	evt, err := event.New(&event.Opts{
-		Target:     event.Target{Type: event.TargetTypeIaas, Value: paramTemplate.IaaSName},
+		Target:     event.Target{Type: event.TargetTypeIaas, Value: iaasName},
 		Kind:       permission.PermMachineTemplateCreate,
 		Owner:      token,
 		CustomData: formToEvents(r.Form),
@@ -174,6 +179,7 @@ func templateCreate(w http.ResponseWriter, r *http.Request, token auth.Token) (e
 //   200: OK
 //   401: Unauthorized
 //   404: Not found
+//   409: Template in use
 func templateDestroy(w http.ResponseWriter, r *http.Request, token auth.Token) (err error) {
 	r.ParseForm()
 	templateName := r.URL.Query().Get(":template_name")
@@ -184,14 +190,18 @@ func templateDestroy(w http.ResponseWriter, r *http.Request, token auth.Token) (
 		}
 		return err
 	}
+	iaasName, err := t.ResolveIaaSName()
+	if err != nil {
+		return err
+	}
 	allowed := permission.Check(token, permission.PermMachineTemplateDelete,
-		permission.Context(permission.CtxIaaS, t.IaaSName),
+		permission.Context(permission.CtxIaaS, iaasName),
 	)
 	if !allowed {
 		return permission.ErrUnauthorized
 	}
 	evt, err := event.New(&event.Opts{
-		Target:     event.Target{Type: event.TargetTypeIaas, Value: t.IaaSName},
+		Target:     event.Target{Type: event.TargetTypeIaas, Value: iaasName},
 		Kind:       permission.PermMachineTemplateDelete,
 		Owner:      token,
 		CustomData: formToEvents(r.Form),
@@ -200,7 +210,11 @@ func templateDestroy(w http.ResponseWriter, r *http.Request, token auth.Token) (
 		return err
 	}
 	defer func() { evt.Done(err) }()
-	return iaas.DestroyTemplate(templateName)
+	err = iaas.DestroyTemplate(templateName)
+	if inUseErr, ok := err.(*iaas.TemplateInUseError); ok {
+		return &errors.HTTP{Code: http.StatusConflict, Message: inUseErr.Error()}
+	}
+	return err
 }
 
 // title: template update
@@ -232,14 +246,18 @@ func templateUpdate(w http.ResponseWriter, r *http.Request, token auth.Token) (e
 		}
 		return err
 	}
+	iaasName, err := dbTpl.ResolveIaaSName()
+	if err != nil {
+		return err
+	}
 	allowed := permission.Check(token, permission.PermMachineTemplateUpdate,
-		permission.Context(permission.CtxIaaS, dbTpl.IaaSName),
+		permission.Context(permission.CtxIaaS, iaasName),
 	)
 	if !allowed {
 		return permission.ErrUnauthorized
 	}
 	evt, err := event.New(&event.Opts{
-		Target:     event.Target{Type: event.TargetTypeIaas, Value: dbTpl.IaaSName},
+		Target:     event.Target{Type: event.TargetTypeIaas, Value: iaasName},
 		Kind:       permission.PermMachineTemplateUpdate,
 		Owner:      token,
 		CustomData: formToEvents(r.Form),
@@ -8,6 +8,7 @@ import (
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"sort"
 	"strings"
 
@@ -15,6 +16,7 @@ import (
 	"github.com/tsuru/tsuru/event"
 	"github.com/tsuru/tsuru/event/eventtest"
 	"github.com/tsuru/tsuru/iaas"
+	"github.com/tsuru/tsuru/permission"
 	"gopkg.in/check.v1"
 )
 
@@ -201,6 +203,81 @@ func (s *S) TestTemplateCreate(c *check.C) {
 	}, eventtest.HasEvent)
 }
 
+func (s *S) TestTemplateCreateWithParentAndParams(c *check.C) {
+	iaas.RegisterIaasProvider("my-iaas", newTestIaaS)
+	parent := iaas.Template{Name: "parent-tpl", IaaSName: "my-iaas"}
+	err := parent.Save()
+	c.Assert(err, check.IsNil)
+	defer iaas.DestroyTemplate("parent-tpl")
+	data := iaas.Template{
+		Name:   "my-tpl",
+		Parent: "parent-tpl",
+		Params: iaas.TemplateParamList{
+			{Name: "size", Required: true, Values: []string{"small", "large"}},
+			{Name: "count", Type: iaas.TemplateParamInt, Default: "1"},
+		},
+	}
+	v, err := form.EncodeToValues(&data)
+	c.Assert(err, check.IsNil)
+	recorder := httptest.NewRecorder()
+	request, err := http.NewRequest("POST", "/iaas/templates", strings.NewReader(v.Encode()))
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	m := RunServer(true)
+	m.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusCreated)
+	defer iaas.DestroyTemplate("my-tpl")
+	tpl, err := iaas.FindTemplate("my-tpl")
+	c.Assert(err, check.IsNil)
+	c.Assert(tpl.Parent, check.Equals, "parent-tpl")
+	c.Assert(tpl.Params, check.DeepEquals, data.Params)
+}
+
+func (s *S) TestTemplateCreateChildWithIaaSScopedPermission(c *check.C) {
+	iaas.RegisterIaasProvider("my-iaas", newTestIaaS)
+	parent := iaas.Template{Name: "parent-tpl", IaaSName: "my-iaas"}
+	err := parent.Save()
+	c.Assert(err, check.IsNil)
+	defer iaas.DestroyTemplate("parent-tpl")
+	token := userWithPermission(c, permission.Permission{
+		Scheme:  permission.PermMachineTemplateCreate,
+		Context: permission.Context(permission.CtxIaaS, "my-iaas"),
+	})
+	v := url.Values{"Name": {"my-tpl"}, "Parent": {"parent-tpl"}}
+	recorder := httptest.NewRecorder()
+	request, err := http.NewRequest("POST", "/iaas/templates", strings.NewReader(v.Encode()))
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Authorization", "bearer "+token.GetValue())
+	m := RunServer(true)
+	m.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusCreated, check.Commentf("body: %s", recorder.Body.String()))
+	defer iaas.DestroyTemplate("my-tpl")
+	c.Assert(eventtest.EventDesc{
+		Target: event.Target{Type: event.TargetTypeIaas, Value: "my-iaas"},
+		Owner:  token.GetUserName(),
+		Kind:   "machine.template.create",
+		StartCustomData: []map[string]interface{}{
+			{"name": "Name", "value": "my-tpl"},
+			{"name": "Parent", "value": "parent-tpl"},
+		},
+	}, eventtest.HasEvent)
+}
+
+func (s *S) TestTemplateCreateParentNotFound(c *check.C) {
+	v := url.Values{"Name": {"my-tpl"}, "Parent": {"unknown"}}
+	recorder := httptest.NewRecorder()
+	request, err := http.NewRequest("POST", "/iaas/templates", strings.NewReader(v.Encode()))
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	m := RunServer(true)
+	m.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusBadRequest)
+	c.Assert(recorder.Body.String(), check.Equals, "parent template \"unknown\" not found\n")
+}
+
 func (s *S) TestTemplateCreateBadRequest(c *check.C) {
 	iaas.RegisterIaasProvider("my-iaas", newTestIaaS)
 	recorder := httptest.NewRecorder()
@@ -245,6 +322,27 @@ func (s *S) TestTemplateDestroy(c *check.C) {
 	}, eventtest.HasEvent)
 }
 
+func (s *S) TestTemplateDestroyParentInUse(c *check.C) {
+	iaas.RegisterIaasProvider("ec2", newTestIaaS)
+	parent := iaas.Template{Name: "parent-tpl", IaaSName: "ec2"}
+	err := parent.Save()
+	c.Assert(err, check.IsNil)
+	defer iaas.DestroyTemplate("parent-tpl")
+	child := iaas.Template{Name: "child-tpl", Parent: "parent-tpl"}
+	err = child.Save()
+	c.Assert(err, check.IsNil)
+	defer iaas.DestroyTemplate("child-tpl")
+	recorder := httptest.NewRecorder()
+	request, err := http.NewRequest("DELETE", "/iaas/templates/parent-tpl", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	m := RunServer(true)
+	m.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusConflict)
+	_, err = iaas.FindTemplate("parent-tpl")
+	c.Assert(err, check.IsNil)
+}
+
 func (s *S) TestTemplateUpdate(c *check.C) {
 	iaas.RegisterIaasProvider("my-iaas", newTestIaaS)
 	tpl1 := iaas.Template{
@@ -129,6 +129,27 @@ func RunServer(dry bool) http.Handler {
 	m.Add("1.0", "Get", "/apps/{app}", AuthorizationRequiredHandler(appInfo))
 	m.Add("1.0", "Post", "/apps/{app}/cname", AuthorizationRequiredHandler(setCName))
 	m.Add("1.0", "Delete", "/apps/{app}/cname", AuthorizationRequiredHandler(unsetCName))
+	m.Add("1.0", "Put", "/apps/{app}/certificate", AuthorizationRequiredHandler(setCertificate))
+	m.Add("1.0", "Delete", "/apps/{app}/certificate", AuthorizationRequiredHandler(unsetCertificate))
+	m.Add("1.0", "Get", "/apps/{app}/certificate", AuthorizationRequiredHandler(listCertificates))
+	m.Add("1.0", "Post", "/apps/{app}/acme", AuthorizationRequiredHandler(enableACME))
+	m.Add("1.0", "Delete", "/apps/{app}/acme", AuthorizationRequiredHandler(disableACME))
+	m.Add("1.0", "Get", "/.well-known/acme-challenge/{token}", Handler(acmeChallenge))
+	m.Add("1.0", "Post", "/apps/{app}/routers", AuthorizationRequiredHandler(addAppRouter))
+	m.Add("1.0", "Delete", "/apps/{app}/routers/{router}", AuthorizationRequiredHandler(removeAppRouter))
+	m.Add("1.0", "Get", "/apps/{app}/routers", AuthorizationRequiredHandler(listAppRouters))
+	m.Add("1.0", "Post", "/apps/{app}/mounts", AuthorizationRequiredHandler(addAppMount))
+	m.Add("1.0", "Delete", "/apps/{app}/mounts", AuthorizationRequiredHandler(removeAppMount))
+	m.Add("1.0", "Get", "/apps/{app}/mounts", AuthorizationRequiredHandler(listAppMounts))
+	m.Add("1.0", "Post", "/apps/{app}/access-policy", AuthorizationRequiredHandler(setAccessPolicy))
+	m.Add("1.0", "Delete", "/apps/{app}/access-policy", AuthorizationRequiredHandler(unsetAccessPolicy))
+	m.Add("1.0", "Get", "/apps/{app}/access-policy", AuthorizationRequiredHandler(getAccessPolicy))
+	m.Add("1.0", "Post", "/apps/{app}/maintenance", AuthorizationRequiredHandler(setMaintenance))
+	m.Add("1.0", "Delete", "/apps/{app}/maintenance", AuthorizationRequiredHandler(unsetMaintenance))
+	m.Add("1.0", "Post", "/apps/{app}/auto-sleep", AuthorizationRequiredHandler(setAutoSleep))
+	m.Add("1.0", "Delete", "/apps/{app}/auto-sleep", AuthorizationRequiredHandler(unsetAutoSleep))
+	m.Add("1.0", "Get", "/apps/{app}/auto-sleep", AuthorizationRequiredHandler(getAutoSleep))
+	m.Add("1.0", "Get", "/routes/drift", AuthorizationRequiredHandler(routesDrift))
 	runHandler := AuthorizationRequiredHandler(runCommand)
 	m.Add("1.0", "Post", "/apps/{app}/run", runHandler)
 	m.Add("1.0", "Post", "/apps/{app}/restart", AuthorizationRequiredHandler(restart))
@@ -157,6 +178,7 @@ func RunServer(dry bool) http.Handler {
 	logPostHandler := AuthorizationRequiredHandler(addLog)
 	m.Add("1.0", "Post", "/apps/{app}/log", logPostHandler)
 	m.Add("1.0", "Post", "/apps/{appname}/deploy/rollback", AuthorizationRequiredHandler(deployRollback))
+	m.Add("1.0", "Post", "/apps/{appname}/deploy/promote", AuthorizationRequiredHandler(deployPromote))
 	m.Add("1.0", "Get", "/apps/{app}/metric/envs", AuthorizationRequiredHandler(appMetricEnvs))
 	m.Add("1.0", "Post", "/apps/{app}/routes", AuthorizationRequiredHandler(appRebuildRoutes))
 
@@ -377,6 +399,24 @@ func RunServer(dry bool) http.Handler {
 				fatal(err)
 			}
 		}
+		certificateChecker := app.NewCertificateExpiryChecker()
+		certificateChecker.Start()
+		shutdown.Register(certificateChecker)
+		routesReconciler := app.NewRoutesReconciler()
+		routesReconciler.Start()
+		shutdown.Register(routesReconciler)
+		autoSleeper, err := app.NewAutoSleeper()
+		if err == nil {
+			autoSleeper.Start()
+			shutdown.Register(autoSleeper)
+			fmt.Printf("Putting idle apps to sleep with proxy %q.\n", autoSleeper.ProxyURL)
+		}
+		acmeWorker, err := app.NewACMEWorker()
+		if err == nil {
+			acmeWorker.Start()
+			shutdown.Register(acmeWorker)
+			fmt.Printf("Using ACME server %q for app certificates.\n", acmeWorker.DirectoryURL)
+		}
 		if messageProvisioner, ok := app.Provisioner.(provision.MessageProvisioner); ok {
 			startupMessage, err = messageProvisioner.StartupMessage()
 			if err == nil && startupMessage != "" {
@@ -90,6 +90,7 @@ func (s *S) SetUpSuite(c *check.C) {
 
 func (s *S) SetUpTest(c *check.C) {
 	routertest.FakeRouter.Reset()
+	routertest.HCRouter.Reset()
 	repositorytest.Reset()
 	var err error
 	s.conn, err = db.Conn()
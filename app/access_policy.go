@@ -0,0 +1,185 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package app
+
+import (
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base64"
+	stderr "errors"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/tsuru/tsuru/db"
+	"github.com/tsuru/tsuru/errors"
+	"github.com/tsuru/tsuru/log"
+	"github.com/tsuru/tsuru/router"
+	"gopkg.in/mgo.v2/bson"
+)
+
+var ErrAccessPolicyNotSupported = stderr.New("the routers of the app don't support access policies")
+
+// AccessPolicy is the access policy of an app, as provided by users. The
+// password of the basic auth is in plain text, and is hashed before the
+// policy is stored and sent to the routers.
+type AccessPolicy struct {
+	Allow             []string
+	Deny              []string
+	RateLimit         int
+	RateBurst         int
+	BasicAuthUser     string
+	BasicAuthPassword string
+}
+
+// routerPolicy validates the policy and converts it to the format used by
+// routers.
+func (p *AccessPolicy) routerPolicy() (router.AccessPolicy, error) {
+	var policy router.AccessPolicy
+	var err error
+	policy.Allow, err = parseNetworks(p.Allow)
+	if err != nil {
+		return policy, err
+	}
+	policy.Deny, err = parseNetworks(p.Deny)
+	if err != nil {
+		return policy, err
+	}
+	if p.RateLimit < 0 || p.RateBurst < 0 {
+		return policy, &errors.ValidationError{Message: "rate limit and burst must not be negative"}
+	}
+	if p.RateBurst > 0 && p.RateLimit == 0 {
+		return policy, &errors.ValidationError{Message: "rate burst requires a rate limit"}
+	}
+	policy.RateLimit = p.RateLimit
+	policy.RateBurst = p.RateBurst
+	if p.BasicAuthUser == "" && p.BasicAuthPassword == "" {
+		return policy, nil
+	}
+	if p.BasicAuthUser == "" || p.BasicAuthPassword == "" {
+		return policy, &errors.ValidationError{Message: "basic auth requires both user and password"}
+	}
+	if strings.ContainsAny(p.BasicAuthUser, ":\n") {
+		return policy, &errors.ValidationError{Message: "invalid basic auth user"}
+	}
+	hash, err := hashPassword(p.BasicAuthPassword)
+	if err != nil {
+		return policy, err
+	}
+	policy.BasicAuth = &router.BasicAuth{Username: p.BasicAuthUser, PasswordHash: hash}
+	return policy, nil
+}
+
+// parseNetworks validates a list of addresses in the CIDR notation, also
+// accepting single IPs, returning them in their canonical form.
+func parseNetworks(values []string) ([]string, error) {
+	var networks []string
+	for _, value := range values {
+		if value == "" {
+			continue
+		}
+		if ip := net.ParseIP(value); ip != nil {
+			if ip.To4() != nil {
+				value += "/32"
+			} else {
+				value += "/128"
+			}
+		}
+		_, network, err := net.ParseCIDR(value)
+		if err != nil {
+			return nil, &errors.ValidationError{Message: fmt.Sprintf("invalid network: %q", value)}
+		}
+		networks = append(networks, network.String())
+	}
+	return networks, nil
+}
+
+// hashPassword hashes a password using salted SHA-1, in the format supported
+// by htpasswd files.
+func hashPassword(password string) (string, error) {
+	salt := make([]byte, 8)
+	_, err := rand.Read(salt)
+	if err != nil {
+		return "", err
+	}
+	sum := sha1.Sum(append([]byte(password), salt...))
+	return "{SSHA}" + base64.StdEncoding.EncodeToString(append(sum[:], salt...)), nil
+}
+
+func (app *App) accessPolicyRouters() ([]router.AccessPolicyRouter, error) {
+	appRouters, err := app.GetRouters()
+	if err != nil {
+		return nil, err
+	}
+	routers := make([]router.AccessPolicyRouter, len(appRouters))
+	for i, appRouter := range appRouters {
+		r, err := router.Get(appRouter.Name)
+		if err != nil {
+			return nil, err
+		}
+		policyRouter, ok := r.(router.AccessPolicyRouter)
+		if !ok {
+			return nil, ErrAccessPolicyNotSupported
+		}
+		routers[i] = policyRouter
+	}
+	return routers, nil
+}
+
+// SetAccessPolicy validates the access policy and applies it to all the
+// routers of the app, replacing the previous policy. An empty policy removes
+// all the restrictions.
+func (app *App) SetAccessPolicy(p AccessPolicy) error {
+	policy, err := p.routerPolicy()
+	if err != nil {
+		return err
+	}
+	routers, err := app.accessPolicyRouters()
+	if err != nil {
+		return err
+	}
+	var previous router.AccessPolicy
+	if app.AccessPolicy != nil {
+		previous = *app.AccessPolicy
+	}
+	for i, r := range routers {
+		err = r.SetAccessPolicy(app.Name, policy)
+		if err != nil {
+			for _, done := range routers[:i] {
+				if rollbackErr := done.SetAccessPolicy(app.Name, previous); rollbackErr != nil {
+					log.Errorf("[set-access-policy] unable to restore access policy of app %q: %s", app.Name, rollbackErr)
+				}
+			}
+			return err
+		}
+	}
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if policy.Empty() {
+		err = conn.Apps().Update(bson.M{"name": app.Name}, bson.M{"$unset": bson.M{"accesspolicy": ""}})
+		app.AccessPolicy = nil
+	} else {
+		err = conn.Apps().Update(bson.M{"name": app.Name}, bson.M{"$set": bson.M{"accesspolicy": policy}})
+		app.AccessPolicy = &policy
+	}
+	return err
+}
+
+// restoreAccessPolicy applies the stored access policy of the app to a
+// router. Routers that don't support access policies are rejected when the
+// app has a policy, so that the app is never exposed without restrictions.
+func (app *App) restoreAccessPolicy(r router.Router) error {
+	if app.AccessPolicy == nil {
+		return nil
+	}
+	policyRouter, ok := r.(router.AccessPolicyRouter)
+	if !ok {
+		return ErrAccessPolicyNotSupported
+	}
+	return policyRouter.SetAccessPolicy(app.Name, *app.AccessPolicy)
+}
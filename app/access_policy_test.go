@@ -0,0 +1,131 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package app
+
+import (
+	"crypto/sha1"
+	"encoding/base64"
+	"strings"
+
+	"github.com/tsuru/tsuru/errors"
+	"github.com/tsuru/tsuru/provision"
+	"github.com/tsuru/tsuru/router"
+	"github.com/tsuru/tsuru/router/routertest"
+	"gopkg.in/check.v1"
+)
+
+func (s *S) TestSetAccessPolicy(c *check.C) {
+	a := s.createRouterApp(c)
+	defer s.provisioner.Destroy(a)
+	err := a.SetAccessPolicy(AccessPolicy{
+		Allow:             []string{"10.0.0.0/8", "192.168.0.1"},
+		Deny:              []string{"10.1.2.3/16"},
+		RateLimit:         10,
+		RateBurst:         20,
+		BasicAuthUser:     "user",
+		BasicAuthPassword: "secret",
+	})
+	c.Assert(err, check.IsNil)
+	policy, ok := routertest.FakeRouter.AccessPolicy(a.Name)
+	c.Assert(ok, check.Equals, true)
+	c.Assert(policy.Allow, check.DeepEquals, []string{"10.0.0.0/8", "192.168.0.1/32"})
+	c.Assert(policy.Deny, check.DeepEquals, []string{"10.1.0.0/16"})
+	c.Assert(policy.RateLimit, check.Equals, 10)
+	c.Assert(policy.RateBurst, check.Equals, 20)
+	c.Assert(policy.BasicAuth.Username, check.Equals, "user")
+	c.Assert(policy.BasicAuth.PasswordHash, check.Not(check.Matches), ".*secret.*")
+	dbApp, err := GetByName(a.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(dbApp.AccessPolicy, check.DeepEquals, &policy)
+}
+
+func (s *S) TestSetAccessPolicyEmpty(c *check.C) {
+	a := s.createRouterApp(c)
+	defer s.provisioner.Destroy(a)
+	err := a.SetAccessPolicy(AccessPolicy{RateLimit: 10})
+	c.Assert(err, check.IsNil)
+	err = a.SetAccessPolicy(AccessPolicy{})
+	c.Assert(err, check.IsNil)
+	_, ok := routertest.FakeRouter.AccessPolicy(a.Name)
+	c.Assert(ok, check.Equals, false)
+	dbApp, err := GetByName(a.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(dbApp.AccessPolicy, check.IsNil)
+}
+
+func (s *S) TestSetAccessPolicyInvalid(c *check.C) {
+	a := s.createRouterApp(c)
+	defer s.provisioner.Destroy(a)
+	tests := []AccessPolicy{
+		{Allow: []string{"10.0.0.0/33"}},
+		{Deny: []string{"invalid"}},
+		{RateLimit: -1},
+		{RateBurst: 10},
+		{BasicAuthUser: "user"},
+		{BasicAuthPassword: "secret"},
+		{BasicAuthUser: "us:er", BasicAuthPassword: "secret"},
+	}
+	for _, tt := range tests {
+		err := a.SetAccessPolicy(tt)
+		c.Check(err, check.FitsTypeOf, &errors.ValidationError{}, check.Commentf("%#v", tt))
+	}
+	_, ok := routertest.FakeRouter.AccessPolicy(a.Name)
+	c.Assert(ok, check.Equals, false)
+}
+
+func (s *S) TestSetAccessPolicyMultipleRouters(c *check.C) {
+	a := s.createRouterApp(c)
+	defer s.provisioner.Destroy(a)
+	err := a.AddRouter(provision.AppRouter{Name: "fake-hc"})
+	c.Assert(err, check.IsNil)
+	err = a.SetAccessPolicy(AccessPolicy{Deny: []string{"10.0.0.1"}})
+	c.Assert(err, check.IsNil)
+	policy, ok := routertest.FakeRouter.AccessPolicy(a.Name)
+	c.Assert(ok, check.Equals, true)
+	c.Assert(policy.Deny, check.DeepEquals, []string{"10.0.0.1/32"})
+	policy, ok = routertest.HCRouter.AccessPolicy(a.Name)
+	c.Assert(ok, check.Equals, true)
+	c.Assert(policy.Deny, check.DeepEquals, []string{"10.0.0.1/32"})
+}
+
+func (s *S) TestAddRouterRestoresAccessPolicy(c *check.C) {
+	a := s.createRouterApp(c)
+	defer s.provisioner.Destroy(a)
+	err := a.SetAccessPolicy(AccessPolicy{RateLimit: 5})
+	c.Assert(err, check.IsNil)
+	err = a.AddRouter(provision.AppRouter{Name: "fake-hc"})
+	c.Assert(err, check.IsNil)
+	policy, ok := routertest.HCRouter.AccessPolicy(a.Name)
+	c.Assert(ok, check.Equals, true)
+	c.Assert(policy, check.DeepEquals, router.AccessPolicy{RateLimit: 5})
+}
+
+func (s *S) TestRebuildRoutesRestoresAccessPolicy(c *check.C) {
+	a := s.createRouterApp(c)
+	defer s.provisioner.Destroy(a)
+	err := a.SetAccessPolicy(AccessPolicy{RateLimit: 5})
+	c.Assert(err, check.IsNil)
+	err = routertest.FakeRouter.SetAccessPolicy(a.Name, router.AccessPolicy{})
+	c.Assert(err, check.IsNil)
+	_, err = a.RebuildRoutes()
+	c.Assert(err, check.IsNil)
+	policy, ok := routertest.FakeRouter.AccessPolicy(a.Name)
+	c.Assert(ok, check.Equals, true)
+	c.Assert(policy, check.DeepEquals, router.AccessPolicy{RateLimit: 5})
+}
+
+func (s *S) TestHashPassword(c *check.C) {
+	hash, err := hashPassword("secret")
+	c.Assert(err, check.IsNil)
+	c.Assert(strings.HasPrefix(hash, "{SSHA}"), check.Equals, true)
+	data, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(hash, "{SSHA}"))
+	c.Assert(err, check.IsNil)
+	c.Assert(data, check.HasLen, sha1.Size+8)
+	sum := sha1.Sum(append([]byte("secret"), data[sha1.Size:]...))
+	c.Assert(data[:sha1.Size], check.DeepEquals, sum[:])
+	other, err := hashPassword("secret")
+	c.Assert(err, check.IsNil)
+	c.Assert(other, check.Not(check.Equals), hash)
+}
@@ -0,0 +1,465 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package app
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	stderr "errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tsuru/config"
+	"github.com/tsuru/tsuru/acme"
+	"github.com/tsuru/tsuru/db"
+	"github.com/tsuru/tsuru/event"
+	"github.com/tsuru/tsuru/log"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+const (
+	acmeCertificateEventKind = "acme-certificate"
+
+	defaultACMERenewInterval = 12 * time.Hour
+	defaultACMERenewBefore   = 30 * 24 * time.Hour
+
+	acmeRetryBackoff    = 10 * time.Minute
+	maxACMERetryBackoff = 24 * time.Hour
+)
+
+var (
+	ErrACMENotConfigured = stderr.New(`config key "acme:directory-url" not found`)
+	ErrACMEChallenge     = stderr.New("acme challenge not found")
+	ErrACMENotForwarded  = stderr.New("the router of the app doesn't forward acme challenges to the API")
+
+	errACMEOrderInProgress = stderr.New("acme order in progress")
+
+	// acmeAppLockWait is how long the worker waits for the app lock to store
+	// an issued certificate.
+	acmeAppLockWait = 10 * time.Second
+
+	acmeWorkerMu sync.Mutex
+	acmeWorker   *ACMEWorker
+)
+
+// acmeAccount is the account registered in an ACME server, identified by the
+// URL of the directory of the server. The key is encrypted in the same way as
+// the keys of the certificates.
+type acmeAccount struct {
+	Directory string `bson:"_id"`
+	URL       string
+	Key       []byte
+}
+
+// acmeChallenge is the key authorization of a pending HTTP-01 challenge. It's
+// stored in the database, so that any tsuru API instance is able to answer
+// the challenge.
+type acmeChallenge struct {
+	Token   string `bson:"_id"`
+	Domain  string
+	KeyAuth string
+}
+
+// acmeFailure tracks the failed attempts to obtain a certificate for a cname,
+// so that the worker backs off instead of creating a new order on every run.
+type acmeFailure struct {
+	CName    string `bson:"_id"`
+	Failures int
+	FailedAt time.Time
+}
+
+// retryAt returns the time after which a new order may be created for the
+// cname. The backoff doubles on every consecutive failure.
+func (f *acmeFailure) retryAt() time.Time {
+	backoff := maxACMERetryBackoff
+	if f.Failures < 10 {
+		backoff = acmeRetryBackoff << uint(f.Failures-1)
+		if backoff > maxACMERetryBackoff {
+			backoff = maxACMERetryBackoff
+		}
+	}
+	return f.FailedAt.Add(backoff)
+}
+
+// challengeStore is the solver used in the ACME orders, the challenges are
+// served by the API in the /.well-known/acme-challenge/{token} path, which
+// must be forwarded by the routers.
+type challengeStore struct{}
+
+func (challengeStore) Present(domain, token, keyAuth string) error {
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	_, err = conn.Collection("acme_challenges").UpsertId(token, acmeChallenge{Token: token, Domain: domain, KeyAuth: keyAuth})
+	return err
+}
+
+func (challengeStore) CleanUp(domain, token string) error {
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	err = conn.Collection("acme_challenges").RemoveId(token)
+	if err == mgo.ErrNotFound {
+		return nil
+	}
+	return err
+}
+
+// ACMEChallengeKeyAuth returns the key authorization of a pending ACME
+// challenge.
+func ACMEChallengeKeyAuth(token string) (string, error) {
+	conn, err := db.Conn()
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+	var chal acmeChallenge
+	err = conn.Collection("acme_challenges").FindId(token).One(&chal)
+	if err == mgo.ErrNotFound {
+		return "", ErrACMEChallenge
+	}
+	if err != nil {
+		return "", err
+	}
+	return chal.KeyAuth, nil
+}
+
+// SetACME enables or disables the automatic management of certificates for
+// the cnames of the app using ACME. Certificates already issued are kept when
+// it's disabled, but they're no longer renewed. It can only be enabled when
+// the router of the app forwards the challenges to the API, as configured in
+// "routers:<name>:acme-challenge-url".
+func (app *App) SetACME(enabled bool) error {
+	if enabled {
+		if _, err := app.tlsRouter(); err != nil {
+			return err
+		}
+		routerName, err := app.GetRouter()
+		if err != nil {
+			return err
+		}
+		if challengeURL, _ := config.GetString("routers:" + routerName + ":acme-challenge-url"); challengeURL == "" {
+			return ErrACMENotForwarded
+		}
+	}
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	err = conn.Apps().Update(bson.M{"name": app.Name}, bson.M{"$set": bson.M{"acme": enabled}})
+	if err != nil {
+		return err
+	}
+	app.ACME = enabled
+	if enabled {
+		triggerACMEWorker()
+	}
+	return nil
+}
+
+func triggerACMEWorker() {
+	acmeWorkerMu.Lock()
+	defer acmeWorkerMu.Unlock()
+	if acmeWorker != nil {
+		acmeWorker.Trigger()
+	}
+}
+
+// ACMEWorker obtains certificates for the cnames of the apps with ACME
+// enabled, renewing them before they expire.
+type ACMEWorker struct {
+	DirectoryURL  string
+	Email         string
+	RenewInterval time.Duration
+	RenewBefore   time.Duration
+	HTTPClient    *http.Client
+	client        *acme.Client
+	trigger       chan bool
+	done          chan bool
+}
+
+// NewACMEWorker creates a worker using the "acme:*" config keys. It returns
+// ErrACMENotConfigured when no ACME server is configured.
+func NewACMEWorker() (*ACMEWorker, error) {
+	directoryURL, _ := config.GetString("acme:directory-url")
+	if directoryURL == "" {
+		return nil, ErrACMENotConfigured
+	}
+	email, _ := config.GetString("acme:email")
+	renewInterval := defaultACMERenewInterval
+	if value, err := config.GetInt("acme:renew-interval"); err == nil && value > 0 {
+		renewInterval = time.Duration(value) * time.Second
+	}
+	renewBefore := defaultACMERenewBefore
+	if value, err := config.GetInt("acme:renew-before"); err == nil && value > 0 {
+		renewBefore = time.Duration(value) * time.Second
+	}
+	httpClient := http.DefaultClient
+	if insecure, _ := config.GetBool("acme:insecure-skip-verify"); insecure {
+		httpClient = &http.Client{Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+		}}
+	}
+	return &ACMEWorker{
+		DirectoryURL:  directoryURL,
+		Email:         email,
+		RenewInterval: renewInterval,
+		RenewBefore:   renewBefore,
+		HTTPClient:    httpClient,
+		trigger:       make(chan bool, 1),
+		done:          make(chan bool),
+	}, nil
+}
+
+func (w *ACMEWorker) Start() {
+	acmeWorkerMu.Lock()
+	acmeWorker = w
+	acmeWorkerMu.Unlock()
+	go func() {
+		for {
+			err := w.runOnce()
+			if err != nil {
+				log.Errorf("[acme worker] %s", err)
+			}
+			select {
+			case <-w.done:
+				return
+			case <-w.trigger:
+			case <-time.After(w.RenewInterval):
+			}
+		}
+	}()
+}
+
+// Trigger makes the worker look for certificates to obtain without waiting
+// for the renew interval.
+func (w *ACMEWorker) Trigger() {
+	select {
+	case w.trigger <- true:
+	default:
+	}
+}
+
+func (w *ACMEWorker) Shutdown() {
+	acmeWorkerMu.Lock()
+	if acmeWorker == w {
+		acmeWorker = nil
+	}
+	acmeWorkerMu.Unlock()
+	w.done <- true
+}
+
+func (w *ACMEWorker) String() string {
+	return "acme worker"
+}
+
+func (w *ACMEWorker) runOnce() error {
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	var apps []App
+	err = conn.Apps().Find(bson.M{"acme": true}).All(&apps)
+	conn.Close()
+	if err != nil {
+		return err
+	}
+	for i := range apps {
+		err = w.checkApp(&apps[i])
+		if err != nil {
+			log.Errorf("[acme worker] unable to check certificates of app %s: %s", apps[i].Name, err)
+		}
+	}
+	return nil
+}
+
+// checkApp obtains the pending certificates of an app. Cnames with orders in
+// progress in other API instances are skipped until the next run.
+func (w *ACMEWorker) checkApp(a *App) error {
+	cnames, err := w.pendingCNames(a)
+	if err != nil {
+		return err
+	}
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	coll := conn.Collection("acme_failures")
+	now := time.Now().UTC()
+	for _, cname := range cnames {
+		var failure acmeFailure
+		err = coll.FindId(cname).One(&failure)
+		if err != nil && err != mgo.ErrNotFound {
+			return err
+		}
+		if err == nil && now.Before(failure.retryAt()) {
+			continue
+		}
+		err = w.obtainCertificate(a, cname)
+		if err == errACMEOrderInProgress {
+			continue
+		}
+		if err != nil {
+			log.Errorf("[acme worker] unable to obtain certificate for %s in app %s: %s", cname, a.Name, err)
+			_, err = coll.UpsertId(cname, bson.M{
+				"$set": bson.M{"failedat": now},
+				"$inc": bson.M{"failures": 1},
+			})
+		} else {
+			err = coll.RemoveId(cname)
+			if err == mgo.ErrNotFound {
+				err = nil
+			}
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// pendingCNames returns the cnames of the app without certificates or with
+// certificates about to expire. Wildcard cnames are ignored, as they can't
+// be validated using HTTP-01 challenges.
+func (w *ACMEWorker) pendingCNames(a *App) ([]string, error) {
+	coll, err := certificatesCollection()
+	if err != nil {
+		return nil, err
+	}
+	defer coll.Close()
+	var pending []string
+	for _, cname := range a.CName {
+		if strings.HasPrefix(cname, "*.") {
+			continue
+		}
+		var cert cnameCertificate
+		err = coll.FindId(cname).One(&cert)
+		if err == mgo.ErrNotFound || (err == nil && cert.ExpiresAt.Sub(time.Now()) < w.RenewBefore) {
+			pending = append(pending, cname)
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return pending, nil
+}
+
+// obtainCertificate orders a certificate for a cname and stores it in the
+// app. The order is locked by an event on the cname, so that other API
+// instances don't create orders for the same cname, while the app is only
+// locked to store the issued certificate, as orders may take minutes.
+func (w *ACMEWorker) obtainCertificate(a *App, cname string) (err error) {
+	evt, err := event.NewInternal(&event.Opts{
+		Target:       event.Target{Type: event.TargetTypeCName, Value: cname},
+		ExtraTargets: []event.Target{{Type: event.TargetTypeApp, Value: a.Name}},
+		InternalKind: acmeCertificateEventKind,
+		CustomData:   map[string]string{"cname": cname},
+	})
+	if _, ok := err.(event.ErrEventLocked); ok {
+		return errACMEOrderInProgress
+	}
+	if err != nil {
+		return err
+	}
+	defer func() {
+		evt.Done(err)
+	}()
+	client, err := w.acmeClient()
+	if err != nil {
+		return err
+	}
+	key, err := acme.GenerateKey()
+	if err != nil {
+		return err
+	}
+	chain, err := client.ObtainCertificate([]string{cname}, key, challengeStore{})
+	if err != nil {
+		return err
+	}
+	keyData, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return err
+	}
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyData})
+	locked, err := AcquireApplicationLockWait(a.Name, InternalAppName, "acme", acmeAppLockWait)
+	if err != nil {
+		return err
+	}
+	if !locked {
+		return fmt.Errorf("unable to store certificate: app %s is locked", a.Name)
+	}
+	defer ReleaseApplicationLock(a.Name)
+	return a.SetCertificate(cname, chain, string(keyPEM))
+}
+
+// acmeClient returns a client for the ACME server, registering a new account
+// when there's no account stored for the server.
+func (w *ACMEWorker) acmeClient() (*acme.Client, error) {
+	if w.client != nil {
+		return w.client, nil
+	}
+	conn, err := db.Conn()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	coll := conn.Collection("acme_accounts")
+	var account acmeAccount
+	err = coll.FindId(w.DirectoryURL).One(&account)
+	if err != nil && err != mgo.ErrNotFound {
+		return nil, err
+	}
+	if err == nil {
+		var keyData []byte
+		keyData, err = decryptCertificateKey(account.Key)
+		if err != nil {
+			return nil, err
+		}
+		key, err := x509.ParseECPrivateKey(keyData)
+		if err != nil {
+			return nil, err
+		}
+		w.client = acme.NewClient(w.DirectoryURL, key)
+		w.client.HTTPClient = w.HTTPClient
+		w.client.AccountURL = account.URL
+		return w.client, nil
+	}
+	key, err := acme.GenerateKey()
+	if err != nil {
+		return nil, err
+	}
+	client := acme.NewClient(w.DirectoryURL, key)
+	client.HTTPClient = w.HTTPClient
+	err = client.Register(w.Email)
+	if err != nil {
+		return nil, err
+	}
+	keyData, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+	encryptedKey, err := encryptCertificateKey(keyData)
+	if err != nil {
+		return nil, err
+	}
+	err = coll.Insert(acmeAccount{Directory: w.DirectoryURL, URL: client.AccountURL, Key: encryptedKey})
+	if err != nil {
+		return nil, err
+	}
+	w.client = client
+	return client, nil
+}
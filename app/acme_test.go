@@ -0,0 +1,296 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package app
+
+import (
+	"errors"
+	"time"
+
+	"github.com/tsuru/config"
+	"github.com/tsuru/tsuru/acme/acmetest"
+	"github.com/tsuru/tsuru/event"
+	"github.com/tsuru/tsuru/router/routertest"
+	"gopkg.in/check.v1"
+	"gopkg.in/mgo.v2/bson"
+)
+
+func (s *S) newACMEWorker(c *check.C) (*ACMEWorker, *acmetest.Server) {
+	server, err := acmetest.NewServer()
+	c.Assert(err, check.IsNil)
+	server.Validate = func(domain, token string) (string, error) {
+		return ACMEChallengeKeyAuth(token)
+	}
+	config.Set("acme:directory-url", server.DirectoryURL())
+	defer config.Unset("acme:directory-url")
+	w, err := NewACMEWorker()
+	c.Assert(err, check.IsNil)
+	return w, server
+}
+
+func (s *S) setACMEChallengeURL() func() {
+	config.Set("routers:fake:acme-challenge-url", "http://tsuru.example.com")
+	return func() { config.Unset("routers:fake:acme-challenge-url") }
+}
+
+func (s *S) TestNewACMEWorkerNotConfigured(c *check.C) {
+	_, err := NewACMEWorker()
+	c.Assert(err, check.Equals, ErrACMENotConfigured)
+}
+
+func (s *S) TestSetACME(c *check.C) {
+	defer s.setACMEChallengeURL()()
+	a := s.createCertificateApp(c)
+	defer s.provisioner.Destroy(a)
+	err := a.SetACME(true)
+	c.Assert(err, check.IsNil)
+	c.Assert(a.ACME, check.Equals, true)
+	dbApp, err := GetByName(a.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(dbApp.ACME, check.Equals, true)
+	err = a.SetACME(false)
+	c.Assert(err, check.IsNil)
+	dbApp, err = GetByName(a.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(dbApp.ACME, check.Equals, false)
+}
+
+func (s *S) TestACMEWorkerObtainsCertificates(c *check.C) {
+	defer s.setACMEChallengeURL()()
+	w, server := s.newACMEWorker(c)
+	defer server.Close()
+	a := s.createCertificateApp(c)
+	defer s.provisioner.Destroy(a)
+	err := a.AddCName("*.myapp.io")
+	c.Assert(err, check.IsNil)
+	err = a.SetACME(true)
+	c.Assert(err, check.IsNil)
+	err = w.runOnce()
+	c.Assert(err, check.IsNil)
+	c.Assert(server.Orders(), check.Equals, 1)
+	cert, err := routertest.FakeRouter.Certificate(a.Name, "myapp.io")
+	c.Assert(err, check.IsNil)
+	c.Assert(cert, check.Matches, "(?s)-----BEGIN CERTIFICATE-----.*")
+	coll, err := certificatesCollection()
+	c.Assert(err, check.IsNil)
+	defer coll.Close()
+	var stored cnameCertificate
+	err = coll.FindId("myapp.io").One(&stored)
+	c.Assert(err, check.IsNil)
+	c.Assert(stored.ExpiresAt.After(time.Now().Add(80*24*time.Hour)), check.Equals, true)
+	n, err := s.conn.Collection("acme_challenges").Count()
+	c.Assert(err, check.IsNil)
+	c.Assert(n, check.Equals, 0)
+	err = w.runOnce()
+	c.Assert(err, check.IsNil)
+	c.Assert(server.Orders(), check.Equals, 1)
+	evts, err := event.List(&event.Filter{KindName: acmeCertificateEventKind})
+	c.Assert(err, check.IsNil)
+	c.Assert(evts, check.HasLen, 1)
+	c.Assert(evts[0].Error, check.Equals, "")
+}
+
+func (s *S) TestACMEWorkerRenewsCertificates(c *check.C) {
+	defer s.setACMEChallengeURL()()
+	w, server := s.newACMEWorker(c)
+	defer server.Close()
+	server.CertificateDuration = 10 * 24 * time.Hour
+	a := s.createCertificateApp(c)
+	defer s.provisioner.Destroy(a)
+	err := a.SetACME(true)
+	c.Assert(err, check.IsNil)
+	err = w.runOnce()
+	c.Assert(err, check.IsNil)
+	c.Assert(server.Orders(), check.Equals, 1)
+	err = w.runOnce()
+	c.Assert(err, check.IsNil)
+	c.Assert(server.Orders(), check.Equals, 2)
+}
+
+func (s *S) TestSetACMEChallengeNotForwarded(c *check.C) {
+	a := s.createCertificateApp(c)
+	defer s.provisioner.Destroy(a)
+	err := a.SetACME(true)
+	c.Assert(err, check.Equals, ErrACMENotForwarded)
+	dbApp, err := GetByName(a.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(dbApp.ACME, check.Equals, false)
+}
+
+func (s *S) TestACMEWorkerBacksOffAfterFailure(c *check.C) {
+	defer s.setACMEChallengeURL()()
+	w, server := s.newACMEWorker(c)
+	defer server.Close()
+	server.Validate = func(domain, token string) (string, error) {
+		return "", errors.New("challenge not reachable")
+	}
+	a := s.createCertificateApp(c)
+	defer s.provisioner.Destroy(a)
+	err := a.SetACME(true)
+	c.Assert(err, check.IsNil)
+	err = w.runOnce()
+	c.Assert(err, check.IsNil)
+	c.Assert(server.Orders(), check.Equals, 1)
+	var failure acmeFailure
+	err = s.conn.Collection("acme_failures").FindId("myapp.io").One(&failure)
+	c.Assert(err, check.IsNil)
+	c.Assert(failure.Failures, check.Equals, 1)
+	err = w.runOnce()
+	c.Assert(err, check.IsNil)
+	c.Assert(server.Orders(), check.Equals, 1)
+	server.Validate = func(domain, token string) (string, error) {
+		return ACMEChallengeKeyAuth(token)
+	}
+	err = s.conn.Collection("acme_failures").UpdateId("myapp.io", bson.M{"$set": bson.M{"failedat": time.Now().Add(-time.Hour)}})
+	c.Assert(err, check.IsNil)
+	err = w.runOnce()
+	c.Assert(err, check.IsNil)
+	c.Assert(server.Orders(), check.Equals, 2)
+	n, err := s.conn.Collection("acme_failures").Count()
+	c.Assert(err, check.IsNil)
+	c.Assert(n, check.Equals, 0)
+}
+
+func (s *S) TestACMEWorkerSkipsCNamesInProgress(c *check.C) {
+	defer s.setACMEChallengeURL()()
+	w, server := s.newACMEWorker(c)
+	defer server.Close()
+	a := s.createCertificateApp(c)
+	defer s.provisioner.Destroy(a)
+	err := a.SetACME(true)
+	c.Assert(err, check.IsNil)
+	evt, err := event.NewInternal(&event.Opts{
+		Target:       event.Target{Type: event.TargetTypeCName, Value: "myapp.io"},
+		InternalKind: acmeCertificateEventKind,
+	})
+	c.Assert(err, check.IsNil)
+	err = w.runOnce()
+	c.Assert(err, check.IsNil)
+	c.Assert(server.Orders(), check.Equals, 0)
+	n, err := s.conn.Collection("acme_failures").Count()
+	c.Assert(err, check.IsNil)
+	c.Assert(n, check.Equals, 0)
+	err = evt.Done(nil)
+	c.Assert(err, check.IsNil)
+	err = w.runOnce()
+	c.Assert(err, check.IsNil)
+	c.Assert(server.Orders(), check.Equals, 1)
+}
+
+func (s *S) TestACMEWorkerLocksAppOnlyToStoreCertificate(c *check.C) {
+	defer s.setACMEChallengeURL()()
+	defer func(wait time.Duration) { acmeAppLockWait = wait }(acmeAppLockWait)
+	acmeAppLockWait = 0
+	w, server := s.newACMEWorker(c)
+	defer server.Close()
+	a := s.createCertificateApp(c)
+	defer s.provisioner.Destroy(a)
+	err := a.SetACME(true)
+	c.Assert(err, check.IsNil)
+	server.Validate = func(domain, token string) (string, error) {
+		dbApp, err := GetByName(a.Name)
+		c.Check(err, check.IsNil)
+		c.Check(dbApp.Lock.Locked, check.Equals, false)
+		return ACMEChallengeKeyAuth(token)
+	}
+	err = w.runOnce()
+	c.Assert(err, check.IsNil)
+	c.Assert(server.Orders(), check.Equals, 1)
+	dbApp, err := GetByName(a.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(dbApp.Lock.Locked, check.Equals, false)
+	_, err = routertest.FakeRouter.Certificate(a.Name, "myapp.io")
+	c.Assert(err, check.IsNil)
+}
+
+func (s *S) TestACMEWorkerAppLockedWhenStoring(c *check.C) {
+	defer s.setACMEChallengeURL()()
+	defer func(wait time.Duration) { acmeAppLockWait = wait }(acmeAppLockWait)
+	acmeAppLockWait = 0
+	w, server := s.newACMEWorker(c)
+	defer server.Close()
+	a := s.createCertificateApp(c)
+	defer s.provisioner.Destroy(a)
+	err := a.SetACME(true)
+	c.Assert(err, check.IsNil)
+	locked, err := AcquireApplicationLock(a.Name, "someone", "deploy")
+	c.Assert(err, check.IsNil)
+	c.Assert(locked, check.Equals, true)
+	defer ReleaseApplicationLock(a.Name)
+	err = w.runOnce()
+	c.Assert(err, check.IsNil)
+	c.Assert(server.Orders(), check.Equals, 1)
+	_, err = routertest.FakeRouter.Certificate(a.Name, "myapp.io")
+	c.Assert(err, check.NotNil)
+	var failure acmeFailure
+	err = s.conn.Collection("acme_failures").FindId("myapp.io").One(&failure)
+	c.Assert(err, check.IsNil)
+	c.Assert(failure.Failures, check.Equals, 1)
+	dbApp, err := GetByName(a.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(dbApp.Lock.Owner, check.Equals, "someone")
+}
+
+func (s *S) TestACMEFailureRetryAt(c *check.C) {
+	failedAt := time.Date(2016, 10, 1, 12, 0, 0, 0, time.UTC)
+	var tests = []struct {
+		failures int
+		expected time.Duration
+	}{
+		{1, 10 * time.Minute},
+		{2, 20 * time.Minute},
+		{4, 80 * time.Minute},
+		{9, maxACMERetryBackoff},
+		{100, maxACMERetryBackoff},
+	}
+	for _, tt := range tests {
+		f := acmeFailure{Failures: tt.failures, FailedAt: failedAt}
+		c.Check(f.retryAt(), check.DeepEquals, failedAt.Add(tt.expected), check.Commentf("failures: %d", tt.failures))
+	}
+}
+
+func (s *S) TestACMEWorkerIgnoresDisabledApps(c *check.C) {
+	w, server := s.newACMEWorker(c)
+	defer server.Close()
+	a := s.createCertificateApp(c)
+	defer s.provisioner.Destroy(a)
+	err := w.runOnce()
+	c.Assert(err, check.IsNil)
+	c.Assert(server.Orders(), check.Equals, 0)
+}
+
+func (s *S) TestACMEWorkerReusesAccount(c *check.C) {
+	w, server := s.newACMEWorker(c)
+	defer server.Close()
+	client, err := w.acmeClient()
+	c.Assert(err, check.IsNil)
+	config.Set("acme:directory-url", server.DirectoryURL())
+	defer config.Unset("acme:directory-url")
+	other, err := NewACMEWorker()
+	c.Assert(err, check.IsNil)
+	otherClient, err := other.acmeClient()
+	c.Assert(err, check.IsNil)
+	c.Assert(otherClient.AccountURL, check.Equals, client.AccountURL)
+}
+
+func (s *S) TestACMEChallengeKeyAuth(c *check.C) {
+	_, err := ACMEChallengeKeyAuth("mytoken")
+	c.Assert(err, check.Equals, ErrACMEChallenge)
+	err = challengeStore{}.Present("myapp.io", "mytoken", "mytoken.thumbprint")
+	c.Assert(err, check.IsNil)
+	keyAuth, err := ACMEChallengeKeyAuth("mytoken")
+	c.Assert(err, check.IsNil)
+	c.Assert(keyAuth, check.Equals, "mytoken.thumbprint")
+	err = challengeStore{}.CleanUp("myapp.io", "mytoken")
+	c.Assert(err, check.IsNil)
+	_, err = ACMEChallengeKeyAuth("mytoken")
+	c.Assert(err, check.Equals, ErrACMEChallenge)
+}
+
+func (s *S) TestACMEWorkerTrigger(c *check.C) {
+	w := &ACMEWorker{trigger: make(chan bool, 1)}
+	w.Trigger()
+	w.Trigger()
+	c.Assert(w.trigger, check.HasLen, 1)
+}
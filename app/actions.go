@@ -403,6 +403,9 @@ var moveRouterUnits = action.Action{
 				log.Errorf("BACKWARD ABORTED - failed to get app router: %s", err)
 				return
 			}
+			if app.hasRouter(routerName) {
+				return
+			}
 			r, err := router.Get(routerName)
 			if err != nil {
 				log.Errorf("BACKWARD ABORTED - failed to retrieve router %q: %s", routerName, err)
@@ -485,6 +488,11 @@ var removeOldBackend = action.Action{
 				log.Errorf("[IGNORED ERROR] failed to remove old backend: %s", err)
 				return nil, nil
 			}
+			// the old router is still used by the app when it was also
+			// added as an additional router
+			if result.app.hasRouter(routerName) {
+				return result, nil
+			}
 			r, err := router.Get(routerName)
 			if err != nil {
 				log.Errorf("[IGNORED ERROR] failed to remove old backend: %s", err)
@@ -520,6 +528,13 @@ var validateNewCNames = action.Action{
 			if cs > 0 {
 				return nil, errors.New("cname already exists!")
 			}
+			isMount, err := isMountDomain(cname)
+			if err != nil {
+				return nil, err
+			}
+			if isMount {
+				return nil, errors.New("cname is a domain with mounted apps")
+			}
 		}
 		return cnames, nil
 	},
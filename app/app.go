@@ -122,6 +122,11 @@ type App struct {
 	Pool           string
 	Description    string
 	RouterOpts     map[string]string
+	Routers        []provision.AppRouter
+	ACME           bool
+	AccessPolicy   *router.AccessPolicy
+	Maintenance    *Maintenance
+	AutoSleep      *AutoSleep
 
 	quota.Quota
 }
@@ -131,10 +136,6 @@ func (app *App) Units() ([]provision.Unit, error) {
 	return Provisioner.Units(app)
 }
 
-func (app *App) GetRouterOpts() map[string]string {
-	return app.RouterOpts
-}
-
 // MarshalJSON marshals the app in json format.
 func (app *App) MarshalJSON() ([]byte, error) {
 	repo, _ := repository.Manager().GetRepository(app.Name)
@@ -396,6 +397,10 @@ func Delete(app *App, w io.Writer) error {
 		log.Errorf("[delete-app: %s] %s", appName, msg)
 		hasErrors = true
 	}
+	err = app.removeMounts()
+	if err != nil {
+		logErr("Unable to remove app mounts", err)
+	}
 	err = Provisioner.Destroy(app)
 	if err != nil {
 		logErr("Unable to destroy app in provisioner", err)
@@ -428,6 +433,14 @@ func Delete(app *App, w io.Writer) error {
 	if err != nil {
 		logErr("Unable to remove logs collection", err)
 	}
+	err = removeAutoSleepStatus(appName)
+	if err != nil {
+		logErr("Unable to remove auto sleep status", err)
+	}
+	err = removeRoutesDrift(appName)
+	if err != nil {
+		logErr("Unable to remove routes drift", err)
+	}
 	conn, err := db.Conn()
 	if err == nil {
 		defer conn.Close()
@@ -860,6 +873,7 @@ func (app *App) Restart(process string, w io.Writer) error {
 		log.Errorf("[restart] error on restart the app %s - %s", app.Name, err)
 		return err
 	}
+	app.clearAsleep()
 	return nil
 }
 
@@ -883,36 +897,45 @@ func (app *App) Sleep(w io.Writer, process string, proxyURL *url.URL) error {
 		msg = fmt.Sprintf("\n ---> Putting the app %q to sleep\n", app.Name)
 	}
 	log.Write(w, []byte(msg))
-	routerName, err := app.GetRouter()
-	if err != nil {
-		log.Errorf("[sleep] error on sleep the app %s - %s", app.Name, err)
-		return err
-	}
-	r, err := router.Get(routerName)
+	appRouters, err := app.GetRouters()
 	if err != nil {
 		log.Errorf("[sleep] error on sleep the app %s - %s", app.Name, err)
 		return err
 	}
-	oldRoutes, err := r.Routes(app.GetName())
-	if err != nil {
-		log.Errorf("[sleep] error on sleep the app %s - %s", app.Name, err)
-		return err
-	}
-	for _, route := range oldRoutes {
-		r.RemoveRoute(app.GetName(), route)
+	routers := make([]router.Router, len(appRouters))
+	oldRoutes := make([][]*url.URL, len(appRouters))
+	rollback := func(n int) {
+		for i := 0; i < n; i++ {
+			for _, route := range oldRoutes[i] {
+				routers[i].AddRoute(app.GetName(), route)
+			}
+			routers[i].RemoveRoute(app.GetName(), proxyURL)
+		}
 	}
-	err = r.AddRoute(app.GetName(), proxyURL)
-	if err != nil {
-		log.Errorf("[sleep] error on sleep the app %s - %s", app.Name, err)
-		return err
+	for i, appRouter := range appRouters {
+		routers[i], err = router.Get(appRouter.Name)
+		if err == nil {
+			oldRoutes[i], err = routers[i].Routes(app.GetName())
+		}
+		if err != nil {
+			log.Errorf("[sleep] error on sleep the app %s - %s", app.Name, err)
+			rollback(i)
+			return err
+		}
+		for _, route := range oldRoutes[i] {
+			routers[i].RemoveRoute(app.GetName(), route)
+		}
+		err = routers[i].AddRoute(app.GetName(), proxyURL)
+		if err != nil {
+			log.Errorf("[sleep] error on sleep the app %s - %s", app.Name, err)
+			rollback(i + 1)
+			return err
+		}
 	}
 	err = Provisioner.Sleep(app, process)
 	if err != nil {
 		log.Errorf("[sleep] error on sleep the app %s - %s", app.Name, err)
-		for _, route := range oldRoutes {
-			r.AddRoute(app.GetName(), route)
-		}
-		r.RemoveRoute(app.GetName(), proxyURL)
+		rollback(len(routers))
 		log.Errorf("[sleep] rolling back the sleep %s", app.Name)
 		return err
 	}
@@ -1142,7 +1165,14 @@ func (app *App) AddCName(cnames ...string) error {
 		&saveCNames,
 		&updateApp,
 	}
-	return action.NewPipeline(actions...).Execute(app, cnames)
+	err := action.NewPipeline(actions...).Execute(app, cnames)
+	if err != nil {
+		return err
+	}
+	if app.ACME {
+		triggerACMEWorker()
+	}
+	return nil
 }
 
 func (app *App) RemoveCName(cnames ...string) error {
@@ -1152,7 +1182,11 @@ func (app *App) RemoveCName(cnames ...string) error {
 		&removeCNameFromDatabase,
 		&removeCNameFromApp,
 	}
-	return action.NewPipeline(actions...).Execute(app, cnames)
+	err := action.NewPipeline(actions...).Execute(app, cnames)
+	if err != nil {
+		return err
+	}
+	return removeCertificates(cnames...)
 }
 
 func (app *App) parsedTsuruServices() map[string][]bind.ServiceInstance {
@@ -1493,13 +1527,19 @@ func (app *App) Start(w io.Writer, process string) error {
 		msg = fmt.Sprintf("\n ---> Starting the app %q\n", app.Name)
 	}
 	log.Write(w, []byte(msg))
+	started := time.Now()
 	err := Provisioner.Start(app, process)
 	if err != nil {
 		log.Errorf("[start] error on start the app %s - %s", app.Name, err)
 		return err
 	}
-	_, err = app.RebuildRoutes()
-	return err
+	app.endMaintenance()
+	_, err = app.rebuildAllRoutes()
+	if err != nil {
+		return err
+	}
+	app.markAwake(started)
+	return nil
 }
 
 func (app *App) SetUpdatePlatform(check bool) error {
@@ -1557,17 +1597,45 @@ type RebuildRoutesResult struct {
 	Removed []string
 }
 
+// RebuildRoutes makes sure the app is present in all its routers, with its
+// cnames, certificates and the routes to all its routable units. Apps put to
+// sleep by the auto sleeper are no longer asleep once their routes point to
+// the units again.
 func (app *App) RebuildRoutes() (*RebuildRoutesResult, error) {
-	routerName, err := app.GetRouter()
+	result, err := app.rebuildAllRoutes()
 	if err != nil {
 		return nil, err
 	}
-	r, err := router.Get(routerName)
+	app.clearAsleep()
+	return result, nil
+}
+
+func (app *App) rebuildAllRoutes() (*RebuildRoutesResult, error) {
+	appRouters, err := app.GetRouters()
+	if err != nil {
+		return nil, err
+	}
+	var result RebuildRoutesResult
+	for i, appRouter := range appRouters {
+		routerResult, err := app.rebuildRoutes(appRouter, i == 0)
+		if err != nil {
+			return nil, err
+		}
+		result.Added = append(result.Added, routerResult.Added...)
+		result.Removed = append(result.Removed, routerResult.Removed...)
+	}
+	return &result, nil
+}
+
+// rebuildRoutes rebuilds the routes of the app in a single router. The
+// address of the app is updated only when rebuilding its main router.
+func (app *App) rebuildRoutes(appRouter provision.AppRouter, mainRouter bool) (*RebuildRoutesResult, error) {
+	r, err := router.Get(appRouter.Name)
 	if err != nil {
 		return nil, err
 	}
 	if optsRouter, ok := r.(router.OptsRouter); ok {
-		err = optsRouter.AddBackendOpts(app.Name, app.RouterOpts)
+		err = optsRouter.AddBackendOpts(app.Name, appRouter.Opts)
 	} else {
 		err = r.AddBackend(app.Name)
 	}
@@ -1575,7 +1643,7 @@ func (app *App) RebuildRoutes() (*RebuildRoutesResult, error) {
 		return nil, err
 	}
 	var newAddr string
-	if newAddr, err = r.Addr(app.GetName()); err == nil && newAddr != app.Ip {
+	if newAddr, err = r.Addr(app.GetName()); mainRouter && err == nil && newAddr != app.Ip {
 		var conn *db.Storage
 		conn, err = db.Conn()
 		if err != nil {
@@ -1596,6 +1664,24 @@ func (app *App) RebuildRoutes() (*RebuildRoutesResult, error) {
 			}
 		}
 	}
+	err = app.restoreCertificates(r, mainRouter)
+	if err != nil {
+		return nil, err
+	}
+	err = app.restoreAccessPolicy(r)
+	if err != nil {
+		return nil, err
+	}
+	err = app.restoreMaintenance(r)
+	if err != nil {
+		return nil, err
+	}
+	if pathRouter, ok := r.(router.PathRouter); ok && mainRouter {
+		err = app.restoreMounts(pathRouter)
+		if err != nil {
+			return nil, err
+		}
+	}
 	oldRoutes, err := r.Routes(app.GetName())
 	if err != nil {
 		return nil, err
@@ -2370,6 +2370,27 @@ func (s *S) TestSleep(c *check.C) {
 	c.Assert(routes, check.HasLen, 1)
 }
 
+func (s *S) TestSleepMultipleRouters(c *check.C) {
+	a := s.createRouterApp(c)
+	defer s.provisioner.Destroy(a)
+	err := a.AddRouter(provision.AppRouter{Name: "fake-hc"})
+	c.Assert(err, check.IsNil)
+	proxyURL, err := url.Parse("http://example.com")
+	c.Assert(err, check.IsNil)
+	var b bytes.Buffer
+	err = a.Sleep(&b, "", proxyURL)
+	c.Assert(err, check.IsNil)
+	c.Assert(s.provisioner.Sleeps(a, ""), check.Equals, 1)
+	c.Assert(routertest.FakeRouter.HasRoute(a.Name, proxyURL.String()), check.Equals, true)
+	routes, err := routertest.FakeRouter.Routes(a.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(routes, check.HasLen, 1)
+	c.Assert(routertest.HCRouter.HasRoute(a.Name, proxyURL.String()), check.Equals, true)
+	routes, err = routertest.HCRouter.Routes(a.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(routes, check.HasLen, 1)
+}
+
 func (s *S) TestLog(c *check.C) {
 	a := App{Name: "newApp"}
 	err := s.conn.Apps().Insert(a)
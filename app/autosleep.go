@@ -0,0 +1,405 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package app
+
+import (
+	stderr "errors"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/tsuru/config"
+	"github.com/tsuru/tsuru/db"
+	"github.com/tsuru/tsuru/db/storage"
+	"github.com/tsuru/tsuru/errors"
+	"github.com/tsuru/tsuru/event"
+	"github.com/tsuru/tsuru/log"
+	"github.com/tsuru/tsuru/provision"
+	"github.com/tsuru/tsuru/router"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+const (
+	autoSleepEventKind = "auto-sleep"
+	autoWakeEventKind  = "auto-wake"
+
+	defaultAutoSleepInterval = time.Minute
+)
+
+var (
+	ErrAutoSleepNotConfigured = stderr.New(`config key "auto-sleep:proxy-url" not found`)
+	ErrActivityNotSupported   = stderr.New("the routers of the app don't report request activity")
+)
+
+// AutoSleep holds the auto sleep setting of an app. Apps without requests
+// for IdleMinutes are put to sleep, zero disables auto sleep for the app.
+type AutoSleep struct {
+	IdleMinutes int `json:"idleMinutes"`
+}
+
+// AutoSleepStatus is the state tracked by the auto sleeper for an app.
+//
+// LastStartDuration is the time taken by the last wake, from the start
+// request received by tsuru until the units are started and the routes point
+// to them again. It doesn't include the time the request waited in the proxy.
+type AutoSleepStatus struct {
+	App               string        `bson:"_id" json:"app"`
+	IdleMinutes       int           `bson:"-" json:"idleMinutes"`
+	LastActivity      time.Time     `json:"lastActivity"`
+	Asleep            bool          `json:"asleep"`
+	SleptAt           time.Time     `json:"sleptAt"`
+	WokeAt            time.Time     `json:"wokeAt"`
+	Sleeps            int           `json:"sleeps"`
+	Wakes             int           `json:"wakes"`
+	LastStartDuration time.Duration `json:"lastStartDuration"`
+}
+
+func autoSleepCollection() (*storage.Collection, error) {
+	conn, err := db.Conn()
+	if err != nil {
+		return nil, err
+	}
+	return conn.Collection("auto_sleep"), nil
+}
+
+// AutoSleepIdle returns the time without requests after which the app is put
+// to sleep, or zero when auto sleep is disabled for the app. Apps without a
+// setting of their own use the one in the "auto-sleep:pools:<pool>:idle-minutes"
+// config, auto sleep is disabled by default.
+func (app *App) AutoSleepIdle() time.Duration {
+	if app.AutoSleep != nil {
+		return time.Duration(app.AutoSleep.IdleMinutes) * time.Minute
+	}
+	minutes, err := config.GetInt(fmt.Sprintf("auto-sleep:pools:%s:idle-minutes", app.Pool))
+	if err != nil || minutes < 0 {
+		return 0
+	}
+	return time.Duration(minutes) * time.Minute
+}
+
+// SetAutoSleep sets the auto sleep setting of the app. A nil setting makes the
+// app use the default of its pool.
+func (app *App) SetAutoSleep(autoSleep *AutoSleep) error {
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	update := bson.M{"$unset": bson.M{"autosleep": ""}}
+	if autoSleep != nil {
+		if autoSleep.IdleMinutes < 0 {
+			return &errors.ValidationError{Message: "idle minutes must not be negative"}
+		}
+		if autoSleep.IdleMinutes > 0 {
+			_, err = app.activityRouters()
+			if err == ErrActivityNotSupported {
+				return &errors.ValidationError{Message: err.Error()}
+			}
+			if err != nil {
+				return err
+			}
+		}
+		update = bson.M{"$set": bson.M{"autosleep": autoSleep}}
+	}
+	err = conn.Apps().Update(bson.M{"name": app.Name}, update)
+	if err != nil {
+		return err
+	}
+	app.AutoSleep = autoSleep
+	return nil
+}
+
+// GetAutoSleepStatus returns the state tracked by the auto sleeper for the
+// app.
+func (app *App) GetAutoSleepStatus() (*AutoSleepStatus, error) {
+	coll, err := autoSleepCollection()
+	if err != nil {
+		return nil, err
+	}
+	defer coll.Close()
+	status := AutoSleepStatus{App: app.Name}
+	err = coll.FindId(app.Name).One(&status)
+	if err != nil && err != mgo.ErrNotFound {
+		return nil, err
+	}
+	status.IdleMinutes = int(app.AutoSleepIdle() / time.Minute)
+	return &status, nil
+}
+
+func removeAutoSleepStatus(appName string) error {
+	coll, err := autoSleepCollection()
+	if err != nil {
+		return err
+	}
+	defer coll.Close()
+	err = coll.RemoveId(appName)
+	if err == mgo.ErrNotFound {
+		return nil
+	}
+	return err
+}
+
+// activityRouters returns the routers of the app, failing with
+// ErrActivityNotSupported when any of them doesn't track request activity.
+func (app *App) activityRouters() ([]router.ActivityRouter, error) {
+	appRouters, err := app.GetRouters()
+	if err != nil {
+		return nil, err
+	}
+	result := make([]router.ActivityRouter, 0, len(appRouters))
+	for _, appRouter := range appRouters {
+		r, err := router.Get(appRouter.Name)
+		if err != nil {
+			return nil, err
+		}
+		activityRouter, ok := r.(router.ActivityRouter)
+		if !ok || !activityRouter.TracksActivity() {
+			return nil, ErrActivityNotSupported
+		}
+		result = append(result, activityRouter)
+	}
+	return result, nil
+}
+
+// LastActivity returns the last time any of the routers of the app received
+// a request for it.
+func (app *App) LastActivity() (time.Time, error) {
+	activityRouters, err := app.activityRouters()
+	if err != nil {
+		return time.Time{}, err
+	}
+	var last time.Time
+	for _, activityRouter := range activityRouters {
+		t, err := activityRouter.LastActivity(app.Name)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if t.After(last) {
+			last = t
+		}
+	}
+	return last, nil
+}
+
+// markAwake records the wake of an app put to sleep by the auto sleeper,
+// along with the time it took to start it since started. It's called after
+// the app is successfully started, errors are only logged.
+func (app *App) markAwake(started time.Time) {
+	coll, err := autoSleepCollection()
+	if err != nil {
+		log.Errorf("[auto sleep] unable to record wake of app %q: %s", app.Name, err)
+		return
+	}
+	defer coll.Close()
+	now := time.Now().UTC()
+	duration := now.Sub(started)
+	err = coll.Update(bson.M{"_id": app.Name, "asleep": true}, bson.M{
+		"$set": bson.M{"asleep": false, "wokeat": now, "lastactivity": now, "laststartduration": duration},
+		"$inc": bson.M{"wakes": 1},
+	})
+	if err == mgo.ErrNotFound {
+		return
+	}
+	if err != nil {
+		log.Errorf("[auto sleep] unable to record wake of app %q: %s", app.Name, err)
+		return
+	}
+	evt, err := event.NewInternal(&event.Opts{
+		Target:       event.Target{Type: event.TargetTypeApp, Value: app.Name},
+		InternalKind: autoWakeEventKind,
+		CustomData:   map[string]interface{}{"startDuration": duration.Seconds()},
+		DisableLock:  true,
+	})
+	if err != nil {
+		log.Errorf("[auto sleep] unable to create wake event for app %q: %s", app.Name, err)
+		return
+	}
+	evt.Logf("app %s started in %s", app.Name, duration)
+	evt.Done(nil)
+}
+
+// clearAsleep marks an app put to sleep by the auto sleeper as awake without
+// recording a wake. It's called after deploys, restarts and route rebuilds,
+// which point the routes of the app back to its units, errors are only
+// logged.
+func (app *App) clearAsleep() {
+	coll, err := autoSleepCollection()
+	if err != nil {
+		log.Errorf("[auto sleep] unable to clear sleep of app %q: %s", app.Name, err)
+		return
+	}
+	defer coll.Close()
+	now := time.Now().UTC()
+	err = coll.Update(bson.M{"_id": app.Name, "asleep": true}, bson.M{
+		"$set": bson.M{"asleep": false, "lastactivity": now},
+	})
+	if err != nil && err != mgo.ErrNotFound {
+		log.Errorf("[auto sleep] unable to clear sleep of app %q: %s", app.Name, err)
+	}
+}
+
+// AutoSleeper periodically checks the request activity of the apps with auto
+// sleep enabled, putting to sleep the ones idle for longer than allowed.
+// Sleeping apps have their routes pointing to ProxyURL, which is expected to
+// wake them up on the first request.
+type AutoSleeper struct {
+	Interval time.Duration
+	ProxyURL *url.URL
+	done     chan bool
+}
+
+// NewAutoSleeper creates a sleeper using the "auto-sleep:*" config keys. It
+// returns ErrAutoSleepNotConfigured when no proxy URL is configured.
+func NewAutoSleeper() (*AutoSleeper, error) {
+	proxy, _ := config.GetString("auto-sleep:proxy-url")
+	if proxy == "" {
+		return nil, ErrAutoSleepNotConfigured
+	}
+	proxyURL, err := url.Parse(proxy)
+	if err != nil {
+		return nil, err
+	}
+	interval := defaultAutoSleepInterval
+	if value, err := config.GetInt("auto-sleep:interval"); err == nil && value > 0 {
+		interval = time.Duration(value) * time.Second
+	}
+	return &AutoSleeper{
+		Interval: interval,
+		ProxyURL: proxyURL,
+		done:     make(chan bool),
+	}, nil
+}
+
+func (s *AutoSleeper) Start() {
+	go func() {
+		for {
+			err := s.runOnce()
+			if err != nil {
+				log.Errorf("[auto sleep] %s", err)
+			}
+			select {
+			case <-s.done:
+				return
+			case <-time.After(s.Interval):
+			}
+		}
+	}()
+}
+
+func (s *AutoSleeper) Shutdown() {
+	s.done <- true
+}
+
+func (s *AutoSleeper) String() string {
+	return "auto sleeper"
+}
+
+func (s *AutoSleeper) runOnce() error {
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	var apps []App
+	err = conn.Apps().Find(nil).All(&apps)
+	conn.Close()
+	if err != nil {
+		return err
+	}
+	for i := range apps {
+		if apps[i].AutoSleepIdle() == 0 {
+			continue
+		}
+		_, err = apps[i].activityRouters()
+		if err == ErrActivityNotSupported {
+			continue
+		}
+		if err == nil {
+			err = s.check(&apps[i])
+		}
+		if err != nil {
+			log.Errorf("[auto sleep] unable to check app %s: %s", apps[i].Name, err)
+		}
+	}
+	return nil
+}
+
+// check updates the last activity of an app and puts it to sleep when it's
+// idle. Apps locked by other operations, apps already asleep and apps without
+// started units are skipped.
+func (s *AutoSleeper) check(a *App) error {
+	locked, err := AcquireApplicationLock(a.Name, InternalAppName, "auto-sleep")
+	if err != nil {
+		return err
+	}
+	if !locked {
+		return nil
+	}
+	defer ReleaseApplicationLock(a.Name)
+	coll, err := autoSleepCollection()
+	if err != nil {
+		return err
+	}
+	defer coll.Close()
+	now := time.Now().UTC()
+	var status AutoSleepStatus
+	err = coll.FindId(a.Name).One(&status)
+	if err == mgo.ErrNotFound {
+		status = AutoSleepStatus{App: a.Name, LastActivity: now}
+		err = coll.Insert(status)
+	}
+	if err != nil || status.Asleep {
+		return err
+	}
+	started, err := hasStartedUnits(a)
+	if err != nil || !started {
+		return err
+	}
+	last, err := a.LastActivity()
+	if err != nil {
+		return err
+	}
+	if last.After(status.LastActivity) {
+		status.LastActivity = last.UTC()
+		return coll.UpdateId(a.Name, bson.M{"$set": bson.M{"lastactivity": status.LastActivity}})
+	}
+	idle := a.AutoSleepIdle()
+	if now.Sub(status.LastActivity) < idle {
+		return nil
+	}
+	evt, err := event.NewInternal(&event.Opts{
+		Target:       event.Target{Type: event.TargetTypeApp, Value: a.Name},
+		InternalKind: autoSleepEventKind,
+		CustomData:   map[string]interface{}{"lastActivity": status.LastActivity, "idleMinutes": int(idle / time.Minute)},
+		DisableLock:  true,
+	})
+	if err != nil {
+		return err
+	}
+	err = a.Sleep(evt, "", s.ProxyURL)
+	if err == nil {
+		err = coll.UpdateId(a.Name, bson.M{
+			"$set": bson.M{"asleep": true, "sleptat": now},
+			"$inc": bson.M{"sleeps": 1},
+		})
+	}
+	if doneErr := evt.Done(err); doneErr != nil {
+		log.Errorf("[auto sleep] unable to finish event for app %s: %s", a.Name, doneErr)
+	}
+	return err
+}
+
+func hasStartedUnits(a *App) (bool, error) {
+	units, err := a.Units()
+	if err != nil {
+		return false, err
+	}
+	for _, unit := range units {
+		if unit.Status == provision.StatusStarted {
+			return true, nil
+		}
+	}
+	return false, nil
+}
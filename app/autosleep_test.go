@@ -0,0 +1,266 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package app
+
+import (
+	"bytes"
+	"net/url"
+	"time"
+
+	"github.com/tsuru/config"
+	"github.com/tsuru/tsuru/errors"
+	"github.com/tsuru/tsuru/event"
+	"github.com/tsuru/tsuru/permission"
+	"github.com/tsuru/tsuru/router/routertest"
+	"gopkg.in/check.v1"
+	"gopkg.in/mgo.v2/bson"
+)
+
+func (s *S) newAutoSleeper(c *check.C) *AutoSleeper {
+	proxyURL, err := url.Parse("http://sleep-proxy.example.com")
+	c.Assert(err, check.IsNil)
+	return &AutoSleeper{Interval: time.Minute, ProxyURL: proxyURL}
+}
+
+func (s *S) setLastActivity(c *check.C, appName string, t time.Time) {
+	coll, err := autoSleepCollection()
+	c.Assert(err, check.IsNil)
+	defer coll.Close()
+	err = coll.UpdateId(appName, bson.M{"$set": bson.M{"lastactivity": t}})
+	c.Assert(err, check.IsNil)
+}
+
+func (s *S) TestAutoSleepIdle(c *check.C) {
+	config.Set("auto-sleep:pools:pool1:idle-minutes", 30)
+	defer config.Unset("auto-sleep")
+	a := App{Name: "myapp", Pool: "pool1"}
+	c.Assert(a.AutoSleepIdle(), check.Equals, 30*time.Minute)
+	a.AutoSleep = &AutoSleep{IdleMinutes: 10}
+	c.Assert(a.AutoSleepIdle(), check.Equals, 10*time.Minute)
+	a.AutoSleep = &AutoSleep{}
+	c.Assert(a.AutoSleepIdle(), check.Equals, time.Duration(0))
+	a = App{Name: "myapp", Pool: "pool2"}
+	c.Assert(a.AutoSleepIdle(), check.Equals, time.Duration(0))
+}
+
+func (s *S) TestSetAutoSleep(c *check.C) {
+	a := s.createRouterApp(c)
+	defer s.provisioner.Destroy(a)
+	err := a.SetAutoSleep(&AutoSleep{IdleMinutes: 15})
+	c.Assert(err, check.IsNil)
+	dbApp, err := GetByName(a.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(dbApp.AutoSleep, check.DeepEquals, &AutoSleep{IdleMinutes: 15})
+	err = a.SetAutoSleep(nil)
+	c.Assert(err, check.IsNil)
+	dbApp, err = GetByName(a.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(dbApp.AutoSleep, check.IsNil)
+	err = a.SetAutoSleep(&AutoSleep{IdleMinutes: -1})
+	c.Assert(err, check.FitsTypeOf, &errors.ValidationError{})
+}
+
+func (s *S) TestSetAutoSleepActivityNotTracked(c *check.C) {
+	a := s.createRouterApp(c)
+	defer s.provisioner.Destroy(a)
+	routertest.FakeRouter.DisableActivity()
+	err := a.SetAutoSleep(&AutoSleep{IdleMinutes: 15})
+	c.Assert(err, check.DeepEquals, &errors.ValidationError{Message: ErrActivityNotSupported.Error()})
+	dbApp, err := GetByName(a.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(dbApp.AutoSleep, check.IsNil)
+	err = a.SetAutoSleep(&AutoSleep{})
+	c.Assert(err, check.IsNil)
+}
+
+func (s *S) TestAutoSleeperSleepsIdleApp(c *check.C) {
+	a := s.createRouterApp(c)
+	defer s.provisioner.Destroy(a)
+	err := a.SetAutoSleep(&AutoSleep{IdleMinutes: 10})
+	c.Assert(err, check.IsNil)
+	sleeper := s.newAutoSleeper(c)
+	err = sleeper.check(a)
+	c.Assert(err, check.IsNil)
+	c.Assert(s.provisioner.Sleeps(a, ""), check.Equals, 0)
+	s.setLastActivity(c, a.Name, time.Now().Add(-time.Hour))
+	err = sleeper.check(a)
+	c.Assert(err, check.IsNil)
+	c.Assert(s.provisioner.Sleeps(a, ""), check.Equals, 1)
+	routes, err := routertest.FakeRouter.Routes(a.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(routes, check.DeepEquals, []*url.URL{sleeper.ProxyURL})
+	status, err := a.GetAutoSleepStatus()
+	c.Assert(err, check.IsNil)
+	c.Assert(status.Asleep, check.Equals, true)
+	c.Assert(status.Sleeps, check.Equals, 1)
+	c.Assert(status.IdleMinutes, check.Equals, 10)
+	evts, err := event.List(&event.Filter{KindName: autoSleepEventKind})
+	c.Assert(err, check.IsNil)
+	c.Assert(evts, check.HasLen, 1)
+	c.Assert(evts[0].Target, check.Equals, event.Target{Type: event.TargetTypeApp, Value: a.Name})
+	err = sleeper.check(a)
+	c.Assert(err, check.IsNil)
+	c.Assert(s.provisioner.Sleeps(a, ""), check.Equals, 1)
+}
+
+func (s *S) TestAutoSleeperKeepsActiveApp(c *check.C) {
+	a := s.createRouterApp(c)
+	defer s.provisioner.Destroy(a)
+	err := a.SetAutoSleep(&AutoSleep{IdleMinutes: 10})
+	c.Assert(err, check.IsNil)
+	sleeper := s.newAutoSleeper(c)
+	err = sleeper.check(a)
+	c.Assert(err, check.IsNil)
+	s.setLastActivity(c, a.Name, time.Now().Add(-time.Hour))
+	lastRequest := time.Now().Add(-time.Minute).UTC().Truncate(time.Second)
+	routertest.FakeRouter.SetLastActivity(a.Name, lastRequest)
+	err = sleeper.check(a)
+	c.Assert(err, check.IsNil)
+	c.Assert(s.provisioner.Sleeps(a, ""), check.Equals, 0)
+	status, err := a.GetAutoSleepStatus()
+	c.Assert(err, check.IsNil)
+	c.Assert(status.Asleep, check.Equals, false)
+	c.Assert(status.LastActivity.Equal(lastRequest), check.Equals, true)
+}
+
+func (s *S) TestAutoSleeperSkipsDisabledApps(c *check.C) {
+	a := s.createRouterApp(c)
+	defer s.provisioner.Destroy(a)
+	sleeper := s.newAutoSleeper(c)
+	err := sleeper.runOnce()
+	c.Assert(err, check.IsNil)
+	status, err := a.GetAutoSleepStatus()
+	c.Assert(err, check.IsNil)
+	c.Assert(status.LastActivity.IsZero(), check.Equals, true)
+	c.Assert(status.IdleMinutes, check.Equals, 0)
+}
+
+func (s *S) TestAutoSleeperSkipsAppsWithoutActivity(c *check.C) {
+	config.Set("auto-sleep:pools:"+s.Pool+":idle-minutes", 10)
+	defer config.Unset("auto-sleep")
+	a := s.createRouterApp(c)
+	defer s.provisioner.Destroy(a)
+	err := s.conn.Apps().Update(bson.M{"name": a.Name}, bson.M{"$set": bson.M{"pool": s.Pool}})
+	c.Assert(err, check.IsNil)
+	a.Pool = s.Pool
+	routertest.FakeRouter.DisableActivity()
+	sleeper := s.newAutoSleeper(c)
+	err = sleeper.runOnce()
+	c.Assert(err, check.IsNil)
+	status, err := a.GetAutoSleepStatus()
+	c.Assert(err, check.IsNil)
+	c.Assert(status.LastActivity.IsZero(), check.Equals, true)
+	c.Assert(status.IdleMinutes, check.Equals, 10)
+	locked, err := AcquireApplicationLock(a.Name, "me", "test")
+	c.Assert(err, check.IsNil)
+	c.Assert(locked, check.Equals, true)
+	ReleaseApplicationLock(a.Name)
+}
+
+func (s *S) TestStartMarksAutoSleptAppAwake(c *check.C) {
+	a := s.createRouterApp(c)
+	defer s.provisioner.Destroy(a)
+	err := a.SetAutoSleep(&AutoSleep{IdleMinutes: 10})
+	c.Assert(err, check.IsNil)
+	sleeper := s.newAutoSleeper(c)
+	err = sleeper.check(a)
+	c.Assert(err, check.IsNil)
+	s.setLastActivity(c, a.Name, time.Now().Add(-time.Hour))
+	err = sleeper.check(a)
+	c.Assert(err, check.IsNil)
+	var b bytes.Buffer
+	err = a.Start(&b, "")
+	c.Assert(err, check.IsNil)
+	status, err := a.GetAutoSleepStatus()
+	c.Assert(err, check.IsNil)
+	c.Assert(status.Asleep, check.Equals, false)
+	c.Assert(status.Wakes, check.Equals, 1)
+	c.Assert(status.WokeAt.IsZero(), check.Equals, false)
+	c.Assert(status.LastStartDuration > 0, check.Equals, true)
+	evts, err := event.List(&event.Filter{KindName: autoWakeEventKind})
+	c.Assert(err, check.IsNil)
+	c.Assert(evts, check.HasLen, 1)
+	err = a.Start(&b, "")
+	c.Assert(err, check.IsNil)
+	status, err = a.GetAutoSleepStatus()
+	c.Assert(err, check.IsNil)
+	c.Assert(status.Wakes, check.Equals, 1)
+}
+
+func (s *S) TestDeployClearsAsleepWithoutWake(c *check.C) {
+	a := s.createRouterApp(c)
+	defer s.provisioner.Destroy(a)
+	err := a.SetAutoSleep(&AutoSleep{IdleMinutes: 10})
+	c.Assert(err, check.IsNil)
+	sleeper := s.newAutoSleeper(c)
+	err = sleeper.check(a)
+	c.Assert(err, check.IsNil)
+	s.setLastActivity(c, a.Name, time.Now().Add(-time.Hour))
+	err = sleeper.check(a)
+	c.Assert(err, check.IsNil)
+	evt, err := event.New(&event.Opts{
+		Target:   event.Target{Type: event.TargetTypeApp, Value: a.Name},
+		Kind:     permission.PermAppDeploy,
+		RawOwner: event.Owner{Type: event.OwnerTypeUser, Name: s.user.Email},
+	})
+	c.Assert(err, check.IsNil)
+	_, err = Deploy(DeployOptions{
+		App:          a,
+		Image:        "myimage",
+		OutputStream: &bytes.Buffer{},
+		Event:        evt,
+	})
+	c.Assert(err, check.IsNil)
+	status, err := a.GetAutoSleepStatus()
+	c.Assert(err, check.IsNil)
+	c.Assert(status.Asleep, check.Equals, false)
+	c.Assert(status.Wakes, check.Equals, 0)
+	c.Assert(status.WokeAt.IsZero(), check.Equals, true)
+	evts, err := event.List(&event.Filter{KindName: autoWakeEventKind})
+	c.Assert(err, check.IsNil)
+	c.Assert(evts, check.HasLen, 0)
+}
+
+func (s *S) putAppToSleep(c *check.C, a *App) {
+	err := a.SetAutoSleep(&AutoSleep{IdleMinutes: 10})
+	c.Assert(err, check.IsNil)
+	sleeper := s.newAutoSleeper(c)
+	err = sleeper.check(a)
+	c.Assert(err, check.IsNil)
+	s.setLastActivity(c, a.Name, time.Now().Add(-time.Hour))
+	err = sleeper.check(a)
+	c.Assert(err, check.IsNil)
+	status, err := a.GetAutoSleepStatus()
+	c.Assert(err, check.IsNil)
+	c.Assert(status.Asleep, check.Equals, true)
+}
+
+func (s *S) TestRestartClearsAsleepWithoutWake(c *check.C) {
+	a := s.createRouterApp(c)
+	defer s.provisioner.Destroy(a)
+	s.putAppToSleep(c, a)
+	var b bytes.Buffer
+	err := a.Restart("", &b)
+	c.Assert(err, check.IsNil)
+	status, err := a.GetAutoSleepStatus()
+	c.Assert(err, check.IsNil)
+	c.Assert(status.Asleep, check.Equals, false)
+	c.Assert(status.Wakes, check.Equals, 0)
+}
+
+func (s *S) TestRebuildRoutesClearsAsleepWithoutWake(c *check.C) {
+	a := s.createRouterApp(c)
+	defer s.provisioner.Destroy(a)
+	s.putAppToSleep(c, a)
+	_, err := a.RebuildRoutes()
+	c.Assert(err, check.IsNil)
+	status, err := a.GetAutoSleepStatus()
+	c.Assert(err, check.IsNil)
+	c.Assert(status.Asleep, check.Equals, false)
+	c.Assert(status.Wakes, check.Equals, 0)
+	evts, err := event.List(&event.Filter{KindName: autoWakeEventKind})
+	c.Assert(err, check.IsNil)
+	c.Assert(evts, check.HasLen, 0)
+}
@@ -0,0 +1,400 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package app
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	stderr "errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/tsuru/config"
+	"github.com/tsuru/tsuru/db"
+	"github.com/tsuru/tsuru/db/storage"
+	"github.com/tsuru/tsuru/errors"
+	"github.com/tsuru/tsuru/event"
+	"github.com/tsuru/tsuru/log"
+	"github.com/tsuru/tsuru/router"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+const (
+	certificateExpiringEventKind = "certificate-expiring"
+
+	defaultExpiryCheckInterval = 12 * time.Hour
+	defaultExpiryWarning       = 30 * 24 * time.Hour
+)
+
+var (
+	ErrTLSNotSupported          = stderr.New("the router of the app doesn't support TLS certificates")
+	ErrCertificateEncryptionKey = stderr.New(`config key "certificates:encryption-key" not found`)
+)
+
+// cnameCertificate is the stored version of a certificate set in an app
+// cname. The key is encrypted, so that it can be restored in the router
+// without being readable from the database.
+type cnameCertificate struct {
+	CName       string `bson:"_id"`
+	App         string
+	Certificate string
+	Key         []byte
+	ExpiresAt   time.Time
+	Notified    bool
+}
+
+// CertificateExpiring is the custom data of the events created when the
+// certificate of a cname is about to expire.
+type CertificateExpiring struct {
+	CName     string
+	ExpiresAt time.Time
+}
+
+func certificatesCollection() (*storage.Collection, error) {
+	conn, err := db.Conn()
+	if err != nil {
+		return nil, err
+	}
+	return conn.Collection("app_certificates"), nil
+}
+
+func (app *App) tlsRouter() (router.TLSRouter, error) {
+	routerName, err := app.GetRouter()
+	if err != nil {
+		return nil, err
+	}
+	r, err := router.Get(routerName)
+	if err != nil {
+		return nil, err
+	}
+	tlsRouter, ok := r.(router.TLSRouter)
+	if !ok {
+		return nil, ErrTLSNotSupported
+	}
+	return tlsRouter, nil
+}
+
+// certificateRouters returns the routers of the app serving a cname, in which
+// its certificate must be added. The hostname of the app is only served by
+// the main router, while the other cnames are also served by the other
+// routers of the app able to handle cnames and TLS certificates.
+func (app *App) certificateRouters(cname string) ([]router.TLSRouter, error) {
+	mainRouter, err := app.tlsRouter()
+	if err != nil {
+		return nil, err
+	}
+	routers := []router.TLSRouter{mainRouter}
+	appRouters, err := app.GetRouters()
+	if err != nil {
+		return nil, err
+	}
+	for _, appRouter := range appRouters[1:] {
+		r, err := router.Get(appRouter.Name)
+		if err != nil {
+			return nil, err
+		}
+		if tlsRouter, ok := r.(router.TLSRouter); ok && app.servesCName(r, false, cname) {
+			routers = append(routers, tlsRouter)
+		}
+	}
+	return routers, nil
+}
+
+// servesCName tells whether a cname of the app is served by one of its
+// routers.
+func (app *App) servesCName(r router.Router, mainRouter bool, cname string) bool {
+	if mainRouter {
+		return true
+	}
+	if cname == app.Ip {
+		return false
+	}
+	_, ok := r.(router.CNameRouter)
+	return ok
+}
+
+func (app *App) hasCName(cname string) bool {
+	if cname == app.Ip {
+		return true
+	}
+	for _, c := range app.CName {
+		if c == cname {
+			return true
+		}
+	}
+	return false
+}
+
+// SetCertificate validates a certificate and its key for a cname of the app,
+// adds them to the routers serving the cname and stores them, so that the
+// expiration of the certificate can be tracked.
+func (app *App) SetCertificate(cname, certificate, key string) error {
+	if !app.hasCName(cname) {
+		return &errors.ValidationError{Message: fmt.Sprintf("cname %s not found in app", cname)}
+	}
+	pair, err := tls.X509KeyPair([]byte(certificate), []byte(key))
+	if err != nil {
+		return &errors.ValidationError{Message: fmt.Sprintf("invalid certificate: %s", err)}
+	}
+	x509Cert, err := x509.ParseCertificate(pair.Certificate[0])
+	if err != nil {
+		return &errors.ValidationError{Message: fmt.Sprintf("invalid certificate: %s", err)}
+	}
+	err = x509Cert.VerifyHostname(cname)
+	if err != nil {
+		return &errors.ValidationError{Message: err.Error()}
+	}
+	encryptedKey, err := encryptCertificateKey([]byte(key))
+	if err != nil {
+		return err
+	}
+	tlsRouters, err := app.certificateRouters(cname)
+	if err != nil {
+		return err
+	}
+	for _, tlsRouter := range tlsRouters {
+		err = tlsRouter.AddCertificate(app.Name, cname, certificate, key)
+		if err != nil {
+			return err
+		}
+	}
+	coll, err := certificatesCollection()
+	if err != nil {
+		return err
+	}
+	defer coll.Close()
+	_, err = coll.UpsertId(cname, cnameCertificate{
+		CName:       cname,
+		App:         app.Name,
+		Certificate: certificate,
+		Key:         encryptedKey,
+		ExpiresAt:   x509Cert.NotAfter,
+	})
+	return err
+}
+
+// RemoveCertificate removes the certificate of a cname of the app from the
+// routers serving the cname and from the storage.
+func (app *App) RemoveCertificate(cname string) error {
+	if !app.hasCName(cname) {
+		return &errors.ValidationError{Message: fmt.Sprintf("cname %s not found in app", cname)}
+	}
+	tlsRouters, err := app.certificateRouters(cname)
+	if err != nil {
+		return err
+	}
+	for i, tlsRouter := range tlsRouters {
+		err = tlsRouter.RemoveCertificate(app.Name, cname)
+		if err == router.ErrCertificateNotFound && i > 0 {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return removeCertificates(cname)
+}
+
+// GetCertificates returns the certificates of the app, indexed by cname. The
+// hostname of the app in the router is included, with an empty value when no
+// certificate is set, while other cnames are only included when they have a
+// certificate.
+func (app *App) GetCertificates() (map[string]string, error) {
+	tlsRouter, err := app.tlsRouter()
+	if err != nil {
+		return nil, err
+	}
+	certificates := make(map[string]string)
+	for _, cname := range append([]string{app.Ip}, app.CName...) {
+		cert, err := tlsRouter.Certificate(app.Name, cname)
+		if err == router.ErrCertificateNotFound {
+			if cname == app.Ip {
+				certificates[cname] = ""
+			}
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		certificates[cname] = cert
+	}
+	return certificates, nil
+}
+
+// restoreCertificates adds the stored certificates of the app to the router,
+// skipping the cnames not served by it.
+func (app *App) restoreCertificates(r router.Router, mainRouter bool) error {
+	tlsRouter, ok := r.(router.TLSRouter)
+	if !ok {
+		return nil
+	}
+	coll, err := certificatesCollection()
+	if err != nil {
+		return err
+	}
+	defer coll.Close()
+	var certs []cnameCertificate
+	err = coll.Find(bson.M{"app": app.Name}).All(&certs)
+	if err != nil {
+		return err
+	}
+	for _, cert := range certs {
+		if !app.hasCName(cert.CName) || !app.servesCName(r, mainRouter, cert.CName) {
+			continue
+		}
+		key, err := decryptCertificateKey(cert.Key)
+		if err != nil {
+			return err
+		}
+		err = tlsRouter.AddCertificate(app.Name, cert.CName, cert.Certificate, string(key))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func removeCertificates(cnames ...string) error {
+	coll, err := certificatesCollection()
+	if err != nil {
+		return err
+	}
+	defer coll.Close()
+	_, err = coll.RemoveAll(bson.M{"_id": bson.M{"$in": cnames}})
+	return err
+}
+
+func certificateCipher() (cipher.AEAD, error) {
+	secret, err := config.GetString("certificates:encryption-key")
+	if err != nil || secret == "" {
+		return nil, ErrCertificateEncryptionKey
+	}
+	key := sha256.Sum256([]byte(secret))
+	block, err := aes.NewCipher(key[:])
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func encryptCertificateKey(data []byte) ([]byte, error) {
+	gcm, err := certificateCipher()
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	_, err = io.ReadFull(rand.Reader, nonce)
+	if err != nil {
+		return nil, err
+	}
+	return gcm.Seal(nonce, nonce, data, nil), nil
+}
+
+func decryptCertificateKey(data []byte) ([]byte, error) {
+	gcm, err := certificateCipher()
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < gcm.NonceSize() {
+		return nil, stderr.New("invalid encrypted certificate key")
+	}
+	return gcm.Open(nil, data[:gcm.NonceSize()], data[gcm.NonceSize():], nil)
+}
+
+// CertificateExpiryChecker periodically looks for certificates that are about
+// to expire, creating an event for each of them. Each certificate generates
+// only one event, until it's replaced.
+type CertificateExpiryChecker struct {
+	CheckInterval time.Duration
+	Warning       time.Duration
+	done          chan bool
+}
+
+// NewCertificateExpiryChecker creates a checker using the intervals, in
+// seconds, defined in the "certificates:expiry-check-interval" and
+// "certificates:expiry-warning" config keys.
+func NewCertificateExpiryChecker() *CertificateExpiryChecker {
+	checkInterval := defaultExpiryCheckInterval
+	if value, err := config.GetInt("certificates:expiry-check-interval"); err == nil && value > 0 {
+		checkInterval = time.Duration(value) * time.Second
+	}
+	warning := defaultExpiryWarning
+	if value, err := config.GetInt("certificates:expiry-warning"); err == nil && value > 0 {
+		warning = time.Duration(value) * time.Second
+	}
+	return &CertificateExpiryChecker{
+		CheckInterval: checkInterval,
+		Warning:       warning,
+		done:          make(chan bool),
+	}
+}
+
+func (c *CertificateExpiryChecker) Start() {
+	go func() {
+		for {
+			err := c.runOnce()
+			if err != nil {
+				log.Errorf("[certificate expiry checker] %s", err)
+			}
+			select {
+			case <-c.done:
+				return
+			case <-time.After(c.CheckInterval):
+			}
+		}
+	}()
+}
+
+func (c *CertificateExpiryChecker) Shutdown() {
+	c.done <- true
+}
+
+func (c *CertificateExpiryChecker) String() string {
+	return "certificate expiry checker"
+}
+
+func (c *CertificateExpiryChecker) runOnce() error {
+	coll, err := certificatesCollection()
+	if err != nil {
+		return err
+	}
+	defer coll.Close()
+	var certs []cnameCertificate
+	err = coll.Find(bson.M{
+		"notified":  false,
+		"expiresat": bson.M{"$lte": time.Now().Add(c.Warning)},
+	}).All(&certs)
+	if err != nil {
+		return err
+	}
+	for _, cert := range certs {
+		evt, err := event.NewInternal(&event.Opts{
+			Target:       event.Target{Type: event.TargetTypeApp, Value: cert.App},
+			InternalKind: certificateExpiringEventKind,
+			CustomData:   CertificateExpiring{CName: cert.CName, ExpiresAt: cert.ExpiresAt},
+			DisableLock:  true,
+		})
+		if err != nil {
+			log.Errorf("[certificate expiry checker] unable to create event for %s: %s", cert.CName, err)
+			continue
+		}
+		evt.Logf("certificate of %s in app %s expires at %s", cert.CName, cert.App, cert.ExpiresAt.Format(time.RFC3339))
+		err = evt.Done(nil)
+		if err != nil {
+			log.Errorf("[certificate expiry checker] unable to finish event for %s: %s", cert.CName, err)
+		}
+		err = coll.UpdateId(cert.CName, bson.M{"$set": bson.M{"notified": true}})
+		if err != nil && err != mgo.ErrNotFound {
+			return err
+		}
+	}
+	return nil
+}
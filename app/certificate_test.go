@@ -0,0 +1,209 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package app
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"time"
+
+	"github.com/tsuru/tsuru/event"
+	"github.com/tsuru/tsuru/provision"
+	"github.com/tsuru/tsuru/router"
+	"github.com/tsuru/tsuru/router/routertest"
+	"gopkg.in/check.v1"
+)
+
+func generateCertificate(c *check.C, hostname string, notAfter time.Time) (string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	c.Assert(err, check.IsNil)
+	template := x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: hostname},
+		DNSNames:     []string{hostname},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     notAfter,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, &template, &template, &key.PublicKey, key)
+	c.Assert(err, check.IsNil)
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	c.Assert(err, check.IsNil)
+	cert := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPem := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer})
+	return string(cert), string(keyPem)
+}
+
+func (s *S) createCertificateApp(c *check.C) *App {
+	a := &App{Name: "myapp", Ip: "myapp.fakerouter.com", CName: []string{"myapp.io"}, Plan: Plan{Router: "fake"}}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, check.IsNil)
+	err = s.provisioner.Provision(a)
+	c.Assert(err, check.IsNil)
+	return a
+}
+
+func (s *S) TestSetCertificate(c *check.C) {
+	a := s.createCertificateApp(c)
+	defer s.provisioner.Destroy(a)
+	notAfter := time.Now().Add(90 * 24 * time.Hour).UTC().Truncate(time.Second)
+	cert, key := generateCertificate(c, "myapp.io", notAfter)
+	err := a.SetCertificate("myapp.io", cert, key)
+	c.Assert(err, check.IsNil)
+	routerCert, err := routertest.FakeRouter.Certificate(a.Name, "myapp.io")
+	c.Assert(err, check.IsNil)
+	c.Assert(routerCert, check.Equals, cert)
+	coll, err := certificatesCollection()
+	c.Assert(err, check.IsNil)
+	defer coll.Close()
+	var stored cnameCertificate
+	err = coll.FindId("myapp.io").One(&stored)
+	c.Assert(err, check.IsNil)
+	c.Assert(stored.App, check.Equals, a.Name)
+	c.Assert(stored.Certificate, check.Equals, cert)
+	c.Assert(stored.ExpiresAt.Equal(notAfter), check.Equals, true)
+	c.Assert(string(stored.Key), check.Not(check.Equals), key)
+	decrypted, err := decryptCertificateKey(stored.Key)
+	c.Assert(err, check.IsNil)
+	c.Assert(string(decrypted), check.Equals, key)
+}
+
+func (s *S) TestSetCertificateMultipleRouters(c *check.C) {
+	a := s.createCertificateApp(c)
+	defer s.provisioner.Destroy(a)
+	err := a.AddRouter(provision.AppRouter{Name: "fake-hc"})
+	c.Assert(err, check.IsNil)
+	notAfter := time.Now().Add(90 * 24 * time.Hour)
+	cert, key := generateCertificate(c, "myapp.io", notAfter)
+	err = a.SetCertificate("myapp.io", cert, key)
+	c.Assert(err, check.IsNil)
+	ipCert, ipKey := generateCertificate(c, a.Ip, notAfter)
+	err = a.SetCertificate(a.Ip, ipCert, ipKey)
+	c.Assert(err, check.IsNil)
+	routerCert, err := routertest.HCRouter.Certificate(a.Name, "myapp.io")
+	c.Assert(err, check.IsNil)
+	c.Assert(routerCert, check.Equals, cert)
+	_, err = routertest.HCRouter.Certificate(a.Name, a.Ip)
+	c.Assert(err, check.Equals, router.ErrCertificateNotFound)
+	err = routertest.HCRouter.RemoveCertificate(a.Name, "myapp.io")
+	c.Assert(err, check.IsNil)
+	_, err = a.RebuildRoutes()
+	c.Assert(err, check.IsNil)
+	routerCert, err = routertest.HCRouter.Certificate(a.Name, "myapp.io")
+	c.Assert(err, check.IsNil)
+	c.Assert(routerCert, check.Equals, cert)
+	_, err = routertest.HCRouter.Certificate(a.Name, a.Ip)
+	c.Assert(err, check.Equals, router.ErrCertificateNotFound)
+	routerCert, err = routertest.FakeRouter.Certificate(a.Name, a.Ip)
+	c.Assert(err, check.IsNil)
+	c.Assert(routerCert, check.Equals, ipCert)
+	err = a.RemoveCertificate("myapp.io")
+	c.Assert(err, check.IsNil)
+	_, err = routertest.HCRouter.Certificate(a.Name, "myapp.io")
+	c.Assert(err, check.Equals, router.ErrCertificateNotFound)
+}
+
+func (s *S) TestSetCertificateInvalidCName(c *check.C) {
+	a := s.createCertificateApp(c)
+	defer s.provisioner.Destroy(a)
+	cert, key := generateCertificate(c, "other.io", time.Now().Add(time.Hour))
+	err := a.SetCertificate("other.io", cert, key)
+	c.Assert(err, check.ErrorMatches, "cname other.io not found in app")
+}
+
+func (s *S) TestSetCertificateHostnameMismatch(c *check.C) {
+	a := s.createCertificateApp(c)
+	defer s.provisioner.Destroy(a)
+	cert, key := generateCertificate(c, "other.io", time.Now().Add(time.Hour))
+	err := a.SetCertificate("myapp.io", cert, key)
+	c.Assert(err, check.ErrorMatches, ".*not myapp.io.*")
+	_, err = routertest.FakeRouter.Certificate(a.Name, "myapp.io")
+	c.Assert(err, check.Equals, router.ErrCertificateNotFound)
+}
+
+func (s *S) TestSetCertificateInvalidKey(c *check.C) {
+	a := s.createCertificateApp(c)
+	defer s.provisioner.Destroy(a)
+	cert, _ := generateCertificate(c, "myapp.io", time.Now().Add(time.Hour))
+	_, key := generateCertificate(c, "myapp.io", time.Now().Add(time.Hour))
+	err := a.SetCertificate("myapp.io", cert, key)
+	c.Assert(err, check.ErrorMatches, "invalid certificate: .*")
+}
+
+func (s *S) TestRemoveCertificate(c *check.C) {
+	a := s.createCertificateApp(c)
+	defer s.provisioner.Destroy(a)
+	cert, key := generateCertificate(c, "myapp.io", time.Now().Add(time.Hour))
+	err := a.SetCertificate("myapp.io", cert, key)
+	c.Assert(err, check.IsNil)
+	err = a.RemoveCertificate("myapp.io")
+	c.Assert(err, check.IsNil)
+	_, err = routertest.FakeRouter.Certificate(a.Name, "myapp.io")
+	c.Assert(err, check.Equals, router.ErrCertificateNotFound)
+	coll, err := certificatesCollection()
+	c.Assert(err, check.IsNil)
+	defer coll.Close()
+	n, err := coll.FindId("myapp.io").Count()
+	c.Assert(err, check.IsNil)
+	c.Assert(n, check.Equals, 0)
+	err = a.RemoveCertificate("myapp.io")
+	c.Assert(err, check.Equals, router.ErrCertificateNotFound)
+}
+
+func (s *S) TestGetCertificates(c *check.C) {
+	a := s.createCertificateApp(c)
+	defer s.provisioner.Destroy(a)
+	cert, key := generateCertificate(c, "myapp.io", time.Now().Add(time.Hour))
+	err := a.SetCertificate("myapp.io", cert, key)
+	c.Assert(err, check.IsNil)
+	certs, err := a.GetCertificates()
+	c.Assert(err, check.IsNil)
+	c.Assert(certs, check.DeepEquals, map[string]string{
+		"myapp.fakerouter.com": "",
+		"myapp.io":             cert,
+	})
+}
+
+func (s *S) TestRebuildRoutesRestoresCertificates(c *check.C) {
+	a := s.createCertificateApp(c)
+	defer s.provisioner.Destroy(a)
+	cert, key := generateCertificate(c, "myapp.io", time.Now().Add(time.Hour))
+	err := a.SetCertificate("myapp.io", cert, key)
+	c.Assert(err, check.IsNil)
+	routertest.FakeRouter.Reset()
+	_, err = a.RebuildRoutes()
+	c.Assert(err, check.IsNil)
+	routerCert, err := routertest.FakeRouter.Certificate(a.Name, "myapp.io")
+	c.Assert(err, check.IsNil)
+	c.Assert(routerCert, check.Equals, cert)
+}
+
+func (s *S) TestCertificateExpiryChecker(c *check.C) {
+	a := s.createCertificateApp(c)
+	defer s.provisioner.Destroy(a)
+	cert, key := generateCertificate(c, "myapp.io", time.Now().Add(24*time.Hour))
+	err := a.SetCertificate("myapp.io", cert, key)
+	c.Assert(err, check.IsNil)
+	cert, key = generateCertificate(c, "myapp.fakerouter.com", time.Now().Add(90*24*time.Hour))
+	err = a.SetCertificate("myapp.fakerouter.com", cert, key)
+	c.Assert(err, check.IsNil)
+	checker := &CertificateExpiryChecker{Warning: 7 * 24 * time.Hour}
+	err = checker.runOnce()
+	c.Assert(err, check.IsNil)
+	err = checker.runOnce()
+	c.Assert(err, check.IsNil)
+	evts, err := event.List(&event.Filter{KindName: certificateExpiringEventKind})
+	c.Assert(err, check.IsNil)
+	c.Assert(evts, check.HasLen, 1)
+	c.Assert(evts[0].Target, check.DeepEquals, event.Target{Type: event.TargetTypeApp, Value: a.Name})
+	var data CertificateExpiring
+	err = evts[0].StartData(&data)
+	c.Assert(err, check.IsNil)
+	c.Assert(data.CName, check.Equals, "myapp.io")
+}
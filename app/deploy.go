@@ -5,6 +5,7 @@
 package app
 
 import (
+	"errors"
 	"fmt"
 	"io"
 	"regexp"
@@ -26,6 +27,7 @@ const (
 	DeployArchiveURL  DeployKind = "archive-url"
 	DeployGit         DeployKind = "git"
 	DeployImage       DeployKind = "image"
+	DeployPromote     DeployKind = "promote"
 	DeployRollback    DeployKind = "rollback"
 	DeployUpload      DeployKind = "upload"
 	DeployUploadBuild DeployKind = "uploadbuild"
@@ -33,6 +35,8 @@ const (
 
 var reImageVersion = regexp.MustCompile("v[0-9]+$")
 
+var ErrPromoteNotSupported = errors.New("provisioner does not support promoting images between apps")
+
 type DeployData struct {
 	ID          bson.ObjectId `bson:"_id,omitempty"`
 	App         string
@@ -47,6 +51,9 @@ type DeployData struct {
 	CanRollback bool
 	RemoveDate  time.Time `bson:",omitempty"`
 	Diff        string
+	// AutoRollback holds the reason why tsuru automatically rolled back
+	// this deploy, if it did.
+	AutoRollback string
 }
 
 func findValidImages(apps ...string) (set, error) {
@@ -126,14 +133,17 @@ func eventToDeployData(evt *event.Event, validImages set, full bool) *DeployData
 		data.Commit = startOpts.Commit
 		data.Origin = startOpts.Origin
 	}
-	if full {
-		data.Log = evt.Log
-		var otherData map[string]string
-		err = evt.OtherData(&otherData)
-		if err == nil {
+	var otherData map[string]string
+	err = evt.OtherData(&otherData)
+	if err == nil {
+		data.AutoRollback = otherData["auto-rollback"]
+		if full {
 			data.Diff = otherData["diff"]
 		}
 	}
+	if full {
+		data.Log = evt.Log
+	}
 	var endData map[string]string
 	err = evt.EndData(&endData)
 	if err == nil {
@@ -164,6 +174,7 @@ type DeployOptions struct {
 	Event        *event.Event `bson:"-"`
 	Kind         DeployKind
 	Message      string
+	PromoteFrom  string
 }
 
 func (o *DeployOptions) GetKind() (kind DeployKind) {
@@ -173,6 +184,9 @@ func (o *DeployOptions) GetKind() (kind DeployKind) {
 	if o.Rollback {
 		return DeployRollback
 	}
+	if o.PromoteFrom != "" {
+		return DeployPromote
+	}
 	if o.Image != "" {
 		return DeployImage
 	}
@@ -214,6 +228,8 @@ func Deploy(opts DeployOptions) (string, error) {
 	if err != nil {
 		return "", err
 	}
+	opts.App.endMaintenance()
+	opts.App.clearAsleep()
 	err = incrementDeploy(opts.App)
 	if err != nil {
 		log.Errorf("WARNING: couldn't increment deploy count, deploy opts: %#v", opts)
@@ -228,6 +244,16 @@ func deployToProvisioner(opts *DeployOptions, evt *event.Event) (string, error)
 	switch opts.GetKind() {
 	case DeployRollback:
 		return Provisioner.Rollback(opts.App, opts.Image, evt)
+	case DeployPromote:
+		promoter, ok := Provisioner.(provision.ImagePromoter)
+		if !ok {
+			return "", ErrPromoteNotSupported
+		}
+		source, err := GetByName(opts.PromoteFrom)
+		if err != nil {
+			return "", err
+		}
+		return promoter.PromoteDeploy(opts.App, source, opts.Image, evt)
 	case DeployImage:
 		if deployer, ok := Provisioner.(provision.ImageDeployer); ok {
 			return deployer.ImageDeploy(opts.App, opts.Image, evt)
@@ -244,7 +270,7 @@ func deployToProvisioner(opts *DeployOptions, evt *event.Event) (string, error)
 }
 
 func ValidateOrigin(origin string) bool {
-	originList := []string{"app-deploy", "git", "rollback", "drag-and-drop", "image"}
+	originList := []string{"app-deploy", "git", "rollback", "drag-and-drop", "image", "promote"}
 	for _, ol := range originList {
 		if ol == origin {
 			return true
@@ -487,6 +487,7 @@ func (s *S) TestValidateOrigin(c *check.C) {
 	c.Assert(ValidateOrigin("rollback"), check.Equals, true)
 	c.Assert(ValidateOrigin("drag-and-drop"), check.Equals, true)
 	c.Assert(ValidateOrigin("image"), check.Equals, true)
+	c.Assert(ValidateOrigin("promote"), check.Equals, true)
 	c.Assert(ValidateOrigin("invalid"), check.Equals, false)
 }
 
@@ -659,6 +660,68 @@ func (s *S) TestRollbackWithNameImage(c *check.C) {
 	c.Assert(imgID, check.Equals, "registry.somewhere/tsuru/app-example:v2")
 }
 
+func (s *S) TestDeployPromote(c *check.C) {
+	source := App{
+		Name:     "myapp-staging",
+		Plan:     Plan{Router: "fake"},
+		Platform: "zend",
+		Teams:    []string{s.team.Name},
+	}
+	err := s.conn.Apps().Insert(source)
+	c.Assert(err, check.IsNil)
+	a := App{
+		Name:     "myapp",
+		Plan:     Plan{Router: "fake"},
+		Platform: "zend",
+		Teams:    []string{s.team.Name},
+	}
+	err = s.conn.Apps().Insert(a)
+	c.Assert(err, check.IsNil)
+	s.provisioner.Provision(&a)
+	s.provisioner.SetValidImagesForApp(source.Name, []string{"registry.somewhere/tsuru/app-myapp-staging:v1", "registry.somewhere/tsuru/app-myapp-staging:v2"})
+	writer := &bytes.Buffer{}
+	evt, err := event.New(&event.Opts{
+		Target:   event.Target{Type: "app", Value: a.Name},
+		Kind:     permission.PermAppDeploy,
+		RawOwner: event.Owner{Type: event.OwnerTypeUser, Name: s.user.Email},
+	})
+	c.Assert(err, check.IsNil)
+	imgID, err := Deploy(DeployOptions{
+		App:          &a,
+		OutputStream: writer,
+		PromoteFrom:  source.Name,
+		Event:        evt,
+	})
+	c.Assert(err, check.IsNil)
+	c.Assert(writer.String(), check.Equals, "Promote deploy called")
+	c.Assert(imgID, check.Equals, "registry.somewhere/tsuru/app-myapp-staging:v2")
+}
+
+func (s *S) TestDeployPromoteSourceNotFound(c *check.C) {
+	a := App{
+		Name:     "myapp",
+		Plan:     Plan{Router: "fake"},
+		Platform: "zend",
+		Teams:    []string{s.team.Name},
+	}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, check.IsNil)
+	s.provisioner.Provision(&a)
+	evt, err := event.New(&event.Opts{
+		Target:   event.Target{Type: "app", Value: a.Name},
+		Kind:     permission.PermAppDeploy,
+		RawOwner: event.Owner{Type: event.OwnerTypeUser, Name: s.user.Email},
+	})
+	c.Assert(err, check.IsNil)
+	_, err = Deploy(DeployOptions{
+		App:          &a,
+		OutputStream: &bytes.Buffer{},
+		PromoteFrom:  "unknown",
+		Event:        evt,
+	})
+	c.Assert(err, check.Equals, ErrAppNotFound)
+}
+
 func (s *S) TestRollbackWithVersionImage(c *check.C) {
 	a := App{
 		Name:     "otherapp",
@@ -733,6 +796,10 @@ func (s *S) TestDeployKind(c *check.C) {
 			DeployOptions{Image: "quay.io/tsuru/python"},
 			DeployImage,
 		},
+		{
+			DeployOptions{Image: "app-image", PromoteFrom: "otherapp"},
+			DeployPromote,
+		},
 		{
 			DeployOptions{File: ioutil.NopCloser(bytes.NewBuffer(nil))},
 			DeployUpload,
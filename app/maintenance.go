@@ -0,0 +1,204 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package app
+
+import (
+	stderr "errors"
+	"fmt"
+	"io/ioutil"
+
+	"github.com/tsuru/config"
+	"github.com/tsuru/tsuru/db"
+	"github.com/tsuru/tsuru/errors"
+	"github.com/tsuru/tsuru/log"
+	"github.com/tsuru/tsuru/router"
+	"gopkg.in/mgo.v2/bson"
+)
+
+const (
+	maxMaintenancePageSize = 512 * 1024
+
+	defaultMaintenancePage = `<!DOCTYPE html>
+<html>
+<head><title>Under maintenance</title></head>
+<body>
+<h1>Under maintenance</h1>
+<p>This application is under maintenance, please try again later.</p>
+</body>
+</html>
+`
+)
+
+var (
+	ErrMaintenanceNotSupported = stderr.New("the routers of the app don't support maintenance mode")
+	ErrNotInMaintenance        = stderr.New("the app is not in maintenance")
+)
+
+// Maintenance holds the maintenance mode of an app. When Page is empty, the
+// default page of the pool of the app is served.
+type Maintenance struct {
+	Page string `json:"page,omitempty"`
+}
+
+// defaultPoolMaintenancePage returns the maintenance page used by apps in the
+// given pool without a page of their own. It's read from the file in the
+// "maintenance:pools:<pool>:page" config, falling back to the file in the
+// "maintenance:page" config and to a built-in page.
+func defaultPoolMaintenancePage(pool string) (string, error) {
+	pageFile, err := config.GetString(fmt.Sprintf("maintenance:pools:%s:page", pool))
+	if err != nil {
+		pageFile, _ = config.GetString("maintenance:page")
+	}
+	if pageFile == "" {
+		return defaultMaintenancePage, nil
+	}
+	data, err := ioutil.ReadFile(pageFile)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+func (app *App) maintenancePage() (string, error) {
+	if app.Maintenance.Page != "" {
+		return app.Maintenance.Page, nil
+	}
+	return defaultPoolMaintenancePage(app.Pool)
+}
+
+func (app *App) maintenanceRouters() ([]router.MaintenanceRouter, error) {
+	appRouters, err := app.GetRouters()
+	if err != nil {
+		return nil, err
+	}
+	routers := make([]router.MaintenanceRouter, len(appRouters))
+	for i, appRouter := range appRouters {
+		r, err := router.Get(appRouter.Name)
+		if err != nil {
+			return nil, err
+		}
+		maintenanceRouter, ok := r.(router.MaintenanceRouter)
+		if !ok {
+			return nil, ErrMaintenanceNotSupported
+		}
+		routers[i] = maintenanceRouter
+	}
+	return routers, nil
+}
+
+// SetMaintenance makes the routers of the app serve a maintenance page
+// instead of forwarding the requests to the units. An empty page means the
+// default page of the pool of the app.
+func (app *App) SetMaintenance(page string) error {
+	if len(page) > maxMaintenancePageSize {
+		return &errors.ValidationError{Message: fmt.Sprintf("maintenance page must not be larger than %d bytes", maxMaintenancePageSize)}
+	}
+	routers, err := app.maintenanceRouters()
+	if err != nil {
+		return err
+	}
+	previous := app.Maintenance
+	app.Maintenance = &Maintenance{Page: page}
+	content, err := app.maintenancePage()
+	if err != nil {
+		app.Maintenance = previous
+		return err
+	}
+	for i, r := range routers {
+		err = r.SetMaintenance(app.Name, content)
+		if err != nil {
+			app.Maintenance = previous
+			app.rollbackMaintenance(routers[:i])
+			return err
+		}
+	}
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	return conn.Apps().Update(bson.M{"name": app.Name}, bson.M{"$set": bson.M{"maintenance": app.Maintenance}})
+}
+
+// rollbackMaintenance restores the previous maintenance mode of the app in
+// the given routers.
+func (app *App) rollbackMaintenance(routers []router.MaintenanceRouter) {
+	for _, r := range routers {
+		var err error
+		if app.Maintenance == nil {
+			err = r.UnsetMaintenance(app.Name)
+		} else {
+			var content string
+			content, err = app.maintenancePage()
+			if err == nil {
+				err = r.SetMaintenance(app.Name, content)
+			}
+		}
+		if err != nil {
+			log.Errorf("[maintenance] unable to restore maintenance mode of app %q: %s", app.Name, err)
+		}
+	}
+}
+
+// UnsetMaintenance makes the routers of the app forward the requests to the
+// units again.
+func (app *App) UnsetMaintenance() error {
+	if app.Maintenance == nil {
+		return ErrNotInMaintenance
+	}
+	routers, err := app.maintenanceRouters()
+	if err != nil {
+		return err
+	}
+	for _, r := range routers {
+		err = r.UnsetMaintenance(app.Name)
+		if err != nil {
+			return err
+		}
+	}
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	err = conn.Apps().Update(bson.M{"name": app.Name}, bson.M{"$unset": bson.M{"maintenance": ""}})
+	if err != nil {
+		return err
+	}
+	app.Maintenance = nil
+	return nil
+}
+
+// endMaintenance turns off the maintenance mode of the app, if it's on. It's
+// called after the app is successfully deployed or started, errors are only
+// logged.
+func (app *App) endMaintenance() {
+	if app.Maintenance == nil {
+		return
+	}
+	err := app.UnsetMaintenance()
+	if err != nil {
+		log.Errorf("[maintenance] unable to turn off maintenance mode of app %q: %s", app.Name, err)
+	}
+}
+
+// restoreMaintenance applies the maintenance mode of the app to a router.
+func (app *App) restoreMaintenance(r router.Router) error {
+	maintenanceRouter, ok := r.(router.MaintenanceRouter)
+	if !ok {
+		if app.Maintenance != nil {
+			return ErrMaintenanceNotSupported
+		}
+		return nil
+	}
+	if app.Maintenance == nil {
+		return maintenanceRouter.UnsetMaintenance(app.Name)
+	}
+	content, err := app.maintenancePage()
+	if err != nil {
+		return err
+	}
+	return maintenanceRouter.SetMaintenance(app.Name, content)
+}
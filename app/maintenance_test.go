@@ -0,0 +1,186 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package app
+
+import (
+	"bytes"
+	stderr "errors"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"github.com/tsuru/config"
+	"github.com/tsuru/tsuru/errors"
+	"github.com/tsuru/tsuru/event"
+	"github.com/tsuru/tsuru/permission"
+	"github.com/tsuru/tsuru/provision"
+	"github.com/tsuru/tsuru/router/routertest"
+	"gopkg.in/check.v1"
+)
+
+func (s *S) TestSetMaintenance(c *check.C) {
+	a := s.createRouterApp(c)
+	defer s.provisioner.Destroy(a)
+	err := a.SetMaintenance("<h1>brb</h1>")
+	c.Assert(err, check.IsNil)
+	page, ok := routertest.FakeRouter.MaintenancePage(a.Name)
+	c.Assert(ok, check.Equals, true)
+	c.Assert(page, check.Equals, "<h1>brb</h1>")
+	dbApp, err := GetByName(a.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(dbApp.Maintenance, check.DeepEquals, &Maintenance{Page: "<h1>brb</h1>"})
+}
+
+func (s *S) TestSetMaintenanceDefaultPage(c *check.C) {
+	a := s.createRouterApp(c)
+	defer s.provisioner.Destroy(a)
+	err := a.SetMaintenance("")
+	c.Assert(err, check.IsNil)
+	page, ok := routertest.FakeRouter.MaintenancePage(a.Name)
+	c.Assert(ok, check.Equals, true)
+	c.Assert(page, check.Equals, defaultMaintenancePage)
+	dbApp, err := GetByName(a.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(dbApp.Maintenance, check.DeepEquals, &Maintenance{})
+}
+
+func (s *S) TestSetMaintenancePoolDefaultPage(c *check.C) {
+	dir := c.MkDir()
+	defaultFile := filepath.Join(dir, "default.html")
+	poolFile := filepath.Join(dir, "pool.html")
+	err := ioutil.WriteFile(defaultFile, []byte("default page"), 0644)
+	c.Assert(err, check.IsNil)
+	err = ioutil.WriteFile(poolFile, []byte("pool page"), 0644)
+	c.Assert(err, check.IsNil)
+	config.Set("maintenance:page", defaultFile)
+	config.Set("maintenance:pools:pool1:page", poolFile)
+	defer config.Unset("maintenance")
+	a := s.createRouterApp(c)
+	defer s.provisioner.Destroy(a)
+	err = a.SetMaintenance("")
+	c.Assert(err, check.IsNil)
+	page, _ := routertest.FakeRouter.MaintenancePage(a.Name)
+	c.Assert(page, check.Equals, "default page")
+	a.Pool = "pool1"
+	err = a.SetMaintenance("")
+	c.Assert(err, check.IsNil)
+	page, _ = routertest.FakeRouter.MaintenancePage(a.Name)
+	c.Assert(page, check.Equals, "pool page")
+}
+
+func (s *S) TestSetMaintenancePageTooLarge(c *check.C) {
+	a := s.createRouterApp(c)
+	defer s.provisioner.Destroy(a)
+	err := a.SetMaintenance(strings.Repeat("a", maxMaintenancePageSize+1))
+	c.Assert(err, check.FitsTypeOf, &errors.ValidationError{})
+	_, ok := routertest.FakeRouter.MaintenancePage(a.Name)
+	c.Assert(ok, check.Equals, false)
+}
+
+func (s *S) TestSetMaintenanceMultipleRouters(c *check.C) {
+	a := s.createRouterApp(c)
+	defer s.provisioner.Destroy(a)
+	err := a.AddRouter(provision.AppRouter{Name: "fake-hc"})
+	c.Assert(err, check.IsNil)
+	err = a.SetMaintenance("<h1>brb</h1>")
+	c.Assert(err, check.IsNil)
+	_, ok := routertest.FakeRouter.MaintenancePage(a.Name)
+	c.Assert(ok, check.Equals, true)
+	_, ok = routertest.HCRouter.MaintenancePage(a.Name)
+	c.Assert(ok, check.Equals, true)
+}
+
+func (s *S) TestUnsetMaintenance(c *check.C) {
+	a := s.createRouterApp(c)
+	defer s.provisioner.Destroy(a)
+	err := a.SetMaintenance("<h1>brb</h1>")
+	c.Assert(err, check.IsNil)
+	err = a.UnsetMaintenance()
+	c.Assert(err, check.IsNil)
+	_, ok := routertest.FakeRouter.MaintenancePage(a.Name)
+	c.Assert(ok, check.Equals, false)
+	dbApp, err := GetByName(a.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(dbApp.Maintenance, check.IsNil)
+	err = a.UnsetMaintenance()
+	c.Assert(err, check.Equals, ErrNotInMaintenance)
+}
+
+func (s *S) TestRebuildRoutesRestoresMaintenance(c *check.C) {
+	a := s.createRouterApp(c)
+	defer s.provisioner.Destroy(a)
+	err := a.SetMaintenance("<h1>brb</h1>")
+	c.Assert(err, check.IsNil)
+	err = routertest.FakeRouter.UnsetMaintenance(a.Name)
+	c.Assert(err, check.IsNil)
+	_, err = a.RebuildRoutes()
+	c.Assert(err, check.IsNil)
+	page, ok := routertest.FakeRouter.MaintenancePage(a.Name)
+	c.Assert(ok, check.Equals, true)
+	c.Assert(page, check.Equals, "<h1>brb</h1>")
+}
+
+func (s *S) TestStartEndsMaintenance(c *check.C) {
+	a := s.createRouterApp(c)
+	defer s.provisioner.Destroy(a)
+	err := a.SetMaintenance("<h1>brb</h1>")
+	c.Assert(err, check.IsNil)
+	var b bytes.Buffer
+	err = a.Start(&b, "")
+	c.Assert(err, check.IsNil)
+	_, ok := routertest.FakeRouter.MaintenancePage(a.Name)
+	c.Assert(ok, check.Equals, false)
+	dbApp, err := GetByName(a.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(dbApp.Maintenance, check.IsNil)
+}
+
+func (s *S) TestDeployEndsMaintenance(c *check.C) {
+	a := s.createRouterApp(c)
+	defer s.provisioner.Destroy(a)
+	err := a.SetMaintenance("<h1>brb</h1>")
+	c.Assert(err, check.IsNil)
+	evt, err := event.New(&event.Opts{
+		Target:   event.Target{Type: "app", Value: a.Name},
+		Kind:     permission.PermAppDeploy,
+		RawOwner: event.Owner{Type: event.OwnerTypeUser, Name: s.user.Email},
+	})
+	c.Assert(err, check.IsNil)
+	_, err = Deploy(DeployOptions{
+		App:          a,
+		Image:        "myimage",
+		OutputStream: ioutil.Discard,
+		Event:        evt,
+	})
+	c.Assert(err, check.IsNil)
+	_, ok := routertest.FakeRouter.MaintenancePage(a.Name)
+	c.Assert(ok, check.Equals, false)
+	dbApp, err := GetByName(a.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(dbApp.Maintenance, check.IsNil)
+}
+
+func (s *S) TestDeployFailureKeepsMaintenance(c *check.C) {
+	a := s.createRouterApp(c)
+	defer s.provisioner.Destroy(a)
+	err := a.SetMaintenance("<h1>brb</h1>")
+	c.Assert(err, check.IsNil)
+	s.provisioner.PrepareFailure("ImageDeploy", stderr.New("deploy failed"))
+	evt, err := event.New(&event.Opts{
+		Target:   event.Target{Type: "app", Value: a.Name},
+		Kind:     permission.PermAppDeploy,
+		RawOwner: event.Owner{Type: event.OwnerTypeUser, Name: s.user.Email},
+	})
+	c.Assert(err, check.IsNil)
+	_, err = Deploy(DeployOptions{
+		App:          a,
+		Image:        "myimage",
+		OutputStream: ioutil.Discard,
+		Event:        evt,
+	})
+	c.Assert(err, check.NotNil)
+	_, ok := routertest.FakeRouter.MaintenancePage(a.Name)
+	c.Assert(ok, check.Equals, true)
+}
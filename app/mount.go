@@ -0,0 +1,224 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package app
+
+import (
+	stderr "errors"
+	"fmt"
+	"path"
+	"regexp"
+
+	"github.com/tsuru/tsuru/db"
+	"github.com/tsuru/tsuru/db/storage"
+	"github.com/tsuru/tsuru/errors"
+	"github.com/tsuru/tsuru/router"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+var (
+	ErrMountConflict           = stderr.New("the path is already mounted in the domain")
+	ErrMountNotFound           = stderr.New("mount not found in the app")
+	ErrPathRoutingNotSupported = stderr.New("the router of the app doesn't support path based routing")
+
+	mountDomainRegexp = regexp.MustCompile(`^[a-zA-Z0-9][\w-.]+$`)
+	mountPathRegexp   = regexp.MustCompile(`^(/[\w-.~]+)+$`)
+)
+
+// Mount is a path prefix of a shared domain in which the app is served.
+type Mount struct {
+	ID          string `bson:"_id" json:"-"`
+	App         string `json:"app"`
+	Domain      string `json:"domain"`
+	Path        string `json:"path"`
+	StripPrefix bool   `json:"strip"`
+}
+
+func (m *Mount) routerMount() router.Mount {
+	return router.Mount{Domain: m.Domain, Path: m.Path, StripPrefix: m.StripPrefix}
+}
+
+func mountsCollection() (*storage.Collection, error) {
+	conn, err := db.Conn()
+	if err != nil {
+		return nil, err
+	}
+	return conn.Collection("app_mounts"), nil
+}
+
+func (app *App) pathRouter() (router.PathRouter, error) {
+	routerName, err := app.GetRouter()
+	if err != nil {
+		return nil, err
+	}
+	r, err := router.Get(routerName)
+	if err != nil {
+		return nil, err
+	}
+	pathRouter, ok := r.(router.PathRouter)
+	if !ok {
+		return nil, ErrPathRoutingNotSupported
+	}
+	return pathRouter, nil
+}
+
+func validateMount(domain, mountPath string) error {
+	if !mountDomainRegexp.MatchString(domain) {
+		return &errors.ValidationError{Message: fmt.Sprintf("invalid domain: %q", domain)}
+	}
+	if path.Clean(mountPath) != mountPath || !mountPathRegexp.MatchString(mountPath) {
+		return &errors.ValidationError{Message: fmt.Sprintf("invalid path: %q, it must start with a slash and can't be the root path", mountPath)}
+	}
+	return nil
+}
+
+// AddMount serves the app at the given path of a domain shared with other
+// apps. A path can be mounted only once in a domain, and the domain can't be
+// the address or a cname of an app, nor a subdomain of the router.
+func (app *App) AddMount(domain, mountPath string, stripPrefix bool) error {
+	err := validateMount(domain, mountPath)
+	if err != nil {
+		return err
+	}
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	query := bson.M{"$or": []bson.M{{"cname": domain}, {"ip": domain}}}
+	count, err := conn.Apps().Find(query).Count()
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return &errors.ValidationError{Message: fmt.Sprintf("domain %s is an address or a cname of an app", domain)}
+	}
+	pathRouter, err := app.pathRouter()
+	if err != nil {
+		return err
+	}
+	mount := Mount{
+		ID:          domain + mountPath,
+		App:         app.Name,
+		Domain:      domain,
+		Path:        mountPath,
+		StripPrefix: stripPrefix,
+	}
+	coll, err := mountsCollection()
+	if err != nil {
+		return err
+	}
+	defer coll.Close()
+	err = coll.Insert(mount)
+	if mgo.IsDup(err) {
+		return ErrMountConflict
+	}
+	if err != nil {
+		return err
+	}
+	err = pathRouter.AddMount(app.Name, mount.routerMount())
+	if err != nil {
+		coll.RemoveId(mount.ID)
+		if err == router.ErrMountExists {
+			return ErrMountConflict
+		}
+		if err == router.ErrStripPrefixNotSupported || err == router.ErrMountDomainNotAllowed || err == router.ErrMountDomainInUse {
+			return &errors.ValidationError{Message: err.Error()}
+		}
+		return err
+	}
+	return nil
+}
+
+// RemoveMount removes the app from the given path of a domain.
+func (app *App) RemoveMount(domain, mountPath string) error {
+	coll, err := mountsCollection()
+	if err != nil {
+		return err
+	}
+	defer coll.Close()
+	var mount Mount
+	err = coll.Find(bson.M{"_id": domain + mountPath, "app": app.Name}).One(&mount)
+	if err == mgo.ErrNotFound {
+		return ErrMountNotFound
+	}
+	if err != nil {
+		return err
+	}
+	pathRouter, err := app.pathRouter()
+	if err != nil {
+		return err
+	}
+	err = pathRouter.RemoveMount(app.Name, mount.routerMount())
+	if err != nil && err != router.ErrMountNotFound {
+		return err
+	}
+	return coll.RemoveId(mount.ID)
+}
+
+// GetMounts returns the mounts of the app, sorted by domain and path.
+func (app *App) GetMounts() ([]Mount, error) {
+	coll, err := mountsCollection()
+	if err != nil {
+		return nil, err
+	}
+	defer coll.Close()
+	var mounts []Mount
+	err = coll.Find(bson.M{"app": app.Name}).Sort("_id").All(&mounts)
+	if err != nil {
+		return nil, err
+	}
+	return mounts, nil
+}
+
+// restoreMounts adds the stored mounts of the app to the router.
+func (app *App) restoreMounts(pathRouter router.PathRouter) error {
+	mounts, err := app.GetMounts()
+	if err != nil {
+		return err
+	}
+	for _, mount := range mounts {
+		err = pathRouter.AddMount(app.Name, mount.routerMount())
+		if err != nil && err != router.ErrMountExists {
+			return err
+		}
+	}
+	return nil
+}
+
+// removeMounts removes all the mounts of the app, from the router and from
+// the storage.
+func (app *App) removeMounts() error {
+	mounts, err := app.GetMounts()
+	if err != nil || len(mounts) == 0 {
+		return err
+	}
+	pathRouter, err := app.pathRouter()
+	if err == nil {
+		for _, mount := range mounts {
+			err = pathRouter.RemoveMount(app.Name, mount.routerMount())
+			if err != nil && err != router.ErrMountNotFound {
+				return err
+			}
+		}
+	}
+	coll, err := mountsCollection()
+	if err != nil {
+		return err
+	}
+	defer coll.Close()
+	_, err = coll.RemoveAll(bson.M{"app": app.Name})
+	return err
+}
+
+func isMountDomain(domain string) (bool, error) {
+	coll, err := mountsCollection()
+	if err != nil {
+		return false, err
+	}
+	defer coll.Close()
+	count, err := coll.Find(bson.M{"domain": domain}).Count()
+	return count > 0, err
+}
@@ -0,0 +1,164 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package app
+
+import (
+	"github.com/tsuru/tsuru/errors"
+	"github.com/tsuru/tsuru/router"
+	"github.com/tsuru/tsuru/router/routertest"
+	"gopkg.in/check.v1"
+)
+
+func (s *S) TestAddMount(c *check.C) {
+	a := s.createRouterApp(c)
+	defer s.provisioner.Destroy(a)
+	err := a.AddMount("api.example.com", "/billing", true)
+	c.Assert(err, check.IsNil)
+	c.Assert(routertest.FakeRouter.HasMount(a.Name, "api.example.com", "/billing"), check.Equals, true)
+	mounts, err := a.GetMounts()
+	c.Assert(err, check.IsNil)
+	c.Assert(mounts, check.DeepEquals, []Mount{
+		{ID: "api.example.com/billing", App: a.Name, Domain: "api.example.com", Path: "/billing", StripPrefix: true},
+	})
+}
+
+func (s *S) TestAddMountInvalid(c *check.C) {
+	a := s.createRouterApp(c)
+	defer s.provisioner.Destroy(a)
+	tests := []struct{ domain, path string }{
+		{"api.example.com", "/"},
+		{"api.example.com", ""},
+		{"api.example.com", "billing"},
+		{"api.example.com", "/billing/"},
+		{"api.example.com", "/billing/../admin"},
+		{"api.example.com", "/billing?x=1"},
+		{"", "/billing"},
+		{"api.example.com/x", "/billing"},
+	}
+	for _, tt := range tests {
+		err := a.AddMount(tt.domain, tt.path, false)
+		c.Check(err, check.FitsTypeOf, &errors.ValidationError{}, check.Commentf("%s%s", tt.domain, tt.path))
+	}
+	mounts, err := a.GetMounts()
+	c.Assert(err, check.IsNil)
+	c.Assert(mounts, check.HasLen, 0)
+}
+
+func (s *S) TestAddMountConflict(c *check.C) {
+	a := s.createRouterApp(c)
+	defer s.provisioner.Destroy(a)
+	other := &App{Name: "otherapp", Platform: "zend", Plan: Plan{Router: "fake"}}
+	err := s.conn.Apps().Insert(other)
+	c.Assert(err, check.IsNil)
+	err = s.provisioner.Provision(other)
+	c.Assert(err, check.IsNil)
+	defer s.provisioner.Destroy(other)
+	err = a.AddMount("api.example.com", "/billing", false)
+	c.Assert(err, check.IsNil)
+	err = other.AddMount("api.example.com", "/billing", false)
+	c.Assert(err, check.Equals, ErrMountConflict)
+	err = other.AddMount("api.example.com", "/billing/v2", false)
+	c.Assert(err, check.IsNil)
+	c.Assert(routertest.FakeRouter.HasMount(a.Name, "api.example.com", "/billing"), check.Equals, true)
+	c.Assert(routertest.FakeRouter.HasMount(other.Name, "api.example.com", "/billing/v2"), check.Equals, true)
+}
+
+func (s *S) TestAddMountCNameDomain(c *check.C) {
+	a := s.createRouterApp(c)
+	defer s.provisioner.Destroy(a)
+	err := a.AddMount("myapp.io", "/billing", false)
+	c.Assert(err, check.FitsTypeOf, &errors.ValidationError{})
+	c.Assert(routertest.FakeRouter.HasMount(a.Name, "myapp.io", "/billing"), check.Equals, false)
+}
+
+func (s *S) TestAddMountAppAddressDomain(c *check.C) {
+	a := s.createRouterApp(c)
+	defer s.provisioner.Destroy(a)
+	other := &App{Name: "otherapp", Platform: "zend", Ip: "otherapp.example.net", Plan: Plan{Router: "fake"}}
+	err := s.conn.Apps().Insert(other)
+	c.Assert(err, check.IsNil)
+	err = a.AddMount("otherapp.example.net", "/billing", false)
+	c.Assert(err, check.FitsTypeOf, &errors.ValidationError{})
+	c.Assert(routertest.FakeRouter.HasMount(a.Name, "otherapp.example.net", "/billing"), check.Equals, false)
+	mounts, err := a.GetMounts()
+	c.Assert(err, check.IsNil)
+	c.Assert(mounts, check.HasLen, 0)
+}
+
+func (s *S) TestAddMountRouterDomain(c *check.C) {
+	a := s.createRouterApp(c)
+	defer s.provisioner.Destroy(a)
+	for _, domain := range []string{"otherapp.fakerouter.com", "fakerouter.com"} {
+		err := a.AddMount(domain, "/billing", false)
+		c.Check(err, check.DeepEquals, &errors.ValidationError{Message: router.ErrMountDomainNotAllowed.Error()}, check.Commentf(domain))
+		c.Check(routertest.FakeRouter.HasMount(a.Name, domain, "/billing"), check.Equals, false)
+	}
+	mounts, err := a.GetMounts()
+	c.Assert(err, check.IsNil)
+	c.Assert(mounts, check.HasLen, 0)
+}
+
+func (s *S) TestAddCNameMountDomain(c *check.C) {
+	a := s.createRouterApp(c)
+	defer s.provisioner.Destroy(a)
+	err := a.AddMount("api.example.com", "/billing", false)
+	c.Assert(err, check.IsNil)
+	err = a.AddCName("api.example.com")
+	c.Assert(err, check.NotNil)
+	c.Assert(err.Error(), check.Equals, "cname is a domain with mounted apps")
+}
+
+func (s *S) TestRemoveMount(c *check.C) {
+	a := s.createRouterApp(c)
+	defer s.provisioner.Destroy(a)
+	err := a.AddMount("api.example.com", "/billing", false)
+	c.Assert(err, check.IsNil)
+	err = a.RemoveMount("api.example.com", "/billing")
+	c.Assert(err, check.IsNil)
+	c.Assert(routertest.FakeRouter.HasMount(a.Name, "api.example.com", "/billing"), check.Equals, false)
+	mounts, err := a.GetMounts()
+	c.Assert(err, check.IsNil)
+	c.Assert(mounts, check.HasLen, 0)
+	err = a.RemoveMount("api.example.com", "/billing")
+	c.Assert(err, check.Equals, ErrMountNotFound)
+}
+
+func (s *S) TestRemoveMountFromOtherApp(c *check.C) {
+	a := s.createRouterApp(c)
+	defer s.provisioner.Destroy(a)
+	err := a.AddMount("api.example.com", "/billing", false)
+	c.Assert(err, check.IsNil)
+	other := &App{Name: "otherapp", Platform: "zend", Plan: Plan{Router: "fake"}}
+	err = other.RemoveMount("api.example.com", "/billing")
+	c.Assert(err, check.Equals, ErrMountNotFound)
+	c.Assert(routertest.FakeRouter.HasMount(a.Name, "api.example.com", "/billing"), check.Equals, true)
+}
+
+func (s *S) TestRebuildRoutesRestoresMounts(c *check.C) {
+	a := s.createRouterApp(c)
+	defer s.provisioner.Destroy(a)
+	err := a.AddMount("api.example.com", "/billing", false)
+	c.Assert(err, check.IsNil)
+	err = routertest.FakeRouter.RemoveMount(a.Name, router.Mount{Domain: "api.example.com", Path: "/billing"})
+	c.Assert(err, check.IsNil)
+	_, err = a.RebuildRoutes()
+	c.Assert(err, check.IsNil)
+	c.Assert(routertest.FakeRouter.HasMount(a.Name, "api.example.com", "/billing"), check.Equals, true)
+}
+
+func (s *S) TestDeleteRemovesMounts(c *check.C) {
+	a := s.createRouterApp(c)
+	err := a.AddMount("api.example.com", "/billing", false)
+	c.Assert(err, check.IsNil)
+	err = Delete(a, nil)
+	c.Assert(err, check.IsNil)
+	c.Assert(routertest.FakeRouter.HasMount(a.Name, "api.example.com", "/billing"), check.Equals, false)
+	coll, err := mountsCollection()
+	c.Assert(err, check.IsNil)
+	defer coll.Close()
+	count, err := coll.Count()
+	c.Assert(err, check.IsNil)
+	c.Assert(count, check.Equals, 0)
+}
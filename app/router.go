@@ -0,0 +1,156 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package app
+
+import (
+	stderr "errors"
+
+	"github.com/tsuru/tsuru/db"
+	"github.com/tsuru/tsuru/errors"
+	"github.com/tsuru/tsuru/log"
+	"github.com/tsuru/tsuru/provision"
+	"github.com/tsuru/tsuru/router"
+	"gopkg.in/mgo.v2/bson"
+)
+
+var (
+	ErrRouterAlreadyAdded = stderr.New("router already added to the app")
+	ErrRouterNotFound     = stderr.New("router not found in the app")
+	ErrRemovePlanRouter   = stderr.New("the router of the plan can't be removed from the app, change the plan instead")
+	ErrAddRouterSwapped   = stderr.New("routers can't be added to a swapped app, swap it back first")
+)
+
+// GetRouters returns the routers of the app. The first one is always the
+// router of the plan, using the router opts of the app, followed by the
+// routers added to the app.
+func (app *App) GetRouters() ([]provision.AppRouter, error) {
+	planRouter, err := app.GetRouter()
+	if err != nil {
+		return nil, err
+	}
+	routers := []provision.AppRouter{{Name: planRouter, Opts: app.RouterOpts}}
+	for _, r := range app.Routers {
+		if r.Name != planRouter {
+			routers = append(routers, r)
+		}
+	}
+	return routers, nil
+}
+
+// GetRoutersWithAddr returns the routers of the app along with the address
+// of the app in each of them.
+func (app *App) GetRoutersWithAddr() ([]provision.AppRouter, error) {
+	routers, err := app.GetRouters()
+	if err != nil {
+		return nil, err
+	}
+	for i := range routers {
+		r, err := router.Get(routers[i].Name)
+		if err != nil {
+			return nil, err
+		}
+		routers[i].Address, err = r.Addr(app.Name)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return routers, nil
+}
+
+func (app *App) hasRouter(name string) bool {
+	for _, r := range app.Routers {
+		if r.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// AddRouter exposes the app in one more router, creating the backend of the
+// app in the router and adding routes to all the routable units of the app.
+func (app *App) AddRouter(appRouter provision.AppRouter) error {
+	r, err := router.Get(appRouter.Name)
+	if err != nil {
+		return &errors.ValidationError{Message: err.Error()}
+	}
+	routers, err := app.GetRouters()
+	if err != nil {
+		return err
+	}
+	for _, existing := range routers {
+		if existing.Name == appRouter.Name {
+			return ErrRouterAlreadyAdded
+		}
+	}
+	// The name of the backend of a swapped app is shared by all its routers,
+	// and there's no backend with that name in the new router.
+	backendName, err := router.Retrieve(app.Name)
+	if err != nil && err != router.ErrBackendNotFound {
+		return err
+	}
+	if err == nil && backendName != app.Name {
+		return ErrAddRouterSwapped
+	}
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	err = conn.Apps().Update(bson.M{"name": app.Name}, bson.M{"$push": bson.M{"routers": appRouter}})
+	if err != nil {
+		return err
+	}
+	app.Routers = append(app.Routers, appRouter)
+	_, err = app.rebuildRoutes(appRouter, false)
+	if err != nil {
+		log.Errorf("[add-router] unable to add router %q to app %q, rolling back: %s", appRouter.Name, app.Name, err)
+		if rmErr := r.RemoveBackend(app.Name); rmErr != nil && rmErr != router.ErrBackendNotFound {
+			log.Errorf("[add-router] unable to remove backend of app %q: %s", app.Name, rmErr)
+		}
+		app.Routers = app.Routers[:len(app.Routers)-1]
+		conn.Apps().Update(bson.M{"name": app.Name}, bson.M{"$pull": bson.M{"routers": bson.M{"name": appRouter.Name}}})
+		return err
+	}
+	return nil
+}
+
+// RemoveRouter removes the backend of the app from a router previously added
+// using AddRouter. The router of the plan can't be removed.
+func (app *App) RemoveRouter(name string) error {
+	planRouter, err := app.GetRouter()
+	if err != nil {
+		return err
+	}
+	if name == planRouter {
+		return ErrRemovePlanRouter
+	}
+	if !app.hasRouter(name) {
+		return ErrRouterNotFound
+	}
+	r, err := router.Get(name)
+	if err != nil {
+		return err
+	}
+	err = r.RemoveBackend(app.Name)
+	if err != nil && err != router.ErrBackendNotFound {
+		return err
+	}
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	err = conn.Apps().Update(bson.M{"name": app.Name}, bson.M{"$pull": bson.M{"routers": bson.M{"name": name}}})
+	if err != nil {
+		return err
+	}
+	for i, appRouter := range app.Routers {
+		if appRouter.Name == name {
+			app.Routers = append(app.Routers[:i], app.Routers[i+1:]...)
+			break
+		}
+	}
+	return nil
+}
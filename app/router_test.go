@@ -0,0 +1,184 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package app
+
+import (
+	"sort"
+
+	"github.com/tsuru/tsuru/errors"
+	"github.com/tsuru/tsuru/provision"
+	"github.com/tsuru/tsuru/router"
+	"github.com/tsuru/tsuru/router/routertest"
+	"gopkg.in/check.v1"
+	"gopkg.in/mgo.v2/bson"
+)
+
+func (s *S) createRouterApp(c *check.C) *App {
+	a := &App{
+		Name:       "myapp",
+		Platform:   "zend",
+		CName:      []string{"myapp.io"},
+		Plan:       Plan{Router: "fake"},
+		RouterOpts: map[string]string{"opt1": "val1"},
+	}
+	err := s.conn.Apps().Insert(a)
+	c.Assert(err, check.IsNil)
+	err = s.provisioner.Provision(a)
+	c.Assert(err, check.IsNil)
+	_, err = s.provisioner.AddUnits(a, 2, "web", nil)
+	c.Assert(err, check.IsNil)
+	return a
+}
+
+func (s *S) TestGetRouters(c *check.C) {
+	a := App{
+		Name:       "myapp",
+		Plan:       Plan{Router: "fake"},
+		RouterOpts: map[string]string{"opt1": "val1"},
+		Routers:    []provision.AppRouter{{Name: "fake-hc", Opts: map[string]string{"opt2": "val2"}}},
+	}
+	routers, err := a.GetRouters()
+	c.Assert(err, check.IsNil)
+	c.Assert(routers, check.DeepEquals, []provision.AppRouter{
+		{Name: "fake", Opts: map[string]string{"opt1": "val1"}},
+		{Name: "fake-hc", Opts: map[string]string{"opt2": "val2"}},
+	})
+}
+
+func (s *S) TestGetRoutersIgnoresPlanRouter(c *check.C) {
+	a := App{
+		Name:    "myapp",
+		Plan:    Plan{Router: "fake-hc"},
+		Routers: []provision.AppRouter{{Name: "fake-hc"}},
+	}
+	routers, err := a.GetRouters()
+	c.Assert(err, check.IsNil)
+	c.Assert(routers, check.DeepEquals, []provision.AppRouter{{Name: "fake-hc"}})
+}
+
+func (s *S) TestAddRouter(c *check.C) {
+	a := s.createRouterApp(c)
+	defer s.provisioner.Destroy(a)
+	err := a.AddRouter(provision.AppRouter{Name: "fake-hc", Opts: map[string]string{"opt2": "val2"}})
+	c.Assert(err, check.IsNil)
+	c.Assert(routertest.HCRouter.HasBackend(a.Name), check.Equals, true)
+	c.Assert(routertest.HCRouter.HasCName("myapp.io"), check.Equals, true)
+	units, err := a.Units()
+	c.Assert(err, check.IsNil)
+	c.Assert(units, check.HasLen, 2)
+	routes, err := routertest.HCRouter.Routes(a.Name)
+	c.Assert(err, check.IsNil)
+	var expected, obtained []string
+	for i := range units {
+		expected = append(expected, units[i].Address.String())
+		obtained = append(obtained, routes[i].String())
+	}
+	sort.Strings(expected)
+	sort.Strings(obtained)
+	c.Assert(obtained, check.DeepEquals, expected)
+	dbApp, err := GetByName(a.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(dbApp.Routers, check.DeepEquals, []provision.AppRouter{{Name: "fake-hc", Opts: map[string]string{"opt2": "val2"}}})
+}
+
+func (s *S) TestAddRouterAlreadyAdded(c *check.C) {
+	a := s.createRouterApp(c)
+	defer s.provisioner.Destroy(a)
+	err := a.AddRouter(provision.AppRouter{Name: "fake"})
+	c.Assert(err, check.Equals, ErrRouterAlreadyAdded)
+	err = a.AddRouter(provision.AppRouter{Name: "fake-hc"})
+	c.Assert(err, check.IsNil)
+	err = a.AddRouter(provision.AppRouter{Name: "fake-hc"})
+	c.Assert(err, check.Equals, ErrRouterAlreadyAdded)
+}
+
+func (s *S) TestAddRouterSwappedApp(c *check.C) {
+	a := s.createRouterApp(c)
+	defer s.provisioner.Destroy(a)
+	err := s.conn.Collection("routers").Update(bson.M{"app": a.Name}, bson.M{"$set": bson.M{"router": "otherapp"}})
+	c.Assert(err, check.IsNil)
+	err = a.AddRouter(provision.AppRouter{Name: "fake-hc"})
+	c.Assert(err, check.Equals, ErrAddRouterSwapped)
+	c.Assert(routertest.HCRouter.HasBackend(a.Name), check.Equals, false)
+	dbApp, err := GetByName(a.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(dbApp.Routers, check.HasLen, 0)
+}
+
+func (s *S) TestAddRouterInvalidRouter(c *check.C) {
+	a := s.createRouterApp(c)
+	defer s.provisioner.Destroy(a)
+	err := a.AddRouter(provision.AppRouter{Name: "unknown"})
+	c.Assert(err, check.FitsTypeOf, &errors.ValidationError{})
+	dbApp, err := GetByName(a.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(dbApp.Routers, check.HasLen, 0)
+}
+
+func (s *S) TestRemoveRouter(c *check.C) {
+	a := s.createRouterApp(c)
+	defer s.provisioner.Destroy(a)
+	err := a.AddRouter(provision.AppRouter{Name: "fake-hc"})
+	c.Assert(err, check.IsNil)
+	err = a.RemoveRouter("fake-hc")
+	c.Assert(err, check.IsNil)
+	c.Assert(routertest.HCRouter.HasBackend(a.Name), check.Equals, false)
+	c.Assert(routertest.FakeRouter.HasBackend(a.Name), check.Equals, true)
+	c.Assert(a.Routers, check.HasLen, 0)
+	backendName, err := router.Retrieve(a.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(backendName, check.Equals, a.Name)
+	n, err := s.conn.Collection("routers").Find(bson.M{"app": a.Name}).Count()
+	c.Assert(err, check.IsNil)
+	c.Assert(n, check.Equals, 1)
+	dbApp, err := GetByName(a.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(dbApp.Routers, check.HasLen, 0)
+}
+
+func (s *S) TestRemoveRouterPlanRouter(c *check.C) {
+	a := s.createRouterApp(c)
+	defer s.provisioner.Destroy(a)
+	err := a.RemoveRouter("fake")
+	c.Assert(err, check.Equals, ErrRemovePlanRouter)
+	c.Assert(routertest.FakeRouter.HasBackend(a.Name), check.Equals, true)
+}
+
+func (s *S) TestRemoveRouterNotFound(c *check.C) {
+	a := s.createRouterApp(c)
+	defer s.provisioner.Destroy(a)
+	err := a.RemoveRouter("fake-hc")
+	c.Assert(err, check.Equals, ErrRouterNotFound)
+}
+
+func (s *S) TestRebuildRoutesMultipleRouters(c *check.C) {
+	a := s.createRouterApp(c)
+	defer s.provisioner.Destroy(a)
+	err := a.AddRouter(provision.AppRouter{Name: "fake-hc"})
+	c.Assert(err, check.IsNil)
+	routertest.FakeRouter.RemoveBackend(a.Name)
+	routertest.HCRouter.RemoveBackend(a.Name)
+	result, err := a.RebuildRoutes()
+	c.Assert(err, check.IsNil)
+	c.Assert(result.Added, check.HasLen, 4)
+	c.Assert(routertest.FakeRouter.HasBackend(a.Name), check.Equals, true)
+	c.Assert(routertest.HCRouter.HasBackend(a.Name), check.Equals, true)
+	routes, err := routertest.HCRouter.Routes(a.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(routes, check.HasLen, 2)
+}
+
+func (s *S) TestGetRoutersWithAddr(c *check.C) {
+	a := s.createRouterApp(c)
+	defer s.provisioner.Destroy(a)
+	err := a.AddRouter(provision.AppRouter{Name: "fake-hc"})
+	c.Assert(err, check.IsNil)
+	routers, err := a.GetRoutersWithAddr()
+	c.Assert(err, check.IsNil)
+	c.Assert(routers, check.DeepEquals, []provision.AppRouter{
+		{Name: "fake", Opts: map[string]string{"opt1": "val1"}, Address: "myapp.fakerouter.com"},
+		{Name: "fake-hc", Address: "myapp.fakerouter.com"},
+	})
+}
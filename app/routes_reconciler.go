@@ -0,0 +1,323 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package app
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/tsuru/config"
+	"github.com/tsuru/tsuru/db"
+	"github.com/tsuru/tsuru/db/storage"
+	"github.com/tsuru/tsuru/event"
+	"github.com/tsuru/tsuru/log"
+	"github.com/tsuru/tsuru/provision"
+	"github.com/tsuru/tsuru/router"
+	"gopkg.in/mgo.v2/bson"
+)
+
+const (
+	routesDriftEventKind = "routes-drift"
+
+	defaultRoutesReconcileInterval = 5 * time.Minute
+)
+
+// RoutesDrift describes the differences between the routes expected for an
+// app in one of its routers and what's actually registered in the router.
+type RoutesDrift struct {
+	App            string
+	Router         string
+	MissingBackend bool
+	MissingRoutes  []string
+	ExtraRoutes    []string
+	MissingCNames  []string
+	ExtraCNames    []string
+	Fixed          bool
+	CheckedAt      time.Time
+}
+
+// InSync returns whether the router matches the expected state of the app.
+func (d *RoutesDrift) InSync() bool {
+	return !d.MissingBackend && len(d.MissingRoutes) == 0 && len(d.ExtraRoutes) == 0 &&
+		len(d.MissingCNames) == 0 && len(d.ExtraCNames) == 0
+}
+
+func (d *RoutesDrift) String() string {
+	if d.MissingBackend {
+		return fmt.Sprintf("app %s not found in router %s", d.App, d.Router)
+	}
+	return fmt.Sprintf("router %s of app %s: missing routes %v, extra routes %v, missing cnames %v, extra cnames %v",
+		d.Router, d.App, d.MissingRoutes, d.ExtraRoutes, d.MissingCNames, d.ExtraCNames)
+}
+
+// RoutesDriftSummary holds the drifts found in the last check of each app by
+// the routes reconciler.
+type RoutesDriftSummary struct {
+	OutOfSync     []string
+	MissingRoutes int
+	ExtraRoutes   int
+	Drifts        []RoutesDrift
+}
+
+func routesDriftCollection() (*storage.Collection, error) {
+	conn, err := db.Conn()
+	if err != nil {
+		return nil, err
+	}
+	return conn.Collection("routes_drift"), nil
+}
+
+// storeRoutesDrift replaces the drifts recorded for an app with the ones found
+// in its last check.
+func storeRoutesDrift(appName string, drifts []RoutesDrift) error {
+	coll, err := routesDriftCollection()
+	if err != nil {
+		return err
+	}
+	defer coll.Close()
+	_, err = coll.RemoveAll(bson.M{"app": appName})
+	if err != nil {
+		return err
+	}
+	for _, drift := range drifts {
+		err = coll.Insert(drift)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func removeRoutesDrift(appName string) error {
+	return storeRoutesDrift(appName, nil)
+}
+
+// RoutesDrift compares the routable units and cnames of the app with the
+// routes and cnames registered in each of its routers, returning the routers
+// that are out of sync. Apps with asleep units are always in sync, as their
+// routes point to the proxy that wakes them up instead of the units.
+func (app *App) RoutesDrift() ([]RoutesDrift, error) {
+	appRouters, err := app.GetRouters()
+	if err != nil {
+		return nil, err
+	}
+	units, err := Provisioner.RoutableUnits(app)
+	if err != nil {
+		return nil, err
+	}
+	expectedRoutes := make(map[string]bool, len(units))
+	for _, unit := range units {
+		if unit.Status == provision.StatusAsleep {
+			return nil, nil
+		}
+		expectedRoutes[unit.Address.Host] = true
+	}
+	expectedCNames := make(map[string]bool, len(app.CName))
+	for _, cname := range app.CName {
+		expectedCNames[cname] = true
+	}
+	var drifts []RoutesDrift
+	for _, appRouter := range appRouters {
+		r, err := router.Get(appRouter.Name)
+		if err != nil {
+			return nil, err
+		}
+		drift := RoutesDrift{App: app.Name, Router: appRouter.Name, CheckedAt: time.Now().UTC()}
+		routes, err := r.Routes(app.Name)
+		if err == router.ErrBackendNotFound {
+			drift.MissingBackend = true
+			err = nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		hosts := make([]string, len(routes))
+		for i, route := range routes {
+			hosts[i] = route.Host
+		}
+		drift.MissingRoutes, drift.ExtraRoutes = diffHosts(expectedRoutes, hosts)
+		if cnameRouter, ok := r.(router.CNameRouter); ok && !drift.MissingBackend {
+			cnames, err := cnameRouter.CNames(app.Name)
+			if err != nil {
+				return nil, err
+			}
+			hosts = make([]string, len(cnames))
+			for i, cname := range cnames {
+				hosts[i] = cname.Host
+			}
+			drift.MissingCNames, drift.ExtraCNames = diffHosts(expectedCNames, hosts)
+		}
+		if !drift.InSync() {
+			drifts = append(drifts, drift)
+		}
+	}
+	return drifts, nil
+}
+
+// diffHosts returns the expected hosts not found and the hosts found but not
+// expected, both sorted.
+func diffHosts(expected map[string]bool, found []string) (missing []string, extra []string) {
+	foundMap := make(map[string]bool, len(found))
+	for _, host := range found {
+		foundMap[host] = true
+		if !expected[host] {
+			extra = append(extra, host)
+		}
+	}
+	for host := range expected {
+		if !foundMap[host] {
+			missing = append(missing, host)
+		}
+	}
+	sort.Strings(missing)
+	sort.Strings(extra)
+	return missing, extra
+}
+
+// GetRoutesDriftSummary returns the drifts found in the last check of each
+// app by the routes reconciler.
+func GetRoutesDriftSummary() (*RoutesDriftSummary, error) {
+	coll, err := routesDriftCollection()
+	if err != nil {
+		return nil, err
+	}
+	defer coll.Close()
+	summary := RoutesDriftSummary{OutOfSync: []string{}, Drifts: []RoutesDrift{}}
+	err = coll.Find(nil).Sort("app", "router").All(&summary.Drifts)
+	if err != nil {
+		return nil, err
+	}
+	outOfSync := make(map[string]bool)
+	for _, drift := range summary.Drifts {
+		if drift.Fixed {
+			continue
+		}
+		if !outOfSync[drift.App] {
+			outOfSync[drift.App] = true
+			summary.OutOfSync = append(summary.OutOfSync, drift.App)
+		}
+		summary.MissingRoutes += len(drift.MissingRoutes)
+		summary.ExtraRoutes += len(drift.ExtraRoutes)
+	}
+	return &summary, nil
+}
+
+// RoutesReconciler periodically compares the routes of all the apps with
+// what's registered in their routers, recording the drifts as events and
+// optionally rebuilding the routes of the apps out of sync.
+type RoutesReconciler struct {
+	Interval time.Duration
+	AutoFix  bool
+	done     chan bool
+}
+
+// NewRoutesReconciler creates a reconciler using the interval, in seconds,
+// defined in the "routes-reconciler:interval" config key. Routes are only
+// rebuilt when "routes-reconciler:auto-fix" is true.
+func NewRoutesReconciler() *RoutesReconciler {
+	interval := defaultRoutesReconcileInterval
+	if value, err := config.GetInt("routes-reconciler:interval"); err == nil && value > 0 {
+		interval = time.Duration(value) * time.Second
+	}
+	autoFix, _ := config.GetBool("routes-reconciler:auto-fix")
+	return &RoutesReconciler{
+		Interval: interval,
+		AutoFix:  autoFix,
+		done:     make(chan bool),
+	}
+}
+
+func (r *RoutesReconciler) Start() {
+	go func() {
+		for {
+			err := r.runOnce()
+			if err != nil {
+				log.Errorf("[routes reconciler] %s", err)
+			}
+			select {
+			case <-r.done:
+				return
+			case <-time.After(r.Interval):
+			}
+		}
+	}()
+}
+
+func (r *RoutesReconciler) Shutdown() {
+	r.done <- true
+}
+
+func (r *RoutesReconciler) String() string {
+	return "routes reconciler"
+}
+
+func (r *RoutesReconciler) runOnce() error {
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	var apps []App
+	err = conn.Apps().Find(nil).All(&apps)
+	conn.Close()
+	if err != nil {
+		return err
+	}
+	for i := range apps {
+		err = r.reconcile(&apps[i])
+		if err != nil {
+			log.Errorf("[routes reconciler] unable to reconcile routes of app %s: %s", apps[i].Name, err)
+		}
+	}
+	return nil
+}
+
+// reconcile checks the routes of a single app, replacing the drifts recorded
+// for it. Apps locked by other operations, like deploys, are skipped and keep
+// the drifts of their last check, as their routes are expected to be
+// changing. As the reconciler runs in every API instance, the drifts are
+// stored while the app is locked.
+func (r *RoutesReconciler) reconcile(a *App) error {
+	locked, err := AcquireApplicationLock(a.Name, InternalAppName, "routes-reconciler")
+	if err != nil {
+		return err
+	}
+	if !locked {
+		return nil
+	}
+	defer ReleaseApplicationLock(a.Name)
+	drifts, err := a.RoutesDrift()
+	if err != nil {
+		return err
+	}
+	if len(drifts) == 0 {
+		return storeRoutesDrift(a.Name, nil)
+	}
+	evt, err := event.NewInternal(&event.Opts{
+		Target:       event.Target{Type: event.TargetTypeApp, Value: a.Name},
+		InternalKind: routesDriftEventKind,
+		CustomData:   drifts,
+		DisableLock:  true,
+	})
+	if err != nil {
+		return err
+	}
+	for _, drift := range drifts {
+		evt.Logf("%s", drift.String())
+	}
+	if r.AutoFix {
+		_, err = a.RebuildRoutes()
+		if err == nil {
+			for i := range drifts {
+				drifts[i].Fixed = true
+			}
+			evt.Logf("routes of app %s rebuilt", a.Name)
+		}
+	}
+	if doneErr := evt.Done(err); doneErr != nil {
+		log.Errorf("[routes reconciler] unable to finish event for app %s: %s", a.Name, doneErr)
+	}
+	return storeRoutesDrift(a.Name, drifts)
+}
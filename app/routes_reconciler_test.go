@@ -0,0 +1,204 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package app
+
+import (
+	"io/ioutil"
+	"net/url"
+
+	"github.com/tsuru/config"
+	"github.com/tsuru/tsuru/event"
+	"github.com/tsuru/tsuru/router/routertest"
+	"gopkg.in/check.v1"
+)
+
+func (s *S) createSyncedApp(c *check.C) *App {
+	a := s.createRouterApp(c)
+	_, err := a.RebuildRoutes()
+	c.Assert(err, check.IsNil)
+	return a
+}
+
+func (s *S) TestRoutesDriftInSync(c *check.C) {
+	a := s.createSyncedApp(c)
+	defer s.provisioner.Destroy(a)
+	drifts, err := a.RoutesDrift()
+	c.Assert(err, check.IsNil)
+	c.Assert(drifts, check.HasLen, 0)
+}
+
+func (s *S) TestRoutesDrift(c *check.C) {
+	a := s.createSyncedApp(c)
+	defer s.provisioner.Destroy(a)
+	units, err := a.Units()
+	c.Assert(err, check.IsNil)
+	err = routertest.FakeRouter.RemoveRoute(a.Name, units[0].Address)
+	c.Assert(err, check.IsNil)
+	extra, _ := url.Parse("http://10.0.0.99:8080")
+	err = routertest.FakeRouter.AddRoute(a.Name, extra)
+	c.Assert(err, check.IsNil)
+	err = routertest.FakeRouter.UnsetCName("myapp.io", a.Name)
+	c.Assert(err, check.IsNil)
+	err = routertest.FakeRouter.SetCName("other.io", a.Name)
+	c.Assert(err, check.IsNil)
+	drifts, err := a.RoutesDrift()
+	c.Assert(err, check.IsNil)
+	c.Assert(drifts, check.HasLen, 1)
+	c.Assert(drifts[0].App, check.Equals, a.Name)
+	c.Assert(drifts[0].Router, check.Equals, "fake")
+	c.Assert(drifts[0].MissingBackend, check.Equals, false)
+	c.Assert(drifts[0].MissingRoutes, check.DeepEquals, []string{units[0].Address.Host})
+	c.Assert(drifts[0].ExtraRoutes, check.DeepEquals, []string{"10.0.0.99:8080"})
+	c.Assert(drifts[0].MissingCNames, check.DeepEquals, []string{"myapp.io"})
+	c.Assert(drifts[0].ExtraCNames, check.DeepEquals, []string{"other.io"})
+}
+
+func (s *S) TestRoutesDriftMissingBackend(c *check.C) {
+	a := s.createSyncedApp(c)
+	defer s.provisioner.Destroy(a)
+	err := routertest.FakeRouter.RemoveBackend(a.Name)
+	c.Assert(err, check.IsNil)
+	drifts, err := a.RoutesDrift()
+	c.Assert(err, check.IsNil)
+	c.Assert(drifts, check.HasLen, 1)
+	c.Assert(drifts[0].MissingBackend, check.Equals, true)
+	c.Assert(drifts[0].MissingRoutes, check.HasLen, 2)
+}
+
+func (s *S) TestRoutesDriftSleepingApp(c *check.C) {
+	a := s.createSyncedApp(c)
+	defer s.provisioner.Destroy(a)
+	proxyURL, _ := url.Parse("http://sleep-proxy.example.com")
+	err := a.Sleep(ioutil.Discard, "", proxyURL)
+	c.Assert(err, check.IsNil)
+	drifts, err := a.RoutesDrift()
+	c.Assert(err, check.IsNil)
+	c.Assert(drifts, check.HasLen, 0)
+	r := &RoutesReconciler{AutoFix: true}
+	err = r.runOnce()
+	c.Assert(err, check.IsNil)
+	routes, err := routertest.FakeRouter.Routes(a.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(routes, check.HasLen, 1)
+	c.Assert(routertest.FakeRouter.HasRoute(a.Name, proxyURL.String()), check.Equals, true)
+	evts, err := event.List(&event.Filter{KindName: routesDriftEventKind})
+	c.Assert(err, check.IsNil)
+	c.Assert(evts, check.HasLen, 0)
+}
+
+func (s *S) TestNewRoutesReconciler(c *check.C) {
+	r := NewRoutesReconciler()
+	c.Assert(r.Interval, check.Equals, defaultRoutesReconcileInterval)
+	c.Assert(r.AutoFix, check.Equals, false)
+	config.Set("routes-reconciler:interval", 60)
+	config.Set("routes-reconciler:auto-fix", true)
+	defer config.Unset("routes-reconciler")
+	r = NewRoutesReconciler()
+	c.Assert(r.Interval.Seconds(), check.Equals, float64(60))
+	c.Assert(r.AutoFix, check.Equals, true)
+}
+
+func (s *S) TestRoutesReconcilerRecordsDrift(c *check.C) {
+	a := s.createSyncedApp(c)
+	defer s.provisioner.Destroy(a)
+	extra, _ := url.Parse("http://10.0.0.99:8080")
+	err := routertest.FakeRouter.AddRoute(a.Name, extra)
+	c.Assert(err, check.IsNil)
+	r := &RoutesReconciler{}
+	err = r.runOnce()
+	c.Assert(err, check.IsNil)
+	c.Assert(routertest.FakeRouter.HasRoute(a.Name, extra.String()), check.Equals, true)
+	evts, err := event.List(&event.Filter{KindName: routesDriftEventKind})
+	c.Assert(err, check.IsNil)
+	c.Assert(evts, check.HasLen, 1)
+	c.Assert(evts[0].Target, check.Equals, event.Target{Type: event.TargetTypeApp, Value: a.Name})
+	var drifts []RoutesDrift
+	err = evts[0].StartData(&drifts)
+	c.Assert(err, check.IsNil)
+	c.Assert(drifts, check.HasLen, 1)
+	c.Assert(drifts[0].ExtraRoutes, check.DeepEquals, []string{"10.0.0.99:8080"})
+	summary, err := GetRoutesDriftSummary()
+	c.Assert(err, check.IsNil)
+	c.Assert(summary.OutOfSync, check.DeepEquals, []string{a.Name})
+	c.Assert(summary.ExtraRoutes, check.Equals, 1)
+	c.Assert(summary.MissingRoutes, check.Equals, 0)
+	c.Assert(summary.Drifts, check.HasLen, 1)
+	c.Assert(summary.Drifts[0].Fixed, check.Equals, false)
+	dbApp, err := GetByName(a.Name)
+	c.Assert(err, check.IsNil)
+	c.Assert(dbApp.Lock.Locked, check.Equals, false)
+}
+
+func (s *S) TestRoutesReconcilerAutoFix(c *check.C) {
+	a := s.createSyncedApp(c)
+	defer s.provisioner.Destroy(a)
+	extra, _ := url.Parse("http://10.0.0.99:8080")
+	err := routertest.FakeRouter.AddRoute(a.Name, extra)
+	c.Assert(err, check.IsNil)
+	r := &RoutesReconciler{AutoFix: true}
+	err = r.runOnce()
+	c.Assert(err, check.IsNil)
+	c.Assert(routertest.FakeRouter.HasRoute(a.Name, extra.String()), check.Equals, false)
+	summary, err := GetRoutesDriftSummary()
+	c.Assert(err, check.IsNil)
+	c.Assert(summary.OutOfSync, check.HasLen, 0)
+	c.Assert(summary.Drifts, check.HasLen, 1)
+	c.Assert(summary.Drifts[0].Fixed, check.Equals, true)
+	err = r.runOnce()
+	c.Assert(err, check.IsNil)
+	summary, err = GetRoutesDriftSummary()
+	c.Assert(err, check.IsNil)
+	c.Assert(summary.Drifts, check.HasLen, 0)
+}
+
+func (s *S) TestRoutesReconcilerSkipsLockedApps(c *check.C) {
+	a := s.createSyncedApp(c)
+	defer s.provisioner.Destroy(a)
+	extra, _ := url.Parse("http://10.0.0.99:8080")
+	err := routertest.FakeRouter.AddRoute(a.Name, extra)
+	c.Assert(err, check.IsNil)
+	r := &RoutesReconciler{}
+	err = r.runOnce()
+	c.Assert(err, check.IsNil)
+	locked, err := AcquireApplicationLock(a.Name, "someone", "deploy")
+	c.Assert(err, check.IsNil)
+	c.Assert(locked, check.Equals, true)
+	defer ReleaseApplicationLock(a.Name)
+	r.AutoFix = true
+	err = r.runOnce()
+	c.Assert(err, check.IsNil)
+	c.Assert(routertest.FakeRouter.HasRoute(a.Name, extra.String()), check.Equals, true)
+	summary, err := GetRoutesDriftSummary()
+	c.Assert(err, check.IsNil)
+	c.Assert(summary.OutOfSync, check.DeepEquals, []string{a.Name})
+	c.Assert(summary.Drifts, check.HasLen, 1)
+	c.Assert(summary.Drifts[0].Fixed, check.Equals, false)
+}
+
+func (s *S) TestRoutesReconcilerKeepsDriftsOfOtherApps(c *check.C) {
+	a := s.createSyncedApp(c)
+	defer s.provisioner.Destroy(a)
+	err := storeRoutesDrift("otherapp", []RoutesDrift{
+		{App: "otherapp", Router: "fake", ExtraRoutes: []string{"10.0.0.98:8080"}},
+	})
+	c.Assert(err, check.IsNil)
+	extra, _ := url.Parse("http://10.0.0.99:8080")
+	err = routertest.FakeRouter.AddRoute(a.Name, extra)
+	c.Assert(err, check.IsNil)
+	r := &RoutesReconciler{}
+	err = r.runOnce()
+	c.Assert(err, check.IsNil)
+	summary, err := GetRoutesDriftSummary()
+	c.Assert(err, check.IsNil)
+	c.Assert(summary.OutOfSync, check.DeepEquals, []string{a.Name, "otherapp"})
+	c.Assert(summary.ExtraRoutes, check.Equals, 2)
+	err = routertest.FakeRouter.RemoveRoute(a.Name, extra)
+	c.Assert(err, check.IsNil)
+	err = r.runOnce()
+	c.Assert(err, check.IsNil)
+	summary, err = GetRoutesDriftSummary()
+	c.Assert(err, check.IsNil)
+	c.Assert(summary.OutOfSync, check.DeepEquals, []string{"otherapp"})
+}
@@ -63,6 +63,8 @@ var (
 	TargetTypeRole            = TargetType("role")
 	TargetTypePlatform        = TargetType("platform")
 	TargetTypePlan            = TargetType("plan")
+	TargetTypeNodeContainer   = TargetType("node-container")
+	TargetTypeCName           = TargetType("cname")
 )
 
 type ErrThrottled struct {
@@ -132,6 +134,7 @@ type eventData struct {
 	StartTime       time.Time
 	EndTime         time.Time `bson:",omitempty"`
 	Target          Target    `bson:",omitempty"`
+	ExtraTargets    []Target  `bson:",omitempty"`
 	StartCustomData bson.Raw  `bson:",omitempty"`
 	EndCustomData   bson.Raw  `bson:",omitempty"`
 	OtherCustomData bson.Raw  `bson:",omitempty"`
@@ -179,6 +182,10 @@ func GetTargetType(t string) (TargetType, error) {
 		return TargetTypeTeam, nil
 	case "user":
 		return TargetTypeUser, nil
+	case "node-container":
+		return TargetTypeNodeContainer, nil
+	case "cname":
+		return TargetTypeCName, nil
 	}
 	return TargetType(""), ErrInvalidTargetType
 }
@@ -234,7 +241,10 @@ type Event struct {
 }
 
 type Opts struct {
-	Target       Target
+	Target Target
+	// ExtraTargets are other targets related to the event, the event is
+	// listed when filtering by any of them but only Target is locked.
+	ExtraTargets []Target
 	Kind         *permission.PermissionScheme
 	InternalKind string
 	Owner        auth.Token
@@ -287,25 +297,38 @@ func (f *Filter) PruneUserValues() {
 
 func (f *Filter) toQuery() (bson.M, error) {
 	query := bson.M{}
+	var andBlock []bson.M
 	if f.AllowedTargets != nil {
 		var orBlock []bson.M
 		for _, at := range f.AllowedTargets {
 			f := bson.M{"target.type": at.Type}
+			extra := bson.M{"type": at.Type}
 			if at.Values != nil {
 				f["target.value"] = bson.M{"$in": at.Values}
+				extra["value"] = bson.M{"$in": at.Values}
 			}
-			orBlock = append(orBlock, f)
+			orBlock = append(orBlock, f, bson.M{"extratargets": bson.M{"$elemMatch": extra}})
 		}
 		if len(orBlock) == 0 {
 			return nil, errInvalidQuery
 		}
-		query["$or"] = orBlock
-	}
-	if f.Target.Type != "" {
-		query["target.type"] = f.Target.Type
-	}
-	if f.Target.Value != "" {
-		query["target.value"] = f.Target.Value
+		andBlock = append(andBlock, bson.M{"$or": orBlock})
+	}
+	if f.Target.Type != "" || f.Target.Value != "" {
+		target := bson.M{}
+		extra := bson.M{}
+		if f.Target.Type != "" {
+			target["target.type"] = f.Target.Type
+			extra["type"] = f.Target.Type
+		}
+		if f.Target.Value != "" {
+			target["target.value"] = f.Target.Value
+			extra["value"] = f.Target.Value
+		}
+		andBlock = append(andBlock, bson.M{"$or": []bson.M{
+			target,
+			{"extratargets": bson.M{"$elemMatch": extra}},
+		}})
 	}
 	if f.KindType != "" {
 		query["kind.type"] = f.KindType
@@ -326,8 +349,9 @@ func (f *Filter) toQuery() (bson.M, error) {
 	if !f.Until.IsZero() {
 		timeParts = append(timeParts, bson.M{"starttime": bson.M{"$lte": f.Until}})
 	}
-	if len(timeParts) != 0 {
-		query["$and"] = timeParts
+	andBlock = append(andBlock, timeParts...)
+	if len(andBlock) != 0 {
+		query["$and"] = andBlock
 	}
 	if f.Running != nil {
 		query["running"] = *f.Running
@@ -598,6 +622,7 @@ func newEvt(opts *Opts) (*Event, error) {
 		ID:              id,
 		UniqueID:        uniqID,
 		Target:          opts.Target,
+		ExtraTargets:    opts.ExtraTargets,
 		StartTime:       now,
 		Kind:            k,
 		Owner:           o,
@@ -656,6 +681,20 @@ func (e *Event) SetOtherCustomData(data interface{}) error {
 	})
 }
 
+// SetOtherCustomDataField sets a single field in the other custom data of
+// the event, keeping the remaining fields untouched.
+func (e *Event) SetOtherCustomDataField(name string, value interface{}) error {
+	conn, err := db.Conn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	coll := conn.Events()
+	return coll.UpdateId(e.ID, bson.M{
+		"$set": bson.M{"othercustomdata." + name: value},
+	})
+}
+
 func (e *Event) Logf(format string, params ...interface{}) {
 	log.Debugf(fmt.Sprintf("%s(%s)[%s] %s", e.Target.Type, e.Target.Value, e.Kind, format), params...)
 	format += "\n"
@@ -563,6 +563,28 @@ func (s *S) TestEventOtherCustomData(c *check.C) {
 	c.Assert(data, check.DeepEquals, map[string]string{"z": "h"})
 }
 
+func (s *S) TestEventSetOtherCustomDataField(c *check.C) {
+	evt, err := New(&Opts{
+		Target: Target{Type: "app", Value: "myapp"},
+		Kind:   permission.PermAppUpdateEnvSet,
+		Owner:  s.token,
+	})
+	c.Assert(err, check.IsNil)
+	err = evt.SetOtherCustomData(map[string]string{"z": "h"})
+	c.Assert(err, check.IsNil)
+	err = evt.Done(nil)
+	c.Assert(err, check.IsNil)
+	err = evt.SetOtherCustomDataField("w", "k")
+	c.Assert(err, check.IsNil)
+	evts, err := All()
+	c.Assert(err, check.IsNil)
+	c.Assert(evts, check.HasLen, 1)
+	var data map[string]string
+	err = evts[0].OtherData(&data)
+	c.Assert(err, check.IsNil)
+	c.Assert(data, check.DeepEquals, map[string]string{"z": "h", "w": "k"})
+}
+
 func (s *S) TestEventAsWriter(c *check.C) {
 	evt, err := New(&Opts{
 		Target:     Target{Type: "app", Value: "myapp"},
@@ -610,6 +632,7 @@ func (s *S) TestGetTargetType(c *check.C) {
 		{"service-instance", TargetTypeServiceInstance, nil},
 		{"team", TargetTypeTeam, nil},
 		{"user", TargetTypeUser, nil},
+		{"node-container", TargetTypeNodeContainer, nil},
 		{"invalid", "", ErrInvalidTargetType},
 	}
 	for _, t := range tests {
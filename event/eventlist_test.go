@@ -131,6 +131,38 @@ func (s *S) TestListFilterMany(c *check.C) {
 	}, Sort: "_id"}, []event.Event{allEvts[0], allEvts[4]})
 }
 
+func (s *S) TestListFilterExtraTargets(c *check.C) {
+	evt1, err := event.NewInternal(&event.Opts{
+		Target:       event.Target{Type: "container", Value: "c1"},
+		ExtraTargets: []event.Target{{Type: "app", Value: "myapp"}},
+		InternalKind: "healer",
+	})
+	c.Assert(err, check.IsNil)
+	evt2, err := event.New(&event.Opts{
+		Target: event.Target{Type: "app", Value: "myapp"},
+		Kind:   permission.PermAppUpdateEnvSet,
+		Owner:  s.token,
+	})
+	c.Assert(err, check.IsNil)
+	_, err = event.NewInternal(&event.Opts{
+		Target:       event.Target{Type: "container", Value: "c2"},
+		ExtraTargets: []event.Target{{Type: "app", Value: "otherapp"}},
+		InternalKind: "healer",
+	})
+	c.Assert(err, check.IsNil)
+	evts, err := event.List(&event.Filter{Target: event.Target{Type: "app", Value: "myapp"}, Sort: "_id"})
+	c.Assert(err, check.IsNil)
+	c.Assert(evts, eventtest.EvtEquals, []*event.Event{evt1, evt2})
+	evts, err = event.List(&event.Filter{Target: event.Target{Type: "container", Value: "c1"}})
+	c.Assert(err, check.IsNil)
+	c.Assert(evts, eventtest.EvtEquals, []*event.Event{evt1})
+	evts, err = event.List(&event.Filter{AllowedTargets: []event.TargetFilter{
+		{Type: "app", Values: []string{"myapp"}},
+	}, Sort: "_id"})
+	c.Assert(err, check.IsNil)
+	c.Assert(evts, eventtest.EvtEquals, []*event.Event{evt1, evt2})
+}
+
 func (s *S) TestGetByID(c *check.C) {
 	evt, err := event.New(&event.Opts{Target: event.Target{Type: "app", Value: "myapp"}, Kind: permission.PermAppUpdateEnvSet, Owner: s.token})
 	c.Assert(err, check.IsNil)
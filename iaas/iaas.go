@@ -7,6 +7,7 @@
 package iaas
 
 import (
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"net/http"
@@ -43,6 +44,14 @@ type InitializableIaaS interface {
 	Initialize() error
 }
 
+// Lister is implemented by IaaS providers able to list the machines created
+// by tsuru that still exist in the provider.
+type Lister interface {
+	ListMachines() ([]Machine, error)
+}
+
+var ErrListNotSupported = errors.New("IaaS doesn't support listing machines")
+
 type NamedIaaS struct {
 	BaseIaaSName string
 	IaaSName     string
@@ -140,6 +149,28 @@ func Describe(iaasName ...string) (string, error) {
 	return desc.Describe(), nil
 }
 
+// ListIaaSMachines returns the machines listed by the IaaS with the given
+// name. ErrListNotSupported is returned when the IaaS doesn't implement the
+// Lister interface.
+func ListIaaSMachines(iaasName string) ([]Machine, error) {
+	iaas, err := getIaasProvider(iaasName)
+	if err != nil {
+		return nil, err
+	}
+	lister, ok := iaas.(Lister)
+	if !ok {
+		return nil, ErrListNotSupported
+	}
+	machines, err := lister.ListMachines()
+	if err != nil {
+		return nil, err
+	}
+	for i := range machines {
+		machines[i].Iaas = iaasName
+	}
+	return machines, nil
+}
+
 func ResetAll() {
 	iaasLock.Lock()
 	defer iaasLock.Unlock()
@@ -5,6 +5,7 @@
 package iaas
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
@@ -52,6 +53,32 @@ func (s *S) TestDescribe(c *check.C) {
 	c.Assert(desc, check.Equals, "ahoy desc!")
 }
 
+func (s *S) TestListIaaSMachines(c *check.C) {
+	RegisterIaasProvider("lister-iaas", func(name string) IaaS {
+		return &TestListerIaaS{machines: []Machine{{Id: "m1", Address: "10.0.0.1"}, {Id: "m2", Address: "10.0.0.2"}}}
+	})
+	machines, err := ListIaaSMachines("lister-iaas")
+	c.Assert(err, check.IsNil)
+	c.Assert(machines, check.DeepEquals, []Machine{
+		{Id: "m1", Address: "10.0.0.1", Iaas: "lister-iaas"},
+		{Id: "m2", Address: "10.0.0.2", Iaas: "lister-iaas"},
+	})
+}
+
+func (s *S) TestListIaaSMachinesNotSupported(c *check.C) {
+	RegisterIaasProvider("nolister-iaas", newTestIaaS)
+	_, err := ListIaaSMachines("nolister-iaas")
+	c.Assert(err, check.Equals, ErrListNotSupported)
+}
+
+func (s *S) TestListIaaSMachinesError(c *check.C) {
+	RegisterIaasProvider("errlister-iaas", func(name string) IaaS {
+		return &TestListerIaaS{err: errors.New("list error")}
+	})
+	_, err := ListIaaSMachines("errlister-iaas")
+	c.Assert(err, check.ErrorMatches, "list error")
+}
+
 func (s *S) TestCustomizableIaaSProvider(c *check.C) {
 	RegisterIaasProvider("customable-iaas", newTestCustomizableIaaS)
 	config.Set("iaas:custom:abc:provider", "customable-iaas")
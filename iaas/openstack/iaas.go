@@ -0,0 +1,483 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package openstack
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tsuru/monsterqueue"
+	"github.com/tsuru/tsuru/hc"
+	"github.com/tsuru/tsuru/iaas"
+	"github.com/tsuru/tsuru/net"
+	"github.com/tsuru/tsuru/queue"
+)
+
+const defaultDomainName = "Default"
+
+func init() {
+	iaas.RegisterIaasProvider("openstack", newOpenstackIaaS)
+	hc.AddChecker("OpenStack", iaas.BuildHealthCheck("openstack"))
+}
+
+type OpenstackIaaS struct {
+	base  iaas.UserDataIaaS
+	mu    sync.Mutex
+	token *authToken
+}
+
+type httpError struct {
+	code int
+	body string
+}
+
+func (e *httpError) Error() string {
+	return fmt.Sprintf("openstack: unexpected status code %d: %s", e.code, e.body)
+}
+
+func newOpenstackIaaS(name string) iaas.IaaS {
+	return &OpenstackIaaS{base: iaas.UserDataIaaS{NamedIaaS: iaas.NamedIaaS{BaseIaaSName: "openstack", IaaSName: name}}}
+}
+
+func (i *OpenstackIaaS) Describe() string {
+	return `OpenStack IaaS required params:
+  flavor=<flavor>                      Your flavor uuid
+  image=<image>                        Your image uuid
+
+Optional params:
+  name=<name>                          Name of the server, defaults to a random name
+  networks=<id1,id2,...>               Network uuids the server will be attached to
+  security-groups=<group1,group2,...>  Names of the security groups of the server
+  key-name=<key-name>                  Name of a key pair to be injected in the server
+  availability-zone=<zone>             Availability zone where the server will be created
+  floating-network=<network>           External network uuid, allocates a floating ip from it as the server address
+  tags=<key1:value1,key2:value2,...>   Metadata set in the server
+`
+}
+
+func (i *OpenstackIaaS) HealthCheck() error {
+	var resp flavorsResponse
+	err := i.do(computeService, "GET", "/flavors", nil, &resp)
+	if err != nil {
+		return err
+	}
+	if len(resp.Flavors) < 1 {
+		name := i.base.IaaSName
+		if name == "" {
+			name = i.base.BaseIaaSName
+		}
+		return fmt.Errorf("%q - not enough flavors available, want at least 1, got %d", name, len(resp.Flavors))
+	}
+	return nil
+}
+
+func (i *OpenstackIaaS) Initialize() error {
+	q, err := queue.Queue()
+	if err != nil {
+		return err
+	}
+	return q.RegisterTask(&openstackWaitTask{iaas: i})
+}
+
+func validateParams(params map[string]string) error {
+	mandatory := []string{"flavor", "image"}
+	for _, p := range mandatory {
+		if params[p] == "" {
+			return fmt.Errorf("param %q is mandatory", p)
+		}
+	}
+	return nil
+}
+
+func splitList(value string) []string {
+	var result []string
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if item != "" {
+			result = append(result, item)
+		}
+	}
+	return result
+}
+
+func randomName() (string, error) {
+	buf := make([]byte, 8)
+	_, err := rand.Read(buf)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("tsuru-%x", buf), nil
+}
+
+func (i *OpenstackIaaS) waitTimeout() int {
+	rawWait, _ := i.base.GetConfigString("wait-timeout")
+	maxWaitTime, _ := strconv.Atoi(rawWait)
+	if maxWaitTime == 0 {
+		maxWaitTime = 300
+	}
+	return maxWaitTime
+}
+
+func (i *OpenstackIaaS) CreateMachine(params map[string]string) (*iaas.Machine, error) {
+	err := validateParams(params)
+	if err != nil {
+		return nil, err
+	}
+	userData, err := i.base.ReadUserData()
+	if err != nil {
+		return nil, err
+	}
+	q, err := queue.Queue()
+	if err != nil {
+		return nil, err
+	}
+	name := params["name"]
+	if name == "" {
+		name, err = randomName()
+		if err != nil {
+			return nil, err
+		}
+	}
+	opts := serverCreate{
+		Name:             name,
+		ImageRef:         params["image"],
+		FlavorRef:        params["flavor"],
+		KeyName:          params["key-name"],
+		AvailabilityZone: params["availability-zone"],
+	}
+	for _, network := range splitList(params["networks"]) {
+		opts.Networks = append(opts.Networks, serverNetwork{UUID: network})
+	}
+	for _, group := range splitList(params["security-groups"]) {
+		opts.SecurityGroups = append(opts.SecurityGroups, securityGroup{Name: group})
+	}
+	opts.Metadata = map[string]string{iaasMetadataKey: i.base.IaaSName}
+	for _, tag := range splitList(params["tags"]) {
+		if strings.Contains(tag, ":") {
+			parts := strings.SplitN(tag, ":", 2)
+			opts.Metadata[parts[0]] = parts[1]
+		}
+	}
+	if userData != "" {
+		opts.UserData = base64.StdEncoding.EncodeToString([]byte(userData))
+	}
+	var created serverResponse
+	err = i.do(computeService, "POST", "/servers", serverCreateRequest{Server: opts}, &created)
+	if err != nil {
+		return nil, err
+	}
+	serverID := created.Server.ID
+	maxWaitTime := i.waitTimeout()
+	waitDuration := time.Duration(maxWaitTime) * time.Second
+	jobParams := monsterqueue.JobParams{
+		"serverId":        serverID,
+		"timeout":         maxWaitTime,
+		"floatingNetwork": params["floating-network"],
+	}
+	job, err := q.EnqueueWait(i.taskName(), jobParams, waitDuration)
+	if err != nil {
+		if err == monsterqueue.ErrQueueWaitTimeout {
+			return nil, fmt.Errorf("openstack: time out after %v waiting for server %s to start", waitDuration, serverID)
+		}
+		return nil, err
+	}
+	result, err := job.Result()
+	if err != nil {
+		return nil, err
+	}
+	return &iaas.Machine{
+		Id:      serverID,
+		Address: result.(string),
+		Status:  "running",
+	}, nil
+}
+
+func (i *OpenstackIaaS) DeleteMachine(machine *iaas.Machine) error {
+	if machine.CreationParams["floating-network"] != "" && machine.Address != "" {
+		err := i.releaseFloatingIPs(machine.Address)
+		if err != nil {
+			return err
+		}
+	}
+	return i.deleteServer(machine.Id)
+}
+
+// ListMachines returns the servers in the project created by this IaaS.
+func (i *OpenstackIaaS) ListMachines() ([]iaas.Machine, error) {
+	var resp serversResponse
+	err := i.do(computeService, "GET", "/servers/detail", nil, &resp)
+	if err != nil {
+		return nil, err
+	}
+	var machines []iaas.Machine
+	for _, srv := range resp.Servers {
+		if srv.Metadata[iaasMetadataKey] != i.base.IaaSName {
+			continue
+		}
+		address := serverFloatingAddress(&srv)
+		if address == "" {
+			address = serverFixedAddress(&srv)
+		}
+		machines = append(machines, iaas.Machine{
+			Id:      srv.ID,
+			Address: address,
+			Status:  strings.ToLower(srv.Status),
+		})
+	}
+	return machines, nil
+}
+
+func (i *OpenstackIaaS) deleteServer(serverID string) error {
+	err := i.do(computeService, "DELETE", "/servers/"+serverID, nil, nil)
+	if httpErr, ok := err.(*httpError); ok && httpErr.code == http.StatusNotFound {
+		return nil
+	}
+	return err
+}
+
+func (i *OpenstackIaaS) getServer(serverID string) (*server, error) {
+	var resp serverResponse
+	err := i.do(computeService, "GET", "/servers/"+serverID, nil, &resp)
+	if err != nil {
+		return nil, err
+	}
+	return &resp.Server, nil
+}
+
+func (i *OpenstackIaaS) allocateFloatingIP(serverID, floatingNetwork string) (*floatingIP, error) {
+	var ports portsResponse
+	err := i.do(networkService, "GET", "/v2.0/ports?device_id="+url.QueryEscape(serverID), nil, &ports)
+	if err != nil {
+		return nil, err
+	}
+	if len(ports.Ports) == 0 {
+		return nil, fmt.Errorf("no ports found for server %s", serverID)
+	}
+	req := floatingIPRequest{FloatingIP: floatingIP{
+		FloatingNetworkID: floatingNetwork,
+		PortID:            ports.Ports[0].ID,
+	}}
+	var resp floatingIPResponse
+	err = i.do(networkService, "POST", "/v2.0/floatingips", req, &resp)
+	if err != nil {
+		return nil, err
+	}
+	return &resp.FloatingIP, nil
+}
+
+func (i *OpenstackIaaS) releaseFloatingIPs(address string) error {
+	var resp floatingIPsResponse
+	err := i.do(networkService, "GET", "/v2.0/floatingips?floating_ip_address="+url.QueryEscape(address), nil, &resp)
+	if err != nil {
+		return err
+	}
+	for _, fip := range resp.FloatingIPs {
+		err = i.do(networkService, "DELETE", "/v2.0/floatingips/"+fip.ID, nil, nil)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// serverFixedAddress returns the first fixed IPv4 address of the server, looking
+// at its networks in name order.
+func serverFixedAddress(srv *server) string {
+	return serverAddressByType(srv, "fixed")
+}
+
+// serverFloatingAddress returns the first floating IPv4 address of the
+// server, looking at its networks in name order.
+func serverFloatingAddress(srv *server) string {
+	return serverAddressByType(srv, "floating")
+}
+
+func serverAddressByType(srv *server, addrType string) string {
+	var networks []string
+	for name := range srv.Addresses {
+		networks = append(networks, name)
+	}
+	sort.Strings(networks)
+	for _, name := range networks {
+		for _, addr := range srv.Addresses[name] {
+			typ := addr.Type
+			if typ == "" {
+				typ = "fixed"
+			}
+			if addr.Version == 4 && typ == addrType {
+				return addr.Addr
+			}
+		}
+	}
+	return ""
+}
+
+func (i *OpenstackIaaS) taskName() string {
+	return fmt.Sprintf("openstack-wait-machine-%s", i.base.IaaSName)
+}
+
+// authenticate returns a valid keystone v3 token, requesting a new one
+// when there's no cached token or when it is about to expire.
+func (i *OpenstackIaaS) authenticate() (*authToken, error) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	if i.token != nil && time.Now().Add(time.Minute).Before(i.token.expiresAt) {
+		return i.token, nil
+	}
+	authURL, err := i.base.GetConfigString("auth-url")
+	if err != nil {
+		return nil, err
+	}
+	username, err := i.base.GetConfigString("username")
+	if err != nil {
+		return nil, err
+	}
+	password, err := i.base.GetConfigString("password")
+	if err != nil {
+		return nil, err
+	}
+	project, err := i.base.GetConfigString("project-name")
+	if err != nil {
+		return nil, err
+	}
+	userDomain, _ := i.base.GetConfigString("user-domain-name")
+	if userDomain == "" {
+		userDomain = defaultDomainName
+	}
+	projectDomain, _ := i.base.GetConfigString("project-domain-name")
+	if projectDomain == "" {
+		projectDomain = defaultDomainName
+	}
+	var req authRequest
+	req.Auth.Identity.Methods = []string{"password"}
+	req.Auth.Identity.Password.User = authUser{
+		Name:     username,
+		Password: password,
+		Domain:   authDomainRef{Name: userDomain},
+	}
+	req.Auth.Scope.Project = authProject{
+		Name:   project,
+		Domain: authDomainRef{Name: projectDomain},
+	}
+	var resp authResponse
+	header, err := doRequest("POST", strings.TrimRight(authURL, "/")+"/auth/tokens", "", req, &resp)
+	if err != nil {
+		return nil, fmt.Errorf("openstack: unable to authenticate: %s", err)
+	}
+	tokenID := header.Get("X-Subject-Token")
+	if tokenID == "" {
+		return nil, fmt.Errorf("openstack: unable to authenticate: no token returned by keystone")
+	}
+	i.token = &authToken{
+		id:        tokenID,
+		expiresAt: resp.Token.ExpiresAt,
+		catalog:   resp.Token.Catalog,
+	}
+	return i.token, nil
+}
+
+func (i *OpenstackIaaS) resetToken() {
+	i.mu.Lock()
+	i.token = nil
+	i.mu.Unlock()
+}
+
+func (i *OpenstackIaaS) endpoint(token *authToken, service string) (string, error) {
+	region, _ := i.base.GetConfigString("region")
+	iface, _ := i.base.GetConfigString("endpoint-interface")
+	if iface == "" {
+		iface = "public"
+	}
+	for _, entry := range token.catalog {
+		if entry.Type != service {
+			continue
+		}
+		for _, endpoint := range entry.Endpoints {
+			if endpoint.Interface != iface {
+				continue
+			}
+			if region != "" && endpoint.Region != region && endpoint.RegionID != region {
+				continue
+			}
+			return strings.TrimRight(endpoint.URL, "/"), nil
+		}
+	}
+	return "", fmt.Errorf("openstack: no %s endpoint found in the service catalog", service)
+}
+
+// do sends a request to the given service, using the endpoint found in the
+// service catalog. The request is retried once with a new token when the
+// current one is rejected.
+func (i *OpenstackIaaS) do(service, method, path string, body, result interface{}) error {
+	for retry := true; ; retry = false {
+		token, err := i.authenticate()
+		if err != nil {
+			return err
+		}
+		endpoint, err := i.endpoint(token, service)
+		if err != nil {
+			return err
+		}
+		_, err = doRequest(method, endpoint+path, token.id, body, result)
+		if httpErr, ok := err.(*httpError); ok && httpErr.code == http.StatusUnauthorized && retry {
+			i.resetToken()
+			continue
+		}
+		return err
+	}
+}
+
+func doRequest(method, reqURL, token string, body, result interface{}) (http.Header, error) {
+	var reqBody io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		reqBody = bytes.NewReader(data)
+	}
+	req, err := http.NewRequest(method, reqURL, reqBody)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if token != "" {
+		req.Header.Set("X-Auth-Token", token)
+	}
+	resp, err := net.Dial5Full300ClientNoKeepAlive.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
+		return nil, &httpError{code: resp.StatusCode, body: string(data)}
+	}
+	if result != nil && len(data) > 0 {
+		err = json.Unmarshal(data, result)
+		if err != nil {
+			return nil, fmt.Errorf("unexpected result data: %s - Body: %s", err, string(data))
+		}
+	}
+	return resp.Header, nil
+}
@@ -0,0 +1,348 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package openstack
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/tsuru/config"
+	"github.com/tsuru/tsuru/iaas"
+	"github.com/tsuru/tsuru/queue"
+	"gopkg.in/check.v1"
+)
+
+func Test(t *testing.T) { check.TestingT(t) }
+
+type openstackSuite struct {
+	server *fakeOpenstack
+}
+
+var _ = check.Suite(&openstackSuite{})
+
+func (s *openstackSuite) SetUpSuite(c *check.C) {
+	config.Set("iaas:openstack:username", "tsuru")
+	config.Set("iaas:openstack:password", "secret")
+	config.Set("iaas:openstack:project-name", "tsuru-project")
+	waitInterval = 10 * time.Millisecond
+}
+
+func (s *openstackSuite) SetUpTest(c *check.C) {
+	config.Set("queue:mongo-url", "127.0.0.1:27017")
+	config.Set("queue:mongo-database", "queue_openstack_iaas")
+	queue.ResetQueue()
+	s.server = newFakeOpenstack()
+	config.Set("iaas:openstack:auth-url", s.server.URL+"/identity/v3")
+}
+
+func (s *openstackSuite) TearDownTest(c *check.C) {
+	s.server.Close()
+}
+
+type fakeOpenstack struct {
+	*httptest.Server
+	mu          sync.Mutex
+	calls       []string
+	authBodies  []authRequest
+	created     serverCreateRequest
+	fipRequest  floatingIPRequest
+	statuses    []string
+	tokenStatus int
+}
+
+func newFakeOpenstack() *fakeOpenstack {
+	f := &fakeOpenstack{statuses: []string{"BUILD", serverStatusActive}}
+	f.Server = httptest.NewServer(http.HandlerFunc(f.handle))
+	return f
+}
+
+func (f *fakeOpenstack) getCalls() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string(nil), f.calls...)
+}
+
+func (f *fakeOpenstack) handle(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	call := r.Method + " " + r.URL.Path
+	if r.URL.RawQuery != "" {
+		call += "?" + r.URL.RawQuery
+	}
+	f.calls = append(f.calls, call)
+	w.Header().Set("Content-Type", "application/json")
+	if r.URL.Path == "/identity/v3/auth/tokens" {
+		var req authRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		f.authBodies = append(f.authBodies, req)
+		w.Header().Set("X-Subject-Token", fmt.Sprintf("token-%d", len(f.authBodies)))
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprintf(w, `{"token": {"expires_at": %q, "catalog": [
+			{"type": "compute", "name": "nova", "endpoints": [
+				{"interface": "internal", "region": "RegionOne", "url": "http://internal.invalid"},
+				{"interface": "public", "region": "RegionOne", "url": "%s/compute/v2.1/"}
+			]},
+			{"type": "network", "name": "neutron", "endpoints": [
+				{"interface": "public", "region": "RegionOne", "url": "%s/network"}
+			]}
+		]}}`, time.Now().Add(time.Hour).Format(time.RFC3339), f.URL, f.URL)
+		return
+	}
+	if f.tokenStatus != 0 && r.Header.Get("X-Auth-Token") == "token-1" {
+		w.WriteHeader(f.tokenStatus)
+		return
+	}
+	switch call {
+	case "POST /compute/v2.1/servers":
+		json.NewDecoder(r.Body).Decode(&f.created)
+		w.WriteHeader(http.StatusAccepted)
+		fmt.Fprint(w, `{"server": {"id": "srv-1"}}`)
+	case "GET /compute/v2.1/servers/srv-1":
+		status := f.statuses[0]
+		if len(f.statuses) > 1 {
+			f.statuses = f.statuses[1:]
+		}
+		fmt.Fprintf(w, `{"server": {"id": "srv-1", "status": %q, "fault": {"message": "no valid host"}, "addresses": {
+			"public": [{"addr": "fe80::1", "version": 6, "OS-EXT-IPS:type": "fixed"}, {"addr": "10.0.0.5", "version": 4, "OS-EXT-IPS:type": "fixed"}]
+		}}}`, status)
+	case "DELETE /compute/v2.1/servers/srv-1":
+		w.WriteHeader(http.StatusNoContent)
+	case "DELETE /compute/v2.1/servers/srv-gone":
+		w.WriteHeader(http.StatusNotFound)
+	case "DELETE /compute/v2.1/servers/srv-broken":
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprint(w, "something went wrong")
+	case "GET /compute/v2.1/servers/detail":
+		fmt.Fprint(w, `{"servers": [
+			{"id": "srv-1", "status": "ACTIVE", "metadata": {"tsuru-iaas": "openstack"}, "addresses": {
+				"public": [{"addr": "10.0.0.5", "version": 4}]
+			}},
+			{"id": "srv-2", "status": "SHUTOFF", "metadata": {"tsuru-iaas": "openstack"}, "addresses": {
+				"public": [{"addr": "10.0.0.6", "version": 4, "OS-EXT-IPS:type": "fixed"}, {"addr": "200.1.1.11", "version": 4, "OS-EXT-IPS:type": "floating"}]
+			}},
+			{"id": "srv-3", "status": "ACTIVE", "metadata": {"tsuru-iaas": "other"}},
+			{"id": "srv-4", "status": "ACTIVE"}
+		]}`)
+	case "GET /compute/v2.1/flavors":
+		fmt.Fprint(w, `{"flavors": [{"id": "1", "name": "m1.small"}]}`)
+	case "GET /network/v2.0/ports?device_id=srv-1":
+		fmt.Fprint(w, `{"ports": [{"id": "port-1"}]}`)
+	case "POST /network/v2.0/floatingips":
+		json.NewDecoder(r.Body).Decode(&f.fipRequest)
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprint(w, `{"floatingip": {"id": "fip-1", "floating_ip_address": "200.1.1.10"}}`)
+	case "GET /network/v2.0/floatingips?floating_ip_address=200.1.1.10":
+		fmt.Fprint(w, `{"floatingips": [{"id": "fip-1", "floating_ip_address": "200.1.1.10"}]}`)
+	case "DELETE /network/v2.0/floatingips/fip-1":
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func (s *openstackSuite) newIaaS(c *check.C) *OpenstackIaaS {
+	os := newOpenstackIaaS("openstack").(*OpenstackIaaS)
+	err := os.Initialize()
+	c.Assert(err, check.IsNil)
+	return os
+}
+
+func (s *openstackSuite) TestCreateMachine(c *check.C) {
+	os := s.newIaaS(c)
+	params := map[string]string{
+		"name":            "my-node",
+		"flavor":          "flavor-1",
+		"image":           "image-1",
+		"networks":        "net-1, net-2",
+		"security-groups": "default,tsuru",
+		"key-name":        "mykey",
+		"tags":            "team:infra,invalid",
+	}
+	m, err := os.CreateMachine(params)
+	c.Assert(err, check.IsNil)
+	c.Assert(m.Id, check.Equals, "srv-1")
+	c.Assert(m.Address, check.Equals, "10.0.0.5")
+	c.Assert(m.Status, check.Equals, "running")
+	created := s.server.created.Server
+	c.Assert(created.Name, check.Equals, "my-node")
+	c.Assert(created.FlavorRef, check.Equals, "flavor-1")
+	c.Assert(created.ImageRef, check.Equals, "image-1")
+	c.Assert(created.KeyName, check.Equals, "mykey")
+	c.Assert(created.Networks, check.DeepEquals, []serverNetwork{{UUID: "net-1"}, {UUID: "net-2"}})
+	c.Assert(created.SecurityGroups, check.DeepEquals, []securityGroup{{Name: "default"}, {Name: "tsuru"}})
+	c.Assert(created.Metadata, check.DeepEquals, map[string]string{"team": "infra", "tsuru-iaas": "openstack"})
+	c.Assert(created.UserData, check.Not(check.Equals), "")
+	auth := s.server.authBodies[0].Auth
+	c.Assert(auth.Identity.Methods, check.DeepEquals, []string{"password"})
+	c.Assert(auth.Identity.Password.User, check.DeepEquals, authUser{
+		Name:     "tsuru",
+		Password: "secret",
+		Domain:   authDomainRef{Name: "Default"},
+	})
+	c.Assert(auth.Scope.Project, check.DeepEquals, authProject{Name: "tsuru-project", Domain: authDomainRef{Name: "Default"}})
+	c.Assert(s.server.getCalls(), check.DeepEquals, []string{
+		"POST /identity/v3/auth/tokens",
+		"POST /compute/v2.1/servers",
+		"GET /compute/v2.1/servers/srv-1",
+		"GET /compute/v2.1/servers/srv-1",
+	})
+}
+
+func (s *openstackSuite) TestCreateMachineWithFloatingIP(c *check.C) {
+	os := s.newIaaS(c)
+	params := map[string]string{
+		"flavor":           "flavor-1",
+		"image":            "image-1",
+		"floating-network": "ext-net",
+	}
+	m, err := os.CreateMachine(params)
+	c.Assert(err, check.IsNil)
+	c.Assert(m.Id, check.Equals, "srv-1")
+	c.Assert(m.Address, check.Equals, "200.1.1.10")
+	c.Assert(s.server.created.Server.Name, check.Matches, "tsuru-[0-9a-f]{16}")
+	c.Assert(s.server.fipRequest.FloatingIP, check.DeepEquals, floatingIP{FloatingNetworkID: "ext-net", PortID: "port-1"})
+	c.Assert(s.server.getCalls(), check.DeepEquals, []string{
+		"POST /identity/v3/auth/tokens",
+		"POST /compute/v2.1/servers",
+		"GET /compute/v2.1/servers/srv-1",
+		"GET /compute/v2.1/servers/srv-1",
+		"GET /network/v2.0/ports?device_id=srv-1",
+		"POST /network/v2.0/floatingips",
+	})
+}
+
+func (s *openstackSuite) TestCreateMachineServerError(c *check.C) {
+	s.server.statuses = []string{serverStatusError}
+	os := s.newIaaS(c)
+	params := map[string]string{"flavor": "flavor-1", "image": "image-1"}
+	_, err := os.CreateMachine(params)
+	c.Assert(err, check.ErrorMatches, "server in error state: no valid host")
+	c.Assert(s.server.getCalls(), check.DeepEquals, []string{
+		"POST /identity/v3/auth/tokens",
+		"POST /compute/v2.1/servers",
+		"GET /compute/v2.1/servers/srv-1",
+		"DELETE /compute/v2.1/servers/srv-1",
+	})
+}
+
+func (s *openstackSuite) TestCreateMachineValidateParams(c *check.C) {
+	os := newOpenstackIaaS("openstack")
+	_, err := os.CreateMachine(map[string]string{"image": "image-1"})
+	c.Assert(err, check.ErrorMatches, `param "flavor" is mandatory`)
+	_, err = os.CreateMachine(map[string]string{"flavor": "flavor-1"})
+	c.Assert(err, check.ErrorMatches, `param "image" is mandatory`)
+	c.Assert(s.server.getCalls(), check.HasLen, 0)
+}
+
+func (s *openstackSuite) TestCreateMachineReauthenticatesOnUnauthorized(c *check.C) {
+	s.server.tokenStatus = http.StatusUnauthorized
+	os := s.newIaaS(c)
+	params := map[string]string{"flavor": "flavor-1", "image": "image-1"}
+	m, err := os.CreateMachine(params)
+	c.Assert(err, check.IsNil)
+	c.Assert(m.Address, check.Equals, "10.0.0.5")
+	c.Assert(s.server.getCalls()[:4], check.DeepEquals, []string{
+		"POST /identity/v3/auth/tokens",
+		"POST /compute/v2.1/servers",
+		"POST /identity/v3/auth/tokens",
+		"POST /compute/v2.1/servers",
+	})
+}
+
+func (s *openstackSuite) TestDeleteMachine(c *check.C) {
+	os := newOpenstackIaaS("openstack")
+	err := os.DeleteMachine(&iaas.Machine{Id: "srv-1", Address: "10.0.0.5"})
+	c.Assert(err, check.IsNil)
+	c.Assert(s.server.getCalls(), check.DeepEquals, []string{
+		"POST /identity/v3/auth/tokens",
+		"DELETE /compute/v2.1/servers/srv-1",
+	})
+}
+
+func (s *openstackSuite) TestDeleteMachineWithFloatingIP(c *check.C) {
+	os := newOpenstackIaaS("openstack")
+	err := os.DeleteMachine(&iaas.Machine{
+		Id:             "srv-1",
+		Address:        "200.1.1.10",
+		CreationParams: map[string]string{"floating-network": "ext-net"},
+	})
+	c.Assert(err, check.IsNil)
+	c.Assert(s.server.getCalls(), check.DeepEquals, []string{
+		"POST /identity/v3/auth/tokens",
+		"GET /network/v2.0/floatingips?floating_ip_address=200.1.1.10",
+		"DELETE /network/v2.0/floatingips/fip-1",
+		"DELETE /compute/v2.1/servers/srv-1",
+	})
+}
+
+func (s *openstackSuite) TestDeleteMachineNotFound(c *check.C) {
+	os := newOpenstackIaaS("openstack")
+	err := os.DeleteMachine(&iaas.Machine{Id: "srv-gone"})
+	c.Assert(err, check.IsNil)
+}
+
+func (s *openstackSuite) TestDeleteMachineError(c *check.C) {
+	os := newOpenstackIaaS("openstack")
+	err := os.DeleteMachine(&iaas.Machine{Id: "srv-broken"})
+	c.Assert(err, check.ErrorMatches, "openstack: unexpected status code 500: something went wrong")
+}
+
+func (s *openstackSuite) TestListMachines(c *check.C) {
+	os := newOpenstackIaaS("openstack").(iaas.Lister)
+	machines, err := os.ListMachines()
+	c.Assert(err, check.IsNil)
+	c.Assert(machines, check.DeepEquals, []iaas.Machine{
+		{Id: "srv-1", Address: "10.0.0.5", Status: "active"},
+		{Id: "srv-2", Address: "200.1.1.11", Status: "shutoff"},
+	})
+}
+
+func (s *openstackSuite) TestHealthCheck(c *check.C) {
+	os := newOpenstackIaaS("openstack").(iaas.HealthChecker)
+	err := os.HealthCheck()
+	c.Assert(err, check.IsNil)
+	c.Assert(s.server.getCalls(), check.DeepEquals, []string{
+		"POST /identity/v3/auth/tokens",
+		"GET /compute/v2.1/flavors",
+	})
+}
+
+func (s *openstackSuite) TestHealthCheckAuthFailure(c *check.C) {
+	config.Set("iaas:openstack:auth-url", s.server.URL+"/other")
+	os := newOpenstackIaaS("openstack").(iaas.HealthChecker)
+	err := os.HealthCheck()
+	c.Assert(err, check.ErrorMatches, "openstack: unable to authenticate: .*404.*")
+}
+
+func (s *openstackSuite) TestEndpointWithRegion(c *check.C) {
+	defer config.Unset("iaas:openstack:region")
+	config.Set("iaas:openstack:region", "RegionTwo")
+	os := newOpenstackIaaS("openstack").(*OpenstackIaaS)
+	err := os.HealthCheck()
+	c.Assert(err, check.ErrorMatches, "openstack: no compute endpoint found in the service catalog")
+}
+
+func (s *openstackSuite) TestServerFixedAddress(c *check.C) {
+	srv := server{Addresses: map[string][]serverAddress{
+		"b-net": {{Addr: "10.0.1.1", Version: 4, Type: "fixed"}},
+		"a-net": {
+			{Addr: "fe80::1", Version: 6, Type: "fixed"},
+			{Addr: "200.0.0.1", Version: 4, Type: "floating"},
+			{Addr: "10.0.0.1", Version: 4, Type: "fixed"},
+		},
+	}}
+	c.Assert(serverFixedAddress(&srv), check.Equals, "10.0.0.1")
+	c.Assert(serverFixedAddress(&server{}), check.Equals, "")
+}
+
+func (s *openstackSuite) TestDescribe(c *check.C) {
+	os := newOpenstackIaaS("openstack").(iaas.Describer)
+	c.Assert(os.Describe(), check.Matches, "(?s)OpenStack IaaS required params:.*flavor=.*image=.*")
+}
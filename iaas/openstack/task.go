@@ -0,0 +1,104 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package openstack
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/tsuru/monsterqueue"
+	"github.com/tsuru/tsuru/log"
+)
+
+var waitInterval = 500 * time.Millisecond
+
+type openstackWaitTask struct {
+	iaas *OpenstackIaaS
+}
+
+func (t *openstackWaitTask) Name() string {
+	return t.iaas.taskName()
+}
+
+func (t *openstackWaitTask) Run(job monsterqueue.Job) {
+	params := job.Parameters()
+	serverID := params["serverId"].(string)
+	var timeout int
+	switch val := params["timeout"].(type) {
+	case int:
+		timeout = val
+	case float64:
+		timeout = int(val)
+	}
+	var floatingNetwork string
+	if network, ok := params["floatingNetwork"].(string); ok {
+		floatingNetwork = network
+	}
+	var address string
+	var fip *floatingIP
+	var jobErr error
+	t0 := time.Now()
+	for {
+		if time.Since(t0) > time.Duration(2*timeout)*time.Second {
+			jobErr = errors.New("hard timeout")
+			break
+		}
+		log.Debugf("openstack: waiting for server %s to be active", serverID)
+		srv, err := t.iaas.getServer(serverID)
+		if err != nil {
+			log.Debugf("openstack: api error: %s", err)
+			time.Sleep(waitInterval)
+			continue
+		}
+		if srv.Status == serverStatusError {
+			msg := "server in error state"
+			if srv.Fault != nil && srv.Fault.Message != "" {
+				msg = fmt.Sprintf("%s: %s", msg, srv.Fault.Message)
+			}
+			jobErr = errors.New(msg)
+			break
+		}
+		if srv.Status != serverStatusActive {
+			time.Sleep(waitInterval)
+			continue
+		}
+		if floatingNetwork != "" {
+			fip, err = t.iaas.allocateFloatingIP(serverID, floatingNetwork)
+			if err != nil {
+				jobErr = err
+				break
+			}
+			address = fip.FloatingIPAddress
+		} else {
+			address = serverFixedAddress(srv)
+		}
+		if address == "" {
+			jobErr = fmt.Errorf("no address found for server %s", serverID)
+		}
+		break
+	}
+	if jobErr == nil {
+		notified, _ := job.Success(address)
+		if notified {
+			return
+		}
+	}
+	// The server is removed before the error is reported, so that callers
+	// waiting for the job don't see a leftover server.
+	if fip != nil {
+		err := t.iaas.do(networkService, "DELETE", "/v2.0/floatingips/"+fip.ID, nil, nil)
+		if err != nil {
+			log.Errorf("openstack: could not release floating ip %s: %s", fip.ID, err)
+		}
+	}
+	err := t.iaas.deleteServer(serverID)
+	if err != nil {
+		log.Errorf("openstack: could not delete server %s: %s", serverID, err)
+	}
+	if jobErr != nil {
+		job.Error(jobErr)
+	}
+}
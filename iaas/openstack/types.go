@@ -0,0 +1,158 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package openstack
+
+import "time"
+
+const (
+	serverStatusActive = "ACTIVE"
+	serverStatusError  = "ERROR"
+
+	computeService = "compute"
+	networkService = "network"
+
+	// iaasMetadataKey is set in the servers created by tsuru, holding the
+	// name of the IaaS that created them.
+	iaasMetadataKey = "tsuru-iaas"
+)
+
+type authRequest struct {
+	Auth struct {
+		Identity struct {
+			Methods  []string `json:"methods"`
+			Password struct {
+				User authUser `json:"user"`
+			} `json:"password"`
+		} `json:"identity"`
+		Scope struct {
+			Project authProject `json:"project"`
+		} `json:"scope"`
+	} `json:"auth"`
+}
+
+type authUser struct {
+	Name     string        `json:"name"`
+	Password string        `json:"password"`
+	Domain   authDomainRef `json:"domain"`
+}
+
+type authProject struct {
+	Name   string        `json:"name"`
+	Domain authDomainRef `json:"domain"`
+}
+
+type authDomainRef struct {
+	Name string `json:"name"`
+}
+
+type authResponse struct {
+	Token struct {
+		ExpiresAt time.Time      `json:"expires_at"`
+		Catalog   []catalogEntry `json:"catalog"`
+	} `json:"token"`
+}
+
+type catalogEntry struct {
+	Type      string            `json:"type"`
+	Name      string            `json:"name"`
+	Endpoints []catalogEndpoint `json:"endpoints"`
+}
+
+type catalogEndpoint struct {
+	Interface string `json:"interface"`
+	Region    string `json:"region"`
+	RegionID  string `json:"region_id"`
+	URL       string `json:"url"`
+}
+
+type authToken struct {
+	id        string
+	expiresAt time.Time
+	catalog   []catalogEntry
+}
+
+type serverCreateRequest struct {
+	Server serverCreate `json:"server"`
+}
+
+type serverCreate struct {
+	Name             string            `json:"name"`
+	ImageRef         string            `json:"imageRef"`
+	FlavorRef        string            `json:"flavorRef"`
+	Networks         []serverNetwork   `json:"networks,omitempty"`
+	SecurityGroups   []securityGroup   `json:"security_groups,omitempty"`
+	KeyName          string            `json:"key_name,omitempty"`
+	AvailabilityZone string            `json:"availability_zone,omitempty"`
+	UserData         string            `json:"user_data,omitempty"`
+	Metadata         map[string]string `json:"metadata,omitempty"`
+}
+
+type serverNetwork struct {
+	UUID string `json:"uuid"`
+}
+
+type securityGroup struct {
+	Name string `json:"name"`
+}
+
+type serverResponse struct {
+	Server server `json:"server"`
+}
+
+type server struct {
+	ID        string                     `json:"id"`
+	Name      string                     `json:"name"`
+	Status    string                     `json:"status"`
+	Addresses map[string][]serverAddress `json:"addresses"`
+	Metadata  map[string]string          `json:"metadata"`
+	Fault     *serverFault               `json:"fault"`
+}
+
+type serversResponse struct {
+	Servers []server `json:"servers"`
+}
+
+type serverAddress struct {
+	Addr    string `json:"addr"`
+	Version int    `json:"version"`
+	Type    string `json:"OS-EXT-IPS:type"`
+}
+
+type serverFault struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+type flavorsResponse struct {
+	Flavors []struct {
+		ID   string `json:"id"`
+		Name string `json:"name"`
+	} `json:"flavors"`
+}
+
+type portsResponse struct {
+	Ports []struct {
+		ID string `json:"id"`
+	} `json:"ports"`
+}
+
+type floatingIPRequest struct {
+	FloatingIP floatingIP `json:"floatingip"`
+}
+
+type floatingIPResponse struct {
+	FloatingIP floatingIP `json:"floatingip"`
+}
+
+type floatingIPsResponse struct {
+	FloatingIPs []floatingIP `json:"floatingips"`
+}
+
+type floatingIP struct {
+	ID                string `json:"id,omitempty"`
+	FloatingNetworkID string `json:"floating_network_id,omitempty"`
+	FloatingIPAddress string `json:"floating_ip_address,omitempty"`
+	PortID            string `json:"port_id,omitempty"`
+}
@@ -101,6 +101,16 @@ func (i *TestHealthCheckerIaaS) HealthCheck() error {
 	return i.err
 }
 
+type TestListerIaaS struct {
+	TestIaaS
+	machines []Machine
+	err      error
+}
+
+func (i *TestListerIaaS) ListMachines() ([]Machine, error) {
+	return i.machines, i.err
+}
+
 func newTestHealthcheckIaaS(name string) IaaS {
 	return &TestHealthCheckerIaaS{}
 }
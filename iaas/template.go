@@ -6,11 +6,27 @@ package iaas
 
 import (
 	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
 
 	"github.com/tsuru/config"
 	"github.com/tsuru/tsuru/db"
 	"github.com/tsuru/tsuru/db/storage"
 	"github.com/tsuru/tsuru/log"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+const (
+	TemplateParamString = "string"
+	TemplateParamInt    = "int"
+	TemplateParamBool   = "bool"
+
+	// maxTemplateDepth is the maximum number of templates in a chain of
+	// parent templates.
+	maxTemplateDepth = 10
 )
 
 type TemplateData struct {
@@ -24,10 +40,65 @@ func (l TemplateDataList) Len() int           { return len(l) }
 func (l TemplateDataList) Swap(i, j int)      { l[i], l[j] = l[j], l[i] }
 func (l TemplateDataList) Less(i, j int) bool { return l[i].Name < l[j].Name }
 
+// TemplateParam declares a parameter accepted by a template. Type defaults to
+// TemplateParamString, and when Values is not empty the parameter value must
+// be one of them.
+type TemplateParam struct {
+	Name     string
+	Type     string   `form:",omitempty"`
+	Required bool     `form:",omitempty"`
+	Values   []string `form:",omitempty"`
+	Default  string   `form:",omitempty"`
+}
+
+func (p *TemplateParam) validate(value string) error {
+	switch p.Type {
+	case TemplateParamInt:
+		if _, err := strconv.Atoi(value); err != nil {
+			return fmt.Errorf("%q must be an integer, got %q", p.Name, value)
+		}
+	case TemplateParamBool:
+		if _, err := strconv.ParseBool(value); err != nil {
+			return fmt.Errorf("%q must be a boolean, got %q", p.Name, value)
+		}
+	}
+	if len(p.Values) == 0 {
+		return nil
+	}
+	for _, v := range p.Values {
+		if v == value {
+			return nil
+		}
+	}
+	return fmt.Errorf("%q must be one of %s, got %q", p.Name, strings.Join(p.Values, ", "), value)
+}
+
+type TemplateParamList []TemplateParam
+
+func (l TemplateParamList) Len() int           { return len(l) }
+func (l TemplateParamList) Swap(i, j int)      { l[i], l[j] = l[j], l[i] }
+func (l TemplateParamList) Less(i, j int) bool { return l[i].Name < l[j].Name }
+
+// InvalidParamsError is returned by ExpandTemplate when the params don't
+// match the params declared by the template.
+type InvalidParamsError struct {
+	Template string
+	Errors   []string
+}
+
+func (e *InvalidParamsError) Error() string {
+	return fmt.Sprintf("invalid params for template %q: %s", e.Template, strings.Join(e.Errors, "; "))
+}
+
+// Template holds a set of params used when creating machines. A template may
+// extend a Parent template, inheriting its IaaS, data and declared params,
+// which are overridden by the ones set in the template itself.
 type Template struct {
 	Name     string `bson:"_id"`
 	IaaSName string
+	Parent   string `bson:",omitempty" form:",omitempty"`
 	Data     TemplateDataList
+	Params   TemplateParamList `bson:",omitempty" form:",omitempty"`
 }
 
 func FindTemplate(name string) (*Template, error) {
@@ -38,12 +109,22 @@ func FindTemplate(name string) (*Template, error) {
 	return &template, err
 }
 
+// ExpandTemplate merges the data in the template chain with the given params
+// and validates the result against the params declared by the templates. An
+// *InvalidParamsError is returned when validation fails.
 func ExpandTemplate(name string, params map[string]string) (map[string]string, error) {
 	template, err := FindTemplate(name)
+	if err != nil {
+		if err == mgo.ErrNotFound {
+			return nil, fmt.Errorf("template %q not found", name)
+		}
+		return nil, err
+	}
+	resolved, err := template.resolve()
 	if err != nil {
 		return nil, err
 	}
-	templateParams := template.paramsMap()
+	templateParams := resolved.paramsMap()
 	delete(params, "template")
 	// User params will override template params
 	for k, v := range templateParams {
@@ -52,6 +133,26 @@ func ExpandTemplate(name string, params map[string]string) (map[string]string, e
 			params[k] = v
 		}
 	}
+	var errs []string
+	for _, p := range resolved.Params {
+		value, isSet := params[p.Name]
+		if !isSet && p.Default != "" {
+			params[p.Name] = p.Default
+			value, isSet = p.Default, true
+		}
+		if !isSet || value == "" {
+			if p.Required {
+				errs = append(errs, fmt.Sprintf("%q is required", p.Name))
+			}
+			continue
+		}
+		if err = p.validate(value); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+	if len(errs) > 0 {
+		return nil, &InvalidParamsError{Template: name, Errors: errs}
+	}
 	return params, nil
 }
 
@@ -63,9 +164,34 @@ func ListTemplates() ([]Template, error) {
 	return templates, err
 }
 
+// TemplateInUseError is returned by DestroyTemplate when other templates
+// extend the template.
+type TemplateInUseError struct {
+	Template string
+	Children []string
+}
+
+func (e *TemplateInUseError) Error() string {
+	return fmt.Sprintf("template %q is the parent of other templates: %s", e.Template, strings.Join(e.Children, ", "))
+}
+
+// DestroyTemplate removes a template. Templates extended by other templates
+// can't be removed, a *TemplateInUseError is returned instead.
 func DestroyTemplate(name string) error {
 	coll := template_collection()
 	defer coll.Close()
+	var children []Template
+	err := coll.Find(bson.M{"parent": name}).Sort("_id").All(&children)
+	if err != nil {
+		return err
+	}
+	if len(children) > 0 {
+		inUseErr := &TemplateInUseError{Template: name}
+		for _, child := range children {
+			inUseErr.Children = append(inUseErr.Children, child.Name)
+		}
+		return inUseErr
+	}
 	return coll.RemoveId(name)
 }
 
@@ -85,6 +211,10 @@ func (t *Template) Update(toMerge *Template) error {
 	for k, v := range currentMap {
 		t.Data = append(t.Data, TemplateData{Name: k, Value: v})
 	}
+	if toMerge.Parent != "" {
+		t.Parent = toMerge.Parent
+	}
+	t.Params = mergeParams(t.Params, toMerge.Params)
 	return t.Save()
 }
 
@@ -92,13 +222,119 @@ func (t *Template) Save() error {
 	if t.Name == "" {
 		return errors.New("template name cannot be empty")
 	}
-	_, err := getIaasProvider(t.IaaSName)
+	err := t.validateParams()
+	if err != nil {
+		return err
+	}
+	resolved, err := t.resolve()
+	if err != nil {
+		return err
+	}
+	_, err = getIaasProvider(resolved.IaaSName)
 	if err != nil {
 		return err
 	}
 	return t.saveToDB()
 }
 
+func (t *Template) validateParams() error {
+	names := map[string]struct{}{}
+	for _, p := range t.Params {
+		if p.Name == "" {
+			return errors.New("template param name cannot be empty")
+		}
+		if _, ok := names[p.Name]; ok {
+			return fmt.Errorf("template param %q is declared more than once", p.Name)
+		}
+		names[p.Name] = struct{}{}
+		switch p.Type {
+		case "", TemplateParamString, TemplateParamInt, TemplateParamBool:
+		default:
+			return fmt.Errorf("invalid type %q for template param %q", p.Type, p.Name)
+		}
+		if p.Default != "" {
+			if err := p.validate(p.Default); err != nil {
+				return fmt.Errorf("invalid default for template param: %s", err)
+			}
+		}
+	}
+	return nil
+}
+
+// ResolveIaaSName returns the name of the IaaS used by the template, which
+// may be inherited from its parent templates.
+func (t *Template) ResolveIaaSName() (string, error) {
+	resolved, err := t.resolve()
+	if err != nil {
+		return "", err
+	}
+	return resolved.IaaSName, nil
+}
+
+// resolve walks the chain of parent templates, returning a template holding
+// the IaaS, data and params inherited by t.
+func (t *Template) resolve() (*Template, error) {
+	chain := []*Template{t}
+	seen := map[string]struct{}{t.Name: {}}
+	for current := t; current.Parent != ""; {
+		if _, ok := seen[current.Parent]; ok {
+			return nil, fmt.Errorf("template %q has a cycle in its parents", t.Name)
+		}
+		if len(chain) >= maxTemplateDepth {
+			return nil, fmt.Errorf("template %q exceeds the maximum of %d parent templates", t.Name, maxTemplateDepth-1)
+		}
+		parent, err := FindTemplate(current.Parent)
+		if err != nil {
+			if err == mgo.ErrNotFound {
+				return nil, fmt.Errorf("parent template %q not found", current.Parent)
+			}
+			return nil, err
+		}
+		seen[parent.Name] = struct{}{}
+		chain = append(chain, parent)
+		current = parent
+	}
+	resolved := &Template{Name: t.Name}
+	data := map[string]string{}
+	var params TemplateParamList
+	for i := len(chain) - 1; i >= 0; i-- {
+		if chain[i].IaaSName != "" {
+			resolved.IaaSName = chain[i].IaaSName
+		}
+		for _, d := range chain[i].Data {
+			data[d.Name] = d.Value
+		}
+		params = mergeParams(params, chain[i].Params)
+	}
+	for k, v := range data {
+		resolved.Data = append(resolved.Data, TemplateData{Name: k, Value: v})
+	}
+	sort.Sort(resolved.Data)
+	resolved.Params = params
+	return resolved, nil
+}
+
+// mergeParams returns the params in base overridden by the params in
+// toMerge with the same name.
+func mergeParams(base, toMerge TemplateParamList) TemplateParamList {
+	byName := map[string]TemplateParam{}
+	for _, p := range base {
+		byName[p.Name] = p
+	}
+	for _, p := range toMerge {
+		byName[p.Name] = p
+	}
+	if len(byName) == 0 {
+		return nil
+	}
+	result := make(TemplateParamList, 0, len(byName))
+	for _, p := range byName {
+		result = append(result, p)
+	}
+	sort.Sort(result)
+	return result
+}
+
 func (t *Template) saveToDB() error {
 	coll := template_collection()
 	defer coll.Close()
@@ -111,7 +347,9 @@ func (t *Template) paramsMap() map[string]string {
 	for _, item := range t.Data {
 		params[item.Name] = item.Value
 	}
-	params["iaas"] = t.IaaSName
+	if t.IaaSName != "" {
+		params["iaas"] = t.IaaSName
+	}
 	return params
 }
 
@@ -156,6 +156,36 @@ func (s *S) TestListTemplates(c *check.C) {
 	c.Assert(templates, check.DeepEquals, []Template{tpl1, tpl2})
 }
 
+func (s *S) TestDestroyTemplateWithChildren(c *check.C) {
+	base := Template{Name: "base", IaaSName: "test-iaas"}
+	err := base.Save()
+	c.Assert(err, check.IsNil)
+	child := Template{Name: "child", Parent: "base"}
+	err = child.Save()
+	c.Assert(err, check.IsNil)
+	err = DestroyTemplate("base")
+	c.Assert(err, check.DeepEquals, &TemplateInUseError{Template: "base", Children: []string{"child"}})
+	_, err = FindTemplate("base")
+	c.Assert(err, check.IsNil)
+	err = DestroyTemplate("child")
+	c.Assert(err, check.IsNil)
+	err = DestroyTemplate("base")
+	c.Assert(err, check.IsNil)
+}
+
+func (s *S) TestTemplateResolveIaaSName(c *check.C) {
+	base := Template{Name: "base", IaaSName: "test-iaas"}
+	err := base.Save()
+	c.Assert(err, check.IsNil)
+	child := Template{Name: "child", Parent: "base"}
+	name, err := child.ResolveIaaSName()
+	c.Assert(err, check.IsNil)
+	c.Assert(name, check.Equals, "test-iaas")
+	orphan := Template{Name: "orphan", Parent: "unknown"}
+	_, err = orphan.ResolveIaaSName()
+	c.Assert(err, check.ErrorMatches, `parent template "unknown" not found`)
+}
+
 func (s *S) TestDestroyTemplate(c *check.C) {
 	t := Template{
 		Name:     "tpl1",
@@ -196,3 +226,104 @@ func (s *S) TestExpandTemplate(c *check.C) {
 		"iaas": "test-iaas",
 	})
 }
+
+func (s *S) TestExpandTemplateWithParent(c *check.C) {
+	base := Template{
+		Name:     "base",
+		IaaSName: "test-iaas",
+		Data: TemplateDataList{
+			{Name: "key1", Value: "val1"},
+			{Name: "key2", Value: "val2"},
+		},
+		Params: TemplateParamList{
+			{Name: "size", Values: []string{"small", "large"}, Default: "small"},
+		},
+	}
+	err := base.Save()
+	c.Assert(err, check.IsNil)
+	child := Template{
+		Name:   "child",
+		Parent: "base",
+		Data: TemplateDataList{
+			{Name: "key2", Value: "childval2"},
+			{Name: "key3", Value: "val3"},
+		},
+		Params: TemplateParamList{
+			{Name: "count", Type: TemplateParamInt, Required: true},
+		},
+	}
+	err = child.Save()
+	c.Assert(err, check.IsNil)
+	data, err := ExpandTemplate("child", map[string]string{"template": "child", "count": "3"})
+	c.Assert(err, check.IsNil)
+	c.Assert(data, check.DeepEquals, map[string]string{
+		"key1":  "val1",
+		"key2":  "childval2",
+		"key3":  "val3",
+		"iaas":  "test-iaas",
+		"size":  "small",
+		"count": "3",
+	})
+}
+
+func (s *S) TestExpandTemplateInvalidParams(c *check.C) {
+	tpl := Template{
+		Name:     "tpl1",
+		IaaSName: "test-iaas",
+		Params: TemplateParamList{
+			{Name: "count", Type: TemplateParamInt, Required: true},
+			{Name: "public", Type: TemplateParamBool},
+			{Name: "size", Values: []string{"small", "large"}},
+		},
+	}
+	err := tpl.Save()
+	c.Assert(err, check.IsNil)
+	_, err = ExpandTemplate("tpl1", map[string]string{"public": "maybe", "size": "huge"})
+	c.Assert(err, check.FitsTypeOf, &InvalidParamsError{})
+	c.Assert(err.(*InvalidParamsError).Errors, check.DeepEquals, []string{
+		`"count" is required`,
+		`"public" must be a boolean, got "maybe"`,
+		`"size" must be one of small, large, got "huge"`,
+	})
+	_, err = ExpandTemplate("tpl1", map[string]string{"count": "x"})
+	c.Assert(err, check.ErrorMatches, `invalid params for template "tpl1": "count" must be an integer, got "x"`)
+}
+
+func (s *S) TestExpandTemplateNotFound(c *check.C) {
+	_, err := ExpandTemplate("unknown", map[string]string{})
+	c.Assert(err, check.ErrorMatches, `template "unknown" not found`)
+}
+
+func (s *S) TestTemplateSaveParentNotFound(c *check.C) {
+	t := Template{Name: "tpl1", Parent: "unknown"}
+	err := t.Save()
+	c.Assert(err, check.ErrorMatches, `parent template "unknown" not found`)
+}
+
+func (s *S) TestTemplateSaveParentCycle(c *check.C) {
+	tpl1 := Template{Name: "tpl1", IaaSName: "test-iaas"}
+	err := tpl1.Save()
+	c.Assert(err, check.IsNil)
+	tpl2 := Template{Name: "tpl2", Parent: "tpl1"}
+	err = tpl2.Save()
+	c.Assert(err, check.IsNil)
+	tpl1.Parent = "tpl2"
+	err = tpl1.Save()
+	c.Assert(err, check.ErrorMatches, `template "tpl1" has a cycle in its parents`)
+}
+
+func (s *S) TestTemplateSaveInvalidParams(c *check.C) {
+	t := Template{
+		Name:     "tpl1",
+		IaaSName: "test-iaas",
+		Params:   TemplateParamList{{Name: "count", Type: "float"}},
+	}
+	err := t.Save()
+	c.Assert(err, check.ErrorMatches, `invalid type "float" for template param "count"`)
+	t.Params = TemplateParamList{{Name: "count"}, {Name: "count"}}
+	err = t.Save()
+	c.Assert(err, check.ErrorMatches, `template param "count" is declared more than once`)
+	t.Params = TemplateParamList{{Name: "count", Type: TemplateParamInt, Default: "many"}}
+	err = t.Save()
+	c.Assert(err, check.ErrorMatches, `invalid default for template param: "count" must be an integer, got "many"`)
+}
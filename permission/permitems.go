@@ -21,18 +21,34 @@ var (
 	PermAppDeployBuild                   = PermissionRegistry.get("app.deploy.build")                    // [global app team pool]
 	PermAppDeployGit                     = PermissionRegistry.get("app.deploy.git")                      // [global app team pool]
 	PermAppDeployImage                   = PermissionRegistry.get("app.deploy.image")                    // [global app team pool]
+	PermAppDeployPromote                 = PermissionRegistry.get("app.deploy.promote")                  // [global app team pool]
 	PermAppDeployRollback                = PermissionRegistry.get("app.deploy.rollback")                 // [global app team pool]
 	PermAppDeployUpload                  = PermissionRegistry.get("app.deploy.upload")                   // [global app team pool]
 	PermAppRead                          = PermissionRegistry.get("app.read")                            // [global app team pool]
+	PermAppReadAccessPolicy              = PermissionRegistry.get("app.read.access-policy")              // [global app team pool]
+	PermAppReadAutoSleep                 = PermissionRegistry.get("app.read.auto-sleep")                 // [global app team pool]
+	PermAppReadCertificate               = PermissionRegistry.get("app.read.certificate")                // [global app team pool]
 	PermAppReadDeploy                    = PermissionRegistry.get("app.read.deploy")                     // [global app team pool]
 	PermAppReadEnv                       = PermissionRegistry.get("app.read.env")                        // [global app team pool]
 	PermAppReadEvents                    = PermissionRegistry.get("app.read.events")                     // [global app team pool]
 	PermAppReadLog                       = PermissionRegistry.get("app.read.log")                        // [global app team pool]
 	PermAppReadMetric                    = PermissionRegistry.get("app.read.metric")                     // [global app team pool]
+	PermAppReadMount                     = PermissionRegistry.get("app.read.mount")                      // [global app team pool]
+	PermAppReadRouter                    = PermissionRegistry.get("app.read.router")                     // [global app team pool]
 	PermAppRun                           = PermissionRegistry.get("app.run")                             // [global app team pool]
 	PermAppRunShell                      = PermissionRegistry.get("app.run.shell")                       // [global app team pool]
 	PermAppUpdate                        = PermissionRegistry.get("app.update")                          // [global app team pool]
+	PermAppUpdateAccessPolicy            = PermissionRegistry.get("app.update.access-policy")            // [global app team pool]
+	PermAppUpdateAccessPolicySet         = PermissionRegistry.get("app.update.access-policy.set")        // [global app team pool]
+	PermAppUpdateAccessPolicyUnset       = PermissionRegistry.get("app.update.access-policy.unset")      // [global app team pool]
+	PermAppUpdateAutoSleep               = PermissionRegistry.get("app.update.auto-sleep")               // [global app team pool]
+	PermAppUpdateAutoSleepSet            = PermissionRegistry.get("app.update.auto-sleep.set")           // [global app team pool]
+	PermAppUpdateAutoSleepUnset          = PermissionRegistry.get("app.update.auto-sleep.unset")         // [global app team pool]
 	PermAppUpdateBind                    = PermissionRegistry.get("app.update.bind")                     // [global app team pool]
+	PermAppUpdateCertificate             = PermissionRegistry.get("app.update.certificate")              // [global app team pool]
+	PermAppUpdateCertificateAcme         = PermissionRegistry.get("app.update.certificate.acme")         // [global app team pool]
+	PermAppUpdateCertificateSet          = PermissionRegistry.get("app.update.certificate.set")          // [global app team pool]
+	PermAppUpdateCertificateUnset        = PermissionRegistry.get("app.update.certificate.unset")        // [global app team pool]
 	PermAppUpdateCname                   = PermissionRegistry.get("app.update.cname")                    // [global app team pool]
 	PermAppUpdateCnameAdd                = PermissionRegistry.get("app.update.cname.add")                // [global app team pool]
 	PermAppUpdateCnameRemove             = PermissionRegistry.get("app.update.cname.remove")             // [global app team pool]
@@ -43,10 +59,19 @@ var (
 	PermAppUpdateEvents                  = PermissionRegistry.get("app.update.events")                   // [global app team pool]
 	PermAppUpdateGrant                   = PermissionRegistry.get("app.update.grant")                    // [global app team pool]
 	PermAppUpdateLog                     = PermissionRegistry.get("app.update.log")                      // [global app team pool]
+	PermAppUpdateMaintenance             = PermissionRegistry.get("app.update.maintenance")              // [global app team pool]
+	PermAppUpdateMaintenanceSet          = PermissionRegistry.get("app.update.maintenance.set")          // [global app team pool]
+	PermAppUpdateMaintenanceUnset        = PermissionRegistry.get("app.update.maintenance.unset")        // [global app team pool]
+	PermAppUpdateMount                   = PermissionRegistry.get("app.update.mount")                    // [global app team pool]
+	PermAppUpdateMountAdd                = PermissionRegistry.get("app.update.mount.add")                // [global app team pool]
+	PermAppUpdateMountRemove             = PermissionRegistry.get("app.update.mount.remove")             // [global app team pool]
 	PermAppUpdatePlan                    = PermissionRegistry.get("app.update.plan")                     // [global app team pool]
 	PermAppUpdatePool                    = PermissionRegistry.get("app.update.pool")                     // [global app team pool]
 	PermAppUpdateRestart                 = PermissionRegistry.get("app.update.restart")                  // [global app team pool]
 	PermAppUpdateRevoke                  = PermissionRegistry.get("app.update.revoke")                   // [global app team pool]
+	PermAppUpdateRouter                  = PermissionRegistry.get("app.update.router")                   // [global app team pool]
+	PermAppUpdateRouterAdd               = PermissionRegistry.get("app.update.router.add")               // [global app team pool]
+	PermAppUpdateRouterRemove            = PermissionRegistry.get("app.update.router.remove")            // [global app team pool]
 	PermAppUpdateSleep                   = PermissionRegistry.get("app.update.sleep")                    // [global app team pool]
 	PermAppUpdateStart                   = PermissionRegistry.get("app.update.start")                    // [global app team pool]
 	PermAppUpdateStop                    = PermissionRegistry.get("app.update.stop")                     // [global app team pool]
@@ -101,6 +126,7 @@ var (
 	PermPoolUpdate                       = PermissionRegistry.get("pool.update")                         // [global pool]
 	PermPoolUpdateEvents                 = PermissionRegistry.get("pool.update.events")                  // [global pool]
 	PermPoolUpdateLogs                   = PermissionRegistry.get("pool.update.logs")                    // [global pool]
+	PermPoolUpdateScheduler              = PermissionRegistry.get("pool.update.scheduler")               // [global pool]
 	PermPoolUpdateTeam                   = PermissionRegistry.get("pool.update.team")                    // [global pool]
 	PermPoolUpdateTeamAdd                = PermissionRegistry.get("pool.update.team.add")                // [global pool]
 	PermPoolUpdateTeamRemove             = PermissionRegistry.get("pool.update.team.remove")             // [global pool]
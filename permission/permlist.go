@@ -30,6 +30,19 @@ var PermissionRegistry = (&registry{}).addWithCtx(
 	"app.update.teamowner",
 	"app.update.cname.add",
 	"app.update.cname.remove",
+	"app.update.certificate.set",
+	"app.update.certificate.unset",
+	"app.update.certificate.acme",
+	"app.update.router.add",
+	"app.update.router.remove",
+	"app.update.mount.add",
+	"app.update.mount.remove",
+	"app.update.access-policy.set",
+	"app.update.access-policy.unset",
+	"app.update.maintenance.set",
+	"app.update.maintenance.unset",
+	"app.update.auto-sleep.set",
+	"app.update.auto-sleep.unset",
 	"app.update.plan",
 	"app.update.bind",
 	"app.update.events",
@@ -39,9 +52,15 @@ var PermissionRegistry = (&registry{}).addWithCtx(
 	"app.deploy.build",
 	"app.deploy.git",
 	"app.deploy.image",
+	"app.deploy.promote",
 	"app.deploy.rollback",
 	"app.deploy.upload",
 	"app.read",
+	"app.read.certificate",
+	"app.read.router",
+	"app.read.mount",
+	"app.read.access-policy",
+	"app.read.auto-sleep",
 	"app.read.deploy",
 	"app.read.env",
 	"app.read.events",
@@ -149,6 +168,7 @@ var PermissionRegistry = (&registry{}).addWithCtx(
 	"pool.update.team.remove",
 	"pool.update.events",
 	"pool.update.logs",
+	"pool.update.scheduler",
 	"pool.delete",
 ).add(
 	"debug",
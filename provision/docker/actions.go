@@ -20,7 +20,6 @@ import (
 	"github.com/tsuru/tsuru/log"
 	"github.com/tsuru/tsuru/provision"
 	"github.com/tsuru/tsuru/provision/docker/container"
-	"github.com/tsuru/tsuru/router"
 	"gopkg.in/mgo.v2/bson"
 )
 
@@ -433,7 +432,7 @@ var addNewRoutes = action.Action{
 			log.Errorf("[WARNING] cannot get the name of the web process: %s", err)
 		}
 		newContainers := ctx.Previous.([]container.Container)
-		r, err := getRouterForApp(args.app)
+		routers, err := getRoutersForApp(args.app)
 		if err != nil {
 			return nil, err
 		}
@@ -457,10 +456,14 @@ var addNewRoutes = action.Action{
 		if len(routesToAdd) == 0 {
 			return newContainers, nil
 		}
-		err = r.AddRoutes(args.app.GetName(), routesToAdd)
-		if err != nil {
-			r.RemoveRoutes(args.app.GetName(), routesToAdd)
-			return nil, err
+		for i, r := range routers {
+			err = r.AddRoutes(args.app.GetName(), routesToAdd)
+			if err != nil {
+				for _, added := range routers[:i+1] {
+					added.RemoveRoutes(args.app.GetName(), routesToAdd)
+				}
+				return nil, err
+			}
 		}
 		for _, c := range newContainers {
 			if c.Routable {
@@ -472,9 +475,10 @@ var addNewRoutes = action.Action{
 	Backward: func(ctx action.BWContext) {
 		args := ctx.Params[0].(changeUnitsPipelineArgs)
 		newContainers := ctx.FWResult.([]container.Container)
-		r, err := getRouterForApp(args.app)
+		routers, err := getRoutersForApp(args.app)
 		if err != nil {
-			log.Errorf("[add-new-routes:Backward] Error geting router: %s", err.Error())
+			log.Errorf("[add-new-routes:Backward] Error geting routers: %s", err.Error())
+			return
 		}
 		w := args.writer
 		if w == nil {
@@ -490,10 +494,12 @@ var addNewRoutes = action.Action{
 		if len(routesToRemove) == 0 {
 			return
 		}
-		err = r.RemoveRoutes(args.app.GetName(), routesToRemove)
-		if err != nil {
-			log.Errorf("[add-new-routes:Backward] Error removing route for [%v]: %s", routesToRemove, err.Error())
-			return
+		for _, r := range routers {
+			err = r.RemoveRoutes(args.app.GetName(), routesToRemove)
+			if err != nil {
+				log.Errorf("[add-new-routes:Backward] Error removing route for [%v]: %s", routesToRemove, err.Error())
+				return
+			}
 		}
 		for _, c := range newContainers {
 			if c.Routable {
@@ -513,12 +519,11 @@ var setRouterHealthcheck = action.Action{
 			return nil, err
 		}
 		newContainers := ctx.Previous.([]container.Container)
-		r, err := getRouterForApp(args.app)
+		hcRouters, err := healthcheckRoutersForApp(args.app)
 		if err != nil {
 			return nil, err
 		}
-		hcRouter, ok := r.(router.CustomHealthcheckRouter)
-		if !ok {
+		if len(hcRouters) == 0 {
 			return newContainers, nil
 		}
 		yamlData, err := getImageTsuruYamlData(args.imageId)
@@ -538,18 +543,22 @@ var setRouterHealthcheck = action.Action{
 			msg = fmt.Sprintf("%s, Body: %s", msg, hcData.Body)
 		}
 		fmt.Fprintf(writer, "\n---- Setting router healthcheck (%s) ----\n", msg)
-		err = hcRouter.SetHealthcheck(args.app.GetName(), hcData)
-		return newContainers, err
+		for _, hcRouter := range hcRouters {
+			err = hcRouter.SetHealthcheck(args.app.GetName(), hcData)
+			if err != nil {
+				return nil, err
+			}
+		}
+		return newContainers, nil
 	},
 	Backward: func(ctx action.BWContext) {
 		args := ctx.Params[0].(changeUnitsPipelineArgs)
-		r, err := getRouterForApp(args.app)
+		hcRouters, err := healthcheckRoutersForApp(args.app)
 		if err != nil {
-			log.Errorf("[set-router-healthcheck:Backward] Error getting router: %s", err.Error())
+			log.Errorf("[set-router-healthcheck:Backward] Error getting routers: %s", err.Error())
 			return
 		}
-		hcRouter, ok := r.(router.CustomHealthcheckRouter)
-		if !ok {
+		if len(hcRouters) == 0 {
 			return
 		}
 		currentImageName, _ := appCurrentImageName(args.app.GetName())
@@ -558,9 +567,11 @@ var setRouterHealthcheck = action.Action{
 			log.Errorf("[set-router-healthcheck:Backward] Error getting yaml data: %s", err.Error())
 		}
 		hcData := yamlData.Healthcheck.ToRouterHC()
-		err = hcRouter.SetHealthcheck(args.app.GetName(), hcData)
-		if err != nil {
-			log.Errorf("[set-router-healthcheck:Backward] Error setting healthcheck: %s", err.Error())
+		for _, hcRouter := range hcRouters {
+			err = hcRouter.SetHealthcheck(args.app.GetName(), hcData)
+			if err != nil {
+				log.Errorf("[set-router-healthcheck:Backward] Error setting healthcheck: %s", err.Error())
+			}
 		}
 	},
 }
@@ -581,7 +592,7 @@ var removeOldRoutes = action.Action{
 				err = nil
 			}()
 		}
-		r, err := getRouterForApp(args.app)
+		routers, err := getRoutersForApp(args.app)
 		if err != nil {
 			return
 		}
@@ -613,12 +624,16 @@ var removeOldRoutes = action.Action{
 		if len(routesToRemove) == 0 {
 			return
 		}
-		err = r.RemoveRoutes(args.app.GetName(), routesToRemove)
-		if err != nil {
-			if !args.appDestroy {
-				r.AddRoutes(args.app.GetName(), routesToRemove)
+		for i, r := range routers {
+			err = r.RemoveRoutes(args.app.GetName(), routesToRemove)
+			if err != nil {
+				if !args.appDestroy {
+					for _, removed := range routers[:i+1] {
+						removed.AddRoutes(args.app.GetName(), routesToRemove)
+					}
+				}
+				return
 			}
-			return
 		}
 		for _, c := range args.toRemove {
 			if c.Routable {
@@ -629,9 +644,10 @@ var removeOldRoutes = action.Action{
 	},
 	Backward: func(ctx action.BWContext) {
 		args := ctx.Params[0].(changeUnitsPipelineArgs)
-		r, err := getRouterForApp(args.app)
+		routers, err := getRoutersForApp(args.app)
 		if err != nil {
-			log.Errorf("[remove-old-routes:Backward] Error geting router: %s", err.Error())
+			log.Errorf("[remove-old-routes:Backward] Error geting routers: %s", err.Error())
+			return
 		}
 		w := args.writer
 		if w == nil {
@@ -647,10 +663,12 @@ var removeOldRoutes = action.Action{
 		if len(routesToAdd) == 0 {
 			return
 		}
-		err = r.AddRoutes(args.app.GetName(), routesToAdd)
-		if err != nil {
-			log.Errorf("[remove-old-routes:Backward] Error adding back route for [%v]: %s", routesToAdd, err.Error())
-			return
+		for _, r := range routers {
+			err = r.AddRoutes(args.app.GetName(), routesToAdd)
+			if err != nil {
+				log.Errorf("[remove-old-routes:Backward] Error adding back route for [%v]: %s", routesToAdd, err.Error())
+				return
+			}
 		}
 		for _, c := range args.toRemove {
 			if c.Routable {
@@ -0,0 +1,266 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package docker
+
+import (
+	"fmt"
+	"io/ioutil"
+	"time"
+
+	"github.com/tsuru/config"
+	"github.com/tsuru/tsuru/app"
+	"github.com/tsuru/tsuru/event"
+	"github.com/tsuru/tsuru/log"
+	"github.com/tsuru/tsuru/permission"
+	"github.com/tsuru/tsuru/provision"
+	"github.com/tsuru/tsuru/provision/docker/container"
+	"gopkg.in/mgo.v2/bson"
+)
+
+const autoRollbackOwner = "auto-rollback"
+
+// autoRollbackConfig holds the thresholds used while watching an app after a
+// deploy. A negative threshold disables the related check.
+type autoRollbackConfig struct {
+	WatchPeriod            time.Duration
+	CheckInterval          time.Duration
+	MaxRestarts            int
+	MaxHealings            int
+	MaxErrorUnits          int
+	MaxHealthcheckFailures int
+}
+
+func getAutoRollbackConfig() *autoRollbackConfig {
+	watchPeriod, _ := config.GetInt("docker:auto-rollback:watch-period")
+	if watchPeriod <= 0 {
+		return nil
+	}
+	checkInterval, err := config.GetInt("docker:auto-rollback:check-interval")
+	if err != nil || checkInterval <= 0 {
+		checkInterval = 10
+	}
+	intOrDefault := func(key string, defaultValue int) int {
+		value, err := config.GetInt(key)
+		if err != nil {
+			return defaultValue
+		}
+		return value
+	}
+	return &autoRollbackConfig{
+		WatchPeriod:            time.Duration(watchPeriod) * time.Second,
+		CheckInterval:          time.Duration(checkInterval) * time.Second,
+		MaxRestarts:            intOrDefault("docker:auto-rollback:max-restarts", 3),
+		MaxHealings:            intOrDefault("docker:auto-rollback:max-healings", 1),
+		MaxErrorUnits:          intOrDefault("docker:auto-rollback:max-error-units", 1),
+		MaxHealthcheckFailures: intOrDefault("docker:auto-rollback:max-healthcheck-failures", 3),
+	}
+}
+
+// deployWatcher watches the units of an app for a while after a deploy,
+// rolling back to the previous image if the new one is unhealthy.
+type deployWatcher struct {
+	provisioner         *dockerProvisioner
+	config              autoRollbackConfig
+	appName             string
+	image               string
+	previousImage       string
+	deployID            bson.ObjectId
+	startTime           time.Time
+	initialRestarts     map[string]int
+	healthcheckFailures int
+}
+
+func (p *dockerProvisioner) newDeployWatcher(a provision.App, imageId string, evt *event.Event) *deployWatcher {
+	cfg := getAutoRollbackConfig()
+	if cfg == nil || evt == nil {
+		return nil
+	}
+	images, err := listValidAppImages(a.GetName())
+	if err != nil {
+		log.Errorf("[auto-rollback] unable to list images for app %q: %s", a.GetName(), err)
+		return nil
+	}
+	var previousImage string
+	for i, img := range images {
+		if img == imageId && i > 0 {
+			previousImage = images[i-1]
+		}
+	}
+	if previousImage == "" {
+		return nil
+	}
+	return &deployWatcher{
+		provisioner:     p,
+		config:          *cfg,
+		appName:         a.GetName(),
+		image:           imageId,
+		previousImage:   previousImage,
+		deployID:        evt.UniqueID,
+		startTime:       time.Now().UTC(),
+		initialRestarts: map[string]int{},
+	}
+}
+
+func (w *deployWatcher) run() {
+	deadline := w.startTime.Add(w.config.WatchPeriod)
+	for time.Now().Before(deadline) {
+		time.Sleep(w.config.CheckInterval)
+		reason, err := w.check()
+		if err != nil {
+			log.Errorf("[auto-rollback] error watching deploy of app %q: %s", w.appName, err)
+			continue
+		}
+		if w.superseded() {
+			return
+		}
+		if reason != "" {
+			err = w.rollback(reason)
+			if err != nil {
+				log.Errorf("[auto-rollback] unable to rollback app %q: %s", w.appName, err)
+			}
+			return
+		}
+	}
+}
+
+// superseded reports whether the app is no longer running the watched image,
+// which happens when a new deploy is done during the watch period.
+func (w *deployWatcher) superseded() bool {
+	current, err := appCurrentImageName(w.appName)
+	return err == nil && current != w.image
+}
+
+// check returns a non empty reason when the deployed units crossed any of
+// the configured thresholds.
+func (w *deployWatcher) check() (string, error) {
+	containers, err := w.provisioner.ListContainers(bson.M{"appname": w.appName, "image": w.image})
+	if err != nil {
+		return "", err
+	}
+	if w.config.MaxErrorUnits >= 0 {
+		var errorUnits int
+		for _, c := range containers {
+			if c.Status == provision.StatusError.String() {
+				errorUnits++
+			}
+		}
+		if errorUnits > w.config.MaxErrorUnits {
+			return fmt.Sprintf("%d units in error state", errorUnits), nil
+		}
+	}
+	if w.config.MaxRestarts >= 0 {
+		restarts := w.restarts(containers)
+		if restarts > w.config.MaxRestarts {
+			return fmt.Sprintf("%d unit restarts since deploy", restarts), nil
+		}
+	}
+	if w.config.MaxHealings >= 0 {
+		healings, err := w.healings()
+		if err != nil {
+			return "", err
+		}
+		if healings > w.config.MaxHealings {
+			return fmt.Sprintf("%d units healed since deploy", healings), nil
+		}
+	}
+	if w.config.MaxHealthcheckFailures >= 0 {
+		w.healthcheckFailures += w.failedHealthchecks(containers)
+		if w.healthcheckFailures > w.config.MaxHealthcheckFailures {
+			return fmt.Sprintf("%d healthcheck failures since deploy", w.healthcheckFailures), nil
+		}
+	}
+	return "", nil
+}
+
+func (w *deployWatcher) restarts(containers []container.Container) int {
+	var total int
+	for _, c := range containers {
+		dockerCont, err := w.provisioner.Cluster().InspectContainer(c.ID)
+		if err != nil {
+			continue
+		}
+		initial, ok := w.initialRestarts[c.ID]
+		if !ok {
+			initial = dockerCont.RestartCount
+			w.initialRestarts[c.ID] = initial
+		}
+		total += dockerCont.RestartCount - initial
+	}
+	return total
+}
+
+func (w *deployWatcher) healings() (int, error) {
+	evts, err := event.List(&event.Filter{
+		Target:   event.Target{Type: event.TargetTypeContainer},
+		KindType: event.KindTypeInternal,
+		KindName: "healer",
+		Since:    w.startTime,
+		Raw:      bson.M{"startcustomdata.appname": w.appName},
+	})
+	if err != nil {
+		return 0, err
+	}
+	return len(evts), nil
+}
+
+func (w *deployWatcher) failedHealthchecks(containers []container.Container) int {
+	var failures int
+	for i := range containers {
+		c := &containers[i]
+		if c.HostPort == "" || !c.Available() {
+			continue
+		}
+		probe, err := newHealthcheckProbe(c)
+		if err != nil || probe == nil {
+			continue
+		}
+		if _, err = probe.check(c); err != nil {
+			failures++
+		}
+	}
+	return failures
+}
+
+func (w *deployWatcher) rollback(reason string) (err error) {
+	a, err := app.GetByName(w.appName)
+	if err != nil {
+		return err
+	}
+	opts := app.DeployOptions{
+		App:          a,
+		Image:        w.previousImage,
+		User:         autoRollbackOwner,
+		Origin:       "rollback",
+		Rollback:     true,
+		Message:      fmt.Sprintf("automatic rollback of %s: %s", w.image, reason),
+		OutputStream: ioutil.Discard,
+	}
+	opts.GetKind()
+	evt, err := event.New(&event.Opts{
+		Target:     event.Target{Type: event.TargetTypeApp, Value: w.appName},
+		Kind:       permission.PermAppDeploy,
+		RawOwner:   event.Owner{Type: event.OwnerTypeInternal, Name: autoRollbackOwner},
+		CustomData: opts,
+	})
+	if err != nil {
+		return err
+	}
+	var imageID string
+	defer func() { evt.DoneCustomData(err, map[string]string{"image": imageID}) }()
+	evt.Logf("---- Rolling back to %s: %s ----", w.previousImage, reason)
+	opts.Event = evt
+	imageID, err = app.Deploy(opts)
+	if err != nil {
+		return err
+	}
+	deployEvt, markErr := event.GetByID(w.deployID)
+	if markErr == nil {
+		markErr = deployEvt.SetOtherCustomDataField("auto-rollback", reason)
+	}
+	if markErr != nil {
+		log.Errorf("[auto-rollback] unable to mark deploy %s of app %q as rolled back: %s", w.deployID.Hex(), w.appName, markErr)
+	}
+	return nil
+}
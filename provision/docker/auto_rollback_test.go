@@ -0,0 +1,149 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package docker
+
+import (
+	"time"
+
+	"github.com/tsuru/config"
+	"github.com/tsuru/tsuru/app"
+	"github.com/tsuru/tsuru/event"
+	"github.com/tsuru/tsuru/permission"
+	"github.com/tsuru/tsuru/provision"
+	"github.com/tsuru/tsuru/provision/docker/container"
+	"github.com/tsuru/tsuru/quota"
+	"gopkg.in/check.v1"
+)
+
+func (s *S) TestGetAutoRollbackConfigDisabled(c *check.C) {
+	c.Assert(getAutoRollbackConfig(), check.IsNil)
+}
+
+func (s *S) TestGetAutoRollbackConfig(c *check.C) {
+	config.Set("docker:auto-rollback:watch-period", 300)
+	config.Set("docker:auto-rollback:max-healings", -1)
+	defer config.Unset("docker:auto-rollback")
+	c.Assert(getAutoRollbackConfig(), check.DeepEquals, &autoRollbackConfig{
+		WatchPeriod:            5 * time.Minute,
+		CheckInterval:          10 * time.Second,
+		MaxRestarts:            3,
+		MaxHealings:            -1,
+		MaxErrorUnits:          1,
+		MaxHealthcheckFailures: 3,
+	})
+}
+
+func (s *S) TestNewDeployWatcher(c *check.C) {
+	config.Set("docker:auto-rollback:watch-period", 300)
+	defer config.Unset("docker:auto-rollback")
+	a := &app.App{Name: "myapp"}
+	evt, err := event.New(&event.Opts{
+		Target: event.Target{Type: event.TargetTypeApp, Value: a.Name},
+		Kind:   permission.PermAppDeploy,
+		Owner:  s.token,
+	})
+	c.Assert(err, check.IsNil)
+	defer evt.Done(nil)
+	err = appendAppImageName(a.Name, "tsuru/app-myapp:v1")
+	c.Assert(err, check.IsNil)
+	c.Assert(s.p.newDeployWatcher(a, "tsuru/app-myapp:v1", evt), check.IsNil)
+	err = appendAppImageName(a.Name, "tsuru/app-myapp:v2")
+	c.Assert(err, check.IsNil)
+	watcher := s.p.newDeployWatcher(a, "tsuru/app-myapp:v2", evt)
+	c.Assert(watcher, check.NotNil)
+	c.Assert(watcher.previousImage, check.Equals, "tsuru/app-myapp:v1")
+	c.Assert(watcher.deployID, check.Equals, evt.UniqueID)
+}
+
+func (s *S) TestDeployWatcherCheckErrorUnits(c *check.C) {
+	cont1, err := s.newContainer(&newContainerOpts{AppName: "myapp", Image: "tsuru/app-myapp:v2", Status: provision.StatusError.String()}, nil)
+	c.Assert(err, check.IsNil)
+	defer s.removeTestContainer(cont1)
+	watcher := &deployWatcher{
+		provisioner:     s.p,
+		config:          autoRollbackConfig{MaxErrorUnits: 1, MaxRestarts: -1, MaxHealings: -1, MaxHealthcheckFailures: -1},
+		appName:         "myapp",
+		image:           "tsuru/app-myapp:v2",
+		initialRestarts: map[string]int{},
+	}
+	reason, err := watcher.check()
+	c.Assert(err, check.IsNil)
+	c.Assert(reason, check.Equals, "")
+	cont2, err := s.newContainer(&newContainerOpts{AppName: "myapp", Image: "tsuru/app-myapp:v2", Status: provision.StatusError.String()}, nil)
+	c.Assert(err, check.IsNil)
+	defer s.removeTestContainer(cont2)
+	reason, err = watcher.check()
+	c.Assert(err, check.IsNil)
+	c.Assert(reason, check.Equals, "2 units in error state")
+}
+
+func (s *S) TestDeployWatcherCheckHealings(c *check.C) {
+	watcher := &deployWatcher{
+		provisioner:     s.p,
+		config:          autoRollbackConfig{MaxErrorUnits: -1, MaxRestarts: -1, MaxHealings: 0, MaxHealthcheckFailures: -1},
+		appName:         "myapp",
+		image:           "tsuru/app-myapp:v2",
+		startTime:       time.Now().UTC().Add(-time.Minute),
+		initialRestarts: map[string]int{},
+	}
+	evt, err := event.NewInternal(&event.Opts{
+		Target:       event.Target{Type: event.TargetTypeContainer, Value: "c1"},
+		InternalKind: "healer",
+		CustomData:   container.Container{ID: "c1", AppName: "myapp"},
+	})
+	c.Assert(err, check.IsNil)
+	err = evt.Done(nil)
+	c.Assert(err, check.IsNil)
+	reason, err := watcher.check()
+	c.Assert(err, check.IsNil)
+	c.Assert(reason, check.Equals, "1 units healed since deploy")
+}
+
+func (s *S) TestDeployWatcherRollback(c *check.C) {
+	err := s.newFakeImage(s.p, "tsuru/app-myapp:v1", nil)
+	c.Assert(err, check.IsNil)
+	err = appendAppImageName("myapp", "tsuru/app-myapp:v1")
+	c.Assert(err, check.IsNil)
+	a := app.App{Name: "myapp", Platform: "python", Quota: quota.Unlimited}
+	err = s.storage.Apps().Insert(a)
+	c.Assert(err, check.IsNil)
+	s.p.Provision(&a)
+	defer s.p.Destroy(&a)
+	deployEvt, err := event.New(&event.Opts{
+		Target: event.Target{Type: event.TargetTypeApp, Value: a.Name},
+		Kind:   permission.PermAppDeploy,
+		Owner:  s.token,
+	})
+	c.Assert(err, check.IsNil)
+	err = deployEvt.Done(nil)
+	c.Assert(err, check.IsNil)
+	watcher := &deployWatcher{
+		provisioner:   s.p,
+		appName:       a.Name,
+		image:         "tsuru/app-myapp:v2",
+		previousImage: "tsuru/app-myapp:v1",
+		deployID:      deployEvt.UniqueID,
+	}
+	err = watcher.rollback("2 units in error state")
+	c.Assert(err, check.IsNil)
+	units, err := a.Units()
+	c.Assert(err, check.IsNil)
+	c.Assert(units, check.HasLen, 1)
+	deployEvt, err = event.GetByID(deployEvt.UniqueID)
+	c.Assert(err, check.IsNil)
+	var otherData map[string]string
+	err = deployEvt.OtherData(&otherData)
+	c.Assert(err, check.IsNil)
+	c.Assert(otherData["auto-rollback"], check.Equals, "2 units in error state")
+	evts, err := event.List(&event.Filter{
+		Target:    event.Target{Type: event.TargetTypeApp, Value: a.Name},
+		OwnerType: event.OwnerTypeInternal,
+		KindName:  permission.PermAppDeploy.FullName(),
+	})
+	c.Assert(err, check.IsNil)
+	c.Assert(evts, check.HasLen, 1)
+	c.Assert(evts[0].Owner.Name, check.Equals, autoRollbackOwner)
+	c.Assert(evts[0].Error, check.Equals, "")
+}
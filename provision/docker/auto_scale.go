@@ -23,6 +23,7 @@ import (
 	"github.com/tsuru/tsuru/net"
 	"github.com/tsuru/tsuru/provision/docker/container"
 	"github.com/tsuru/tsuru/provision/docker/nodecontainer"
+	"github.com/tsuru/tsuru/provision/docker/nodestate"
 	"github.com/tsuru/tsuru/queue"
 	"github.com/tsuru/tsuru/safe"
 	"gopkg.in/mgo.v2"
@@ -45,10 +46,13 @@ type autoScaleConfig struct {
 	WaitTimeNewMachine  time.Duration
 	RunInterval         time.Duration
 	TotalMemoryMetadata string
+	TotalCpuMetadata    string
 	Enabled             bool
 	provisioner         *dockerProvisioner
 	done                chan bool
 	writer              io.Writer
+	dryRun              bool
+	simulations         []autoScaleSimulation
 }
 
 type scalerResult struct {
@@ -85,6 +89,9 @@ func (a *autoScaleConfig) initialize() {
 	if a.TotalMemoryMetadata == "" {
 		a.TotalMemoryMetadata, _ = config.GetString("docker:scheduler:total-memory-metadata")
 	}
+	if a.TotalCpuMetadata == "" {
+		a.TotalCpuMetadata, _ = config.GetString("docker:scheduler:total-cpu-metadata")
+	}
 	if a.RunInterval == 0 {
 		a.RunInterval = time.Hour
 	}
@@ -97,6 +104,9 @@ func (a *autoScaleConfig) scalerForRule(rule *autoScaleRule) (autoScaler, error)
 	if rule.MaxContainerCount > 0 {
 		return &countScaler{autoScaleConfig: a, rule: rule}, nil
 	}
+	if rule.cpuBased() {
+		return &cpuScaler{autoScaleConfig: a, rule: rule}, nil
+	}
 	return &memoryScaler{autoScaleConfig: a, rule: rule}, nil
 }
 
@@ -166,6 +176,10 @@ func (a *autoScaleConfig) runScaler() (retErr error) {
 			a.logDebug("skipped node %s, no metadata value for %s.", node.Address, poolMetadataName)
 			continue
 		}
+		if state := nodestate.Get(node); state != "" {
+			a.logDebug("skipped node %s, node is %s.", node.Address, state)
+			continue
+		}
 		clusterMap[pool] = append(clusterMap[pool], node)
 	}
 	for pool, nodes := range clusterMap {
@@ -175,42 +189,79 @@ func (a *autoScaleConfig) runScaler() (retErr error) {
 }
 
 type evtCustomData struct {
-	Result *scalerResult
-	Nodes  []cluster.Node
-	Rule   *autoScaleRule
+	Result   *scalerResult
+	Nodes    []cluster.Node
+	Rule     *autoScaleRule
+	Schedule string `json:",omitempty" bson:",omitempty"`
 }
 
+// runScalerInNodes runs the scaler for a pool, locking the pool with an
+// event. Simulations don't create events, so that they neither block nor show
+// up along with the actual runs, their log is kept in the simulation.
 func (a *autoScaleConfig) runScalerInNodes(pool string, nodes []*cluster.Node) {
-	evt, err := event.NewInternal(&event.Opts{
-		Target:       event.Target{Type: event.TargetTypePool, Value: pool},
-		InternalKind: autoScaleEventKind,
-	})
-	if err != nil {
-		if _, ok := err.(event.ErrEventLocked); ok {
-			a.logDebug("skipping already running for: %s", pool)
-		} else {
-			a.logError("error creating scale event %s: %s", pool, err.Error())
+	var evt *event.Event
+	var logger scaleLogger
+	var simulationLog *safe.Buffer
+	var err error
+	if a.dryRun {
+		simulationLog = safe.NewBuffer(nil)
+		logger = &writerLogger{w: simulationLog}
+	} else {
+		evt, err = event.NewInternal(&event.Opts{
+			Target:       event.Target{Type: event.TargetTypePool, Value: pool},
+			InternalKind: autoScaleEventKind,
+		})
+		if err != nil {
+			if _, ok := err.(event.ErrEventLocked); ok {
+				a.logDebug("skipping already running for: %s", pool)
+			} else {
+				a.logError("error creating scale event %s: %s", pool, err.Error())
+			}
+			return
 		}
-		return
+		evt.SetLogWriter(a.writer)
+		logger = evt
 	}
-	evt.SetLogWriter(a.writer)
 	var retErr error
 	var sResult *scalerResult
 	var evtNodes []cluster.Node
 	var rule *autoScaleRule
+	var limits *scheduleLimits
+	var moves []rebalanceMove
 	defer func() {
 		if retErr != nil {
-			evt.Logf(retErr.Error())
+			logger.Logf(retErr.Error())
+		}
+		if a.dryRun {
+			simulation := autoScaleSimulation{
+				Pool:   pool,
+				Rule:   rule,
+				Result: sResult,
+				Moves:  moves,
+				Log:    simulationLog.String(),
+			}
+			if limits != nil {
+				simulation.Schedule = limits.schedule
+			}
+			if retErr != nil {
+				simulation.Error = retErr.Error()
+			}
+			a.simulations = append(a.simulations, simulation)
+			return
 		}
 		if (sResult == nil && retErr == nil) || (sResult != nil && sResult.NoAction()) {
-			evt.Logf("nothing to do for %q: %q", poolMetadataName, pool)
+			logger.Logf("nothing to do for %q: %q", poolMetadataName, pool)
 			evt.Abort()
 		} else {
-			evt.DoneCustomData(retErr, evtCustomData{
+			customData := evtCustomData{
 				Result: sResult,
 				Nodes:  evtNodes,
 				Rule:   rule,
-			})
+			}
+			if limits != nil {
+				customData.Schedule = limits.schedule
+			}
+			evt.DoneCustomData(retErr, customData)
 		}
 	}()
 	rule, err = autoScaleRuleForMetadata(pool)
@@ -222,40 +273,62 @@ func (a *autoScaleConfig) runScalerInNodes(pool string, nodes []*cluster.Node) {
 			retErr = fmt.Errorf("unable to fetch auto scale rules for %s: %s", pool, err)
 			return
 		}
-		evt.Logf("no auto scale rule for %s", pool)
+		logger.Logf("no auto scale rule for %s", pool)
 		return
 	}
 	if !rule.Enabled {
-		evt.Logf("auto scale rule disabled for %s", pool)
+		logger.Logf("auto scale rule disabled for %s", pool)
 		return
 	}
-	scaler, err := a.scalerForRule(rule)
+	limits, err = activeScheduleLimits(pool, autoScaleNow())
 	if err != nil {
-		retErr = fmt.Errorf("error getting scaler for %s: %s", pool, err)
+		retErr = fmt.Errorf("unable to fetch auto scale schedules for %s: %s", pool, err)
 		return
 	}
-	evt.Logf("running scaler %T for %q: %q", scaler, poolMetadataName, pool)
-	sResult, err = scaler.scale(pool, nodes)
+	sResult, err = limits.enforce(a.provisioner, nodes)
 	if err != nil {
-		if _, ok := err.(errAppNotLocked); ok {
-			evt.Logf("aborting scaler for now, gonna retry later: %s", err)
+		retErr = fmt.Errorf("error enforcing schedules for %s: %s", pool, err)
+		return
+	}
+	if sResult != nil {
+		logger.Logf("enforcing schedule %q for %q: %q", limits.schedule, poolMetadataName, pool)
+	} else {
+		scaler, err := a.scalerForRule(rule)
+		if err != nil {
+			retErr = fmt.Errorf("error getting scaler for %s: %s", pool, err)
+			return
+		}
+		logger.Logf("running scaler %T for %q: %q", scaler, poolMetadataName, pool)
+		sResult, err = scaler.scale(pool, nodes)
+		if err != nil {
+			if _, ok := err.(errAppNotLocked); ok {
+				logger.Logf("aborting scaler for now, gonna retry later: %s", err)
+				return
+			}
+			retErr = fmt.Errorf("error scaling group %s: %s", pool, err.Error())
 			return
 		}
-		retErr = fmt.Errorf("error scaling group %s: %s", pool, err.Error())
+		limits.clamp(nodes, sResult)
+	}
+	if a.dryRun {
+		logger.Logf("simulating scale for %q: %#v", pool, sResult)
+		if !rule.PreventRebalance {
+			moves, retErr = a.simulateRebalance(nodes, sResult)
+		}
 		return
 	}
 	if sResult.ToAdd > 0 {
-		evt.Logf("running event \"add\" for %q: %#v", pool, sResult)
+		logger.Logf("running event \"add\" for %q: %#v", pool, sResult)
 		evtNodes, err = a.addMultipleNodes(evt, nodes, sResult.ToAdd)
 		if err != nil {
 			if len(evtNodes) == 0 {
 				retErr = err
 				return
 			}
-			evt.Logf("not all required nodes were created: %s", err)
+			logger.Logf("not all required nodes were created: %s", err)
 		}
 	} else if len(sResult.ToRemove) > 0 {
-		evt.Logf("running event \"remove\" for %q: %#v", pool, sResult)
+		logger.Logf("running event \"remove\" for %q: %#v", pool, sResult)
 		evtNodes = sResult.ToRemove
 		err = a.removeMultipleNodes(evt, sResult.ToRemove)
 		if err != nil {
@@ -269,12 +342,26 @@ func (a *autoScaleConfig) runScalerInNodes(pool string, nodes []*cluster.Node) {
 			if sResult.IsRebalanceOnly() {
 				retErr = err
 			} else {
-				evt.Logf("unable to rebalance: %s", err.Error())
+				logger.Logf("unable to rebalance: %s", err.Error())
 			}
 		}
 	}
 }
 
+// scaleLogger receives the progress of a scaler run.
+type scaleLogger interface {
+	Logf(format string, params ...interface{})
+}
+
+// writerLogger is a scaleLogger writing each message as a line in w.
+type writerLogger struct {
+	w io.Writer
+}
+
+func (l *writerLogger) Logf(format string, params ...interface{}) {
+	fmt.Fprintf(l.w, format+"\n", params...)
+}
+
 func (a *autoScaleConfig) rebalanceIfNeeded(evt *event.Event, pool string, nodes []*cluster.Node, sResult *scalerResult) error {
 	if len(sResult.ToRemove) > 0 {
 		return nil
@@ -434,10 +521,24 @@ func (a *autoScaleConfig) removeMultipleNodes(evt *event.Event, chosenNodes []cl
 	return nil
 }
 
-func chooseNodeForRemoval(nodes []*cluster.Node, toRemoveCount int) []cluster.Node {
+// chooseNodeForRemoval returns up to toRemoveCount nodes that can be removed
+// without unbalancing metadata groups, preferring the nodes the scheduler
+// strategy of the pool would empty first.
+func (p *dockerProvisioner) chooseNodeForRemoval(nodes []*cluster.Node, toRemoveCount int) ([]cluster.Node, error) {
+	if len(nodes) == 0 {
+		return nil, nil
+	}
+	strategy, err := schedulerStrategyForPool(nodes[0].Metadata[poolMetadataName])
+	if err != nil {
+		return nil, err
+	}
+	candidates, err := strategy.removalOrder(p, nodes)
+	if err != nil {
+		return nil, err
+	}
 	var chosenNodes []cluster.Node
 	remainingNodes := nodes[:]
-	for _, node := range nodes {
+	for _, node := range candidates {
 		canRemove, _ := canRemoveNode(node, remainingNodes)
 		if canRemove {
 			for i := range remainingNodes {
@@ -452,7 +553,7 @@ func chooseNodeForRemoval(nodes []*cluster.Node, toRemoveCount int) []cluster.No
 			}
 		}
 	}
-	return chosenNodes
+	return chosenNodes, nil
 }
 
 func canRemoveNode(chosenNode *cluster.Node, nodes []*cluster.Node) (bool, error) {
@@ -489,7 +590,7 @@ func cleanMetadata(n *cluster.Node) map[string]string {
 	// iaas-id is ignored because it wasn't created in previous tsuru versions
 	// and having nodes with and without it would cause unbalanced metadata
 	// errors.
-	ignoredMetadata := []string{"iaas-id"}
+	ignoredMetadata := []string{"iaas-id", nodestate.MetadataKey}
 	metadata := n.CleanMetadata()
 	for _, val := range ignoredMetadata {
 		delete(metadata, val)
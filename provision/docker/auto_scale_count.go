@@ -25,7 +25,10 @@ func (a *countScaler) scale(groupMetadata string, nodes []*cluster.Node) (*scale
 	scaledMaxCount := int(float32(a.rule.MaxContainerCount) * a.rule.ScaleDownRatio)
 	if freeSlots > scaledMaxCount {
 		toRemoveCount := freeSlots / scaledMaxCount
-		chosenNodes := chooseNodeForRemoval(nodes, toRemoveCount)
+		chosenNodes, err := a.provisioner.chooseNodeForRemoval(nodes, toRemoveCount)
+		if err != nil {
+			return nil, err
+		}
 		if len(chosenNodes) == 0 {
 			a.logDebug("would remove any node but can't due to metadata restrictions")
 			return &scalerResult{}, nil
@@ -0,0 +1,137 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package docker
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/tsuru/config"
+	"github.com/tsuru/docker-cluster/cluster"
+	"github.com/tsuru/tsuru/app"
+	"github.com/tsuru/tsuru/provision/docker/healer"
+)
+
+// cpuMetricsMaxAge is the maximum age of the cpu usage reported by a node for
+// it to be considered by the cpu scaler.
+var cpuMetricsMaxAge = 5 * time.Minute
+
+type cpuScaler struct {
+	*autoScaleConfig
+	rule *autoScaleRule
+}
+
+type nodeCpuData struct {
+	node     *cluster.Node
+	cores    float64
+	reserved float64
+	used     float64
+}
+
+func cpuSharesPerCore() float64 {
+	shares, _ := config.GetFloat("docker:auto-scale:cpu-shares-per-core")
+	if shares <= 0 {
+		shares = 1024
+	}
+	return shares
+}
+
+// nodesCpuData returns, for each node, the number of cores it has and how
+// many of them are in use. Reserved cores are calculated from the cpu shares
+// in the plans of running containers, if the node reports a higher observed
+// usage, the observed value is used instead.
+func (a *cpuScaler) nodesCpuData(nodes []*cluster.Node) ([]nodeCpuData, error) {
+	containersMap, err := a.provisioner.runningContainersByNode(nodes)
+	if err != nil {
+		return nil, err
+	}
+	addresses := make([]string, len(nodes))
+	for i, node := range nodes {
+		addresses[i] = node.Address
+	}
+	metrics, err := healer.NodesMetrics(addresses, cpuMetricsMaxAge)
+	if err != nil {
+		return nil, err
+	}
+	sharesPerCore := cpuSharesPerCore()
+	plans := map[string]app.Plan{}
+	result := make([]nodeCpuData, len(nodes))
+	for i, node := range nodes {
+		cores, _ := strconv.ParseFloat(node.Metadata[a.TotalCpuMetadata], 64)
+		if cores <= 0 {
+			return nil, fmt.Errorf("no value found for cpu metadata (%s) in node %s", a.TotalCpuMetadata, node.Address)
+		}
+		data := nodeCpuData{node: node, cores: cores}
+		for _, cont := range containersMap[node.Address] {
+			plan, ok := plans[cont.AppName]
+			if !ok {
+				a, err := app.GetByName(cont.AppName)
+				if err != nil {
+					return nil, fmt.Errorf("couldn't find container app (%s): %s", cont.AppName, err)
+				}
+				plan = a.Plan
+				plans[cont.AppName] = plan
+			}
+			data.reserved += float64(plan.CpuShare) / sharesPerCore
+		}
+		data.used = data.reserved
+		if m, ok := metrics[node.Address]; ok && m.CpuUsage*cores > data.used {
+			data.used = m.CpuUsage * cores
+		}
+		result[i] = data
+	}
+	return result, nil
+}
+
+func (a *cpuScaler) scale(groupMetadata string, nodes []*cluster.Node) (*scalerResult, error) {
+	cpuData, err := a.nodesCpuData(nodes)
+	if err != nil {
+		return nil, err
+	}
+	var totalCores, totalUsed float64
+	for _, data := range cpuData {
+		totalCores += data.cores
+		totalUsed += data.used
+	}
+	usage := totalUsed / totalCores
+	coresPerNode := totalCores / float64(len(nodes))
+	upThreshold := float64(a.rule.CpuScaleUpThreshold)
+	downThreshold := float64(a.rule.CpuScaleDownThreshold)
+	if usage > upThreshold {
+		nodesToAdd := int(math.Ceil(totalUsed/(coresPerNode*upThreshold))) - len(nodes)
+		if nodesToAdd < 1 {
+			nodesToAdd = 1
+		}
+		return &scalerResult{
+			ToAdd:  nodesToAdd,
+			Reason: fmt.Sprintf("cpu usage %.2f%% is above the scale up threshold of %.2f%%", usage*100, upThreshold*100),
+		}, nil
+	}
+	if usage >= downThreshold || len(nodes) < 2 {
+		return &scalerResult{}, nil
+	}
+	neededNodes := int(math.Ceil(totalUsed / (coresPerNode * downThreshold)))
+	if neededNodes < 1 {
+		neededNodes = 1
+	}
+	toRemoveCount := len(nodes) - neededNodes
+	if toRemoveCount <= 0 {
+		return &scalerResult{}, nil
+	}
+	chosenNodes, err := a.provisioner.chooseNodeForRemoval(nodes, toRemoveCount)
+	if err != nil {
+		return nil, err
+	}
+	if len(chosenNodes) == 0 {
+		a.logDebug("would remove any node but can't due to metadata restrictions")
+		return &scalerResult{}, nil
+	}
+	return &scalerResult{
+		ToRemove: chosenNodes,
+		Reason:   fmt.Sprintf("cpu usage %.2f%% is below the scale down threshold of %.2f%%", usage*100, downThreshold*100),
+	}, nil
+}
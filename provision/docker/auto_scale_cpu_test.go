@@ -0,0 +1,183 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package docker
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/tsuru/config"
+	"github.com/tsuru/docker-cluster/cluster"
+	"github.com/tsuru/tsuru/db"
+	"github.com/tsuru/tsuru/event"
+	"github.com/tsuru/tsuru/event/eventtest"
+	"github.com/tsuru/tsuru/provision/docker/dockertest"
+	"gopkg.in/check.v1"
+	"gopkg.in/mgo.v2/bson"
+)
+
+func (s *AutoScaleSuite) setUpCpuScale(c *check.C, rule autoScaleRule, cores string) {
+	config.Unset("docker:auto-scale:max-container-count")
+	config.Set("docker:scheduler:total-cpu-metadata", "totalCpu")
+	config.Set("docker:auto-scale:cpu-shares-per-core", 100)
+	err := s.S.storage.Apps().Update(bson.M{"name": s.appInstance.GetName()}, bson.M{"$set": bson.M{"plan.cpushare": 20}})
+	c.Assert(err, check.IsNil)
+	nodes, err := s.p.cluster.Nodes()
+	c.Assert(err, check.IsNil)
+	for _, n := range nodes {
+		_, err = s.p.cluster.UpdateNode(cluster.Node{Address: n.Address, Metadata: map[string]string{"totalCpu": cores}})
+		c.Assert(err, check.IsNil)
+	}
+	err = rule.update()
+	c.Assert(err, check.IsNil)
+}
+
+func (s *AutoScaleSuite) tearDownCpuScale() {
+	config.Unset("docker:scheduler:total-cpu-metadata")
+	config.Unset("docker:auto-scale:cpu-shares-per-core")
+}
+
+func (s *AutoScaleSuite) TestAutoScaleConfigRunCpuBased(c *check.C) {
+	s.setUpCpuScale(c, autoScaleRule{MetadataFilter: "pool1", Enabled: true, CpuScaleUpThreshold: 0.5}, "1")
+	defer s.tearDownCpuScale()
+	_, err := addContainersWithHost(&changeUnitsPipelineArgs{
+		toAdd:       map[string]*containersToAdd{"web": {Quantity: 4}},
+		app:         s.appInstance,
+		imageId:     s.imageId,
+		provisioner: s.p,
+	})
+	c.Assert(err, check.IsNil)
+	a := autoScaleConfig{
+		done:        make(chan bool),
+		provisioner: s.p,
+	}
+	a.runOnce()
+	nodes, err := s.p.cluster.Nodes()
+	c.Assert(err, check.IsNil)
+	c.Assert(nodes, check.HasLen, 2)
+	c.Assert(eventtest.EventDesc{
+		Target: event.Target{Type: "pool", Value: "pool1"},
+		Kind:   "autoscale",
+		EndCustomData: map[string]interface{}{
+			"result.toadd":       1,
+			"result.torebalance": true,
+			"result.reason":      "cpu usage 80.00% is above the scale up threshold of 50.00%",
+			"nodes":              bson.M{"$size": 1},
+		},
+	}, eventtest.HasEvent)
+}
+
+func (s *AutoScaleSuite) TestAutoScaleConfigRunScaleDownCpuScaler(c *check.C) {
+	otherUrl := fmt.Sprintf("http://localhost:%d/", dockertest.URLPort(s.node2.URL()))
+	node := cluster.Node{Address: otherUrl, Metadata: map[string]string{
+		"pool": "pool1",
+		"iaas": "my-scale-iaas",
+	}}
+	err := s.p.cluster.Register(node)
+	c.Assert(err, check.IsNil)
+	s.setUpCpuScale(c, autoScaleRule{
+		MetadataFilter:        "pool1",
+		Enabled:               true,
+		CpuScaleUpThreshold:   0.8,
+		CpuScaleDownThreshold: 0.4,
+	}, "2")
+	defer s.tearDownCpuScale()
+	for _, host := range []string{"127.0.0.1", "localhost"} {
+		_, err = addContainersWithHost(&changeUnitsPipelineArgs{
+			toAdd:       map[string]*containersToAdd{"web": {Quantity: 1}},
+			app:         s.appInstance,
+			imageId:     s.imageId,
+			provisioner: s.p,
+			toHost:      host,
+		})
+		c.Assert(err, check.IsNil)
+	}
+	a := autoScaleConfig{
+		done:        make(chan bool),
+		provisioner: s.p,
+	}
+	a.runOnce()
+	c.Assert(eventtest.EventDesc{
+		Target: event.Target{Type: "pool", Value: "pool1"},
+		Kind:   "autoscale",
+		EndCustomData: map[string]interface{}{
+			"result.toremove":    bson.M{"$size": 1},
+			"result.torebalance": false,
+			"result.reason":      "cpu usage 10.00% is below the scale down threshold of 40.00%",
+			"nodes":              bson.M{"$size": 1},
+		},
+	}, eventtest.HasEvent)
+	nodes, err := s.p.cluster.Nodes()
+	c.Assert(err, check.IsNil)
+	c.Assert(nodes, check.HasLen, 1)
+}
+
+func (s *S) TestCpuScalerUsesObservedUsage(c *check.C) {
+	config.Set("docker:scheduler:total-cpu-metadata", "totalCpu")
+	defer config.Unset("docker:scheduler:total-cpu-metadata")
+	conn, err := db.Conn()
+	c.Assert(err, check.IsNil)
+	defer conn.Close()
+	coll := conn.Collection("node_status")
+	defer coll.RemoveAll(nil)
+	now := time.Now().UTC()
+	for _, addr := range []string{"http://server1:2375", "http://server2:2375"} {
+		err = coll.Insert(bson.M{"_id": addr, "lastupdate": now, "lastmetrics": now, "metrics": bson.M{"cpuusage": 0.95}})
+		c.Assert(err, check.IsNil)
+	}
+	nodes := []*cluster.Node{
+		{Address: "http://server1:2375", Metadata: map[string]string{"totalCpu": "2"}},
+		{Address: "http://server2:2375", Metadata: map[string]string{"totalCpu": "2"}},
+	}
+	rule := autoScaleRule{Enabled: true, CpuScaleUpThreshold: 0.8, CpuScaleDownThreshold: 0.4}
+	scaler := &cpuScaler{autoScaleConfig: &autoScaleConfig{provisioner: s.p, TotalCpuMetadata: "totalCpu"}, rule: &rule}
+	result, err := scaler.scale("pool1", nodes)
+	c.Assert(err, check.IsNil)
+	c.Assert(result, check.DeepEquals, &scalerResult{
+		ToAdd:  1,
+		Reason: "cpu usage 95.00% is above the scale up threshold of 80.00%",
+	})
+	err = coll.UpdateId("http://server1:2375", bson.M{"$set": bson.M{"lastmetrics": now.Add(-time.Hour)}})
+	c.Assert(err, check.IsNil)
+	result, err = scaler.scale("pool1", nodes)
+	c.Assert(err, check.IsNil)
+	c.Assert(result, check.DeepEquals, &scalerResult{})
+	nodes[1].Metadata = nil
+	_, err = scaler.scale("pool1", nodes)
+	c.Assert(err, check.ErrorMatches, `no value found for cpu metadata \(totalCpu\) in node http://server2:2375`)
+}
+
+func (s *S) TestAutoScaleRuleNormalizeCpu(c *check.C) {
+	rule := autoScaleRule{Enabled: true, CpuScaleUpThreshold: 0.8}
+	err := rule.normalize()
+	c.Assert(err, check.ErrorMatches, `invalid rule, cpu thresholds require docker:scheduler:total-cpu-metadata to be set`)
+	config.Set("docker:scheduler:total-cpu-metadata", "totalCpu")
+	defer config.Unset("docker:scheduler:total-cpu-metadata")
+	rule = autoScaleRule{Enabled: true, CpuScaleUpThreshold: 0.8, ScaleDownRatio: 2}
+	err = rule.normalize()
+	c.Assert(err, check.IsNil)
+	c.Assert(rule.CpuScaleDownThreshold, check.Equals, float32(0.4))
+	c.Assert(rule.Error, check.Equals, "")
+	rule = autoScaleRule{Enabled: true, CpuScaleUpThreshold: 1.5}
+	err = rule.normalize()
+	c.Assert(err, check.ErrorMatches, `invalid rule, cpu scale up threshold must be greater than 0.0 and at most 1.0, got 1.500000`)
+	c.Assert(rule.Error, check.Equals, err.Error())
+	rule = autoScaleRule{Enabled: true, CpuScaleUpThreshold: 0.5, CpuScaleDownThreshold: 0.6}
+	err = rule.normalize()
+	c.Assert(err, check.ErrorMatches, `invalid rule, cpu scale down threshold must be greater than 0.0 and lower than the scale up threshold, got 0.600000`)
+	rule = autoScaleRule{Enabled: true, CpuScaleDownThreshold: 0.2}
+	err = rule.normalize()
+	c.Assert(err, check.ErrorMatches, `invalid rule, cpu scale up threshold .*`)
+}
+
+func (s *S) TestScalerForRuleCpu(c *check.C) {
+	a := &autoScaleConfig{}
+	scaler, err := a.scalerForRule(&autoScaleRule{CpuScaleUpThreshold: 0.8})
+	c.Assert(err, check.IsNil)
+	c.Assert(scaler, check.FitsTypeOf, &cpuScaler{})
+	scaler, err = a.scalerForRule(&autoScaleRule{CpuScaleUpThreshold: 0.8, MaxContainerCount: 2})
+	c.Assert(err, check.IsNil)
+	c.Assert(scaler, check.FitsTypeOf, &countScaler{})
+}
@@ -73,7 +73,10 @@ func (a *memoryScaler) chooseNodeForRemoval(maxPlanMemory int64, groupMetadata s
 	if toRemoveCount <= 0 {
 		return nil, nil
 	}
-	chosenNodes := chooseNodeForRemoval(nodes, toRemoveCount)
+	chosenNodes, err := a.provisioner.chooseNodeForRemoval(nodes, toRemoveCount)
+	if err != nil {
+		return nil, err
+	}
 	if len(chosenNodes) == 0 {
 		return nil, nil
 	}
@@ -15,13 +15,15 @@ import (
 )
 
 type autoScaleRule struct {
-	MetadataFilter    string `bson:"_id"`
-	Error             string `bson:"-"`
-	MaxContainerCount int
-	ScaleDownRatio    float32
-	MaxMemoryRatio    float32
-	Enabled           bool
-	PreventRebalance  bool
+	MetadataFilter        string `bson:"_id"`
+	Error                 string `bson:"-"`
+	MaxContainerCount     int
+	ScaleDownRatio        float32
+	MaxMemoryRatio        float32
+	CpuScaleUpThreshold   float32
+	CpuScaleDownThreshold float32
+	Enabled               bool
+	PreventRebalance      bool
 }
 
 type autoScaleRuleList []autoScaleRule
@@ -42,8 +44,15 @@ func (r *autoScaleRule) normalize() error {
 		maxMemoryRatio, _ := config.GetFloat("docker:scheduler:max-used-memory")
 		r.MaxMemoryRatio = float32(maxMemoryRatio)
 	}
+	if r.cpuBased() {
+		err := r.normalizeCpu()
+		if err != nil {
+			r.Error = err.Error()
+			return err
+		}
+	}
 	TotalMemoryMetadata, _ := config.GetString("docker:scheduler:total-memory-metadata")
-	if r.Enabled && r.MaxContainerCount <= 0 && (TotalMemoryMetadata == "" || r.MaxMemoryRatio <= 0) {
+	if r.Enabled && r.MaxContainerCount <= 0 && !r.cpuBased() && (TotalMemoryMetadata == "" || r.MaxMemoryRatio <= 0) {
 		err := fmt.Errorf("invalid rule, either memory information or max container count must be set")
 		r.Error = err.Error()
 		return err
@@ -51,6 +60,26 @@ func (r *autoScaleRule) normalize() error {
 	return nil
 }
 
+func (r *autoScaleRule) cpuBased() bool {
+	return r.CpuScaleUpThreshold != 0 || r.CpuScaleDownThreshold != 0
+}
+
+func (r *autoScaleRule) normalizeCpu() error {
+	if r.CpuScaleUpThreshold <= 0 || r.CpuScaleUpThreshold > 1.0 {
+		return fmt.Errorf("invalid rule, cpu scale up threshold must be greater than 0.0 and at most 1.0, got %f", r.CpuScaleUpThreshold)
+	}
+	if r.CpuScaleDownThreshold == 0.0 {
+		r.CpuScaleDownThreshold = r.CpuScaleUpThreshold / r.ScaleDownRatio
+	} else if r.CpuScaleDownThreshold < 0 || r.CpuScaleDownThreshold >= r.CpuScaleUpThreshold {
+		return fmt.Errorf("invalid rule, cpu scale down threshold must be greater than 0.0 and lower than the scale up threshold, got %f", r.CpuScaleDownThreshold)
+	}
+	totalCpuMetadata, _ := config.GetString("docker:scheduler:total-cpu-metadata")
+	if r.Enabled && totalCpuMetadata == "" {
+		return fmt.Errorf("invalid rule, cpu thresholds require docker:scheduler:total-cpu-metadata to be set")
+	}
+	return nil
+}
+
 func (r *autoScaleRule) update() error {
 	coll, err := autoScaleRuleCollection()
 	if err != nil {
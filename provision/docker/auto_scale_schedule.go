@@ -0,0 +1,305 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package docker
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/tsuru/config"
+	"github.com/tsuru/docker-cluster/cluster"
+	"github.com/tsuru/tsuru/db"
+	"github.com/tsuru/tsuru/db/storage"
+	"gopkg.in/mgo.v2/bson"
+)
+
+var autoScaleNow = time.Now
+
+var weekdayNames = []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}
+
+// autoScaleSchedule is a time based capacity rule for the nodes matching a
+// metadata filter. While active, the node auto scaler keeps the number of
+// nodes between MinNodes and MaxNodes, zero meaning no limit.
+type autoScaleSchedule struct {
+	MetadataFilter string
+	Name           string
+	// Days is a comma separated list of week days or ranges of week days,
+	// like "mon-fri" or "sat,sun". Empty means every day.
+	Days string
+	// Start and End are times of day in the "15:04" format. When End is
+	// before Start the schedule ends on the next day. Empty means the whole
+	// day.
+	Start    string
+	End      string
+	Timezone string
+	MinNodes int
+	MaxNodes int
+}
+
+type autoScaleScheduleList []autoScaleSchedule
+
+func (l autoScaleScheduleList) Len() int      { return len(l) }
+func (l autoScaleScheduleList) Swap(i, j int) { l[i], l[j] = l[j], l[i] }
+func (l autoScaleScheduleList) Less(i, j int) bool {
+	if l[i].MetadataFilter != l[j].MetadataFilter {
+		return l[i].MetadataFilter < l[j].MetadataFilter
+	}
+	return l[i].Name < l[j].Name
+}
+
+func parseWeekdays(days string) (map[time.Weekday]bool, error) {
+	result := map[time.Weekday]bool{}
+	if days == "" {
+		for i := range weekdayNames {
+			result[time.Weekday(i)] = true
+		}
+		return result, nil
+	}
+	indexOf := func(name string) (int, error) {
+		name = strings.ToLower(strings.TrimSpace(name))
+		for i, n := range weekdayNames {
+			if n == name {
+				return i, nil
+			}
+		}
+		return 0, fmt.Errorf("invalid week day %q", name)
+	}
+	for _, part := range strings.Split(days, ",") {
+		bounds := strings.SplitN(part, "-", 2)
+		first, err := indexOf(bounds[0])
+		if err != nil {
+			return nil, err
+		}
+		last := first
+		if len(bounds) == 2 {
+			last, err = indexOf(bounds[1])
+			if err != nil {
+				return nil, err
+			}
+		}
+		for i := first; ; i = (i + 1) % len(weekdayNames) {
+			result[time.Weekday(i)] = true
+			if i == last {
+				break
+			}
+		}
+	}
+	return result, nil
+}
+
+func parseTimeOfDay(value string) (time.Duration, error) {
+	if value == "" {
+		return 0, nil
+	}
+	t, err := time.Parse("15:04", value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time of day %q, expected format is HH:MM", value)
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+func (s *autoScaleSchedule) location() (*time.Location, error) {
+	if s.Timezone == "" {
+		return time.Local, nil
+	}
+	return time.LoadLocation(s.Timezone)
+}
+
+func (s *autoScaleSchedule) validate() error {
+	if s.Name == "" {
+		return errors.New("schedule name is required")
+	}
+	if s.MinNodes < 0 || s.MaxNodes < 0 {
+		return errors.New("min and max nodes must not be negative")
+	}
+	if s.MinNodes == 0 && s.MaxNodes == 0 {
+		return errors.New("either min or max nodes must be set")
+	}
+	if s.MaxNodes > 0 && s.MinNodes > s.MaxNodes {
+		return fmt.Errorf("min nodes (%d) must not be greater than max nodes (%d)", s.MinNodes, s.MaxNodes)
+	}
+	if (s.Start == "") != (s.End == "") {
+		return errors.New("start and end must be set together")
+	}
+	if _, err := parseTimeOfDay(s.Start); err != nil {
+		return err
+	}
+	if _, err := parseTimeOfDay(s.End); err != nil {
+		return err
+	}
+	if _, err := parseWeekdays(s.Days); err != nil {
+		return err
+	}
+	if _, err := s.location(); err != nil {
+		return fmt.Errorf("invalid timezone %q: %s", s.Timezone, err)
+	}
+	return nil
+}
+
+// activeAt returns whether the schedule is active at the given time. A
+// schedule crossing midnight belongs to the day it starts.
+func (s *autoScaleSchedule) activeAt(now time.Time) bool {
+	loc, err := s.location()
+	if err != nil {
+		return false
+	}
+	days, err := parseWeekdays(s.Days)
+	if err != nil {
+		return false
+	}
+	now = now.In(loc)
+	start, _ := parseTimeOfDay(s.Start)
+	end, _ := parseTimeOfDay(s.End)
+	midnight := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, loc)
+	elapsed := now.Sub(midnight)
+	if start == end {
+		return days[now.Weekday()]
+	}
+	if start < end {
+		return days[now.Weekday()] && elapsed >= start && elapsed < end
+	}
+	if elapsed >= start {
+		return days[now.Weekday()]
+	}
+	yesterday := (now.Weekday() + 6) % 7
+	return elapsed < end && days[yesterday]
+}
+
+func (s *autoScaleSchedule) update() error {
+	err := s.validate()
+	if err != nil {
+		return err
+	}
+	coll, err := autoScaleScheduleCollection()
+	if err != nil {
+		return err
+	}
+	defer coll.Close()
+	_, err = coll.Upsert(bson.M{"metadatafilter": s.MetadataFilter, "name": s.Name}, s)
+	return err
+}
+
+func autoScaleScheduleCollection() (*storage.Collection, error) {
+	conn, err := db.Conn()
+	if err != nil {
+		return nil, err
+	}
+	name, err := config.GetString("docker:collection")
+	if err != nil {
+		return nil, err
+	}
+	return conn.Collection(fmt.Sprintf("%s_auto_scale_schedule", name)), nil
+}
+
+func listAutoScaleSchedules(metadataFilter *string) ([]autoScaleSchedule, error) {
+	coll, err := autoScaleScheduleCollection()
+	if err != nil {
+		return nil, err
+	}
+	defer coll.Close()
+	var query bson.M
+	if metadataFilter != nil {
+		query = bson.M{"metadatafilter": *metadataFilter}
+	}
+	var schedules []autoScaleSchedule
+	err = coll.Find(query).All(&schedules)
+	if err != nil {
+		return nil, err
+	}
+	sort.Sort(autoScaleScheduleList(schedules))
+	return schedules, nil
+}
+
+func deleteAutoScaleSchedule(metadataFilter, name string) error {
+	coll, err := autoScaleScheduleCollection()
+	if err != nil {
+		return err
+	}
+	defer coll.Close()
+	return coll.Remove(bson.M{"metadatafilter": metadataFilter, "name": name})
+}
+
+// scheduleLimits holds the node count limits from the schedules active for a
+// pool, along with the name of the schedule defining each limit.
+type scheduleLimits struct {
+	min      int
+	minName  string
+	max      int
+	maxName  string
+	schedule string
+}
+
+func activeScheduleLimits(pool string, now time.Time) (*scheduleLimits, error) {
+	schedules, err := listAutoScaleSchedules(&pool)
+	if err != nil {
+		return nil, err
+	}
+	var limits scheduleLimits
+	for i := range schedules {
+		s := &schedules[i]
+		if !s.activeAt(now) {
+			continue
+		}
+		if s.MinNodes > limits.min {
+			limits.min, limits.minName = s.MinNodes, s.Name
+		}
+		if s.MaxNodes > 0 && (limits.max == 0 || s.MaxNodes < limits.max) {
+			limits.max, limits.maxName = s.MaxNodes, s.Name
+		}
+	}
+	return &limits, nil
+}
+
+// enforce returns a scaler result bringing the number of nodes into the
+// schedule limits, or nil if the number of nodes is already within them.
+func (l *scheduleLimits) enforce(p *dockerProvisioner, nodes []*cluster.Node) (*scalerResult, error) {
+	if l.min > len(nodes) {
+		l.schedule = l.minName
+		return &scalerResult{
+			ToAdd:  l.min - len(nodes),
+			Reason: fmt.Sprintf("schedule %q requires at least %d nodes", l.minName, l.min),
+		}, nil
+	}
+	if l.max > 0 && len(nodes) > l.max {
+		chosenNodes, err := p.chooseNodeForRemoval(nodes, len(nodes)-l.max)
+		if err != nil {
+			return nil, err
+		}
+		if len(chosenNodes) == 0 {
+			return nil, nil
+		}
+		l.schedule = l.maxName
+		return &scalerResult{
+			ToRemove: chosenNodes,
+			Reason:   fmt.Sprintf("schedule %q allows at most %d nodes", l.maxName, l.max),
+		}, nil
+	}
+	return nil, nil
+}
+
+// clamp limits the result of a reactive scaler so that the number of nodes
+// stays within the schedule limits.
+func (l *scheduleLimits) clamp(nodes []*cluster.Node, result *scalerResult) {
+	if l.max > 0 && result.ToAdd > 0 && len(nodes)+result.ToAdd > l.max {
+		result.ToAdd = l.max - len(nodes)
+		if result.ToAdd < 0 {
+			result.ToAdd = 0
+		}
+		result.Reason = fmt.Sprintf("%s, limited to %d nodes by schedule %q", result.Reason, l.max, l.maxName)
+		l.schedule = l.maxName
+	}
+	if l.min > 0 && len(result.ToRemove) > 0 && len(nodes)-len(result.ToRemove) < l.min {
+		allowed := len(nodes) - l.min
+		if allowed < 0 {
+			allowed = 0
+		}
+		result.ToRemove = result.ToRemove[:allowed]
+		result.Reason = fmt.Sprintf("%s, limited to %d nodes by schedule %q", result.Reason, l.min, l.minName)
+		l.schedule = l.minName
+	}
+}
@@ -0,0 +1,165 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package docker
+
+import (
+	"time"
+
+	"github.com/tsuru/docker-cluster/cluster"
+	"github.com/tsuru/tsuru/event"
+	"github.com/tsuru/tsuru/event/eventtest"
+	"gopkg.in/check.v1"
+	"gopkg.in/mgo.v2/bson"
+)
+
+func (s *S) TestAutoScaleScheduleActiveAt(c *check.C) {
+	// 2016-06-06 is a monday
+	monday := func(hour, min int) time.Time {
+		return time.Date(2016, 6, 6, hour, min, 0, 0, time.UTC)
+	}
+	schedule := autoScaleSchedule{Days: "mon-fri", Start: "08:00", End: "20:00", Timezone: "UTC"}
+	c.Assert(schedule.activeAt(monday(8, 0)), check.Equals, true)
+	c.Assert(schedule.activeAt(monday(19, 59)), check.Equals, true)
+	c.Assert(schedule.activeAt(monday(20, 0)), check.Equals, false)
+	c.Assert(schedule.activeAt(monday(7, 59)), check.Equals, false)
+	c.Assert(schedule.activeAt(monday(12, 0).AddDate(0, 0, -1)), check.Equals, false)
+	night := autoScaleSchedule{Days: "fri", Start: "22:00", End: "06:00", Timezone: "UTC"}
+	friday := monday(23, 0).AddDate(0, 0, 4)
+	c.Assert(night.activeAt(friday), check.Equals, true)
+	c.Assert(night.activeAt(friday.Add(6*time.Hour)), check.Equals, true)
+	c.Assert(night.activeAt(friday.Add(8*time.Hour)), check.Equals, false)
+	c.Assert(night.activeAt(monday(23, 0)), check.Equals, false)
+	weekend := autoScaleSchedule{Days: "sat,sun"}
+	c.Assert(weekend.activeAt(monday(12, 0)), check.Equals, false)
+	c.Assert(weekend.activeAt(monday(12, 0).AddDate(0, 0, -1)), check.Equals, true)
+	c.Assert(weekend.activeAt(monday(12, 0).AddDate(0, 0, -2)), check.Equals, true)
+	wrapped := autoScaleSchedule{Days: "fri-mon"}
+	c.Assert(wrapped.activeAt(monday(12, 0)), check.Equals, true)
+	c.Assert(wrapped.activeAt(monday(12, 0).AddDate(0, 0, 1)), check.Equals, false)
+	saoPaulo := autoScaleSchedule{Start: "08:00", End: "20:00", Timezone: "America/Sao_Paulo"}
+	c.Assert(saoPaulo.activeAt(monday(10, 0)), check.Equals, false)
+	c.Assert(saoPaulo.activeAt(monday(12, 0)), check.Equals, true)
+}
+
+func (s *S) TestAutoScaleScheduleValidate(c *check.C) {
+	tests := []struct {
+		schedule autoScaleSchedule
+		err      string
+	}{
+		{autoScaleSchedule{Name: "s", MinNodes: 1}, ""},
+		{autoScaleSchedule{Name: "s", MinNodes: 1, MaxNodes: 3, Days: "mon-fri", Start: "08:00", End: "20:00", Timezone: "UTC"}, ""},
+		{autoScaleSchedule{MinNodes: 1}, "schedule name is required"},
+		{autoScaleSchedule{Name: "s"}, "either min or max nodes must be set"},
+		{autoScaleSchedule{Name: "s", MinNodes: -1}, "min and max nodes must not be negative"},
+		{autoScaleSchedule{Name: "s", MinNodes: 4, MaxNodes: 3}, `min nodes \(4\) must not be greater than max nodes \(3\)`},
+		{autoScaleSchedule{Name: "s", MinNodes: 1, Start: "08:00"}, "start and end must be set together"},
+		{autoScaleSchedule{Name: "s", MinNodes: 1, Start: "8h", End: "20:00"}, `invalid time of day "8h", expected format is HH:MM`},
+		{autoScaleSchedule{Name: "s", MinNodes: 1, Days: "mon-xyz"}, `invalid week day "xyz"`},
+		{autoScaleSchedule{Name: "s", MinNodes: 1, Timezone: "Nowhere/Land"}, `invalid timezone "Nowhere/Land": .*`},
+	}
+	for i, tt := range tests {
+		err := tt.schedule.validate()
+		if tt.err == "" {
+			c.Check(err, check.IsNil, check.Commentf("test %d", i))
+		} else {
+			c.Check(err, check.ErrorMatches, tt.err, check.Commentf("test %d", i))
+		}
+	}
+}
+
+func (s *S) TestActiveScheduleLimits(c *check.C) {
+	schedules := []autoScaleSchedule{
+		{MetadataFilter: "pool1", Name: "business", MinNodes: 5},
+		{MetadataFilter: "pool1", Name: "cap", MinNodes: 2, MaxNodes: 8},
+		{MetadataFilter: "pool1", Name: "tighter", MaxNodes: 6},
+		{MetadataFilter: "pool1", Name: "inactive", MinNodes: 10, Days: "sun", Timezone: "UTC"},
+		{MetadataFilter: "pool2", Name: "other", MinNodes: 20},
+	}
+	for i := range schedules {
+		err := schedules[i].update()
+		c.Assert(err, check.IsNil)
+	}
+	monday := time.Date(2016, 6, 6, 12, 0, 0, 0, time.UTC)
+	limits, err := activeScheduleLimits("pool1", monday)
+	c.Assert(err, check.IsNil)
+	c.Assert(limits, check.DeepEquals, &scheduleLimits{min: 5, minName: "business", max: 6, maxName: "tighter"})
+	nodes := []*cluster.Node{{Address: "http://n1:2375"}, {Address: "http://n2:2375"}}
+	result, err := limits.enforce(s.p, nodes)
+	c.Assert(err, check.IsNil)
+	c.Assert(result, check.DeepEquals, &scalerResult{ToAdd: 3, Reason: `schedule "business" requires at least 5 nodes`})
+	c.Assert(limits.schedule, check.Equals, "business")
+	all, err := listAutoScaleSchedules(nil)
+	c.Assert(err, check.IsNil)
+	c.Assert(all, check.HasLen, 5)
+	err = deleteAutoScaleSchedule("pool1", "business")
+	c.Assert(err, check.IsNil)
+	limits, err = activeScheduleLimits("pool1", monday)
+	c.Assert(err, check.IsNil)
+	c.Assert(limits.min, check.Equals, 2)
+}
+
+func (s *S) TestScheduleLimitsClamp(c *check.C) {
+	nodes := []*cluster.Node{{Address: "http://n1:2375"}, {Address: "http://n2:2375"}, {Address: "http://n3:2375"}}
+	limits := scheduleLimits{min: 2, minName: "floor", max: 4, maxName: "ceiling"}
+	result := &scalerResult{ToAdd: 3, Reason: "number of free slots is -5"}
+	limits.clamp(nodes, result)
+	c.Assert(result, check.DeepEquals, &scalerResult{ToAdd: 1, Reason: `number of free slots is -5, limited to 4 nodes by schedule "ceiling"`})
+	c.Assert(limits.schedule, check.Equals, "ceiling")
+	limits.schedule = ""
+	result = &scalerResult{ToRemove: []cluster.Node{{Address: "http://n1:2375"}, {Address: "http://n2:2375"}}, Reason: "number of free slots is 10"}
+	limits.clamp(nodes, result)
+	c.Assert(result, check.DeepEquals, &scalerResult{ToRemove: []cluster.Node{{Address: "http://n1:2375"}}, Reason: `number of free slots is 10, limited to 2 nodes by schedule "floor"`})
+	c.Assert(limits.schedule, check.Equals, "floor")
+	limits.schedule = ""
+	result = &scalerResult{ToAdd: 1}
+	limits.clamp(nodes, result)
+	c.Assert(result, check.DeepEquals, &scalerResult{ToAdd: 1})
+	c.Assert(limits.schedule, check.Equals, "")
+}
+
+func (s *AutoScaleSuite) TestAutoScaleConfigRunScheduleMinNodes(c *check.C) {
+	schedule := autoScaleSchedule{MetadataFilter: "pool1", Name: "business", MinNodes: 2}
+	err := schedule.update()
+	c.Assert(err, check.IsNil)
+	a := autoScaleConfig{
+		done:        make(chan bool),
+		provisioner: s.p,
+	}
+	a.runOnce()
+	nodes, err := s.p.cluster.Nodes()
+	c.Assert(err, check.IsNil)
+	c.Assert(nodes, check.HasLen, 2)
+	c.Assert(eventtest.EventDesc{
+		Target: event.Target{Type: "pool", Value: "pool1"},
+		Kind:   "autoscale",
+		EndCustomData: map[string]interface{}{
+			"result.toadd":  1,
+			"result.reason": `schedule "business" requires at least 2 nodes`,
+			"schedule":      "business",
+			"nodes":         bson.M{"$size": 1},
+		},
+	}, eventtest.HasEvent)
+}
+
+func (s *AutoScaleSuite) TestAutoScaleConfigRunScheduleMaxNodes(c *check.C) {
+	schedule := autoScaleSchedule{MetadataFilter: "pool1", Name: "night", MaxNodes: 1}
+	err := schedule.update()
+	c.Assert(err, check.IsNil)
+	_, err = addContainersWithHost(&changeUnitsPipelineArgs{
+		toAdd:       map[string]*containersToAdd{"web": {Quantity: 4}},
+		app:         s.appInstance,
+		imageId:     s.imageId,
+		provisioner: s.p,
+	})
+	c.Assert(err, check.IsNil)
+	a := autoScaleConfig{
+		done:        make(chan bool),
+		provisioner: s.p,
+	}
+	a.runOnce()
+	nodes, err := s.p.cluster.Nodes()
+	c.Assert(err, check.IsNil)
+	c.Assert(nodes, check.HasLen, 1)
+}
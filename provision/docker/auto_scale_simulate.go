@@ -0,0 +1,126 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package docker
+
+import (
+	"fmt"
+	"io/ioutil"
+	"math"
+
+	"github.com/tsuru/docker-cluster/cluster"
+	"github.com/tsuru/tsuru/net"
+	"github.com/tsuru/tsuru/provision/docker/container"
+)
+
+// autoScaleSimulation is the outcome of running the auto scaler for a pool
+// in dry mode.
+type autoScaleSimulation struct {
+	Pool     string
+	Rule     *autoScaleRule
+	Schedule string
+	Result   *scalerResult
+	Moves    []rebalanceMove
+	Log      string
+	Error    string
+}
+
+// rebalanceMove describes a unit that would be moved by a rebalance.
+type rebalanceMove struct {
+	ContainerID string
+	AppName     string
+	ProcessName string
+	From        string
+	To          string
+}
+
+// simulate runs the auto scaler for all pools without adding or removing
+// nodes and without moving containers, returning what would be done.
+func (a *autoScaleConfig) simulate() ([]autoScaleSimulation, error) {
+	a.initialize()
+	a.dryRun = true
+	a.simulations = nil
+	err := a.runScaler()
+	if err != nil {
+		return nil, err
+	}
+	return a.simulations, nil
+}
+
+// simulateRebalance decides whether the pool needs to be rebalanced, using
+// the same criteria of rebalanceIfNeeded, and returns the units that would
+// be moved. Rebalances caused by new nodes can't be simulated since the nodes
+// don't exist yet.
+func (a *autoScaleConfig) simulateRebalance(nodes []*cluster.Node, sResult *scalerResult) ([]rebalanceMove, error) {
+	if len(sResult.ToRemove) > 0 {
+		return nil, nil
+	}
+	if sResult.ToAdd > 0 {
+		sResult.ToRebalance = true
+		return nil, nil
+	}
+	_, gap, err := a.provisioner.containerGapInNodes(nodes)
+	if err != nil {
+		return nil, err
+	}
+	hosts := make([]string, len(nodes))
+	for i := range nodes {
+		hosts[i] = net.URLToHost(nodes[i].Address)
+	}
+	containers, err := a.provisioner.listContainersByAppAndHost(nil, hosts)
+	if err != nil {
+		return nil, err
+	}
+	if len(containers) == 0 {
+		return nil, nil
+	}
+	dryProvisioner, err := a.provisioner.dryMode(containers)
+	if err != nil {
+		return nil, err
+	}
+	defer dryProvisioner.stopDryMode()
+	moves, err := dryProvisioner.dryMoveContainers(containers)
+	if err != nil {
+		return nil, err
+	}
+	_, gapAfter, err := dryProvisioner.containerGapInNodes(nodes)
+	if err != nil {
+		return nil, err
+	}
+	if math.Abs(float64(gap-gapAfter)) <= 2.0 {
+		return nil, nil
+	}
+	sResult.ToRebalance = true
+	if sResult.Reason == "" {
+		sResult.Reason = fmt.Sprintf("gap is %d, after rebalance gap will be %d", gap, gapAfter)
+	}
+	return moves, nil
+}
+
+// dryMoveContainers moves, one by one, the containers using a provisioner in
+// dry mode and returns the units that changed hosts.
+func (p *dockerProvisioner) dryMoveContainers(containers []container.Container) ([]rebalanceMove, error) {
+	locker := &appLocker{}
+	var moves []rebalanceMove
+	for _, c := range containers {
+		moveErrors := make(chan error, 1)
+		moved := p.MoveOneContainer(c, "", moveErrors, nil, ioutil.Discard, locker)
+		close(moveErrors)
+		err := p.HandleMoveErrors(moveErrors, ioutil.Discard)
+		if err != nil {
+			return nil, err
+		}
+		if moved.HostAddr == c.HostAddr {
+			continue
+		}
+		moves = append(moves, rebalanceMove{
+			ContainerID: c.ID,
+			AppName:     c.AppName,
+			ProcessName: c.ProcessName,
+			From:        c.HostAddr,
+			To:          moved.HostAddr,
+		})
+	}
+	return moves, nil
+}
@@ -0,0 +1,117 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package docker
+
+import (
+	"fmt"
+
+	"github.com/tsuru/config"
+	"github.com/tsuru/docker-cluster/cluster"
+	"github.com/tsuru/tsuru/event"
+	"github.com/tsuru/tsuru/provision/docker/dockertest"
+	"gopkg.in/check.v1"
+)
+
+func (s *AutoScaleSuite) TestAutoScaleConfigSimulate(c *check.C) {
+	_, err := addContainersWithHost(&changeUnitsPipelineArgs{
+		toAdd:       map[string]*containersToAdd{"web": {Quantity: 4}},
+		app:         s.appInstance,
+		imageId:     s.imageId,
+		provisioner: s.p,
+	})
+	c.Assert(err, check.IsNil)
+	a := autoScaleConfig{
+		done:        make(chan bool),
+		provisioner: s.p,
+	}
+	simulations, err := a.simulate()
+	c.Assert(err, check.IsNil)
+	c.Assert(simulations, check.HasLen, 1)
+	c.Assert(simulations[0].Pool, check.Equals, "pool1")
+	c.Assert(simulations[0].Error, check.Equals, "")
+	c.Assert(simulations[0].Result, check.DeepEquals, &scalerResult{
+		ToAdd:       1,
+		ToRebalance: true,
+		Reason:      "number of free slots is -2",
+	})
+	c.Assert(simulations[0].Moves, check.IsNil)
+	nodes, err := s.p.cluster.Nodes()
+	c.Assert(err, check.IsNil)
+	c.Assert(nodes, check.HasLen, 1)
+	evts, err := event.All()
+	c.Assert(err, check.IsNil)
+	c.Assert(evts, check.HasLen, 0)
+}
+
+func (s *AutoScaleSuite) TestAutoScaleConfigSimulateRebalance(c *check.C) {
+	config.Set("docker:auto-scale:max-container-count", 4)
+	otherUrl := fmt.Sprintf("http://localhost:%d/", dockertest.URLPort(s.node2.URL()))
+	err := s.p.cluster.Register(cluster.Node{Address: otherUrl, Metadata: map[string]string{
+		"pool": "pool1",
+		"iaas": "my-scale-iaas",
+	}})
+	c.Assert(err, check.IsNil)
+	_, err = addContainersWithHost(&changeUnitsPipelineArgs{
+		toAdd:       map[string]*containersToAdd{"web": {Quantity: 4}},
+		app:         s.appInstance,
+		imageId:     s.imageId,
+		provisioner: s.p,
+		toHost:      "127.0.0.1",
+	})
+	c.Assert(err, check.IsNil)
+	a := autoScaleConfig{
+		done:        make(chan bool),
+		provisioner: s.p,
+	}
+	simulations, err := a.simulate()
+	c.Assert(err, check.IsNil)
+	c.Assert(simulations, check.HasLen, 1)
+	c.Assert(simulations[0].Result, check.DeepEquals, &scalerResult{
+		ToRebalance: true,
+		Reason:      "gap is 4, after rebalance gap will be 0",
+	})
+	c.Assert(simulations[0].Moves, check.HasLen, 2)
+	for _, m := range simulations[0].Moves {
+		c.Assert(m.AppName, check.Equals, s.appInstance.GetName())
+		c.Assert(m.From, check.Equals, "127.0.0.1")
+		c.Assert(m.To, check.Equals, "localhost")
+	}
+	containers, err := s.p.listContainersByHost("127.0.0.1")
+	c.Assert(err, check.IsNil)
+	c.Assert(containers, check.HasLen, 4)
+	evts, err := event.All()
+	c.Assert(err, check.IsNil)
+	c.Assert(evts, check.HasLen, 0)
+}
+
+func (s *AutoScaleSuite) TestAutoScaleConfigSimulateLockedPool(c *check.C) {
+	_, err := addContainersWithHost(&changeUnitsPipelineArgs{
+		toAdd:       map[string]*containersToAdd{"web": {Quantity: 4}},
+		app:         s.appInstance,
+		imageId:     s.imageId,
+		provisioner: s.p,
+	})
+	c.Assert(err, check.IsNil)
+	evt, err := event.NewInternal(&event.Opts{
+		Target:       event.Target{Type: event.TargetTypePool, Value: "pool1"},
+		InternalKind: autoScaleEventKind,
+	})
+	c.Assert(err, check.IsNil)
+	defer evt.Abort()
+	a := autoScaleConfig{
+		done:        make(chan bool),
+		provisioner: s.p,
+	}
+	simulations, err := a.simulate()
+	c.Assert(err, check.IsNil)
+	c.Assert(simulations, check.HasLen, 1)
+	c.Assert(simulations[0].Error, check.Equals, "")
+	c.Assert(simulations[0].Result, check.NotNil)
+	c.Assert(simulations[0].Log, check.Matches, `(?s).*simulating scale for "pool1".*`)
+	evts, err := event.All()
+	c.Assert(err, check.IsNil)
+	c.Assert(evts, check.HasLen, 1)
+	c.Assert(evts[0].UniqueID, check.Equals, evt.UniqueID)
+}
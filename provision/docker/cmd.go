@@ -232,6 +232,113 @@ func (c *removeNodeFromSchedulerCmd) Flags() *gnuflag.FlagSet {
 	return c.fs
 }
 
+type cordonNodeCmd struct{}
+
+func (cordonNodeCmd) Info() *cmd.Info {
+	return &cmd.Info{
+		Name:  "docker-node-cordon",
+		Usage: "docker-node-cordon <address>",
+		Desc: `Marks a node as cordoned. Cordoned nodes keep running their containers but
+won't receive new ones. They are also ignored by the node healer and by the
+auto scaler.`,
+		MinArgs: 1,
+	}
+}
+
+func (c *cordonNodeCmd) Run(ctx *cmd.Context, client *cmd.Client) error {
+	err := postNodeMaintenance(client, ctx.Args[0], "cordon")
+	if err != nil {
+		return err
+	}
+	ctx.Stdout.Write([]byte("Node successfully cordoned.\n"))
+	return nil
+}
+
+type uncordonNodeCmd struct{}
+
+func (uncordonNodeCmd) Info() *cmd.Info {
+	return &cmd.Info{
+		Name:    "docker-node-uncordon",
+		Usage:   "docker-node-uncordon <address>",
+		Desc:    `Takes a cordoned or draining node out of maintenance, allowing it to receive new containers.`,
+		MinArgs: 1,
+	}
+}
+
+func (c *uncordonNodeCmd) Run(ctx *cmd.Context, client *cmd.Client) error {
+	err := postNodeMaintenance(client, ctx.Args[0], "uncordon")
+	if err != nil {
+		return err
+	}
+	ctx.Stdout.Write([]byte("Node successfully uncordoned.\n"))
+	return nil
+}
+
+func postNodeMaintenance(client *cmd.Client, address, action string) error {
+	u, err := cmd.GetURL(fmt.Sprintf("/docker/node/%s/%s", address, action))
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest("POST", u, nil)
+	if err != nil {
+		return err
+	}
+	_, err = client.Do(req)
+	return err
+}
+
+type drainNodeCmd struct {
+	fs       *gnuflag.FlagSet
+	interval int
+}
+
+func (drainNodeCmd) Info() *cmd.Info {
+	return &cmd.Info{
+		Name:  "docker-node-drain",
+		Usage: "docker-node-drain <address> [--interval/-i <seconds>]",
+		Desc: `Drains a node, moving all its containers to other nodes.
+
+The node is marked as draining, so it won't receive new containers, and its
+containers are moved one at a time. Before moving the next container, tsuru
+waits until the app has at least as many available units as it had before
+the drain started. The [[--interval]] flag adds a pause between moves.
+
+After all containers are moved the node is left cordoned, use
+[[docker-node-uncordon]] to make it available again.`,
+		MinArgs: 1,
+	}
+}
+
+func (c *drainNodeCmd) Run(ctx *cmd.Context, client *cmd.Client) error {
+	ctx.RawOutput()
+	u, err := cmd.GetURL(fmt.Sprintf("/docker/node/%s/drain", ctx.Args[0]))
+	if err != nil {
+		return err
+	}
+	v := url.Values{}
+	v.Set("interval", strconv.Itoa(c.interval))
+	req, err := http.NewRequest("POST", u, bytes.NewBufferString(v.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	return cmd.StreamJSONResponse(ctx.Stdout, resp)
+}
+
+func (c *drainNodeCmd) Flags() *gnuflag.FlagSet {
+	if c.fs == nil {
+		c.fs = gnuflag.NewFlagSet("with-flags", gnuflag.ContinueOnError)
+		desc := "Seconds to wait between each container move"
+		c.fs.IntVar(&c.interval, "interval", 0, desc)
+		c.fs.IntVar(&c.interval, "i", 0, desc)
+	}
+	return c.fs
+}
+
 type listNodesInTheSchedulerCmd struct {
 	fs         *gnuflag.FlagSet
 	filter     cmd.MapFlag
@@ -465,6 +572,95 @@ func (c *autoScaleRunCmd) Run(context *cmd.Context, client *cmd.Client) error {
 	return nil
 }
 
+type autoScaleSimulateCmd struct{}
+
+func (c *autoScaleSimulateCmd) Info() *cmd.Info {
+	return &cmd.Info{
+		Name:  "docker-autoscale-simulate",
+		Usage: "docker-autoscale-simulate",
+		Desc: `Run node auto scale checks in dry mode. It shows the nodes that would be
+added or removed in each pool and the units that would be moved by a
+rebalance, without changing any node or container.`,
+	}
+}
+
+func (c *autoScaleSimulateCmd) Run(context *cmd.Context, client *cmd.Client) error {
+	u, err := cmd.GetURL("/docker/autoscale/simulate")
+	if err != nil {
+		return err
+	}
+	request, err := http.NewRequest("POST", u, nil)
+	if err != nil {
+		return err
+	}
+	response, err := client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if response.StatusCode == http.StatusNoContent {
+		fmt.Fprintln(context.Stdout, "No pools to scale.")
+		return nil
+	}
+	var simulations []autoScaleSimulation
+	err = json.NewDecoder(response.Body).Decode(&simulations)
+	if err != nil {
+		return err
+	}
+	var table cmd.Table
+	table.Headers = cmd.Row{"Pool", "Action", "Reason", "Schedule"}
+	for _, sim := range simulations {
+		var reason string
+		if sim.Result != nil {
+			reason = sim.Result.Reason
+		}
+		if sim.Error != "" {
+			reason = sim.Error
+		}
+		table.AddRow(cmd.Row{sim.Pool, describeSimulatedAction(&sim), reason, sim.Schedule})
+	}
+	fmt.Fprint(context.Stdout, table.String())
+	for _, sim := range simulations {
+		if len(sim.Moves) == 0 {
+			continue
+		}
+		var movesTable cmd.Table
+		movesTable.Headers = cmd.Row{"Unit", "App", "Process", "From", "To"}
+		for _, m := range sim.Moves {
+			movesTable.AddRow(cmd.Row{m.ContainerID, m.AppName, m.ProcessName, m.From, m.To})
+		}
+		fmt.Fprintf(context.Stdout, "\nRebalance moves in %s:\n%s", sim.Pool, movesTable.String())
+	}
+	return nil
+}
+
+func describeSimulatedAction(sim *autoScaleSimulation) string {
+	if sim.Error != "" {
+		return "error"
+	}
+	if sim.Result == nil {
+		return "none"
+	}
+	var actions []string
+	if sim.Result.ToAdd > 0 {
+		actions = append(actions, fmt.Sprintf("add %d node(s)", sim.Result.ToAdd))
+	}
+	if len(sim.Result.ToRemove) > 0 {
+		addrs := make([]string, len(sim.Result.ToRemove))
+		for i, n := range sim.Result.ToRemove {
+			addrs[i] = n.Address
+		}
+		actions = append(actions, "remove "+strings.Join(addrs, ", "))
+	}
+	if sim.Result.ToRebalance {
+		actions = append(actions, "rebalance")
+	}
+	if len(actions) == 0 {
+		return "none"
+	}
+	return strings.Join(actions, ", ")
+}
+
 type autoScaleInfoCmd struct{}
 
 func (c *autoScaleInfoCmd) Info() *cmd.Info {
@@ -546,16 +742,22 @@ func (c *autoScaleInfoCmd) render(context *cmd.Context, config *autoScaleConfig,
 		"Pool",
 		"Max container count",
 		"Max memory ratio",
+		"Cpu thresholds",
 		"Scale down ratio",
 		"Rebalance on scale",
 		"Enabled",
 	}
 	table.Headers = tableHeader
 	for _, rule := range rules {
+		cpuThresholds := "-"
+		if rule.cpuBased() {
+			cpuThresholds = fmt.Sprintf("%.4f/%.4f", rule.CpuScaleUpThreshold, rule.CpuScaleDownThreshold)
+		}
 		table.AddRow([]string{
 			rule.MetadataFilter,
 			strconv.Itoa(rule.MaxContainerCount),
 			strconv.FormatFloat(float64(rule.MaxMemoryRatio), 'f', 4, 32),
+			cpuThresholds,
 			strconv.FormatFloat(float64(rule.ScaleDownRatio), 'f', 4, 32),
 			strconv.FormatBool(!rule.PreventRebalance),
 			strconv.FormatBool(rule.Enabled),
@@ -570,6 +772,8 @@ type autoScaleSetRuleCmd struct {
 	filterValue        string
 	maxContainerCount  int
 	maxMemoryRatio     float64
+	cpuScaleUp         float64
+	cpuScaleDown       float64
 	scaleDownRatio     float64
 	noRebalanceOnScale bool
 	enable             bool
@@ -579,8 +783,8 @@ type autoScaleSetRuleCmd struct {
 func (c *autoScaleSetRuleCmd) Info() *cmd.Info {
 	return &cmd.Info{
 		Name:  "docker-autoscale-rule-set",
-		Usage: "docker-autoscale-rule-set [-f/--filter-value <pool name>] [-c/--max-container-count 0] [-m/--max-memory-ratio 0.9] [-d/--scale-down-ratio 1.33] [--no-rebalance-on-scale] [--enable] [--disable]",
-		Desc:  "Creates or update an auto-scale rule. Using resources limitation (amount of container or memory usage).",
+		Usage: "docker-autoscale-rule-set [-f/--filter-value <pool name>] [-c/--max-container-count 0] [-m/--max-memory-ratio 0.9] [--cpu-scale-up-threshold 0.8] [--cpu-scale-down-threshold 0.5] [-d/--scale-down-ratio 1.33] [--no-rebalance-on-scale] [--enable] [--disable]",
+		Desc:  "Creates or update an auto-scale rule. Using resources limitation (amount of container, memory usage or cpu usage).",
 	}
 }
 
@@ -589,12 +793,14 @@ func (c *autoScaleSetRuleCmd) Run(context *cmd.Context, client *cmd.Client) erro
 		return errors.New("either --disable or --enable must be set")
 	}
 	rule := autoScaleRule{
-		MetadataFilter:    c.filterValue,
-		MaxContainerCount: c.maxContainerCount,
-		MaxMemoryRatio:    float32(c.maxMemoryRatio),
-		ScaleDownRatio:    float32(c.scaleDownRatio),
-		PreventRebalance:  c.noRebalanceOnScale,
-		Enabled:           c.enable,
+		MetadataFilter:        c.filterValue,
+		MaxContainerCount:     c.maxContainerCount,
+		MaxMemoryRatio:        float32(c.maxMemoryRatio),
+		CpuScaleUpThreshold:   float32(c.cpuScaleUp),
+		CpuScaleDownThreshold: float32(c.cpuScaleDown),
+		ScaleDownRatio:        float32(c.scaleDownRatio),
+		PreventRebalance:      c.noRebalanceOnScale,
+		Enabled:               c.enable,
 	}
 	val, err := form.EncodeToValues(rule)
 	if err != nil {
@@ -630,6 +836,10 @@ func (c *autoScaleSetRuleCmd) Flags() *gnuflag.FlagSet {
 		msg = "The maximum memory usage per node. 0 means no limit, 1 means 100%. It is fine to use values greater than 1, which means that tsuru will overcommit memory in Docker nodes. Keep in mind that container count has higher precedence than memory ratio, so if --max-container-count is defined, the value of --max-memory-ratio will be ignored."
 		c.fs.Float64Var(&c.maxMemoryRatio, "max-memory-ratio", .0, msg)
 		c.fs.Float64Var(&c.maxMemoryRatio, "m", .0, msg)
+		msg = "The cpu usage of the pool, from 0 to 1, above which new nodes are added. Setting it enables cpu based scaling, which uses the cpu shares of app plans and the cpu usage reported by nodes. Container count has higher precedence than cpu thresholds."
+		c.fs.Float64Var(&c.cpuScaleUp, "cpu-scale-up-threshold", .0, msg)
+		msg = "The cpu usage of the pool, from 0 to 1, below which nodes are removed. Defaults to the scale up threshold divided by the scale down ratio."
+		c.fs.Float64Var(&c.cpuScaleDown, "cpu-scale-down-threshold", .0, msg)
 		msg = "The ratio for triggering an scale down event. The default value is 1.33, which mean that whenever it gets one third of the resource utilization (memory ratio or container count)."
 		c.fs.Float64Var(&c.scaleDownRatio, "scale-down-ratio", 1.33, msg)
 		c.fs.Float64Var(&c.scaleDownRatio, "d", 1.33, msg)
@@ -681,6 +891,170 @@ func (c *autoScaleDeleteRuleCmd) Run(context *cmd.Context, client *cmd.Client) e
 	return nil
 }
 
+type autoScaleSetScheduleCmd struct {
+	fs          *gnuflag.FlagSet
+	filterValue string
+	days        string
+	start       string
+	end         string
+	timezone    string
+	minNodes    int
+	maxNodes    int
+}
+
+func (c *autoScaleSetScheduleCmd) Info() *cmd.Info {
+	return &cmd.Info{
+		Name:    "docker-autoscale-schedule-set",
+		Usage:   "docker-autoscale-schedule-set <name> [-f/--filter-value <pool name>] [--days mon-fri] [--start 08:00] [--end 20:00] [--timezone America/Sao_Paulo] [--min 0] [--max 0]",
+		Desc:    "Creates or updates a scheduled capacity rule. While the schedule is active the node auto scaler keeps the number of nodes in the pool between --min and --max, before running the resource based scalers.",
+		MinArgs: 1,
+	}
+}
+
+func (c *autoScaleSetScheduleCmd) Run(context *cmd.Context, client *cmd.Client) error {
+	schedule := autoScaleSchedule{
+		MetadataFilter: c.filterValue,
+		Name:           context.Args[0],
+		Days:           c.days,
+		Start:          c.start,
+		End:            c.end,
+		Timezone:       c.timezone,
+		MinNodes:       c.minNodes,
+		MaxNodes:       c.maxNodes,
+	}
+	val, err := form.EncodeToValues(schedule)
+	if err != nil {
+		return err
+	}
+	u, err := cmd.GetURL("/docker/autoscale/schedules")
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest("POST", u, strings.NewReader(val.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	_, err = client.Do(req)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(context.Stdout, "Schedule successfully defined.")
+	return nil
+}
+
+func (c *autoScaleSetScheduleCmd) Flags() *gnuflag.FlagSet {
+	if c.fs == nil {
+		c.fs = gnuflag.NewFlagSet("autoscale-schedule-set", gnuflag.ExitOnError)
+		msg := "The pool name matching the schedule."
+		c.fs.StringVar(&c.filterValue, "filter-value", "", msg)
+		c.fs.StringVar(&c.filterValue, "f", "", msg)
+		c.fs.StringVar(&c.days, "days", "", "Week days when the schedule is active, like mon-fri or sat,sun. Defaults to every day.")
+		c.fs.StringVar(&c.start, "start", "", "Time of day, in the HH:MM format, when the schedule starts. Defaults to the whole day.")
+		c.fs.StringVar(&c.end, "end", "", "Time of day, in the HH:MM format, when the schedule ends. Defaults to the whole day.")
+		c.fs.StringVar(&c.timezone, "timezone", "", "Timezone for start and end times. Defaults to the tsuru server timezone.")
+		c.fs.IntVar(&c.minNodes, "min", 0, "Minimum number of nodes while the schedule is active. Zero means no minimum.")
+		c.fs.IntVar(&c.maxNodes, "max", 0, "Maximum number of nodes while the schedule is active. Zero means no maximum.")
+	}
+	return c.fs
+}
+
+type autoScaleListSchedulesCmd struct{}
+
+func (c *autoScaleListSchedulesCmd) Info() *cmd.Info {
+	return &cmd.Info{
+		Name:  "docker-autoscale-schedule-list",
+		Usage: "docker-autoscale-schedule-list",
+		Desc:  "Lists the scheduled capacity rules used by the node auto scaler.",
+	}
+}
+
+func (c *autoScaleListSchedulesCmd) Run(context *cmd.Context, client *cmd.Client) error {
+	u, err := cmd.GetURL("/docker/autoscale/schedules")
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest("GET", u, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNoContent {
+		fmt.Fprintln(context.Stdout, "No schedules defined.")
+		return nil
+	}
+	var schedules []autoScaleSchedule
+	err = json.NewDecoder(resp.Body).Decode(&schedules)
+	if err != nil {
+		return err
+	}
+	var table cmd.Table
+	table.Headers = cmd.Row{"Pool", "Name", "Days", "Time", "Timezone", "Min nodes", "Max nodes"}
+	for _, s := range schedules {
+		days := s.Days
+		if days == "" {
+			days = "all"
+		}
+		period := "all day"
+		if s.Start != "" {
+			period = s.Start + "-" + s.End
+		}
+		table.AddRow(cmd.Row{s.MetadataFilter, s.Name, days, period, s.Timezone, strconv.Itoa(s.MinNodes), strconv.Itoa(s.MaxNodes)})
+	}
+	fmt.Fprint(context.Stdout, table.String())
+	return nil
+}
+
+type autoScaleDeleteScheduleCmd struct {
+	cmd.ConfirmationCommand
+	fs          *gnuflag.FlagSet
+	filterValue string
+}
+
+func (c *autoScaleDeleteScheduleCmd) Info() *cmd.Info {
+	return &cmd.Info{
+		Name:    "docker-autoscale-schedule-remove",
+		Usage:   "docker-autoscale-schedule-remove <name> [-f/--filter-value <pool name>] [-y/--assume-yes]",
+		Desc:    "Removes a scheduled capacity rule.",
+		MinArgs: 1,
+	}
+}
+
+func (c *autoScaleDeleteScheduleCmd) Run(context *cmd.Context, client *cmd.Client) error {
+	name := context.Args[0]
+	if !c.Confirm(context, fmt.Sprintf("Are you sure you want to remove the schedule %q?", name)) {
+		return nil
+	}
+	u, err := cmd.GetURL(fmt.Sprintf("/docker/autoscale/schedules/%s?filter=%s", name, url.QueryEscape(c.filterValue)))
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest("DELETE", u, nil)
+	if err != nil {
+		return err
+	}
+	_, err = client.Do(req)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(context.Stdout, "Schedule successfully removed.")
+	return nil
+}
+
+func (c *autoScaleDeleteScheduleCmd) Flags() *gnuflag.FlagSet {
+	if c.fs == nil {
+		c.fs = c.ConfirmationCommand.Flags()
+		msg := "The pool name matching the schedule."
+		c.fs.StringVar(&c.filterValue, "filter-value", "", msg)
+		c.fs.StringVar(&c.filterValue, "f", "", msg)
+	}
+	return c.fs
+}
+
 type dockerLogUpdate struct {
 	cmd.ConfirmationCommand
 	fs        *gnuflag.FlagSet
@@ -770,6 +1144,107 @@ func (c *dockerLogUpdate) Run(context *cmd.Context, client *cmd.Client) error {
 	return cmd.StreamJSONResponse(context.Stdout, response)
 }
 
+type schedulerInfo struct{}
+
+func (c *schedulerInfo) Info() *cmd.Info {
+	return &cmd.Info{
+		Name:    "docker-scheduler-info",
+		Usage:   "docker-scheduler-info",
+		Desc:    "Prints the scheduler strategy used in each pool.",
+		MinArgs: 0,
+	}
+}
+
+func (c *schedulerInfo) Run(context *cmd.Context, client *cmd.Client) error {
+	u, err := cmd.GetURL("/docker/scheduler")
+	if err != nil {
+		return err
+	}
+	request, err := http.NewRequest("GET", u, nil)
+	if err != nil {
+		return err
+	}
+	response, err := client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	var conf map[string]schedulerConfig
+	err = json.NewDecoder(response.Body).Decode(&conf)
+	if err != nil {
+		return err
+	}
+	baseStrategy := conf[""].Strategy
+	if baseStrategy == "" {
+		baseStrategy = spreadStrategyName
+	}
+	delete(conf, "")
+	t := cmd.Table{Headers: cmd.Row([]string{"Pool", "Strategy"})}
+	t.AddRow(cmd.Row([]string{"[default]", baseStrategy}))
+	poolNames := make([]string, 0, len(conf))
+	for poolName := range conf {
+		poolNames = append(poolNames, poolName)
+	}
+	sort.Strings(poolNames)
+	for _, poolName := range poolNames {
+		t.AddRow(cmd.Row([]string{poolName, conf[poolName].Strategy}))
+	}
+	context.Stdout.Write(t.Bytes())
+	return nil
+}
+
+type schedulerUpdate struct {
+	fs   *gnuflag.FlagSet
+	pool string
+}
+
+func (c *schedulerUpdate) Flags() *gnuflag.FlagSet {
+	if c.fs == nil {
+		c.fs = gnuflag.NewFlagSet("with-flags", gnuflag.ContinueOnError)
+		desc := "Pool name where the strategy will be used."
+		c.fs.StringVar(&c.pool, "pool", "", desc)
+		c.fs.StringVar(&c.pool, "p", "", desc)
+	}
+	return c.fs
+}
+
+func (c *schedulerUpdate) Info() *cmd.Info {
+	return &cmd.Info{
+		Name:  "docker-scheduler-update",
+		Usage: "docker-scheduler-update <spread|binpack> [-p/--pool poolname]",
+		Desc: `Sets the strategy used to choose nodes for new containers.
+
+The 'spread' strategy, used by default, distributes containers evenly among
+nodes. The 'binpack' strategy fills the most used nodes, by memory and cpu,
+before using other ones, allowing the node auto scaler to remove the least
+used nodes. The 'binpack' strategy requires memory aware scheduling.
+
+If --pool is specified the strategy will only be used on the chosen pool.`,
+		MinArgs: 1,
+	}
+}
+
+func (c *schedulerUpdate) Run(context *cmd.Context, client *cmd.Client) error {
+	u, err := cmd.GetURL("/docker/scheduler")
+	if err != nil {
+		return err
+	}
+	values := url.Values{}
+	values.Set("pool", c.pool)
+	values.Set("strategy", context.Args[0])
+	request, err := http.NewRequest("POST", u, strings.NewReader(values.Encode()))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	_, err = client.Do(request)
+	if err != nil {
+		return err
+	}
+	context.Stdout.Write([]byte("Scheduler strategy successfully updated.\n"))
+	return nil
+}
+
 type dockerLogInfo struct{}
 
 func (c *dockerLogInfo) Info() *cmd.Info {
@@ -830,3 +1305,47 @@ func (c *dockerLogInfo) Run(context *cmd.Context, client *cmd.Client) error {
 	}
 	return nil
 }
+
+type listOrphansCmd struct{}
+
+func (c *listOrphansCmd) Info() *cmd.Info {
+	return &cmd.Info{
+		Name:  "docker-orphan-list",
+		Usage: "docker-orphan-list",
+		Desc: `Lists machines and nodes out of sync between the IaaS and the docker
+cluster: machines not registered as nodes, nodes whose machine no longer exists
+and machines listed by the IaaS which are unknown to tsuru.`,
+	}
+}
+
+func (c *listOrphansCmd) Run(context *cmd.Context, client *cmd.Client) error {
+	u, err := cmd.GetURL("/docker/orphans")
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest("GET", u, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNoContent {
+		fmt.Fprintln(context.Stdout, "No orphans found.")
+		return nil
+	}
+	var orphans []Orphan
+	err = json.NewDecoder(resp.Body).Decode(&orphans)
+	if err != nil {
+		return err
+	}
+	var table cmd.Table
+	table.Headers = cmd.Row{"Kind", "IaaS", "Machine", "Address", "Pool", "Reason", "First seen"}
+	for _, o := range orphans {
+		table.AddRow(cmd.Row{o.Kind, o.IaaS, o.MachineID, o.Address, o.Pool, o.Reason, o.FirstSeen.Local().Format(time.Stamp)})
+	}
+	fmt.Fprint(context.Stdout, table.String())
+	return nil
+}
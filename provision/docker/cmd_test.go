@@ -102,6 +102,62 @@ func (s *S) TestRemoveNodeFromTheSchedulerCmdRun(c *check.C) {
 	c.Assert(buf.String(), check.Equals, "Node successfully removed.\n")
 }
 
+func (s *S) TestCordonNodeCmdRun(c *check.C) {
+	var buf bytes.Buffer
+	context := cmd.Context{Args: []string{"http://localhost:8080"}, Stdout: &buf}
+	trans := &cmdtest.ConditionalTransport{
+		Transport: cmdtest.Transport{Message: "", Status: http.StatusOK},
+		CondFunc: func(req *http.Request) bool {
+			url := strings.HasSuffix(req.URL.Path, "/1.0/docker/node/http://localhost:8080/cordon")
+			return url && req.Method == "POST"
+		},
+	}
+	manager := cmd.Manager{}
+	client := cmd.NewClient(&http.Client{Transport: trans}, nil, &manager)
+	cmd := cordonNodeCmd{}
+	err := cmd.Run(&context, client)
+	c.Assert(err, check.IsNil)
+	c.Assert(buf.String(), check.Equals, "Node successfully cordoned.\n")
+}
+
+func (s *S) TestUncordonNodeCmdRun(c *check.C) {
+	var buf bytes.Buffer
+	context := cmd.Context{Args: []string{"http://localhost:8080"}, Stdout: &buf}
+	trans := &cmdtest.ConditionalTransport{
+		Transport: cmdtest.Transport{Message: "", Status: http.StatusOK},
+		CondFunc: func(req *http.Request) bool {
+			url := strings.HasSuffix(req.URL.Path, "/1.0/docker/node/http://localhost:8080/uncordon")
+			return url && req.Method == "POST"
+		},
+	}
+	manager := cmd.Manager{}
+	client := cmd.NewClient(&http.Client{Transport: trans}, nil, &manager)
+	cmd := uncordonNodeCmd{}
+	err := cmd.Run(&context, client)
+	c.Assert(err, check.IsNil)
+	c.Assert(buf.String(), check.Equals, "Node successfully uncordoned.\n")
+}
+
+func (s *S) TestDrainNodeCmdRun(c *check.C) {
+	var buf bytes.Buffer
+	context := cmd.Context{Args: []string{"http://localhost:8080"}, Stdout: &buf}
+	msg, _ := json.Marshal(tsuruIo.SimpleJsonMessage{Message: "drained\n"})
+	trans := &cmdtest.ConditionalTransport{
+		Transport: cmdtest.Transport{Message: string(msg), Status: http.StatusOK},
+		CondFunc: func(req *http.Request) bool {
+			url := strings.HasSuffix(req.URL.Path, "/1.0/docker/node/http://localhost:8080/drain")
+			return url && req.Method == "POST" && req.FormValue("interval") == "5"
+		},
+	}
+	manager := cmd.Manager{}
+	client := cmd.NewClient(&http.Client{Transport: trans}, nil, &manager)
+	cmd := drainNodeCmd{}
+	cmd.Flags().Parse(true, []string{"-i", "5"})
+	err := cmd.Run(&context, client)
+	c.Assert(err, check.IsNil)
+	c.Assert(buf.String(), check.Equals, "drained\n")
+}
+
 func (s *S) TestRemoveNodeFromTheSchedulerWithDestroyCmdRun(c *check.C) {
 	var buf bytes.Buffer
 	context := cmd.Context{Args: []string{"http://localhost:8080"}, Stdout: &buf}
@@ -459,6 +515,47 @@ func (s *S) TestAutoScaleRunCmdRun(c *check.C) {
 	c.Assert(stdout.String(), check.Equals, "progress msg")
 }
 
+func (s *S) TestAutoScaleSimulateCmdRun(c *check.C) {
+	simulations := `[
+	{"Pool":"pool1","Result":{"ToAdd":1,"ToRebalance":true,"Reason":"number of free slots is -2"},"Schedule":""},
+	{"Pool":"pool2","Result":{"ToRebalance":true,"Reason":"gap is 4, after rebalance gap will be 0"},"Moves":[
+		{"ContainerID":"c1","AppName":"myapp","ProcessName":"web","From":"10.0.0.1","To":"10.0.0.2"}
+	]},
+	{"Pool":"pool3","Result":{"ToRemove":[{"Address":"http://10.0.0.5:2375"}],"Reason":"schedule \"night\" allows at most 1 nodes"},"Schedule":"night"},
+	{"Pool":"pool4","Error":"error scaling group pool4: boom"}
+]`
+	trans := &cmdtest.ConditionalTransport{
+		Transport: cmdtest.Transport{Message: simulations, Status: http.StatusOK},
+		CondFunc: func(req *http.Request) bool {
+			return req.URL.Path == "/1.0/docker/autoscale/simulate" && req.Method == "POST"
+		},
+	}
+	var stdout bytes.Buffer
+	context := cmd.Context{Stdout: &stdout}
+	manager := cmd.Manager{}
+	client := cmd.NewClient(&http.Client{Transport: trans}, nil, &manager)
+	var command autoScaleSimulateCmd
+	err := command.Run(&context, client)
+	c.Assert(err, check.IsNil)
+	expected := `+-------+-----------------------------+-----------------------------------------+----------+
+| Pool  | Action                      | Reason                                  | Schedule |
++-------+-----------------------------+-----------------------------------------+----------+
+| pool1 | add 1 node(s), rebalance    | number of free slots is -2              |          |
+| pool2 | rebalance                   | gap is 4, after rebalance gap will be 0 |          |
+| pool3 | remove http://10.0.0.5:2375 | schedule "night" allows at most 1 nodes | night    |
+| pool4 | error                       | error scaling group pool4: boom         |          |
++-------+-----------------------------+-----------------------------------------+----------+
+
+Rebalance moves in pool2:
++------+-------+---------+----------+----------+
+| Unit | App   | Process | From     | To       |
++------+-------+---------+----------+----------+
+| c1   | myapp | web     | 10.0.0.1 | 10.0.0.2 |
++------+-------+---------+----------+----------+
+`
+	c.Assert(stdout.String(), check.Equals, expected)
+}
+
 func (s *S) TestAutoScaleInfoCmdRun(c *check.C) {
 	var calls int
 	config := `{"Enabled":true}`
@@ -496,6 +593,14 @@ func (s *S) TestAutoScaleInfoCmdRun(c *check.C) {
 		"PreventRebalance":false,
 		"MaxMemoryRatio":1.20,
 		"Error": "something went wrong"
+	},
+	{
+		"MetadataFilter":"pool4",
+		"Enabled":true,
+		"ScaleDownRatio":1.33,
+		"CpuScaleUpThreshold":0.8,
+		"CpuScaleDownThreshold":0.6,
+		"Error": ""
 	}
 ]`
 	rulesTransport := cmdtest.ConditionalTransport{
@@ -516,13 +621,14 @@ func (s *S) TestAutoScaleInfoCmdRun(c *check.C) {
 	err := command.Run(&context, client)
 	c.Assert(err, check.IsNil)
 	expected := `Rules:
-+-------+---------------------+------------------+------------------+--------------------+---------+
-| Pool  | Max container count | Max memory ratio | Scale down ratio | Rebalance on scale | Enabled |
-+-------+---------------------+------------------+------------------+--------------------+---------+
-| pool1 | 6                   | 1.2000           | 1.3300           | true               | true    |
-| pool2 | 13                  | 0.9000           | 1.3300           | false              | true    |
-| pool3 | 50                  | 1.2000           | 1.3300           | true               | false   |
-+-------+---------------------+------------------+------------------+--------------------+---------+
++-------+---------------------+------------------+----------------+------------------+--------------------+---------+
+| Pool  | Max container count | Max memory ratio | Cpu thresholds | Scale down ratio | Rebalance on scale | Enabled |
++-------+---------------------+------------------+----------------+------------------+--------------------+---------+
+| pool1 | 6                   | 1.2000           | -              | 1.3300           | true               | true    |
+| pool2 | 13                  | 0.9000           | -              | 1.3300           | false              | true    |
+| pool3 | 50                  | 1.2000           | -              | 1.3300           | true               | false   |
+| pool4 | 0                   | 0.0000           | 0.8000/0.6000  | 1.3300           | true               | true    |
++-------+---------------------+------------------+----------------+------------------+--------------------+---------+
 `
 	c.Assert(buf.String(), check.Equals, expected)
 	c.Assert(calls, check.Equals, 2)
@@ -585,6 +691,41 @@ func (s *S) TestAutoScaleSetRuleCmdRun(c *check.C) {
 	c.Assert(buf.String(), check.Equals, "Rule successfully defined.\n")
 }
 
+func (s *S) TestAutoScaleSetRuleCmdRunCpuThresholds(c *check.C) {
+	var called bool
+	transport := cmdtest.ConditionalTransport{
+		Transport: cmdtest.Transport{Message: "", Status: http.StatusOK},
+		CondFunc: func(req *http.Request) bool {
+			called = true
+			err := req.ParseForm()
+			c.Assert(err, check.IsNil)
+			var rule autoScaleRule
+			err = form.DecodeValues(&rule, req.Form)
+			c.Assert(err, check.IsNil)
+			c.Assert(rule, check.DeepEquals, autoScaleRule{
+				MetadataFilter:        "pool1",
+				Enabled:               true,
+				CpuScaleUpThreshold:   0.8,
+				CpuScaleDownThreshold: 0.5,
+				ScaleDownRatio:        1.33,
+			})
+			return req.Method == "POST" && req.URL.Path == "/1.0/docker/autoscale/rules"
+		},
+	}
+	var buf bytes.Buffer
+	context := cmd.Context{Stdout: &buf}
+	var manager cmd.Manager
+	client := cmd.NewClient(&http.Client{Transport: &transport}, nil, &manager)
+	var command autoScaleSetRuleCmd
+	flags := []string{"-f", "pool1", "--cpu-scale-up-threshold", "0.8", "--cpu-scale-down-threshold", "0.5", "--enable"}
+	err := command.Flags().Parse(true, flags)
+	c.Assert(err, check.IsNil)
+	err = command.Run(&context, client)
+	c.Assert(err, check.IsNil)
+	c.Assert(called, check.Equals, true)
+	c.Assert(buf.String(), check.Equals, "Rule successfully defined.\n")
+}
+
 func (s *S) TestAutoScaleDeleteCmdRun(c *check.C) {
 	var called bool
 	transport := cmdtest.ConditionalTransport{
@@ -669,6 +810,91 @@ func (s *S) TestAutoScaleDeleteCmdRunDefaultAskForConfirmation(c *check.C) {
 	c.Assert(buf.String(), check.Equals, "Are you sure you want to remove the default rule? (y/n) Rule successfully removed.\n")
 }
 
+func (s *S) TestAutoScaleSetScheduleCmdRun(c *check.C) {
+	var called bool
+	transport := cmdtest.ConditionalTransport{
+		Transport: cmdtest.Transport{Message: "", Status: http.StatusOK},
+		CondFunc: func(req *http.Request) bool {
+			called = true
+			err := req.ParseForm()
+			c.Assert(err, check.IsNil)
+			var schedule autoScaleSchedule
+			err = form.DecodeValues(&schedule, req.Form)
+			c.Assert(err, check.IsNil)
+			c.Assert(schedule, check.DeepEquals, autoScaleSchedule{
+				MetadataFilter: "pool1",
+				Name:           "business",
+				Days:           "mon-fri",
+				Start:          "08:00",
+				End:            "20:00",
+				MinNodes:       10,
+			})
+			return req.Method == "POST" && req.URL.Path == "/1.0/docker/autoscale/schedules"
+		},
+	}
+	var buf bytes.Buffer
+	context := cmd.Context{Args: []string{"business"}, Stdout: &buf}
+	var manager cmd.Manager
+	client := cmd.NewClient(&http.Client{Transport: &transport}, nil, &manager)
+	var command autoScaleSetScheduleCmd
+	flags := []string{"-f", "pool1", "--days", "mon-fri", "--start", "08:00", "--end", "20:00", "--min", "10"}
+	err := command.Flags().Parse(true, flags)
+	c.Assert(err, check.IsNil)
+	err = command.Run(&context, client)
+	c.Assert(err, check.IsNil)
+	c.Assert(called, check.Equals, true)
+	c.Assert(buf.String(), check.Equals, "Schedule successfully defined.\n")
+}
+
+func (s *S) TestAutoScaleListSchedulesCmdRun(c *check.C) {
+	schedules := `[{"MetadataFilter":"pool1","Name":"business","Days":"mon-fri","Start":"08:00","End":"20:00","MinNodes":10},
+{"MetadataFilter":"pool1","Name":"night","Timezone":"UTC","MaxNodes":2}]`
+	transport := cmdtest.ConditionalTransport{
+		Transport: cmdtest.Transport{Message: schedules, Status: http.StatusOK},
+		CondFunc: func(req *http.Request) bool {
+			return req.Method == "GET" && req.URL.Path == "/1.0/docker/autoscale/schedules"
+		},
+	}
+	var buf bytes.Buffer
+	context := cmd.Context{Stdout: &buf}
+	var manager cmd.Manager
+	client := cmd.NewClient(&http.Client{Transport: &transport}, nil, &manager)
+	var command autoScaleListSchedulesCmd
+	err := command.Run(&context, client)
+	c.Assert(err, check.IsNil)
+	expected := `+-------+----------+---------+-------------+----------+-----------+-----------+
+| Pool  | Name     | Days    | Time        | Timezone | Min nodes | Max nodes |
++-------+----------+---------+-------------+----------+-----------+-----------+
+| pool1 | business | mon-fri | 08:00-20:00 |          | 10        | 0         |
+| pool1 | night    | all     | all day     | UTC      | 0         | 2         |
++-------+----------+---------+-------------+----------+-----------+-----------+
+`
+	c.Assert(buf.String(), check.Equals, expected)
+}
+
+func (s *S) TestAutoScaleDeleteScheduleCmdRun(c *check.C) {
+	var called bool
+	transport := cmdtest.ConditionalTransport{
+		Transport: cmdtest.Transport{Message: "", Status: http.StatusOK},
+		CondFunc: func(req *http.Request) bool {
+			called = true
+			return req.Method == "DELETE" && req.URL.Path == "/1.0/docker/autoscale/schedules/night" &&
+				req.URL.Query().Get("filter") == "pool1"
+		},
+	}
+	var buf bytes.Buffer
+	context := cmd.Context{Args: []string{"night"}, Stdout: &buf}
+	var manager cmd.Manager
+	client := cmd.NewClient(&http.Client{Transport: &transport}, nil, &manager)
+	var command autoScaleDeleteScheduleCmd
+	err := command.Flags().Parse(true, []string{"-y", "-f", "pool1"})
+	c.Assert(err, check.IsNil)
+	err = command.Run(&context, client)
+	c.Assert(err, check.IsNil)
+	c.Assert(called, check.Equals, true)
+	c.Assert(buf.String(), check.Equals, "Schedule successfully removed.\n")
+}
+
 func (s *S) TestDockerLogUpdateRun(c *check.C) {
 	var stdout, stderr bytes.Buffer
 	context := cmd.Context{
@@ -776,3 +1002,94 @@ Log driver [pool p1]: x
 Log driver [pool p2]: bs
 `)
 }
+
+func (s *S) TestSchedulerInfoRun(c *check.C) {
+	var stdout, stderr bytes.Buffer
+	context := cmd.Context{
+		Stdout: &stdout,
+		Stderr: &stderr,
+	}
+	conf := map[string]schedulerConfig{
+		"p2": {Strategy: "binpack"},
+		"p1": {Strategy: "spread"},
+	}
+	result, _ := json.Marshal(conf)
+	trans := &cmdtest.ConditionalTransport{
+		Transport: cmdtest.Transport{Message: string(result), Status: http.StatusOK},
+		CondFunc: func(req *http.Request) bool {
+			return req.URL.Path == "/1.0/docker/scheduler" && req.Method == "GET"
+		},
+	}
+	manager := cmd.NewManager("admin", "0.1", "admin-ver", &stdout, &stderr, nil, nil)
+	client := cmd.NewClient(&http.Client{Transport: trans}, nil, manager)
+	cmd := schedulerInfo{}
+	err := cmd.Run(&context, client)
+	c.Assert(err, check.IsNil)
+	c.Assert(stdout.String(), check.Equals, `+-----------+----------+
+| Pool      | Strategy |
++-----------+----------+
+| [default] | spread   |
+| p1        | spread   |
+| p2        | binpack  |
++-----------+----------+
+`)
+}
+
+func (s *S) TestSchedulerUpdateRun(c *check.C) {
+	var stdout bytes.Buffer
+	context := cmd.Context{Args: []string{"binpack"}, Stdout: &stdout}
+	trans := &cmdtest.ConditionalTransport{
+		Transport: cmdtest.Transport{Message: "", Status: http.StatusOK},
+		CondFunc: func(req *http.Request) bool {
+			return req.URL.Path == "/1.0/docker/scheduler" && req.Method == "POST" &&
+				req.FormValue("pool") == "dev" && req.FormValue("strategy") == "binpack"
+		},
+	}
+	manager := cmd.Manager{}
+	client := cmd.NewClient(&http.Client{Transport: trans}, nil, &manager)
+	cmd := schedulerUpdate{}
+	cmd.Flags().Parse(true, []string{"-p", "dev"})
+	err := cmd.Run(&context, client)
+	c.Assert(err, check.IsNil)
+	c.Assert(stdout.String(), check.Equals, "Scheduler strategy successfully updated.\n")
+}
+
+func (s *S) TestListOrphansCmdRun(c *check.C) {
+	orphans := `[{"Kind":"machine","IaaS":"ec2","MachineID":"i-1","Address":"10.0.0.1","Pool":"pool1","Reason":"machine is not registered as a node","FirstSeen":"2016-08-01T10:00:00Z"},
+{"Kind":"node","IaaS":"ec2","MachineID":"i-2","Address":"http://10.0.0.2:2375","Pool":"pool1","Reason":"machine was not found in the IaaS","FirstSeen":"2016-08-01T11:00:00Z"}]`
+	transport := cmdtest.ConditionalTransport{
+		Transport: cmdtest.Transport{Message: orphans, Status: http.StatusOK},
+		CondFunc: func(req *http.Request) bool {
+			return req.Method == "GET" && req.URL.Path == "/1.0/docker/orphans"
+		},
+	}
+	var buf bytes.Buffer
+	context := cmd.Context{Stdout: &buf}
+	var manager cmd.Manager
+	client := cmd.NewClient(&http.Client{Transport: &transport}, nil, &manager)
+	var command listOrphansCmd
+	err := command.Run(&context, client)
+	c.Assert(err, check.IsNil)
+	first := time.Date(2016, 8, 1, 10, 0, 0, 0, time.UTC).Local().Format(time.Stamp)
+	second := time.Date(2016, 8, 1, 11, 0, 0, 0, time.UTC).Local().Format(time.Stamp)
+	expected := `+---------+------+---------+----------------------+-------+-------------------------------------+-----------------+
+| Kind    | IaaS | Machine | Address              | Pool  | Reason                              | First seen      |
++---------+------+---------+----------------------+-------+-------------------------------------+-----------------+
+| machine | ec2  | i-1     | 10.0.0.1             | pool1 | machine is not registered as a node | ` + first + ` |
+| node    | ec2  | i-2     | http://10.0.0.2:2375 | pool1 | machine was not found in the IaaS   | ` + second + ` |
++---------+------+---------+----------------------+-------+-------------------------------------+-----------------+
+`
+	c.Assert(buf.String(), check.Equals, expected)
+}
+
+func (s *S) TestListOrphansCmdRunNoContent(c *check.C) {
+	transport := cmdtest.Transport{Message: "", Status: http.StatusNoContent}
+	var buf bytes.Buffer
+	context := cmd.Context{Stdout: &buf}
+	var manager cmd.Manager
+	client := cmd.NewClient(&http.Client{Transport: &transport}, nil, &manager)
+	var command listOrphansCmd
+	err := command.Run(&context, client)
+	c.Assert(err, check.IsNil)
+	c.Assert(buf.String(), check.Equals, "No orphans found.\n")
+}
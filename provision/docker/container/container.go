@@ -70,6 +70,8 @@ type Container struct {
 	LastStatusUpdate        time.Time
 	LastSuccessStatusUpdate time.Time
 	LockedUntil             time.Time
+	HealCount               int
+	LastHealTime            time.Time
 	Routable                bool `bson:"-"`
 	ExposedPort             string
 }
@@ -266,7 +268,9 @@ func (c *Container) SetStatus(p DockerProvisioner, status provision.Status, upda
 	if c.Status == provision.StatusStarted.String() ||
 		c.Status == provision.StatusStarting.String() {
 		c.LastSuccessStatusUpdate = c.LastStatusUpdate
+		c.HealCount = 0
 		updateData["lastsuccessstatusupdate"] = c.LastSuccessStatusUpdate
+		updateData["healcount"] = c.HealCount
 	}
 	if !updateDB {
 		return nil
@@ -276,6 +280,19 @@ func (c *Container) SetStatus(p DockerProvisioner, status provision.Status, upda
 	return coll.Update(bson.M{"id": c.ID, "status": bson.M{"$ne": provision.StatusBuilding.String()}}, bson.M{"$set": updateData})
 }
 
+// SetHealCount stores the number of times in a row the container was healed
+// without reporting a successful status.
+func (c *Container) SetHealCount(p DockerProvisioner, count int) error {
+	c.HealCount = count
+	c.LastHealTime = time.Now().In(time.UTC)
+	coll := p.Collection()
+	defer coll.Close()
+	return coll.Update(bson.M{"id": c.ID}, bson.M{"$set": bson.M{
+		"healcount":    c.HealCount,
+		"lasthealtime": c.LastHealTime,
+	}})
+}
+
 func (c *Container) SetImage(p DockerProvisioner, imageId string) error {
 	c.Image = imageId
 	coll := p.Collection()
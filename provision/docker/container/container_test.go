@@ -524,6 +524,32 @@ func (s *S) TestContainerSetStatusStarted(c *check.C) {
 	c.Assert(c2.LastSuccessStatusUpdate.IsZero(), check.Equals, false)
 }
 
+func (s *S) TestContainerSetStatusStartedResetsHealCount(c *check.C) {
+	container := Container{ID: "telnet"}
+	coll := s.p.Collection()
+	defer coll.Close()
+	err := coll.Insert(container)
+	c.Assert(err, check.IsNil)
+	defer coll.Remove(bson.M{"id": container.ID})
+	err = container.SetHealCount(s.p, 3)
+	c.Assert(err, check.IsNil)
+	var c2 Container
+	err = coll.Find(bson.M{"id": container.ID}).One(&c2)
+	c.Assert(err, check.IsNil)
+	c.Assert(c2.HealCount, check.Equals, 3)
+	c.Assert(c2.LastHealTime.IsZero(), check.Equals, false)
+	err = c2.SetStatus(s.p, provision.StatusError, true)
+	c.Assert(err, check.IsNil)
+	err = coll.Find(bson.M{"id": container.ID}).One(&c2)
+	c.Assert(err, check.IsNil)
+	c.Assert(c2.HealCount, check.Equals, 3)
+	err = c2.SetStatus(s.p, provision.StatusStarted, true)
+	c.Assert(err, check.IsNil)
+	err = coll.Find(bson.M{"id": container.ID}).One(&c2)
+	c.Assert(err, check.IsNil)
+	c.Assert(c2.HealCount, check.Equals, 0)
+}
+
 func (s *S) TestContainerSetStatusBuilding(c *check.C) {
 	c1 := Container{
 		ID:     "something-300",
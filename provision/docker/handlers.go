@@ -24,16 +24,19 @@ import (
 	"github.com/tsuru/tsuru/app"
 	"github.com/tsuru/tsuru/auth"
 	"github.com/tsuru/tsuru/errors"
+	"github.com/tsuru/tsuru/event"
 	"github.com/tsuru/tsuru/iaas"
 	_ "github.com/tsuru/tsuru/iaas/cloudstack"
 	_ "github.com/tsuru/tsuru/iaas/digitalocean"
 	_ "github.com/tsuru/tsuru/iaas/ec2"
+	_ "github.com/tsuru/tsuru/iaas/openstack"
 	tsuruIo "github.com/tsuru/tsuru/io"
 	"github.com/tsuru/tsuru/net"
 	"github.com/tsuru/tsuru/permission"
 	"github.com/tsuru/tsuru/provision/docker/container"
 	"github.com/tsuru/tsuru/provision/docker/healer"
 	"github.com/tsuru/tsuru/provision/docker/nodecontainer"
+	"github.com/tsuru/tsuru/provision/docker/nodestate"
 	"github.com/tsuru/tsuru/queue"
 	"gopkg.in/mgo.v2"
 )
@@ -44,6 +47,9 @@ func init() {
 	api.RegisterHandler("/docker/node/{address:.*}/containers", "GET", api.AuthorizationRequiredHandler(listContainersByNode))
 	api.RegisterHandler("/docker/node", "POST", api.AuthorizationRequiredHandler(addNodeHandler))
 	api.RegisterHandler("/docker/node", "PUT", api.AuthorizationRequiredHandler(updateNodeHandler))
+	api.RegisterHandler("/docker/node/{address:.*}/cordon", "POST", api.AuthorizationRequiredHandler(cordonNodeHandler))
+	api.RegisterHandler("/docker/node/{address:.*}/uncordon", "POST", api.AuthorizationRequiredHandler(uncordonNodeHandler))
+	api.RegisterHandler("/docker/node/{address:.*}/drain", "POST", api.AuthorizationRequiredHandler(drainNodeHandler))
 	api.RegisterHandler("/docker/node/{address:.*}", "DELETE", api.AuthorizationRequiredHandler(removeNodeHandler))
 	api.RegisterHandler("/docker/container/{id}/move", "POST", api.AuthorizationRequiredHandler(moveContainerHandler))
 	api.RegisterHandler("/docker/containers/move", "POST", api.AuthorizationRequiredHandler(moveContainersHandler))
@@ -52,13 +58,18 @@ func init() {
 	api.RegisterHandler("/docker/healing/node", "GET", api.AuthorizationRequiredHandler(nodeHealingRead))
 	api.RegisterHandler("/docker/healing/node", "POST", api.AuthorizationRequiredHandler(nodeHealingUpdate))
 	api.RegisterHandler("/docker/healing/node", "DELETE", api.AuthorizationRequiredHandler(nodeHealingDelete))
+	api.RegisterHandler("/docker/healing/node/resume", "POST", api.AuthorizationRequiredHandler(nodeHealingResume))
 	api.RegisterHandler("/docker/autoscale", "GET", api.AuthorizationRequiredHandler(autoScaleHistoryHandler))
 	api.RegisterHandler("/docker/autoscale/config", "GET", api.AuthorizationRequiredHandler(autoScaleGetConfig))
 	api.RegisterHandler("/docker/autoscale/run", "POST", api.AuthorizationRequiredHandler(autoScaleRunHandler))
+	api.RegisterHandler("/docker/autoscale/simulate", "POST", api.AuthorizationRequiredHandler(autoScaleSimulateHandler))
 	api.RegisterHandler("/docker/autoscale/rules", "GET", api.AuthorizationRequiredHandler(autoScaleListRules))
 	api.RegisterHandler("/docker/autoscale/rules", "POST", api.AuthorizationRequiredHandler(autoScaleSetRule))
 	api.RegisterHandler("/docker/autoscale/rules", "DELETE", api.AuthorizationRequiredHandler(autoScaleDeleteRule))
 	api.RegisterHandler("/docker/autoscale/rules/{id}", "DELETE", api.AuthorizationRequiredHandler(autoScaleDeleteRule))
+	api.RegisterHandler("/docker/autoscale/schedules", "GET", api.AuthorizationRequiredHandler(autoScaleListSchedules))
+	api.RegisterHandler("/docker/autoscale/schedules", "POST", api.AuthorizationRequiredHandler(autoScaleSetSchedule))
+	api.RegisterHandler("/docker/autoscale/schedules/{name}", "DELETE", api.AuthorizationRequiredHandler(autoScaleDeleteSchedule))
 	api.RegisterHandler("/docker/bs/upgrade", "POST", api.AuthorizationRequiredHandler(bsUpgradeHandler))
 	api.RegisterHandler("/docker/bs/env", "POST", api.AuthorizationRequiredHandler(bsEnvSetHandler))
 	api.RegisterHandler("/docker/bs", "GET", api.AuthorizationRequiredHandler(bsConfigGetHandler))
@@ -68,8 +79,12 @@ func init() {
 	api.RegisterHandler("/docker/nodecontainers/{name}", "DELETE", api.AuthorizationRequiredHandler(nodeContainerDelete))
 	api.RegisterHandler("/docker/nodecontainers/{name}", "POST", api.AuthorizationRequiredHandler(nodeContainerUpdate))
 	api.RegisterHandler("/docker/nodecontainers/{name}/upgrade", "POST", api.AuthorizationRequiredHandler(nodeContainerUpgrade))
+	api.RegisterHandler("/docker/nodecontainers/{name}/status", "GET", api.AuthorizationRequiredHandler(nodeContainerStatus))
+	api.RegisterHandler("/docker/orphans", "GET", api.AuthorizationRequiredHandler(orphansList))
 	api.RegisterHandler("/docker/logs", "GET", api.AuthorizationRequiredHandler(logsConfigGetHandler))
 	api.RegisterHandler("/docker/logs", "POST", api.AuthorizationRequiredHandler(logsConfigSetHandler))
+	api.RegisterHandler("/docker/scheduler", "GET", api.AuthorizationRequiredHandler(schedulerConfigGetHandler))
+	api.RegisterHandler("/docker/scheduler", "POST", api.AuthorizationRequiredHandler(schedulerConfigSetHandler))
 }
 
 // title: get autoscale config
@@ -160,6 +175,79 @@ func autoScaleDeleteRule(w http.ResponseWriter, r *http.Request, t auth.Token) e
 	return nil
 }
 
+// title: autoscale schedules list
+// path: /docker/autoscale/schedules
+// method: GET
+// produce: application/json
+// responses:
+//   200: Ok
+//   204: No content
+//   401: Unauthorized
+func autoScaleListSchedules(w http.ResponseWriter, r *http.Request, t auth.Token) error {
+	if !permission.Check(t, permission.PermNodeAutoscale) {
+		return permission.ErrUnauthorized
+	}
+	schedules, err := listAutoScaleSchedules(nil)
+	if err != nil {
+		return err
+	}
+	if len(schedules) == 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return nil
+	}
+	w.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(schedules)
+}
+
+// title: autoscale set schedule
+// path: /docker/autoscale/schedules
+// method: POST
+// consume: application/x-www-form-urlencoded
+// responses:
+//   200: Ok
+//   400: Invalid data
+//   401: Unauthorized
+func autoScaleSetSchedule(w http.ResponseWriter, r *http.Request, t auth.Token) error {
+	if !permission.Check(t, permission.PermNodeAutoscale) {
+		return permission.ErrUnauthorized
+	}
+	err := r.ParseForm()
+	if err != nil {
+		return &errors.HTTP{Code: http.StatusBadRequest, Message: err.Error()}
+	}
+	var schedule autoScaleSchedule
+	dec := form.NewDecoder(nil)
+	dec.IgnoreUnknownKeys(true)
+	err = dec.DecodeValues(&schedule, r.Form)
+	if err != nil {
+		return &errors.HTTP{Code: http.StatusBadRequest, Message: err.Error()}
+	}
+	err = schedule.validate()
+	if err != nil {
+		return &errors.HTTP{Code: http.StatusBadRequest, Message: err.Error()}
+	}
+	return schedule.update()
+}
+
+// title: delete autoscale schedule
+// path: /docker/autoscale/schedules/{name}
+// method: DELETE
+// responses:
+//   200: Ok
+//   401: Unauthorized
+//   404: Not found
+func autoScaleDeleteSchedule(w http.ResponseWriter, r *http.Request, t auth.Token) error {
+	if !permission.Check(t, permission.PermNodeAutoscale) {
+		return permission.ErrUnauthorized
+	}
+	name := r.URL.Query().Get(":name")
+	err := deleteAutoScaleSchedule(r.URL.Query().Get("filter"), name)
+	if err == mgo.ErrNotFound {
+		return &errors.HTTP{Code: http.StatusNotFound, Message: "schedule not found"}
+	}
+	return err
+}
+
 func validateNodeAddress(address string) error {
 	if address == "" {
 		return fmt.Errorf("address=url parameter is required")
@@ -195,12 +283,14 @@ func (p *dockerProvisioner) addNodeForParams(params map[string]string, isRegiste
 		machineID = m.Id
 	}
 	err := validateNodeAddress(address)
-	if err != nil {
-		return response, err
+	if err == nil {
+		node := cluster.Node{Address: address, Metadata: params, CreationStatus: cluster.NodeCreationStatusPending}
+		err = p.Cluster().Register(node)
 	}
-	node := cluster.Node{Address: address, Metadata: params, CreationStatus: cluster.NodeCreationStatusPending}
-	err = p.Cluster().Register(node)
 	if err != nil {
+		if machineID != "" {
+			return response, destroyUnregisteredMachine(machineID, err)
+		}
 		return response, err
 	}
 	q, err := queue.Queue()
@@ -212,6 +302,19 @@ func (p *dockerProvisioner) addNodeForParams(params map[string]string, isRegiste
 	return response, err
 }
 
+// destroyUnregisteredMachine destroys a machine created for a node that
+// could not be registered, so that it's not left behind in the IaaS.
+func destroyUnregisteredMachine(machineID string, registerErr error) error {
+	m, err := iaas.FindMachineById(machineID)
+	if err == nil {
+		err = m.Destroy()
+	}
+	if err != nil {
+		return fmt.Errorf("machine %s was created but could not be registered as a node: %s (unable to destroy machine: %s)", machineID, registerErr, err)
+	}
+	return fmt.Errorf("machine %s was created but could not be registered as a node and was destroyed: %s", machineID, registerErr)
+}
+
 type addNodeOptions struct {
 	Metadata map[string]string
 	Register bool
@@ -328,7 +431,14 @@ func removeNodeHandler(w http.ResponseWriter, r *http.Request, t auth.Token) err
 		}
 		return m.Destroy()
 	}
-	return nil
+	m, err := iaas.FindMachineByIdOrAddress(node.Metadata["iaas-id"], net.URLToHost(address))
+	if err == mgo.ErrNotFound {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return keepOrphanMachine(&m)
 }
 
 // title: list nodes
@@ -383,14 +493,119 @@ func listNodesHandler(w http.ResponseWriter, r *http.Request, t auth.Token) erro
 		w.WriteHeader(http.StatusNoContent)
 		return nil
 	}
+	nodeList := make([]nodeListEntry, len(nodes))
+	for i := range nodes {
+		nodeList[i] = nodeListEntry{
+			Address:  nodes[i].Address,
+			Metadata: nodes[i].Metadata,
+			Status:   nodes[i].Status(),
+		}
+		if state := nodestate.Get(&nodes[i]); state != "" {
+			nodeList[i].Status = fmt.Sprintf("%s (%s)", nodeList[i].Status, state)
+		}
+	}
 	result := map[string]interface{}{
-		"nodes":    nodes,
+		"nodes":    nodeList,
 		"machines": machines,
 	}
 	w.Header().Set("Content-Type", "application/json")
 	return json.NewEncoder(w).Encode(result)
 }
 
+type nodeListEntry struct {
+	Address  string
+	Metadata map[string]string
+	Status   string
+}
+
+func nodeForMaintenance(address string, t auth.Token) (*cluster.Node, error) {
+	if address == "" {
+		return nil, &errors.HTTP{Code: http.StatusBadRequest, Message: "Node address is required."}
+	}
+	node, err := mainDockerProvisioner.Cluster().GetNode(address)
+	if err != nil {
+		return nil, &errors.HTTP{
+			Code:    http.StatusNotFound,
+			Message: fmt.Sprintf("Node %s not found.", address),
+		}
+	}
+	allowed := permission.Check(t, permission.PermNodeUpdate,
+		permission.Context(permission.CtxPool, node.Metadata["pool"]),
+	)
+	if !allowed {
+		return nil, permission.ErrUnauthorized
+	}
+	return &node, nil
+}
+
+// title: cordon node
+// path: /docker/node/{address}/cordon
+// method: POST
+// responses:
+//   200: Ok
+//   400: Invalid data
+//   401: Unauthorized
+//   404: Not found
+func cordonNodeHandler(w http.ResponseWriter, r *http.Request, t auth.Token) error {
+	node, err := nodeForMaintenance(r.URL.Query().Get(":address"), t)
+	if err != nil {
+		return err
+	}
+	return mainDockerProvisioner.setNodeMaintenanceState(node.Address, nodestate.Cordoned)
+}
+
+// title: uncordon node
+// path: /docker/node/{address}/uncordon
+// method: POST
+// responses:
+//   200: Ok
+//   400: Invalid data
+//   401: Unauthorized
+//   404: Not found
+func uncordonNodeHandler(w http.ResponseWriter, r *http.Request, t auth.Token) error {
+	node, err := nodeForMaintenance(r.URL.Query().Get(":address"), t)
+	if err != nil {
+		return err
+	}
+	return mainDockerProvisioner.setNodeMaintenanceState(node.Address, "")
+}
+
+// title: drain node
+// path: /docker/node/{address}/drain
+// method: POST
+// consume: application/x-www-form-urlencoded
+// produce: application/x-json-stream
+// responses:
+//   200: Ok
+//   400: Invalid data
+//   401: Unauthorized
+//   404: Not found
+func drainNodeHandler(w http.ResponseWriter, r *http.Request, t auth.Token) error {
+	node, err := nodeForMaintenance(r.URL.Query().Get(":address"), t)
+	if err != nil {
+		return err
+	}
+	var interval time.Duration
+	if value := r.FormValue("interval"); value != "" {
+		seconds, parseErr := strconv.Atoi(value)
+		if parseErr != nil || seconds < 0 {
+			return &errors.HTTP{Code: http.StatusBadRequest, Message: "interval must be a non negative number of seconds"}
+		}
+		interval = time.Duration(seconds) * time.Second
+	}
+	w.Header().Set("Content-Type", "application/x-json-stream")
+	keepAliveWriter := tsuruIo.NewKeepAliveWriter(w, 15*time.Second, "")
+	defer keepAliveWriter.Stop()
+	writer := &tsuruIo.SimpleJsonMessageEncoderWriter{Encoder: json.NewEncoder(keepAliveWriter)}
+	err = mainDockerProvisioner.drainNode(node.Address, interval, writer)
+	if err != nil {
+		fmt.Fprintf(writer, "Error trying to drain node: %s\n", err.Error())
+	} else {
+		fmt.Fprintf(writer, "Node %s drained successfully, it's now cordoned.\n", node.Address)
+	}
+	return nil
+}
+
 type updateNodeOptions struct {
 	Address  string
 	Metadata map[string]string
@@ -786,6 +1001,31 @@ func autoScaleRunHandler(w http.ResponseWriter, r *http.Request, t auth.Token) e
 	return nil
 }
 
+// title: autoscale simulate
+// path: /docker/autoscale/simulate
+// method: POST
+// produce: application/json
+// responses:
+//   200: Ok
+//   204: No content
+//   401: Unauthorized
+func autoScaleSimulateHandler(w http.ResponseWriter, r *http.Request, t auth.Token) error {
+	if !permission.Check(t, permission.PermNodeAutoscale) {
+		return permission.ErrUnauthorized
+	}
+	autoScaleConfig := mainDockerProvisioner.initAutoScaleConfig()
+	simulations, err := autoScaleConfig.simulate()
+	if err != nil {
+		return err
+	}
+	if len(simulations) == 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return nil
+	}
+	w.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(simulations)
+}
+
 func bsEnvSetHandler(w http.ResponseWriter, r *http.Request, t auth.Token) error {
 	return stderror.New("this route is deprecated, please use POST /docker/nodecontainer/{name} (node-container-update command)")
 }
@@ -900,6 +1140,61 @@ func logsConfigSetHandler(w http.ResponseWriter, r *http.Request, t auth.Token)
 	return nil
 }
 
+// title: scheduler config
+// path: /docker/scheduler
+// method: GET
+// produce: application/json
+// responses:
+//   200: Ok
+//   401: Unauthorized
+func schedulerConfigGetHandler(w http.ResponseWriter, r *http.Request, t auth.Token) error {
+	pools, err := listContextValues(t, permission.PermPoolUpdateScheduler, true)
+	if err != nil {
+		return err
+	}
+	configEntries, err := schedulerConfigLoadAll()
+	if err != nil {
+		return err
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if len(pools) == 0 {
+		return json.NewEncoder(w).Encode(configEntries)
+	}
+	newMap := map[string]schedulerConfig{}
+	for _, p := range pools {
+		if entry, ok := configEntries[p]; ok {
+			newMap[p] = entry
+		}
+	}
+	return json.NewEncoder(w).Encode(newMap)
+}
+
+// title: scheduler config set
+// path: /docker/scheduler
+// method: POST
+// consume: application/x-www-form-urlencoded
+// responses:
+//   200: Ok
+//   400: Invalid data
+//   401: Unauthorized
+func schedulerConfigSetHandler(w http.ResponseWriter, r *http.Request, t auth.Token) error {
+	pool := r.FormValue("pool")
+	if pool == "" && !permission.Check(t, permission.PermPoolUpdateScheduler) {
+		return permission.ErrUnauthorized
+	}
+	hasPermission := permission.Check(t, permission.PermPoolUpdateScheduler,
+		permission.Context(permission.CtxPool, pool))
+	if !hasPermission {
+		return permission.ErrUnauthorized
+	}
+	conf := schedulerConfig{Strategy: r.FormValue("strategy")}
+	err := conf.save(pool)
+	if err != nil {
+		return &errors.HTTP{Code: http.StatusBadRequest, Message: err.Error()}
+	}
+	return nil
+}
+
 func tryRestartAppsByFilter(filter *app.Filter, writer io.Writer) error {
 	apps, err := app.List(filter)
 	if err != nil {
@@ -1031,6 +1326,33 @@ func nodeHealingDelete(w http.ResponseWriter, r *http.Request, t auth.Token) err
 	return nil
 }
 
+// title: resume node healing
+// path: /docker/healing/node/resume
+// method: POST
+// consume: application/x-www-form-urlencoded
+// responses:
+//   200: Ok
+//   401: Unauthorized
+//   404: Not found
+func nodeHealingResume(w http.ResponseWriter, r *http.Request, t auth.Token) error {
+	poolName := r.FormValue("pool")
+	if poolName == "" {
+		if !permission.Check(t, permission.PermHealingUpdate) {
+			return permission.ErrUnauthorized
+		}
+	} else {
+		if !permission.Check(t, permission.PermHealingUpdate,
+			permission.Context(permission.CtxPool, poolName)) {
+			return permission.ErrUnauthorized
+		}
+	}
+	err := healer.ResumePool(poolName)
+	if err == healer.ErrPoolNotPaused {
+		return &errors.HTTP{Code: http.StatusNotFound, Message: err.Error()}
+	}
+	return err
+}
+
 // title: remove node container list
 // path: /docker/nodecontainers
 // method: GET
@@ -1248,6 +1570,7 @@ func nodeContainerDelete(w http.ResponseWriter, r *http.Request, t auth.Token) e
 //   400: Invald data
 //   401: Unauthorized
 //   404: Not found
+//   409: Upgrade already running
 func nodeContainerUpgrade(w http.ResponseWriter, r *http.Request, t auth.Token) error {
 	name := r.URL.Query().Get(":name")
 	poolName := r.FormValue("pool")
@@ -1261,7 +1584,32 @@ func nodeContainerUpgrade(w http.ResponseWriter, r *http.Request, t auth.Token)
 			return permission.ErrUnauthorized
 		}
 	}
-	err := nodecontainer.ResetImage(poolName, name)
+	opts, err := rolloutOptionsFromForm(r)
+	if err != nil {
+		return &errors.HTTP{Code: http.StatusBadRequest, Message: err.Error()}
+	}
+	opts.Pool = poolName
+	var extraTargets []event.Target
+	if poolName != "" {
+		extraTargets = []event.Target{{Type: event.TargetTypePool, Value: poolName}}
+	}
+	evt, err := event.New(&event.Opts{
+		Target:       event.Target{Type: event.TargetTypeNodeContainer, Value: name},
+		ExtraTargets: extraTargets,
+		Kind:         permission.PermNodecontainerUpdateUpgrade,
+		Owner:        t,
+		CustomData:   opts,
+		Cancelable:   true,
+	})
+	if err != nil {
+		if _, ok := err.(event.ErrEventLocked); ok {
+			return &errors.HTTP{Code: http.StatusConflict, Message: err.Error()}
+		}
+		return err
+	}
+	var results []nodecontainer.RolloutNodeResult
+	defer func() { evt.DoneCustomData(err, results) }()
+	err = nodecontainer.ResetImage(poolName, name)
 	if err != nil {
 		if err == nodecontainer.ErrNodeContainerNotFound {
 			return &errors.HTTP{
@@ -1271,9 +1619,151 @@ func nodeContainerUpgrade(w http.ResponseWriter, r *http.Request, t auth.Token)
 		}
 		return err
 	}
+	opts.Event = evt
 	w.Header().Set("Content-Type", "application/x-json-stream")
 	keepAliveWriter := tsuruIo.NewKeepAliveWriter(w, 15*time.Second, "")
 	defer keepAliveWriter.Stop()
 	writer := &tsuruIo.SimpleJsonMessageEncoderWriter{Encoder: json.NewEncoder(keepAliveWriter)}
-	return nodecontainer.RecreateNamedContainers(mainDockerProvisioner, writer, name)
+	evt.SetLogWriter(writer)
+	results, err = nodecontainer.RolloutNamedContainer(mainDockerProvisioner, evt, name, opts)
+	return err
+}
+
+// title: node container status
+// path: /docker/nodecontainers/{name}/status
+// method: GET
+// produce: application/json
+// responses:
+//   200: Ok
+//   204: No content
+//   401: Unauthorized
+//   404: Not found
+func nodeContainerStatus(w http.ResponseWriter, r *http.Request, t auth.Token) error {
+	pools, err := listContextValues(t, permission.PermNodecontainerRead, true)
+	if err != nil {
+		return err
+	}
+	name := r.URL.Query().Get(":name")
+	poolName := r.URL.Query().Get("pool")
+	_, err = nodecontainer.LoadNodeContainer("", name)
+	if err != nil {
+		if err == nodecontainer.ErrNodeContainerNotFound {
+			return &errors.HTTP{
+				Code:    http.StatusNotFound,
+				Message: err.Error(),
+			}
+		}
+		return err
+	}
+	allNodes, err := mainDockerProvisioner.Cluster().UnfilteredNodes()
+	if err != nil {
+		return err
+	}
+	poolMap := map[string]struct{}{}
+	for _, p := range pools {
+		poolMap[p] = struct{}{}
+	}
+	var nodes []cluster.Node
+	for _, n := range allNodes {
+		nodePool := n.Metadata["pool"]
+		if poolName != "" && nodePool != poolName {
+			continue
+		}
+		if _, ok := poolMap[nodePool]; pools != nil && !ok {
+			continue
+		}
+		nodes = append(nodes, n)
+	}
+	if len(nodes) == 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return nil
+	}
+	statuses, err := nodecontainer.ContainerStatuses(mainDockerProvisioner, name, nodes...)
+	if err != nil {
+		return err
+	}
+	if len(statuses) == 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return nil
+	}
+	w.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(statuses)
+}
+
+// title: orphan machines and nodes list
+// path: /docker/orphans
+// method: GET
+// produce: application/json
+// responses:
+//   200: Ok
+//   204: No content
+//   401: Unauthorized
+func orphansList(w http.ResponseWriter, r *http.Request, t auth.Token) error {
+	contexts := permission.ContextsForPermission(t, permission.PermMachineRead)
+	if len(contexts) == 0 {
+		return permission.ErrUnauthorized
+	}
+	allowedIaaS := map[string]struct{}{}
+	for _, c := range contexts {
+		if c.CtxType == permission.CtxGlobal {
+			allowedIaaS = nil
+			break
+		}
+		if c.CtxType == permission.CtxIaaS {
+			allowedIaaS[c.Value] = struct{}{}
+		}
+	}
+	orphans, err := listOrphans(mainDockerProvisioner)
+	if err != nil {
+		return err
+	}
+	for i := 0; allowedIaaS != nil && i < len(orphans); i++ {
+		if _, ok := allowedIaaS[orphans[i].IaaS]; !ok {
+			orphans = append(orphans[:i], orphans[i+1:]...)
+			i--
+		}
+	}
+	if len(orphans) == 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return nil
+	}
+	w.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(orphans)
+}
+
+func rolloutOptionsFromForm(r *http.Request) (nodecontainer.RolloutOptions, error) {
+	var opts nodecontainer.RolloutOptions
+	intValues := map[string]*int{
+		"batchsize":    &opts.BatchSize,
+		"batchpercent": &opts.BatchPercent,
+		"probeport":    &opts.ProbePort,
+	}
+	for key, dst := range intValues {
+		value := r.FormValue(key)
+		if value == "" {
+			continue
+		}
+		parsed, err := strconv.Atoi(value)
+		if err != nil {
+			return opts, fmt.Errorf("invalid value for %s: %s", key, value)
+		}
+		*dst = parsed
+	}
+	durationValues := map[string]*time.Duration{
+		"pause":         &opts.Pause,
+		"healthtimeout": &opts.HealthTimeout,
+	}
+	for key, dst := range durationValues {
+		value := r.FormValue(key)
+		if value == "" {
+			continue
+		}
+		seconds, err := strconv.Atoi(value)
+		if err != nil {
+			return opts, fmt.Errorf("invalid value for %s: %s", key, value)
+		}
+		*dst = time.Duration(seconds) * time.Second
+	}
+	opts.ProbePath = r.FormValue("probepath")
+	return opts, opts.Validate()
 }
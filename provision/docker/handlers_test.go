@@ -32,14 +32,17 @@ import (
 	"github.com/tsuru/tsuru/db/dbtest"
 	tsuruErrors "github.com/tsuru/tsuru/errors"
 	"github.com/tsuru/tsuru/event"
+	"github.com/tsuru/tsuru/event/eventtest"
 	"github.com/tsuru/tsuru/iaas"
 	tsuruIo "github.com/tsuru/tsuru/io"
 	tsuruNet "github.com/tsuru/tsuru/net"
 	"github.com/tsuru/tsuru/permission"
 	"github.com/tsuru/tsuru/provision"
 	"github.com/tsuru/tsuru/provision/docker/container"
+	"github.com/tsuru/tsuru/provision/docker/dockertest"
 	"github.com/tsuru/tsuru/provision/docker/healer"
 	"github.com/tsuru/tsuru/provision/docker/nodecontainer"
+	"github.com/tsuru/tsuru/provision/docker/nodestate"
 	"github.com/tsuru/tsuru/provision/provisiontest"
 	"github.com/tsuru/tsuru/queue"
 	"github.com/tsuru/tsuru/quota"
@@ -311,6 +314,80 @@ func (s *HandlersSuite) TestAddNodeHandlerCreatingAnIaasMachineExplicit(c *check
 	})
 }
 
+func (s *HandlersSuite) TestAddNodeHandlerWithTemplate(c *check.C) {
+	iaas.RegisterIaasProvider("test-iaas", newTestIaaS)
+	mainDockerProvisioner.cluster, _ = cluster.New(&segregatedScheduler{}, &cluster.MapStorage{}, "")
+	tpl := iaas.Template{
+		Name:     "tpl1",
+		IaaSName: "test-iaas",
+		Params: iaas.TemplateParamList{
+			{Name: "size", Type: iaas.TemplateParamString, Required: true, Values: []string{"small", "large"}},
+		},
+	}
+	err := tpl.Save()
+	c.Assert(err, check.IsNil)
+	defer iaas.DestroyTemplate("tpl1")
+	params := addNodeOptions{
+		Register: false,
+		Metadata: map[string]string{
+			"id":       "test1",
+			"pool":     "pool1",
+			"template": "tpl1",
+			"size":     "huge",
+		},
+	}
+	v, err := form.EncodeToValues(&params)
+	c.Assert(err, check.IsNil)
+	b := strings.NewReader(v.Encode())
+	req, err := http.NewRequest("POST", "/docker/node", b)
+	c.Assert(err, check.IsNil)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Authorization", s.token.GetValue())
+	rec := httptest.NewRecorder()
+	m := api.RunServer(true)
+	m.ServeHTTP(rec, req)
+	c.Assert(rec.Code, check.Equals, http.StatusBadRequest)
+	c.Assert(rec.Body.String(), check.Equals, `invalid params for template "tpl1": "size" must be one of small, large, got "huge"`+"\n")
+	machines, err := iaas.ListMachines()
+	c.Assert(err, check.IsNil)
+	c.Assert(machines, check.HasLen, 0)
+}
+
+func (s *HandlersSuite) TestAddNodeHandlerDestroysMachineWhenRegisterFails(c *check.C) {
+	iaas.RegisterIaasProvider("test-iaas", newTestIaaS)
+	mainDockerProvisioner.cluster, _ = cluster.New(&segregatedScheduler{}, &cluster.MapStorage{}, "",
+		cluster.Node{Address: "http://127.0.0.1:2375"},
+	)
+	opts := provision.AddPoolOptions{Name: "pool1"}
+	err := provision.AddPool(opts)
+	defer provision.RemovePool("pool1")
+	params := addNodeOptions{
+		Register: false,
+		Metadata: map[string]string{
+			"id":   "test1",
+			"pool": "pool1",
+		},
+	}
+	v, err := form.EncodeToValues(&params)
+	c.Assert(err, check.IsNil)
+	b := strings.NewReader(v.Encode())
+	req, err := http.NewRequest("POST", "/docker/node", b)
+	c.Assert(err, check.IsNil)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Authorization", s.token.GetValue())
+	rec := httptest.NewRecorder()
+	m := api.RunServer(true)
+	m.ServeHTTP(rec, req)
+	c.Assert(rec.Code, check.Equals, http.StatusCreated)
+	var result map[string]string
+	err = json.NewDecoder(rec.Body).Decode(&result)
+	c.Assert(err, check.IsNil)
+	c.Assert(result["Error"], check.Matches, "machine test1 was created but could not be registered as a node and was destroyed: .*\n\nmy iaas description")
+	machines, err := iaas.ListMachines()
+	c.Assert(err, check.IsNil)
+	c.Assert(machines, check.HasLen, 0)
+}
+
 func (s *HandlersSuite) TestAddNodeHandlerWithoutCluster(c *check.C) {
 	server, waitQueue := s.startFakeDockerNode(c)
 	defer server.Stop()
@@ -497,6 +574,15 @@ func (s *HandlersSuite) TestRemoveNodeHandlerWithoutRemoveIaaS(c *check.C) {
 	dbM, err := iaas.FindMachineById(machine.Id)
 	c.Assert(err, check.IsNil)
 	c.Assert(dbM.Id, check.Equals, machine.Id)
+	orphans, err := listOrphans(mainDockerProvisioner)
+	c.Assert(err, check.IsNil)
+	var kept []string
+	for _, o := range orphans {
+		if o.Kept {
+			kept = append(kept, o.MachineID)
+		}
+	}
+	c.Assert(kept, check.DeepEquals, []string{machine.Id})
 }
 
 func (s *HandlersSuite) TestRemoveNodeHandlerRemoveIaaS(c *check.C) {
@@ -575,6 +661,122 @@ func (s *S) TestRemoveNodeHandlerRebalanceContainers(c *check.C) {
 	c.Assert(containerList, check.HasLen, 5)
 }
 
+func (s *HandlersSuite) TestCordonNodeHandler(c *check.C) {
+	var err error
+	mainDockerProvisioner.cluster, err = cluster.New(nil, &cluster.MapStorage{}, "")
+	c.Assert(err, check.IsNil)
+	err = mainDockerProvisioner.Cluster().Register(cluster.Node{Address: "host.com:2375", Metadata: map[string]string{"pool": "pool1"}})
+	c.Assert(err, check.IsNil)
+	req, err := http.NewRequest("POST", "/docker/node/host.com:2375/cordon", nil)
+	c.Assert(err, check.IsNil)
+	req.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	rec := httptest.NewRecorder()
+	server := api.RunServer(true)
+	server.ServeHTTP(rec, req)
+	c.Assert(rec.Code, check.Equals, http.StatusOK)
+	node, err := mainDockerProvisioner.Cluster().GetNode("host.com:2375")
+	c.Assert(err, check.IsNil)
+	c.Assert(node.Metadata, check.DeepEquals, map[string]string{"pool": "pool1", nodestate.MetadataKey: nodestate.Cordoned})
+	req, err = http.NewRequest("POST", "/docker/node/host.com:2375/uncordon", nil)
+	c.Assert(err, check.IsNil)
+	req.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	rec = httptest.NewRecorder()
+	server.ServeHTTP(rec, req)
+	c.Assert(rec.Code, check.Equals, http.StatusOK)
+	node, err = mainDockerProvisioner.Cluster().GetNode("host.com:2375")
+	c.Assert(err, check.IsNil)
+	c.Assert(node.Metadata, check.DeepEquals, map[string]string{"pool": "pool1"})
+}
+
+func (s *HandlersSuite) TestCordonNodeHandlerNotFound(c *check.C) {
+	var err error
+	mainDockerProvisioner.cluster, err = cluster.New(nil, &cluster.MapStorage{}, "")
+	c.Assert(err, check.IsNil)
+	req, err := http.NewRequest("POST", "/docker/node/host.com:2375/cordon", nil)
+	c.Assert(err, check.IsNil)
+	req.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	rec := httptest.NewRecorder()
+	server := api.RunServer(true)
+	server.ServeHTTP(rec, req)
+	c.Assert(rec.Code, check.Equals, http.StatusNotFound)
+}
+
+func (s *HandlersSuite) TestCordonNodeHandlerNoPermission(c *check.C) {
+	var err error
+	mainDockerProvisioner.cluster, err = cluster.New(nil, &cluster.MapStorage{}, "")
+	c.Assert(err, check.IsNil)
+	err = mainDockerProvisioner.Cluster().Register(cluster.Node{Address: "host.com:2375", Metadata: map[string]string{"pool": "pool1"}})
+	c.Assert(err, check.IsNil)
+	limitedUser := &auth.User{Email: "mylimited@groundcontrol.com", Password: "123456"}
+	_, err = nativeScheme.Create(limitedUser)
+	c.Assert(err, check.IsNil)
+	defer nativeScheme.Remove(limitedUser)
+	t := createTokenForUser(limitedUser, "node.update", string(permission.CtxPool), "pool2", c)
+	req, err := http.NewRequest("POST", "/docker/node/host.com:2375/cordon", nil)
+	c.Assert(err, check.IsNil)
+	req.Header.Set("Authorization", "bearer "+t.GetValue())
+	rec := httptest.NewRecorder()
+	server := api.RunServer(true)
+	server.ServeHTTP(rec, req)
+	c.Assert(rec.Code, check.Equals, http.StatusForbidden)
+}
+
+func (s *S) TestDrainNodeHandler(c *check.C) {
+	p, err := s.startMultipleServersCluster()
+	c.Assert(err, check.IsNil)
+	mainDockerProvisioner = p
+	err = s.newFakeImage(p, "tsuru/app-myapp", nil)
+	c.Assert(err, check.IsNil)
+	appInstance := provisiontest.NewFakeApp("myapp", "python", 0)
+	defer p.Destroy(appInstance)
+	p.Provision(appInstance)
+	imageId, err := appCurrentImageName(appInstance.GetName())
+	c.Assert(err, check.IsNil)
+	nodes, err := mainDockerProvisioner.cluster.Nodes()
+	c.Assert(err, check.IsNil)
+	c.Assert(nodes, check.HasLen, 2)
+	units, err := addContainersWithHost(&changeUnitsPipelineArgs{
+		toHost:      "127.0.0.1",
+		toAdd:       map[string]*containersToAdd{"web": {Quantity: 2}},
+		app:         appInstance,
+		imageId:     imageId,
+		provisioner: p,
+	})
+	c.Assert(err, check.IsNil)
+	coll := p.Collection()
+	defer coll.Close()
+	defer coll.RemoveAll(bson.M{"appname": appInstance.GetName()})
+	appStruct := &app.App{
+		Name:     appInstance.GetName(),
+		Platform: appInstance.GetPlatform(),
+	}
+	err = s.storage.Apps().Insert(appStruct)
+	c.Assert(err, check.IsNil)
+	err = s.storage.Apps().Update(
+		bson.M{"name": appStruct.Name},
+		bson.M{"$set": bson.M{"units": units}},
+	)
+	c.Assert(err, check.IsNil)
+	u := fmt.Sprintf("/docker/node/%s/drain", nodes[0].Address)
+	req, err := http.NewRequest("POST", u, nil)
+	c.Assert(err, check.IsNil)
+	req.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	rec := tsurutest.NewSafeResponseRecorder()
+	server := api.RunServer(true)
+	server.ServeHTTP(rec, req)
+	c.Assert(rec.Code, check.Equals, http.StatusOK)
+	c.Assert(rec.Body.String(), check.Matches, `(?s).*drained successfully.*`)
+	node, err := mainDockerProvisioner.Cluster().GetNode(nodes[0].Address)
+	c.Assert(err, check.IsNil)
+	c.Assert(nodestate.Get(&node), check.Equals, nodestate.Cordoned)
+	containerList, err := mainDockerProvisioner.listContainersByHost("127.0.0.1")
+	c.Assert(err, check.IsNil)
+	c.Assert(containerList, check.HasLen, 0)
+	containerList, err = mainDockerProvisioner.listContainersByHost("localhost")
+	c.Assert(err, check.IsNil)
+	c.Assert(containerList, check.HasLen, 2)
+}
+
 func (s *S) TestRemoveNodeHandlerNoRebalanceContainers(c *check.C) {
 	p, err := s.startMultipleServersCluster()
 	c.Assert(err, check.IsNil)
@@ -676,6 +878,37 @@ func (s *HandlersSuite) TestListNodeHandler(c *check.C) {
 	c.Assert(result.Nodes[1].Metadata, check.DeepEquals, map[string]string{"pool": "pool2", "foo": "bar"})
 }
 
+func (s *HandlersSuite) TestListNodeHandlerMaintenanceStatus(c *check.C) {
+	var result struct {
+		Nodes []nodeListEntry `json:"nodes"`
+	}
+	var err error
+	mainDockerProvisioner.cluster, err = cluster.New(nil, &cluster.MapStorage{}, "")
+	c.Assert(err, check.IsNil)
+	err = mainDockerProvisioner.Cluster().Register(cluster.Node{
+		Address:  "host1.com:2375",
+		Metadata: map[string]string{"pool": "pool1", "LastSuccess": "x", nodestate.MetadataKey: nodestate.Draining},
+	})
+	c.Assert(err, check.IsNil)
+	err = mainDockerProvisioner.Cluster().Register(cluster.Node{
+		Address:  "host2.com:2375",
+		Metadata: map[string]string{"pool": "pool1", "LastSuccess": "x"},
+	})
+	c.Assert(err, check.IsNil)
+	req, err := http.NewRequest("GET", "/docker/node", nil)
+	c.Assert(err, check.IsNil)
+	rec := httptest.NewRecorder()
+	req.Header.Set("Authorization", s.token.GetValue())
+	m := api.RunServer(true)
+	m.ServeHTTP(rec, req)
+	c.Assert(rec.Code, check.Equals, http.StatusOK)
+	err = json.Unmarshal(rec.Body.Bytes(), &result)
+	c.Assert(err, check.IsNil)
+	c.Assert(result.Nodes, check.HasLen, 2)
+	c.Assert(result.Nodes[0].Status, check.Equals, "ready (draining)")
+	c.Assert(result.Nodes[1].Status, check.Equals, "ready")
+}
+
 func (s *HandlersSuite) TestListContainersByHostNotFound(c *check.C) {
 	req, err := http.NewRequest("GET", "/docker/node/http://notfound.com:4243/containers", nil)
 	c.Assert(err, check.IsNil)
@@ -1565,6 +1798,36 @@ func (s *HandlersSuite) TestAutoScaleRunHandler(c *check.C) {
 	})
 }
 
+func (s *HandlersSuite) TestAutoScaleSimulateHandler(c *check.C) {
+	mainDockerProvisioner.cluster, _ = cluster.New(&segregatedScheduler{}, &cluster.MapStorage{}, "",
+		cluster.Node{Address: "localhost:1999", Metadata: map[string]string{
+			"pool": "pool1",
+		}},
+	)
+	config.Set("docker:auto-scale:max-container-count", 2)
+	defer config.Unset("docker:auto-scale:max-container-count")
+	recorder := httptest.NewRecorder()
+	request, err := http.NewRequest("POST", "/docker/autoscale/simulate", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	server := api.RunServer(true)
+	server.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	c.Assert(recorder.Header().Get("Content-Type"), check.Equals, "application/json")
+	var simulations []autoScaleSimulation
+	err = json.Unmarshal(recorder.Body.Bytes(), &simulations)
+	c.Assert(err, check.IsNil)
+	c.Assert(simulations, check.HasLen, 1)
+	c.Assert(simulations[0].Pool, check.Equals, "pool1")
+	c.Assert(simulations[0].Error, check.Equals, "")
+	c.Assert(simulations[0].Result, check.DeepEquals, &scalerResult{})
+	c.Assert(simulations[0].Rule.MaxContainerCount, check.Equals, 2)
+	c.Assert(simulations[0].Log, check.Matches, `(?s)running scaler \*docker.countScaler for "pool": "pool1".*`)
+	evts, err := event.All()
+	c.Assert(err, check.IsNil)
+	c.Assert(evts, check.HasLen, 0)
+}
+
 func (s *HandlersSuite) TestAutoScaleConfigHandler(c *check.C) {
 	config.Set("docker:auto-scale:enabled", true)
 	defer config.Unset("docker:auto-scale:enabled")
@@ -1761,6 +2024,132 @@ func (s *HandlersSuite) TestAutoScaleDeleteRuleNotFound(c *check.C) {
 	c.Assert(recorder.Body.String(), check.Equals, "rule not found\n")
 }
 
+func (s *HandlersSuite) TestAutoScaleSetSchedule(c *check.C) {
+	schedule := autoScaleSchedule{MetadataFilter: "pool1", Name: "business", Days: "mon-fri", Start: "08:00", End: "20:00", MinNodes: 10}
+	v, err := form.EncodeToValues(&schedule)
+	c.Assert(err, check.IsNil)
+	recorder := httptest.NewRecorder()
+	request, err := http.NewRequest("POST", "/docker/autoscale/schedules", strings.NewReader(v.Encode()))
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	server := api.RunServer(true)
+	server.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	schedules, err := listAutoScaleSchedules(nil)
+	c.Assert(err, check.IsNil)
+	c.Assert(schedules, check.DeepEquals, []autoScaleSchedule{schedule})
+}
+
+func (s *HandlersSuite) TestAutoScaleSetScheduleInvalid(c *check.C) {
+	schedule := autoScaleSchedule{MetadataFilter: "pool1", Name: "business", MinNodes: 10, MaxNodes: 2}
+	v, err := form.EncodeToValues(&schedule)
+	c.Assert(err, check.IsNil)
+	recorder := httptest.NewRecorder()
+	request, err := http.NewRequest("POST", "/docker/autoscale/schedules", strings.NewReader(v.Encode()))
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	server := api.RunServer(true)
+	server.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusBadRequest)
+	c.Assert(recorder.Body.String(), check.Equals, "min nodes (10) must not be greater than max nodes (2)\n")
+}
+
+func (s *HandlersSuite) TestAutoScaleListSchedules(c *check.C) {
+	recorder := httptest.NewRecorder()
+	request, err := http.NewRequest("GET", "/docker/autoscale/schedules", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	server := api.RunServer(true)
+	server.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusNoContent)
+	schedule := autoScaleSchedule{MetadataFilter: "pool1", Name: "night", MaxNodes: 2}
+	err = schedule.update()
+	c.Assert(err, check.IsNil)
+	recorder = httptest.NewRecorder()
+	server.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	var schedules []autoScaleSchedule
+	err = json.Unmarshal(recorder.Body.Bytes(), &schedules)
+	c.Assert(err, check.IsNil)
+	c.Assert(schedules, check.DeepEquals, []autoScaleSchedule{schedule})
+}
+
+func (s *HandlersSuite) TestAutoScaleDeleteSchedule(c *check.C) {
+	schedule := autoScaleSchedule{MetadataFilter: "pool1", Name: "night", MaxNodes: 2}
+	err := schedule.update()
+	c.Assert(err, check.IsNil)
+	server := api.RunServer(true)
+	recorder := httptest.NewRecorder()
+	request, err := http.NewRequest("DELETE", "/docker/autoscale/schedules/night", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	server.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusNotFound)
+	recorder = httptest.NewRecorder()
+	request, err = http.NewRequest("DELETE", "/docker/autoscale/schedules/night?filter=pool1", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	server.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	schedules, err := listAutoScaleSchedules(nil)
+	c.Assert(err, check.IsNil)
+	c.Assert(schedules, check.HasLen, 0)
+}
+
+func (s *HandlersSuite) TestSchedulerConfigSetHandler(c *check.C) {
+	doReq := func(val url.Values, expectedCode int) {
+		reader := strings.NewReader(val.Encode())
+		recorder := httptest.NewRecorder()
+		request, err := http.NewRequest("POST", "/docker/scheduler", reader)
+		c.Assert(err, check.IsNil)
+		request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+		request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		server := api.RunServer(true)
+		server.ServeHTTP(recorder, request)
+		c.Assert(recorder.Code, check.Equals, expectedCode)
+	}
+	doReq(url.Values{"strategy": []string{"spread"}}, http.StatusOK)
+	doReq(url.Values{"pool": []string{"dev"}, "strategy": []string{"binpack"}}, http.StatusOK)
+	doReq(url.Values{"pool": []string{"dev"}, "strategy": []string{"random"}}, http.StatusBadRequest)
+	entries, err := schedulerConfigLoadAll()
+	c.Assert(err, check.IsNil)
+	c.Assert(entries, check.DeepEquals, map[string]schedulerConfig{
+		"":    {Strategy: "spread"},
+		"dev": {Strategy: "binpack"},
+	})
+	request, err := http.NewRequest("GET", "/docker/scheduler", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	recorder := httptest.NewRecorder()
+	server := api.RunServer(true)
+	server.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	c.Assert(recorder.Header().Get("Content-Type"), check.Equals, "application/json")
+	var result map[string]schedulerConfig
+	err = json.Unmarshal(recorder.Body.Bytes(), &result)
+	c.Assert(err, check.IsNil)
+	c.Assert(result, check.DeepEquals, entries)
+}
+
+func (s *HandlersSuite) TestSchedulerConfigSetHandlerNoPermission(c *check.C) {
+	limitedUser := &auth.User{Email: "mylimited@groundcontrol.com", Password: "123456"}
+	_, err := nativeScheme.Create(limitedUser)
+	c.Assert(err, check.IsNil)
+	defer nativeScheme.Remove(limitedUser)
+	t := createTokenForUser(limitedUser, "pool.update.scheduler", string(permission.CtxPool), "dev", c)
+	values := url.Values{"pool": []string{"prod"}, "strategy": []string{"binpack"}}
+	request, err := http.NewRequest("POST", "/docker/scheduler", strings.NewReader(values.Encode()))
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+t.GetValue())
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	recorder := httptest.NewRecorder()
+	server := api.RunServer(true)
+	server.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusForbidden)
+}
+
 func (s *HandlersSuite) TestDockerLogsUpdateHandler(c *check.C) {
 	values1 := url.Values{
 		"Driver":                 []string{"awslogs"},
@@ -1965,27 +2354,27 @@ func (s *HandlersSuite) TestNodeHealingUpdateRead(c *check.C) {
 		}},
 		{"pool=p1&Enabled=false", map[string]healer.NodeHealerConfig{
 			"":   {Enabled: boolPtr(true), MaxTimeSinceSuccess: intPtr(60), MaxUnresponsiveTime: intPtr(20)},
-			"p1": {Enabled: boolPtr(false), MaxTimeSinceSuccess: intPtr(60), MaxTimeSinceSuccessInherited: true, MaxUnresponsiveTime: intPtr(20), MaxUnresponsiveTimeInherited: true},
+			"p1": {Enabled: boolPtr(false), MaxTimeSinceSuccess: intPtr(60), MaxTimeSinceSuccessInherited: true, MaxUnresponsiveTime: intPtr(20), MaxUnresponsiveTimeInherited: true, MaxConcurrentHealsInherited: true, MaxUnhealthyPercentInherited: true, ReconcileNodeContainersInherited: true},
 		}},
 		{"pool=p1&Enabled=true", map[string]healer.NodeHealerConfig{
 			"":   {Enabled: boolPtr(true), MaxTimeSinceSuccess: intPtr(60), MaxUnresponsiveTime: intPtr(20)},
-			"p1": {Enabled: boolPtr(true), MaxTimeSinceSuccess: intPtr(60), MaxTimeSinceSuccessInherited: true, MaxUnresponsiveTime: intPtr(20), MaxUnresponsiveTimeInherited: true},
+			"p1": {Enabled: boolPtr(true), MaxTimeSinceSuccess: intPtr(60), MaxTimeSinceSuccessInherited: true, MaxUnresponsiveTime: intPtr(20), MaxUnresponsiveTimeInherited: true, MaxConcurrentHealsInherited: true, MaxUnhealthyPercentInherited: true, ReconcileNodeContainersInherited: true},
 		}},
 		{"pool=p1", map[string]healer.NodeHealerConfig{
 			"":   {Enabled: boolPtr(true), MaxTimeSinceSuccess: intPtr(60), MaxUnresponsiveTime: intPtr(20)},
-			"p1": {Enabled: boolPtr(true), MaxTimeSinceSuccess: intPtr(60), MaxTimeSinceSuccessInherited: true, MaxUnresponsiveTime: intPtr(20), MaxUnresponsiveTimeInherited: true},
+			"p1": {Enabled: boolPtr(true), MaxTimeSinceSuccess: intPtr(60), MaxTimeSinceSuccessInherited: true, MaxUnresponsiveTime: intPtr(20), MaxUnresponsiveTimeInherited: true, MaxConcurrentHealsInherited: true, MaxUnhealthyPercentInherited: true, ReconcileNodeContainersInherited: true},
 		}},
 		{"pool=p1&MaxUnresponsiveTime=30", map[string]healer.NodeHealerConfig{
 			"":   {Enabled: boolPtr(true), MaxTimeSinceSuccess: intPtr(60), MaxUnresponsiveTime: intPtr(20)},
-			"p1": {Enabled: boolPtr(true), MaxTimeSinceSuccess: intPtr(60), MaxTimeSinceSuccessInherited: true, MaxUnresponsiveTime: intPtr(30), MaxUnresponsiveTimeInherited: false},
+			"p1": {Enabled: boolPtr(true), MaxTimeSinceSuccess: intPtr(60), MaxTimeSinceSuccessInherited: true, MaxUnresponsiveTime: intPtr(30), MaxUnresponsiveTimeInherited: false, MaxConcurrentHealsInherited: true, MaxUnhealthyPercentInherited: true, ReconcileNodeContainersInherited: true},
 		}},
 		{"pool=p1&MaxUnresponsiveTime=0", map[string]healer.NodeHealerConfig{
 			"":   {Enabled: boolPtr(true), MaxTimeSinceSuccess: intPtr(60), MaxUnresponsiveTime: intPtr(20)},
-			"p1": {Enabled: boolPtr(true), MaxTimeSinceSuccess: intPtr(60), MaxTimeSinceSuccessInherited: true, MaxUnresponsiveTime: intPtr(0), MaxUnresponsiveTimeInherited: false},
+			"p1": {Enabled: boolPtr(true), MaxTimeSinceSuccess: intPtr(60), MaxTimeSinceSuccessInherited: true, MaxUnresponsiveTime: intPtr(0), MaxUnresponsiveTimeInherited: false, MaxConcurrentHealsInherited: true, MaxUnhealthyPercentInherited: true, ReconcileNodeContainersInherited: true},
 		}},
 		{"pool=p1&Enabled=false", map[string]healer.NodeHealerConfig{
 			"":   {Enabled: boolPtr(true), MaxTimeSinceSuccess: intPtr(60), MaxUnresponsiveTime: intPtr(20)},
-			"p1": {Enabled: boolPtr(false), MaxTimeSinceSuccess: intPtr(60), MaxTimeSinceSuccessInherited: true, MaxUnresponsiveTime: intPtr(0), MaxUnresponsiveTimeInherited: false},
+			"p1": {Enabled: boolPtr(false), MaxTimeSinceSuccess: intPtr(60), MaxTimeSinceSuccessInherited: true, MaxUnresponsiveTime: intPtr(0), MaxUnresponsiveTimeInherited: false, MaxConcurrentHealsInherited: true, MaxUnhealthyPercentInherited: true, ReconcileNodeContainersInherited: true},
 		}},
 	}
 	for i, t := range tests {
@@ -2002,7 +2391,7 @@ func (s *HandlersSuite) TestNodeHealingUpdateRead(c *check.C) {
 	configMap := doRequest("")
 	c.Assert(configMap, check.DeepEquals, map[string]healer.NodeHealerConfig{
 		"":   {Enabled: boolPtr(true), MaxTimeSinceSuccess: intPtr(60), MaxUnresponsiveTime: intPtr(20)},
-		"p1": {Enabled: boolPtr(false), MaxTimeSinceSuccess: intPtr(60), MaxTimeSinceSuccessInherited: true, MaxUnresponsiveTime: intPtr(20), MaxUnresponsiveTimeInherited: true},
+		"p1": {Enabled: boolPtr(false), MaxTimeSinceSuccess: intPtr(60), MaxTimeSinceSuccessInherited: true, MaxUnresponsiveTime: intPtr(20), MaxUnresponsiveTimeInherited: true, MaxConcurrentHealsInherited: true, MaxUnhealthyPercentInherited: true, ReconcileNodeContainersInherited: true},
 	})
 	request, err = http.NewRequest("DELETE", "/docker/healing/node", nil)
 	c.Assert(err, check.IsNil)
@@ -2013,7 +2402,7 @@ func (s *HandlersSuite) TestNodeHealingUpdateRead(c *check.C) {
 	configMap = doRequest("")
 	c.Assert(configMap, check.DeepEquals, map[string]healer.NodeHealerConfig{
 		"":   {},
-		"p1": {Enabled: boolPtr(false), MaxTimeSinceSuccessInherited: true, MaxUnresponsiveTimeInherited: true},
+		"p1": {Enabled: boolPtr(false), MaxTimeSinceSuccessInherited: true, MaxUnresponsiveTimeInherited: true, MaxConcurrentHealsInherited: true, MaxUnhealthyPercentInherited: true, ReconcileNodeContainersInherited: true},
 	})
 	request, err = http.NewRequest("DELETE", "/docker/healing/node?pool=p1&name=Enabled", nil)
 	c.Assert(err, check.IsNil)
@@ -2024,7 +2413,7 @@ func (s *HandlersSuite) TestNodeHealingUpdateRead(c *check.C) {
 	configMap = doRequest("")
 	c.Assert(configMap, check.DeepEquals, map[string]healer.NodeHealerConfig{
 		"":   {},
-		"p1": {EnabledInherited: true, MaxTimeSinceSuccessInherited: true, MaxUnresponsiveTimeInherited: true},
+		"p1": {EnabledInherited: true, MaxTimeSinceSuccessInherited: true, MaxUnresponsiveTimeInherited: true, MaxConcurrentHealsInherited: true, MaxUnhealthyPercentInherited: true, ReconcileNodeContainersInherited: true},
 	})
 }
 
@@ -2070,10 +2459,39 @@ func (s *HandlersSuite) TestNodeHealingConfigUpdateReadLimited(c *check.C) {
 	data = doRequest(t, http.StatusOK, "pool=p2&Enabled=true&MaxTimeSinceSuccess=20")
 	c.Assert(data, check.DeepEquals, map[string]healer.NodeHealerConfig{
 		"":   {Enabled: boolPtr(true), MaxTimeSinceSuccess: intPtr(60)},
-		"p2": {Enabled: boolPtr(true), MaxTimeSinceSuccess: intPtr(20), MaxUnresponsiveTimeInherited: true},
+		"p2": {Enabled: boolPtr(true), MaxTimeSinceSuccess: intPtr(20), MaxUnresponsiveTimeInherited: true, MaxConcurrentHealsInherited: true, MaxUnhealthyPercentInherited: true, ReconcileNodeContainersInherited: true},
 	})
 }
 
+func (s *HandlersSuite) TestNodeHealingResume(c *check.C) {
+	conn, err := db.Conn()
+	c.Assert(err, check.IsNil)
+	defer conn.Close()
+	coll := conn.Collection("node_healer_pause")
+	defer coll.RemoveAll(nil)
+	err = coll.Insert(healer.PoolPause{Pool: "p1", Time: time.Now().UTC(), Unhealthy: 2, Total: 3})
+	c.Assert(err, check.IsNil)
+	doRequest := func() *httptest.ResponseRecorder {
+		body := strings.NewReader("pool=p1")
+		request, err := http.NewRequest("POST", "/docker/healing/node/resume", body)
+		c.Assert(err, check.IsNil)
+		request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+		recorder := httptest.NewRecorder()
+		server := api.RunServer(true)
+		server.ServeHTTP(recorder, request)
+		return recorder
+	}
+	recorder := doRequest()
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	n, err := coll.FindId("p1").Count()
+	c.Assert(err, check.IsNil)
+	c.Assert(n, check.Equals, 0)
+	recorder = doRequest()
+	c.Assert(recorder.Code, check.Equals, http.StatusNotFound)
+	c.Assert(recorder.Body.String(), check.Equals, healer.ErrPoolNotPaused.Error()+"\n")
+}
+
 func (s *HandlersSuite) TestNodeContainerList(c *check.C) {
 	err := nodecontainer.AddNewContainer("", &nodecontainer.NodeContainerConfig{
 		Name: "c1",
@@ -2593,6 +3011,116 @@ func (s *HandlersSuite) TestNodeContainerUpgrade(c *check.C) {
 			"": {Name: "c1", Config: docker.Config{Env: []string{"A=1"}, Image: "img1"}},
 		}},
 	})
+	c.Assert(eventtest.EventDesc{
+		Target: event.Target{Type: event.TargetTypeNodeContainer, Value: "c1"},
+		Owner:  s.token.GetUserName(),
+		Kind:   "nodecontainer.update.upgrade",
+	}, eventtest.HasEvent)
+}
+
+func (s *HandlersSuite) TestNodeContainerUpgradeWithRolloutOptions(c *check.C) {
+	err := nodecontainer.AddNewContainer("", &nodecontainer.NodeContainerConfig{
+		Name:   "c1",
+		Config: docker.Config{Image: "img1"},
+	})
+	c.Assert(err, check.IsNil)
+	values := url.Values{
+		"pool":      []string{"p1"},
+		"batchsize": []string{"2"},
+		"pause":     []string{"10"},
+		"probeport": []string{"8080"},
+		"probepath": []string{"/healthcheck"},
+	}
+	recorder := httptest.NewRecorder()
+	request, err := http.NewRequest("POST", "/docker/nodecontainers/c1/upgrade", strings.NewReader(values.Encode()))
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	server := api.RunServer(true)
+	server.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	c.Assert(eventtest.EventDesc{
+		Target: event.Target{Type: event.TargetTypeNodeContainer, Value: "c1"},
+		Owner:  s.token.GetUserName(),
+		Kind:   "nodecontainer.update.upgrade",
+		StartCustomData: map[string]interface{}{
+			"pool":      "p1",
+			"batchsize": 2,
+			"pause":     10 * time.Second,
+			"probeport": 8080,
+			"probepath": "/healthcheck",
+		},
+	}, eventtest.HasEvent)
+}
+
+func (s *HandlersSuite) TestNodeContainerUpgradeInvalidRolloutOptions(c *check.C) {
+	err := nodecontainer.AddNewContainer("", &nodecontainer.NodeContainerConfig{
+		Name:   "c1",
+		Config: docker.Config{Image: "img1"},
+	})
+	c.Assert(err, check.IsNil)
+	values := url.Values{"batchsize": []string{"2"}, "batchpercent": []string{"10"}}
+	recorder := httptest.NewRecorder()
+	request, err := http.NewRequest("POST", "/docker/nodecontainers/c1/upgrade", strings.NewReader(values.Encode()))
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	server := api.RunServer(true)
+	server.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusBadRequest)
+	c.Assert(recorder.Body.String(), check.Equals, "batch size and batch percent are mutually exclusive\n")
+}
+
+func (s *HandlersSuite) TestNodeContainerStatus(c *check.C) {
+	err := nodecontainer.AddNewContainer("", &nodecontainer.NodeContainerConfig{
+		Name:   "c1",
+		Config: docker.Config{Image: "img1"},
+	})
+	c.Assert(err, check.IsNil)
+	dockerServer, err := testing.NewServer("127.0.0.1:0", nil, nil)
+	c.Assert(err, check.IsNil)
+	defer dockerServer.Stop()
+	mainDockerProvisioner.cluster, err = cluster.New(nil, &cluster.MapStorage{}, "",
+		cluster.Node{Address: dockerServer.URL(), Metadata: map[string]string{"pool": "pool1"}},
+	)
+	c.Assert(err, check.IsNil)
+	recorder := httptest.NewRecorder()
+	request, err := http.NewRequest("GET", "/docker/nodecontainers/c1/status", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	server := api.RunServer(true)
+	server.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	c.Assert(recorder.Header().Get("Content-Type"), check.Equals, "application/json")
+	var statuses []nodecontainer.ContainerStatus
+	err = json.Unmarshal(recorder.Body.Bytes(), &statuses)
+	c.Assert(err, check.IsNil)
+	c.Assert(statuses, check.DeepEquals, []nodecontainer.ContainerStatus{
+		{
+			Name:            "c1",
+			Address:         dockerServer.URL(),
+			Pool:            "pool1",
+			ConfiguredImage: "img1",
+			Missing:         true,
+			Error:           "container not found",
+		},
+	})
+	recorder = httptest.NewRecorder()
+	request, err = http.NewRequest("GET", "/docker/nodecontainers/c1/status?pool=notfound", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	server.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusNoContent)
+}
+
+func (s *HandlersSuite) TestNodeContainerStatusNotFound(c *check.C) {
+	recorder := httptest.NewRecorder()
+	request, err := http.NewRequest("GET", "/docker/nodecontainers/c1/status", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	server := api.RunServer(true)
+	server.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusNotFound)
 }
 
 func (s *HandlersSuite) TestNodeContainerUpgradeNotFound(c *check.C) {
@@ -2604,3 +3132,93 @@ func (s *HandlersSuite) TestNodeContainerUpgradeNotFound(c *check.C) {
 	server.ServeHTTP(recorder, request)
 	c.Assert(recorder.Code, check.Equals, http.StatusNotFound)
 }
+
+func (s *HandlersSuite) TestNodeContainerUpgradeLocked(c *check.C) {
+	err := nodecontainer.AddNewContainer("", &nodecontainer.NodeContainerConfig{
+		Name:        "c1",
+		PinnedImage: "tsuru/c1@sha256:abcef384829283eff",
+		Config: docker.Config{
+			Image: "img1",
+		},
+	})
+	c.Assert(err, check.IsNil)
+	evt, err := event.New(&event.Opts{
+		Target: event.Target{Type: event.TargetTypeNodeContainer, Value: "c1"},
+		Kind:   permission.PermNodecontainerUpdateUpgrade,
+		Owner:  s.token,
+	})
+	c.Assert(err, check.IsNil)
+	defer evt.Done(nil)
+	recorder := httptest.NewRecorder()
+	request, err := http.NewRequest("POST", "/docker/nodecontainers/c1/upgrade", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	server := api.RunServer(true)
+	server.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusConflict)
+	nc, err := nodecontainer.LoadNodeContainer("", "c1")
+	c.Assert(err, check.IsNil)
+	c.Assert(nc.PinnedImage, check.Equals, "tsuru/c1@sha256:abcef384829283eff")
+}
+
+func (s *HandlersSuite) TestOrphansList(c *check.C) {
+	iaas.RegisterIaasProvider("orphan-handler-iaas", dockertest.NewHealerIaaSConstructor("10.0.0.9", nil))
+	recorder := httptest.NewRecorder()
+	request, err := http.NewRequest("GET", "/docker/orphans", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+s.token.GetValue())
+	server := api.RunServer(true)
+	server.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusNoContent)
+	_, err = iaas.CreateMachineForIaaS("orphan-handler-iaas", map[string]string{"pool": "pool1"})
+	c.Assert(err, check.IsNil)
+	recorder = httptest.NewRecorder()
+	server.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusOK)
+	c.Assert(recorder.Header().Get("Content-Type"), check.Equals, "application/json")
+	var orphans []Orphan
+	err = json.Unmarshal(recorder.Body.Bytes(), &orphans)
+	c.Assert(err, check.IsNil)
+	c.Assert(orphans, check.HasLen, 1)
+	c.Assert(orphans[0], check.DeepEquals, Orphan{
+		Kind:      OrphanKindMachine,
+		IaaS:      "orphan-handler-iaas",
+		MachineID: "m-10.0.0.9",
+		Address:   "10.0.0.9",
+		Pool:      "pool1",
+		Reason:    "machine is not registered as a node",
+	})
+}
+
+func (s *HandlersSuite) TestOrphansListFilterByIaaS(c *check.C) {
+	iaas.RegisterIaasProvider("orphan-handler-iaas", dockertest.NewHealerIaaSConstructor("10.0.0.9", nil))
+	_, err := iaas.CreateMachineForIaaS("orphan-handler-iaas", map[string]string{})
+	c.Assert(err, check.IsNil)
+	limitedUser := &auth.User{Email: "mylimited@groundcontrol.com", Password: "123456"}
+	_, err = nativeScheme.Create(limitedUser)
+	c.Assert(err, check.IsNil)
+	defer nativeScheme.Remove(limitedUser)
+	t := createTokenForUser(limitedUser, "machine.read", string(permission.CtxIaaS), "other-iaas", c)
+	recorder := httptest.NewRecorder()
+	request, err := http.NewRequest("GET", "/docker/orphans", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+t.GetValue())
+	server := api.RunServer(true)
+	server.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusNoContent)
+}
+
+func (s *HandlersSuite) TestOrphansListNoPermission(c *check.C) {
+	limitedUser := &auth.User{Email: "mylimited@groundcontrol.com", Password: "123456"}
+	_, err := nativeScheme.Create(limitedUser)
+	c.Assert(err, check.IsNil)
+	defer nativeScheme.Remove(limitedUser)
+	t := createTokenForUser(limitedUser, "node.read", string(permission.CtxGlobal), "", c)
+	recorder := httptest.NewRecorder()
+	request, err := http.NewRequest("GET", "/docker/orphans", nil)
+	c.Assert(err, check.IsNil)
+	request.Header.Set("Authorization", "bearer "+t.GetValue())
+	server := api.RunServer(true)
+	server.ServeHTTP(recorder, request)
+	c.Assert(recorder.Code, check.Equals, http.StatusForbidden)
+}
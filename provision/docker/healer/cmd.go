@@ -150,6 +150,12 @@ func (c *GetNodeHealingConfigCmd) Run(ctx *cmd.Context, client *cmd.Client) erro
 		}
 		return fmt.Sprintf("%ds", *v)
 	}
+	limit := func(v *int, format string) string {
+		if v == nil || *v == 0 {
+			return "unlimited"
+		}
+		return fmt.Sprintf(format, *v)
+	}
 	baseConf := conf[""]
 	delete(conf, "")
 	fmt.Fprint(ctx.Stdout, "Default:\n")
@@ -158,6 +164,9 @@ func (c *GetNodeHealingConfigCmd) Run(ctx *cmd.Context, client *cmd.Client) erro
 	tbl.AddRow(cmd.Row{"Enabled", fmt.Sprintf("%v", baseConf.Enabled != nil && *baseConf.Enabled)})
 	tbl.AddRow(cmd.Row{"Max unresponsive time", v(baseConf.MaxUnresponsiveTime)})
 	tbl.AddRow(cmd.Row{"Max time since success", v(baseConf.MaxTimeSinceSuccess)})
+	tbl.AddRow(cmd.Row{"Max concurrent heals", limit(baseConf.MaxConcurrentHeals, "%d")})
+	tbl.AddRow(cmd.Row{"Max unhealthy nodes", limit(baseConf.MaxUnhealthyPercent, "%d%%")})
+	tbl.AddRow(cmd.Row{"Reconcile node containers", fmt.Sprintf("%v", baseConf.ReconcileNodeContainers != nil && *baseConf.ReconcileNodeContainers)})
 	fmt.Fprint(ctx.Stdout, tbl.String())
 	if len(conf) > 0 {
 		fmt.Fprintln(ctx.Stdout)
@@ -175,6 +184,9 @@ func (c *GetNodeHealingConfigCmd) Run(ctx *cmd.Context, client *cmd.Client) erro
 		tbl.AddRow(cmd.Row{"Enabled", fmt.Sprintf("%v", poolConf.Enabled != nil && *poolConf.Enabled), strconv.FormatBool(poolConf.EnabledInherited)})
 		tbl.AddRow(cmd.Row{"Max unresponsive time", v(poolConf.MaxUnresponsiveTime), strconv.FormatBool(poolConf.MaxUnresponsiveTimeInherited)})
 		tbl.AddRow(cmd.Row{"Max time since success", v(poolConf.MaxTimeSinceSuccess), strconv.FormatBool(poolConf.MaxTimeSinceSuccessInherited)})
+		tbl.AddRow(cmd.Row{"Max concurrent heals", limit(poolConf.MaxConcurrentHeals, "%d"), strconv.FormatBool(poolConf.MaxConcurrentHealsInherited)})
+		tbl.AddRow(cmd.Row{"Max unhealthy nodes", limit(poolConf.MaxUnhealthyPercent, "%d%%"), strconv.FormatBool(poolConf.MaxUnhealthyPercentInherited)})
+		tbl.AddRow(cmd.Row{"Reconcile node containers", fmt.Sprintf("%v", poolConf.ReconcileNodeContainers != nil && *poolConf.ReconcileNodeContainers), strconv.FormatBool(poolConf.ReconcileNodeContainersInherited)})
 		fmt.Fprint(ctx.Stdout, tbl.String())
 		if i < len(poolNames)-1 {
 			fmt.Fprintln(ctx.Stdout)
@@ -184,19 +196,32 @@ func (c *GetNodeHealingConfigCmd) Run(ctx *cmd.Context, client *cmd.Client) erro
 }
 
 type SetNodeHealingConfigCmd struct {
-	fs              *gnuflag.FlagSet
-	enable          bool
-	disable         bool
-	pool            string
-	maxUnresponsive int
-	maxUnsuccessful int
+	fs                  *gnuflag.FlagSet
+	enable              bool
+	disable             bool
+	pool                string
+	maxUnresponsive     int
+	maxUnsuccessful     int
+	maxConcurrent       int
+	maxUnhealthyPercent int
+	reconcile           bool
+	noReconcile         bool
 }
 
 func (c *SetNodeHealingConfigCmd) Info() *cmd.Info {
 	return &cmd.Info{
 		Name:  "docker-healing-update",
-		Usage: "docker-healing-update [-p/--pool pool] [--enable] [--disable] [--max-unresponsive <seconds>] [--max-unsuccessful <seconds>]",
-		Desc:  "Update node healing configuration",
+		Usage: "docker-healing-update [-p/--pool pool] [--enable] [--disable] [--max-unresponsive <seconds>] [--max-unsuccessful <seconds>] [--max-concurrent <count>] [--max-unhealthy-percent <percent>] [--reconcile-node-containers] [--no-reconcile-node-containers]",
+		Desc: `Update node healing configuration.
+
+The [[--max-concurrent]] flag limits how many nodes in a pool may be healed at
+the same time. The [[--max-unhealthy-percent]] flag sets the percentage of
+unhealthy nodes in a pool above which node healing is automatically paused in
+the pool, until it's resumed with [[docker-healing-resume]]. Zero means no
+limit.
+
+The [[--reconcile-node-containers]] flag makes the healer recreate node
+containers which are missing or stopped in the nodes of the pool.`,
 	}
 }
 
@@ -210,6 +235,10 @@ func (c *SetNodeHealingConfigCmd) Flags() *gnuflag.FlagSet {
 		c.fs.BoolVar(&c.disable, "disable", false, "Disable active node healing")
 		c.fs.IntVar(&c.maxUnresponsive, "max-unresponsive", -1, "Number of seconds tsuru will wait for the node to notify it's alive")
 		c.fs.IntVar(&c.maxUnsuccessful, "max-unsuccessful", -1, "Number of seconds tsuru will wait for the node to run successul checks")
+		c.fs.IntVar(&c.maxConcurrent, "max-concurrent", -1, "Maximum number of nodes healed at the same time in a pool")
+		c.fs.IntVar(&c.maxUnhealthyPercent, "max-unhealthy-percent", -1, "Percentage of unhealthy nodes in a pool above which healing is paused")
+		c.fs.BoolVar(&c.reconcile, "reconcile-node-containers", false, "Recreate missing or stopped node containers")
+		c.fs.BoolVar(&c.noReconcile, "no-reconcile-node-containers", false, "Don't recreate missing or stopped node containers")
 	}
 	return c.fs
 }
@@ -218,6 +247,9 @@ func (c *SetNodeHealingConfigCmd) Run(ctx *cmd.Context, client *cmd.Client) erro
 	if c.enable && c.disable {
 		return errors.New("conflicting flags --enable and --disable")
 	}
+	if c.reconcile && c.noReconcile {
+		return errors.New("conflicting flags --reconcile-node-containers and --no-reconcile-node-containers")
+	}
 	v := url.Values{}
 	v.Set("pool", c.pool)
 	if c.maxUnresponsive >= 0 {
@@ -226,12 +258,27 @@ func (c *SetNodeHealingConfigCmd) Run(ctx *cmd.Context, client *cmd.Client) erro
 	if c.maxUnsuccessful >= 0 {
 		v.Set("MaxTimeSinceSuccess", strconv.Itoa(c.maxUnsuccessful))
 	}
+	if c.maxConcurrent >= 0 {
+		v.Set("MaxConcurrentHeals", strconv.Itoa(c.maxConcurrent))
+	}
+	if c.maxUnhealthyPercent > 100 {
+		return errors.New("--max-unhealthy-percent must be between 0 and 100")
+	}
+	if c.maxUnhealthyPercent >= 0 {
+		v.Set("MaxUnhealthyPercent", strconv.Itoa(c.maxUnhealthyPercent))
+	}
 	if c.enable {
 		v.Set("Enabled", strconv.FormatBool(true))
 	}
 	if c.disable {
 		v.Set("Enabled", strconv.FormatBool(false))
 	}
+	if c.reconcile {
+		v.Set("ReconcileNodeContainers", strconv.FormatBool(true))
+	}
+	if c.noReconcile {
+		v.Set("ReconcileNodeContainers", strconv.FormatBool(false))
+	}
 	body := strings.NewReader(v.Encode())
 	u, err := cmd.GetURL("/docker/healing/node")
 	if err != nil {
@@ -251,17 +298,20 @@ func (c *SetNodeHealingConfigCmd) Run(ctx *cmd.Context, client *cmd.Client) erro
 
 type DeleteNodeHealingConfigCmd struct {
 	cmd.ConfirmationCommand
-	fs              *gnuflag.FlagSet
-	pool            string
-	enabled         bool
-	maxUnresponsive bool
-	maxUnsuccessful bool
+	fs                  *gnuflag.FlagSet
+	pool                string
+	enabled             bool
+	maxUnresponsive     bool
+	maxUnsuccessful     bool
+	maxConcurrent       bool
+	maxUnhealthyPercent bool
+	reconcile           bool
 }
 
 func (c *DeleteNodeHealingConfigCmd) Info() *cmd.Info {
 	return &cmd.Info{
 		Name:  "docker-healing-delete",
-		Usage: "docker-healing-delete [-p/--pool pool] [--enabled] [--max-unresponsive] [--max-unsuccessful]",
+		Usage: "docker-healing-delete [-p/--pool pool] [--enabled] [--max-unresponsive] [--max-unsuccessful] [--max-concurrent] [--max-unhealthy-percent] [--reconcile-node-containers]",
 		Desc: `Delete a node healing configuration entry.
 
 If [[--pool]] is provided the configuration entries from the specified pool
@@ -281,6 +331,9 @@ func (c *DeleteNodeHealingConfigCmd) Flags() *gnuflag.FlagSet {
 		c.fs.BoolVar(&c.enabled, "enabled", false, "Remove the 'enabled' configuration option")
 		c.fs.BoolVar(&c.maxUnresponsive, "max-unresponsive", false, "Remove the 'max-unresponsive' configuration option")
 		c.fs.BoolVar(&c.maxUnsuccessful, "max-unsuccessful", false, "Remove the 'max-unsuccessful' configuration option")
+		c.fs.BoolVar(&c.maxConcurrent, "max-concurrent", false, "Remove the 'max-concurrent' configuration option")
+		c.fs.BoolVar(&c.maxUnhealthyPercent, "max-unhealthy-percent", false, "Remove the 'max-unhealthy-percent' configuration option")
+		c.fs.BoolVar(&c.reconcile, "reconcile-node-containers", false, "Remove the 'reconcile-node-containers' configuration option")
 	}
 	return c.fs
 }
@@ -306,6 +359,15 @@ func (c *DeleteNodeHealingConfigCmd) Run(ctx *cmd.Context, client *cmd.Client) e
 	if c.maxUnsuccessful {
 		v.Add("name", "MaxTimeSinceSuccess")
 	}
+	if c.maxConcurrent {
+		v.Add("name", "MaxConcurrentHeals")
+	}
+	if c.maxUnhealthyPercent {
+		v.Add("name", "MaxUnhealthyPercent")
+	}
+	if c.reconcile {
+		v.Add("name", "ReconcileNodeContainers")
+	}
 	u, err := cmd.GetURL("/docker/healing/node?" + v.Encode())
 	if err != nil {
 		return err
@@ -320,3 +382,49 @@ func (c *DeleteNodeHealingConfigCmd) Run(ctx *cmd.Context, client *cmd.Client) e
 	}
 	return err
 }
+
+type ResumeNodeHealingCmd struct {
+	fs   *gnuflag.FlagSet
+	pool string
+}
+
+func (c *ResumeNodeHealingCmd) Info() *cmd.Info {
+	return &cmd.Info{
+		Name:  "docker-healing-resume",
+		Usage: "docker-healing-resume [-p/--pool pool]",
+		Desc: `Resume node healing in a pool where it was automatically paused because
+too many of its nodes were unhealthy at the same time.
+
+If the pool is still above the unhealthy nodes limit, healing will be paused
+again.`,
+	}
+}
+
+func (c *ResumeNodeHealingCmd) Flags() *gnuflag.FlagSet {
+	if c.fs == nil {
+		c.fs = gnuflag.NewFlagSet("with-flags", gnuflag.ContinueOnError)
+		msg := "The pool name where node healing will be resumed."
+		c.fs.StringVar(&c.pool, "p", "", msg)
+		c.fs.StringVar(&c.pool, "pool", "", msg)
+	}
+	return c.fs
+}
+
+func (c *ResumeNodeHealingCmd) Run(ctx *cmd.Context, client *cmd.Client) error {
+	v := url.Values{}
+	v.Set("pool", c.pool)
+	u, err := cmd.GetURL("/docker/healing/node/resume")
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest("POST", u, strings.NewReader(v.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	_, err = client.Do(req)
+	if err == nil {
+		fmt.Fprintln(ctx.Stdout, "Node healing successfully resumed.")
+	}
+	return err
+}
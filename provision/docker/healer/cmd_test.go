@@ -213,8 +213,8 @@ func (s *S) TestGetNodeHealingConfigCmd(c *check.C) {
 	trans := &cmdtest.ConditionalTransport{
 		Transport: cmdtest.Transport{Message: `{
 "": {"enabled": true, "maxunresponsivetime": 2},
-"p1": {"enabled": false, "maxunresponsivetime": 2, "maxunresponsivetimeinherited": true},
-"p2": {"enabled": true, "maxunresponsivetime": 3, "enabledinherited": true}
+"p1": {"enabled": false, "maxunresponsivetime": 2, "maxunresponsivetimeinherited": true, "maxconcurrenthealsinherited": true, "maxunhealthypercentinherited": true, "reconcilenodecontainersinherited": true},
+"p2": {"enabled": true, "maxunresponsivetime": 3, "enabledinherited": true, "maxconcurrentheals": 2, "maxunhealthypercent": 30, "reconcilenodecontainers": true}
 }`, Status: http.StatusOK},
 		CondFunc: func(req *http.Request) bool {
 			return req.URL.Path == "/1.0/docker/healing/node"
@@ -226,31 +226,40 @@ func (s *S) TestGetNodeHealingConfigCmd(c *check.C) {
 	err := healing.Run(&context, client)
 	c.Assert(err, check.IsNil)
 	expected := `Default:
-+------------------------+----------+
-| Config                 | Value    |
-+------------------------+----------+
-| Enabled                | true     |
-| Max unresponsive time  | 2s       |
-| Max time since success | disabled |
-+------------------------+----------+
++---------------------------+-----------+
+| Config                    | Value     |
++---------------------------+-----------+
+| Enabled                   | true      |
+| Max unresponsive time     | 2s        |
+| Max time since success    | disabled  |
+| Max concurrent heals      | unlimited |
+| Max unhealthy nodes       | unlimited |
+| Reconcile node containers | false     |
++---------------------------+-----------+
 
 Pool "p1":
-+------------------------+----------+-----------+
-| Config                 | Value    | Inherited |
-+------------------------+----------+-----------+
-| Enabled                | false    | false     |
-| Max unresponsive time  | 2s       | true      |
-| Max time since success | disabled | false     |
-+------------------------+----------+-----------+
++---------------------------+-----------+-----------+
+| Config                    | Value     | Inherited |
++---------------------------+-----------+-----------+
+| Enabled                   | false     | false     |
+| Max unresponsive time     | 2s        | true      |
+| Max time since success    | disabled  | false     |
+| Max concurrent heals      | unlimited | true      |
+| Max unhealthy nodes       | unlimited | true      |
+| Reconcile node containers | false     | true      |
++---------------------------+-----------+-----------+
 
 Pool "p2":
-+------------------------+----------+-----------+
-| Config                 | Value    | Inherited |
-+------------------------+----------+-----------+
-| Enabled                | true     | true      |
-| Max unresponsive time  | 3s       | false     |
-| Max time since success | disabled | false     |
-+------------------------+----------+-----------+
++---------------------------+----------+-----------+
+| Config                    | Value    | Inherited |
++---------------------------+----------+-----------+
+| Enabled                   | true     | true      |
+| Max unresponsive time     | 3s       | false     |
+| Max time since success    | disabled | false     |
+| Max concurrent heals      | 2        | false     |
+| Max unhealthy nodes       | 30%      | false     |
+| Reconcile node containers | true     | false     |
++---------------------------+----------+-----------+
 `
 	c.Assert(buf.String(), check.Equals, expected)
 }
@@ -270,13 +279,16 @@ func (s *S) TestGetNodeHealingConfigCmdEmpty(c *check.C) {
 	err := healing.Run(&context, client)
 	c.Assert(err, check.IsNil)
 	expected := `Default:
-+------------------------+----------+
-| Config                 | Value    |
-+------------------------+----------+
-| Enabled                | false    |
-| Max unresponsive time  | disabled |
-| Max time since success | disabled |
-+------------------------+----------+
++---------------------------+-----------+
+| Config                    | Value     |
++---------------------------+-----------+
+| Enabled                   | false     |
+| Max unresponsive time     | disabled  |
+| Max time since success    | disabled  |
+| Max concurrent heals      | unlimited |
+| Max unhealthy nodes       | unlimited |
+| Reconcile node containers | false     |
++---------------------------+-----------+
 `
 	c.Assert(buf.String(), check.Equals, expected)
 }
@@ -324,3 +336,78 @@ func (s *S) TestSetNodeHealingConfigCmd(c *check.C) {
 	c.Assert(err, check.IsNil)
 	c.Assert(buf.String(), check.Equals, "Node healing configuration successfully updated.\n")
 }
+
+func (s *S) TestSetNodeHealingConfigCmdPoolLimits(c *check.C) {
+	var buf bytes.Buffer
+	context := cmd.Context{Stdout: &buf}
+	trans := &cmdtest.ConditionalTransport{
+		Transport: cmdtest.Transport{Message: `{}`, Status: http.StatusOK},
+		CondFunc: func(req *http.Request) bool {
+			req.ParseForm()
+			c.Assert(req.Form, check.DeepEquals, url.Values{
+				"pool":                []string{"p1"},
+				"MaxConcurrentHeals":  []string{"2"},
+				"MaxUnhealthyPercent": []string{"40"},
+			})
+			return req.URL.Path == "/1.0/docker/healing/node" && req.Method == "POST"
+		},
+	}
+	manager := cmd.Manager{}
+	client := cmd.NewClient(&http.Client{Transport: trans}, nil, &manager)
+	healing := &SetNodeHealingConfigCmd{}
+	healing.Flags().Parse(true, []string{"--pool", "p1", "--max-concurrent", "2", "--max-unhealthy-percent", "40"})
+	err := healing.Run(&context, client)
+	c.Assert(err, check.IsNil)
+	c.Assert(buf.String(), check.Equals, "Node healing configuration successfully updated.\n")
+	healing = &SetNodeHealingConfigCmd{}
+	healing.Flags().Parse(true, []string{"--max-unhealthy-percent", "101"})
+	err = healing.Run(&context, client)
+	c.Assert(err, check.ErrorMatches, "--max-unhealthy-percent must be between 0 and 100")
+}
+
+func (s *S) TestSetNodeHealingConfigCmdReconcile(c *check.C) {
+	var buf bytes.Buffer
+	context := cmd.Context{Stdout: &buf}
+	trans := &cmdtest.ConditionalTransport{
+		Transport: cmdtest.Transport{Message: `{}`, Status: http.StatusOK},
+		CondFunc: func(req *http.Request) bool {
+			req.ParseForm()
+			c.Assert(req.Form, check.DeepEquals, url.Values{
+				"pool":                    []string{"p1"},
+				"ReconcileNodeContainers": []string{"true"},
+			})
+			return req.URL.Path == "/1.0/docker/healing/node" && req.Method == "POST"
+		},
+	}
+	manager := cmd.Manager{}
+	client := cmd.NewClient(&http.Client{Transport: trans}, nil, &manager)
+	healing := &SetNodeHealingConfigCmd{}
+	healing.Flags().Parse(true, []string{"--pool", "p1", "--reconcile-node-containers"})
+	err := healing.Run(&context, client)
+	c.Assert(err, check.IsNil)
+	c.Assert(buf.String(), check.Equals, "Node healing configuration successfully updated.\n")
+	healing = &SetNodeHealingConfigCmd{}
+	healing.Flags().Parse(true, []string{"--reconcile-node-containers", "--no-reconcile-node-containers"})
+	err = healing.Run(&context, client)
+	c.Assert(err, check.ErrorMatches, "conflicting flags --reconcile-node-containers and --no-reconcile-node-containers")
+}
+
+func (s *S) TestResumeNodeHealingCmd(c *check.C) {
+	var buf bytes.Buffer
+	context := cmd.Context{Stdout: &buf}
+	trans := &cmdtest.ConditionalTransport{
+		Transport: cmdtest.Transport{Message: ``, Status: http.StatusOK},
+		CondFunc: func(req *http.Request) bool {
+			req.ParseForm()
+			return req.URL.Path == "/1.0/docker/healing/node/resume" && req.Method == "POST" &&
+				req.Form.Get("pool") == "p1"
+		},
+	}
+	manager := cmd.Manager{}
+	client := cmd.NewClient(&http.Client{Transport: trans}, nil, &manager)
+	healing := &ResumeNodeHealingCmd{}
+	healing.Flags().Parse(true, []string{"--pool", "p1"})
+	err := healing.Run(&context, client)
+	c.Assert(err, check.IsNil)
+	c.Assert(buf.String(), check.Equals, "Node healing successfully resumed.\n")
+}
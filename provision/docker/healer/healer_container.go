@@ -19,6 +19,9 @@ import (
 type ContainerHealer struct {
 	provisioner         DockerProvisioner
 	maxUnresponsiveTime time.Duration
+	maxConsecutiveHeals int
+	backoff             time.Duration
+	maxBackoff          time.Duration
 	done                chan bool
 	locker              AppLocker
 }
@@ -26,14 +29,25 @@ type ContainerHealer struct {
 type ContainerHealerArgs struct {
 	Provisioner         DockerProvisioner
 	MaxUnresponsiveTime time.Duration
-	Done                chan bool
-	Locker              AppLocker
+	// MaxConsecutiveHeals is the number of times a container may be healed
+	// in a row, without reporting a successful status, before being marked
+	// as in crash loop. Zero or negative values disable the limit.
+	MaxConsecutiveHeals int
+	// Backoff is the time to wait before healing a container again after it
+	// was healed, it doubles after each consecutive heal up to MaxBackoff.
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+	Done       chan bool
+	Locker     AppLocker
 }
 
 func NewContainerHealer(args ContainerHealerArgs) *ContainerHealer {
 	return &ContainerHealer{
 		provisioner:         args.Provisioner,
 		maxUnresponsiveTime: args.MaxUnresponsiveTime,
+		maxConsecutiveHeals: args.MaxConsecutiveHeals,
+		backoff:             args.Backoff,
+		maxBackoff:          args.MaxBackoff,
 		done:                args.Done,
 		locker:              args.Locker,
 	}
@@ -78,6 +92,44 @@ func (h *ContainerHealer) isRunning(cont container.Container) (bool, error) {
 	return container.State.Running || container.State.Restarting, nil
 }
 
+// backoffFor returns how long to wait since the last heal before healing
+// again a container healed healCount times in a row.
+func (h *ContainerHealer) backoffFor(healCount int) time.Duration {
+	wait := h.backoff
+	for i := 1; i < healCount; i++ {
+		if h.maxBackoff > 0 && wait >= h.maxBackoff {
+			break
+		}
+		wait *= 2
+	}
+	if h.maxBackoff > 0 && wait > h.maxBackoff {
+		wait = h.maxBackoff
+	}
+	return wait
+}
+
+func (h *ContainerHealer) markCrashLoop(cont *container.Container) error {
+	log.Errorf("Containers healing: container %q healed %d times in a row without success, marking it as in crash loop.", cont.ID, cont.HealCount)
+	evt, err := event.NewInternal(&event.Opts{
+		Target:       event.Target{Type: event.TargetTypeContainer, Value: cont.ID},
+		ExtraTargets: []event.Target{{Type: event.TargetTypeApp, Value: cont.AppName}},
+		InternalKind: "healer-crashloop",
+		CustomData:   cont,
+	})
+	if err != nil {
+		return fmt.Errorf("Error trying to insert container crash loop event: %s", err.Error())
+	}
+	err = cont.SetStatus(h.provisioner, provision.StatusCrashLoop, true)
+	if err != nil {
+		err = fmt.Errorf("Error setting crash loop status in container %q: %s", cont.ID, err.Error())
+	}
+	updateErr := evt.Done(err)
+	if updateErr != nil {
+		log.Errorf("Error trying to update container crash loop event: %s", updateErr.Error())
+	}
+	return err
+}
+
 func (h *ContainerHealer) healContainerIfNeeded(cont container.Container) error {
 	if cont.LastSuccessStatusUpdate.IsZero() {
 		if !cont.MongoID.Time().Before(time.Now().Add(-h.maxUnresponsiveTime)) {
@@ -98,16 +150,27 @@ func (h *ContainerHealer) healContainerIfNeeded(cont container.Container) error
 	}
 	defer h.locker.Unlock(cont.AppName)
 	// Sanity check, now we have a lock, let's find out if the container still exists
-	_, err = h.provisioner.GetContainer(cont.ID)
+	dbCont, err := h.provisioner.GetContainer(cont.ID)
 	if err != nil {
 		if _, isNotFound := err.(*provision.UnitNotFoundError); isNotFound {
 			return nil
 		}
 		return fmt.Errorf("Containers healing: unable to heal %q couldn't verify it still exists: %s", cont.ID, err)
 	}
+	if dbCont.HealCount > 0 {
+		if h.maxConsecutiveHeals > 0 && dbCont.HealCount >= h.maxConsecutiveHeals {
+			return h.markCrashLoop(dbCont)
+		}
+		retryTime := dbCont.LastHealTime.Add(h.backoffFor(dbCont.HealCount))
+		if time.Now().Before(retryTime) {
+			log.Debugf("Containers healing: container %q was healed %d times in a row, waiting until %s to heal it again.", cont.ID, dbCont.HealCount, retryTime)
+			return nil
+		}
+	}
 	log.Errorf("Initiating healing process for container %q, unresponsive since %s.", cont.ID, cont.LastSuccessStatusUpdate)
 	evt, err := event.NewInternal(&event.Opts{
 		Target:       event.Target{Type: event.TargetTypeContainer, Value: cont.ID},
+		ExtraTargets: []event.Target{{Type: event.TargetTypeApp, Value: cont.AppName}},
 		InternalKind: "healer",
 		CustomData:   cont,
 	})
@@ -117,6 +180,12 @@ func (h *ContainerHealer) healContainerIfNeeded(cont container.Container) error
 	newCont, healErr := h.healContainer(cont)
 	if healErr != nil {
 		healErr = fmt.Errorf("Error healing container %q: %s", cont.ID, healErr.Error())
+		err = dbCont.SetHealCount(h.provisioner, dbCont.HealCount+1)
+	} else {
+		err = newCont.SetHealCount(h.provisioner, dbCont.HealCount+1)
+	}
+	if err != nil {
+		log.Errorf("Error trying to update container heal count: %s", err.Error())
 	}
 	err = evt.DoneCustomData(healErr, newCont)
 	if err != nil {
@@ -152,6 +221,7 @@ func listUnresponsiveContainers(p DockerProvisioner, maxUnresponsiveTime time.Du
 			provision.StatusStopped.String(),
 			provision.StatusBuilding.String(),
 			provision.StatusAsleep.String(),
+			provision.StatusCrashLoop.String(),
 		}},
 	})
 }
@@ -101,6 +101,7 @@ func (s *S) TestRunContainerHealer(c *check.C) {
 			provision.StatusStopped.String(),
 			provision.StatusBuilding.String(),
 			provision.StatusAsleep.String(),
+			provision.StatusCrashLoop.String(),
 		}},
 	}})
 	c.Assert(eventtest.EventDesc{
@@ -561,6 +562,121 @@ func (s *S) TestRunContainerHealerThrottled(c *check.C) {
 	c.Assert(err, check.ErrorMatches, "Error trying to insert container healing event, healing aborted: event throttled, limit for healer on container \".*?\" is 3 every 5m0s")
 }
 
+func (s *S) TestContainerHealerBackoffFor(c *check.C) {
+	healer := NewContainerHealer(ContainerHealerArgs{Backoff: time.Minute, MaxBackoff: 5 * time.Minute})
+	c.Assert(healer.backoffFor(1), check.Equals, time.Minute)
+	c.Assert(healer.backoffFor(2), check.Equals, 2*time.Minute)
+	c.Assert(healer.backoffFor(3), check.Equals, 4*time.Minute)
+	c.Assert(healer.backoffFor(4), check.Equals, 5*time.Minute)
+	c.Assert(healer.backoffFor(100), check.Equals, 5*time.Minute)
+	healer = NewContainerHealer(ContainerHealerArgs{Backoff: time.Minute})
+	c.Assert(healer.backoffFor(4), check.Equals, 8*time.Minute)
+}
+
+func (s *S) TestRunContainerHealerBackoff(c *check.C) {
+	p, err := dockertest.StartMultipleServersCluster()
+	c.Assert(err, check.IsNil)
+	defer p.Destroy()
+	node1 := p.Servers()[0]
+	app := provisiontest.NewFakeApp("myapp", "python", 0)
+	_, err = p.StartContainers(dockertest.StartContainersArgs{
+		Endpoint:  node1.URL(),
+		App:       app,
+		Amount:    map[string]int{"web": 1},
+		Image:     "tsuru/python",
+		PullImage: true,
+	})
+	c.Assert(err, check.IsNil)
+	containers := p.AllContainers()
+	c.Assert(containers, check.HasLen, 1)
+	node1.MutateContainer(containers[0].ID, docker.State{Running: false, Restarting: false})
+	toMoveCont := containers[0]
+	toMoveCont.LastSuccessStatusUpdate = time.Now().Add(-5 * time.Minute)
+	toMoveCont.HealCount = 2
+	toMoveCont.LastHealTime = time.Now().Add(-3 * time.Minute)
+	p.SetContainers(toMoveCont.HostAddr, []container.Container{toMoveCont})
+	healer := NewContainerHealer(ContainerHealerArgs{
+		Provisioner:         p,
+		Locker:              dockertest.NewFakeLocker(),
+		MaxConsecutiveHeals: 5,
+		Backoff:             2 * time.Minute,
+	})
+	err = healer.healContainerIfNeeded(toMoveCont)
+	c.Assert(err, check.IsNil)
+	c.Assert(p.Movings(), check.HasLen, 0)
+	c.Assert(eventtest.EventDesc{IsEmpty: true}, eventtest.HasEvent)
+	toMoveCont.LastHealTime = time.Now().Add(-5 * time.Minute)
+	p.SetContainers(toMoveCont.HostAddr, []container.Container{toMoveCont})
+	err = healer.healContainerIfNeeded(toMoveCont)
+	c.Assert(err, check.IsNil)
+	c.Assert(p.Movings(), check.HasLen, 1)
+	c.Assert(eventtest.EventDesc{
+		Target: event.Target{Type: "container", Value: toMoveCont.ID},
+		Kind:   "healer",
+		StartCustomData: map[string]interface{}{
+			"id":        toMoveCont.ID,
+			"healcount": 2,
+		},
+	}, eventtest.HasEvent)
+	evts, err := event.List(&event.Filter{Target: event.Target{Type: event.TargetTypeApp, Value: "myapp"}})
+	c.Assert(err, check.IsNil)
+	c.Assert(evts, check.HasLen, 1)
+}
+
+func (s *S) TestRunContainerHealerCrashLoop(c *check.C) {
+	p, err := dockertest.StartMultipleServersCluster()
+	c.Assert(err, check.IsNil)
+	defer p.Destroy()
+	node1 := p.Servers()[0]
+	app := provisiontest.NewFakeApp("myapp", "python", 0)
+	_, err = p.StartContainers(dockertest.StartContainersArgs{
+		Endpoint:  node1.URL(),
+		App:       app,
+		Amount:    map[string]int{"web": 1},
+		Image:     "tsuru/python",
+		PullImage: true,
+	})
+	c.Assert(err, check.IsNil)
+	containers := p.AllContainers()
+	c.Assert(containers, check.HasLen, 1)
+	node1.MutateContainer(containers[0].ID, docker.State{Running: false, Restarting: false})
+	toMoveCont := containers[0]
+	toMoveCont.LastSuccessStatusUpdate = time.Now().Add(-5 * time.Minute)
+	toMoveCont.HealCount = 3
+	toMoveCont.LastHealTime = time.Now().Add(-time.Hour)
+	p.SetContainers(toMoveCont.HostAddr, []container.Container{toMoveCont})
+	coll := p.Collection()
+	defer coll.Close()
+	err = coll.Insert(toMoveCont)
+	c.Assert(err, check.IsNil)
+	defer coll.RemoveAll(bson.M{"id": toMoveCont.ID})
+	healer := NewContainerHealer(ContainerHealerArgs{
+		Provisioner:         p,
+		Locker:              dockertest.NewFakeLocker(),
+		MaxConsecutiveHeals: 3,
+		Backoff:             time.Minute,
+	})
+	err = healer.healContainerIfNeeded(toMoveCont)
+	c.Assert(err, check.IsNil)
+	c.Assert(p.Movings(), check.HasLen, 0)
+	var dbCont container.Container
+	err = coll.Find(bson.M{"id": toMoveCont.ID}).One(&dbCont)
+	c.Assert(err, check.IsNil)
+	c.Assert(dbCont.Status, check.Equals, provision.StatusCrashLoop.String())
+	c.Assert(dbCont.AsUnit(app).Status, check.Equals, provision.StatusCrashLoop)
+	c.Assert(eventtest.EventDesc{
+		Target: event.Target{Type: "container", Value: toMoveCont.ID},
+		Kind:   "healer-crashloop",
+		StartCustomData: map[string]interface{}{
+			"id":        toMoveCont.ID,
+			"healcount": 3,
+		},
+	}, eventtest.HasEvent)
+	evts, err := event.List(&event.Filter{Target: event.Target{Type: event.TargetTypeApp, Value: "myapp"}})
+	c.Assert(err, check.IsNil)
+	c.Assert(evts, check.HasLen, 1)
+}
+
 func (s *S) TestListUnresponsiveContainers(c *check.C) {
 	p, err := dockertest.StartMultipleServersCluster()
 	c.Assert(err, check.IsNil)
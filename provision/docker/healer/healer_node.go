@@ -6,7 +6,9 @@ package healer
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
+	"strings"
 	"sync"
 	"time"
 
@@ -21,6 +23,7 @@ import (
 	"github.com/tsuru/tsuru/net"
 	"github.com/tsuru/tsuru/provision"
 	"github.com/tsuru/tsuru/provision/docker/nodecontainer"
+	"github.com/tsuru/tsuru/provision/docker/nodestate"
 	"github.com/tsuru/tsuru/queue"
 	"github.com/tsuru/tsuru/scopedconfig"
 	"gopkg.in/mgo.v2"
@@ -29,8 +32,11 @@ import (
 
 const (
 	nodeHealerConfigCollection = "node-healer"
+	nodeHealerPauseCollection  = "node_healer_pause"
 )
 
+var ErrPoolNotPaused = errors.New("node healing is not paused for this pool")
+
 type NodeHealer struct {
 	wg                    sync.WaitGroup
 	provisioner           DockerProvisioner
@@ -49,12 +55,27 @@ type NodeHealerArgs struct {
 }
 
 type NodeHealerConfig struct {
-	Enabled                      *bool
-	MaxTimeSinceSuccess          *int
-	MaxUnresponsiveTime          *int
-	EnabledInherited             bool
-	MaxTimeSinceSuccessInherited bool
-	MaxUnresponsiveTimeInherited bool
+	Enabled                          *bool
+	MaxTimeSinceSuccess              *int
+	MaxUnresponsiveTime              *int
+	MaxConcurrentHeals               *int
+	MaxUnhealthyPercent              *int
+	ReconcileNodeContainers          *bool
+	EnabledInherited                 bool
+	MaxTimeSinceSuccessInherited     bool
+	MaxUnresponsiveTimeInherited     bool
+	MaxConcurrentHealsInherited      bool
+	MaxUnhealthyPercentInherited     bool
+	ReconcileNodeContainersInherited bool
+}
+
+// PoolPause describes a pool where node healing was automatically paused
+// because too many of its nodes were unhealthy at the same time.
+type PoolPause struct {
+	Pool      string `bson:"_id"`
+	Time      time.Time
+	Unhealthy int
+	Total     int
 }
 
 type nodeStatusData struct {
@@ -62,6 +83,13 @@ type nodeStatusData struct {
 	Checks      []nodeChecks `bson:",omitempty"`
 	LastSuccess time.Time    `bson:",omitempty"`
 	LastUpdate  time.Time
+	Metrics     *provision.NodeMetrics `bson:",omitempty"`
+	LastMetrics time.Time              `bson:",omitempty"`
+}
+
+type nodeReconcileCustomData struct {
+	Node       *cluster.Node
+	Containers []string
 }
 
 type nodeHealerCustomData struct {
@@ -165,6 +193,17 @@ func (h *NodeHealer) tryHealingNode(node *cluster.Node, reason string, lastCheck
 		log.Debugf("node %q doesn't have IaaS information, healing (%s) won't run on it.", node.Address, reason)
 		return nil
 	}
+	if state := nodestate.Get(node); state != "" {
+		log.Debugf("node %q is %s, healing (%s) won't run on it.", node.Address, state, reason)
+		return nil
+	}
+	configEntry, allowed, err := h.checkPoolLimits(node)
+	if err != nil {
+		return fmt.Errorf("Error checking pool healing limits, healing aborted: %s", err.Error())
+	}
+	if !allowed {
+		return nil
+	}
 	evt, err := event.NewInternal(&event.Opts{
 		Target:       event.Target{Type: event.TargetTypeNode, Value: node.Address},
 		InternalKind: "healer",
@@ -194,6 +233,15 @@ func (h *NodeHealer) tryHealingNode(node *cluster.Node, reason string, lastCheck
 			log.Errorf("error trying to update healing event: %s", updateErr.Error())
 		}
 	}()
+	allowed, err = concurrentHealsAllowed(evt, node.Metadata["pool"], configEntry)
+	if err != nil {
+		evtErr = fmt.Errorf("unable to check concurrent heals in pool: %s", err)
+		return evtErr
+	}
+	if !allowed {
+		log.Debugf("maximum number of concurrent heals reached in pool %q, healing (%s) won't run on node %q.", node.Metadata["pool"], reason, node.Address)
+		return nil
+	}
 	_, err = h.provisioner.Cluster().GetNode(node.Address)
 	if err != nil {
 		if err == clusterStorage.ErrNoSuchNode {
@@ -326,6 +374,10 @@ func (h *NodeHealer) UpdateNodeData(nodeData provision.NodeStatusData) error {
 	if isSuccess {
 		toInsert.LastSuccess = now
 	}
+	if nodeData.Metrics != nil {
+		toInsert.Metrics = nodeData.Metrics
+		toInsert.LastMetrics = now
+	}
 	coll, err := nodeDataCollection()
 	if err != nil {
 		return err
@@ -425,6 +477,173 @@ func (h *NodeHealer) shouldHealNode(node *cluster.Node) (bool, error) {
 	return count > 0, nil
 }
 
+// checkPoolLimits loads the healer config for the pool of the node and
+// returns whether healing is allowed to run in this pool. Healing is paused
+// in the pool, generating an event, when the percentage of unhealthy nodes
+// is above the configured limit.
+func (h *NodeHealer) checkPoolLimits(node *cluster.Node) (NodeHealerConfig, bool, error) {
+	pool := node.Metadata["pool"]
+	var configEntry NodeHealerConfig
+	err := healerConfig().Load(pool, &configEntry)
+	if err != nil {
+		return configEntry, false, err
+	}
+	pause, err := getPoolPause(pool)
+	if err != nil {
+		return configEntry, false, err
+	}
+	if pause != nil {
+		log.Debugf("node healing is paused in pool %q, healing won't run on node %q.", pool, node.Address)
+		return configEntry, false, nil
+	}
+	if configEntry.MaxUnhealthyPercent == nil || *configEntry.MaxUnhealthyPercent <= 0 {
+		return configEntry, true, nil
+	}
+	unhealthy, total, err := h.poolHealth(pool, configEntry)
+	if err != nil {
+		return configEntry, false, err
+	}
+	if total == 0 || unhealthy*100 <= *configEntry.MaxUnhealthyPercent*total {
+		return configEntry, true, nil
+	}
+	err = pausePool(PoolPause{
+		Pool:      pool,
+		Time:      time.Now().UTC(),
+		Unhealthy: unhealthy,
+		Total:     total,
+	}, *configEntry.MaxUnhealthyPercent)
+	return configEntry, false, err
+}
+
+// poolHealth returns the number of unhealthy nodes in the pool, according to
+// the healer config, and the total number of nodes in it.
+func (h *NodeHealer) poolHealth(pool string, config NodeHealerConfig) (int, int, error) {
+	nodes, err := h.provisioner.Cluster().UnfilteredNodes()
+	if err != nil {
+		return 0, 0, err
+	}
+	var poolNodes []*cluster.Node
+	for i := range nodes {
+		if nodes[i].Metadata["pool"] == pool {
+			poolNodes = append(poolNodes, &nodes[i])
+		}
+	}
+	if len(poolNodes) == 0 {
+		return 0, 0, nil
+	}
+	queryPart, err := h.queryPartForConfig(poolNodes, config)
+	if err != nil || queryPart == nil {
+		return 0, len(poolNodes), err
+	}
+	coll, err := nodeDataCollection()
+	if err != nil {
+		return 0, 0, fmt.Errorf("unable to get node data collection: %s", err)
+	}
+	defer coll.Close()
+	unhealthy, err := coll.Find(queryPart).Count()
+	if err != nil {
+		return 0, 0, fmt.Errorf("unable to find unhealthy nodes: %s", err)
+	}
+	return unhealthy, len(poolNodes), nil
+}
+
+// concurrentHealsAllowed returns whether the healing event is among the
+// oldest running healing events in the pool, within the maximum number of
+// concurrent heals. The check is done after the event is created so that
+// healers running in different tsuru instances see each other.
+func concurrentHealsAllowed(evt *event.Event, pool string, config NodeHealerConfig) (bool, error) {
+	if config.MaxConcurrentHeals == nil || *config.MaxConcurrentHeals <= 0 {
+		return true, nil
+	}
+	var poolQuery interface{} = pool
+	if pool == "" {
+		poolQuery = bson.M{"$in": []interface{}{"", nil}}
+	}
+	running := true
+	evts, err := event.List(&event.Filter{
+		KindName: "healer",
+		Running:  &running,
+		Raw:      bson.M{"target.type": event.TargetTypeNode, "startcustomdata.node.metadata.pool": poolQuery},
+		Sort:     "starttime",
+		Limit:    *config.MaxConcurrentHeals,
+	})
+	if err != nil {
+		return false, err
+	}
+	for i := range evts {
+		if evts[i].UniqueID == evt.UniqueID {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func pausePool(pause PoolPause, maxPercent int) error {
+	coll, err := nodePauseCollection()
+	if err != nil {
+		return err
+	}
+	defer coll.Close()
+	err = coll.Insert(pause)
+	if err != nil {
+		if mgo.IsDup(err) {
+			return nil
+		}
+		return err
+	}
+	log.Errorf("pausing node healing in pool %q: %d of %d nodes are unhealthy", pause.Pool, pause.Unhealthy, pause.Total)
+	if pause.Pool == "" {
+		// Events require a target value, nodes without a pool only get the
+		// log entry above.
+		return nil
+	}
+	evt, err := event.NewInternal(&event.Opts{
+		Target:       event.Target{Type: event.TargetTypePool, Value: pause.Pool},
+		InternalKind: "healer-pause",
+		CustomData: map[string]interface{}{
+			"unhealthy":           pause.Unhealthy,
+			"total":               pause.Total,
+			"maxunhealthypercent": maxPercent,
+		},
+	})
+	if err != nil {
+		return err
+	}
+	return evt.Done(nil)
+}
+
+func getPoolPause(pool string) (*PoolPause, error) {
+	coll, err := nodePauseCollection()
+	if err != nil {
+		return nil, err
+	}
+	defer coll.Close()
+	var pause PoolPause
+	err = coll.FindId(pool).One(&pause)
+	if err != nil {
+		if err == mgo.ErrNotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &pause, nil
+}
+
+// ResumePool resumes node healing in a pool where it was automatically
+// paused.
+func ResumePool(pool string) error {
+	coll, err := nodePauseCollection()
+	if err != nil {
+		return err
+	}
+	defer coll.Close()
+	err = coll.RemoveId(pool)
+	if err == mgo.ErrNotFound {
+		return ErrPoolNotPaused
+	}
+	return err
+}
+
 func (h *NodeHealer) findNodesForHealing() ([]nodeStatusData, map[string]*cluster.Node, error) {
 	nodes, err := h.provisioner.Cluster().UnfilteredNodes()
 	if err != nil {
@@ -502,6 +721,91 @@ func (h *NodeHealer) runActiveHealing() {
 			log.Errorf("[node healer active] %s", err)
 		}
 	}
+	err = h.reconcileNodeContainers(nodesAddrMap)
+	if err != nil {
+		log.Errorf("[node healer reconcile] %s", err)
+	}
+}
+
+// reconcileNodeContainers recreates, in the nodes of pools with node
+// container reconciliation enabled, the node containers which are missing or
+// not running.
+func (h *NodeHealer) reconcileNodeContainers(nodes map[string]*cluster.Node) error {
+	conf := healerConfig()
+	poolEnabled := map[string]bool{}
+	var toCheck []cluster.Node
+	for _, n := range nodes {
+		pool := n.Metadata["pool"]
+		enabled, ok := poolEnabled[pool]
+		if !ok {
+			var configEntry NodeHealerConfig
+			err := conf.Load(pool, &configEntry)
+			if err != nil {
+				return err
+			}
+			enabled = configEntry.ReconcileNodeContainers != nil && *configEntry.ReconcileNodeContainers
+			poolEnabled[pool] = enabled
+		}
+		if enabled && nodestate.Get(n) == "" {
+			toCheck = append(toCheck, *n)
+		}
+	}
+	if len(toCheck) == 0 {
+		return nil
+	}
+	groups, err := nodecontainer.AllNodeContainers()
+	if err != nil {
+		return err
+	}
+	broken := map[string][]string{}
+	for _, g := range groups {
+		statuses, err := nodecontainer.ContainerStatuses(h.provisioner, g.Name, toCheck...)
+		if err != nil {
+			return err
+		}
+		for _, st := range statuses {
+			if st.Missing || (st.ContainerID != "" && !st.Running) {
+				broken[st.Address] = append(broken[st.Address], g.Name)
+			}
+		}
+	}
+	for addr, names := range broken {
+		err = h.reconcileNode(nodes[addr], names)
+		if err != nil {
+			log.Errorf("[node healer reconcile] %s", err)
+		}
+	}
+	return nil
+}
+
+func (h *NodeHealer) reconcileNode(node *cluster.Node, names []string) error {
+	evt, err := event.NewInternal(&event.Opts{
+		Target:       event.Target{Type: event.TargetTypeNode, Value: node.Address},
+		InternalKind: "healer-reconcile",
+		CustomData:   nodeReconcileCustomData{Node: node, Containers: names},
+	})
+	if err != nil {
+		if _, ok := err.(event.ErrEventLocked); ok {
+			return nil
+		}
+		return fmt.Errorf("unable to create reconcile event for node %q: %s", node.Address, err)
+	}
+	log.Errorf("reconciling node containers %v in node %q", names, node.Address)
+	var reconcileErrors []string
+	for _, name := range names {
+		err = nodecontainer.RecreateNamedContainers(h.provisioner, evt, name, *node)
+		if err != nil {
+			reconcileErrors = append(reconcileErrors, err.Error())
+		}
+	}
+	if len(reconcileErrors) > 0 {
+		err = fmt.Errorf("unable to reconcile node containers in node %q: %s", node.Address, strings.Join(reconcileErrors, ", "))
+	}
+	doneErr := evt.Done(err)
+	if doneErr != nil {
+		log.Errorf("error trying to update reconcile event: %s", doneErr)
+	}
+	return err
 }
 
 func UpdateConfig(pool string, config NodeHealerConfig) error {
@@ -534,6 +838,31 @@ func GetConfig() (map[string]NodeHealerConfig, error) {
 	return ret, nil
 }
 
+// NodesMetrics returns the last metrics reported by each one of the nodes,
+// ignoring reports older than maxAge.
+func NodesMetrics(addresses []string, maxAge time.Duration) (map[string]provision.NodeMetrics, error) {
+	coll, err := nodeDataCollection()
+	if err != nil {
+		return nil, err
+	}
+	defer coll.Close()
+	var data []nodeStatusData
+	err = coll.Find(bson.M{
+		"_id":         bson.M{"$in": addresses},
+		"lastmetrics": bson.M{"$gte": time.Now().UTC().Add(-maxAge)},
+	}).Select(bson.M{"metrics": 1}).All(&data)
+	if err != nil {
+		return nil, err
+	}
+	result := make(map[string]provision.NodeMetrics, len(data))
+	for _, d := range data {
+		if d.Metrics != nil {
+			result[d.Address] = *d.Metrics
+		}
+	}
+	return result, nil
+}
+
 func nodeDataCollection() (*storage.Collection, error) {
 	conn, err := db.Conn()
 	if err != nil {
@@ -541,3 +870,11 @@ func nodeDataCollection() (*storage.Collection, error) {
 	}
 	return conn.Collection("node_status"), nil
 }
+
+func nodePauseCollection() (*storage.Collection, error) {
+	conn, err := db.Conn()
+	if err != nil {
+		return nil, err
+	}
+	return conn.Collection(nodeHealerPauseCollection), nil
+}
@@ -12,6 +12,7 @@ import (
 	"sync"
 	"time"
 
+	"github.com/fsouza/go-dockerclient"
 	"github.com/fsouza/go-dockerclient/testing"
 	"github.com/tsuru/config"
 	"github.com/tsuru/docker-cluster/cluster"
@@ -22,6 +23,7 @@ import (
 	"github.com/tsuru/tsuru/provision"
 	"github.com/tsuru/tsuru/provision/docker/dockertest"
 	"github.com/tsuru/tsuru/provision/docker/nodecontainer"
+	"github.com/tsuru/tsuru/provision/docker/nodestate"
 	"github.com/tsuru/tsuru/provision/provisiontest"
 	"github.com/tsuru/tsuru/tsurutest"
 	"gopkg.in/check.v1"
@@ -413,6 +415,34 @@ func (s *S) TestHealerHandleErrorDoesntTriggerEventIfNotNeeded(c *check.C) {
 	}, eventtest.HasEvent)
 }
 
+func (s *S) TestHealerHandleErrorIgnoresNodesUnderMaintenance(c *check.C) {
+	node1, err := testing.NewServer("127.0.0.1:0", nil, nil)
+	c.Assert(err, check.IsNil)
+	p, err := s.newFakeDockerProvisioner(node1.URL())
+	c.Assert(err, check.IsNil)
+	defer p.Destroy()
+	healer := NewNodeHealer(NodeHealerArgs{
+		Provisioner:           p,
+		DisabledTime:          20,
+		FailuresBeforeHealing: 1,
+		WaitTimeNewMachine:    time.Minute,
+	})
+	healer.Shutdown()
+	for _, state := range []string{nodestate.Cordoned, nodestate.Draining} {
+		node := cluster.Node{Address: "addr", Metadata: map[string]string{
+			"Failures":            "2",
+			"LastSuccess":         "something",
+			"iaas":                "invalid",
+			nodestate.MetadataKey: state,
+		}}
+		waitTime := healer.HandleError(&node)
+		c.Assert(waitTime, check.Equals, time.Duration(20))
+		c.Assert(eventtest.EventDesc{
+			IsEmpty: true,
+		}, eventtest.HasEvent)
+	}
+}
+
 func (s *S) TestHealerHandleErrorThrottled(c *check.C) {
 	factory, iaasInst := dockertest.NewHealerIaaSConstructorWithInst("127.0.0.1")
 	iaas.RegisterIaasProvider("my-healer-iaas", factory)
@@ -523,6 +553,46 @@ func (s *S) TestHealerUpdateNodeData(c *check.C) {
 	})
 }
 
+func (s *S) TestHealerUpdateNodeDataWithMetrics(c *check.C) {
+	node1, err := testing.NewServer("127.0.0.1:0", nil, nil)
+	c.Assert(err, check.IsNil)
+	p, err := s.newFakeDockerProvisioner(node1.URL())
+	c.Assert(err, check.IsNil)
+	defer p.Destroy()
+	healer := NewNodeHealer(NodeHealerArgs{
+		Provisioner: p,
+	})
+	healer.Shutdown()
+	data := provision.NodeStatusData{
+		Addrs:   []string{"127.0.0.1"},
+		Checks:  []provision.NodeCheckResult{{Name: "ok1", Successful: true}},
+		Metrics: &provision.NodeMetrics{CpuUsage: 0.75},
+	}
+	err = healer.UpdateNodeData(data)
+	c.Assert(err, check.IsNil)
+	metrics, err := NodesMetrics([]string{node1.URL(), "http://other:2375"}, time.Minute)
+	c.Assert(err, check.IsNil)
+	c.Assert(metrics, check.DeepEquals, map[string]provision.NodeMetrics{
+		node1.URL(): {CpuUsage: 0.75},
+	})
+	data.Metrics = nil
+	err = healer.UpdateNodeData(data)
+	c.Assert(err, check.IsNil)
+	metrics, err = NodesMetrics([]string{node1.URL()}, time.Minute)
+	c.Assert(err, check.IsNil)
+	c.Assert(metrics, check.DeepEquals, map[string]provision.NodeMetrics{
+		node1.URL(): {CpuUsage: 0.75},
+	})
+	coll, err := nodeDataCollection()
+	c.Assert(err, check.IsNil)
+	defer coll.Close()
+	err = coll.UpdateId(node1.URL(), bson.M{"$set": bson.M{"lastmetrics": time.Now().UTC().Add(-2 * time.Minute)}})
+	c.Assert(err, check.IsNil)
+	metrics, err = NodesMetrics([]string{node1.URL()}, time.Minute)
+	c.Assert(err, check.IsNil)
+	c.Assert(metrics, check.HasLen, 0)
+}
+
 func (s *S) TestHealerUpdateNodeDataSavesLast10Checks(c *check.C) {
 	node1, err := testing.NewServer("127.0.0.1:0", nil, nil)
 	c.Assert(err, check.IsNil)
@@ -1059,6 +1129,204 @@ func (s *S) TestTryHealingNodeDoubleCheck(c *check.C) {
 	}, eventtest.HasEvent)
 }
 
+func (s *S) TestReconcileNodeContainers(c *check.C) {
+	err := nodecontainer.AddNewContainer("", &nodecontainer.NodeContainerConfig{
+		Name:   "bs",
+		Config: docker.Config{Image: "bsimg"},
+	})
+	c.Assert(err, check.IsNil)
+	node1, err := testing.NewServer("127.0.0.1:0", nil, nil)
+	c.Assert(err, check.IsNil)
+	p, err := s.newFakeDockerProvisioner(node1.URL())
+	c.Assert(err, check.IsNil)
+	defer p.Destroy()
+	healer := NewNodeHealer(NodeHealerArgs{Provisioner: p})
+	healer.Shutdown()
+	nodes, err := p.Cluster().UnfilteredNodes()
+	c.Assert(err, check.IsNil)
+	nodesMap := map[string]*cluster.Node{nodes[0].Address: &nodes[0]}
+	err = healer.reconcileNodeContainers(nodesMap)
+	c.Assert(err, check.IsNil)
+	evts, err := event.List(&event.Filter{KindName: "healer-reconcile"})
+	c.Assert(err, check.IsNil)
+	c.Assert(evts, check.HasLen, 0)
+	err = healerConfig().SaveBase(NodeHealerConfig{ReconcileNodeContainers: boolPtr(true)})
+	c.Assert(err, check.IsNil)
+	err = healer.reconcileNodeContainers(nodesMap)
+	c.Assert(err, check.IsNil)
+	client, err := docker.NewClient(node1.URL())
+	c.Assert(err, check.IsNil)
+	cont, err := client.InspectContainer("bs")
+	c.Assert(err, check.IsNil)
+	c.Assert(cont.State.Running, check.Equals, true)
+	c.Assert(eventtest.EventDesc{
+		Target: event.Target{Type: event.TargetTypeNode, Value: nodes[0].Address},
+		Kind:   "healer-reconcile",
+		StartCustomData: map[string]interface{}{
+			"node._id":   nodes[0].Address,
+			"containers": []string{"bs"},
+		},
+	}, eventtest.HasEvent)
+	err = healer.reconcileNodeContainers(nodesMap)
+	c.Assert(err, check.IsNil)
+	evts, err = event.List(&event.Filter{KindName: "healer-reconcile"})
+	c.Assert(err, check.IsNil)
+	c.Assert(evts, check.HasLen, 1)
+}
+
+func (s *S) TestTryHealingNodePausesPool(c *check.C) {
+	conf := healerConfig()
+	err := conf.SaveBase(NodeHealerConfig{Enabled: boolPtr(true), MaxUnresponsiveTime: intPtr(1), MaxUnhealthyPercent: intPtr(50)})
+	c.Assert(err, check.IsNil)
+	factory, iaasInst := dockertest.NewHealerIaaSConstructorWithInst("127.0.0.1")
+	iaas.RegisterIaasProvider("my-healer-iaas", factory)
+	_, err = iaas.CreateMachineForIaaS("my-healer-iaas", map[string]string{})
+	c.Assert(err, check.IsNil)
+	iaasInst.Addr = "localhost"
+	node1, err := testing.NewServer("127.0.0.1:0", nil, nil)
+	c.Assert(err, check.IsNil)
+	p, err := s.newFakeDockerProvisioner(node1.URL())
+	c.Assert(err, check.IsNil)
+	defer p.Destroy()
+	healer := NewNodeHealer(NodeHealerArgs{
+		Provisioner:        p,
+		WaitTimeNewMachine: time.Minute,
+	})
+	healer.Shutdown()
+	healer.started = time.Now().Add(-3 * time.Second)
+	err = healer.UpdateNodeData(provision.NodeStatusData{
+		Addrs:  []string{"127.0.0.1"},
+		Checks: []provision.NodeCheckResult{},
+	})
+	c.Assert(err, check.IsNil)
+	time.Sleep(1200 * time.Millisecond)
+	nodes, err := p.Cluster().UnfilteredNodes()
+	c.Assert(err, check.IsNil)
+	c.Assert(nodes, check.HasLen, 1)
+	nodes[0].Metadata["iaas"] = "my-healer-iaas"
+	nodes[0].Metadata["pool"] = "p1"
+	_, err = p.Cluster().UpdateNode(nodes[0])
+	c.Assert(err, check.IsNil)
+	err = healer.tryHealingNode(&nodes[0], "something", nil)
+	c.Assert(err, check.IsNil)
+	nodes, err = p.Cluster().UnfilteredNodes()
+	c.Assert(err, check.IsNil)
+	c.Assert(nodes, check.HasLen, 1)
+	c.Assert(tsurunet.URLToHost(nodes[0].Address), check.Equals, "127.0.0.1")
+	pause, err := getPoolPause("p1")
+	c.Assert(err, check.IsNil)
+	c.Assert(pause, check.NotNil)
+	c.Assert(pause.Unhealthy, check.Equals, 1)
+	c.Assert(pause.Total, check.Equals, 1)
+	c.Assert(eventtest.EventDesc{
+		Target: event.Target{Type: "pool", Value: "p1"},
+		Kind:   "healer-pause",
+		StartCustomData: map[string]interface{}{
+			"unhealthy":           1,
+			"total":               1,
+			"maxunhealthypercent": 50,
+		},
+	}, eventtest.HasEvent)
+	err = healer.tryHealingNode(&nodes[0], "something", nil)
+	c.Assert(err, check.IsNil)
+	evts, err := event.List(&event.Filter{KindName: "healer"})
+	c.Assert(err, check.IsNil)
+	c.Assert(evts, check.HasLen, 0)
+	err = ResumePool("p1")
+	c.Assert(err, check.IsNil)
+	pause, err = getPoolPause("p1")
+	c.Assert(err, check.IsNil)
+	c.Assert(pause, check.IsNil)
+	err = ResumePool("p1")
+	c.Assert(err, check.Equals, ErrPoolNotPaused)
+}
+
+func (s *S) TestTryHealingNodeMaxConcurrentHeals(c *check.C) {
+	factory, iaasInst := dockertest.NewHealerIaaSConstructorWithInst("127.0.0.1")
+	iaas.RegisterIaasProvider("my-healer-iaas", factory)
+	_, err := iaas.CreateMachineForIaaS("my-healer-iaas", map[string]string{})
+	c.Assert(err, check.IsNil)
+	iaasInst.Addr = "localhost"
+	node1, err := testing.NewServer("127.0.0.1:0", nil, nil)
+	c.Assert(err, check.IsNil)
+	node2, err := testing.NewServer("127.0.0.1:0", nil, nil)
+	c.Assert(err, check.IsNil)
+	config.Set("iaas:node-protocol", "http")
+	config.Set("iaas:node-port", dockertest.URLPort(node2.URL()))
+	defer config.Unset("iaas:node-protocol")
+	defer config.Unset("iaas:node-port")
+	p, err := s.newFakeDockerProvisioner(node1.URL())
+	c.Assert(err, check.IsNil)
+	defer p.Destroy()
+	healer := NewNodeHealer(NodeHealerArgs{
+		Provisioner:        p,
+		WaitTimeNewMachine: time.Minute,
+	})
+	healer.Shutdown()
+	healer.started = time.Now().Add(-3 * time.Second)
+	conf := healerConfig()
+	err = conf.SaveBase(NodeHealerConfig{Enabled: boolPtr(true), MaxUnresponsiveTime: intPtr(1), MaxConcurrentHeals: intPtr(1)})
+	c.Assert(err, check.IsNil)
+	err = healer.UpdateNodeData(provision.NodeStatusData{
+		Addrs:  []string{"127.0.0.1"},
+		Checks: []provision.NodeCheckResult{},
+	})
+	c.Assert(err, check.IsNil)
+	time.Sleep(1200 * time.Millisecond)
+	nodes, err := p.Cluster().UnfilteredNodes()
+	c.Assert(err, check.IsNil)
+	c.Assert(nodes, check.HasLen, 1)
+	nodes[0].Metadata["iaas"] = "my-healer-iaas"
+	nodes[0].Metadata["pool"] = "p1"
+	_, err = p.Cluster().UpdateNode(nodes[0])
+	c.Assert(err, check.IsNil)
+	otherNode := &cluster.Node{Address: "http://10.0.0.1:2375", Metadata: map[string]string{"pool": "p1"}}
+	otherEvt, err := event.NewInternal(&event.Opts{
+		Target:       event.Target{Type: event.TargetTypeNode, Value: otherNode.Address},
+		InternalKind: "healer",
+		CustomData:   nodeHealerCustomData{Node: otherNode, Reason: "other"},
+	})
+	c.Assert(err, check.IsNil)
+	err = healer.tryHealingNode(&nodes[0], "something", nil)
+	c.Assert(err, check.IsNil)
+	nodes, err = p.Cluster().UnfilteredNodes()
+	c.Assert(err, check.IsNil)
+	c.Assert(nodes, check.HasLen, 1)
+	c.Assert(tsurunet.URLToHost(nodes[0].Address), check.Equals, "127.0.0.1")
+	evts, err := event.List(&event.Filter{KindName: "healer"})
+	c.Assert(err, check.IsNil)
+	c.Assert(evts, check.HasLen, 1)
+	err = otherEvt.Done(nil)
+	c.Assert(err, check.IsNil)
+	err = healer.tryHealingNode(&nodes[0], "something", nil)
+	c.Assert(err, check.IsNil)
+	nodes, err = p.Cluster().UnfilteredNodes()
+	c.Assert(err, check.IsNil)
+	c.Assert(nodes, check.HasLen, 1)
+	c.Assert(tsurunet.URLToHost(nodes[0].Address), check.Equals, "localhost")
+}
+
+func (s *S) TestConcurrentHealsAllowedIgnoresContainerHeals(c *check.C) {
+	containerEvt, err := event.NewInternal(&event.Opts{
+		Target:       event.Target{Type: event.TargetTypeContainer, Value: "c1"},
+		InternalKind: "healer",
+		CustomData:   map[string]string{"id": "c1"},
+	})
+	c.Assert(err, check.IsNil)
+	defer containerEvt.Done(nil)
+	node := &cluster.Node{Address: "http://10.0.0.1:2375", Metadata: map[string]string{}}
+	nodeEvt, err := event.NewInternal(&event.Opts{
+		Target:       event.Target{Type: event.TargetTypeNode, Value: node.Address},
+		InternalKind: "healer",
+		CustomData:   nodeHealerCustomData{Node: node, Reason: "something"},
+	})
+	c.Assert(err, check.IsNil)
+	defer nodeEvt.Done(nil)
+	allowed, err := concurrentHealsAllowed(nodeEvt, "", NodeHealerConfig{MaxConcurrentHeals: intPtr(1)})
+	c.Assert(err, check.IsNil)
+	c.Assert(allowed, check.Equals, true)
+}
+
 func (s *S) TestUpdateConfigIgnoresEmpty(c *check.C) {
 	err := UpdateConfig("", NodeHealerConfig{
 		Enabled:             boolPtr(true),
@@ -1070,11 +1338,14 @@ func (s *S) TestUpdateConfigIgnoresEmpty(c *check.C) {
 	err = conf.Load("p1", &nodeConf)
 	c.Assert(err, check.IsNil)
 	c.Assert(nodeConf, check.DeepEquals, NodeHealerConfig{
-		Enabled:                      boolPtr(true),
-		MaxUnresponsiveTime:          intPtr(1),
-		EnabledInherited:             true,
-		MaxUnresponsiveTimeInherited: true,
-		MaxTimeSinceSuccessInherited: true,
+		Enabled:                          boolPtr(true),
+		MaxUnresponsiveTime:              intPtr(1),
+		EnabledInherited:                 true,
+		MaxUnresponsiveTimeInherited:     true,
+		MaxTimeSinceSuccessInherited:     true,
+		MaxConcurrentHealsInherited:      true,
+		MaxUnhealthyPercentInherited:     true,
+		ReconcileNodeContainersInherited: true,
 	})
 	err = UpdateConfig("p1", NodeHealerConfig{
 		MaxTimeSinceSuccess: intPtr(2),
@@ -1084,12 +1355,15 @@ func (s *S) TestUpdateConfigIgnoresEmpty(c *check.C) {
 	err = conf.Load("p1", &nodeConf)
 	c.Assert(err, check.IsNil)
 	c.Assert(nodeConf, check.DeepEquals, NodeHealerConfig{
-		Enabled:                      boolPtr(true),
-		MaxUnresponsiveTime:          intPtr(1),
-		MaxTimeSinceSuccess:          intPtr(2),
-		EnabledInherited:             true,
-		MaxUnresponsiveTimeInherited: true,
-		MaxTimeSinceSuccessInherited: false,
+		Enabled:                          boolPtr(true),
+		MaxUnresponsiveTime:              intPtr(1),
+		MaxTimeSinceSuccess:              intPtr(2),
+		EnabledInherited:                 true,
+		MaxUnresponsiveTimeInherited:     true,
+		MaxTimeSinceSuccessInherited:     false,
+		MaxConcurrentHealsInherited:      true,
+		MaxUnhealthyPercentInherited:     true,
+		ReconcileNodeContainersInherited: true,
 	})
 	err = UpdateConfig("p1", NodeHealerConfig{
 		MaxTimeSinceSuccess: intPtr(2),
@@ -1100,12 +1374,15 @@ func (s *S) TestUpdateConfigIgnoresEmpty(c *check.C) {
 	err = conf.Load("p1", &nodeConf)
 	c.Assert(err, check.IsNil)
 	c.Assert(nodeConf, check.DeepEquals, NodeHealerConfig{
-		Enabled:                      boolPtr(true),
-		MaxUnresponsiveTime:          intPtr(9),
-		MaxTimeSinceSuccess:          intPtr(2),
-		EnabledInherited:             true,
-		MaxUnresponsiveTimeInherited: false,
-		MaxTimeSinceSuccessInherited: false,
+		Enabled:                          boolPtr(true),
+		MaxUnresponsiveTime:              intPtr(9),
+		MaxTimeSinceSuccess:              intPtr(2),
+		EnabledInherited:                 true,
+		MaxUnresponsiveTimeInherited:     false,
+		MaxTimeSinceSuccessInherited:     false,
+		MaxConcurrentHealsInherited:      true,
+		MaxUnhealthyPercentInherited:     true,
+		ReconcileNodeContainersInherited: true,
 	})
 
 }
@@ -8,6 +8,7 @@ import (
 	"io"
 	"sync"
 
+	"github.com/fsouza/go-dockerclient"
 	"github.com/tsuru/tsuru/provision/docker/container"
 	"gopkg.in/mgo.v2/bson"
 )
@@ -19,6 +20,7 @@ type DockerProvisioner interface {
 	HandleMoveErrors(errors chan error, w io.Writer) error
 	GetContainer(id string) (*container.Container, error)
 	ListContainers(query bson.M) ([]container.Container, error)
+	RegistryAuthConfig() docker.AuthConfiguration
 }
 
 type AppLocker interface {
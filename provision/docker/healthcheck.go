@@ -18,35 +18,84 @@ import (
 	"github.com/tsuru/tsuru/provision/docker/container"
 )
 
-func runHealthcheck(cont *container.Container, w io.Writer) error {
+type healthcheckProbe struct {
+	path            string
+	method          string
+	status          int
+	match           string
+	matchRE         *regexp.Regexp
+	allowedFailures int
+}
+
+// newHealthcheckProbe returns the healthcheck configured in the tsuru.yaml of
+// the container image, or nil if the image has no healthcheck.
+func newHealthcheckProbe(cont *container.Container) (*healthcheckProbe, error) {
 	yamlData, err := getImageTsuruYamlData(cont.Image)
 	if err != nil {
-		return err
+		return nil, err
+	}
+	probe := healthcheckProbe{
+		path:            yamlData.Healthcheck.Path,
+		method:          yamlData.Healthcheck.Method,
+		match:           yamlData.Healthcheck.Match,
+		status:          yamlData.Healthcheck.Status,
+		allowedFailures: yamlData.Healthcheck.AllowedFailures,
+	}
+	if probe.path == "" {
+		return nil, nil
+	}
+	probe.path = strings.TrimSpace(strings.TrimLeft(probe.path, "/"))
+	if probe.method == "" {
+		probe.method = "get"
 	}
-	path := yamlData.Healthcheck.Path
-	method := yamlData.Healthcheck.Method
-	match := yamlData.Healthcheck.Match
-	status := yamlData.Healthcheck.Status
-	allowedFailures := yamlData.Healthcheck.AllowedFailures
-	if path == "" {
-		return nil
+	probe.method = strings.ToUpper(probe.method)
+	if probe.status == 0 && probe.match == "" {
+		probe.status = 200
+	}
+	if probe.match != "" {
+		probe.match = "(?s)" + probe.match
+		probe.matchRE, err = regexp.Compile(probe.match)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return &probe, nil
+}
+
+// check runs the healthcheck request once against the container. The
+// returned bool indicates whether the container answered the request at all.
+func (p *healthcheckProbe) check(cont *container.Container) (bool, error) {
+	url := fmt.Sprintf("http://%s:%s/%s", cont.HostAddr, cont.HostPort, p.path)
+	req, err := http.NewRequest(p.method, url, nil)
+	if err != nil {
+		return false, err
 	}
-	path = strings.TrimSpace(strings.TrimLeft(path, "/"))
-	if method == "" {
-		method = "get"
+	rsp, err := net.Dial5Full60ClientNoKeepAlive.Do(req)
+	if err != nil {
+		return false, fmt.Errorf("healthcheck fail(%s): %s", cont.ShortID(), err.Error())
 	}
-	method = strings.ToUpper(method)
-	if status == 0 && match == "" {
-		status = 200
+	defer rsp.Body.Close()
+	if p.status != 0 && rsp.StatusCode != p.status {
+		return true, fmt.Errorf("healthcheck fail(%s): wrong status code, expected %d, got: %d", cont.ShortID(), p.status, rsp.StatusCode)
 	}
-	var matchRE *regexp.Regexp
-	if match != "" {
-		match = "(?s)" + match
-		matchRE, err = regexp.Compile(match)
+	if p.matchRE != nil {
+		result, err := ioutil.ReadAll(rsp.Body)
 		if err != nil {
-			return err
+			return true, err
+		}
+		if !p.matchRE.Match(result) {
+			return true, fmt.Errorf("healthcheck fail(%s): unexpected result, expected %q, got: %s", cont.ShortID(), p.match, string(result))
 		}
 	}
+	return true, nil
+}
+
+func runHealthcheck(cont *container.Container, w io.Writer) error {
+	probe, err := newHealthcheckProbe(cont)
+	if err != nil || probe == nil {
+		return err
+	}
+	allowedFailures := probe.allowedFailures
 	maxWaitTime, _ := config.GetInt("docker:healthcheck:max-time")
 	if maxWaitTime == 0 {
 		maxWaitTime = 120
@@ -54,36 +103,13 @@ func runHealthcheck(cont *container.Container, w io.Writer) error {
 	maxWaitTime = maxWaitTime * int(time.Second)
 	sleepTime := 3 * time.Second
 	startedTime := time.Now()
-	url := fmt.Sprintf("http://%s:%s/%s", cont.HostAddr, cont.HostPort, path)
 	for {
-		var lastError error = nil
-		req, err := http.NewRequest(method, url, nil)
-		if err != nil {
-			return err
-		}
-		rsp, err := net.Dial5Full60ClientNoKeepAlive.Do(req)
-		if err != nil {
-			lastError = fmt.Errorf("healthcheck fail(%s): %s", cont.ShortID(), err.Error())
-		} else {
-			defer rsp.Body.Close()
-			if status != 0 && rsp.StatusCode != status {
-				lastError = fmt.Errorf("healthcheck fail(%s): wrong status code, expected %d, got: %d", cont.ShortID(), status, rsp.StatusCode)
-			} else if matchRE != nil {
-				result, err := ioutil.ReadAll(rsp.Body)
-
-				if err != nil {
-					lastError = err
-				}
-				if !matchRE.Match(result) {
-					lastError = fmt.Errorf("healthcheck fail(%s): unexpected result, expected %q, got: %s", cont.ShortID(), match, string(result))
-				}
-			}
-			if lastError != nil {
-				if allowedFailures == 0 {
-					return lastError
-				}
-				allowedFailures--
+		answered, lastError := probe.check(cont)
+		if lastError != nil && answered {
+			if allowedFailures == 0 {
+				return lastError
 			}
+			allowedFailures--
 		}
 		if lastError == nil {
 			fmt.Fprintf(w, " ---> healthcheck successful(%s)\n", cont.ShortID())
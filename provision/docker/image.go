@@ -165,6 +165,18 @@ func saveImageCustomData(imageName string, customData map[string]interface{}) er
 	return coll.Insert(data)
 }
 
+// saveImageMetadata stores a copy of the given metadata under a new image
+// name, keeping processes and custom data intact.
+func saveImageMetadata(imageName string, data ImageMetadata) error {
+	coll, err := imageCustomDataColl()
+	if err != nil {
+		return err
+	}
+	defer coll.Close()
+	data.Name = imageName
+	return coll.Insert(data)
+}
+
 func getImageCustomData(imageName string) (ImageMetadata, error) {
 	coll, err := imageCustomDataColl()
 	if err != nil {
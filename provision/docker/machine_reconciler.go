@@ -0,0 +1,453 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package docker
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/tsuru/config"
+	"github.com/tsuru/docker-cluster/cluster"
+	"github.com/tsuru/tsuru/db"
+	"github.com/tsuru/tsuru/db/storage"
+	"github.com/tsuru/tsuru/event"
+	"github.com/tsuru/tsuru/iaas"
+	"github.com/tsuru/tsuru/log"
+	"github.com/tsuru/tsuru/net"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+const (
+	// OrphanKindMachine is a machine known by tsuru which is not registered
+	// as a node in the cluster.
+	OrphanKindMachine = "machine"
+	// OrphanKindNode is a node created by an IaaS whose machine no longer
+	// exists, either in tsuru or in the IaaS.
+	OrphanKindNode = "node"
+	// OrphanKindUnknownMachine is a machine listed by the IaaS which is not
+	// known by tsuru.
+	OrphanKindUnknownMachine = "unknown-machine"
+
+	orphanReconcileEventKind = "orphan-reconcile"
+)
+
+// Orphan is a machine or a node out of sync between the IaaS machines and
+// the nodes of the docker cluster. MachineGone is set on orphan nodes whose
+// machine is confirmed to be missing by the IaaS, only these nodes are
+// deregistered by the reconciler, as other nodes may still be running units.
+// Kept is set on orphan machines whose node was removed without destroying
+// the machine, these machines are never destroyed by the reconciler.
+type Orphan struct {
+	Kind        string
+	IaaS        string
+	MachineID   string
+	Address     string
+	Pool        string
+	Reason      string
+	MachineGone bool
+	Kept        bool
+	FirstSeen   time.Time
+}
+
+func (o *Orphan) key() string {
+	if o.Kind == OrphanKindNode {
+		return o.Kind + "/" + o.Address
+	}
+	return o.Kind + "/" + o.IaaS + "/" + o.MachineID
+}
+
+type orphanEntry struct {
+	ID        string `bson:"_id"`
+	FirstSeen time.Time
+	Kept      bool
+}
+
+func (o *Orphan) setEntry(entry *orphanEntry) {
+	o.FirstSeen = entry.FirstSeen
+	if o.Kind == OrphanKindMachine && entry.Kept {
+		o.Kept = true
+		o.Reason = "machine was kept after its node was removed"
+	}
+}
+
+type machineReconciler struct {
+	RunInterval     time.Duration
+	GracePeriod     time.Duration
+	DestroyMachines bool
+	DeregisterNodes bool
+	Enabled         bool
+	provisioner     *dockerProvisioner
+	done            chan bool
+}
+
+func (p *dockerProvisioner) initMachineReconciler() *machineReconciler {
+	enabled, _ := config.GetBool("docker:machine-reconciler:enabled")
+	runInterval, _ := config.GetInt("docker:machine-reconciler:run-interval")
+	if runInterval <= 0 {
+		runInterval = 10 * 60
+	}
+	gracePeriod, err := config.GetInt("docker:machine-reconciler:grace-period")
+	if err != nil {
+		gracePeriod = 60 * 60
+	}
+	destroyMachines, _ := config.GetBool("docker:machine-reconciler:destroy-machines")
+	deregisterNodes, _ := config.GetBool("docker:machine-reconciler:deregister-nodes")
+	return &machineReconciler{
+		RunInterval:     time.Duration(runInterval) * time.Second,
+		GracePeriod:     time.Duration(gracePeriod) * time.Second,
+		DestroyMachines: destroyMachines,
+		DeregisterNodes: deregisterNodes,
+		Enabled:         enabled,
+		provisioner:     p,
+		done:            make(chan bool),
+	}
+}
+
+func (r *machineReconciler) run() {
+	for {
+		err := r.runOnce()
+		if err != nil {
+			log.Errorf("[machine reconciler] %s", err)
+		}
+		select {
+		case <-r.done:
+			return
+		case <-time.After(r.RunInterval):
+		}
+	}
+}
+
+func (r *machineReconciler) Shutdown() {
+	r.done <- true
+}
+
+func (r *machineReconciler) String() string {
+	return "machine reconciler"
+}
+
+// runOnce looks for orphans and, when configured, destroys the orphan
+// machines and deregisters the orphan nodes found for longer than the grace
+// period. Orphan nodes whose machine is not confirmed to be gone by the IaaS
+// and machines kept after their nodes were removed are only reported.
+func (r *machineReconciler) runOnce() error {
+	orphans, err := findOrphans(r.provisioner)
+	if err != nil {
+		return err
+	}
+	err = trackOrphans(orphans)
+	if err != nil {
+		return err
+	}
+	for i := range orphans {
+		o := &orphans[i]
+		if time.Since(o.FirstSeen) < r.GracePeriod {
+			continue
+		}
+		if o.Kind == OrphanKindNode && (!r.DeregisterNodes || !o.MachineGone) {
+			continue
+		}
+		if o.Kind != OrphanKindNode && (!r.DestroyMachines || o.Kept) {
+			continue
+		}
+		err = r.reconcileOrphan(o)
+		if err != nil {
+			log.Errorf("[machine reconciler] unable to reconcile orphan %s: %s", o.key(), err)
+		}
+	}
+	return nil
+}
+
+func (r *machineReconciler) reconcileOrphan(o *Orphan) (err error) {
+	target := event.Target{Type: event.TargetTypeIaas, Value: o.IaaS}
+	if o.Kind == OrphanKindNode {
+		target = event.Target{Type: event.TargetTypeNode, Value: o.Address}
+	}
+	evt, err := event.NewInternal(&event.Opts{
+		Target:       target,
+		InternalKind: orphanReconcileEventKind,
+		CustomData:   *o,
+	})
+	if err != nil {
+		if _, ok := err.(event.ErrEventLocked); ok {
+			log.Debugf("[machine reconciler] skipping orphan %s: %s", o.key(), err)
+			return nil
+		}
+		return err
+	}
+	defer func() {
+		evt.Done(err)
+	}()
+	switch o.Kind {
+	case OrphanKindNode:
+		err = r.provisioner.Cluster().Unregister(o.Address)
+		if err != nil {
+			return err
+		}
+		if o.MachineID != "" {
+			var m iaas.Machine
+			m, err = iaas.FindMachineById(o.MachineID)
+			if err == mgo.ErrNotFound {
+				err = nil
+				break
+			}
+			if err != nil {
+				return err
+			}
+			err = m.Destroy()
+		}
+	case OrphanKindMachine:
+		var m iaas.Machine
+		m, err = iaas.FindMachineById(o.MachineID)
+		if err != nil {
+			return err
+		}
+		err = m.Destroy()
+	case OrphanKindUnknownMachine:
+		m := iaas.Machine{Id: o.MachineID, Iaas: o.IaaS, Address: o.Address}
+		err = m.Destroy()
+		if err == mgo.ErrNotFound {
+			err = nil
+		}
+	}
+	if err != nil {
+		return err
+	}
+	return untrackOrphan(o)
+}
+
+// listOrphans finds the current orphans, along with the tracking state stored
+// by the reconciler. Orphans not yet tracked by the reconciler have a zero
+// FirstSeen.
+func listOrphans(p *dockerProvisioner) ([]Orphan, error) {
+	orphans, err := findOrphans(p)
+	if err != nil {
+		return nil, err
+	}
+	coll, err := orphansCollection()
+	if err != nil {
+		return nil, err
+	}
+	defer coll.Close()
+	for i := range orphans {
+		var entry orphanEntry
+		err = coll.FindId(orphans[i].key()).One(&entry)
+		if err == mgo.ErrNotFound {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		orphans[i].setEntry(&entry)
+	}
+	return orphans, nil
+}
+
+// findOrphans cross-references the machines known by tsuru, the nodes in the
+// cluster and the machines listed by the IaaSs implementing iaas.Lister.
+// Nodes not created by an IaaS are ignored.
+func findOrphans(p *dockerProvisioner) ([]Orphan, error) {
+	machines, err := iaas.ListMachines()
+	if err != nil {
+		return nil, err
+	}
+	nodes, err := p.Cluster().UnfilteredNodes()
+	if err != nil {
+		return nil, err
+	}
+	iaasNames := map[string]struct{}{}
+	for _, m := range machines {
+		iaasNames[m.Iaas] = struct{}{}
+	}
+	for _, n := range nodes {
+		if n.Metadata["iaas"] != "" {
+			iaasNames[n.Metadata["iaas"]] = struct{}{}
+		}
+	}
+	listed := map[string]map[string]iaas.Machine{}
+	for name := range iaasNames {
+		iaasMachines, listErr := iaas.ListIaaSMachines(name)
+		if listErr != nil {
+			if listErr != iaas.ErrListNotSupported {
+				log.Errorf("[machine reconciler] unable to list machines in IaaS %q, ignoring: %s", name, listErr)
+			}
+			continue
+		}
+		listed[name] = map[string]iaas.Machine{}
+		for _, m := range iaasMachines {
+			listed[name][m.Id] = m
+		}
+	}
+	var orphans []Orphan
+	known := map[string]map[string]struct{}{}
+	matchedNodes := map[string]struct{}{}
+	for _, m := range machines {
+		if known[m.Iaas] == nil {
+			known[m.Iaas] = map[string]struct{}{}
+		}
+		known[m.Iaas][m.Id] = struct{}{}
+		node := nodeForMachine(nodes, &m)
+		missing := false
+		if iaasMachines, ok := listed[m.Iaas]; ok {
+			_, found := iaasMachines[m.Id]
+			missing = !found
+		}
+		if node == nil {
+			reason := "machine is not registered as a node"
+			if missing {
+				reason = "machine is not registered as a node and was not found in the IaaS"
+			}
+			orphans = append(orphans, Orphan{
+				Kind:      OrphanKindMachine,
+				IaaS:      m.Iaas,
+				MachineID: m.Id,
+				Address:   m.Address,
+				Pool:      m.CreationParams[poolMetadataName],
+				Reason:    reason,
+			})
+			continue
+		}
+		matchedNodes[node.Address] = struct{}{}
+		if missing {
+			orphans = append(orphans, Orphan{
+				Kind:        OrphanKindNode,
+				IaaS:        m.Iaas,
+				MachineID:   m.Id,
+				Address:     node.Address,
+				Pool:        node.Metadata[poolMetadataName],
+				Reason:      "machine was not found in the IaaS",
+				MachineGone: true,
+			})
+		}
+	}
+	for _, n := range nodes {
+		if n.Metadata["iaas"] == "" && n.Metadata["iaas-id"] == "" {
+			continue
+		}
+		if _, ok := matchedNodes[n.Address]; ok {
+			continue
+		}
+		orphan := Orphan{
+			Kind:      OrphanKindNode,
+			IaaS:      n.Metadata["iaas"],
+			MachineID: n.Metadata["iaas-id"],
+			Address:   n.Address,
+			Pool:      n.Metadata[poolMetadataName],
+			Reason:    "machine was not found in tsuru",
+		}
+		if iaasMachines, ok := listed[orphan.IaaS]; ok && orphan.MachineID != "" {
+			if _, found := iaasMachines[orphan.MachineID]; !found {
+				orphan.Reason = "machine was not found in tsuru nor in the IaaS"
+				orphan.MachineGone = true
+			}
+		}
+		orphans = append(orphans, orphan)
+	}
+	for name, iaasMachines := range listed {
+		for id, m := range iaasMachines {
+			if _, ok := known[name][id]; ok {
+				continue
+			}
+			orphans = append(orphans, Orphan{
+				Kind:      OrphanKindUnknownMachine,
+				IaaS:      name,
+				MachineID: id,
+				Address:   m.Address,
+				Reason:    "machine is not known by tsuru",
+			})
+		}
+	}
+	sort.Sort(orphanList(orphans))
+	return orphans, nil
+}
+
+type orphanList []Orphan
+
+func (l orphanList) Len() int           { return len(l) }
+func (l orphanList) Swap(i, j int)      { l[i], l[j] = l[j], l[i] }
+func (l orphanList) Less(i, j int) bool { return l[i].key() < l[j].key() }
+
+func nodeForMachine(nodes []cluster.Node, m *iaas.Machine) *cluster.Node {
+	for i := range nodes {
+		if nodes[i].Metadata["iaas-id"] == m.Id {
+			return &nodes[i]
+		}
+	}
+	for i := range nodes {
+		if net.URLToHost(nodes[i].Address) == m.Address {
+			return &nodes[i]
+		}
+	}
+	return nil
+}
+
+func orphansCollection() (*storage.Collection, error) {
+	conn, err := db.Conn()
+	if err != nil {
+		return nil, err
+	}
+	name, err := config.GetString("docker:collection")
+	if err != nil {
+		return nil, err
+	}
+	return conn.Collection(fmt.Sprintf("%s_orphans", name)), nil
+}
+
+// trackOrphans sets the time each orphan was first found, forgetting about
+// the previous orphans which are no longer out of sync.
+func trackOrphans(orphans []Orphan) error {
+	coll, err := orphansCollection()
+	if err != nil {
+		return err
+	}
+	defer coll.Close()
+	now := time.Now().UTC()
+	keys := make([]string, len(orphans))
+	for i := range orphans {
+		keys[i] = orphans[i].key()
+		_, err = coll.UpsertId(keys[i], bson.M{"$setOnInsert": bson.M{"firstseen": now}})
+		if err != nil {
+			return err
+		}
+		var entry orphanEntry
+		err = coll.FindId(keys[i]).One(&entry)
+		if err != nil {
+			return err
+		}
+		orphans[i].setEntry(&entry)
+	}
+	_, err = coll.RemoveAll(bson.M{"_id": bson.M{"$nin": keys}})
+	return err
+}
+
+// keepOrphanMachine flags a machine whose node was removed without destroying
+// it, so the reconciler never destroys it while it's not registered as a node.
+func keepOrphanMachine(m *iaas.Machine) error {
+	coll, err := orphansCollection()
+	if err != nil {
+		return err
+	}
+	defer coll.Close()
+	o := Orphan{Kind: OrphanKindMachine, IaaS: m.Iaas, MachineID: m.Id}
+	_, err = coll.UpsertId(o.key(), bson.M{
+		"$set":         bson.M{"kept": true},
+		"$setOnInsert": bson.M{"firstseen": time.Now().UTC()},
+	})
+	return err
+}
+
+func untrackOrphan(o *Orphan) error {
+	coll, err := orphansCollection()
+	if err != nil {
+		return err
+	}
+	defer coll.Close()
+	err = coll.RemoveId(o.key())
+	if err == mgo.ErrNotFound {
+		return nil
+	}
+	return err
+}
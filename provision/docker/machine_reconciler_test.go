@@ -0,0 +1,277 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package docker
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/tsuru/docker-cluster/cluster"
+	"github.com/tsuru/tsuru/event"
+	"github.com/tsuru/tsuru/iaas"
+	"github.com/tsuru/tsuru/provision/docker/container"
+	"github.com/tsuru/tsuru/provision/docker/dockertest"
+	"gopkg.in/check.v1"
+	"gopkg.in/mgo.v2"
+)
+
+type orphanTestIaaS struct {
+	sync.Mutex
+	listed  []iaas.Machine
+	deleted []string
+}
+
+func (i *orphanTestIaaS) CreateMachine(params map[string]string) (*iaas.Machine, error) {
+	return &iaas.Machine{Id: params["id"], Address: params["address"], Status: "running"}, nil
+}
+
+func (i *orphanTestIaaS) DeleteMachine(m *iaas.Machine) error {
+	i.Lock()
+	defer i.Unlock()
+	i.deleted = append(i.deleted, m.Id)
+	return nil
+}
+
+func (i *orphanTestIaaS) ListMachines() ([]iaas.Machine, error) {
+	return i.listed, nil
+}
+
+func (s *S) setUpOrphans(c *check.C) (*dockerProvisioner, *orphanTestIaaS) {
+	testIaaS := &orphanTestIaaS{listed: []iaas.Machine{
+		{Id: "m1", Address: "10.0.0.1"},
+		{Id: "m2", Address: "10.0.0.2"},
+		{Id: "m3", Address: "10.0.0.3"},
+	}}
+	iaas.RegisterIaasProvider("orphan-iaas", func(string) iaas.IaaS { return testIaaS })
+	for _, params := range []map[string]string{
+		{"id": "m1", "address": "10.0.0.1", "pool": "pool1"},
+		{"id": "m2", "address": "10.0.0.2", "pool": "pool1"},
+		{"id": "m4", "address": "10.0.0.4", "pool": "pool1"},
+	} {
+		_, err := iaas.CreateMachineForIaaS("orphan-iaas", params)
+		c.Assert(err, check.IsNil)
+	}
+	p := &dockerProvisioner{storage: &cluster.MapStorage{}}
+	var err error
+	p.cluster, err = cluster.New(nil, p.storage, "",
+		cluster.Node{Address: "http://10.0.0.1:2375", Metadata: map[string]string{"pool": "pool1", "iaas": "orphan-iaas", "iaas-id": "m1"}},
+		cluster.Node{Address: "http://10.0.0.4:2375", Metadata: map[string]string{"pool": "pool1", "iaas": "orphan-iaas"}},
+		cluster.Node{Address: "http://10.0.0.5:2375", Metadata: map[string]string{"pool": "pool2", "iaas": "orphan-iaas", "iaas-id": "m5"}},
+		cluster.Node{Address: "http://10.0.0.6:2375", Metadata: map[string]string{"pool": "pool2"}},
+	)
+	c.Assert(err, check.IsNil)
+	return p, testIaaS
+}
+
+func (s *S) TestFindOrphans(c *check.C) {
+	p, _ := s.setUpOrphans(c)
+	orphans, err := findOrphans(p)
+	c.Assert(err, check.IsNil)
+	c.Assert(orphans, check.DeepEquals, []Orphan{
+		{Kind: OrphanKindMachine, IaaS: "orphan-iaas", MachineID: "m2", Address: "10.0.0.2", Pool: "pool1", Reason: "machine is not registered as a node"},
+		{Kind: OrphanKindNode, IaaS: "orphan-iaas", MachineID: "m4", Address: "http://10.0.0.4:2375", Pool: "pool1", Reason: "machine was not found in the IaaS", MachineGone: true},
+		{Kind: OrphanKindNode, IaaS: "orphan-iaas", MachineID: "m5", Address: "http://10.0.0.5:2375", Pool: "pool2", Reason: "machine was not found in tsuru nor in the IaaS", MachineGone: true},
+		{Kind: OrphanKindUnknownMachine, IaaS: "orphan-iaas", MachineID: "m3", Address: "10.0.0.3", Reason: "machine is not known by tsuru"},
+	})
+}
+
+func (s *S) TestFindOrphansWithoutLister(c *check.C) {
+	iaas.RegisterIaasProvider("orphan-nolist-iaas", dockertest.NewHealerIaaSConstructor("10.0.0.9", nil))
+	_, err := iaas.CreateMachineForIaaS("orphan-nolist-iaas", map[string]string{})
+	c.Assert(err, check.IsNil)
+	p := &dockerProvisioner{storage: &cluster.MapStorage{}}
+	p.cluster, err = cluster.New(nil, p.storage, "",
+		cluster.Node{Address: "http://10.0.0.5:2375", Metadata: map[string]string{"iaas": "orphan-nolist-iaas"}},
+	)
+	c.Assert(err, check.IsNil)
+	orphans, err := findOrphans(p)
+	c.Assert(err, check.IsNil)
+	c.Assert(orphans, check.DeepEquals, []Orphan{
+		{Kind: OrphanKindMachine, IaaS: "orphan-nolist-iaas", MachineID: "m-10.0.0.9", Address: "10.0.0.9", Reason: "machine is not registered as a node"},
+		{Kind: OrphanKindNode, IaaS: "orphan-nolist-iaas", Address: "http://10.0.0.5:2375", Reason: "machine was not found in tsuru"},
+	})
+}
+
+func (s *S) TestTrackOrphansKeepsFirstSeen(c *check.C) {
+	p, _ := s.setUpOrphans(c)
+	orphans, err := findOrphans(p)
+	c.Assert(err, check.IsNil)
+	err = trackOrphans(orphans)
+	c.Assert(err, check.IsNil)
+	c.Assert(orphans, check.HasLen, 4)
+	firstSeen := orphans[0].FirstSeen
+	c.Assert(firstSeen.IsZero(), check.Equals, false)
+	machine, err := iaas.FindMachineById("m4")
+	c.Assert(err, check.IsNil)
+	err = machine.Destroy()
+	c.Assert(err, check.IsNil)
+	err = p.Cluster().Unregister("http://10.0.0.4:2375")
+	c.Assert(err, check.IsNil)
+	orphans, err = findOrphans(p)
+	c.Assert(err, check.IsNil)
+	err = trackOrphans(orphans)
+	c.Assert(err, check.IsNil)
+	c.Assert(orphans, check.HasLen, 3)
+	c.Assert(orphans[0].FirstSeen.Equal(firstSeen), check.Equals, true)
+	coll, err := orphansCollection()
+	c.Assert(err, check.IsNil)
+	defer coll.Close()
+	n, err := coll.Count()
+	c.Assert(err, check.IsNil)
+	c.Assert(n, check.Equals, 3)
+}
+
+func (s *S) TestListOrphansReadsTracking(c *check.C) {
+	p, _ := s.setUpOrphans(c)
+	orphans, err := listOrphans(p)
+	c.Assert(err, check.IsNil)
+	c.Assert(orphans, check.HasLen, 4)
+	c.Assert(orphans[0].FirstSeen.IsZero(), check.Equals, true)
+	coll, err := orphansCollection()
+	c.Assert(err, check.IsNil)
+	defer coll.Close()
+	n, err := coll.Count()
+	c.Assert(err, check.IsNil)
+	c.Assert(n, check.Equals, 0)
+	reconciler := &machineReconciler{provisioner: p, GracePeriod: time.Hour}
+	err = reconciler.runOnce()
+	c.Assert(err, check.IsNil)
+	orphans, err = listOrphans(p)
+	c.Assert(err, check.IsNil)
+	firstSeen := orphans[0].FirstSeen
+	c.Assert(firstSeen.IsZero(), check.Equals, false)
+	err = p.Cluster().Unregister("http://10.0.0.4:2375")
+	c.Assert(err, check.IsNil)
+	orphans, err = listOrphans(p)
+	c.Assert(err, check.IsNil)
+	c.Assert(orphans[0].FirstSeen.Equal(firstSeen), check.Equals, true)
+	n, err = coll.Count()
+	c.Assert(err, check.IsNil)
+	c.Assert(n, check.Equals, 4)
+}
+
+func (s *S) TestMachineReconcilerRunOnceKeepsKeptMachines(c *check.C) {
+	p, testIaaS := s.setUpOrphans(c)
+	machine, err := iaas.FindMachineById("m2")
+	c.Assert(err, check.IsNil)
+	err = keepOrphanMachine(&machine)
+	c.Assert(err, check.IsNil)
+	reconciler := &machineReconciler{provisioner: p, DestroyMachines: true}
+	err = reconciler.runOnce()
+	c.Assert(err, check.IsNil)
+	_, err = iaas.FindMachineById("m2")
+	c.Assert(err, check.IsNil)
+	sort.Strings(testIaaS.deleted)
+	c.Assert(testIaaS.deleted, check.DeepEquals, []string{"m3"})
+	orphans, err := listOrphans(p)
+	c.Assert(err, check.IsNil)
+	c.Assert(orphans[0].MachineID, check.Equals, "m2")
+	c.Assert(orphans[0].Kept, check.Equals, true)
+	c.Assert(orphans[0].Reason, check.Equals, "machine was kept after its node was removed")
+}
+
+func (s *S) TestMachineReconcilerRunOnce(c *check.C) {
+	p, testIaaS := s.setUpOrphans(c)
+	reconciler := &machineReconciler{provisioner: p, DestroyMachines: true, DeregisterNodes: true}
+	err := reconciler.runOnce()
+	c.Assert(err, check.IsNil)
+	machines, err := iaas.ListMachines()
+	c.Assert(err, check.IsNil)
+	c.Assert(machines, check.HasLen, 1)
+	c.Assert(machines[0].Id, check.Equals, "m1")
+	nodes, err := p.Cluster().UnfilteredNodes()
+	c.Assert(err, check.IsNil)
+	var addrs []string
+	for _, n := range nodes {
+		addrs = append(addrs, n.Address)
+	}
+	sort.Strings(addrs)
+	c.Assert(addrs, check.DeepEquals, []string{"http://10.0.0.1:2375", "http://10.0.0.6:2375"})
+	sort.Strings(testIaaS.deleted)
+	c.Assert(testIaaS.deleted, check.DeepEquals, []string{"m2", "m3", "m4"})
+	evts, err := event.List(&event.Filter{KindName: orphanReconcileEventKind})
+	c.Assert(err, check.IsNil)
+	c.Assert(evts, check.HasLen, 4)
+	var targets []string
+	for i := range evts {
+		c.Assert(evts[i].Error, check.Equals, "")
+		targets = append(targets, fmt.Sprintf("%s(%s)", evts[i].Target.Type, evts[i].Target.Value))
+	}
+	sort.Strings(targets)
+	c.Assert(targets, check.DeepEquals, []string{
+		"iaas(orphan-iaas)",
+		"iaas(orphan-iaas)",
+		"node(http://10.0.0.4:2375)",
+		"node(http://10.0.0.5:2375)",
+	})
+	orphans, err := listOrphans(p)
+	c.Assert(err, check.IsNil)
+	c.Assert(orphans, check.HasLen, 1)
+	c.Assert(orphans[0].Kind, check.Equals, OrphanKindUnknownMachine)
+}
+
+func (s *S) TestMachineReconcilerRunOnceGracePeriod(c *check.C) {
+	p, testIaaS := s.setUpOrphans(c)
+	reconciler := &machineReconciler{provisioner: p, DestroyMachines: true, DeregisterNodes: true, GracePeriod: time.Hour}
+	err := reconciler.runOnce()
+	c.Assert(err, check.IsNil)
+	machines, err := iaas.ListMachines()
+	c.Assert(err, check.IsNil)
+	c.Assert(machines, check.HasLen, 3)
+	nodes, err := p.Cluster().UnfilteredNodes()
+	c.Assert(err, check.IsNil)
+	c.Assert(nodes, check.HasLen, 4)
+	c.Assert(testIaaS.deleted, check.HasLen, 0)
+	evts, err := event.List(&event.Filter{KindName: orphanReconcileEventKind})
+	c.Assert(err, check.IsNil)
+	c.Assert(evts, check.HasLen, 0)
+}
+
+func (s *S) TestMachineReconcilerRunOnceOnlyDeregisterNodes(c *check.C) {
+	p, testIaaS := s.setUpOrphans(c)
+	reconciler := &machineReconciler{provisioner: p, DeregisterNodes: true}
+	err := reconciler.runOnce()
+	c.Assert(err, check.IsNil)
+	_, err = iaas.FindMachineById("m2")
+	c.Assert(err, check.IsNil)
+	_, err = iaas.FindMachineById("m4")
+	c.Assert(err, check.Equals, mgo.ErrNotFound)
+	nodes, err := p.Cluster().UnfilteredNodes()
+	c.Assert(err, check.IsNil)
+	c.Assert(nodes, check.HasLen, 2)
+	c.Assert(testIaaS.deleted, check.DeepEquals, []string{"m4"})
+}
+
+func (s *S) TestMachineReconcilerRunOnceKeepsNodesWithMachine(c *check.C) {
+	p, testIaaS := s.setUpOrphans(c)
+	p.collectionName = s.collName
+	testIaaS.listed = append(testIaaS.listed, iaas.Machine{Id: "m5", Address: "10.0.0.5"})
+	coll := p.Collection()
+	defer coll.Close()
+	err := coll.Insert(container.Container{ID: "c1", AppName: "myapp", HostAddr: "10.0.0.5"})
+	c.Assert(err, check.IsNil)
+	defer coll.RemoveId("c1")
+	orphans, err := findOrphans(p)
+	c.Assert(err, check.IsNil)
+	c.Assert(orphans[2], check.DeepEquals, Orphan{
+		Kind: OrphanKindNode, IaaS: "orphan-iaas", MachineID: "m5", Address: "http://10.0.0.5:2375", Pool: "pool2", Reason: "machine was not found in tsuru",
+	})
+	reconciler := &machineReconciler{provisioner: p, DeregisterNodes: true}
+	err = reconciler.runOnce()
+	c.Assert(err, check.IsNil)
+	_, err = p.Cluster().GetNode("http://10.0.0.5:2375")
+	c.Assert(err, check.IsNil)
+	containers, err := p.listContainersByHost("10.0.0.5")
+	c.Assert(err, check.IsNil)
+	c.Assert(containers, check.HasLen, 1)
+	evts, err := event.List(&event.Filter{Target: event.Target{Type: event.TargetTypeNode, Value: "http://10.0.0.5:2375"}})
+	c.Assert(err, check.IsNil)
+	c.Assert(evts, check.HasLen, 0)
+	orphans, err = listOrphans(p)
+	c.Assert(err, check.IsNil)
+	c.Assert(orphans, check.HasLen, 4)
+}
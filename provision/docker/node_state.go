@@ -0,0 +1,118 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package docker
+
+import (
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/tsuru/config"
+	"github.com/tsuru/docker-cluster/cluster"
+	"github.com/tsuru/tsuru/net"
+	"github.com/tsuru/tsuru/provision/docker/nodestate"
+)
+
+var drainCheckInterval = time.Second
+
+// setNodeMaintenanceState changes the maintenance state of the node. An empty
+// state takes the node out of maintenance.
+func (p *dockerProvisioner) setNodeMaintenanceState(address, state string) error {
+	_, err := p.Cluster().UpdateNode(cluster.Node{
+		Address:  address,
+		Metadata: map[string]string{nodestate.MetadataKey: state},
+	})
+	return err
+}
+
+func drainAvailabilityTimeout() time.Duration {
+	timeout, err := config.GetInt("docker:drain:availability-timeout")
+	if err != nil || timeout <= 0 {
+		timeout = 300
+	}
+	return time.Duration(timeout) * time.Second
+}
+
+// drainNode marks the node as draining and moves its containers, one at a
+// time, to other nodes. Before moving to the next container, it waits until
+// the app process has at least as many available units as it had before the
+// drain started. Once all containers are moved the node is left cordoned.
+func (p *dockerProvisioner) drainNode(address string, interval time.Duration, w io.Writer) error {
+	err := p.setNodeMaintenanceState(address, nodestate.Draining)
+	if err != nil {
+		return err
+	}
+	host := net.URLToHost(address)
+	containers, err := p.listContainersByHost(host)
+	if err != nil {
+		return err
+	}
+	if len(containers) == 0 {
+		fmt.Fprintf(w, "No units to move in %s\n", host)
+		return p.setNodeMaintenanceState(address, nodestate.Cordoned)
+	}
+	minAvailable := map[string]int{}
+	for _, c := range containers {
+		key := c.AppName + "/" + c.ProcessName
+		if _, ok := minAvailable[key]; ok {
+			continue
+		}
+		minAvailable[key], err = p.availableUnits(c.AppName, c.ProcessName)
+		if err != nil {
+			return err
+		}
+	}
+	fmt.Fprintf(w, "Draining %d units from %s...\n", len(containers), host)
+	locker := &appLocker{}
+	timeout := drainAvailabilityTimeout()
+	for i, c := range containers {
+		if i > 0 && interval > 0 {
+			time.Sleep(interval)
+		}
+		moveErrors := make(chan error, 1)
+		p.MoveOneContainer(c, "", moveErrors, nil, w, locker)
+		close(moveErrors)
+		err = p.HandleMoveErrors(moveErrors, w)
+		if err != nil {
+			return err
+		}
+		err = p.waitAvailableUnits(c.AppName, c.ProcessName, minAvailable[c.AppName+"/"+c.ProcessName], timeout)
+		if err != nil {
+			return err
+		}
+	}
+	return p.setNodeMaintenanceState(address, nodestate.Cordoned)
+}
+
+func (p *dockerProvisioner) availableUnits(appName, processName string) (int, error) {
+	containers, err := p.listContainersByProcess(appName, processName)
+	if err != nil {
+		return 0, err
+	}
+	var available int
+	for i := range containers {
+		if containers[i].Available() {
+			available++
+		}
+	}
+	return available, nil
+}
+
+func (p *dockerProvisioner) waitAvailableUnits(appName, processName string, min int, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		available, err := p.availableUnits(appName, processName)
+		if err != nil {
+			return err
+		}
+		if available >= min {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("timeout waiting for %q (process %q) to have %d available units, currently %d", appName, processName, min, available)
+		}
+		time.Sleep(drainCheckInterval)
+	}
+}
@@ -11,6 +11,7 @@ import (
 	"net/url"
 	"regexp"
 	"sort"
+	"strconv"
 	"strings"
 
 	"github.com/ajg/form"
@@ -267,6 +268,90 @@ func (c *NodeContainerInfo) Run(context *cmd.Context, client *cmd.Client) error
 	return nil
 }
 
+type NodeContainerStatus struct {
+	fs   *gnuflag.FlagSet
+	pool string
+}
+
+func (c *NodeContainerStatus) Info() *cmd.Info {
+	return &cmd.Info{
+		Name:  "node-container-status",
+		Usage: "node-container-status <name> [-p/--pool poolname]",
+		Desc: `Show the state of a node container in each node, comparing the image of the
+running container with the configured image.`,
+		MinArgs: 1,
+		MaxArgs: 1,
+	}
+}
+
+func (c *NodeContainerStatus) Run(context *cmd.Context, client *cmd.Client) error {
+	val := url.Values{}
+	if c.pool != "" {
+		val.Set("pool", c.pool)
+	}
+	u, err := cmd.GetURL(fmt.Sprintf("/docker/nodecontainers/%s/status?%s", context.Args[0], val.Encode()))
+	if err != nil {
+		return err
+	}
+	request, err := http.NewRequest("GET", u, nil)
+	if err != nil {
+		return err
+	}
+	rsp, err := client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer rsp.Body.Close()
+	if rsp.StatusCode == http.StatusNoContent {
+		fmt.Fprintln(context.Stdout, "No nodes found.")
+		return nil
+	}
+	var statuses []ContainerStatus
+	err = json.NewDecoder(rsp.Body).Decode(&statuses)
+	if err != nil {
+		return err
+	}
+	tbl := cmd.NewTable()
+	tbl.Headers = cmd.Row{"Node", "Pool", "Container", "State", "Image", "Up to date", "Restarts", "Error"}
+	for _, st := range statuses {
+		poolName := st.Pool
+		if poolName == "" {
+			poolName = emptyPoolLabel
+		}
+		containerID := st.ContainerID
+		if len(containerID) > 12 {
+			containerID = containerID[:12]
+		}
+		image := st.Image
+		if st.ImageDigest != "" && st.ImageDigest != image {
+			image = fmt.Sprintf("%s (%s)", image, st.ImageDigest)
+		}
+		tbl.AddRow(cmd.Row{
+			st.Address,
+			poolName,
+			containerID,
+			st.State,
+			image,
+			strconv.FormatBool(st.UpToDate),
+			strconv.Itoa(st.RestartCount),
+			st.Error,
+		})
+	}
+	tbl.Sort()
+	fmt.Fprint(context.Stdout, tbl.String())
+	return nil
+}
+
+func (c *NodeContainerStatus) Flags() *gnuflag.FlagSet {
+	if c.fs == nil {
+		c.fs = gnuflag.NewFlagSet("flags", gnuflag.ExitOnError)
+		msg := "Show only nodes in this pool."
+		c.fs.StringVar(&c.pool, "p", "", msg)
+		c.fs.StringVar(&c.pool, "pool", "", msg)
+	}
+	return c.fs
+}
+
 type NodeContainerUpdate struct {
 	fs        *gnuflag.FlagSet
 	pool      string
@@ -371,13 +456,27 @@ func (c *NodeContainerDelete) Flags() *gnuflag.FlagSet {
 
 type NodeContainerUpgrade struct {
 	cmd.ConfirmationCommand
+	fs            *gnuflag.FlagSet
+	pool          string
+	batchSize     int
+	batchPercent  int
+	pause         int
+	healthTimeout int
+	probePort     int
+	probePath     string
 }
 
 func (c *NodeContainerUpgrade) Info() *cmd.Info {
 	return &cmd.Info{
-		Name:    "node-container-upgrade",
-		Usage:   "node-container-upgrade <name> [-p/--pool poolname] [-y]",
-		Desc:    "Upgrade version and restart node containers.",
+		Name: "node-container-upgrade",
+		Usage: "node-container-upgrade <name> [-p/--pool poolname] [--batch-size n | --batch-percent n] [--pause seconds]" +
+			" [--health-timeout seconds] [--probe-port port [--probe-path path]] [-y]",
+		Desc: `Upgrade version and restart node containers.
+
+Nodes are upgraded in batches, by default all nodes are upgraded at once. After
+being restarted, the node container must be running, and respond to the HTTP
+probe if --probe-port is set, before --health-timeout expires. The upgrade is
+halted when any node in a batch fails this check.`,
 		MinArgs: 1,
 		MaxArgs: 1,
 	}
@@ -392,10 +491,28 @@ func (c *NodeContainerUpgrade) Run(context *cmd.Context, client *cmd.Client) err
 	if err != nil {
 		return err
 	}
-	request, err := http.NewRequest("POST", u, nil)
+	val := url.Values{}
+	val.Set("pool", c.pool)
+	intValues := map[string]int{
+		"batchsize":     c.batchSize,
+		"batchpercent":  c.batchPercent,
+		"pause":         c.pause,
+		"healthtimeout": c.healthTimeout,
+		"probeport":     c.probePort,
+	}
+	for key, value := range intValues {
+		if value != 0 {
+			val.Set(key, strconv.Itoa(value))
+		}
+	}
+	if c.probePath != "" {
+		val.Set("probepath", c.probePath)
+	}
+	request, err := http.NewRequest("POST", u, strings.NewReader(val.Encode()))
 	if err != nil {
 		return err
 	}
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
 	rsp, err := client.Do(request)
 	if err != nil {
 		return err
@@ -403,3 +520,19 @@ func (c *NodeContainerUpgrade) Run(context *cmd.Context, client *cmd.Client) err
 	defer rsp.Body.Close()
 	return cmd.StreamJSONResponse(context.Stdout, rsp)
 }
+
+func (c *NodeContainerUpgrade) Flags() *gnuflag.FlagSet {
+	if c.fs == nil {
+		c.fs = c.ConfirmationCommand.Flags()
+		msg := "Pool to upgrade node containers. If empty node containers in all pools will be upgraded."
+		c.fs.StringVar(&c.pool, "p", "", msg)
+		c.fs.StringVar(&c.pool, "pool", "", msg)
+		c.fs.IntVar(&c.batchSize, "batch-size", 0, "Number of nodes upgraded in each batch.")
+		c.fs.IntVar(&c.batchPercent, "batch-percent", 0, "Percentage of the nodes upgraded in each batch.")
+		c.fs.IntVar(&c.pause, "pause", 0, "Seconds to wait between batches.")
+		c.fs.IntVar(&c.healthTimeout, "health-timeout", 0, "Seconds to wait for the node container to be healthy in each node. Defaults to 60.")
+		c.fs.IntVar(&c.probePort, "probe-port", 0, "Port in the node host for an HTTP health probe.")
+		c.fs.StringVar(&c.probePath, "probe-path", "", "Path for the HTTP health probe.")
+	}
+	return c.fs
+}
@@ -184,3 +184,29 @@ func (s *S) TestNodeContainerUpgradeRun(c *check.C) {
 	c.Assert(err, check.IsNil)
 	c.Assert(buf.String(), check.Equals, "")
 }
+
+func (s *S) TestNodeContainerUpgradeRunWithRolloutOptions(c *check.C) {
+	var buf bytes.Buffer
+	context := cmd.Context{Args: []string{"n1"}, Stdout: &buf}
+	trans := &cmdtest.ConditionalTransport{
+		Transport: cmdtest.Transport{Message: "", Status: http.StatusOK},
+		CondFunc: func(req *http.Request) bool {
+			req.ParseForm()
+			return req.URL.Path == "/1.0/docker/nodecontainers/n1/upgrade" && req.Method == "POST" &&
+				req.Header.Get("Content-Type") == "application/x-www-form-urlencoded" &&
+				req.FormValue("pool") == "p1" &&
+				req.FormValue("batchsize") == "2" &&
+				req.FormValue("batchpercent") == "" &&
+				req.FormValue("pause") == "30" &&
+				req.FormValue("probeport") == "8080" &&
+				req.FormValue("probepath") == "/healthcheck"
+		},
+	}
+	manager := cmd.Manager{}
+	client := cmd.NewClient(&http.Client{Transport: trans}, nil, &manager)
+	command := NodeContainerUpgrade{}
+	command.Flags().Parse(true, []string{"-y", "-p", "p1", "--batch-size", "2", "--pause", "30", "--probe-port", "8080", "--probe-path", "/healthcheck"})
+	err := command.Run(&context, client)
+	c.Assert(err, check.IsNil)
+	c.Assert(buf.String(), check.Equals, "")
+}
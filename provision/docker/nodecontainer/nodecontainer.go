@@ -241,24 +241,11 @@ func ensureContainersStarted(p DockerProvisioner, w io.Writer, relaunch bool, na
 	errChan := make(chan error, len(nodes))
 	wg := sync.WaitGroup{}
 	log.Debugf("[node containers] recreating %d containers", len(nodes))
-	recreateContainer := func(node *cluster.Node, confName string) {
+	recreate := func(node *cluster.Node, confName string) {
 		defer wg.Done()
-		pool := node.Metadata["pool"]
-		containerConfig, confErr := LoadNodeContainer(pool, confName)
+		_, confErr := recreateContainer(p, w, node, confName, relaunch)
 		if confErr != nil {
 			errChan <- confErr
-			return
-		}
-		if !containerConfig.valid() {
-			return
-		}
-		log.Debugf("[node containers] recreating container %q in %s [%s]", confName, node.Address, pool)
-		fmt.Fprintf(w, "relaunching node container %q in the node %s [%s]\n", confName, node.Address, pool)
-		confErr = containerConfig.create(node, pool, p, relaunch)
-		if confErr != nil {
-			msg := fmt.Sprintf("[node containers] failed to create container in %s [%s]: %s", node.Address, pool, confErr)
-			log.Error(msg)
-			errChan <- errors.New(msg)
 		}
 	}
 	for i := range nodes {
@@ -267,7 +254,7 @@ func ensureContainersStarted(p DockerProvisioner, w io.Writer, relaunch bool, na
 			defer wg.Done()
 			for j := range names {
 				wg.Add(1)
-				go recreateContainer(node, names[j])
+				go recreate(node, names[j])
 			}
 		}(&nodes[i])
 	}
@@ -283,6 +270,29 @@ func ensureContainersStarted(p DockerProvisioner, w io.Writer, relaunch bool, na
 	return fmt.Errorf("multiple errors: %s", strings.Join(allErrors, ", "))
 }
 
+// recreateContainer creates the node container with the given name in the
+// node, returning whether a container was created. Nothing is done if the
+// node container config for the node pool has no image.
+func recreateContainer(p DockerProvisioner, w io.Writer, node *cluster.Node, confName string, relaunch bool) (bool, error) {
+	pool := node.Metadata["pool"]
+	containerConfig, err := LoadNodeContainer(pool, confName)
+	if err != nil {
+		return false, err
+	}
+	if !containerConfig.valid() {
+		return false, nil
+	}
+	log.Debugf("[node containers] recreating container %q in %s [%s]", confName, node.Address, pool)
+	fmt.Fprintf(w, "relaunching node container %q in the node %s [%s]\n", confName, node.Address, pool)
+	err = containerConfig.create(node, pool, p, relaunch)
+	if err != nil {
+		msg := fmt.Sprintf("[node containers] failed to create container in %s [%s]: %s", node.Address, pool, err)
+		log.Error(msg)
+		return false, errors.New(msg)
+	}
+	return true, nil
+}
+
 func (c *NodeContainerConfig) EnvMap() map[string]string {
 	envMap := map[string]string{}
 	for _, e := range c.Config.Env {
@@ -0,0 +1,255 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package nodecontainer
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fsouza/go-dockerclient"
+	"github.com/tsuru/docker-cluster/cluster"
+	"github.com/tsuru/tsuru/event"
+	"github.com/tsuru/tsuru/log"
+	"github.com/tsuru/tsuru/net"
+)
+
+const (
+	RolloutStatusSuccess = "success"
+	RolloutStatusFailed  = "failed"
+	// RolloutStatusSkipped is the status of nodes not reached by a rollout
+	// halted or canceled in a previous batch.
+	RolloutStatusSkipped = "skipped"
+	// RolloutStatusNotConfigured is the status of nodes in pools without a
+	// valid config for the node container, which are left untouched.
+	RolloutStatusNotConfigured = "not-configured"
+
+	defaultRolloutHealthTimeout = time.Minute
+)
+
+var (
+	ErrRolloutCanceled = errors.New("node container rollout canceled by user action")
+
+	rolloutHealthInterval = time.Second
+	rolloutProbeClient    = net.Dial5Full60ClientNoKeepAlive
+)
+
+// RolloutOptions controls how a node container is relaunched across the
+// nodes of the cluster. Nodes are handled in batches of BatchSize nodes, or
+// BatchPercent percent of the nodes, all nodes being handled at once when
+// neither is set.
+type RolloutOptions struct {
+	Pool         string
+	BatchSize    int
+	BatchPercent int
+	// Pause is the time to wait after a batch before starting the next one.
+	Pause time.Duration
+	// HealthTimeout is how long to wait for the container to be running, and
+	// for the probe to succeed, in each node.
+	HealthTimeout time.Duration
+	// ProbePort and ProbePath, when ProbePort is set, define an HTTP probe
+	// sent to the node host, which must respond with a 2xx status code.
+	ProbePort int
+	ProbePath string
+	// Event, when set, is checked for cancellation between batches.
+	Event *event.Event `json:"-" bson:"-"`
+}
+
+// RolloutNodeResult is the outcome of a rollout in a single node.
+type RolloutNodeResult struct {
+	Address string
+	Pool    string
+	Batch   int
+	Status  string
+	Error   string `json:",omitempty"`
+}
+
+func (o *RolloutOptions) Validate() error {
+	if o.BatchSize < 0 {
+		return ValidationErr{message: "batch size must not be negative"}
+	}
+	if o.BatchPercent < 0 || o.BatchPercent > 100 {
+		return ValidationErr{message: "batch percent must be between 0 and 100"}
+	}
+	if o.BatchSize > 0 && o.BatchPercent > 0 {
+		return ValidationErr{message: "batch size and batch percent are mutually exclusive"}
+	}
+	if o.Pause < 0 || o.HealthTimeout < 0 {
+		return ValidationErr{message: "pause and health timeout must not be negative"}
+	}
+	if o.ProbePort < 0 || o.ProbePort > 65535 {
+		return ValidationErr{message: "invalid probe port"}
+	}
+	return nil
+}
+
+func (o *RolloutOptions) batchSize(total int) int {
+	size := o.BatchSize
+	if o.BatchPercent > 0 {
+		size = (total*o.BatchPercent + 99) / 100
+	}
+	if size <= 0 || size > total {
+		size = total
+	}
+	return size
+}
+
+// RolloutNamedContainer relaunches the node container with the given name in
+// the nodes of the cluster, or in the nodes of the given pool, according to
+// the rollout options. Each node must pass the health gate for the rollout to
+// continue, the rollout is halted after a batch with any failure, the
+// remaining nodes being reported as skipped.
+func RolloutNamedContainer(p DockerProvisioner, w io.Writer, name string, opts RolloutOptions) ([]RolloutNodeResult, error) {
+	if w == nil {
+		w = ioutil.Discard
+	}
+	err := opts.Validate()
+	if err != nil {
+		return nil, err
+	}
+	nodes, err := p.Cluster().UnfilteredNodes()
+	if err != nil {
+		return nil, err
+	}
+	if opts.Pool != "" {
+		var poolNodes []cluster.Node
+		for _, n := range nodes {
+			if n.Metadata["pool"] == opts.Pool {
+				poolNodes = append(poolNodes, n)
+			}
+		}
+		nodes = poolNodes
+	}
+	results := make([]RolloutNodeResult, len(nodes))
+	for i, n := range nodes {
+		results[i] = RolloutNodeResult{Address: n.Address, Pool: n.Metadata["pool"], Status: RolloutStatusSkipped}
+	}
+	if len(nodes) == 0 {
+		return results, nil
+	}
+	size := opts.batchSize(len(nodes))
+	batches := (len(nodes) + size - 1) / size
+	for batch := 0; batch < batches; batch++ {
+		if batch > 0 {
+			if opts.Pause > 0 {
+				fmt.Fprintf(w, "waiting %s before the next batch\n", opts.Pause)
+				time.Sleep(opts.Pause)
+			}
+			if rolloutCanceled(opts.Event) {
+				fmt.Fprintf(w, "rollout of node container %q canceled\n", name)
+				return results, ErrRolloutCanceled
+			}
+		}
+		start := batch * size
+		end := start + size
+		if end > len(nodes) {
+			end = len(nodes)
+		}
+		fmt.Fprintf(w, "starting batch %d of %d with %d nodes\n", batch+1, batches, end-start)
+		wg := sync.WaitGroup{}
+		for i := start; i < end; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				results[i].Batch = batch + 1
+				status, nodeErr := rolloutNode(p, w, &nodes[i], name, &opts)
+				if nodeErr != nil {
+					results[i].Status = RolloutStatusFailed
+					results[i].Error = nodeErr.Error()
+					return
+				}
+				results[i].Status = status
+			}(i)
+		}
+		wg.Wait()
+		var failed int
+		for i := start; i < end; i++ {
+			if results[i].Status == RolloutStatusFailed {
+				failed++
+			}
+		}
+		if failed > 0 {
+			fmt.Fprintf(w, "rollout of node container %q halted, %d nodes failed in batch %d\n", name, failed, batch+1)
+			return results, fmt.Errorf("rollout halted, %d nodes failed in batch %d", failed, batch+1)
+		}
+	}
+	return results, nil
+}
+
+func rolloutCanceled(evt *event.Event) bool {
+	if evt == nil {
+		return false
+	}
+	canceled, err := evt.AckCancel()
+	if err != nil {
+		log.Errorf("[node containers] unable to check if rollout should be canceled, ignoring: %s", err)
+		return false
+	}
+	return canceled
+}
+
+func rolloutNode(p DockerProvisioner, w io.Writer, node *cluster.Node, name string, opts *RolloutOptions) (string, error) {
+	created, err := recreateContainer(p, w, node, name, true)
+	if err != nil {
+		return "", err
+	}
+	if !created {
+		fmt.Fprintf(w, "node container %q is not configured for the node %s, skipping\n", name, node.Address)
+		return RolloutStatusNotConfigured, nil
+	}
+	timeout := opts.HealthTimeout
+	if timeout == 0 {
+		timeout = defaultRolloutHealthTimeout
+	}
+	err = waitHealthy(node, name, opts, time.Now().Add(timeout))
+	if err != nil {
+		fmt.Fprintf(w, "node container %q in the node %s failed the health check: %s\n", name, node.Address, err)
+		return "", err
+	}
+	fmt.Fprintf(w, "node container %q in the node %s is healthy\n", name, node.Address)
+	return RolloutStatusSuccess, nil
+}
+
+func waitHealthy(node *cluster.Node, name string, opts *RolloutOptions, deadline time.Time) error {
+	client, err := node.Client()
+	if err != nil {
+		return err
+	}
+	for {
+		err = checkHealth(client, node, name, opts)
+		if err == nil || time.Now().After(deadline) {
+			return err
+		}
+		time.Sleep(rolloutHealthInterval)
+	}
+}
+
+func checkHealth(client *docker.Client, node *cluster.Node, name string, opts *RolloutOptions) error {
+	cont, err := client.InspectContainer(name)
+	if err != nil {
+		return err
+	}
+	if !cont.State.Running {
+		return fmt.Errorf("container is not running: %s", cont.State.String())
+	}
+	if opts.ProbePort == 0 {
+		return nil
+	}
+	url := fmt.Sprintf("http://%s:%d/%s", net.URLToHost(node.Address), opts.ProbePort, strings.TrimPrefix(opts.ProbePath, "/"))
+	rsp, err := rolloutProbeClient.Get(url)
+	if err != nil {
+		return err
+	}
+	defer rsp.Body.Close()
+	if rsp.StatusCode < http.StatusOK || rsp.StatusCode >= http.StatusMultipleChoices {
+		return fmt.Errorf("probe %s returned status %d", url, rsp.StatusCode)
+	}
+	return nil
+}
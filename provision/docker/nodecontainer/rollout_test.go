@@ -0,0 +1,192 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package nodecontainer
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/fsouza/go-dockerclient"
+	"github.com/tsuru/tsuru/provision/docker/dockertest"
+	"github.com/tsuru/tsuru/safe"
+	"gopkg.in/check.v1"
+)
+
+func (s *S) addRolloutContainer(c *check.C) {
+	err := AddNewContainer("", &NodeContainerConfig{
+		Name:   "bs",
+		Config: docker.Config{Image: "bsimg"},
+	})
+	c.Assert(err, check.IsNil)
+}
+
+func (s *S) TestRolloutOptionsBatchSize(c *check.C) {
+	var tests = []struct {
+		opts     RolloutOptions
+		total    int
+		expected int
+	}{
+		{RolloutOptions{}, 5, 5},
+		{RolloutOptions{BatchSize: 2}, 5, 2},
+		{RolloutOptions{BatchSize: 10}, 5, 5},
+		{RolloutOptions{BatchPercent: 50}, 5, 3},
+		{RolloutOptions{BatchPercent: 10}, 5, 1},
+		{RolloutOptions{BatchPercent: 100}, 5, 5},
+	}
+	for _, t := range tests {
+		c.Check(t.opts.batchSize(t.total), check.Equals, t.expected)
+	}
+}
+
+func (s *S) TestRolloutOptionsValidate(c *check.C) {
+	var tests = []struct {
+		opts RolloutOptions
+		err  string
+	}{
+		{RolloutOptions{BatchSize: 2, Pause: time.Second, ProbePort: 80}, ""},
+		{RolloutOptions{BatchSize: -1}, "batch size must not be negative"},
+		{RolloutOptions{BatchPercent: 101}, "batch percent must be between 0 and 100"},
+		{RolloutOptions{BatchSize: 1, BatchPercent: 10}, "batch size and batch percent are mutually exclusive"},
+		{RolloutOptions{Pause: -time.Second}, "pause and health timeout must not be negative"},
+		{RolloutOptions{ProbePort: 70000}, "invalid probe port"},
+	}
+	for _, t := range tests {
+		err := t.opts.Validate()
+		if t.err == "" {
+			c.Check(err, check.IsNil)
+		} else {
+			c.Check(err, check.ErrorMatches, t.err)
+		}
+	}
+}
+
+func (s *S) TestRolloutNamedContainerInBatches(c *check.C) {
+	s.addRolloutContainer(c)
+	p, err := dockertest.StartMultipleServersCluster()
+	c.Assert(err, check.IsNil)
+	defer p.Destroy()
+	buf := safe.NewBuffer(nil)
+	results, err := RolloutNamedContainer(p, buf, "bs", RolloutOptions{BatchSize: 1})
+	c.Assert(err, check.IsNil)
+	c.Assert(results, check.HasLen, 2)
+	for i, r := range results {
+		c.Assert(r.Status, check.Equals, RolloutStatusSuccess)
+		c.Assert(r.Batch, check.Equals, i+1)
+		c.Assert(r.Error, check.Equals, "")
+	}
+	c.Assert(buf.String(), check.Matches, `(?s)starting batch 1 of 2 with 1 nodes.*starting batch 2 of 2 with 1 nodes.*`)
+	c.Assert(buf.String(), check.Matches, `(?s).*node container "bs" in the node .* is healthy.*`)
+	for _, server := range p.Servers() {
+		client, err := docker.NewClient(server.URL())
+		c.Assert(err, check.IsNil)
+		cont, err := client.InspectContainer("bs")
+		c.Assert(err, check.IsNil)
+		c.Assert(cont.State.Running, check.Equals, true)
+	}
+}
+
+func (s *S) TestRolloutNamedContainerWithProbe(c *check.C) {
+	s.addRolloutContainer(c)
+	var paths []string
+	probeServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path)
+	}))
+	defer probeServer.Close()
+	p, err := dockertest.StartMultipleServersCluster()
+	c.Assert(err, check.IsNil)
+	defer p.Destroy()
+	results, err := RolloutNamedContainer(p, nil, "bs", RolloutOptions{
+		BatchSize: 1,
+		ProbePort: probePort(c, probeServer.URL),
+		ProbePath: "/healthcheck",
+	})
+	c.Assert(err, check.IsNil)
+	c.Assert(results, check.HasLen, 2)
+	c.Assert(paths, check.DeepEquals, []string{"/healthcheck", "/healthcheck"})
+}
+
+func (s *S) TestRolloutNamedContainerHaltsOnFailure(c *check.C) {
+	s.addRolloutContainer(c)
+	probeServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer probeServer.Close()
+	p, err := dockertest.StartMultipleServersCluster()
+	c.Assert(err, check.IsNil)
+	defer p.Destroy()
+	buf := safe.NewBuffer(nil)
+	results, err := RolloutNamedContainer(p, buf, "bs", RolloutOptions{
+		BatchSize:     1,
+		HealthTimeout: time.Nanosecond,
+		ProbePort:     probePort(c, probeServer.URL),
+	})
+	c.Assert(err, check.ErrorMatches, `rollout halted, 1 nodes failed in batch 1`)
+	c.Assert(results, check.HasLen, 2)
+	c.Assert(results[0].Status, check.Equals, RolloutStatusFailed)
+	c.Assert(results[0].Batch, check.Equals, 1)
+	c.Assert(results[0].Error, check.Matches, `probe http://.* returned status 500`)
+	c.Assert(results[1].Status, check.Equals, RolloutStatusSkipped)
+	c.Assert(results[1].Batch, check.Equals, 0)
+	c.Assert(strings.Contains(buf.String(), "starting batch 2"), check.Equals, false)
+}
+
+func (s *S) TestRolloutNamedContainerFilterByPool(c *check.C) {
+	s.addRolloutContainer(c)
+	p, err := dockertest.StartMultipleServersCluster()
+	c.Assert(err, check.IsNil)
+	defer p.Destroy()
+	nodes, err := p.Cluster().UnfilteredNodes()
+	c.Assert(err, check.IsNil)
+	nodes[0].Metadata = map[string]string{"pool": "p1"}
+	_, err = p.Cluster().UpdateNode(nodes[0])
+	c.Assert(err, check.IsNil)
+	results, err := RolloutNamedContainer(p, nil, "bs", RolloutOptions{Pool: "p1"})
+	c.Assert(err, check.IsNil)
+	c.Assert(results, check.DeepEquals, []RolloutNodeResult{
+		{Address: nodes[0].Address, Pool: "p1", Batch: 1, Status: RolloutStatusSuccess},
+	})
+}
+
+func (s *S) TestRolloutNamedContainerNotConfigured(c *check.C) {
+	err := AddNewContainer("p1", &NodeContainerConfig{
+		Name:   "bs",
+		Config: docker.Config{Image: "bsimg"},
+	})
+	c.Assert(err, check.IsNil)
+	p, err := dockertest.StartMultipleServersCluster()
+	c.Assert(err, check.IsNil)
+	defer p.Destroy()
+	nodes, err := p.Cluster().UnfilteredNodes()
+	c.Assert(err, check.IsNil)
+	nodes[0].Metadata = map[string]string{"pool": "p1"}
+	_, err = p.Cluster().UpdateNode(nodes[0])
+	c.Assert(err, check.IsNil)
+	nodes[1].Metadata = map[string]string{"pool": "p2"}
+	_, err = p.Cluster().UpdateNode(nodes[1])
+	c.Assert(err, check.IsNil)
+	buf := safe.NewBuffer(nil)
+	results, err := RolloutNamedContainer(p, buf, "bs", RolloutOptions{BatchSize: 1})
+	c.Assert(err, check.IsNil)
+	c.Assert(results, check.DeepEquals, []RolloutNodeResult{
+		{Address: nodes[0].Address, Pool: "p1", Batch: 1, Status: RolloutStatusSuccess},
+		{Address: nodes[1].Address, Pool: "p2", Batch: 2, Status: RolloutStatusNotConfigured},
+	})
+	c.Assert(buf.String(), check.Matches, `(?s).*node container "bs" is not configured for the node .*, skipping.*`)
+}
+
+func probePort(c *check.C, serverURL string) int {
+	u, err := url.Parse(serverURL)
+	c.Assert(err, check.IsNil)
+	_, port, err := net.SplitHostPort(u.Host)
+	c.Assert(err, check.IsNil)
+	parsed, err := strconv.Atoi(port)
+	c.Assert(err, check.IsNil)
+	return parsed
+}
@@ -0,0 +1,133 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package nodecontainer
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/fsouza/go-dockerclient"
+	"github.com/tsuru/docker-cluster/cluster"
+)
+
+// ContainerStatus describes the node container running in a node,
+// comparing its image with the image configured for the node pool.
+type ContainerStatus struct {
+	Name            string
+	Address         string
+	Pool            string
+	ContainerID     string
+	Running         bool
+	Missing         bool
+	State           string
+	Image           string
+	ImageDigest     string
+	ConfiguredImage string
+	UpToDate        bool
+	RestartCount    int
+	Error           string
+}
+
+// ContainerStatuses returns the status of the node container with the
+// given name in each node of the cluster, or in the given nodes. Nodes whose
+// pool has no image configured for the node container are ignored.
+func ContainerStatuses(p DockerProvisioner, name string, nodes ...cluster.Node) ([]ContainerStatus, error) {
+	var err error
+	if len(nodes) == 0 {
+		nodes, err = p.Cluster().UnfilteredNodes()
+		if err != nil {
+			return nil, err
+		}
+	}
+	statuses := make([]*ContainerStatus, len(nodes))
+	errs := make([]error, len(nodes))
+	wg := sync.WaitGroup{}
+	for i := range nodes {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			statuses[i], errs[i] = nodeContainerStatus(&nodes[i], name)
+		}(i)
+	}
+	wg.Wait()
+	result := make([]ContainerStatus, 0, len(nodes))
+	for i := range nodes {
+		if errs[i] != nil {
+			return nil, errs[i]
+		}
+		if statuses[i] != nil {
+			result = append(result, *statuses[i])
+		}
+	}
+	return result, nil
+}
+
+func nodeContainerStatus(node *cluster.Node, name string) (*ContainerStatus, error) {
+	pool := node.Metadata["pool"]
+	config, err := LoadNodeContainer(pool, name)
+	if err != nil {
+		return nil, err
+	}
+	if !config.valid() {
+		return nil, nil
+	}
+	status := ContainerStatus{
+		Name:            name,
+		Address:         node.Address,
+		Pool:            pool,
+		ConfiguredImage: config.image(),
+	}
+	client, err := node.Client()
+	if err != nil {
+		status.Error = err.Error()
+		return &status, nil
+	}
+	cont, err := client.InspectContainer(name)
+	if err != nil {
+		if _, ok := err.(*docker.NoSuchContainer); ok {
+			status.Missing = true
+			status.Error = "container not found"
+		} else {
+			status.Error = err.Error()
+		}
+		return &status, nil
+	}
+	status.ContainerID = cont.ID
+	status.Running = cont.State.Running
+	status.State = cont.State.String()
+	status.Image = cont.Config.Image
+	status.RestartCount = cont.RestartCount
+	status.Error = cont.State.Error
+	var digests []string
+	img, err := client.InspectImage(cont.Image)
+	if err == nil {
+		digests = img.RepoDigests
+	}
+	if len(digests) > 0 {
+		status.ImageDigest = digests[0]
+	}
+	status.UpToDate = imageMatches(status.ConfiguredImage, cont.Config.Image, digests)
+	return &status, nil
+}
+
+// imageMatches returns whether a container created from the given image,
+// with the given repository digests, runs the configured image. Images
+// pinned to a digest are compared by digest, other images are compared by
+// name.
+func imageMatches(configured, image string, digests []string) bool {
+	if configured == image {
+		return true
+	}
+	if !strings.Contains(configured, "@") {
+		return false
+	}
+	configuredDigest := configured[strings.Index(configured, "@")+1:]
+	for _, d := range digests {
+		if strings.HasSuffix(d, "@"+configuredDigest) {
+			return true
+		}
+	}
+	return false
+}
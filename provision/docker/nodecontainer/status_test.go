@@ -0,0 +1,79 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package nodecontainer
+
+import (
+	"github.com/fsouza/go-dockerclient"
+	"github.com/tsuru/tsuru/provision/docker/dockertest"
+	"gopkg.in/check.v1"
+)
+
+func (s *S) TestContainerStatuses(c *check.C) {
+	err := AddNewContainer("", &NodeContainerConfig{
+		Name:   "bs",
+		Config: docker.Config{Image: "bsimg"},
+	})
+	c.Assert(err, check.IsNil)
+	p, err := dockertest.StartMultipleServersCluster()
+	c.Assert(err, check.IsNil)
+	defer p.Destroy()
+	nodes, err := p.Cluster().UnfilteredNodes()
+	c.Assert(err, check.IsNil)
+	err = RecreateNamedContainers(p, nil, "bs", nodes[0])
+	c.Assert(err, check.IsNil)
+	client, err := nodes[0].Client()
+	c.Assert(err, check.IsNil)
+	cont, err := client.InspectContainer("bs")
+	c.Assert(err, check.IsNil)
+	statuses, err := ContainerStatuses(p, "bs")
+	c.Assert(err, check.IsNil)
+	c.Assert(statuses, check.HasLen, 2)
+	for _, st := range statuses {
+		if st.Address != nodes[0].Address {
+			c.Assert(st, check.DeepEquals, ContainerStatus{
+				Name:            "bs",
+				Address:         st.Address,
+				ConfiguredImage: "bsimg",
+				Missing:         true,
+				Error:           "container not found",
+			})
+			continue
+		}
+		c.Assert(st.ContainerID, check.Equals, cont.ID)
+		c.Assert(st.Running, check.Equals, true)
+		c.Assert(st.Missing, check.Equals, false)
+		c.Assert(st.Image, check.Equals, "bsimg")
+		c.Assert(st.UpToDate, check.Equals, true)
+		c.Assert(st.Error, check.Equals, "")
+	}
+	err = UpdateContainer("", &NodeContainerConfig{
+		Name:   "bs",
+		Config: docker.Config{Image: "bsimg:v2"},
+	})
+	c.Assert(err, check.IsNil)
+	statuses, err = ContainerStatuses(p, "bs", nodes[0])
+	c.Assert(err, check.IsNil)
+	c.Assert(statuses, check.HasLen, 1)
+	c.Assert(statuses[0].ConfiguredImage, check.Equals, "bsimg:v2")
+	c.Assert(statuses[0].UpToDate, check.Equals, false)
+}
+
+func (s *S) TestImageMatches(c *check.C) {
+	var tests = []struct {
+		configured string
+		image      string
+		digests    []string
+		expected   bool
+	}{
+		{"tsuru/bs", "tsuru/bs", nil, true},
+		{"tsuru/bs:v2", "tsuru/bs", nil, false},
+		{"tsuru/bs@sha256:abc", "tsuru/bs", []string{"tsuru/bs@sha256:abc"}, true},
+		{"tsuru/bs@sha256:abc", "tsuru/bs", []string{"tsuru/bs@sha256:def"}, false},
+		{"tsuru/bs@sha256:abc", "tsuru/bs", nil, false},
+	}
+	for _, t := range tests {
+		c.Check(imageMatches(t.configured, t.image, t.digests), check.Equals, t.expected)
+	}
+}
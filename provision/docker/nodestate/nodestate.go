@@ -0,0 +1,41 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package nodestate handles the maintenance state of docker nodes. Nodes in
+// maintenance are kept in the cluster, running their containers, but are not
+// considered by the scheduler, the node healer or the node auto scaler.
+package nodestate
+
+import "github.com/tsuru/docker-cluster/cluster"
+
+// MetadataKey is the node metadata key holding the maintenance state.
+const MetadataKey = "MaintenanceState"
+
+const (
+	// Cordoned nodes don't receive new containers.
+	Cordoned = "cordoned"
+	// Draining nodes don't receive new containers and are having their
+	// containers moved to other nodes.
+	Draining = "draining"
+)
+
+// Get returns the maintenance state of the node, or an empty string if the
+// node is not under maintenance.
+func Get(node *cluster.Node) string {
+	if node.Metadata == nil {
+		return ""
+	}
+	return node.Metadata[MetadataKey]
+}
+
+// Schedulable filters out the nodes under maintenance.
+func Schedulable(nodes []cluster.Node) []cluster.Node {
+	result := make([]cluster.Node, 0, len(nodes))
+	for i := range nodes {
+		if Get(&nodes[i]) == "" {
+			result = append(result, nodes[i])
+		}
+	}
+	return result
+}
@@ -0,0 +1,37 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package nodestate
+
+import (
+	"testing"
+
+	"github.com/tsuru/docker-cluster/cluster"
+	"gopkg.in/check.v1"
+)
+
+type S struct{}
+
+var _ = check.Suite(&S{})
+
+func Test(t *testing.T) { check.TestingT(t) }
+
+func (s *S) TestGet(c *check.C) {
+	c.Assert(Get(&cluster.Node{}), check.Equals, "")
+	c.Assert(Get(&cluster.Node{Metadata: map[string]string{"pool": "p1"}}), check.Equals, "")
+	c.Assert(Get(&cluster.Node{Metadata: map[string]string{MetadataKey: Cordoned}}), check.Equals, Cordoned)
+}
+
+func (s *S) TestSchedulable(c *check.C) {
+	nodes := []cluster.Node{
+		{Address: "http://n1:2375"},
+		{Address: "http://n2:2375", Metadata: map[string]string{MetadataKey: Cordoned}},
+		{Address: "http://n3:2375", Metadata: map[string]string{"pool": "p1"}},
+		{Address: "http://n4:2375", Metadata: map[string]string{MetadataKey: Draining}},
+	}
+	result := Schedulable(nodes)
+	c.Assert(result, check.HasLen, 2)
+	c.Assert(result[0].Address, check.Equals, "http://n1:2375")
+	c.Assert(result[1].Address, check.Equals, "http://n3:2375")
+}
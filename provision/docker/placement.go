@@ -0,0 +1,129 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package docker
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/tsuru/docker-cluster/cluster"
+	"github.com/tsuru/tsuru/net"
+	"github.com/tsuru/tsuru/provision"
+)
+
+// placementRules returns the placement rules declared in the tsuru.yaml of
+// the given image for a process.
+func placementRules(imageName, process string) (provision.TsuruYamlPlacementRules, error) {
+	if imageName == "" {
+		return provision.TsuruYamlPlacementRules{}, nil
+	}
+	yamlData, err := getImageTsuruYamlData(imageName)
+	if err != nil {
+		return provision.TsuruYamlPlacementRules{}, err
+	}
+	return yamlData.Placement.ForProcess(process), nil
+}
+
+// filterByPlacement removes the nodes not matching the node selector and the
+// nodes running units of apps listed as anti-affinity.
+func (s *segregatedScheduler) filterByPlacement(nodes []cluster.Node, appName string, rules provision.TsuruYamlPlacementRules) ([]cluster.Node, error) {
+	if len(rules.NodeSelector) == 0 && len(rules.AntiAffinity) == 0 {
+		return nodes, nil
+	}
+	var forbiddenHosts map[string]bool
+	if len(rules.AntiAffinity) > 0 {
+		hosts, _ := s.nodesToHosts(nodes)
+		containers, err := s.provisioner.listContainersByAppAndHost(rules.AntiAffinity, hosts)
+		if err != nil {
+			return nil, err
+		}
+		forbiddenHosts = make(map[string]bool, len(containers))
+		for _, c := range containers {
+			forbiddenHosts[c.HostAddr] = true
+		}
+	}
+	result := make([]cluster.Node, 0, len(nodes))
+	for _, node := range nodes {
+		if !matchesNodeSelector(&node, rules.NodeSelector) {
+			continue
+		}
+		if forbiddenHosts[net.URLToHost(node.Address)] {
+			continue
+		}
+		result = append(result, node)
+	}
+	if len(result) == 0 {
+		return nil, fmt.Errorf("no nodes matching placement constraints for %q: %s", appName, describePlacement(rules))
+	}
+	return result, nil
+}
+
+func matchesNodeSelector(node *cluster.Node, selector map[string]string) bool {
+	for key, value := range selector {
+		if node.Metadata[key] != value {
+			return false
+		}
+	}
+	return true
+}
+
+func describePlacement(rules provision.TsuruYamlPlacementRules) string {
+	var parts []string
+	for key, value := range rules.NodeSelector {
+		parts = append(parts, fmt.Sprintf("%s=%s", key, value))
+	}
+	sort.Strings(parts)
+	if len(rules.AntiAffinity) > 0 {
+		parts = append(parts, fmt.Sprintf("anti-affinity with %s", strings.Join(rules.AntiAffinity, ", ")))
+	}
+	if rules.Spread != "" {
+		parts = append(parts, fmt.Sprintf("spread across %s", rules.Spread))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// filterBySpread groups nodes by the value of the spread metadata key and
+// keeps only the nodes in the groups with the least (or the most, when
+// choosing a unit to remove) units of the app process. Nodes without the
+// metadata key are never used when a spread key is set.
+func (s *segregatedScheduler) filterBySpread(nodes []cluster.Node, spreadKey, appName, process string, most bool) ([]cluster.Node, error) {
+	if spreadKey == "" {
+		return nodes, nil
+	}
+	withKey := make([]cluster.Node, 0, len(nodes))
+	for _, node := range nodes {
+		if node.Metadata[spreadKey] != "" {
+			withKey = append(withKey, node)
+		}
+	}
+	if len(withKey) == 0 {
+		return nil, fmt.Errorf("no nodes with metadata %q to spread units of %q", spreadKey, appName)
+	}
+	hosts, _ := s.nodesToHosts(withKey)
+	appCountMap, err := s.aggregateContainersByHostAppProcess(hosts, appName, process)
+	if err != nil {
+		return nil, err
+	}
+	groupCount := map[string]int{}
+	for _, node := range withKey {
+		groupCount[node.Metadata[spreadKey]] += appCountMap[net.URLToHost(node.Address)]
+	}
+	var chosenCount int
+	first := true
+	for _, count := range groupCount {
+		if first || (most && count > chosenCount) || (!most && count < chosenCount) {
+			chosenCount = count
+			first = false
+		}
+	}
+	result := make([]cluster.Node, 0, len(withKey))
+	for _, node := range withKey {
+		if groupCount[node.Metadata[spreadKey]] == chosenCount {
+			result = append(result, node)
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,175 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package docker
+
+import (
+	"github.com/fsouza/go-dockerclient"
+	"github.com/tsuru/docker-cluster/cluster"
+	"github.com/tsuru/tsuru/app"
+	"github.com/tsuru/tsuru/provision"
+	"github.com/tsuru/tsuru/provision/docker/container"
+	"gopkg.in/check.v1"
+	"gopkg.in/mgo.v2/bson"
+)
+
+func (s *S) TestPlacementRules(c *check.C) {
+	err := saveImageCustomData("tsuru/app-myapp:v1", map[string]interface{}{
+		"placement": map[string]interface{}{
+			"node_selector": map[string]interface{}{"disk": "ssd"},
+			"spread":        "zone",
+			"processes": map[string]interface{}{
+				"worker": map[string]interface{}{
+					"anti_affinity": []interface{}{"otherapp"},
+				},
+			},
+		},
+	})
+	c.Assert(err, check.IsNil)
+	rules, err := placementRules("tsuru/app-myapp:v1", "web")
+	c.Assert(err, check.IsNil)
+	c.Assert(rules, check.DeepEquals, provision.TsuruYamlPlacementRules{
+		NodeSelector: map[string]string{"disk": "ssd"},
+		Spread:       "zone",
+	})
+	rules, err = placementRules("tsuru/app-myapp:v1", "worker")
+	c.Assert(err, check.IsNil)
+	c.Assert(rules, check.DeepEquals, provision.TsuruYamlPlacementRules{
+		NodeSelector: map[string]string{"disk": "ssd"},
+		AntiAffinity: []string{"otherapp"},
+		Spread:       "zone",
+	})
+	rules, err = placementRules("", "web")
+	c.Assert(err, check.IsNil)
+	c.Assert(rules, check.DeepEquals, provision.TsuruYamlPlacementRules{})
+}
+
+func (s *S) TestFilterByPlacementNodeSelector(c *check.C) {
+	scheduler := segregatedScheduler{provisioner: s.p}
+	nodes := []cluster.Node{
+		{Address: "http://server1:1234", Metadata: map[string]string{"disk": "ssd"}},
+		{Address: "http://server2:1234", Metadata: map[string]string{"disk": "hdd"}},
+		{Address: "http://server3:1234"},
+	}
+	result, err := scheduler.filterByPlacement(nodes, "myapp", provision.TsuruYamlPlacementRules{
+		NodeSelector: map[string]string{"disk": "ssd"},
+	})
+	c.Assert(err, check.IsNil)
+	c.Assert(result, check.DeepEquals, nodes[:1])
+	_, err = scheduler.filterByPlacement(nodes, "myapp", provision.TsuruYamlPlacementRules{
+		NodeSelector: map[string]string{"disk": "nvme"},
+	})
+	c.Assert(err, check.ErrorMatches, `no nodes matching placement constraints for "myapp": disk=nvme`)
+}
+
+func (s *S) TestFilterByPlacementAntiAffinity(c *check.C) {
+	coll := s.p.Collection()
+	defer coll.Close()
+	err := coll.Insert(
+		container.Container{ID: "c1", AppName: "noisy", HostAddr: "server1"},
+		container.Container{ID: "c2", AppName: "quiet", HostAddr: "server2"},
+	)
+	c.Assert(err, check.IsNil)
+	defer coll.RemoveAll(bson.M{"id": bson.M{"$in": []string{"c1", "c2"}}})
+	scheduler := segregatedScheduler{provisioner: s.p}
+	nodes := []cluster.Node{
+		{Address: "http://server1:1234"},
+		{Address: "http://server2:1234"},
+	}
+	result, err := scheduler.filterByPlacement(nodes, "myapp", provision.TsuruYamlPlacementRules{
+		AntiAffinity: []string{"noisy"},
+	})
+	c.Assert(err, check.IsNil)
+	c.Assert(result, check.DeepEquals, nodes[1:])
+	_, err = scheduler.filterByPlacement(nodes, "myapp", provision.TsuruYamlPlacementRules{
+		AntiAffinity: []string{"noisy", "quiet"},
+	})
+	c.Assert(err, check.ErrorMatches, `no nodes matching placement constraints for "myapp": anti-affinity with noisy, quiet`)
+}
+
+func (s *S) TestFilterBySpread(c *check.C) {
+	coll := s.p.Collection()
+	defer coll.Close()
+	err := coll.Insert(
+		container.Container{ID: "c1", AppName: "myapp", ProcessName: "web", HostAddr: "server1"},
+		container.Container{ID: "c2", AppName: "myapp", ProcessName: "web", HostAddr: "server2"},
+		container.Container{ID: "c3", AppName: "myapp", ProcessName: "web", HostAddr: "server3"},
+	)
+	c.Assert(err, check.IsNil)
+	defer coll.RemoveAll(bson.M{"appname": "myapp"})
+	scheduler := segregatedScheduler{provisioner: s.p}
+	nodes := []cluster.Node{
+		{Address: "http://server1:1234", Metadata: map[string]string{"zone": "a"}},
+		{Address: "http://server2:1234", Metadata: map[string]string{"zone": "a"}},
+		{Address: "http://server3:1234", Metadata: map[string]string{"zone": "b"}},
+		{Address: "http://server4:1234", Metadata: map[string]string{"zone": "b"}},
+		{Address: "http://server5:1234"},
+	}
+	result, err := scheduler.filterBySpread(nodes, "", "myapp", "web", false)
+	c.Assert(err, check.IsNil)
+	c.Assert(result, check.DeepEquals, nodes)
+	result, err = scheduler.filterBySpread(nodes, "zone", "myapp", "web", false)
+	c.Assert(err, check.IsNil)
+	c.Assert(result, check.DeepEquals, nodes[2:4])
+	result, err = scheduler.filterBySpread(nodes, "zone", "myapp", "web", true)
+	c.Assert(err, check.IsNil)
+	c.Assert(result, check.DeepEquals, nodes[:2])
+	_, err = scheduler.filterBySpread(nodes, "rack", "myapp", "web", false)
+	c.Assert(err, check.ErrorMatches, `no nodes with metadata "rack" to spread units of "myapp"`)
+}
+
+func (s *S) TestSchedulerScheduleWithPlacement(c *check.C) {
+	a1 := app.App{Name: "impius", Teams: []string{"tsuruteam"}, Pool: "pool1"}
+	err := s.storage.Apps().Insert(a1)
+	c.Assert(err, check.IsNil)
+	defer s.storage.Apps().Remove(bson.M{"name": a1.Name})
+	err = provision.AddPool(provision.AddPoolOptions{Name: "pool1"})
+	c.Assert(err, check.IsNil)
+	defer provision.RemovePool("pool1")
+	err = saveImageCustomData("tsuru/app-impius:v1", map[string]interface{}{
+		"placement": map[string]interface{}{
+			"node_selector": map[string]interface{}{"disk": "ssd"},
+			"spread":        "zone",
+		},
+	})
+	c.Assert(err, check.IsNil)
+	scheduler := segregatedScheduler{provisioner: s.p}
+	clusterInstance, err := cluster.New(&scheduler, &cluster.MapStorage{}, "")
+	c.Assert(err, check.IsNil)
+	s.p.cluster = clusterInstance
+	for _, n := range []cluster.Node{
+		{Address: "http://server1:1234", Metadata: map[string]string{"pool": "pool1", "zone": "a", "disk": "ssd"}},
+		{Address: "http://server2:1234", Metadata: map[string]string{"pool": "pool1", "zone": "b", "disk": "hdd"}},
+		{Address: "http://server3:1234", Metadata: map[string]string{"pool": "pool1", "zone": "b", "disk": "ssd"}},
+	} {
+		err = clusterInstance.Register(n)
+		c.Assert(err, check.IsNil)
+	}
+	coll := s.p.Collection()
+	defer coll.Close()
+	defer coll.RemoveAll(bson.M{"appname": a1.Name})
+	var addrs []string
+	for _, name := range []string{"cont1", "cont2", "cont3", "cont4"} {
+		err = coll.Insert(container.Container{Name: name, AppName: a1.Name, ProcessName: "web"})
+		c.Assert(err, check.IsNil)
+		opts := docker.CreateContainerOptions{Name: name, Config: &docker.Config{Image: "tsuru/app-impius:v1"}}
+		node, err := scheduler.Schedule(clusterInstance, opts, &container.SchedulerOpts{AppName: a1.Name, ProcessName: "web"})
+		c.Assert(err, check.IsNil)
+		addrs = append(addrs, node.Address)
+	}
+	c.Assert(addrs, check.HasLen, 4)
+	var zoneA, zoneB int
+	for _, addr := range addrs {
+		switch addr {
+		case "http://server1:1234":
+			zoneA++
+		case "http://server3:1234":
+			zoneB++
+		default:
+			c.Fatalf("unexpected node %q", addr)
+		}
+	}
+	c.Assert(zoneA, check.Equals, 2)
+	c.Assert(zoneB, check.Equals, 2)
+}
@@ -37,7 +37,9 @@ import (
 	"github.com/tsuru/tsuru/router"
 	_ "github.com/tsuru/tsuru/router/fusis"
 	_ "github.com/tsuru/tsuru/router/galeb"
+	_ "github.com/tsuru/tsuru/router/haproxy"
 	_ "github.com/tsuru/tsuru/router/hipache"
+	_ "github.com/tsuru/tsuru/router/nginx"
 	_ "github.com/tsuru/tsuru/router/routertest"
 	_ "github.com/tsuru/tsuru/router/vulcand"
 	"gopkg.in/mgo.v2/bson"
@@ -63,6 +65,37 @@ func getRouterForApp(app provision.App) (router.Router, error) {
 	return router.Get(routerName)
 }
 
+// getRoutersForApp returns all the routers of the app, starting with the
+// router returned by getRouterForApp.
+func getRoutersForApp(app provision.App) ([]router.Router, error) {
+	appRouters, err := app.GetRouters()
+	if err != nil {
+		return nil, err
+	}
+	routers := make([]router.Router, len(appRouters))
+	for i, appRouter := range appRouters {
+		routers[i], err = router.Get(appRouter.Name)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return routers, nil
+}
+
+func healthcheckRoutersForApp(app provision.App) ([]router.CustomHealthcheckRouter, error) {
+	routers, err := getRoutersForApp(app)
+	if err != nil {
+		return nil, err
+	}
+	var hcRouters []router.CustomHealthcheckRouter
+	for _, r := range routers {
+		if hcRouter, ok := r.(router.CustomHealthcheckRouter); ok {
+			hcRouters = append(hcRouters, hcRouter)
+		}
+	}
+	return hcRouters, nil
+}
+
 type dockerProvisioner struct {
 	cluster        *cluster.Cluster
 	collectionName string
@@ -132,9 +165,24 @@ func (p *dockerProvisioner) initDockerCluster() error {
 	}
 	healContainersSeconds, _ := config.GetInt("docker:healing:heal-containers-timeout")
 	if healContainersSeconds > 0 {
+		maxConsecutiveHeals, err := config.GetInt("docker:healing:heal-containers-max-consecutive")
+		if err != nil {
+			maxConsecutiveHeals = 5
+		}
+		backoffSeconds, err := config.GetInt("docker:healing:heal-containers-backoff")
+		if err != nil {
+			backoffSeconds = 60
+		}
+		maxBackoffSeconds, err := config.GetInt("docker:healing:heal-containers-max-backoff")
+		if err != nil {
+			maxBackoffSeconds = 30 * 60
+		}
 		contHealerInst := healer.NewContainerHealer(healer.ContainerHealerArgs{
 			Provisioner:         p,
 			MaxUnresponsiveTime: time.Duration(healContainersSeconds) * time.Second,
+			MaxConsecutiveHeals: maxConsecutiveHeals,
+			Backoff:             time.Duration(backoffSeconds) * time.Second,
+			MaxBackoff:          time.Duration(maxBackoffSeconds) * time.Second,
 			Done:                make(chan bool),
 			Locker:              &appLocker{},
 		})
@@ -150,6 +198,11 @@ func (p *dockerProvisioner) initDockerCluster() error {
 		shutdown.Register(autoScale)
 		go autoScale.run()
 	}
+	machineReconciler := p.initMachineReconciler()
+	if machineReconciler.Enabled {
+		shutdown.Register(machineReconciler)
+		go machineReconciler.run()
+	}
 	limitMode, _ := config.GetString("docker:limit:mode")
 	if limitMode == "global" {
 		p.actionLimiter = &provision.MongodbLimiter{}
@@ -286,17 +339,41 @@ func (p *dockerProvisioner) Initialize() error {
 	return p.initDockerCluster()
 }
 
-// Provision creates a route for the container
+// Provision creates a backend for the app in each of its routers.
 func (p *dockerProvisioner) Provision(app provision.App) error {
-	r, err := getRouterForApp(app)
+	appRouters, err := app.GetRouters()
 	if err != nil {
-		log.Fatalf("Failed to get router: %s", err)
+		log.Fatalf("Failed to get routers: %s", err)
 		return err
 	}
-	if optsRouter, ok := r.(router.OptsRouter); ok {
-		return optsRouter.AddBackendOpts(app.GetName(), app.GetRouterOpts())
+	added := make([]router.Router, 0, len(appRouters))
+	rollback := func() {
+		for _, r := range added {
+			if rmErr := r.RemoveBackend(app.GetName()); rmErr != nil && rmErr != router.ErrBackendNotFound {
+				log.Errorf("Failed to remove route backend: %s", rmErr)
+			}
+		}
 	}
-	return r.AddBackend(app.GetName())
+	for _, appRouter := range appRouters {
+		var r router.Router
+		r, err = router.Get(appRouter.Name)
+		if err != nil {
+			log.Fatalf("Failed to get router: %s", err)
+			rollback()
+			return err
+		}
+		if optsRouter, ok := r.(router.OptsRouter); ok {
+			err = optsRouter.AddBackendOpts(app.GetName(), appRouter.Opts)
+		} else {
+			err = r.AddBackend(app.GetName())
+		}
+		if err != nil {
+			rollback()
+			return err
+		}
+		added = append(added, r)
+	}
+	return nil
 }
 
 func (p *dockerProvisioner) Restart(a provision.App, process string, w io.Writer) error {
@@ -379,11 +456,26 @@ func (p *dockerProvisioner) Sleep(app provision.App, process string) error {
 }
 
 func (p *dockerProvisioner) Swap(app1, app2 provision.App, cnameOnly bool) error {
-	r, err := getRouterForApp(app1)
+	routers1, err := app1.GetRouters()
 	if err != nil {
 		return err
 	}
-	err = r.Swap(app1.GetName(), app2.GetName(), cnameOnly)
+	routers2, err := app2.GetRouters()
+	if err != nil {
+		return err
+	}
+	if !sameRouters(routers1, routers2) {
+		return fmt.Errorf("swap is only allowed between apps with the same routers")
+	}
+	routers, err := getRoutersForApp(app1)
+	if err != nil {
+		return err
+	}
+	if len(routers) == 1 {
+		err = routers[0].Swap(app1.GetName(), app2.GetName(), cnameOnly)
+	} else {
+		err = router.SwapMany(routers, app1.GetName(), app2.GetName(), cnameOnly)
+	}
 	if err != nil {
 		routesRebuildOrEnqueue(app1.GetName())
 		routesRebuildOrEnqueue(app2.GetName())
@@ -391,6 +483,22 @@ func (p *dockerProvisioner) Swap(app1, app2 provision.App, cnameOnly bool) error
 	return err
 }
 
+func sameRouters(routers1, routers2 []provision.AppRouter) bool {
+	if len(routers1) != len(routers2) {
+		return false
+	}
+	names := make(map[string]bool, len(routers1))
+	for _, r := range routers1 {
+		names[r.Name] = true
+	}
+	for _, r := range routers2 {
+		if !names[r.Name] {
+			return false
+		}
+	}
+	return true
+}
+
 func (p *dockerProvisioner) Rollback(a provision.App, imageId string, evt *event.Event) (string, error) {
 	validImgs, err := p.ValidAppImages(a.GetName())
 	if err != nil {
@@ -495,6 +603,64 @@ func (p *dockerProvisioner) ImageDeploy(app provision.App, imageId string, evt *
 	return newImage, p.deploy(app, newImage, evt)
 }
 
+func (p *dockerProvisioner) PromoteDeploy(app, source provision.App, imageId string, evt *event.Event) (string, error) {
+	validImgs, err := p.ValidAppImages(source.GetName())
+	if err != nil {
+		return "", err
+	}
+	sourceImage := ""
+	if imageId == "" && len(validImgs) > 0 {
+		sourceImage = validImgs[len(validImgs)-1]
+	}
+	for _, img := range validImgs {
+		if imageId != "" && (img == imageId || strings.HasSuffix(img, ":"+imageId)) {
+			sourceImage = img
+			break
+		}
+	}
+	if sourceImage == "" {
+		return "", fmt.Errorf("Image %q not found in app %q", imageId, source.GetName())
+	}
+	imageData, err := getImageCustomData(sourceImage)
+	if err != nil {
+		return "", err
+	}
+	newImage, err := appNewImageName(app.GetName())
+	if err != nil {
+		return "", err
+	}
+	w := evt
+	fmt.Fprintf(w, "---- Promoting image %s from app %s ----\n", sourceImage, source.GetName())
+	cluster := p.Cluster()
+	imageInfo := strings.Split(newImage, ":")
+	repo, tag := strings.Join(imageInfo[:len(imageInfo)-1], ":"), imageInfo[len(imageInfo)-1]
+	err = cluster.TagImage(sourceImage, docker.TagImageOptions{Repo: repo, Tag: tag, Force: true})
+	if err != nil {
+		return "", err
+	}
+	registry, _ := config.GetString("docker:registry")
+	if registry != "" {
+		fmt.Fprintln(w, "---- Pushing image to tsuru ----")
+		pushOpts := docker.PushImageOptions{
+			Name:              repo,
+			Tag:               tag,
+			Registry:          registry,
+			OutputStream:      w,
+			InactivityTimeout: net.StreamInactivityTimeout,
+		}
+		err = cluster.PushImage(pushOpts, p.RegistryAuthConfig())
+		if err != nil {
+			return "", err
+		}
+	}
+	err = saveImageMetadata(newImage, imageData)
+	if err != nil {
+		return "", err
+	}
+	app.SetUpdatePlatform(true)
+	return newImage, p.deploy(app, newImage, evt)
+}
+
 func (p *dockerProvisioner) ArchiveDeploy(app provision.App, archiveURL string, evt *event.Event) (string, error) {
 	imageId, err := p.archiveDeploy(app, p.getBuildImage(app), archiveURL, evt)
 	if err != nil {
@@ -611,8 +777,13 @@ func (p *dockerProvisioner) deployAndClean(a provision.App, imageId string, evt
 	err := p.deploy(a, imageId, evt)
 	if err != nil {
 		p.cleanImage(a.GetName(), imageId)
+		return err
 	}
-	return err
+	if watcher := p.newDeployWatcher(a, imageId, evt); watcher != nil {
+		fmt.Fprintf(evt, "---- Watching units for %s, unhealthy deploys will be rolled back ----\n", watcher.config.WatchPeriod)
+		go watcher.run()
+	}
+	return nil
 }
 
 func (p *dockerProvisioner) deploy(a provision.App, imageId string, evt *event.Event) error {
@@ -733,15 +904,17 @@ func (p *dockerProvisioner) Destroy(app provision.App) error {
 	if err != nil {
 		log.Errorf("Failed to remove image names from storage for app %s: %s", app.GetName(), err.Error())
 	}
-	r, err := getRouterForApp(app)
+	routers, err := getRoutersForApp(app)
 	if err != nil {
-		log.Errorf("Failed to get router: %s", err.Error())
+		log.Errorf("Failed to get routers: %s", err.Error())
 		return err
 	}
-	err = r.RemoveBackend(app.GetName())
-	if err != nil {
-		log.Errorf("Failed to remove route backend: %s", err.Error())
-		return err
+	for _, r := range routers {
+		err = r.RemoveBackend(app.GetName())
+		if err != nil {
+			log.Errorf("Failed to remove route backend: %s", err.Error())
+			return err
+		}
 	}
 	return nil
 }
@@ -990,36 +1163,56 @@ func (p *dockerProvisioner) ExecuteCommand(stdout, stderr io.Writer, app provisi
 	return nil
 }
 
-func (p *dockerProvisioner) SetCName(app provision.App, cname string) error {
-	r, err := getRouterForApp(app)
+// cnameRoutersForApp returns the routers of the app that support cnames. The
+// main router of the app must support them, other routers without support
+// are ignored.
+func cnameRoutersForApp(app provision.App) ([]router.CNameRouter, error) {
+	routers, err := getRoutersForApp(app)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	cnameRouter, ok := r.(router.CNameRouter)
-	if !ok {
-		return fmt.Errorf("router %T does not allow cnames", r)
+	var cnameRouters []router.CNameRouter
+	for i, r := range routers {
+		cnameRouter, ok := r.(router.CNameRouter)
+		if !ok {
+			if i == 0 {
+				return nil, fmt.Errorf("router %T does not allow cnames", r)
+			}
+			continue
+		}
+		cnameRouters = append(cnameRouters, cnameRouter)
 	}
-	err = cnameRouter.SetCName(cname, app.GetName())
+	return cnameRouters, nil
+}
+
+func (p *dockerProvisioner) SetCName(app provision.App, cname string) error {
+	cnameRouters, err := cnameRoutersForApp(app)
 	if err != nil {
-		routesRebuildOrEnqueue(app.GetName())
+		return err
 	}
-	return err
+	for _, cnameRouter := range cnameRouters {
+		err = cnameRouter.SetCName(cname, app.GetName())
+		if err != nil {
+			routesRebuildOrEnqueue(app.GetName())
+			return err
+		}
+	}
+	return nil
 }
 
 func (p *dockerProvisioner) UnsetCName(app provision.App, cname string) error {
-	r, err := getRouterForApp(app)
+	cnameRouters, err := cnameRoutersForApp(app)
 	if err != nil {
 		return err
 	}
-	cnameRouter, ok := r.(router.CNameRouter)
-	if !ok {
-		return fmt.Errorf("router %T does not allow cnames", r)
-	}
-	err = cnameRouter.UnsetCName(cname, app.GetName())
-	if err != nil {
-		routesRebuildOrEnqueue(app.GetName())
+	for _, cnameRouter := range cnameRouters {
+		err = cnameRouter.UnsetCName(cname, app.GetName())
+		if err != nil {
+			routesRebuildOrEnqueue(app.GetName())
+			return err
+		}
 	}
-	return err
+	return nil
 }
 
 func (p *dockerProvisioner) AdminCommands() []cmd.Command {
@@ -1030,24 +1223,36 @@ func (p *dockerProvisioner) AdminCommands() []cmd.Command {
 		&addNodeToSchedulerCmd{},
 		&removeNodeFromSchedulerCmd{},
 		&listNodesInTheSchedulerCmd{},
+		&cordonNodeCmd{},
+		&uncordonNodeCmd{},
+		&drainNodeCmd{},
 		&healer.ListHealingHistoryCmd{},
 		&healer.GetNodeHealingConfigCmd{},
 		&healer.SetNodeHealingConfigCmd{},
 		&healer.DeleteNodeHealingConfigCmd{},
+		&healer.ResumeNodeHealingCmd{},
 		&autoScaleRunCmd{},
+		&autoScaleSimulateCmd{},
 		&listAutoScaleHistoryCmd{},
 		&autoScaleInfoCmd{},
 		&autoScaleSetRuleCmd{},
 		&autoScaleDeleteRuleCmd{},
+		&autoScaleSetScheduleCmd{},
+		&autoScaleListSchedulesCmd{},
+		&autoScaleDeleteScheduleCmd{},
+		&listOrphansCmd{},
 		&updateNodeToSchedulerCmd{},
 		&dockerLogInfo{},
 		&dockerLogUpdate{},
+		&schedulerInfo{},
+		&schedulerUpdate{},
 		&nodecontainer.NodeContainerList{},
 		&nodecontainer.NodeContainerAdd{},
 		&nodecontainer.NodeContainerInfo{},
 		&nodecontainer.NodeContainerUpdate{},
 		&nodecontainer.NodeContainerDelete{},
 		&nodecontainer.NodeContainerUpgrade{},
+		&nodecontainer.NodeContainerStatus{},
 		&cmd.RemovedCommand{Name: "bs-env-set", Help: "You should use `tsuru-admin node-container-update big-sibling` instead."},
 		&cmd.RemovedCommand{Name: "bs-info", Help: "You should use `tsuru-admin node-container-info big-sibling` instead."},
 		&cmd.RemovedCommand{Name: "bs-upgrade", Help: "You should use `tsuru-admin node-container-upgrade big-sibling` instead."},
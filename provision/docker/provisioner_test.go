@@ -38,6 +38,7 @@ import (
 	"github.com/tsuru/tsuru/queue"
 	"github.com/tsuru/tsuru/quota"
 	"github.com/tsuru/tsuru/repository"
+	"github.com/tsuru/tsuru/router"
 	"github.com/tsuru/tsuru/router/routertest"
 	"github.com/tsuru/tsuru/safe"
 	"gopkg.in/check.v1"
@@ -57,6 +58,30 @@ func (s *S) TestProvisionerProvision(c *check.C) {
 	c.Assert(routertest.FakeRouter.HasBackend("myapp"), check.Equals, true)
 }
 
+func (s *S) TestProvisionerProvisionMultipleRouters(c *check.C) {
+	app := provisiontest.NewFakeApp("myapp", "python", 1)
+	app.Routers = []provision.AppRouter{{Name: "fake-hc"}}
+	err := s.p.Provision(app)
+	c.Assert(err, check.IsNil)
+	c.Assert(routertest.FakeRouter.HasBackend("myapp"), check.Equals, true)
+	c.Assert(routertest.HCRouter.HasBackend("myapp"), check.Equals, true)
+	err = s.p.Destroy(app)
+	c.Assert(err, check.IsNil)
+	c.Assert(routertest.FakeRouter.HasBackend("myapp"), check.Equals, false)
+	c.Assert(routertest.HCRouter.HasBackend("myapp"), check.Equals, false)
+}
+
+func (s *S) TestProvisionerProvisionMultipleRoutersRollback(c *check.C) {
+	err := routertest.HCRouter.AddBackend("myapp")
+	c.Assert(err, check.IsNil)
+	app := provisiontest.NewFakeApp("myapp", "python", 1)
+	app.Routers = []provision.AppRouter{{Name: "fake-hc"}}
+	err = s.p.Provision(app)
+	c.Assert(err, check.Equals, router.ErrBackendExists)
+	c.Assert(routertest.FakeRouter.HasBackend("myapp"), check.Equals, false)
+	c.Assert(routertest.HCRouter.HasBackend("myapp"), check.Equals, true)
+}
+
 func (s *S) TestProvisionerRestart(c *check.C) {
 	app := provisiontest.NewFakeApp("almah", "static", 1)
 	customData := map[string]interface{}{
@@ -811,6 +836,70 @@ func (s *S) TestRollbackDeploy(c *check.C) {
 	c.Assert(units, check.HasLen, 1)
 }
 
+func (s *S) TestPromoteDeploy(c *check.C) {
+	err := s.newFakeImage(s.p, "tsuru/app-otherapp-staging:v1", map[string]interface{}{
+		"processes": map[string]interface{}{
+			"web":    "python myapp.py",
+			"worker": "python worker.py",
+		},
+	})
+	c.Assert(err, check.IsNil)
+	err = appendAppImageName("otherapp-staging", "tsuru/app-otherapp-staging:v1")
+	c.Assert(err, check.IsNil)
+	source := app.App{Name: "otherapp-staging", Platform: "python"}
+	err = s.storage.Apps().Insert(source)
+	c.Assert(err, check.IsNil)
+	a := app.App{
+		Name:     "otherapp",
+		Platform: "python",
+		Quota:    quota.Unlimited,
+	}
+	err = s.storage.Apps().Insert(a)
+	c.Assert(err, check.IsNil)
+	s.p.Provision(&a)
+	defer s.p.Destroy(&a)
+	w := safe.NewBuffer(make([]byte, 2048))
+	evt, err := event.New(&event.Opts{
+		Target: event.Target{Type: "app", Value: a.Name},
+		Kind:   permission.PermAppDeploy,
+		Owner:  s.token,
+	})
+	c.Assert(err, check.IsNil)
+	imgID, err := app.Deploy(app.DeployOptions{
+		App:          &a,
+		OutputStream: w,
+		Image:        "v1",
+		PromoteFrom:  source.Name,
+		Event:        evt,
+	})
+	c.Assert(err, check.IsNil)
+	c.Assert(imgID, check.Equals, "tsuru/app-otherapp:v1")
+	imd, err := getImageCustomData(imgID)
+	c.Assert(err, check.IsNil)
+	c.Assert(imd.Processes, check.DeepEquals, map[string]string{
+		"web":    "python myapp.py",
+		"worker": "python worker.py",
+	})
+	units, err := a.Units()
+	c.Assert(err, check.IsNil)
+	c.Assert(units, check.HasLen, 2)
+}
+
+func (s *S) TestPromoteDeployInvalidImage(c *check.C) {
+	err := appendAppImageName("otherapp-staging", "tsuru/app-otherapp-staging:v1")
+	c.Assert(err, check.IsNil)
+	source := &app.App{Name: "otherapp-staging", Platform: "python"}
+	a := &app.App{Name: "otherapp", Platform: "python"}
+	evt, err := event.New(&event.Opts{
+		Target: event.Target{Type: "app", Value: a.Name},
+		Kind:   permission.PermAppDeploy,
+		Owner:  s.token,
+	})
+	c.Assert(err, check.IsNil)
+	_, err = s.p.PromoteDeploy(a, source, "v2", evt)
+	c.Assert(err, check.ErrorMatches, `Image "v2" not found in app "otherapp-staging"`)
+}
+
 func (s *S) TestRollbackDeployFailureDoesntEraseImage(c *check.C) {
 	err := s.newFakeImage(s.p, "tsuru/app-otherapp:v1", nil)
 	c.Assert(err, check.IsNil)
@@ -2058,6 +2147,22 @@ func (s *S) TestProvisionSetCName(c *check.C) {
 	c.Assert(routertest.FakeRouter.HasRoute(cname, addr.String()), check.Equals, true)
 }
 
+func (s *S) TestProvisionSetCNameMultipleRouters(c *check.C) {
+	a := provisiontest.NewFakeApp("myapp", "python", 1)
+	a.Routers = []provision.AppRouter{{Name: "fake-hc"}}
+	err := s.p.Provision(a)
+	c.Assert(err, check.IsNil)
+	cname := "mycname.com"
+	err = s.p.SetCName(a, cname)
+	c.Assert(err, check.IsNil)
+	c.Assert(routertest.FakeRouter.HasCName(cname), check.Equals, true)
+	c.Assert(routertest.HCRouter.HasCName(cname), check.Equals, true)
+	err = s.p.UnsetCName(a, cname)
+	c.Assert(err, check.IsNil)
+	c.Assert(routertest.FakeRouter.HasCName(cname), check.Equals, false)
+	c.Assert(routertest.HCRouter.HasCName(cname), check.Equals, false)
+}
+
 func (s *S) TestProvisionUnsetCName(c *check.C) {
 	a := provisiontest.NewFakeApp("myapp", "python", 1)
 	routertest.FakeRouter.AddBackend("myapp")
@@ -2086,24 +2191,36 @@ func (s *S) TestAdminCommands(c *check.C) {
 		&addNodeToSchedulerCmd{},
 		&removeNodeFromSchedulerCmd{},
 		&listNodesInTheSchedulerCmd{},
+		&cordonNodeCmd{},
+		&uncordonNodeCmd{},
+		&drainNodeCmd{},
 		&healer.ListHealingHistoryCmd{},
 		&healer.GetNodeHealingConfigCmd{},
 		&healer.SetNodeHealingConfigCmd{},
 		&healer.DeleteNodeHealingConfigCmd{},
+		&healer.ResumeNodeHealingCmd{},
 		&autoScaleRunCmd{},
+		&autoScaleSimulateCmd{},
 		&listAutoScaleHistoryCmd{},
 		&autoScaleInfoCmd{},
 		&autoScaleSetRuleCmd{},
 		&autoScaleDeleteRuleCmd{},
+		&autoScaleSetScheduleCmd{},
+		&autoScaleListSchedulesCmd{},
+		&autoScaleDeleteScheduleCmd{},
+		&listOrphansCmd{},
 		&updateNodeToSchedulerCmd{},
 		&dockerLogInfo{},
 		&dockerLogUpdate{},
+		&schedulerInfo{},
+		&schedulerUpdate{},
 		&nodecontainer.NodeContainerList{},
 		&nodecontainer.NodeContainerAdd{},
 		&nodecontainer.NodeContainerInfo{},
 		&nodecontainer.NodeContainerUpdate{},
 		&nodecontainer.NodeContainerDelete{},
 		&nodecontainer.NodeContainerUpgrade{},
+		&nodecontainer.NodeContainerStatus{},
 		&cmd.RemovedCommand{Name: "bs-env-set", Help: "You should use `tsuru-admin node-container-update big-sibling` instead."},
 		&cmd.RemovedCommand{Name: "bs-info", Help: "You should use `tsuru-admin node-container-info big-sibling` instead."},
 		&cmd.RemovedCommand{Name: "bs-upgrade", Help: "You should use `tsuru-admin node-container-upgrade big-sibling` instead."},
@@ -2132,6 +2249,41 @@ func (s *S) TestSwap(c *check.C) {
 	c.Assert(routertest.FakeRouter.HasRoute(app1.GetName(), addr2.String()), check.Equals, true)
 }
 
+func (s *S) TestSwapMultipleRouters(c *check.C) {
+	app1 := provisiontest.NewFakeApp("app1", "python", 1)
+	app1.Routers = []provision.AppRouter{{Name: "fake-hc"}}
+	app2 := provisiontest.NewFakeApp("app2", "python", 1)
+	app2.Routers = []provision.AppRouter{{Name: "fake-hc"}}
+	addr1, _ := url.Parse("http://127.0.0.1")
+	addr2, _ := url.Parse("http://127.0.0.2")
+	err := s.p.Provision(app1)
+	c.Assert(err, check.IsNil)
+	err = s.p.Provision(app2)
+	c.Assert(err, check.IsNil)
+	routertest.FakeRouter.AddRoute(app1.GetName(), addr1)
+	routertest.HCRouter.AddRoute(app1.GetName(), addr1)
+	routertest.FakeRouter.AddRoute(app2.GetName(), addr2)
+	routertest.HCRouter.AddRoute(app2.GetName(), addr2)
+	err = s.p.Swap(app1, app2, false)
+	c.Assert(err, check.IsNil)
+	c.Assert(routertest.FakeRouter.HasRoute(app2.GetName(), addr1.String()), check.Equals, true)
+	c.Assert(routertest.FakeRouter.HasRoute(app1.GetName(), addr2.String()), check.Equals, true)
+	c.Assert(routertest.HCRouter.HasRoute(app2.GetName(), addr1.String()), check.Equals, true)
+	c.Assert(routertest.HCRouter.HasRoute(app1.GetName(), addr2.String()), check.Equals, true)
+	swapped, with, err := router.IsSwapped(app1.GetName())
+	c.Assert(err, check.IsNil)
+	c.Assert(swapped, check.Equals, true)
+	c.Assert(with, check.Equals, app2.GetName())
+}
+
+func (s *S) TestSwapDifferentRouters(c *check.C) {
+	app1 := provisiontest.NewFakeApp("app1", "python", 1)
+	app1.Routers = []provision.AppRouter{{Name: "fake-hc"}}
+	app2 := provisiontest.NewFakeApp("app2", "python", 1)
+	err := s.p.Swap(app1, app2, false)
+	c.Assert(err, check.ErrorMatches, "swap is only allowed between apps with the same routers")
+}
+
 func (s *S) TestProvisionerRollbackNoDeployImage(c *check.C) {
 	a := provisiontest.NewFakeApp("otherapp", "python", 1)
 	_, err := s.p.Rollback(a, "inexist", nil)
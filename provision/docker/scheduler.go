@@ -18,6 +18,7 @@ import (
 	"github.com/tsuru/tsuru/log"
 	"github.com/tsuru/tsuru/net"
 	"github.com/tsuru/tsuru/provision/docker/container"
+	"github.com/tsuru/tsuru/provision/docker/nodestate"
 	"gopkg.in/mgo.v2"
 	"gopkg.in/mgo.v2/bson"
 )
@@ -26,6 +27,10 @@ import (
 // the segregated scheduler.
 var errNoDefaultPool = errors.New("no default pool configured in the scheduler: you should create a default pool.")
 
+// errNoSchedulableNodes is the error returned when all nodes available for an
+// app are cordoned or being drained.
+var errNoSchedulableNodes = errors.New("no nodes available for scheduling: all nodes are under maintenance")
+
 type segregatedScheduler struct {
 	hostMutex           sync.Mutex
 	maxMemoryRatio      float32
@@ -49,11 +54,27 @@ func (s *segregatedScheduler) Schedule(c *cluster.Cluster, opts docker.CreateCon
 	if err != nil {
 		return cluster.Node{}, &container.SchedulerError{Base: err}
 	}
+	nodes = nodestate.Schedulable(nodes)
+	if len(nodes) == 0 {
+		return cluster.Node{}, &container.SchedulerError{Base: errNoSchedulableNodes}
+	}
+	var imageName string
+	if opts.Config != nil {
+		imageName = opts.Config.Image
+	}
+	rules, err := placementRules(imageName, schedOpts.ProcessName)
+	if err != nil {
+		return cluster.Node{}, &container.SchedulerError{Base: err}
+	}
+	nodes, err = s.filterByPlacement(nodes, schedOpts.AppName, rules)
+	if err != nil {
+		return cluster.Node{}, &container.SchedulerError{Base: err}
+	}
 	nodes, err = s.filterByMemoryUsage(a, nodes, s.maxMemoryRatio, s.TotalMemoryMetadata)
 	if err != nil {
 		return cluster.Node{}, &container.SchedulerError{Base: err}
 	}
-	node, err := s.chooseNodeToAdd(nodes, opts.Name, schedOpts.AppName, schedOpts.ProcessName)
+	node, err := s.chooseNodeToAdd(nodes, opts.Name, schedOpts.AppName, schedOpts.ProcessName, rules.Spread)
 	if err != nil {
 		return cluster.Node{}, &container.SchedulerError{Base: err}
 	}
@@ -171,6 +192,17 @@ func (s *segregatedScheduler) GetRemovableContainer(appName string, process stri
 	if err != nil {
 		return "", err
 	}
+	imageName, _ := appCurrentImageName(appName)
+	rules, err := placementRules(imageName, process)
+	if err != nil {
+		return "", err
+	}
+	if rules.Spread != "" {
+		nodes, err = s.filterBySpread(nodes, rules.Spread, appName, process, true)
+		if err != nil {
+			return "", err
+		}
+	}
 	return s.chooseContainerToRemove(nodes, appName, process)
 }
 
@@ -218,13 +250,27 @@ func (s *segregatedScheduler) nodesToHosts(nodes []cluster.Node) ([]string, map[
 	return hosts, hostsMap
 }
 
-// chooseNodeToAdd finds which is the node with the minimum number of containers
-// and returns it
-func (s *segregatedScheduler) chooseNodeToAdd(nodes []cluster.Node, contName string, appName, process string) (string, error) {
+// chooseNodeToAdd finds the best node for a new container, according to the
+// scheduler strategy of the pool, and returns it. When spreadKey is set, only
+// nodes in the metadata groups with the fewest containers of the app process
+// are considered.
+func (s *segregatedScheduler) chooseNodeToAdd(nodes []cluster.Node, contName string, appName, process, spreadKey string) (string, error) {
 	log.Debugf("[scheduler] Possible nodes for container %s: %#v", contName, nodes)
 	s.hostMutex.Lock()
 	defer s.hostMutex.Unlock()
-	chosenNode, _, err := s.minMaxNodes(nodes, appName, process)
+	nodes, err := s.filterBySpread(nodes, spreadKey, appName, process, false)
+	if err != nil {
+		return "", err
+	}
+	var pool string
+	if len(nodes) > 0 {
+		pool = nodes[0].Metadata[poolMetadataName]
+	}
+	strategy, err := schedulerStrategyForPool(pool)
+	if err != nil {
+		return "", err
+	}
+	chosenNode, err := strategy.chooseNode(s, nodes, appName, process)
 	if err != nil {
 		return "", err
 	}
@@ -0,0 +1,258 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package docker
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+
+	"github.com/tsuru/docker-cluster/cluster"
+	"github.com/tsuru/tsuru/app"
+	"github.com/tsuru/tsuru/log"
+	"github.com/tsuru/tsuru/net"
+	"github.com/tsuru/tsuru/scopedconfig"
+	"gopkg.in/mgo.v2/bson"
+)
+
+const (
+	schedulerConfigCollection = "scheduler"
+	spreadStrategyName        = "spread"
+	binPackStrategyName       = "binpack"
+)
+
+// schedulerStrategy decides where new containers are placed and which nodes
+// should be emptied first when the node auto scaler removes nodes.
+type schedulerStrategy interface {
+	// chooseNode returns the address of the node, among the received ones,
+	// where a new container for the app process should run.
+	chooseNode(s *segregatedScheduler, nodes []cluster.Node, appName, process string) (string, error)
+	// removalOrder returns the nodes sorted by removal preference, the first
+	// node being the best candidate to be removed.
+	removalOrder(p *dockerProvisioner, nodes []*cluster.Node) ([]*cluster.Node, error)
+}
+
+var schedulerStrategies = map[string]schedulerStrategy{}
+
+func registerSchedulerStrategy(name string, strategy schedulerStrategy) {
+	schedulerStrategies[name] = strategy
+}
+
+func init() {
+	registerSchedulerStrategy(spreadStrategyName, spreadStrategy{})
+	registerSchedulerStrategy(binPackStrategyName, binPackStrategy{})
+}
+
+type schedulerConfig struct {
+	Strategy string
+}
+
+func loadSchedulerConfig() *scopedconfig.ScopedConfig {
+	conf := scopedconfig.FindScopedConfig(schedulerConfigCollection)
+	conf.ShallowMerge = true
+	return conf
+}
+
+func schedulerConfigLoadAll() (map[string]schedulerConfig, error) {
+	var all map[string]schedulerConfig
+	err := loadSchedulerConfig().LoadAll(&all)
+	return all, err
+}
+
+func (c *schedulerConfig) save(pool string) error {
+	if _, ok := schedulerStrategies[c.Strategy]; !ok {
+		return fmt.Errorf("invalid scheduler strategy %q", c.Strategy)
+	}
+	return loadSchedulerConfig().Save(pool, *c)
+}
+
+// schedulerStrategyForPool returns the strategy configured for the pool,
+// falling back to the default configuration and to the spread strategy.
+func schedulerStrategyForPool(pool string) (schedulerStrategy, error) {
+	var conf schedulerConfig
+	err := loadSchedulerConfig().Load(pool, &conf)
+	if err != nil {
+		return nil, err
+	}
+	if conf.Strategy == "" {
+		conf.Strategy = spreadStrategyName
+	}
+	strategy, ok := schedulerStrategies[conf.Strategy]
+	if !ok {
+		return nil, fmt.Errorf("invalid scheduler strategy %q for pool %q", conf.Strategy, pool)
+	}
+	return strategy, nil
+}
+
+// spreadStrategy distributes containers evenly among nodes, considering
+// metadata groups first, then app process containers and then the total
+// number of containers in each node.
+type spreadStrategy struct{}
+
+func (spreadStrategy) chooseNode(s *segregatedScheduler, nodes []cluster.Node, appName, process string) (string, error) {
+	node, _, err := s.minMaxNodes(nodes, appName, process)
+	return node, err
+}
+
+func (spreadStrategy) removalOrder(p *dockerProvisioner, nodes []*cluster.Node) ([]*cluster.Node, error) {
+	return nodes, nil
+}
+
+// binPackStrategy fills the most used nodes first, based on reserved memory,
+// cpu shares and number of containers, so that less used nodes can be emptied
+// and removed. It depends on memory aware scheduling to know when a node is
+// full, falling back to the spread strategy when it's not configured.
+type binPackStrategy struct{}
+
+var binPackFallbackOnce sync.Once
+
+func (binPackStrategy) chooseNode(s *segregatedScheduler, nodes []cluster.Node, appName, process string) (string, error) {
+	if s.maxMemoryRatio == 0 || s.TotalMemoryMetadata == "" {
+		binPackFallbackOnce.Do(func() {
+			log.Errorf("[scheduler] binpack strategy requires memory aware scheduling, falling back to spread")
+		})
+		return spreadStrategy{}.chooseNode(s, nodes, appName, process)
+	}
+	nodesPtr := make([]*cluster.Node, len(nodes))
+	for i := range nodes {
+		nodesPtr[i] = &nodes[i]
+	}
+	usage, unknown, err := nodesUsage(s.provisioner, s.TotalMemoryMetadata, nodesPtr, s.ignoredContainers)
+	if err != nil {
+		return "", err
+	}
+	if len(usage) == 0 {
+		return spreadStrategy{}.chooseNode(s, nodes, appName, process)
+	}
+	if len(unknown) > 0 {
+		log.Debugf("[scheduler] binpack strategy ignoring %d nodes without %q metadata", len(unknown), s.TotalMemoryMetadata)
+	}
+	a, err := app.GetByName(appName)
+	if err != nil {
+		return "", err
+	}
+	// Nodes over the memory limit are only received when auto scale allows
+	// going over quota, in which case the load is spread among them until
+	// new nodes are added.
+	if usage.overMemoryLimit(s, a.Plan.Memory) {
+		sort.Sort(usage)
+	} else {
+		sort.Sort(sort.Reverse(usage))
+	}
+	return usage[0].node.Address, nil
+}
+
+// removalOrder sorts the nodes from the least to the most used. Nodes whose
+// usage can't be compared to the others, for missing the total memory
+// metadata, are the last candidates for removal.
+func (binPackStrategy) removalOrder(p *dockerProvisioner, nodes []*cluster.Node) ([]*cluster.Node, error) {
+	var totalMemoryMetadata string
+	if p.scheduler != nil {
+		totalMemoryMetadata = p.scheduler.TotalMemoryMetadata
+	}
+	usage, unknown, err := nodesUsage(p, totalMemoryMetadata, nodes, nil)
+	if err != nil {
+		return nil, err
+	}
+	sort.Sort(usage)
+	result := make([]*cluster.Node, 0, len(nodes))
+	for i := range usage {
+		result = append(result, usage[i].node)
+	}
+	return append(result, unknown...), nil
+}
+
+type nodeUsage struct {
+	node       *cluster.Node
+	memory     float64
+	cpuShares  int
+	containers int
+}
+
+// nodeUsageList sorts nodes from the least to the most used.
+type nodeUsageList []nodeUsage
+
+func (l nodeUsageList) Len() int      { return len(l) }
+func (l nodeUsageList) Swap(i, j int) { l[i], l[j] = l[j], l[i] }
+func (l nodeUsageList) Less(i, j int) bool {
+	if l[i].memory != l[j].memory {
+		return l[i].memory < l[j].memory
+	}
+	if l[i].cpuShares != l[j].cpuShares {
+		return l[i].cpuShares < l[j].cpuShares
+	}
+	if l[i].containers != l[j].containers {
+		return l[i].containers < l[j].containers
+	}
+	return l[i].node.Address > l[j].node.Address
+}
+
+// overMemoryLimit returns whether all the nodes would go over the memory
+// limit of the scheduler when reserving planMemory. The usage must have been
+// calculated using the total memory metadata of the scheduler.
+func (l nodeUsageList) overMemoryLimit(s *segregatedScheduler, planMemory int64) bool {
+	for _, u := range l {
+		totalMemory, _ := strconv.ParseFloat(u.node.Metadata[s.TotalMemoryMetadata], 64)
+		if u.memory*totalMemory+float64(planMemory) <= totalMemory*float64(s.maxMemoryRatio) {
+			return false
+		}
+	}
+	return true
+}
+
+// nodesUsage returns the usage of the nodes. When totalMemoryMetadata is set,
+// memory usage is the ratio of reserved memory to the total memory of the
+// node, and nodes without a valid total memory are returned separately, as
+// their usage can't be compared to the other nodes.
+func nodesUsage(p *dockerProvisioner, totalMemoryMetadata string, nodes []*cluster.Node, ignoredContainers []string) (nodeUsageList, []*cluster.Node, error) {
+	hosts := make([]string, len(nodes))
+	for i := range nodes {
+		hosts[i] = net.URLToHost(nodes[i].Address)
+	}
+	containers, err := p.ListContainers(bson.M{"hostaddr": bson.M{"$in": hosts}, "id": bson.M{"$nin": ignoredContainers}})
+	if err != nil {
+		return nil, nil, err
+	}
+	plans := map[string]app.Plan{}
+	memory := map[string]int64{}
+	cpuShares := map[string]int{}
+	count := map[string]int{}
+	for _, c := range containers {
+		plan, ok := plans[c.AppName]
+		if !ok {
+			a, err := app.GetByName(c.AppName)
+			if err != nil {
+				return nil, nil, err
+			}
+			plan = a.Plan
+			plans[c.AppName] = plan
+		}
+		memory[c.HostAddr] += plan.Memory
+		cpuShares[c.HostAddr] += plan.CpuShare
+		count[c.HostAddr]++
+	}
+	result := make(nodeUsageList, 0, len(nodes))
+	var unknown []*cluster.Node
+	for i, node := range nodes {
+		host := hosts[i]
+		usage := nodeUsage{
+			node:       node,
+			memory:     float64(memory[host]),
+			cpuShares:  cpuShares[host],
+			containers: count[host],
+		}
+		if totalMemoryMetadata != "" {
+			totalMemory, _ := strconv.ParseFloat(node.Metadata[totalMemoryMetadata], 64)
+			if totalMemory <= 0 {
+				unknown = append(unknown, node)
+				continue
+			}
+			usage.memory = usage.memory / totalMemory
+		}
+		result = append(result, usage)
+	}
+	return result, unknown, nil
+}
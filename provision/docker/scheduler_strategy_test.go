@@ -0,0 +1,164 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package docker
+
+import (
+	"github.com/tsuru/docker-cluster/cluster"
+	"github.com/tsuru/tsuru/app"
+	"github.com/tsuru/tsuru/provision/docker/container"
+	"gopkg.in/check.v1"
+	"gopkg.in/mgo.v2/bson"
+)
+
+func (s *S) TestSchedulerStrategyForPool(c *check.C) {
+	strategy, err := schedulerStrategyForPool("dev")
+	c.Assert(err, check.IsNil)
+	c.Assert(strategy, check.Equals, spreadStrategy{})
+	conf := schedulerConfig{Strategy: binPackStrategyName}
+	err = conf.save("dev")
+	c.Assert(err, check.IsNil)
+	strategy, err = schedulerStrategyForPool("dev")
+	c.Assert(err, check.IsNil)
+	c.Assert(strategy, check.Equals, binPackStrategy{})
+	strategy, err = schedulerStrategyForPool("prod")
+	c.Assert(err, check.IsNil)
+	c.Assert(strategy, check.Equals, spreadStrategy{})
+	err = conf.save("")
+	c.Assert(err, check.IsNil)
+	strategy, err = schedulerStrategyForPool("prod")
+	c.Assert(err, check.IsNil)
+	c.Assert(strategy, check.Equals, binPackStrategy{})
+}
+
+func (s *S) TestSchedulerConfigSaveInvalidStrategy(c *check.C) {
+	conf := schedulerConfig{Strategy: "random"}
+	err := conf.save("dev")
+	c.Assert(err, check.ErrorMatches, `invalid scheduler strategy "random"`)
+}
+
+func (s *S) insertBinPackContainers(c *check.C) {
+	a1 := app.App{Name: "big", Plan: app.Plan{Memory: 400, CpuShare: 10}}
+	a2 := app.App{Name: "small", Plan: app.Plan{Memory: 100, CpuShare: 2}}
+	a3 := app.App{Name: "myapp", Plan: app.Plan{Memory: 100, CpuShare: 2}}
+	err := s.storage.Apps().Insert(a1, a2, a3)
+	c.Assert(err, check.IsNil)
+	coll := s.p.Collection()
+	defer coll.Close()
+	err = coll.Insert(
+		container.Container{ID: "c1", AppName: a1.Name, HostAddr: "server1"},
+		container.Container{ID: "c2", AppName: a2.Name, HostAddr: "server2"},
+		container.Container{ID: "c3", AppName: a2.Name, HostAddr: "server2"},
+	)
+	c.Assert(err, check.IsNil)
+}
+
+func (s *S) TestBinPackStrategyChooseNode(c *check.C) {
+	s.insertBinPackContainers(c)
+	nodes := []cluster.Node{
+		{Address: "http://server1:1234", Metadata: map[string]string{"memory": "1000"}},
+		{Address: "http://server2:1234", Metadata: map[string]string{"memory": "1000"}},
+		{Address: "http://server3:1234", Metadata: map[string]string{"memory": "1000"}},
+	}
+	scheduler := segregatedScheduler{provisioner: s.p, maxMemoryRatio: 0.8, TotalMemoryMetadata: "memory"}
+	node, err := binPackStrategy{}.chooseNode(&scheduler, nodes, "myapp", "web")
+	c.Assert(err, check.IsNil)
+	c.Assert(node, check.Equals, "http://server1:1234")
+	nodes[1].Metadata["memory"] = "200"
+	node, err = binPackStrategy{}.chooseNode(&scheduler, nodes, "myapp", "web")
+	c.Assert(err, check.IsNil)
+	c.Assert(node, check.Equals, "http://server2:1234")
+}
+
+func (s *S) TestBinPackStrategyChooseNodeAllOverMemoryLimit(c *check.C) {
+	s.insertBinPackContainers(c)
+	nodes := []cluster.Node{
+		{Address: "http://server1:1234", Metadata: map[string]string{"memory": "500"}},
+		{Address: "http://server2:1234", Metadata: map[string]string{"memory": "300"}},
+	}
+	scheduler := segregatedScheduler{provisioner: s.p, maxMemoryRatio: 0.8, TotalMemoryMetadata: "memory"}
+	node, err := binPackStrategy{}.chooseNode(&scheduler, nodes, "myapp", "web")
+	c.Assert(err, check.IsNil)
+	c.Assert(node, check.Equals, "http://server2:1234")
+}
+
+func (s *S) TestBinPackStrategyChooseNodeIgnoresNodesWithoutTotalMemory(c *check.C) {
+	s.insertBinPackContainers(c)
+	nodes := []cluster.Node{
+		{Address: "http://server1:1234"},
+		{Address: "http://server2:1234", Metadata: map[string]string{"memory": "1000"}},
+		{Address: "http://server3:1234", Metadata: map[string]string{"memory": "1000"}},
+	}
+	scheduler := segregatedScheduler{provisioner: s.p, maxMemoryRatio: 0.8, TotalMemoryMetadata: "memory"}
+	node, err := binPackStrategy{}.chooseNode(&scheduler, nodes, "myapp", "web")
+	c.Assert(err, check.IsNil)
+	c.Assert(node, check.Equals, "http://server2:1234")
+}
+
+func (s *S) TestBinPackStrategyRemovalOrderNodesWithoutTotalMemoryLast(c *check.C) {
+	s.insertBinPackContainers(c)
+	oldScheduler := s.p.scheduler
+	s.p.scheduler = &segregatedScheduler{provisioner: s.p, TotalMemoryMetadata: "memory"}
+	defer func() { s.p.scheduler = oldScheduler }()
+	nodes := []*cluster.Node{
+		{Address: "http://server1:1234"},
+		{Address: "http://server2:1234", Metadata: map[string]string{"memory": "1000"}},
+		{Address: "http://server3:1234", Metadata: map[string]string{"memory": "1000"}},
+	}
+	ordered, err := binPackStrategy{}.removalOrder(s.p, nodes)
+	c.Assert(err, check.IsNil)
+	c.Assert(ordered, check.DeepEquals, []*cluster.Node{nodes[2], nodes[1], nodes[0]})
+}
+
+func (s *S) TestBinPackStrategyChooseNodeWithoutMemoryAwareness(c *check.C) {
+	s.insertBinPackContainers(c)
+	nodes := []cluster.Node{
+		{Address: "http://server1:1234"},
+		{Address: "http://server3:1234"},
+	}
+	scheduler := segregatedScheduler{provisioner: s.p}
+	node, err := binPackStrategy{}.chooseNode(&scheduler, nodes, "myapp", "web")
+	c.Assert(err, check.IsNil)
+	c.Assert(node, check.Equals, "http://server3:1234")
+}
+
+func (s *S) TestBinPackStrategyRemovalOrder(c *check.C) {
+	s.insertBinPackContainers(c)
+	nodes := []*cluster.Node{
+		{Address: "http://server1:1234"},
+		{Address: "http://server2:1234"},
+		{Address: "http://server3:1234"},
+	}
+	ordered, err := binPackStrategy{}.removalOrder(s.p, nodes)
+	c.Assert(err, check.IsNil)
+	c.Assert(ordered, check.DeepEquals, []*cluster.Node{nodes[2], nodes[1], nodes[0]})
+	ordered, err = spreadStrategy{}.removalOrder(s.p, nodes)
+	c.Assert(err, check.IsNil)
+	c.Assert(ordered, check.DeepEquals, nodes)
+}
+
+func (s *S) TestChooseNodeForRemovalBinPack(c *check.C) {
+	s.insertBinPackContainers(c)
+	conf := schedulerConfig{Strategy: binPackStrategyName}
+	err := conf.save("pool1")
+	c.Assert(err, check.IsNil)
+	nodes := []*cluster.Node{
+		{Address: "http://server1:1234", Metadata: map[string]string{"pool": "pool1"}},
+		{Address: "http://server2:1234", Metadata: map[string]string{"pool": "pool1"}},
+		{Address: "http://server3:1234", Metadata: map[string]string{"pool": "pool1"}},
+	}
+	chosen, err := s.p.chooseNodeForRemoval(nodes, 1)
+	c.Assert(err, check.IsNil)
+	c.Assert(chosen, check.HasLen, 1)
+	c.Assert(chosen[0].Address, check.Equals, "http://server3:1234")
+	coll := s.p.Collection()
+	defer coll.Close()
+	err = coll.Remove(bson.M{"id": "c1"})
+	c.Assert(err, check.IsNil)
+	chosen, err = s.p.chooseNodeForRemoval(nodes, 2)
+	c.Assert(err, check.IsNil)
+	c.Assert(chosen, check.HasLen, 2)
+	c.Assert(chosen[0].Address, check.Equals, "http://server3:1234")
+	c.Assert(chosen[1].Address, check.Equals, "http://server1:1234")
+}
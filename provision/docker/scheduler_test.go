@@ -19,6 +19,7 @@ import (
 	"github.com/tsuru/tsuru/log"
 	"github.com/tsuru/tsuru/provision"
 	"github.com/tsuru/tsuru/provision/docker/container"
+	"github.com/tsuru/tsuru/provision/docker/nodestate"
 	"gopkg.in/check.v1"
 	"gopkg.in/mgo.v2/bson"
 )
@@ -80,6 +81,41 @@ func (s *S) TestSchedulerSchedule(c *check.C) {
 	c.Check(node.Address, check.Equals, localURL)
 }
 
+func (s *S) TestSchedulerScheduleIgnoresNodesUnderMaintenance(c *check.C) {
+	a1 := app.App{Name: "impius", Teams: []string{"tsuruteam"}, Pool: "pool1"}
+	err := s.storage.Apps().Insert(a1)
+	c.Assert(err, check.IsNil)
+	defer s.storage.Apps().Remove(bson.M{"name": a1.Name})
+	err = provision.AddPool(provision.AddPoolOptions{Name: "pool1"})
+	c.Assert(err, check.IsNil)
+	defer provision.RemovePool("pool1")
+	scheduler := segregatedScheduler{provisioner: s.p}
+	clusterInstance, err := cluster.New(&scheduler, &cluster.MapStorage{}, "")
+	c.Assert(err, check.IsNil)
+	s.p.cluster = clusterInstance
+	err = clusterInstance.Register(cluster.Node{
+		Address:  "http://server1:1234",
+		Metadata: map[string]string{"pool": "pool1", nodestate.MetadataKey: nodestate.Cordoned},
+	})
+	c.Assert(err, check.IsNil)
+	err = clusterInstance.Register(cluster.Node{
+		Address:  "http://server2:1234",
+		Metadata: map[string]string{"pool": "pool1", nodestate.MetadataKey: nodestate.Draining},
+	})
+	c.Assert(err, check.IsNil)
+	schedOpts := &container.SchedulerOpts{AppName: a1.Name, ProcessName: "web"}
+	_, err = scheduler.Schedule(clusterInstance, docker.CreateContainerOptions{Name: "cont1"}, schedOpts)
+	c.Assert(err, check.DeepEquals, &container.SchedulerError{Base: errNoSchedulableNodes})
+	err = clusterInstance.Register(cluster.Node{
+		Address:  "http://server3:1234",
+		Metadata: map[string]string{"pool": "pool1"},
+	})
+	c.Assert(err, check.IsNil)
+	node, err := scheduler.Schedule(clusterInstance, docker.CreateContainerOptions{Name: "cont1"}, schedOpts)
+	c.Assert(err, check.IsNil)
+	c.Assert(node.Address, check.Equals, "http://server3:1234")
+}
+
 func (s *S) TestSchedulerScheduleByTeamOwner(c *check.C) {
 	a1 := app.App{Name: "impius", Teams: []string{}, TeamOwner: "tsuruteam"}
 	cont1 := container.Container{ID: "1", Name: "impius1", AppName: a1.Name}
@@ -488,7 +524,7 @@ func (s *S) TestChooseNodeDistributesNodesEqually(c *check.C) {
 			cont := container.Container{ID: string(i), Name: fmt.Sprintf("unit%d", i), AppName: "coolapp9"}
 			insertErr := contColl.Insert(cont)
 			c.Assert(insertErr, check.IsNil)
-			node, insertErr := sched.chooseNodeToAdd(nodes, cont.Name, "coolapp9", "web")
+			node, insertErr := sched.chooseNodeToAdd(nodes, cont.Name, "coolapp9", "web", "")
 			c.Assert(insertErr, check.IsNil)
 			c.Assert(node, check.NotNil)
 		}(i)
@@ -536,7 +572,7 @@ func (s *S) TestChooseNodeDistributesNodesEquallyDifferentApps(c *check.C) {
 			cont := container.Container{ID: string(i), Name: fmt.Sprintf("unit%d", i), AppName: "oblivion", ProcessName: "web"}
 			insertErr := contColl.Insert(cont)
 			c.Assert(insertErr, check.IsNil)
-			node, insertErr := sched.chooseNodeToAdd(nodes, cont.Name, "oblivion", "web")
+			node, insertErr := sched.chooseNodeToAdd(nodes, cont.Name, "oblivion", "web", "")
 			c.Assert(insertErr, check.IsNil)
 			c.Assert(node, check.NotNil)
 		}(i)
@@ -580,7 +616,7 @@ func (s *S) TestChooseNodeDistributesNodesEquallyDifferentProcesses(c *check.C)
 			cont := container.Container{ID: string(i), Name: fmt.Sprintf("unit%d", i), AppName: "skyrim", ProcessName: "worker"}
 			insertErr := contColl.Insert(cont)
 			c.Assert(insertErr, check.IsNil)
-			node, insertErr := sched.chooseNodeToAdd(nodes, cont.Name, "skyrim", "worker")
+			node, insertErr := sched.chooseNodeToAdd(nodes, cont.Name, "skyrim", "worker", "")
 			c.Assert(insertErr, check.IsNil)
 			c.Assert(node, check.NotNil)
 		}(i)
@@ -621,7 +657,7 @@ func (s *S) TestChooseNodeDistributesNodesConsideringMetadata(c *check.C) {
 		cont := container.Container{Name: fmt.Sprintf("unit%d", i), AppName: app, ProcessName: process}
 		err := contColl.Insert(cont)
 		c.Assert(err, check.IsNil)
-		node, err := sched.chooseNodeToAdd(nodes, cont.Name, app, process)
+		node, err := sched.chooseNodeToAdd(nodes, cont.Name, app, process, "")
 		c.Assert(err, check.IsNil)
 		c.Assert(node, check.Not(check.Equals), "")
 	}
@@ -83,6 +83,7 @@ func (s *S) SetUpSuite(c *check.C) {
 	config.Set("queue:mongo-database", "queue_provision_docker_tests")
 	config.Set("queue:mongo-polling-interval", 0.01)
 	config.Set("routers:fake:type", "fake")
+	config.Set("routers:fake-hc:type", "fake-hc")
 	config.Set("repo-manager", "fake")
 	config.Set("docker:registry-max-try", 1)
 	config.Set("auth:hash-cost", bcrypt.MinCost)
@@ -134,6 +135,7 @@ func (s *S) SetUpTest(c *check.C) {
 	err = clearClusterStorage(s.clusterSess)
 	c.Assert(err, check.IsNil)
 	routertest.FakeRouter.Reset()
+	routertest.HCRouter.Reset()
 	opts := provision.AddPoolOptions{Name: "test-default", Default: true}
 	err = provision.AddPool(opts)
 	c.Assert(err, check.IsNil)
@@ -64,6 +64,8 @@ func ParseStatus(status string) (Status, error) {
 		return StatusStopped, nil
 	case "asleep":
 		return StatusAsleep, nil
+	case "crashloop":
+		return StatusCrashLoop, nil
 	}
 	return Status(""), ErrInvalidStatus
 }
@@ -116,6 +118,11 @@ const (
 
 	// StatusAsleep is for cases where the unit has been asleep.
 	StatusAsleep = Status("asleep")
+
+	// StatusCrashLoop is for units that had to be healed too many times in a
+	// row without ever reporting a successful status. They won't be healed
+	// again until the app is deployed or restarted.
+	StatusCrashLoop = Status("crashloop")
 )
 
 // Unit represents a provision unit. Can be a machine, container or anything
@@ -155,6 +162,14 @@ type Named interface {
 	GetName() string
 }
 
+// AppRouter is a router in which an app is exposed, along with the options
+// used when creating the backend of the app in it.
+type AppRouter struct {
+	Name    string            `json:"name"`
+	Opts    map[string]string `json:"opts"`
+	Address string            `json:"address" bson:"-"`
+}
+
 // App represents a tsuru app.
 //
 // It contains only relevant information for provisioning.
@@ -207,7 +222,9 @@ type App interface {
 
 	GetLock() AppLock
 
-	GetRouterOpts() map[string]string
+	// GetRouters returns all the routers of the app, the first one being the
+	// router returned by GetRouter.
+	GetRouters() ([]AppRouter, error)
 }
 
 type AppLock interface {
@@ -256,6 +273,13 @@ type ImageDeployer interface {
 	ImageDeploy(app App, image string, evt *event.Event) (string, error)
 }
 
+// ImagePromoter is a provisioner that can deploy the application using an
+// image previously generated for another application, without rebuilding
+// it. An empty image means the latest valid image of the source application.
+type ImagePromoter interface {
+	PromoteDeploy(app App, source App, image string, evt *event.Event) (string, error)
+}
+
 // Provisioner is the basic interface of this package.
 //
 // Any tsuru provisioner must implement this interface in order to provision
@@ -376,9 +400,18 @@ type Node interface {
 }
 
 type NodeStatusData struct {
-	Addrs  []string
-	Units  []UnitStatusData
-	Checks []NodeCheckResult
+	Addrs   []string
+	Units   []UnitStatusData
+	Checks  []NodeCheckResult
+	Metrics *NodeMetrics
+}
+
+// NodeMetrics holds resource usage data optionally reported by the agent
+// running in the node.
+type NodeMetrics struct {
+	// CpuUsage is the fraction of the node total cpu in use, between 0.0 and
+	// 1.0.
+	CpuUsage float64
 }
 
 type UnitStatusData struct {
@@ -485,7 +518,48 @@ func (hc TsuruYamlHealthcheck) ToRouterHC() router.HealthcheckData {
 	}
 }
 
+// TsuruYamlPlacementRules holds the constraints used when choosing the node
+// where a unit will run.
+type TsuruYamlPlacementRules struct {
+	// NodeSelector lists metadata values that a node must have.
+	NodeSelector map[string]string `json:"node_selector" bson:"node_selector"`
+	// AntiAffinity lists apps whose units must not share nodes with the units
+	// of this app.
+	AntiAffinity []string `json:"anti_affinity" bson:"anti_affinity"`
+	// Spread is a node metadata key, such as zone, across which units must be
+	// evenly distributed.
+	Spread string
+}
+
+// TsuruYamlPlacement holds the placement rules for an app, optionally
+// overridden for specific processes.
+type TsuruYamlPlacement struct {
+	TsuruYamlPlacementRules `bson:",inline"`
+	Processes               map[string]TsuruYamlPlacementRules
+}
+
+// ForProcess returns the placement rules for the given process, fields set in
+// the process rules take precedence over the app rules.
+func (p TsuruYamlPlacement) ForProcess(process string) TsuruYamlPlacementRules {
+	rules := p.TsuruYamlPlacementRules
+	procRules, ok := p.Processes[process]
+	if !ok {
+		return rules
+	}
+	if procRules.NodeSelector != nil {
+		rules.NodeSelector = procRules.NodeSelector
+	}
+	if procRules.AntiAffinity != nil {
+		rules.AntiAffinity = procRules.AntiAffinity
+	}
+	if procRules.Spread != "" {
+		rules.Spread = procRules.Spread
+	}
+	return rules
+}
+
 type TsuruYamlData struct {
 	Hooks       TsuruYamlHooks
 	Healthcheck TsuruYamlHealthcheck
+	Placement   TsuruYamlPlacement
 }
@@ -87,6 +87,7 @@ func (ProvisionSuite) TestParseStatus(c *check.C) {
 		{"stopped", StatusStopped, nil},
 		{"asleep", StatusAsleep, nil},
 		{"starting", StatusStarting, nil},
+		{"crashloop", StatusCrashLoop, nil},
 		{"something", Status(""), ErrInvalidStatus},
 		{"otherthing", Status(""), ErrInvalidStatus},
 	}
@@ -123,3 +124,28 @@ func (ProvisionSuite) TestUnitNotFoundError(c *check.C) {
 	var err error = &UnitNotFoundError{ID: "some unit"}
 	c.Assert(err.Error(), check.Equals, `unit "some unit" not found`)
 }
+
+func (ProvisionSuite) TestTsuruYamlPlacementForProcess(c *check.C) {
+	placement := TsuruYamlPlacement{
+		TsuruYamlPlacementRules: TsuruYamlPlacementRules{
+			NodeSelector: map[string]string{"disk": "ssd"},
+			AntiAffinity: []string{"otherapp"},
+			Spread:       "zone",
+		},
+		Processes: map[string]TsuruYamlPlacementRules{
+			"worker": {NodeSelector: map[string]string{"disk": "hdd"}},
+			"cron":   {AntiAffinity: []string{}, Spread: "rack"},
+		},
+	}
+	c.Assert(placement.ForProcess("web"), check.DeepEquals, placement.TsuruYamlPlacementRules)
+	c.Assert(placement.ForProcess("worker"), check.DeepEquals, TsuruYamlPlacementRules{
+		NodeSelector: map[string]string{"disk": "hdd"},
+		AntiAffinity: []string{"otherapp"},
+		Spread:       "zone",
+	})
+	c.Assert(placement.ForProcess("cron"), check.DeepEquals, TsuruYamlPlacementRules{
+		NodeSelector: map[string]string{"disk": "ssd"},
+		AntiAffinity: []string{},
+		Spread:       "rack",
+	})
+}
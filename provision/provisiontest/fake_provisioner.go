@@ -56,6 +56,7 @@ type FakeApp struct {
 	UpdatePlatform bool
 	TeamOwner      string
 	Teams          []string
+	Routers        []provision.AppRouter
 	quota.Quota
 }
 
@@ -83,8 +84,8 @@ func NewFakeApp(name, platform string, units int) *FakeApp {
 	return &app
 }
 
-func (a *FakeApp) GetRouterOpts() map[string]string {
-	return nil
+func (a *FakeApp) GetRouters() ([]provision.AppRouter, error) {
+	return append([]provision.AppRouter{{Name: "fake"}}, a.Routers...), nil
 }
 
 func (a *FakeApp) GetMemory() int64 {
@@ -616,6 +617,32 @@ func (p *FakeProvisioner) ImageDeploy(app provision.App, img string, evt *event.
 	return img, nil
 }
 
+func (p *FakeProvisioner) PromoteDeploy(app, source provision.App, img string, evt *event.Event) (string, error) {
+	if err := p.getError("PromoteDeploy"); err != nil {
+		return "", err
+	}
+	validImgs, err := p.ValidAppImages(source.GetName())
+	if err != nil {
+		return "", err
+	}
+	if img == "" && len(validImgs) > 0 {
+		img = validImgs[len(validImgs)-1]
+	}
+	if !stringInArray(img, validImgs) {
+		return "", fmt.Errorf("Image %q not found in app %q", img, source.GetName())
+	}
+	p.mut.Lock()
+	defer p.mut.Unlock()
+	pApp, ok := p.apps[app.GetName()]
+	if !ok {
+		return "", errNotProvisioned
+	}
+	pApp.image = img
+	evt.Write([]byte("Promote deploy called"))
+	p.apps[app.GetName()] = pApp
+	return img, nil
+}
+
 func (p *FakeProvisioner) Rollback(app provision.App, img string, evt *event.Event) (string, error) {
 	if err := p.getError("ImageDeploy"); err != nil {
 		return "", err
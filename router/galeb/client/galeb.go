@@ -252,6 +252,42 @@ func (c *GalebClient) AddRuleToID(name, poolID string) (string, error) {
 	return c.doCreateResource("/rule", &params)
 }
 
+func (c *GalebClient) AddPathRuleToID(name, poolID, match string, order int) (string, error) {
+	var params Rule
+	c.fillDefaultRuleValues(&params)
+	params.Name = name
+	params.BackendPool = poolID
+	params.Properties.Match = match
+	params.Default = false
+	params.Order = order
+	return c.doCreateResource("/rule", &params)
+}
+
+func (c *GalebClient) AddPathRule(ruleName, poolName, virtualHostName, match string, order int) error {
+	poolID, err := c.findItemByName("pool", poolName)
+	if err != nil {
+		return err
+	}
+	virtualHostID, err := c.findItemByName("virtualhost", virtualHostName)
+	if err != nil {
+		return err
+	}
+	ruleID, err := c.AddPathRuleToID(ruleName, poolID, match, order)
+	if err != nil {
+		return err
+	}
+	err = c.SetRuleVirtualHostIDs(ruleID, virtualHostID)
+	if err != nil {
+		// The rule may have been linked before the failure, so it's unlinked
+		// before being removed. Errors are ignored as the original error is
+		// the one worth returning.
+		c.RemoveRuleVirtualHostByID(ruleID, virtualHostID)
+		c.removeResource(ruleID)
+		return err
+	}
+	return nil
+}
+
 func (c *GalebClient) SetRuleVirtualHostIDs(ruleID, virtualHostID string) error {
 	path := fmt.Sprintf("%s/parents", strings.TrimPrefix(ruleID, c.ApiUrl))
 	rsp, err := c.doRequest("PATCH", path, virtualHostID)
@@ -375,6 +411,28 @@ func (c *GalebClient) FindTargetsByParent(poolName string) ([]Target, error) {
 	return rspObj.Embedded.Targets, nil
 }
 
+func (c *GalebClient) FindRulesByVirtualHost(virtualHostName string) ([]Rule, error) {
+	path := fmt.Sprintf("/rule/search/findByParentName?name=%s&size=999999", virtualHostName)
+	rsp, err := c.doRequest("GET", path, nil)
+	if err != nil {
+		return nil, err
+	}
+	responseData, _ := ioutil.ReadAll(rsp.Body)
+	if rsp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GET /rule/search/findByParentName?name={parentName}: wrong status code: %d. content: %s", rsp.StatusCode, string(responseData))
+	}
+	var rspObj struct {
+		Embedded struct {
+			Rules []Rule `json:"rule"`
+		} `json:"_embedded"`
+	}
+	err = json.Unmarshal(responseData, &rspObj)
+	if err != nil {
+		return nil, fmt.Errorf("GET /rule/search/findByParentName?name={parentName}: unable to parse: %s: %s", string(responseData), err)
+	}
+	return rspObj.Embedded.Rules, nil
+}
+
 func (c *GalebClient) FindVirtualHostsByRule(ruleName string) ([]VirtualHost, error) {
 	ruleID, err := c.findItemByName("rule", ruleName)
 	if err != nil {
@@ -401,6 +459,31 @@ func (c *GalebClient) FindVirtualHostsByRule(ruleName string) ([]VirtualHost, er
 	return rspObj.Embedded.VirtualHosts, nil
 }
 
+func (c *GalebClient) FindPoolByRule(ruleName string) (*Pool, error) {
+	ruleID, err := c.findItemByName("rule", ruleName)
+	if err != nil {
+		return nil, err
+	}
+	path := fmt.Sprintf("%s/pool", strings.TrimPrefix(ruleID, c.ApiUrl))
+	rsp, err := c.doRequest("GET", path, nil)
+	if err != nil {
+		return nil, err
+	}
+	responseData, _ := ioutil.ReadAll(rsp.Body)
+	if rsp.StatusCode == http.StatusNotFound {
+		return nil, ErrItemNotFound
+	}
+	if rsp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GET /rule/{id}/pool: wrong status code: %d. content: %s", rsp.StatusCode, string(responseData))
+	}
+	var pool Pool
+	err = json.Unmarshal(responseData, &pool)
+	if err != nil {
+		return nil, fmt.Errorf("GET /rule/{id}/pool: unable to parse: %s: %s", string(responseData), err)
+	}
+	return &pool, nil
+}
+
 func (c *GalebClient) Healthcheck() error {
 	rsp, err := c.doRequest("GET", "/healthcheck", nil)
 	if err != nil {
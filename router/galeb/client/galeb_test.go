@@ -211,6 +211,77 @@ func (s *S) TestGalebAddRuleToID(c *check.C) {
 	c.Assert(fullId, check.Equals, "http://galeb.somewhere/api/rule/8")
 }
 
+func (s *S) TestGalebAddPathRuleToID(c *check.C) {
+	s.handler.RspHeader.Set("Location", "http://galeb.somewhere/api/rule/8")
+	s.handler.RspCode = http.StatusCreated
+	expected := Rule{
+		commonPostResponse: commonPostResponse{ID: 0, Name: "myrule"},
+		RuleType:           "ruletype1",
+		BackendPool:        "http://galeb.somewhere/api/target/9",
+		Default:            false,
+		Order:              98,
+		Properties: RuleProperties{
+			Match: "/billing/v2",
+		},
+	}
+	fullId, err := s.client.AddPathRuleToID("myrule", "http://galeb.somewhere/api/target/9", "/billing/v2", 98)
+	c.Assert(err, check.IsNil)
+	c.Assert(s.handler.Method, check.DeepEquals, []string{"POST"})
+	c.Assert(s.handler.Url, check.DeepEquals, []string{"/api/rule"})
+	var parsedParams Rule
+	err = json.Unmarshal(s.handler.Body[0], &parsedParams)
+	c.Assert(err, check.IsNil)
+	c.Assert(parsedParams, check.DeepEquals, expected)
+	c.Assert(fullId, check.Equals, "http://galeb.somewhere/api/rule/8")
+}
+
+func (s *S) TestGalebAddPathRuleRemovesRuleOnLinkFailure(c *check.C) {
+	s.handler.ConditionalContent["/api/pool/search/findByName?name=mypool"] = []string{
+		"200", fmt.Sprintf(`{
+		"_embedded": {
+			"pool": [
+				{
+					"_links": {
+						"self": {
+							"href": "%s/pool/9"
+						}
+					}
+				}
+			]
+		}
+	}`, s.client.ApiUrl)}
+	s.handler.ConditionalContent["/api/virtualhost/search/findByName?name=myvh"] = []string{
+		"200", fmt.Sprintf(`{
+		"_embedded": {
+			"virtualhost": [
+				{
+					"_links": {
+						"self": {
+							"href": "%s/virtualhost/2"
+						}
+					}
+				}
+			]
+		}
+	}`, s.client.ApiUrl)}
+	s.handler.ConditionalContent["/api/rule/8/parents"] = []string{"500", "link failed"}
+	s.handler.ConditionalContent["/api/rule/8/parents/2"] = []string{"204", ""}
+	s.handler.ConditionalContent["/api/rule/8"] = []string{"204", ""}
+	s.handler.RspHeader.Set("Location", s.client.ApiUrl+"/rule/8")
+	s.handler.RspCode = http.StatusCreated
+	err := s.client.AddPathRule("myrule", "mypool", "myvh", "/billing", 98)
+	c.Assert(err, check.ErrorMatches, "PATCH /rule/8/parents: invalid response code: 500: link failed")
+	c.Assert(s.handler.Method, check.DeepEquals, []string{"GET", "GET", "POST", "PATCH", "DELETE", "DELETE"})
+	c.Assert(s.handler.Url, check.DeepEquals, []string{
+		"/api/pool/search/findByName?name=mypool",
+		"/api/virtualhost/search/findByName?name=myvh",
+		"/api/rule",
+		"/api/rule/8/parents",
+		"/api/rule/8/parents/2",
+		"/api/rule/8",
+	})
+}
+
 func (s *S) TestGalebRemoveBackendByID(c *check.C) {
 	s.handler.RspCode = http.StatusNoContent
 	err := s.client.RemoveBackendByID("/target/mybackendID")
@@ -480,6 +551,77 @@ func (s *S) TestFindVirtualHostsByRule(c *check.C) {
 	})
 }
 
+func (s *S) TestFindPoolByRule(c *check.C) {
+	s.handler.ConditionalContent["/api/rule/search/findByName?name=myrule"] = []string{
+		"200", fmt.Sprintf(`{
+		"_embedded": {
+			"rule": [
+				{
+					"_links": {
+						"self": {
+							"href": "%s/rule/1"
+						}
+					}
+				}
+			]
+		}
+	}`, s.client.ApiUrl)}
+	s.handler.ConditionalContent["/api/rule/1/pool"] = []string{
+		"200", `{
+		"name": "mypool",
+		"_links": {
+			"self": {
+				"href": "http://galeb.somewhere/api/pool/2"
+			}
+		}
+	}`}
+	s.handler.RspCode = http.StatusOK
+	pool, err := s.client.FindPoolByRule("myrule")
+	c.Assert(err, check.IsNil)
+	c.Assert(pool.Name, check.Equals, "mypool")
+	c.Assert(pool.FullId(), check.Equals, "http://galeb.somewhere/api/pool/2")
+	c.Assert(s.handler.Method, check.DeepEquals, []string{"GET", "GET"})
+	c.Assert(s.handler.Url, check.DeepEquals, []string{
+		"/api/rule/search/findByName?name=myrule",
+		"/api/rule/1/pool",
+	})
+}
+
+func (s *S) TestFindRulesByVirtualHost(c *check.C) {
+	s.handler.ConditionalContent["/api/rule/search/findByParentName?name=api.example.com&size=999999"] = []string{
+		"200", `{
+		"_embedded": {
+			"rule": [
+				{
+					"name": "myrule",
+					"_links": {
+						"self": {
+							"href": "http://galeb.somewhere/api/rule/1"
+						}
+					}
+				}
+			]
+		}
+	}`}
+	s.handler.RspCode = http.StatusOK
+	rules, err := s.client.FindRulesByVirtualHost("api.example.com")
+	c.Assert(err, check.IsNil)
+	c.Assert(rules, check.DeepEquals, []Rule{
+		{
+			commonPostResponse: commonPostResponse{
+				Name: "myrule",
+				Links: linkData{
+					Self: hrefData{Href: "http://galeb.somewhere/api/rule/1"},
+				},
+			},
+		},
+	})
+	c.Assert(s.handler.Method, check.DeepEquals, []string{"GET"})
+	c.Assert(s.handler.Url, check.DeepEquals, []string{
+		"/api/rule/search/findByParentName?name=api.example.com&size=999999",
+	})
+}
+
 func (s *S) TestHealthcheck(c *check.C) {
 	s.handler.ConditionalContent["/api/healthcheck"] = "WORKING"
 	s.handler.RspCode = 200
@@ -5,6 +5,7 @@
 package galeb
 
 import (
+	"crypto/md5"
 	"fmt"
 	"net/url"
 	"strings"
@@ -85,6 +86,10 @@ func (r *galebRouter) ruleName(base string) string {
 	return fmt.Sprintf("tsuru-rootrule-%s-%s", r.routerName, base)
 }
 
+func (r *galebRouter) pathRuleName(mount router.Mount) string {
+	return fmt.Sprintf("tsuru-pathrule-%s-%x", r.routerName, md5.Sum([]byte(mount.Domain+mount.Path)))
+}
+
 func (r *galebRouter) virtualHostName(base string) string {
 	return fmt.Sprintf("%s.%s", base, r.domain)
 }
@@ -250,6 +255,103 @@ func (r *galebRouter) Addr(name string) (string, error) {
 	return r.virtualHostName(backendName), nil
 }
 
+func (r *galebRouter) AddMount(name string, mount router.Mount) error {
+	backendName, err := router.Retrieve(name)
+	if err != nil {
+		return err
+	}
+	if mount.StripPrefix {
+		return router.ErrStripPrefixNotSupported
+	}
+	if !router.ValidCName(mount.Domain, r.domain) {
+		return router.ErrMountDomainNotAllowed
+	}
+	virtualHostID, err := r.client.AddVirtualHost(mount.Domain)
+	createdVirtualHost := err == nil
+	if err == galebClient.ErrItemAlreadyExists {
+		err = r.checkMountVirtualHost(mount.Domain)
+		if err != nil {
+			return err
+		}
+	} else if err != nil {
+		if virtualHostID != "" {
+			r.client.RemoveVirtualHostByID(virtualHostID)
+		}
+		return err
+	}
+	// Rules with lower order are evaluated first, so deeper paths must take
+	// precedence over their parents.
+	order := 100 - strings.Count(mount.Path, "/")
+	err = r.client.AddPathRule(r.pathRuleName(mount), r.poolName(backendName), mount.Domain, mount.Path, order)
+	if err != nil && createdVirtualHost {
+		rules, findErr := r.client.FindRulesByVirtualHost(mount.Domain)
+		if findErr == nil && len(rules) == 0 {
+			r.client.RemoveVirtualHostByID(virtualHostID)
+		}
+	}
+	if err == galebClient.ErrItemAlreadyExists {
+		return router.ErrMountExists
+	}
+	return err
+}
+
+// checkMountVirtualHost returns ErrMountDomainInUse unless the existing
+// virtual host of the domain was created by mounts, having only path rules of
+// this router.
+func (r *galebRouter) checkMountVirtualHost(domain string) error {
+	rules, err := r.client.FindRulesByVirtualHost(domain)
+	if err != nil {
+		return err
+	}
+	if len(rules) == 0 {
+		return router.ErrMountDomainInUse
+	}
+	prefix := fmt.Sprintf("tsuru-pathrule-%s-", r.routerName)
+	for _, rule := range rules {
+		if !strings.HasPrefix(rule.Name, prefix) {
+			return router.ErrMountDomainInUse
+		}
+	}
+	return nil
+}
+
+func (r *galebRouter) RemoveMount(name string, mount router.Mount) error {
+	backendName, err := router.Retrieve(name)
+	if err != nil {
+		return err
+	}
+	rule := r.pathRuleName(mount)
+	pool, err := r.client.FindPoolByRule(rule)
+	if err == galebClient.ErrItemNotFound {
+		return router.ErrMountNotFound
+	}
+	if err != nil {
+		return err
+	}
+	if pool.Name != r.poolName(backendName) {
+		return router.ErrMountNotFound
+	}
+	err = r.client.RemoveRuleVirtualHost(rule, mount.Domain)
+	if err == galebClient.ErrItemNotFound {
+		return router.ErrMountNotFound
+	}
+	if err != nil {
+		return err
+	}
+	err = r.client.RemoveRule(rule)
+	if err != nil {
+		return err
+	}
+	rules, err := r.client.FindRulesByVirtualHost(mount.Domain)
+	if err != nil {
+		return err
+	}
+	if len(rules) == 0 {
+		return r.client.RemoveVirtualHost(mount.Domain)
+	}
+	return nil
+}
+
 func (r *galebRouter) Swap(backend1, backend2 string, cnameOnly bool) error {
 	return router.Swap(r, backend1, backend2, cnameOnly)
 }
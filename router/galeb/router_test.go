@@ -19,6 +19,7 @@ import (
 	"github.com/tsuru/config"
 	"github.com/tsuru/tsuru/db"
 	"github.com/tsuru/tsuru/db/dbtest"
+	"github.com/tsuru/tsuru/router"
 	galebClient "github.com/tsuru/tsuru/router/galeb/client"
 	"github.com/tsuru/tsuru/router/routertest"
 	"gopkg.in/check.v1"
@@ -66,7 +67,9 @@ func NewFakeGalebServer() (*fakeGalebServer, error) {
 	r.HandleFunc("/api/rule/{id}/parents", server.addRuleVirtualhost).Methods("PATCH")
 	r.HandleFunc("/api/rule/{id}/parents", server.findVirtualhostByRule).Methods("GET")
 	r.HandleFunc("/api/rule/{id}/parents/{vhid}", server.destroyRuleVirtualhost).Methods("DELETE")
+	r.HandleFunc("/api/rule/{id}/pool", server.findPoolByRule).Methods("GET")
 	r.HandleFunc("/api/target/search/findByParentName", server.findTargetsByParent).Methods("GET")
+	r.HandleFunc("/api/rule/search/findByParentName", server.findRulesByParent).Methods("GET")
 	server.router = r
 	return server, nil
 }
@@ -136,6 +139,20 @@ func (s *fakeGalebServer) findTargetsByParent(w http.ResponseWriter, r *http.Req
 	json.NewEncoder(w).Encode(makeSearchRsp("target", ret...))
 }
 
+func (s *fakeGalebServer) findRulesByParent(w http.ResponseWriter, r *http.Request) {
+	parentName := r.URL.Query().Get("name")
+	var ret []interface{}
+	for ruleId, vhIds := range s.ruleVh {
+		for _, vhId := range vhIds {
+			vh, ok := s.virtualhosts[vhId].(*galebClient.VirtualHost)
+			if ok && vh.Name == parentName {
+				ret = append(ret, s.rules[ruleId])
+			}
+		}
+	}
+	json.NewEncoder(w).Encode(makeSearchRsp("rule", ret...))
+}
+
 func (s *fakeGalebServer) destroyItem(w http.ResponseWriter, r *http.Request) {
 	id := mux.Vars(r)["id"]
 	item := mux.Vars(r)["item"]
@@ -202,6 +219,10 @@ func (s *fakeGalebServer) createRule(w http.ResponseWriter, r *http.Request) {
 	var rule galebClient.Rule
 	rule.Status = "OK"
 	json.NewDecoder(r.Body).Decode(&rule)
+	if len(s.findItemByName("rule", rule.Name)) > 0 {
+		w.WriteHeader(http.StatusConflict)
+		return
+	}
 	s.idCounter++
 	rule.ID = s.idCounter
 	rule.Links.Self.Href = fmt.Sprintf("http://%s%s/%d", r.Host, r.URL.String(), rule.ID)
@@ -263,6 +284,22 @@ func (s *fakeGalebServer) findVirtualhostByRule(w http.ResponseWriter, r *http.R
 	json.NewEncoder(w).Encode(makeSearchRsp("virtualhost", ret...))
 }
 
+func (s *fakeGalebServer) findPoolByRule(w http.ResponseWriter, r *http.Request) {
+	rule, ok := s.rules[mux.Vars(r)["id"]].(*galebClient.Rule)
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	for _, item := range s.pools {
+		pool := item.(*galebClient.Pool)
+		if pool.FullId() == rule.BackendPool {
+			json.NewEncoder(w).Encode(pool)
+			return
+		}
+	}
+	w.WriteHeader(http.StatusNotFound)
+}
+
 func (s *fakeGalebServer) createVirtualhost(w http.ResponseWriter, r *http.Request) {
 	var virtualhost galebClient.VirtualHost
 	virtualhost.Status = "OK"
@@ -316,3 +353,79 @@ func init() {
 	}
 	check.Suite(suite)
 }
+
+type S struct {
+	server     *httptest.Server
+	fakeServer *fakeGalebServer
+	router     router.Router
+}
+
+var _ = check.Suite(&S{})
+
+func (s *S) SetUpTest(c *check.C) {
+	config.Set("routers:galeb:username", "myusername")
+	config.Set("routers:galeb:password", "mypassword")
+	config.Set("routers:galeb:domain", "galeb.com")
+	config.Set("routers:galeb:type", "galeb")
+	config.Set("database:url", "127.0.0.1:27017")
+	config.Set("database:name", "router_galeb_tests")
+	var err error
+	s.fakeServer, err = NewFakeGalebServer()
+	c.Assert(err, check.IsNil)
+	s.server = httptest.NewServer(s.fakeServer)
+	config.Set("routers:galeb:api-url", s.server.URL+"/api")
+	s.router, err = createRouter("galeb", "routers:galeb")
+	c.Assert(err, check.IsNil)
+	conn, err := db.Conn()
+	c.Assert(err, check.IsNil)
+	defer conn.Close()
+	dbtest.ClearAllCollections(conn.Collection("router_galeb_tests").Database)
+}
+
+func (s *S) TearDownTest(c *check.C) {
+	s.server.Close()
+}
+
+func (s *S) TestAddMountCNameDomain(c *check.C) {
+	err := s.router.AddBackend("myapp")
+	c.Assert(err, check.IsNil)
+	err = s.router.AddBackend("otherapp")
+	c.Assert(err, check.IsNil)
+	cnameRouter := s.router.(router.CNameRouter)
+	err = cnameRouter.SetCName("my.host.com", "myapp")
+	c.Assert(err, check.IsNil)
+	pathRouter := s.router.(router.PathRouter)
+	err = pathRouter.AddMount("otherapp", router.Mount{Domain: "my.host.com", Path: "/billing"})
+	c.Assert(err, check.Equals, router.ErrMountDomainInUse)
+	c.Assert(s.fakeServer.findItemByName("virtualhost", "my.host.com"), check.HasLen, 1)
+	c.Assert(s.fakeServer.rules, check.HasLen, 2)
+	err = cnameRouter.UnsetCName("my.host.com", "myapp")
+	c.Assert(err, check.IsNil)
+	err = s.router.RemoveBackend("myapp")
+	c.Assert(err, check.IsNil)
+	err = s.router.RemoveBackend("otherapp")
+	c.Assert(err, check.IsNil)
+}
+
+func (s *S) TestAddMountSharedDomain(c *check.C) {
+	err := s.router.AddBackend("myapp")
+	c.Assert(err, check.IsNil)
+	err = s.router.AddBackend("otherapp")
+	c.Assert(err, check.IsNil)
+	pathRouter := s.router.(router.PathRouter)
+	billing := router.Mount{Domain: "api.example.com", Path: "/billing"}
+	users := router.Mount{Domain: "api.example.com", Path: "/users"}
+	err = pathRouter.AddMount("myapp", billing)
+	c.Assert(err, check.IsNil)
+	err = pathRouter.AddMount("otherapp", users)
+	c.Assert(err, check.IsNil)
+	err = pathRouter.RemoveMount("myapp", billing)
+	c.Assert(err, check.IsNil)
+	err = pathRouter.RemoveMount("otherapp", users)
+	c.Assert(err, check.IsNil)
+	c.Assert(s.fakeServer.virtualhosts, check.HasLen, 2)
+	err = s.router.RemoveBackend("myapp")
+	c.Assert(err, check.IsNil)
+	err = s.router.RemoveBackend("otherapp")
+	c.Assert(err, check.IsNil)
+}
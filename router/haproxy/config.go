@@ -0,0 +1,223 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package haproxy
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"github.com/tsuru/tsuru/router"
+)
+
+// unusedSlotAddress is the address of the server slots not assigned to any
+// route, they are kept in maintenance mode until a route is added.
+const unusedSlotAddress = "127.0.0.1:1"
+
+const defaultConfigTemplate = `# This file is generated by tsuru, changes will be overwritten.
+global
+    stats socket {{.StatsSocket}} mode 600 level admin
+    stats timeout 2m
+
+defaults
+    mode http
+    option httplog
+    option forwardfor
+    timeout connect 5s
+    timeout client 60s
+    timeout server 60s
+
+frontend tsuru
+    bind {{.Bind}}
+{{- range .Backends}}
+    acl host_{{.Name}} req.hdr(host),field(1,:) -i{{range .Hosts}} {{.}}{{end}}
+    use_backend {{.Name}} if host_{{.Name}}
+{{- end}}
+{{range .Backends}}
+backend {{.Name}}
+{{- if .MaintenancePage}}
+    http-request return status 503 content-type text/html file {{.MaintenancePage}}
+{{- end}}
+{{- if .Deny}}
+    http-request deny if { src{{range .Deny}} {{.}}{{end}} }
+{{- end}}
+{{- if .Allow}}
+    http-request deny unless { src{{range .Allow}} {{.}}{{end}} }
+{{- end}}
+{{- if .RateLimit}}
+    stick-table type ipv6 size 100k expire 10s store http_req_rate(1s)
+    http-request track-sc0 src
+    http-request deny deny_status 429 if { sc_http_req_rate(0) gt {{.RateLimit}} }
+{{- end}}
+{{- with .Healthcheck}}
+    option httpchk GET {{quote .Path}}
+{{- if .Body}}
+    http-check expect string {{quote .Body}}
+{{- else if .Status}}
+    http-check expect status {{.Status}}
+{{- end}}
+{{- end}}
+{{- range .Servers}}
+    server {{.Name}} {{.Address}}{{if .Check}} check{{end}}{{if not .Enabled}} disabled{{end}}
+{{- end}}
+{{end}}`
+
+// configData is the data available to the config template.
+type configData struct {
+	Bind        string
+	StatsSocket string
+	Domain      string
+	Backends    []configBackend
+}
+
+// configBackend is a backend in the config. RateLimit is the number of
+// requests accepted from each client address within a second, including the
+// burst of the access policy. MaintenancePage is the path of the page served
+// to all requests while the backend is in maintenance.
+type configBackend struct {
+	Name            string
+	Hosts           []string
+	Healthcheck     *router.HealthcheckData
+	Servers         []configServer
+	Allow           []string
+	Deny            []string
+	RateLimit       int
+	MaintenancePage string
+}
+
+type configServer struct {
+	Name    string
+	Address string
+	Enabled bool
+	Check   bool
+}
+
+func backendName(name string) string {
+	return "tsuru_" + name
+}
+
+// serverName returns the name of a server slot in the runtime API format,
+// <backend>/<server>.
+func serverName(name string, slot int) string {
+	return fmt.Sprintf("%s/srv%d", backendName(name), slot)
+}
+
+// maintenancePagePath returns the path of the maintenance page of a backend,
+// kept in the maintenance directory next to the config file.
+func (r *haproxyRouter) maintenancePagePath(name string) string {
+	return filepath.Join(filepath.Dir(r.configFile), "maintenance", backendName(name)+".html")
+}
+
+func (r *haproxyRouter) configData(backends []backend) configData {
+	data := configData{
+		Bind:        r.bind,
+		StatsSocket: r.socket,
+		Domain:      r.domain,
+		Backends:    make([]configBackend, len(backends)),
+	}
+	if !strings.HasPrefix(r.socket, "/") {
+		data.StatsSocket = "ipv4@" + r.socket
+	}
+	for i, b := range backends {
+		cb := configBackend{
+			Name:    backendName(b.Name),
+			Hosts:   append([]string{r.hostname(b.Name)}, b.CNames...),
+			Servers: make([]configServer, b.Slots),
+		}
+		if b.AccessPolicy != nil {
+			cb.Allow = b.AccessPolicy.Allow
+			cb.Deny = b.AccessPolicy.Deny
+			if b.AccessPolicy.RateLimit > 0 {
+				cb.RateLimit = b.AccessPolicy.RateLimit + b.AccessPolicy.RateBurst
+			}
+		}
+		if b.Maintenance {
+			cb.MaintenancePage = r.maintenancePagePath(b.Name)
+		}
+		check := false
+		if b.Healthcheck != nil && b.Healthcheck.Path != "" {
+			cb.Healthcheck = b.Healthcheck
+			check = true
+		}
+		for j := range cb.Servers {
+			cb.Servers[j] = configServer{
+				Name:    fmt.Sprintf("srv%d", j+1),
+				Address: unusedSlotAddress,
+				Check:   check,
+			}
+		}
+		for _, s := range b.Servers {
+			if s.Slot < 1 || s.Slot > len(cb.Servers) {
+				continue
+			}
+			u, err := url.Parse(s.Address)
+			if err != nil {
+				continue
+			}
+			host, port := hostPort(u)
+			cb.Servers[s.Slot-1].Address = host + ":" + port
+			cb.Servers[s.Slot-1].Enabled = true
+		}
+		data.Backends[i] = cb
+	}
+	return data
+}
+
+func (r *haproxyRouter) renderConfig(backends []backend) ([]byte, error) {
+	text := defaultConfigTemplate
+	if r.templateFile != "" {
+		content, err := ioutil.ReadFile(r.templateFile)
+		if err != nil {
+			return nil, err
+		}
+		text = string(content)
+	}
+	tmpl, err := template.New("haproxy").Funcs(template.FuncMap{"quote": strconv.Quote}).Parse(text)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	err = tmpl.Execute(&buf, r.configData(backends))
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// writeConfig renders the config file from the state of all backends in the
+// router. The file is replaced atomically, so HAProxy never reads a partially
+// written config.
+func (r *haproxyRouter) writeConfig() error {
+	coll, err := r.coll()
+	if err != nil {
+		return &router.RouterError{Op: "write-config", Err: err}
+	}
+	defer coll.Close()
+	var backends []backend
+	err = coll.Find(nil).Sort("_id").All(&backends)
+	if err != nil {
+		return &router.RouterError{Op: "write-config", Err: err}
+	}
+	content, err := r.renderConfig(backends)
+	if err != nil {
+		return &router.RouterError{Op: "write-config", Err: err}
+	}
+	tmpFile := r.configFile + ".tmp"
+	err = ioutil.WriteFile(tmpFile, content, 0644)
+	if err != nil {
+		return &router.RouterError{Op: "write-config", Err: err}
+	}
+	err = os.Rename(tmpFile, r.configFile)
+	if err != nil {
+		return &router.RouterError{Op: "write-config", Err: err}
+	}
+	return nil
+}
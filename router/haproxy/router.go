@@ -0,0 +1,705 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package haproxy provides a router implementation backed by HAProxy. The
+// state of the router is stored in MongoDB, and used to render the HAProxy
+// config file. Servers are added and removed using the HAProxy runtime API,
+// so that routes changes don't require HAProxy to be reloaded.
+//
+// It does not provide any exported type, in order to use the router, you must
+// import this package and get the router instance using the function
+// router.Get.
+//
+// In order to use this router, you need to define the "routers:<name>:type =
+// haproxy" in your config.
+package haproxy
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sync"
+
+	"github.com/tsuru/config"
+	"github.com/tsuru/tsuru/db"
+	"github.com/tsuru/tsuru/db/storage"
+	"github.com/tsuru/tsuru/hc"
+	"github.com/tsuru/tsuru/log"
+	"github.com/tsuru/tsuru/router"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+const (
+	routerType = "haproxy"
+
+	defaultServerSlots = 10
+	defaultBind        = ":80"
+
+	// maxUpdateAttempts is the number of times the servers of a backend are
+	// assigned again when another API instance changes them concurrently.
+	maxUpdateAttempts = 5
+)
+
+// mu serializes the changes in the state of the routers within the process,
+// so that the config file is consistently rendered. Server slots assignment
+// across API instances relies on the version of the backend instead.
+var mu sync.Mutex
+
+// errConcurrentUpdate is returned by updateServers when the servers of the
+// backend were changed since it was loaded.
+var errConcurrentUpdate = errors.New("backend servers updated concurrently")
+
+func init() {
+	router.Register(routerType, createRouter)
+	hc.AddChecker("Router haproxy", router.BuildHealthCheck(routerType))
+}
+
+type haproxyRouter struct {
+	routerName    string
+	prefix        string
+	domain        string
+	socket        string
+	configFile    string
+	templateFile  string
+	reloadCommand string
+	bind          string
+	serverSlots   int
+	collection    string
+}
+
+// backend is the state of a backend stored in MongoDB. Each backend has a
+// fixed number of server slots in the HAProxy config, routes are assigned to
+// free slots and enabled using the runtime API. Version is incremented on
+// every change in the servers, so that concurrent changes are detected.
+type backend struct {
+	Name         string `bson:"_id"`
+	CNames       []string
+	Servers      []server
+	Slots        int
+	Version      int
+	Healthcheck  *router.HealthcheckData
+	AccessPolicy *router.AccessPolicy
+	Maintenance  bool
+}
+
+type server struct {
+	Slot    int
+	Address string
+}
+
+func (b *backend) findServer(address *url.URL) int {
+	for i, s := range b.Servers {
+		u, err := url.Parse(s.Address)
+		if err == nil && u.Host == address.Host {
+			return i
+		}
+	}
+	return -1
+}
+
+func (b *backend) freeSlot() int {
+	used := make(map[int]bool, len(b.Servers))
+	for _, s := range b.Servers {
+		used[s.Slot] = true
+	}
+	for i := 1; i <= b.Slots; i++ {
+		if !used[i] {
+			return i
+		}
+	}
+	return 0
+}
+
+func createRouter(routerName, configPrefix string) (router.Router, error) {
+	domain, err := config.GetString(configPrefix + ":domain")
+	if err != nil {
+		return nil, err
+	}
+	socket, err := config.GetString(configPrefix + ":socket")
+	if err != nil {
+		return nil, err
+	}
+	configFile, err := config.GetString(configPrefix + ":config-file")
+	if err != nil {
+		return nil, err
+	}
+	templateFile, _ := config.GetString(configPrefix + ":template-file")
+	reloadCommand, _ := config.GetString(configPrefix + ":reload-command")
+	bind, _ := config.GetString(configPrefix + ":bind")
+	if bind == "" {
+		bind = defaultBind
+	}
+	serverSlots, _ := config.GetInt(configPrefix + ":server-slots")
+	if serverSlots <= 0 {
+		serverSlots = defaultServerSlots
+	}
+	collection, _ := config.GetString(configPrefix + ":collection")
+	if collection == "" {
+		collection = "router_haproxy_" + routerName
+	}
+	return &haproxyRouter{
+		routerName:    routerName,
+		prefix:        configPrefix,
+		domain:        domain,
+		socket:        socket,
+		configFile:    configFile,
+		templateFile:  templateFile,
+		reloadCommand: reloadCommand,
+		bind:          bind,
+		serverSlots:   serverSlots,
+		collection:    collection,
+	}, nil
+}
+
+func (r *haproxyRouter) coll() (*storage.Collection, error) {
+	conn, err := db.Conn()
+	if err != nil {
+		return nil, err
+	}
+	return conn.Collection(r.collection), nil
+}
+
+func (r *haproxyRouter) findBackend(name string) (*backend, error) {
+	coll, err := r.coll()
+	if err != nil {
+		return nil, err
+	}
+	defer coll.Close()
+	var b backend
+	err = coll.FindId(name).One(&b)
+	if err == mgo.ErrNotFound {
+		return nil, router.ErrBackendNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &b, nil
+}
+
+// updateServers atomically stores the servers of the backend, as long as they
+// were not changed since the backend was loaded. Otherwise
+// errConcurrentUpdate is returned.
+func (r *haproxyRouter) updateServers(b *backend) error {
+	coll, err := r.coll()
+	if err != nil {
+		return err
+	}
+	defer coll.Close()
+	query := bson.M{"_id": b.Name, "version": b.Version}
+	if b.Version == 0 {
+		query["version"] = bson.M{"$in": []interface{}{0, nil}}
+	}
+	err = coll.Update(query, bson.M{
+		"$set": bson.M{"servers": b.Servers, "slots": b.Slots},
+		"$inc": bson.M{"version": 1},
+	})
+	if err == mgo.ErrNotFound {
+		return errConcurrentUpdate
+	}
+	if err != nil {
+		return err
+	}
+	b.Version++
+	return nil
+}
+
+// changeServers loads the backend and applies a change to its servers,
+// starting over with the current state of the backend when another API
+// instance changed it in the meantime.
+func (r *haproxyRouter) changeServers(op, name string, change func(b *backend) error) error {
+	for i := 0; i < maxUpdateAttempts; i++ {
+		b, err := r.findBackend(name)
+		if err != nil {
+			return err
+		}
+		err = change(b)
+		if err != errConcurrentUpdate {
+			return err
+		}
+	}
+	return &router.RouterError{Op: op, Err: errConcurrentUpdate}
+}
+
+func (r *haproxyRouter) AddBackend(name string) error {
+	mu.Lock()
+	defer mu.Unlock()
+	coll, err := r.coll()
+	if err != nil {
+		return &router.RouterError{Op: "add-backend", Err: err}
+	}
+	defer coll.Close()
+	err = coll.Insert(backend{Name: name, Slots: r.serverSlots})
+	if mgo.IsDup(err) {
+		return router.ErrBackendExists
+	}
+	if err != nil {
+		return &router.RouterError{Op: "add-backend", Err: err}
+	}
+	err = router.Store(name, name, routerType)
+	if err != nil {
+		return err
+	}
+	return r.reload()
+}
+
+func (r *haproxyRouter) RemoveBackend(name string) error {
+	usedName, err := router.Retrieve(name)
+	if err != nil {
+		return err
+	}
+	if usedName != name {
+		return router.ErrBackendSwapped
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	coll, err := r.coll()
+	if err != nil {
+		return &router.RouterError{Op: "remove-backend", Err: err}
+	}
+	defer coll.Close()
+	err = coll.RemoveId(usedName)
+	if err == mgo.ErrNotFound {
+		return router.ErrBackendNotFound
+	}
+	if err != nil {
+		return &router.RouterError{Op: "remove-backend", Err: err}
+	}
+	err = router.Remove(usedName)
+	if err != nil {
+		return err
+	}
+	os.Remove(r.maintenancePagePath(usedName))
+	return r.reload()
+}
+
+func (r *haproxyRouter) AddRoute(name string, address *url.URL) error {
+	usedName, err := router.Retrieve(name)
+	if err != nil {
+		return err
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	return r.changeServers("add-route", usedName, func(b *backend) error {
+		if b.findServer(address) != -1 {
+			return router.ErrRouteExists
+		}
+		return r.addServers(b, []*url.URL{address})
+	})
+}
+
+func (r *haproxyRouter) AddRoutes(name string, addresses []*url.URL) error {
+	usedName, err := router.Retrieve(name)
+	if err != nil {
+		return err
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	return r.changeServers("add-routes", usedName, func(b *backend) error {
+		var toAdd []*url.URL
+		seen := map[string]bool{}
+		for _, addr := range addresses {
+			if b.findServer(addr) == -1 && !seen[addr.Host] {
+				seen[addr.Host] = true
+				toAdd = append(toAdd, addr)
+			}
+		}
+		if len(toAdd) == 0 {
+			return nil
+		}
+		return r.addServers(b, toAdd)
+	})
+}
+
+// addServers assigns a slot for each address, growing the number of slots in
+// the backend when needed. Growing the backend requires HAProxy to be
+// reloaded, otherwise the servers are enabled using the runtime API.
+func (r *haproxyRouter) addServers(b *backend, addresses []*url.URL) error {
+	needsReload := false
+	added := make([]server, len(addresses))
+	for i, addr := range addresses {
+		slot := b.freeSlot()
+		if slot == 0 {
+			slot = b.Slots + 1
+			b.Slots += r.serverSlots
+			needsReload = true
+		}
+		added[i] = server{Slot: slot, Address: addr.String()}
+		b.Servers = append(b.Servers, added[i])
+	}
+	err := r.updateServers(b)
+	if err == errConcurrentUpdate {
+		return err
+	}
+	if err != nil {
+		return &router.RouterError{Op: "add-route", Err: err}
+	}
+	if needsReload {
+		return r.reload()
+	}
+	err = r.writeConfig()
+	if err != nil {
+		return err
+	}
+	for _, s := range added {
+		err = r.enableServer(b.Name, s)
+		if err != nil {
+			log.Errorf("[router haproxy] unable to enable server %s using the runtime API, reloading: %s", s.Address, err)
+			return r.reload()
+		}
+	}
+	return nil
+}
+
+func (r *haproxyRouter) RemoveRoute(name string, address *url.URL) error {
+	usedName, err := router.Retrieve(name)
+	if err != nil {
+		return err
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	return r.changeServers("remove-route", usedName, func(b *backend) error {
+		if b.findServer(address) == -1 {
+			return router.ErrRouteNotFound
+		}
+		return r.removeServers(b, []*url.URL{address})
+	})
+}
+
+func (r *haproxyRouter) RemoveRoutes(name string, addresses []*url.URL) error {
+	usedName, err := router.Retrieve(name)
+	if err != nil {
+		return err
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	return r.changeServers("remove-routes", usedName, func(b *backend) error {
+		return r.removeServers(b, addresses)
+	})
+}
+
+func (r *haproxyRouter) removeServers(b *backend, addresses []*url.URL) error {
+	var removed []server
+	for _, addr := range addresses {
+		idx := b.findServer(addr)
+		if idx == -1 {
+			continue
+		}
+		removed = append(removed, b.Servers[idx])
+		b.Servers = append(b.Servers[:idx], b.Servers[idx+1:]...)
+	}
+	if len(removed) == 0 {
+		return nil
+	}
+	err := r.updateServers(b)
+	if err == errConcurrentUpdate {
+		return err
+	}
+	if err != nil {
+		return &router.RouterError{Op: "remove-route", Err: err}
+	}
+	err = r.writeConfig()
+	if err != nil {
+		return err
+	}
+	for _, s := range removed {
+		err = r.disableServer(b.Name, s)
+		if err != nil {
+			log.Errorf("[router haproxy] unable to disable server %s using the runtime API, reloading: %s", s.Address, err)
+			return r.reload()
+		}
+	}
+	return nil
+}
+
+func (r *haproxyRouter) Routes(name string) ([]*url.URL, error) {
+	usedName, err := router.Retrieve(name)
+	if err != nil {
+		return nil, err
+	}
+	b, err := r.findBackend(usedName)
+	if err != nil {
+		return nil, err
+	}
+	routes := make([]*url.URL, 0, len(b.Servers))
+	for _, s := range b.Servers {
+		u, err := url.Parse(s.Address)
+		if err != nil {
+			return nil, &router.RouterError{Op: "routes", Err: err}
+		}
+		routes = append(routes, u)
+	}
+	return routes, nil
+}
+
+func (r *haproxyRouter) Addr(name string) (string, error) {
+	usedName, err := router.Retrieve(name)
+	if err != nil {
+		return "", err
+	}
+	_, err = r.findBackend(usedName)
+	if err == router.ErrBackendNotFound {
+		return "", router.ErrRouteNotFound
+	}
+	if err != nil {
+		return "", err
+	}
+	return r.hostname(usedName), nil
+}
+
+func (r *haproxyRouter) hostname(name string) string {
+	return fmt.Sprintf("%s.%s", name, r.domain)
+}
+
+func (r *haproxyRouter) Swap(backend1, backend2 string, cnameOnly bool) error {
+	return router.Swap(r, backend1, backend2, cnameOnly)
+}
+
+func (r *haproxyRouter) CNames(name string) ([]*url.URL, error) {
+	usedName, err := router.Retrieve(name)
+	if err != nil {
+		return nil, err
+	}
+	b, err := r.findBackend(usedName)
+	if err != nil {
+		return nil, err
+	}
+	urls := make([]*url.URL, len(b.CNames))
+	for i, cname := range b.CNames {
+		urls[i] = &url.URL{Host: cname}
+	}
+	return urls, nil
+}
+
+func (r *haproxyRouter) SetCName(cname, name string) error {
+	usedName, err := router.Retrieve(name)
+	if err != nil {
+		return err
+	}
+	if !router.ValidCName(cname, r.domain) {
+		return router.ErrCNameNotAllowed
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	coll, err := r.coll()
+	if err != nil {
+		return &router.RouterError{Op: "set-cname", Err: err}
+	}
+	defer coll.Close()
+	n, err := coll.Find(bson.M{"cnames": cname}).Count()
+	if err != nil {
+		return &router.RouterError{Op: "set-cname", Err: err}
+	}
+	if n > 0 {
+		return router.ErrCNameExists
+	}
+	err = coll.UpdateId(usedName, bson.M{"$push": bson.M{"cnames": cname}})
+	if err == mgo.ErrNotFound {
+		return router.ErrBackendNotFound
+	}
+	if err != nil {
+		return &router.RouterError{Op: "set-cname", Err: err}
+	}
+	return r.reload()
+}
+
+func (r *haproxyRouter) UnsetCName(cname, name string) error {
+	usedName, err := router.Retrieve(name)
+	if err != nil {
+		return err
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	coll, err := r.coll()
+	if err != nil {
+		return &router.RouterError{Op: "unset-cname", Err: err}
+	}
+	defer coll.Close()
+	err = coll.Update(bson.M{"_id": usedName, "cnames": cname}, bson.M{"$pull": bson.M{"cnames": cname}})
+	if err == mgo.ErrNotFound {
+		return router.ErrCNameNotFound
+	}
+	if err != nil {
+		return &router.RouterError{Op: "unset-cname", Err: err}
+	}
+	return r.reload()
+}
+
+func (r *haproxyRouter) SetHealthcheck(name string, data router.HealthcheckData) error {
+	if !router.ValidHealthcheckPath(data.Path) {
+		return router.ErrInvalidHealthcheckPath
+	}
+	usedName, err := router.Retrieve(name)
+	if err != nil {
+		return err
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	coll, err := r.coll()
+	if err != nil {
+		return &router.RouterError{Op: "set-healthcheck", Err: err}
+	}
+	defer coll.Close()
+	err = coll.UpdateId(usedName, bson.M{"$set": bson.M{"healthcheck": data}})
+	if err == mgo.ErrNotFound {
+		return router.ErrBackendNotFound
+	}
+	if err != nil {
+		return &router.RouterError{Op: "set-healthcheck", Err: err}
+	}
+	return r.reload()
+}
+
+// SetAccessPolicy sets the access policy of the backend. Rate limits are
+// enforced using a stick table tracking the requests of each client address,
+// and requests above the limit plus the burst within a second are rejected.
+// Basic auth is not supported, as HAProxy only accepts crypt(3) hashes.
+func (r *haproxyRouter) SetAccessPolicy(name string, policy router.AccessPolicy) error {
+	if policy.BasicAuth != nil {
+		return router.ErrBasicAuthNotSupported
+	}
+	update := bson.M{"$set": bson.M{"accesspolicy": policy}}
+	if policy.Empty() {
+		update = bson.M{"$unset": bson.M{"accesspolicy": ""}}
+	}
+	usedName, err := router.Retrieve(name)
+	if err != nil {
+		return err
+	}
+	return r.updateBackend("set-access-policy", usedName, update)
+}
+
+// SetMaintenance writes the maintenance page of the backend and makes HAProxy
+// return it, with the 503 status, instead of proxying the requests to the
+// servers.
+func (r *haproxyRouter) SetMaintenance(name string, page string) error {
+	usedName, err := router.Retrieve(name)
+	if err != nil {
+		return err
+	}
+	_, err = r.findBackend(usedName)
+	if err == router.ErrBackendNotFound {
+		return err
+	}
+	if err != nil {
+		return &router.RouterError{Op: "set-maintenance", Err: err}
+	}
+	path := r.maintenancePagePath(usedName)
+	err = os.MkdirAll(filepath.Dir(path), 0755)
+	if err != nil {
+		return &router.RouterError{Op: "set-maintenance", Err: err}
+	}
+	err = ioutil.WriteFile(path, []byte(page), 0644)
+	if err != nil {
+		return &router.RouterError{Op: "set-maintenance", Err: err}
+	}
+	return r.updateBackend("set-maintenance", usedName, bson.M{"$set": bson.M{"maintenance": true}})
+}
+
+func (r *haproxyRouter) UnsetMaintenance(name string) error {
+	usedName, err := router.Retrieve(name)
+	if err != nil {
+		return err
+	}
+	b, err := r.findBackend(usedName)
+	if err == router.ErrBackendNotFound {
+		return err
+	}
+	if err != nil {
+		return &router.RouterError{Op: "unset-maintenance", Err: err}
+	}
+	if !b.Maintenance {
+		return nil
+	}
+	err = r.updateBackend("unset-maintenance", usedName, bson.M{"$set": bson.M{"maintenance": false}})
+	if err != nil {
+		return err
+	}
+	os.Remove(r.maintenancePagePath(usedName))
+	return nil
+}
+
+// updateBackend applies an update to the state of a backend and reloads
+// HAProxy with the new config. The name must be already resolved with
+// router.Retrieve, so that swapped backends are not resolved twice.
+func (r *haproxyRouter) updateBackend(op, usedName string, update bson.M) error {
+	mu.Lock()
+	defer mu.Unlock()
+	coll, err := r.coll()
+	if err != nil {
+		return &router.RouterError{Op: op, Err: err}
+	}
+	defer coll.Close()
+	err = coll.UpdateId(usedName, update)
+	if err == mgo.ErrNotFound {
+		return router.ErrBackendNotFound
+	}
+	if err != nil {
+		return &router.RouterError{Op: op, Err: err}
+	}
+	return r.reload()
+}
+
+func (r *haproxyRouter) StartupMessage() (string, error) {
+	return fmt.Sprintf("haproxy router %q with runtime API at %q and config file %q", r.domain, r.socket, r.configFile), nil
+}
+
+func (r *haproxyRouter) HealthCheck() error {
+	_, err := r.runtimeCommand("show info")
+	return err
+}
+
+// reload renders the config file and runs the configured reload command.
+func (r *haproxyRouter) reload() error {
+	err := r.writeConfig()
+	if err != nil {
+		return err
+	}
+	if r.reloadCommand == "" {
+		return nil
+	}
+	out, err := exec.Command("/bin/sh", "-c", r.reloadCommand).CombinedOutput()
+	if err != nil {
+		return &router.RouterError{Op: "reload", Err: fmt.Errorf("%s: %s", err, out)}
+	}
+	return nil
+}
+
+func (r *haproxyRouter) enableServer(backendName string, s server) error {
+	u, err := url.Parse(s.Address)
+	if err != nil {
+		return err
+	}
+	host, port := hostPort(u)
+	name := serverName(backendName, s.Slot)
+	_, err = r.runtimeCommand(fmt.Sprintf("set server %s addr %s port %s", name, host, port))
+	if err != nil {
+		return err
+	}
+	_, err = r.runtimeCommand(fmt.Sprintf("set server %s state ready", name))
+	return err
+}
+
+func (r *haproxyRouter) disableServer(backendName string, s server) error {
+	_, err := r.runtimeCommand(fmt.Sprintf("set server %s state maint", serverName(backendName, s.Slot)))
+	return err
+}
+
+// hostPort returns the host and port of a route, using the default port for
+// the scheme when the port is not set.
+func hostPort(u *url.URL) (string, string) {
+	host, port, err := net.SplitHostPort(u.Host)
+	if err == nil {
+		return host, port
+	}
+	if u.Scheme == "https" {
+		return u.Host, "443"
+	}
+	return u.Host, "80"
+}
@@ -0,0 +1,439 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package haproxy
+
+import (
+	"bufio"
+	"io/ioutil"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/tsuru/config"
+	"github.com/tsuru/tsuru/db"
+	"github.com/tsuru/tsuru/db/dbtest"
+	"github.com/tsuru/tsuru/router"
+	"github.com/tsuru/tsuru/router/routertest"
+	"gopkg.in/check.v1"
+)
+
+func Test(t *testing.T) {
+	check.TestingT(t)
+}
+
+type S struct {
+	conn       *db.Storage
+	runtime    *fakeRuntime
+	configFile string
+}
+
+var _ = check.Suite(&S{})
+
+func init() {
+	base := &S{}
+	suite := &routertest.RouterSuite{
+		SetUpSuiteFunc:   base.SetUpSuite,
+		TearDownTestFunc: base.TearDownTest,
+	}
+	suite.SetUpTestFunc = func(c *check.C) {
+		config.Set("database:name", "router_generic_haproxy_tests")
+		base.SetUpTest(c)
+		r, err := router.Get("haproxy")
+		c.Assert(err, check.IsNil)
+		suite.Router = r
+	}
+	check.Suite(suite)
+}
+
+// fakeRuntime is a fake HAProxy runtime API listening on a unix socket. It
+// keeps track of the commands received and of the state of the servers.
+type fakeRuntime struct {
+	sync.Mutex
+	listener net.Listener
+	commands []string
+	servers  map[string]string
+	states   map[string]string
+}
+
+func newFakeRuntime(c *check.C) *fakeRuntime {
+	l, err := net.Listen("unix", filepath.Join(c.MkDir(), "haproxy.sock"))
+	c.Assert(err, check.IsNil)
+	f := &fakeRuntime{listener: l, servers: map[string]string{}, states: map[string]string{}}
+	go f.serve()
+	return f
+}
+
+func (f *fakeRuntime) serve() {
+	for {
+		conn, err := f.listener.Accept()
+		if err != nil {
+			return
+		}
+		line, _ := bufio.NewReader(conn).ReadString('\n')
+		conn.Write([]byte(f.handle(strings.TrimSpace(line))))
+		conn.Close()
+	}
+}
+
+func (f *fakeRuntime) handle(cmd string) string {
+	f.Lock()
+	defer f.Unlock()
+	f.commands = append(f.commands, cmd)
+	parts := strings.Fields(cmd)
+	switch {
+	case cmd == "show info":
+		return "Name: HAProxy\nVersion: 1.8.0\n"
+	case len(parts) == 7 && parts[0] == "set" && parts[1] == "server" && parts[3] == "addr":
+		f.servers[parts[2]] = parts[4] + ":" + parts[6]
+		return "IP changed\n"
+	case len(parts) == 5 && parts[0] == "set" && parts[1] == "server" && parts[3] == "state":
+		f.states[parts[2]] = parts[4]
+		return "\n"
+	}
+	return "Unknown command.\n"
+}
+
+func (f *fakeRuntime) Commands() []string {
+	f.Lock()
+	defer f.Unlock()
+	return append([]string(nil), f.commands...)
+}
+
+func (f *fakeRuntime) State(server string) string {
+	f.Lock()
+	defer f.Unlock()
+	return f.states[server]
+}
+
+func (s *S) SetUpSuite(c *check.C) {
+	config.Set("routers:haproxy:type", "haproxy")
+	config.Set("routers:haproxy:domain", "haproxy.example.com")
+	config.Set("routers:haproxy:server-slots", 2)
+	config.Set("database:url", "127.0.0.1:27017")
+	config.Set("database:name", "router_haproxy_tests")
+}
+
+func (s *S) SetUpTest(c *check.C) {
+	var err error
+	s.conn, err = db.Conn()
+	c.Assert(err, check.IsNil)
+	dbtest.ClearAllCollections(s.conn.Collection("router_haproxy_tests").Database)
+	s.runtime = newFakeRuntime(c)
+	s.configFile = filepath.Join(c.MkDir(), "haproxy.cfg")
+	config.Set("routers:haproxy:socket", s.runtime.listener.Addr().String())
+	config.Set("routers:haproxy:config-file", s.configFile)
+	config.Unset("routers:haproxy:reload-command")
+}
+
+func (s *S) TearDownTest(c *check.C) {
+	s.runtime.listener.Close()
+	s.conn.Close()
+}
+
+func (s *S) TearDownSuite(c *check.C) {
+	conn, err := db.Conn()
+	c.Assert(err, check.IsNil)
+	defer conn.Close()
+	conn.Apps().Database.DropDatabase()
+}
+
+func (s *S) readConfig(c *check.C) string {
+	data, err := ioutil.ReadFile(s.configFile)
+	c.Assert(err, check.IsNil)
+	return string(data)
+}
+
+func (s *S) TestShouldBeRegistered(c *check.C) {
+	got, err := router.Get("haproxy")
+	c.Assert(err, check.IsNil)
+	r, ok := got.(*haproxyRouter)
+	c.Assert(ok, check.Equals, true)
+	c.Assert(r.domain, check.Equals, "haproxy.example.com")
+	c.Assert(r.socket, check.Equals, s.runtime.listener.Addr().String())
+	c.Assert(r.configFile, check.Equals, s.configFile)
+	c.Assert(r.serverSlots, check.Equals, 2)
+	c.Assert(r.bind, check.Equals, ":80")
+	c.Assert(r.collection, check.Equals, "router_haproxy_haproxy")
+}
+
+func (s *S) TestAddBackendWritesConfig(c *check.C) {
+	r, err := router.Get("haproxy")
+	c.Assert(err, check.IsNil)
+	err = r.AddBackend("myapp")
+	c.Assert(err, check.IsNil)
+	cfg := s.readConfig(c)
+	c.Assert(cfg, check.Matches, `(?s).*acl host_tsuru_myapp req.hdr\(host\),field\(1,:\) -i myapp.haproxy.example.com\n.*`)
+	c.Assert(cfg, check.Matches, `(?s).*use_backend tsuru_myapp if host_tsuru_myapp\n.*`)
+	c.Assert(cfg, check.Matches, `(?s).*backend tsuru_myapp\n    server srv1 127.0.0.1:1 disabled\n    server srv2 127.0.0.1:1 disabled\n.*`)
+}
+
+func (s *S) TestAddRouteUsesRuntimeAPI(c *check.C) {
+	r, err := router.Get("haproxy")
+	c.Assert(err, check.IsNil)
+	err = r.AddBackend("myapp")
+	c.Assert(err, check.IsNil)
+	config.Set("routers:haproxy:reload-command", "false")
+	defer config.Unset("routers:haproxy:reload-command")
+	r, err = router.Get("haproxy")
+	c.Assert(err, check.IsNil)
+	addr, _ := url.Parse("http://10.0.0.1:8080")
+	err = r.AddRoute("myapp", addr)
+	c.Assert(err, check.IsNil)
+	c.Assert(s.runtime.Commands(), check.DeepEquals, []string{
+		"set server tsuru_myapp/srv1 addr 10.0.0.1 port 8080",
+		"set server tsuru_myapp/srv1 state ready",
+	})
+	c.Assert(s.readConfig(c), check.Matches, `(?s).*backend tsuru_myapp\n    server srv1 10.0.0.1:8080\n    server srv2 127.0.0.1:1 disabled\n.*`)
+	err = r.RemoveRoute("myapp", addr)
+	c.Assert(err, check.IsNil)
+	c.Assert(s.runtime.State("tsuru_myapp/srv1"), check.Equals, "maint")
+	c.Assert(s.readConfig(c), check.Matches, `(?s).*backend tsuru_myapp\n    server srv1 127.0.0.1:1 disabled\n.*`)
+}
+
+func (s *S) TestAddRoutesGrowsServerSlots(c *check.C) {
+	reloadFile := filepath.Join(c.MkDir(), "reloaded")
+	r, err := router.Get("haproxy")
+	c.Assert(err, check.IsNil)
+	err = r.AddBackend("myapp")
+	c.Assert(err, check.IsNil)
+	config.Set("routers:haproxy:reload-command", "touch "+reloadFile)
+	defer config.Unset("routers:haproxy:reload-command")
+	r, err = router.Get("haproxy")
+	c.Assert(err, check.IsNil)
+	var addrs []*url.URL
+	for _, a := range []string{"http://10.0.0.1:8080", "http://10.0.0.2:8080", "http://10.0.0.3:8080"} {
+		u, _ := url.Parse(a)
+		addrs = append(addrs, u)
+	}
+	err = r.AddRoutes("myapp", addrs)
+	c.Assert(err, check.IsNil)
+	_, err = ioutil.ReadFile(reloadFile)
+	c.Assert(err, check.IsNil)
+	c.Assert(s.runtime.Commands(), check.HasLen, 0)
+	c.Assert(s.readConfig(c), check.Matches, `(?s).*`+
+		`    server srv1 10.0.0.1:8080\n`+
+		`    server srv2 10.0.0.2:8080\n`+
+		`    server srv3 10.0.0.3:8080\n`+
+		`    server srv4 127.0.0.1:1 disabled\n.*`)
+	routes, err := r.Routes("myapp")
+	c.Assert(err, check.IsNil)
+	c.Assert(routes, routertest.HostEquals, addrs)
+}
+
+func (s *S) TestAddRouteFallsBackToReload(c *check.C) {
+	reloadFile := filepath.Join(c.MkDir(), "reloaded")
+	r, err := router.Get("haproxy")
+	c.Assert(err, check.IsNil)
+	err = r.AddBackend("myapp")
+	c.Assert(err, check.IsNil)
+	s.runtime.listener.Close()
+	config.Set("routers:haproxy:reload-command", "touch "+reloadFile)
+	defer config.Unset("routers:haproxy:reload-command")
+	r, err = router.Get("haproxy")
+	c.Assert(err, check.IsNil)
+	addr, _ := url.Parse("http://10.0.0.1:8080")
+	err = r.AddRoute("myapp", addr)
+	c.Assert(err, check.IsNil)
+	_, err = ioutil.ReadFile(reloadFile)
+	c.Assert(err, check.IsNil)
+}
+
+func (s *S) TestSetHealthcheckWritesConfig(c *check.C) {
+	r, err := router.Get("haproxy")
+	c.Assert(err, check.IsNil)
+	err = r.AddBackend("myapp")
+	c.Assert(err, check.IsNil)
+	hcRouter := r.(router.CustomHealthcheckRouter)
+	err = hcRouter.SetHealthcheck("myapp", router.HealthcheckData{Path: "/healthcheck", Status: 200})
+	c.Assert(err, check.IsNil)
+	c.Assert(s.readConfig(c), check.Matches, `(?s).*backend tsuru_myapp\n`+
+		`    option httpchk GET "/healthcheck"\n`+
+		`    http-check expect status 200\n`+
+		`    server srv1 127.0.0.1:1 check disabled\n.*`)
+}
+
+func (s *S) TestSetHealthcheckQuotesBody(c *check.C) {
+	r, err := router.Get("haproxy")
+	c.Assert(err, check.IsNil)
+	err = r.AddBackend("myapp")
+	c.Assert(err, check.IsNil)
+	hcRouter := r.(router.CustomHealthcheckRouter)
+	err = hcRouter.SetHealthcheck("myapp", router.HealthcheckData{Path: "/", Status: 200, Body: "WORKING fine\n"})
+	c.Assert(err, check.IsNil)
+	c.Assert(s.readConfig(c), check.Matches, `(?s).*    http-check expect string "WORKING fine\\n"\n.*`)
+}
+
+func (s *S) TestSetHealthcheckInvalidPath(c *check.C) {
+	r, err := router.Get("haproxy")
+	c.Assert(err, check.IsNil)
+	err = r.AddBackend("myapp")
+	c.Assert(err, check.IsNil)
+	before := s.readConfig(c)
+	hcRouter := r.(router.CustomHealthcheckRouter)
+	err = hcRouter.SetHealthcheck("myapp", router.HealthcheckData{
+		Path:   "/\n    server evil 10.0.0.1:80\nbackend other",
+		Status: 200,
+	})
+	c.Assert(err, check.Equals, router.ErrInvalidHealthcheckPath)
+	err = hcRouter.SetHealthcheck("myapp", router.HealthcheckData{Path: "healthcheck", Status: 200})
+	c.Assert(err, check.Equals, router.ErrInvalidHealthcheckPath)
+	c.Assert(s.readConfig(c), check.Equals, before)
+}
+
+func (s *S) TestUpdateServersConcurrentUpdate(c *check.C) {
+	got, err := router.Get("haproxy")
+	c.Assert(err, check.IsNil)
+	r := got.(*haproxyRouter)
+	err = r.AddBackend("myapp")
+	c.Assert(err, check.IsNil)
+	b1, err := r.findBackend("myapp")
+	c.Assert(err, check.IsNil)
+	b2, err := r.findBackend("myapp")
+	c.Assert(err, check.IsNil)
+	b1.Servers = []server{{Slot: 1, Address: "http://10.0.0.1:8080"}}
+	err = r.updateServers(b1)
+	c.Assert(err, check.IsNil)
+	c.Assert(b1.Version, check.Equals, 1)
+	b2.Servers = []server{{Slot: 1, Address: "http://10.0.0.2:8080"}}
+	err = r.updateServers(b2)
+	c.Assert(err, check.Equals, errConcurrentUpdate)
+	b, err := r.findBackend("myapp")
+	c.Assert(err, check.IsNil)
+	c.Assert(b.Servers, check.DeepEquals, []server{{Slot: 1, Address: "http://10.0.0.1:8080"}})
+	addr, _ := url.Parse("http://10.0.0.2:8080")
+	err = r.AddRoute("myapp", addr)
+	c.Assert(err, check.IsNil)
+	b, err = r.findBackend("myapp")
+	c.Assert(err, check.IsNil)
+	c.Assert(b.Version, check.Equals, 2)
+	c.Assert(b.Servers, check.DeepEquals, []server{
+		{Slot: 1, Address: "http://10.0.0.1:8080"},
+		{Slot: 2, Address: "http://10.0.0.2:8080"},
+	})
+}
+
+func (s *S) TestSetCNameWritesConfig(c *check.C) {
+	r, err := router.Get("haproxy")
+	c.Assert(err, check.IsNil)
+	err = r.AddBackend("myapp")
+	c.Assert(err, check.IsNil)
+	err = r.(router.CNameRouter).SetCName("myapp.io", "myapp")
+	c.Assert(err, check.IsNil)
+	c.Assert(s.readConfig(c), check.Matches, `(?s).*-i myapp.haproxy.example.com myapp.io\n.*`)
+}
+
+func (s *S) TestSetAccessPolicyWritesConfig(c *check.C) {
+	r, err := router.Get("haproxy")
+	c.Assert(err, check.IsNil)
+	err = r.AddBackend("myapp")
+	c.Assert(err, check.IsNil)
+	policyRouter := r.(router.AccessPolicyRouter)
+	err = policyRouter.SetAccessPolicy("myapp", router.AccessPolicy{
+		Allow:     []string{"10.0.0.0/8", "192.168.0.1"},
+		Deny:      []string{"10.1.0.0/16"},
+		RateLimit: 10,
+		RateBurst: 5,
+	})
+	c.Assert(err, check.IsNil)
+	c.Assert(s.readConfig(c), check.Matches, `(?s).*backend tsuru_myapp\n`+
+		`    http-request deny if { src 10.1.0.0/16 }\n`+
+		`    http-request deny unless { src 10.0.0.0/8 192.168.0.1 }\n`+
+		`    stick-table type ipv6 size 100k expire 10s store http_req_rate\(1s\)\n`+
+		`    http-request track-sc0 src\n`+
+		`    http-request deny deny_status 429 if { sc_http_req_rate\(0\) gt 15 }\n.*`)
+	err = policyRouter.SetAccessPolicy("myapp", router.AccessPolicy{})
+	c.Assert(err, check.IsNil)
+	c.Assert(s.readConfig(c), check.Not(check.Matches), `(?s).*http-request.*`)
+}
+
+func (s *S) TestSetAccessPolicyBasicAuthNotSupported(c *check.C) {
+	r, err := router.Get("haproxy")
+	c.Assert(err, check.IsNil)
+	err = r.AddBackend("myapp")
+	c.Assert(err, check.IsNil)
+	err = r.(router.AccessPolicyRouter).SetAccessPolicy("myapp", router.AccessPolicy{
+		BasicAuth: &router.BasicAuth{Username: "user", PasswordHash: "{PLAIN}secret"},
+	})
+	c.Assert(err, check.Equals, router.ErrBasicAuthNotSupported)
+}
+
+func (s *S) TestSetMaintenanceWritesConfig(c *check.C) {
+	r, err := router.Get("haproxy")
+	c.Assert(err, check.IsNil)
+	err = r.AddBackend("myapp")
+	c.Assert(err, check.IsNil)
+	maintenanceRouter := r.(router.MaintenanceRouter)
+	err = maintenanceRouter.SetMaintenance("myapp", "<h1>maintenance</h1>")
+	c.Assert(err, check.IsNil)
+	page := filepath.Join(filepath.Dir(s.configFile), "maintenance", "tsuru_myapp.html")
+	data, err := ioutil.ReadFile(page)
+	c.Assert(err, check.IsNil)
+	c.Assert(string(data), check.Equals, "<h1>maintenance</h1>")
+	c.Assert(s.readConfig(c), check.Matches, `(?s).*backend tsuru_myapp\n`+
+		`    http-request return status 503 content-type text/html file `+regexp.QuoteMeta(page)+`\n.*`)
+	err = maintenanceRouter.UnsetMaintenance("myapp")
+	c.Assert(err, check.IsNil)
+	c.Assert(s.readConfig(c), check.Not(check.Matches), `(?s).*http-request return.*`)
+	_, err = os.Stat(page)
+	c.Assert(os.IsNotExist(err), check.Equals, true)
+}
+
+func (s *S) TestSetMaintenanceSwappedBackends(c *check.C) {
+	got, err := router.Get("haproxy")
+	c.Assert(err, check.IsNil)
+	r := got.(*haproxyRouter)
+	err = r.AddBackend("myapp")
+	c.Assert(err, check.IsNil)
+	err = r.AddBackend("otherapp")
+	c.Assert(err, check.IsNil)
+	err = r.Swap("myapp", "otherapp", false)
+	c.Assert(err, check.IsNil)
+	err = r.SetMaintenance("myapp", "<h1>maintenance</h1>")
+	c.Assert(err, check.IsNil)
+	b, err := r.findBackend("otherapp")
+	c.Assert(err, check.IsNil)
+	c.Assert(b.Maintenance, check.Equals, true)
+	b, err = r.findBackend("myapp")
+	c.Assert(err, check.IsNil)
+	c.Assert(b.Maintenance, check.Equals, false)
+	page := filepath.Join(filepath.Dir(s.configFile), "maintenance", "tsuru_otherapp.html")
+	c.Assert(s.readConfig(c), check.Matches, `(?s).*backend tsuru_otherapp\n`+
+		`    http-request return status 503 content-type text/html file `+regexp.QuoteMeta(page)+`\n.*`)
+	err = r.UnsetMaintenance("myapp")
+	c.Assert(err, check.IsNil)
+	b, err = r.findBackend("otherapp")
+	c.Assert(err, check.IsNil)
+	c.Assert(b.Maintenance, check.Equals, false)
+	_, err = os.Stat(page)
+	c.Assert(os.IsNotExist(err), check.Equals, true)
+}
+
+func (s *S) TestHealthCheck(c *check.C) {
+	r, err := router.Get("haproxy")
+	c.Assert(err, check.IsNil)
+	err = r.(router.HealthChecker).HealthCheck()
+	c.Assert(err, check.IsNil)
+	c.Assert(s.runtime.Commands(), check.DeepEquals, []string{"show info"})
+}
+
+func (s *S) TestHealthCheckFailure(c *check.C) {
+	r, err := router.Get("haproxy")
+	c.Assert(err, check.IsNil)
+	s.runtime.listener.Close()
+	err = r.(router.HealthChecker).HealthCheck()
+	c.Assert(err, check.NotNil)
+}
+
+func (s *S) TestRuntimeCommandError(c *check.C) {
+	r, err := router.Get("haproxy")
+	c.Assert(err, check.IsNil)
+	_, err = r.(*haproxyRouter).runtimeCommand("something weird")
+	c.Assert(err, check.ErrorMatches, `runtime API error running "something weird": Unknown command.`)
+}
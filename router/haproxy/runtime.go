@@ -0,0 +1,58 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package haproxy
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"strings"
+	"time"
+)
+
+var (
+	dialTimeout    = 5 * time.Second
+	commandTimeout = 10 * time.Second
+)
+
+// runtimeErrorPrefixes are the prefixes of the messages returned by the
+// runtime API when a command fails.
+var runtimeErrorPrefixes = []string{
+	"No such",
+	"Unknown command",
+	"Invalid",
+	"Require",
+	"Permission denied",
+}
+
+// runtimeCommand sends a command to the HAProxy runtime API. The socket may be
+// either the path of a unix socket or a TCP address.
+func (r *haproxyRouter) runtimeCommand(cmd string) (string, error) {
+	network := "tcp"
+	if strings.HasPrefix(r.socket, "/") {
+		network = "unix"
+	}
+	conn, err := net.DialTimeout(network, r.socket, dialTimeout)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(commandTimeout))
+	_, err = conn.Write([]byte(cmd + "\n"))
+	if err != nil {
+		return "", err
+	}
+	data, err := ioutil.ReadAll(conn)
+	if err != nil {
+		return "", err
+	}
+	response := strings.TrimSpace(string(data))
+	for _, prefix := range runtimeErrorPrefixes {
+		if strings.HasPrefix(response, prefix) {
+			return "", fmt.Errorf("runtime API error running %q: %s", cmd, response)
+		}
+	}
+	return response, nil
+}
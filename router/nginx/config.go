@@ -0,0 +1,256 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package nginx
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"text/template"
+)
+
+// unusedServer is used in upstreams without routes, as nginx doesn't accept
+// empty upstream blocks.
+const unusedServer = "127.0.0.1:1 down"
+
+var backendTemplate = template.Must(template.New("backend").Parse(`# This file is generated by tsuru, changes will be overwritten.
+upstream {{.Upstream}} {
+{{- if .Plus}}
+    zone {{.Upstream}} 64k;
+{{- end}}
+{{- range .Servers}}
+    server {{.}};
+{{- end}}
+}
+{{- if .Match}}
+
+match {{.Upstream}}_hc {
+{{- if .Match.Status}}
+    status {{.Match.Status}};
+{{- end}}
+{{- if .Match.Body}}
+    body ~ {{.Match.Body}};
+{{- end}}
+}
+{{- end}}
+{{- if .RateLimit}}
+
+limit_req_zone $binary_remote_addr zone={{.Upstream}}_ratelimit:10m rate={{.RateLimit}}r/s;
+{{- end}}
+
+server {
+    listen {{.Listen}};
+    server_name{{range .Hosts}} {{.}}{{end}};
+{{- if .ACMEChallengeURL}}
+
+    location /.well-known/acme-challenge/ {
+        proxy_pass {{.ACMEChallengeURL}};
+    }
+{{- end}}
+{{template "location" .}}
+}
+{{- range .TLS}}
+
+server {
+    listen {{$.TLSListen}} ssl;
+    server_name {{.Host}};
+    ssl_certificate {{.Certificate}};
+    ssl_certificate_key {{.Key}};
+{{template "location" $}}
+}
+{{- end}}
+{{define "location"}}
+{{- if .MaintenancePage}}
+    error_page 503 /tsuru-maintenance.html;
+
+    location = /tsuru-maintenance.html {
+        internal;
+        default_type text/html;
+        alias {{.MaintenancePage}};
+    }
+
+    location / {
+        return 503;
+    }
+{{- else}}
+    location / {
+        proxy_pass http://{{.Upstream}};
+        proxy_set_header Host $host;
+        proxy_set_header X-Real-IP $remote_addr;
+        proxy_set_header X-Forwarded-For $proxy_add_x_forwarded_for;
+{{- if .AccessLog}}
+        access_log {{.AccessLog}};
+{{- end}}
+{{- if .Match}}
+        health_check {{.HealthcheckURI}} match={{.Upstream}}_hc;
+{{- end}}
+{{- range .Deny}}
+        deny {{.}};
+{{- end}}
+{{- range .Allow}}
+        allow {{.}};
+{{- end}}
+{{- if .Allow}}
+        deny all;
+{{- end}}
+{{- if .RateLimit}}
+        limit_req zone={{.Upstream}}_ratelimit{{if .RateBurst}} burst={{.RateBurst}} nodelay{{end}};
+{{- end}}
+{{- if .HtpasswdFile}}
+        auth_basic "Restricted";
+        auth_basic_user_file {{.HtpasswdFile}};
+{{- end}}
+    }
+{{- end}}
+{{- end}}`))
+
+type backendData struct {
+	Upstream         string
+	Listen           string
+	Hosts            []string
+	Servers          []string
+	Plus             bool
+	Match            *matchData
+	HealthcheckURI   string
+	TLSListen        string
+	TLS              []tlsData
+	ACMEChallengeURL string
+	Allow            []string
+	Deny             []string
+	RateLimit        int
+	RateBurst        int
+	HtpasswdFile     string
+	MaintenancePage  string
+	AccessLog        string
+}
+
+type tlsData struct {
+	Host        string
+	Certificate string
+	Key         string
+}
+
+type matchData struct {
+	Status int
+	Body   string
+}
+
+func upstreamName(name string) string {
+	return "tsuru_" + name
+}
+
+func (r *nginxRouter) configPath(name string) string {
+	return filepath.Join(r.configDir, upstreamName(name)+".conf")
+}
+
+func (r *nginxRouter) htpasswdPath(name string) string {
+	return filepath.Join(r.configDir, "htpasswd", upstreamName(name))
+}
+
+func (r *nginxRouter) maintenancePagePath(name string) string {
+	return filepath.Join(r.configDir, "maintenance", upstreamName(name)+".html")
+}
+
+func (r *nginxRouter) accessLogPath(name string) string {
+	return filepath.Join(r.configDir, "access", upstreamName(name)+".log")
+}
+
+func (r *nginxRouter) certificatePaths(cname string) (string, string) {
+	dir := filepath.Join(r.configDir, "certs")
+	return filepath.Join(dir, cname+".crt"), filepath.Join(dir, cname+".key")
+}
+
+// renderBackend renders the config file of a backend. Custom healthchecks are
+// only rendered when the router is configured for NGINX Plus, as nginx open
+// source doesn't support active health checks. Otherwise servers failing
+// requests are temporarily removed from the upstream. Each cname with a
+// certificate gets its own server block listening for TLS connections. The
+// access policy of the backend applies to all its server blocks. Backends in
+// maintenance answer all requests with their maintenance page. When the
+// activity log is enabled, proxied requests are logged to a file per backend.
+// The healthcheck path and body are quoted, as they come from the apps.
+func (r *nginxRouter) renderBackend(b *backend) ([]byte, error) {
+	data := backendData{
+		Upstream:         upstreamName(b.Name),
+		Listen:           r.listen,
+		Hosts:            append([]string{r.hostname(b.Name)}, b.CNames...),
+		Plus:             r.plus,
+		TLSListen:        r.tlsListen,
+		ACMEChallengeURL: r.acmeChallengeURL,
+	}
+	for _, cname := range b.Certificates {
+		certPath, keyPath := r.certificatePaths(cname)
+		data.TLS = append(data.TLS, tlsData{Host: cname, Certificate: certPath, Key: keyPath})
+	}
+	for _, route := range b.Routes {
+		u, err := url.Parse(route)
+		if err != nil {
+			continue
+		}
+		server := hostPort(u)
+		if !r.plus {
+			server += " max_fails=3 fail_timeout=10s"
+		}
+		data.Servers = append(data.Servers, server)
+	}
+	if len(data.Servers) == 0 {
+		data.Servers = []string{unusedServer}
+	}
+	if b.Maintenance {
+		data.MaintenancePage = r.maintenancePagePath(b.Name)
+	}
+	if r.activityLog {
+		data.AccessLog = r.accessLogPath(b.Name)
+	}
+	if b.AccessPolicy != nil {
+		data.Allow = b.AccessPolicy.Allow
+		data.Deny = b.AccessPolicy.Deny
+		data.RateLimit = b.AccessPolicy.RateLimit
+		data.RateBurst = b.AccessPolicy.RateBurst
+		if b.AccessPolicy.BasicAuth != nil {
+			data.HtpasswdFile = r.htpasswdPath(b.Name)
+		}
+	}
+	if r.plus && b.Healthcheck != nil && b.Healthcheck.Path != "" {
+		data.HealthcheckURI = strconv.Quote("uri=" + b.Healthcheck.Path)
+		data.Match = &matchData{Status: b.Healthcheck.Status}
+		if b.Healthcheck.Body != "" {
+			data.Match.Body = strconv.Quote(b.Healthcheck.Body)
+		}
+	}
+	var buf bytes.Buffer
+	err := backendTemplate.Execute(&buf, data)
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// hostPort returns the address of a route in the host:port format, using the
+// default port for the scheme when the port is not set.
+func hostPort(u *url.URL) string {
+	if _, _, err := net.SplitHostPort(u.Host); err == nil {
+		return u.Host
+	}
+	if u.Scheme == "https" {
+		return net.JoinHostPort(u.Host, "443")
+	}
+	return net.JoinHostPort(u.Host, "80")
+}
+
+// writeFile atomically replaces the content of a file, so that nginx never
+// reads a partially written config.
+func writeFile(path string, content []byte, perm os.FileMode) error {
+	tmpFile := path + ".tmp"
+	err := ioutil.WriteFile(tmpFile, content, perm)
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmpFile, path)
+}
@@ -0,0 +1,823 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package nginx provides a router implementation backed by nginx. The state of
+// the router is stored in MongoDB, and each backend is rendered as a config
+// file, holding an upstream and a server block, in a directory that must be
+// included in the nginx config.
+//
+// It does not provide any exported type, in order to use the router, you must
+// import this package and get the router instance using the function
+// router.Get.
+//
+// In order to use this router, you need to define the "routers:<name>:type =
+// nginx" in your config.
+package nginx
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/tsuru/config"
+	"github.com/tsuru/tsuru/db"
+	"github.com/tsuru/tsuru/db/storage"
+	"github.com/tsuru/tsuru/hc"
+	"github.com/tsuru/tsuru/router"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+const (
+	routerType = "nginx"
+
+	defaultListen    = "80"
+	defaultTLSListen = "443"
+
+	maxAccessLogSize = 1 << 20
+)
+
+// mu serializes the changes in the config files, so that the config test and
+// reload always see a consistent set of files.
+var mu sync.Mutex
+
+func init() {
+	router.Register(routerType, createRouter)
+	hc.AddChecker("Router nginx", router.BuildHealthCheck(routerType))
+}
+
+type nginxRouter struct {
+	routerName       string
+	prefix           string
+	domain           string
+	configDir        string
+	testCommand      string
+	reloadCommand    string
+	pidFile          string
+	listen           string
+	tlsListen        string
+	acmeChallengeURL string
+	plus             bool
+	activityLog      bool
+	collection       string
+}
+
+// backend is the state of a backend stored in MongoDB. AccessLogSize is the
+// size of the access log in the last activity check, and LastActivity the
+// last time the log was seen growing.
+type backend struct {
+	Name          string `bson:"_id"`
+	CNames        []string
+	Routes        []string
+	Healthcheck   *router.HealthcheckData
+	Certificates  []string
+	AccessPolicy  *router.AccessPolicy
+	Maintenance   bool
+	AccessLogSize int64
+	LastActivity  time.Time
+}
+
+func (b *backend) findRoute(address *url.URL) int {
+	for i, r := range b.Routes {
+		u, err := url.Parse(r)
+		if err == nil && u.Host == address.Host {
+			return i
+		}
+	}
+	return -1
+}
+
+func createRouter(routerName, configPrefix string) (router.Router, error) {
+	domain, err := config.GetString(configPrefix + ":domain")
+	if err != nil {
+		return nil, err
+	}
+	configDir, err := config.GetString(configPrefix + ":config-dir")
+	if err != nil {
+		return nil, err
+	}
+	testCommand, _ := config.GetString(configPrefix + ":test-command")
+	reloadCommand, _ := config.GetString(configPrefix + ":reload-command")
+	pidFile, _ := config.GetString(configPrefix + ":pid-file")
+	listen, _ := config.GetString(configPrefix + ":listen")
+	if listen == "" {
+		listen = defaultListen
+	}
+	tlsListen, _ := config.GetString(configPrefix + ":tls-listen")
+	if tlsListen == "" {
+		tlsListen = defaultTLSListen
+	}
+	acmeChallengeURL, _ := config.GetString(configPrefix + ":acme-challenge-url")
+	plus, _ := config.GetBool(configPrefix + ":plus")
+	activityLog, _ := config.GetBool(configPrefix + ":activity-log")
+	collection, _ := config.GetString(configPrefix + ":collection")
+	if collection == "" {
+		collection = "router_nginx_" + routerName
+	}
+	return &nginxRouter{
+		routerName:       routerName,
+		prefix:           configPrefix,
+		domain:           domain,
+		configDir:        configDir,
+		testCommand:      testCommand,
+		reloadCommand:    reloadCommand,
+		pidFile:          pidFile,
+		listen:           listen,
+		tlsListen:        tlsListen,
+		acmeChallengeURL: acmeChallengeURL,
+		plus:             plus,
+		activityLog:      activityLog,
+		collection:       collection,
+	}, nil
+}
+
+func (r *nginxRouter) coll() (*storage.Collection, error) {
+	conn, err := db.Conn()
+	if err != nil {
+		return nil, err
+	}
+	return conn.Collection(r.collection), nil
+}
+
+func (r *nginxRouter) findBackend(name string) (*backend, error) {
+	coll, err := r.coll()
+	if err != nil {
+		return nil, err
+	}
+	defer coll.Close()
+	var b backend
+	err = coll.FindId(name).One(&b)
+	if err == mgo.ErrNotFound {
+		return nil, router.ErrBackendNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &b, nil
+}
+
+func (r *nginxRouter) hostname(name string) string {
+	return fmt.Sprintf("%s.%s", name, r.domain)
+}
+
+// apply writes the config file of a backend, removing it when content is nil,
+// and validates the config using the test command. The state is persisted
+// only when the config is valid, otherwise the previous config file is
+// restored. nginx is reloaded after the state is persisted.
+func (r *nginxRouter) apply(op, name string, content []byte, persist func(coll *storage.Collection) error) error {
+	path := r.configPath(name)
+	previous, err := ioutil.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return &router.RouterError{Op: op, Err: err}
+	}
+	hadPrevious := err == nil
+	if content == nil {
+		err = os.Remove(path)
+		if os.IsNotExist(err) {
+			err = nil
+		}
+	} else {
+		err = writeFile(path, content, 0644)
+		if err == nil && r.activityLog {
+			err = os.MkdirAll(filepath.Dir(r.accessLogPath(name)), 0755)
+		}
+	}
+	if err != nil {
+		return &router.RouterError{Op: op, Err: err}
+	}
+	restore := func() {
+		if hadPrevious {
+			writeFile(path, previous, 0644)
+		} else {
+			os.Remove(path)
+		}
+	}
+	err = r.testConfig()
+	if err != nil {
+		restore()
+		return &router.RouterError{Op: op, Err: err}
+	}
+	coll, err := r.coll()
+	if err != nil {
+		restore()
+		return &router.RouterError{Op: op, Err: err}
+	}
+	defer coll.Close()
+	err = persist(coll)
+	if err != nil {
+		restore()
+		return err
+	}
+	return r.reload()
+}
+
+func (r *nginxRouter) testConfig() error {
+	if r.testCommand == "" {
+		return nil
+	}
+	out, err := exec.Command("/bin/sh", "-c", r.testCommand).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("invalid config: %s: %s", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// reload reloads nginx using the reload command or, when it's not set,
+// sending a SIGHUP to the process in the pid file.
+func (r *nginxRouter) reload() error {
+	if r.reloadCommand != "" {
+		out, err := exec.Command("/bin/sh", "-c", r.reloadCommand).CombinedOutput()
+		if err != nil {
+			return &router.RouterError{Op: "reload", Err: fmt.Errorf("%s: %s", err, strings.TrimSpace(string(out)))}
+		}
+		return nil
+	}
+	if r.pidFile == "" {
+		return nil
+	}
+	data, err := ioutil.ReadFile(r.pidFile)
+	if err != nil {
+		return &router.RouterError{Op: "reload", Err: err}
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil {
+		return &router.RouterError{Op: "reload", Err: fmt.Errorf("invalid pid file %q: %s", r.pidFile, err)}
+	}
+	err = syscall.Kill(pid, syscall.SIGHUP)
+	if err != nil {
+		return &router.RouterError{Op: "reload", Err: err}
+	}
+	return nil
+}
+
+func (r *nginxRouter) AddBackend(name string) error {
+	mu.Lock()
+	defer mu.Unlock()
+	_, err := r.findBackend(name)
+	if err == nil {
+		return router.ErrBackendExists
+	}
+	if err != router.ErrBackendNotFound {
+		return &router.RouterError{Op: "add-backend", Err: err}
+	}
+	b := &backend{Name: name}
+	content, err := r.renderBackend(b)
+	if err != nil {
+		return &router.RouterError{Op: "add-backend", Err: err}
+	}
+	return r.apply("add-backend", name, content, func(coll *storage.Collection) error {
+		err := coll.Insert(b)
+		if mgo.IsDup(err) {
+			return router.ErrBackendExists
+		}
+		if err != nil {
+			return &router.RouterError{Op: "add-backend", Err: err}
+		}
+		return router.Store(name, name, routerType)
+	})
+}
+
+func (r *nginxRouter) RemoveBackend(name string) error {
+	usedName, err := router.Retrieve(name)
+	if err != nil {
+		return err
+	}
+	if usedName != name {
+		return router.ErrBackendSwapped
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	b, err := r.findBackend(usedName)
+	if err != nil {
+		return err
+	}
+	err = r.apply("remove-backend", usedName, nil, func(coll *storage.Collection) error {
+		err := coll.RemoveId(usedName)
+		if err == mgo.ErrNotFound {
+			return router.ErrBackendNotFound
+		}
+		if err != nil {
+			return &router.RouterError{Op: "remove-backend", Err: err}
+		}
+		return router.Remove(usedName)
+	})
+	if err != nil {
+		return err
+	}
+	for _, cname := range b.Certificates {
+		r.removeCertificateFiles(cname)
+	}
+	os.Remove(r.htpasswdPath(usedName))
+	os.Remove(r.maintenancePagePath(usedName))
+	os.Remove(r.accessLogPath(usedName))
+	return nil
+}
+
+// update applies a change to a backend and renders its new config file.
+func (r *nginxRouter) update(op, name string, change func(b *backend) error) error {
+	usedName, err := router.Retrieve(name)
+	if err != nil {
+		return err
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	b, err := r.findBackend(usedName)
+	if err != nil {
+		return err
+	}
+	err = change(b)
+	if err != nil {
+		if err == errNoChanges {
+			return nil
+		}
+		return err
+	}
+	content, err := r.renderBackend(b)
+	if err != nil {
+		return &router.RouterError{Op: op, Err: err}
+	}
+	return r.apply(op, usedName, content, func(coll *storage.Collection) error {
+		err := coll.UpdateId(usedName, b)
+		if err == mgo.ErrNotFound {
+			return router.ErrBackendNotFound
+		}
+		if err != nil {
+			return &router.RouterError{Op: op, Err: err}
+		}
+		return nil
+	})
+}
+
+// errNoChanges is returned by the change functions given to update when the
+// backend was not changed, so that the config is not written.
+var errNoChanges = errors.New("no changes")
+
+func (r *nginxRouter) AddRoute(name string, address *url.URL) error {
+	return r.update("add-route", name, func(b *backend) error {
+		if b.findRoute(address) != -1 {
+			return router.ErrRouteExists
+		}
+		b.Routes = append(b.Routes, address.String())
+		return nil
+	})
+}
+
+func (r *nginxRouter) AddRoutes(name string, addresses []*url.URL) error {
+	return r.update("add-route", name, func(b *backend) error {
+		added := false
+		for _, addr := range addresses {
+			if b.findRoute(addr) == -1 {
+				b.Routes = append(b.Routes, addr.String())
+				added = true
+			}
+		}
+		if !added {
+			return errNoChanges
+		}
+		return nil
+	})
+}
+
+func (r *nginxRouter) RemoveRoute(name string, address *url.URL) error {
+	return r.update("remove-route", name, func(b *backend) error {
+		idx := b.findRoute(address)
+		if idx == -1 {
+			return router.ErrRouteNotFound
+		}
+		b.Routes = append(b.Routes[:idx], b.Routes[idx+1:]...)
+		return nil
+	})
+}
+
+func (r *nginxRouter) RemoveRoutes(name string, addresses []*url.URL) error {
+	return r.update("remove-route", name, func(b *backend) error {
+		removed := false
+		for _, addr := range addresses {
+			if idx := b.findRoute(addr); idx != -1 {
+				b.Routes = append(b.Routes[:idx], b.Routes[idx+1:]...)
+				removed = true
+			}
+		}
+		if !removed {
+			return errNoChanges
+		}
+		return nil
+	})
+}
+
+func (r *nginxRouter) Routes(name string) ([]*url.URL, error) {
+	usedName, err := router.Retrieve(name)
+	if err != nil {
+		return nil, err
+	}
+	b, err := r.findBackend(usedName)
+	if err != nil {
+		return nil, err
+	}
+	routes := make([]*url.URL, 0, len(b.Routes))
+	for _, route := range b.Routes {
+		u, err := url.Parse(route)
+		if err != nil {
+			return nil, &router.RouterError{Op: "routes", Err: err}
+		}
+		routes = append(routes, u)
+	}
+	return routes, nil
+}
+
+func (r *nginxRouter) Addr(name string) (string, error) {
+	usedName, err := router.Retrieve(name)
+	if err != nil {
+		return "", err
+	}
+	_, err = r.findBackend(usedName)
+	if err == router.ErrBackendNotFound {
+		return "", router.ErrRouteNotFound
+	}
+	if err != nil {
+		return "", err
+	}
+	return r.hostname(usedName), nil
+}
+
+func (r *nginxRouter) Swap(backend1, backend2 string, cnameOnly bool) error {
+	return router.Swap(r, backend1, backend2, cnameOnly)
+}
+
+func (r *nginxRouter) CNames(name string) ([]*url.URL, error) {
+	usedName, err := router.Retrieve(name)
+	if err != nil {
+		return nil, err
+	}
+	b, err := r.findBackend(usedName)
+	if err != nil {
+		return nil, err
+	}
+	urls := make([]*url.URL, len(b.CNames))
+	for i, cname := range b.CNames {
+		urls[i] = &url.URL{Host: cname}
+	}
+	return urls, nil
+}
+
+func (r *nginxRouter) SetCName(cname, name string) error {
+	if _, err := router.Retrieve(name); err != nil {
+		return err
+	}
+	if !router.ValidCName(cname, r.domain) {
+		return router.ErrCNameNotAllowed
+	}
+	coll, err := r.coll()
+	if err != nil {
+		return &router.RouterError{Op: "set-cname", Err: err}
+	}
+	n, err := coll.Find(bson.M{"cnames": cname}).Count()
+	coll.Close()
+	if err != nil {
+		return &router.RouterError{Op: "set-cname", Err: err}
+	}
+	if n > 0 {
+		return router.ErrCNameExists
+	}
+	return r.update("set-cname", name, func(b *backend) error {
+		b.CNames = append(b.CNames, cname)
+		return nil
+	})
+}
+
+func (r *nginxRouter) UnsetCName(cname, name string) error {
+	var hadCertificate bool
+	err := r.update("unset-cname", name, func(b *backend) error {
+		idx := indexOf(b.CNames, cname)
+		if idx == -1 {
+			return router.ErrCNameNotFound
+		}
+		b.CNames = append(b.CNames[:idx], b.CNames[idx+1:]...)
+		if idx = indexOf(b.Certificates, cname); idx != -1 {
+			b.Certificates = append(b.Certificates[:idx], b.Certificates[idx+1:]...)
+			hadCertificate = true
+		}
+		return nil
+	})
+	if err == nil && hadCertificate {
+		r.removeCertificateFiles(cname)
+	}
+	return err
+}
+
+func (r *nginxRouter) SetHealthcheck(name string, data router.HealthcheckData) error {
+	if !router.ValidHealthcheckPath(data.Path) {
+		return router.ErrInvalidHealthcheckPath
+	}
+	return r.update("set-healthcheck", name, func(b *backend) error {
+		b.Healthcheck = &data
+		return nil
+	})
+}
+
+// AddCertificate stores the certificate and the key of a cname of the backend,
+// which may also be the hostname of the backend in the router domain, and
+// renders a server block serving the cname over TLS.
+func (r *nginxRouter) AddCertificate(name, cname, certificate, key string) error {
+	var restore func()
+	err := r.update("add-certificate", name, func(b *backend) error {
+		if cname != r.hostname(b.Name) && indexOf(b.CNames, cname) == -1 {
+			return router.ErrCNameNotFound
+		}
+		var err error
+		restore, err = r.writeCertificateFiles(cname, certificate, key)
+		if err != nil {
+			return &router.RouterError{Op: "add-certificate", Err: err}
+		}
+		if indexOf(b.Certificates, cname) == -1 {
+			b.Certificates = append(b.Certificates, cname)
+		}
+		return nil
+	})
+	if err != nil && restore != nil {
+		restore()
+	}
+	return err
+}
+
+func (r *nginxRouter) RemoveCertificate(name, cname string) error {
+	err := r.update("remove-certificate", name, func(b *backend) error {
+		idx := indexOf(b.Certificates, cname)
+		if idx == -1 {
+			return router.ErrCertificateNotFound
+		}
+		b.Certificates = append(b.Certificates[:idx], b.Certificates[idx+1:]...)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	r.removeCertificateFiles(cname)
+	return nil
+}
+
+func (r *nginxRouter) Certificate(name, cname string) (string, error) {
+	usedName, err := router.Retrieve(name)
+	if err != nil {
+		return "", err
+	}
+	b, err := r.findBackend(usedName)
+	if err != nil {
+		return "", err
+	}
+	if indexOf(b.Certificates, cname) == -1 {
+		return "", router.ErrCertificateNotFound
+	}
+	certPath, _ := r.certificatePaths(cname)
+	data, err := ioutil.ReadFile(certPath)
+	if err != nil {
+		return "", &router.RouterError{Op: "certificate", Err: err}
+	}
+	return string(data), nil
+}
+
+// SetAccessPolicy sets the access policy of the backend. The credentials of
+// the basic auth are written in a htpasswd file referenced by the config.
+func (r *nginxRouter) SetAccessPolicy(name string, policy router.AccessPolicy) error {
+	var restore func()
+	var backendName string
+	err := r.update("set-access-policy", name, func(b *backend) error {
+		backendName = b.Name
+		if policy.Empty() {
+			b.AccessPolicy = nil
+			return nil
+		}
+		b.AccessPolicy = &policy
+		if policy.BasicAuth == nil {
+			return nil
+		}
+		var err error
+		restore, err = r.writeHtpasswdFile(b.Name, policy.BasicAuth)
+		if err != nil {
+			return &router.RouterError{Op: "set-access-policy", Err: err}
+		}
+		return nil
+	})
+	if err != nil {
+		if restore != nil {
+			restore()
+		}
+		return err
+	}
+	if policy.BasicAuth == nil {
+		os.Remove(r.htpasswdPath(backendName))
+	}
+	return nil
+}
+
+// SetMaintenance writes the maintenance page of the backend and makes nginx
+// serve it instead of proxying the requests to the upstream.
+func (r *nginxRouter) SetMaintenance(name string, page string) error {
+	var restore func()
+	err := r.update("set-maintenance", name, func(b *backend) error {
+		var err error
+		restore, err = r.writeMaintenancePage(b.Name, page)
+		if err != nil {
+			return &router.RouterError{Op: "set-maintenance", Err: err}
+		}
+		b.Maintenance = true
+		return nil
+	})
+	if err != nil && restore != nil {
+		restore()
+	}
+	return err
+}
+
+func (r *nginxRouter) UnsetMaintenance(name string) error {
+	var backendName string
+	err := r.update("unset-maintenance", name, func(b *backend) error {
+		backendName = b.Name
+		if !b.Maintenance {
+			return errNoChanges
+		}
+		b.Maintenance = false
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if backendName != "" {
+		os.Remove(r.maintenancePagePath(backendName))
+	}
+	return nil
+}
+
+func (r *nginxRouter) TracksActivity() bool {
+	return r.activityLog
+}
+
+// LastActivity returns the last time the access log of the backend, which
+// nginx writes on every request, was seen growing. The size of the log is
+// stored on every check, as its modification time also changes when the log
+// is truncated, which happens once it gets larger than maxAccessLogSize.
+func (r *nginxRouter) LastActivity(name string) (time.Time, error) {
+	if !r.activityLog {
+		return time.Time{}, router.ErrActivityNotTracked
+	}
+	usedName, err := router.Retrieve(name)
+	if err != nil {
+		return time.Time{}, err
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	b, err := r.findBackend(usedName)
+	if err != nil {
+		return time.Time{}, err
+	}
+	path := r.accessLogPath(usedName)
+	info, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return b.LastActivity, nil
+	}
+	if err != nil {
+		return time.Time{}, &router.RouterError{Op: "last-activity", Err: err}
+	}
+	size := info.Size()
+	if size == b.AccessLogSize {
+		return b.LastActivity, nil
+	}
+	last := b.LastActivity
+	if size > 0 {
+		last = info.ModTime().UTC()
+	}
+	if size > maxAccessLogSize {
+		err = os.Truncate(path, 0)
+		if err != nil {
+			return time.Time{}, &router.RouterError{Op: "last-activity", Err: err}
+		}
+		size = 0
+	}
+	coll, err := r.coll()
+	if err != nil {
+		return time.Time{}, &router.RouterError{Op: "last-activity", Err: err}
+	}
+	defer coll.Close()
+	err = coll.UpdateId(usedName, bson.M{"$set": bson.M{"accesslogsize": size, "lastactivity": last}})
+	if err != nil {
+		return time.Time{}, &router.RouterError{Op: "last-activity", Err: err}
+	}
+	return last, nil
+}
+
+// writeMaintenancePage writes the maintenance page of a backend, returning a
+// function that restores the previous page.
+func (r *nginxRouter) writeMaintenancePage(name, page string) (func(), error) {
+	path := r.maintenancePagePath(name)
+	err := os.MkdirAll(filepath.Dir(path), 0755)
+	if err != nil {
+		return nil, err
+	}
+	previous, readErr := ioutil.ReadFile(path)
+	restore := func() {
+		if readErr == nil {
+			writeFile(path, previous, 0644)
+		} else {
+			os.Remove(path)
+		}
+	}
+	err = writeFile(path, []byte(page), 0644)
+	if err != nil {
+		restore()
+		return nil, err
+	}
+	return restore, nil
+}
+
+// writeHtpasswdFile writes the credentials of a backend, returning a
+// function that restores the previous file.
+func (r *nginxRouter) writeHtpasswdFile(name string, auth *router.BasicAuth) (func(), error) {
+	path := r.htpasswdPath(name)
+	err := os.MkdirAll(filepath.Dir(path), 0700)
+	if err != nil {
+		return nil, err
+	}
+	previous, readErr := ioutil.ReadFile(path)
+	restore := func() {
+		if readErr == nil {
+			writeFile(path, previous, 0644)
+		} else {
+			os.Remove(path)
+		}
+	}
+	err = writeFile(path, []byte(auth.Username+":"+auth.PasswordHash+"\n"), 0644)
+	if err != nil {
+		restore()
+		return nil, err
+	}
+	return restore, nil
+}
+
+// writeCertificateFiles writes the certificate and the key of a cname,
+// returning a function that restores the previous files.
+func (r *nginxRouter) writeCertificateFiles(cname, certificate, key string) (func(), error) {
+	certPath, keyPath := r.certificatePaths(cname)
+	err := os.MkdirAll(filepath.Dir(certPath), 0700)
+	if err != nil {
+		return nil, err
+	}
+	previousCert, certErr := ioutil.ReadFile(certPath)
+	previousKey, keyErr := ioutil.ReadFile(keyPath)
+	restore := func() {
+		if certErr == nil && keyErr == nil {
+			writeFile(certPath, previousCert, 0644)
+			writeFile(keyPath, previousKey, 0600)
+		} else {
+			r.removeCertificateFiles(cname)
+		}
+	}
+	err = writeFile(certPath, []byte(certificate), 0644)
+	if err == nil {
+		err = writeFile(keyPath, []byte(key), 0600)
+	}
+	if err != nil {
+		restore()
+		return nil, err
+	}
+	return restore, nil
+}
+
+func (r *nginxRouter) removeCertificateFiles(cname string) {
+	certPath, keyPath := r.certificatePaths(cname)
+	os.Remove(certPath)
+	os.Remove(keyPath)
+}
+
+func indexOf(values []string, value string) int {
+	for i, v := range values {
+		if v == value {
+			return i
+		}
+	}
+	return -1
+}
+
+func (r *nginxRouter) StartupMessage() (string, error) {
+	return fmt.Sprintf("nginx router %q with config dir %q", r.domain, r.configDir), nil
+}
+
+func (r *nginxRouter) HealthCheck() error {
+	info, err := os.Stat(r.configDir)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("%q is not a directory", r.configDir)
+	}
+	return r.testConfig()
+}
@@ -0,0 +1,512 @@
+// Copyright 2016 tsuru authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package nginx
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/tsuru/config"
+	"github.com/tsuru/tsuru/db"
+	"github.com/tsuru/tsuru/db/dbtest"
+	"github.com/tsuru/tsuru/router"
+	"github.com/tsuru/tsuru/router/routertest"
+	"gopkg.in/check.v1"
+)
+
+func Test(t *testing.T) {
+	check.TestingT(t)
+}
+
+type S struct {
+	conn      *db.Storage
+	configDir string
+}
+
+var _ = check.Suite(&S{})
+
+func init() {
+	base := &S{}
+	suite := &routertest.RouterSuite{
+		SetUpSuiteFunc:   base.SetUpSuite,
+		TearDownTestFunc: base.TearDownTest,
+	}
+	suite.SetUpTestFunc = func(c *check.C) {
+		config.Set("database:name", "router_generic_nginx_tests")
+		base.SetUpTest(c)
+		r, err := router.Get("nginx")
+		c.Assert(err, check.IsNil)
+		suite.Router = r
+	}
+	check.Suite(suite)
+}
+
+func (s *S) SetUpSuite(c *check.C) {
+	config.Set("routers:nginx:type", "nginx")
+	config.Set("routers:nginx:domain", "nginx.example.com")
+	config.Set("routers:nginx:test-command", "true")
+	config.Set("database:url", "127.0.0.1:27017")
+	config.Set("database:name", "router_nginx_tests")
+}
+
+func (s *S) SetUpTest(c *check.C) {
+	var err error
+	s.conn, err = db.Conn()
+	c.Assert(err, check.IsNil)
+	dbtest.ClearAllCollections(s.conn.Collection("router_nginx_tests").Database)
+	s.configDir = c.MkDir()
+	config.Set("routers:nginx:config-dir", s.configDir)
+	config.Unset("routers:nginx:reload-command")
+	config.Unset("routers:nginx:pid-file")
+	config.Unset("routers:nginx:plus")
+	config.Unset("routers:nginx:acme-challenge-url")
+	config.Unset("routers:nginx:activity-log")
+}
+
+func (s *S) TearDownTest(c *check.C) {
+	s.conn.Close()
+}
+
+func (s *S) TearDownSuite(c *check.C) {
+	conn, err := db.Conn()
+	c.Assert(err, check.IsNil)
+	defer conn.Close()
+	conn.Apps().Database.DropDatabase()
+}
+
+func (s *S) readConfig(c *check.C, name string) string {
+	data, err := ioutil.ReadFile(filepath.Join(s.configDir, "tsuru_"+name+".conf"))
+	c.Assert(err, check.IsNil)
+	return string(data)
+}
+
+func (s *S) TestShouldBeRegistered(c *check.C) {
+	got, err := router.Get("nginx")
+	c.Assert(err, check.IsNil)
+	r, ok := got.(*nginxRouter)
+	c.Assert(ok, check.Equals, true)
+	c.Assert(r.domain, check.Equals, "nginx.example.com")
+	c.Assert(r.configDir, check.Equals, s.configDir)
+	c.Assert(r.testCommand, check.Equals, "true")
+	c.Assert(r.listen, check.Equals, "80")
+	c.Assert(r.tlsListen, check.Equals, "443")
+	c.Assert(r.collection, check.Equals, "router_nginx_nginx")
+}
+
+func (s *S) TestAddBackendWritesConfig(c *check.C) {
+	r, err := router.Get("nginx")
+	c.Assert(err, check.IsNil)
+	err = r.AddBackend("myapp")
+	c.Assert(err, check.IsNil)
+	c.Assert(s.readConfig(c, "myapp"), check.Equals, `# This file is generated by tsuru, changes will be overwritten.
+upstream tsuru_myapp {
+    server 127.0.0.1:1 down;
+}
+
+server {
+    listen 80;
+    server_name myapp.nginx.example.com;
+
+    location / {
+        proxy_pass http://tsuru_myapp;
+        proxy_set_header Host $host;
+        proxy_set_header X-Real-IP $remote_addr;
+        proxy_set_header X-Forwarded-For $proxy_add_x_forwarded_for;
+    }
+}
+`)
+	err = r.RemoveBackend("myapp")
+	c.Assert(err, check.IsNil)
+	_, err = os.Stat(filepath.Join(s.configDir, "tsuru_myapp.conf"))
+	c.Assert(os.IsNotExist(err), check.Equals, true)
+}
+
+func (s *S) TestAddRoutesAndCNamesWritesConfig(c *check.C) {
+	r, err := router.Get("nginx")
+	c.Assert(err, check.IsNil)
+	err = r.AddBackend("myapp")
+	c.Assert(err, check.IsNil)
+	addr1, _ := url.Parse("http://10.0.0.1:8080")
+	addr2, _ := url.Parse("http://10.0.0.2")
+	err = r.AddRoutes("myapp", []*url.URL{addr1, addr2})
+	c.Assert(err, check.IsNil)
+	err = r.(router.CNameRouter).SetCName("myapp.io", "myapp")
+	c.Assert(err, check.IsNil)
+	cfg := s.readConfig(c, "myapp")
+	c.Assert(cfg, check.Matches, `(?s).*upstream tsuru_myapp {
+    server 10.0.0.1:8080 max_fails=3 fail_timeout=10s;
+    server 10.0.0.2:80 max_fails=3 fail_timeout=10s;
+}.*`)
+	c.Assert(cfg, check.Matches, `(?s).*server_name myapp.nginx.example.com myapp.io;.*`)
+}
+
+func (s *S) TestSetHealthcheckPlus(c *check.C) {
+	config.Set("routers:nginx:plus", true)
+	r, err := router.Get("nginx")
+	c.Assert(err, check.IsNil)
+	err = r.AddBackend("myapp")
+	c.Assert(err, check.IsNil)
+	err = r.(router.CustomHealthcheckRouter).SetHealthcheck("myapp", router.HealthcheckData{
+		Path:   "/healthcheck",
+		Status: 200,
+		Body:   "WORKING",
+	})
+	c.Assert(err, check.IsNil)
+	cfg := s.readConfig(c, "myapp")
+	c.Assert(cfg, check.Matches, `(?s).*    zone tsuru_myapp 64k;\n.*`)
+	c.Assert(cfg, check.Matches, `(?s).*match tsuru_myapp_hc {
+    status 200;
+    body ~ "WORKING";
+}.*`)
+	c.Assert(cfg, check.Matches, `(?s).*        health_check "uri=/healthcheck" match=tsuru_myapp_hc;\n.*`)
+}
+
+func (s *S) TestSetHealthcheckInvalidPath(c *check.C) {
+	config.Set("routers:nginx:plus", true)
+	r, err := router.Get("nginx")
+	c.Assert(err, check.IsNil)
+	err = r.AddBackend("myapp")
+	c.Assert(err, check.IsNil)
+	previous := s.readConfig(c, "myapp")
+	hcRouter := r.(router.CustomHealthcheckRouter)
+	err = hcRouter.SetHealthcheck("myapp", router.HealthcheckData{Path: "/;} server { listen 8080; ", Status: 200})
+	c.Assert(err, check.Equals, router.ErrInvalidHealthcheckPath)
+	err = hcRouter.SetHealthcheck("myapp", router.HealthcheckData{Path: "healthcheck", Status: 200})
+	c.Assert(err, check.Equals, router.ErrInvalidHealthcheckPath)
+	c.Assert(s.readConfig(c, "myapp"), check.Equals, previous)
+}
+
+func (s *S) TestSetHealthcheckQuotesPath(c *check.C) {
+	config.Set("routers:nginx:plus", true)
+	r, err := router.Get("nginx")
+	c.Assert(err, check.IsNil)
+	err = r.AddBackend("myapp")
+	c.Assert(err, check.IsNil)
+	err = r.(router.CustomHealthcheckRouter).SetHealthcheck("myapp", router.HealthcheckData{
+		Path:   "/health;deny=all}",
+		Status: 200,
+	})
+	c.Assert(err, check.IsNil)
+	cfg := s.readConfig(c, "myapp")
+	c.Assert(cfg, check.Matches, `(?s).*        health_check "uri=/health;deny=all}" match=tsuru_myapp_hc;\n.*`)
+}
+
+func (s *S) TestInvalidConfigRestoresPreviousFile(c *check.C) {
+	r, err := router.Get("nginx")
+	c.Assert(err, check.IsNil)
+	err = r.AddBackend("myapp")
+	c.Assert(err, check.IsNil)
+	previous := s.readConfig(c, "myapp")
+	config.Set("routers:nginx:test-command", "echo bad config; false")
+	defer config.Set("routers:nginx:test-command", "true")
+	r, err = router.Get("nginx")
+	c.Assert(err, check.IsNil)
+	addr, _ := url.Parse("http://10.0.0.1:8080")
+	err = r.AddRoute("myapp", addr)
+	c.Assert(err, check.ErrorMatches, `\[router add-route\] invalid config: exit status 1: bad config`)
+	c.Assert(s.readConfig(c, "myapp"), check.Equals, previous)
+	routes, err := r.Routes("myapp")
+	c.Assert(err, check.IsNil)
+	c.Assert(routes, check.HasLen, 0)
+	err = r.AddBackend("otherapp")
+	c.Assert(err, check.NotNil)
+	_, err = os.Stat(filepath.Join(s.configDir, "tsuru_otherapp.conf"))
+	c.Assert(os.IsNotExist(err), check.Equals, true)
+	_, err = r.Addr("otherapp")
+	c.Assert(err, check.Equals, router.ErrBackendNotFound)
+}
+
+func (s *S) TestAddCertificateWritesConfig(c *check.C) {
+	r, err := router.Get("nginx")
+	c.Assert(err, check.IsNil)
+	err = r.AddBackend("myapp")
+	c.Assert(err, check.IsNil)
+	err = r.(router.CNameRouter).SetCName("myapp.io", "myapp")
+	c.Assert(err, check.IsNil)
+	tlsRouter := r.(router.TLSRouter)
+	err = tlsRouter.AddCertificate("myapp", "other.io", "cert", "key")
+	c.Assert(err, check.Equals, router.ErrCNameNotFound)
+	err = tlsRouter.AddCertificate("myapp", "myapp.io", "cert", "key")
+	c.Assert(err, check.IsNil)
+	certPath := filepath.Join(s.configDir, "certs", "myapp.io.crt")
+	keyPath := filepath.Join(s.configDir, "certs", "myapp.io.key")
+	data, err := ioutil.ReadFile(certPath)
+	c.Assert(err, check.IsNil)
+	c.Assert(string(data), check.Equals, "cert")
+	info, err := os.Stat(keyPath)
+	c.Assert(err, check.IsNil)
+	c.Assert(info.Mode().Perm(), check.Equals, os.FileMode(0600))
+	c.Assert(s.readConfig(c, "myapp"), check.Matches, `(?s).*server {
+    listen 443 ssl;
+    server_name myapp.io;
+    ssl_certificate `+certPath+`;
+    ssl_certificate_key `+keyPath+`;
+
+    location / {
+        proxy_pass http://tsuru_myapp;.*`)
+	err = r.(router.CNameRouter).UnsetCName("myapp.io", "myapp")
+	c.Assert(err, check.IsNil)
+	c.Assert(s.readConfig(c, "myapp"), check.Not(check.Matches), `(?s).*listen 443 ssl;.*`)
+	_, err = os.Stat(certPath)
+	c.Assert(os.IsNotExist(err), check.Equals, true)
+	_, err = tlsRouter.Certificate("myapp", "myapp.io")
+	c.Assert(err, check.Equals, router.ErrCertificateNotFound)
+}
+
+func (s *S) TestAddCertificateInvalidConfigRestoresFiles(c *check.C) {
+	r, err := router.Get("nginx")
+	c.Assert(err, check.IsNil)
+	err = r.AddBackend("myapp")
+	c.Assert(err, check.IsNil)
+	err = r.(router.TLSRouter).AddCertificate("myapp", "myapp.nginx.example.com", "cert", "key")
+	c.Assert(err, check.IsNil)
+	config.Set("routers:nginx:test-command", "false")
+	defer config.Set("routers:nginx:test-command", "true")
+	r, err = router.Get("nginx")
+	c.Assert(err, check.IsNil)
+	err = r.(router.TLSRouter).AddCertificate("myapp", "myapp.nginx.example.com", "invalid cert", "invalid key")
+	c.Assert(err, check.NotNil)
+	cert, err := r.(router.TLSRouter).Certificate("myapp", "myapp.nginx.example.com")
+	c.Assert(err, check.IsNil)
+	c.Assert(cert, check.Equals, "cert")
+}
+
+func (s *S) TestACMEChallengeLocation(c *check.C) {
+	config.Set("routers:nginx:acme-challenge-url", "http://tsuru.example.com:8080")
+	r, err := router.Get("nginx")
+	c.Assert(err, check.IsNil)
+	err = r.AddBackend("myapp")
+	c.Assert(err, check.IsNil)
+	c.Assert(s.readConfig(c, "myapp"), check.Matches, `(?s).*server_name myapp.nginx.example.com;
+
+    location /.well-known/acme-challenge/ {
+        proxy_pass http://tsuru.example.com:8080;
+    }
+
+    location / {.*`)
+}
+
+func (s *S) TestSetAccessPolicy(c *check.C) {
+	r, err := router.Get("nginx")
+	c.Assert(err, check.IsNil)
+	err = r.AddBackend("myapp")
+	c.Assert(err, check.IsNil)
+	err = r.(router.AccessPolicyRouter).SetAccessPolicy("myapp", router.AccessPolicy{
+		Allow:     []string{"10.0.0.0/8", "192.168.0.1/32"},
+		Deny:      []string{"10.1.0.0/16"},
+		RateLimit: 10,
+		RateBurst: 20,
+		BasicAuth: &router.BasicAuth{Username: "user", PasswordHash: "{SHA}hash"},
+	})
+	c.Assert(err, check.IsNil)
+	htpasswdPath := filepath.Join(s.configDir, "htpasswd", "tsuru_myapp")
+	data, err := ioutil.ReadFile(htpasswdPath)
+	c.Assert(err, check.IsNil)
+	c.Assert(string(data), check.Equals, "user:{SHA}hash\n")
+	c.Assert(s.readConfig(c, "myapp"), check.Matches, `(?s).*
+limit_req_zone \$binary_remote_addr zone=tsuru_myapp_ratelimit:10m rate=10r/s;
+
+server {.*
+        proxy_set_header X-Forwarded-For \$proxy_add_x_forwarded_for;
+        deny 10.1.0.0/16;
+        allow 10.0.0.0/8;
+        allow 192.168.0.1/32;
+        deny all;
+        limit_req zone=tsuru_myapp_ratelimit burst=20 nodelay;
+        auth_basic "Restricted";
+        auth_basic_user_file `+htpasswdPath+`;
+    }.*`)
+	err = r.(router.AccessPolicyRouter).SetAccessPolicy("myapp", router.AccessPolicy{})
+	c.Assert(err, check.IsNil)
+	content := s.readConfig(c, "myapp")
+	c.Assert(content, check.Not(check.Matches), `(?s).*limit_req.*`)
+	c.Assert(content, check.Not(check.Matches), `(?s).*allow.*`)
+	c.Assert(content, check.Not(check.Matches), `(?s).*auth_basic.*`)
+	_, err = os.Stat(htpasswdPath)
+	c.Assert(os.IsNotExist(err), check.Equals, true)
+}
+
+func (s *S) TestSetAccessPolicyRateLimitPlus(c *check.C) {
+	config.Set("routers:nginx:plus", true)
+	r, err := router.Get("nginx")
+	c.Assert(err, check.IsNil)
+	err = r.AddBackend("myapp")
+	c.Assert(err, check.IsNil)
+	err = r.(router.AccessPolicyRouter).SetAccessPolicy("myapp", router.AccessPolicy{RateLimit: 10})
+	c.Assert(err, check.IsNil)
+	cfg := s.readConfig(c, "myapp")
+	c.Assert(cfg, check.Matches, `(?s).*    zone tsuru_myapp 64k;\n.*`)
+	c.Assert(cfg, check.Matches, `(?s).*limit_req_zone \$binary_remote_addr zone=tsuru_myapp_ratelimit:10m rate=10r/s;\n.*`)
+	c.Assert(cfg, check.Matches, `(?s).*        limit_req zone=tsuru_myapp_ratelimit;\n.*`)
+}
+
+func (s *S) TestRemoveBackendRemovesHtpasswdFile(c *check.C) {
+	r, err := router.Get("nginx")
+	c.Assert(err, check.IsNil)
+	err = r.AddBackend("myapp")
+	c.Assert(err, check.IsNil)
+	err = r.(router.AccessPolicyRouter).SetAccessPolicy("myapp", router.AccessPolicy{
+		BasicAuth: &router.BasicAuth{Username: "user", PasswordHash: "{SHA}hash"},
+	})
+	c.Assert(err, check.IsNil)
+	err = r.RemoveBackend("myapp")
+	c.Assert(err, check.IsNil)
+	_, err = os.Stat(filepath.Join(s.configDir, "htpasswd", "tsuru_myapp"))
+	c.Assert(os.IsNotExist(err), check.Equals, true)
+}
+
+func (s *S) TestSetMaintenance(c *check.C) {
+	r, err := router.Get("nginx")
+	c.Assert(err, check.IsNil)
+	err = r.AddBackend("myapp")
+	c.Assert(err, check.IsNil)
+	err = r.(router.MaintenanceRouter).SetMaintenance("myapp", "<h1>maintenance</h1>")
+	c.Assert(err, check.IsNil)
+	pagePath := filepath.Join(s.configDir, "maintenance", "tsuru_myapp.html")
+	data, err := ioutil.ReadFile(pagePath)
+	c.Assert(err, check.IsNil)
+	c.Assert(string(data), check.Equals, "<h1>maintenance</h1>")
+	c.Assert(s.readConfig(c, "myapp"), check.Matches, `(?s).*server_name myapp.nginx.example.com;
+
+    error_page 503 /tsuru-maintenance.html;
+
+    location = /tsuru-maintenance.html {
+        internal;
+        default_type text/html;
+        alias `+pagePath+`;
+    }
+
+    location / {
+        return 503;
+    }
+}
+`)
+	err = r.(router.MaintenanceRouter).UnsetMaintenance("myapp")
+	c.Assert(err, check.IsNil)
+	content := s.readConfig(c, "myapp")
+	c.Assert(content, check.Not(check.Matches), `(?s).*return 503;.*`)
+	c.Assert(content, check.Matches, `(?s).*proxy_pass http://tsuru_myapp;.*`)
+	_, err = os.Stat(pagePath)
+	c.Assert(os.IsNotExist(err), check.Equals, true)
+}
+
+func (s *S) TestLastActivity(c *check.C) {
+	config.Set("routers:nginx:activity-log", true)
+	r, err := router.Get("nginx")
+	c.Assert(err, check.IsNil)
+	err = r.AddBackend("myapp")
+	c.Assert(err, check.IsNil)
+	logPath := filepath.Join(s.configDir, "access", "tsuru_myapp.log")
+	c.Assert(s.readConfig(c, "myapp"), check.Matches, `(?s).*proxy_set_header X-Forwarded-For \$proxy_add_x_forwarded_for;
+        access_log `+logPath+`;
+    }.*`)
+	activityRouter := r.(router.ActivityRouter)
+	c.Assert(activityRouter.TracksActivity(), check.Equals, true)
+	last, err := activityRouter.LastActivity("myapp")
+	c.Assert(err, check.IsNil)
+	c.Assert(last.IsZero(), check.Equals, true)
+	err = ioutil.WriteFile(logPath, []byte("GET / 200\n"), 0644)
+	c.Assert(err, check.IsNil)
+	requestTime := time.Now().Add(-time.Hour).Truncate(time.Second)
+	err = os.Chtimes(logPath, requestTime, requestTime)
+	c.Assert(err, check.IsNil)
+	last, err = activityRouter.LastActivity("myapp")
+	c.Assert(err, check.IsNil)
+	c.Assert(last.Equal(requestTime), check.Equals, true)
+	err = r.RemoveBackend("myapp")
+	c.Assert(err, check.IsNil)
+	_, err = os.Stat(logPath)
+	c.Assert(os.IsNotExist(err), check.Equals, true)
+}
+
+func (s *S) TestLastActivityTruncatesLargeLog(c *check.C) {
+	config.Set("routers:nginx:activity-log", true)
+	r, err := router.Get("nginx")
+	c.Assert(err, check.IsNil)
+	err = r.AddBackend("myapp")
+	c.Assert(err, check.IsNil)
+	logPath := filepath.Join(s.configDir, "access", "tsuru_myapp.log")
+	err = ioutil.WriteFile(logPath, make([]byte, maxAccessLogSize+1), 0644)
+	c.Assert(err, check.IsNil)
+	requestTime := time.Now().Add(-time.Hour).Truncate(time.Second)
+	err = os.Chtimes(logPath, requestTime, requestTime)
+	c.Assert(err, check.IsNil)
+	activityRouter := r.(router.ActivityRouter)
+	last, err := activityRouter.LastActivity("myapp")
+	c.Assert(err, check.IsNil)
+	c.Assert(last.Equal(requestTime), check.Equals, true)
+	info, err := os.Stat(logPath)
+	c.Assert(err, check.IsNil)
+	c.Assert(info.Size(), check.Equals, int64(0))
+	last, err = activityRouter.LastActivity("myapp")
+	c.Assert(err, check.IsNil)
+	c.Assert(last.Equal(requestTime), check.Equals, true)
+	err = ioutil.WriteFile(logPath, []byte("GET / 200\n"), 0644)
+	c.Assert(err, check.IsNil)
+	last, err = activityRouter.LastActivity("myapp")
+	c.Assert(err, check.IsNil)
+	c.Assert(last.After(requestTime), check.Equals, true)
+}
+
+func (s *S) TestLastActivityNotTracked(c *check.C) {
+	r, err := router.Get("nginx")
+	c.Assert(err, check.IsNil)
+	err = r.AddBackend("myapp")
+	c.Assert(err, check.IsNil)
+	c.Assert(s.readConfig(c, "myapp"), check.Not(check.Matches), `(?s).*access_log.*`)
+	c.Assert(r.(router.ActivityRouter).TracksActivity(), check.Equals, false)
+	_, err = r.(router.ActivityRouter).LastActivity("myapp")
+	c.Assert(err, check.Equals, router.ErrActivityNotTracked)
+}
+
+func (s *S) TestReloadCommand(c *check.C) {
+	reloadFile := filepath.Join(c.MkDir(), "reloaded")
+	config.Set("routers:nginx:reload-command", "touch "+reloadFile)
+	r, err := router.Get("nginx")
+	c.Assert(err, check.IsNil)
+	err = r.AddBackend("myapp")
+	c.Assert(err, check.IsNil)
+	_, err = os.Stat(reloadFile)
+	c.Assert(err, check.IsNil)
+}
+
+func (s *S) TestReloadSignal(c *check.C) {
+	cmd := exec.Command("sleep", "30")
+	err := cmd.Start()
+	c.Assert(err, check.IsNil)
+	defer cmd.Process.Kill()
+	pidFile := filepath.Join(c.MkDir(), "nginx.pid")
+	err = ioutil.WriteFile(pidFile, []byte(fmt.Sprintf("%d\n", cmd.Process.Pid)), 0644)
+	c.Assert(err, check.IsNil)
+	config.Set("routers:nginx:pid-file", pidFile)
+	r, err := router.Get("nginx")
+	c.Assert(err, check.IsNil)
+	err = r.AddBackend("myapp")
+	c.Assert(err, check.IsNil)
+	err = cmd.Wait()
+	c.Assert(err, check.NotNil)
+	status := cmd.ProcessState.Sys().(syscall.WaitStatus)
+	c.Assert(status.Signal(), check.Equals, syscall.SIGHUP)
+}
+
+func (s *S) TestHealthCheck(c *check.C) {
+	r, err := router.Get("nginx")
+	c.Assert(err, check.IsNil)
+	err = r.(router.HealthChecker).HealthCheck()
+	c.Assert(err, check.IsNil)
+	config.Set("routers:nginx:test-command", "false")
+	defer config.Set("routers:nginx:test-command", "true")
+	r, err = router.Get("nginx")
+	c.Assert(err, check.IsNil)
+	err = r.(router.HealthChecker).HealthCheck()
+	c.Assert(err, check.NotNil)
+}
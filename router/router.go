@@ -12,6 +12,8 @@ import (
 	"net/url"
 	"sort"
 	"strings"
+	"time"
+	"unicode"
 
 	"github.com/tsuru/config"
 	"github.com/tsuru/tsuru/db"
@@ -32,6 +34,20 @@ var (
 	ErrCNameExists     = errors.New("CName already exists")
 	ErrCNameNotFound   = errors.New("CName not found")
 	ErrCNameNotAllowed = errors.New("CName as router subdomain not allowed")
+
+	ErrActivityNotTracked = errors.New("Router is not tracking the activity of backends")
+
+	ErrBasicAuthNotSupported = errors.New("Router doesn't support basic auth in access policies")
+
+	ErrInvalidHealthcheckPath = errors.New("Healthcheck path must start with / and must not contain whitespace or control characters")
+
+	ErrCertificateNotFound = errors.New("Certificate not found")
+
+	ErrMountExists             = errors.New("Mount already exists")
+	ErrMountNotFound           = errors.New("Mount not found")
+	ErrStripPrefixNotSupported = errors.New("Router doesn't support stripping the mount path")
+	ErrMountDomainNotAllowed   = errors.New("Mount domain as router subdomain not allowed")
+	ErrMountDomainInUse        = errors.New("Mount domain is used by a backend of the router")
 )
 
 const HttpScheme = "http"
@@ -99,6 +115,78 @@ type CNameRouter interface {
 	CNames(name string) ([]*url.URL, error)
 }
 
+// TLSRouter is a router that is able to serve backends over TLS, using a
+// certificate and a key for each cname.
+type TLSRouter interface {
+	AddCertificate(name, cname, certificate, key string) error
+	RemoveCertificate(name, cname string) error
+	Certificate(name, cname string) (string, error)
+}
+
+// Mount is a path prefix of a shared domain in which a backend is served.
+// When StripPrefix is set, the path is removed from the requests before
+// they're forwarded to the backend.
+type Mount struct {
+	Domain      string
+	Path        string
+	StripPrefix bool
+}
+
+// PathRouter is a router able to serve backends at path prefixes of shared
+// domains, allowing multiple backends to be served by the same domain.
+type PathRouter interface {
+	AddMount(name string, mount Mount) error
+	RemoveMount(name string, mount Mount) error
+}
+
+// AccessPolicy restricts the access to a backend. Requests from addresses in
+// Deny are always rejected and, when Allow is not empty, only requests from
+// addresses in Allow are accepted. RateLimit is the number of requests per
+// second accepted from each client address, with bursts of up to RateBurst
+// requests, zero meaning no limit.
+type AccessPolicy struct {
+	Allow     []string   `json:"allow,omitempty"`
+	Deny      []string   `json:"deny,omitempty"`
+	RateLimit int        `json:"ratelimit,omitempty"`
+	RateBurst int        `json:"rateburst,omitempty"`
+	BasicAuth *BasicAuth `json:"basicauth,omitempty"`
+}
+
+// Empty returns whether the policy doesn't restrict the access at all.
+func (p *AccessPolicy) Empty() bool {
+	return len(p.Allow) == 0 && len(p.Deny) == 0 && p.RateLimit == 0 && p.BasicAuth == nil
+}
+
+// BasicAuth holds the credentials required by a backend. The password is
+// hashed in a format accepted by htpasswd files.
+type BasicAuth struct {
+	Username     string `json:"username"`
+	PasswordHash string `json:"-"`
+}
+
+// AccessPolicyRouter is a router able to restrict the access to backends. An
+// empty policy removes any restriction previously set.
+type AccessPolicyRouter interface {
+	SetAccessPolicy(name string, policy AccessPolicy) error
+}
+
+// MaintenanceRouter is a router able to serve a static maintenance page,
+// with the 503 status code, instead of proxying the requests to a backend.
+type MaintenanceRouter interface {
+	SetMaintenance(name string, page string) error
+	UnsetMaintenance(name string) error
+}
+
+// ActivityRouter is a router able to tell when a backend last received
+// requests. LastActivity returns the zero time when there's no record of
+// requests to the backend. TracksActivity returns whether the router is
+// configured to track the activity of backends, LastActivity fails with
+// ErrActivityNotTracked when it isn't.
+type ActivityRouter interface {
+	LastActivity(name string) (time.Time, error)
+	TracksActivity() bool
+}
+
 type MessageRouter interface {
 	StartupMessage() (string, error)
 }
@@ -139,19 +227,26 @@ func collection() (*storage.Collection, error) {
 }
 
 // Store stores the app name related with the
-// router name.
+// router name. Apps in more than one router share the same mapping, so each
+// call to Store must be paired with a call to Remove, and the mapping is only
+// removed when no router uses it anymore.
 func Store(appName, routerName, kind string) error {
 	coll, err := collection()
 	if err != nil {
 		return err
 	}
 	defer coll.Close()
-	data := map[string]string{
-		"app":    appName,
-		"router": routerName,
-		"kind":   kind,
+	// Mappings stored before apps could have more than one router are used by
+	// a single router.
+	err = coll.Update(bson.M{"app": appName, "refs": bson.M{"$exists": false}}, bson.M{"$set": bson.M{"refs": 1}})
+	if err != nil && err != mgo.ErrNotFound {
+		return err
 	}
-	return coll.Insert(&data)
+	_, err = coll.Upsert(bson.M{"app": appName}, bson.M{
+		"$setOnInsert": bson.M{"router": routerName, "kind": kind},
+		"$inc":         bson.M{"refs": 1},
+	})
+	return err
 }
 
 func retrieveRouterData(appName string) (map[string]string, error) {
@@ -181,12 +276,18 @@ func Retrieve(appName string) (string, error) {
 	return data["router"], nil
 }
 
+// Remove releases the mapping of the app stored by one router, removing it
+// when it's not used by other routers.
 func Remove(appName string) error {
 	coll, err := collection()
 	if err != nil {
 		return err
 	}
 	defer coll.Close()
+	err = coll.Update(bson.M{"app": appName, "refs": bson.M{"$gt": 1}}, bson.M{"$inc": bson.M{"refs": -1}})
+	if err != mgo.ErrNotFound {
+		return err
+	}
 	return coll.Remove(bson.M{"app": appName})
 }
 
@@ -205,12 +306,13 @@ func swapBackendName(backend1, backend2 string) error {
 		return err
 	}
 	update := bson.M{"$set": bson.M{"router": router2}}
-	err = coll.Update(bson.M{"app": backend1}, update)
+	_, err = coll.UpdateAll(bson.M{"app": backend1}, update)
 	if err != nil {
 		return err
 	}
 	update = bson.M{"$set": bson.M{"router": router1}}
-	return coll.Update(bson.M{"app": backend2}, update)
+	_, err = coll.UpdateAll(bson.M{"app": backend2}, update)
+	return err
 }
 
 func swapCnames(r Router, backend1, backend2 string) error {
@@ -249,7 +351,7 @@ func swapCnames(r Router, backend1, backend2 string) error {
 	return nil
 }
 
-func swapBackends(r Router, backend1, backend2 string) error {
+func swapRoutes(r Router, backend1, backend2 string) error {
 	routes1, err := r.Routes(backend1)
 	if err != nil {
 		return err
@@ -270,15 +372,17 @@ func swapBackends(r Router, backend1, backend2 string) error {
 	if err != nil {
 		return err
 	}
-	err = r.RemoveRoutes(backend2, routes2)
-	if err != nil {
-		return err
-	}
-	return swapBackendName(backend1, backend2)
-
+	return r.RemoveRoutes(backend2, routes2)
 }
 
 func Swap(r Router, backend1, backend2 string, cnameOnly bool) error {
+	return SwapMany([]Router{r}, backend1, backend2, cnameOnly)
+}
+
+// SwapMany swaps two backends present in all the given routers. The names
+// of the backends are swapped only once, after the routes are swapped in
+// every router, as they're shared by all the routers of the backends.
+func SwapMany(routers []Router, backend1, backend2 string, cnameOnly bool) error {
 	data1, err := retrieveRouterData(backend1)
 	if err != nil {
 		return err
@@ -291,10 +395,20 @@ func Swap(r Router, backend1, backend2 string, cnameOnly bool) error {
 		return fmt.Errorf("swap is only allowed between routers of the same kind. %q uses %q, %q uses %q",
 			backend1, data1["kind"], backend2, data2["kind"])
 	}
+	for _, r := range routers {
+		if cnameOnly {
+			err = swapCnames(r, backend1, backend2)
+		} else {
+			err = swapRoutes(r, backend1, backend2)
+		}
+		if err != nil {
+			return err
+		}
+	}
 	if cnameOnly {
-		return swapCnames(r, backend1, backend2)
+		return nil
 	}
-	return swapBackends(r, backend1, backend2)
+	return swapBackendName(backend1, backend2)
 }
 
 type PlanRouter struct {
@@ -338,6 +452,25 @@ func ValidCName(cname, domain string) bool {
 	return !strings.HasSuffix(cname, domain)
 }
 
+// ValidHealthcheckPath returns true if the path is safe to be written in the
+// config of routers: it must start with a slash and must not contain
+// whitespace or control characters. An empty path disables the healthcheck
+// and is also valid.
+func ValidHealthcheckPath(path string) bool {
+	if path == "" {
+		return true
+	}
+	if !strings.HasPrefix(path, "/") {
+		return false
+	}
+	for _, c := range path {
+		if unicode.IsSpace(c) || unicode.IsControl(c) {
+			return false
+		}
+	}
+	return true
+}
+
 func IsSwapped(name string) (bool, string, error) {
 	backendName, err := Retrieve(name)
 	if err != nil {
@@ -9,6 +9,7 @@ import (
 
 	"github.com/tsuru/config"
 	"gopkg.in/check.v1"
+	"gopkg.in/mgo.v2/bson"
 )
 
 func (s *S) TestRegisterAndGet(c *check.C) {
@@ -94,6 +95,47 @@ func (s *S) TestStore(c *check.C) {
 	c.Assert(err, check.IsNil)
 }
 
+func (s *S) TestStoreSharedByRouters(c *check.C) {
+	err := Store("appname", "appname", "fake")
+	c.Assert(err, check.IsNil)
+	err = Store("appname", "appname", "nginx")
+	c.Assert(err, check.IsNil)
+	coll, err := collection()
+	c.Assert(err, check.IsNil)
+	defer coll.Close()
+	n, err := coll.Find(bson.M{"app": "appname"}).Count()
+	c.Assert(err, check.IsNil)
+	c.Assert(n, check.Equals, 1)
+	err = Remove("appname")
+	c.Assert(err, check.IsNil)
+	name, err := Retrieve("appname")
+	c.Assert(err, check.IsNil)
+	c.Assert(name, check.Equals, "appname")
+	err = Remove("appname")
+	c.Assert(err, check.IsNil)
+	_, err = Retrieve("appname")
+	c.Assert(err, check.Equals, ErrBackendNotFound)
+}
+
+func (s *S) TestStoreLegacyMapping(c *check.C) {
+	coll, err := collection()
+	c.Assert(err, check.IsNil)
+	defer coll.Close()
+	err = coll.Insert(bson.M{"app": "appname", "router": "appname", "kind": "fake"})
+	c.Assert(err, check.IsNil)
+	err = Store("appname", "appname", "nginx")
+	c.Assert(err, check.IsNil)
+	err = Remove("appname")
+	c.Assert(err, check.IsNil)
+	name, err := Retrieve("appname")
+	c.Assert(err, check.IsNil)
+	c.Assert(name, check.Equals, "appname")
+	err = Remove("appname")
+	c.Assert(err, check.IsNil)
+	_, err = Retrieve("appname")
+	c.Assert(err, check.Equals, ErrBackendNotFound)
+}
+
 func (s *S) TestRetrieveWithoutKind(c *check.C) {
 	err := Store("appname", "routername", "")
 	c.Assert(err, check.IsNil)
@@ -177,3 +219,14 @@ func (s *S) TestRouteError(c *check.C) {
 	err = &RouterError{Op: "del", Err: errors.New("Fatal error.")}
 	c.Assert(err.Error(), check.Equals, "[router del] Fatal error.")
 }
+
+func (s *S) TestValidHealthcheckPath(c *check.C) {
+	c.Assert(ValidHealthcheckPath(""), check.Equals, true)
+	c.Assert(ValidHealthcheckPath("/"), check.Equals, true)
+	c.Assert(ValidHealthcheckPath("/health?full=1"), check.Equals, true)
+	c.Assert(ValidHealthcheckPath("health"), check.Equals, false)
+	c.Assert(ValidHealthcheckPath("/health check"), check.Equals, false)
+	c.Assert(ValidHealthcheckPath("/health\n    server evil 10.0.0.1:80"), check.Equals, false)
+	c.Assert(ValidHealthcheckPath("/health\tcheck"), check.Equals, false)
+	c.Assert(ValidHealthcheckPath("/health\x00"), check.Equals, false)
+}
@@ -610,3 +610,146 @@ func (s *RouterSuite) TestSetHealthcheck(c *check.C) {
 	err = s.Router.RemoveBackend(testBackend1)
 	c.Assert(err, check.IsNil)
 }
+
+func (s *RouterSuite) TestAddRemoveCertificate(c *check.C) {
+	tlsRouter, ok := s.Router.(router.TLSRouter)
+	if !ok {
+		c.Skip(fmt.Sprintf("%T does not implement TLSRouter", s.Router))
+	}
+	err := s.Router.AddBackend(testBackend1)
+	c.Assert(err, check.IsNil)
+	addr, err := s.Router.Addr(testBackend1)
+	c.Assert(err, check.IsNil)
+	_, err = tlsRouter.Certificate(testBackend1, addr)
+	c.Assert(err, check.Equals, router.ErrCertificateNotFound)
+	err = tlsRouter.AddCertificate(testBackend1, addr, "my certificate", "my key")
+	c.Assert(err, check.IsNil)
+	cert, err := tlsRouter.Certificate(testBackend1, addr)
+	c.Assert(err, check.IsNil)
+	c.Assert(cert, check.Equals, "my certificate")
+	err = tlsRouter.RemoveCertificate(testBackend1, addr)
+	c.Assert(err, check.IsNil)
+	err = tlsRouter.RemoveCertificate(testBackend1, addr)
+	c.Assert(err, check.Equals, router.ErrCertificateNotFound)
+	_, err = tlsRouter.Certificate(testBackend1, addr)
+	c.Assert(err, check.Equals, router.ErrCertificateNotFound)
+	err = s.Router.RemoveBackend(testBackend1)
+	c.Assert(err, check.IsNil)
+}
+
+func (s *RouterSuite) TestAddRemoveMount(c *check.C) {
+	pathRouter, ok := s.Router.(router.PathRouter)
+	if !ok {
+		c.Skip(fmt.Sprintf("%T does not implement PathRouter", s.Router))
+	}
+	err := s.Router.AddBackend(testBackend1)
+	c.Assert(err, check.IsNil)
+	mount := router.Mount{Domain: "api.mydomain.com", Path: "/billing"}
+	err = pathRouter.AddMount(testBackend1, mount)
+	c.Assert(err, check.IsNil)
+	err = pathRouter.AddMount(testBackend1, mount)
+	c.Assert(err, check.Equals, router.ErrMountExists)
+	other := router.Mount{Domain: "api.mydomain.com", Path: "/billing/v2"}
+	err = pathRouter.AddMount(testBackend1, other)
+	c.Assert(err, check.IsNil)
+	err = pathRouter.RemoveMount(testBackend1, mount)
+	c.Assert(err, check.IsNil)
+	err = pathRouter.RemoveMount(testBackend1, mount)
+	c.Assert(err, check.Equals, router.ErrMountNotFound)
+	err = pathRouter.RemoveMount(testBackend1, other)
+	c.Assert(err, check.IsNil)
+	err = s.Router.RemoveBackend(testBackend1)
+	c.Assert(err, check.IsNil)
+}
+
+func (s *RouterSuite) TestAddMountRouterDomain(c *check.C) {
+	pathRouter, ok := s.Router.(router.PathRouter)
+	if !ok {
+		c.Skip(fmt.Sprintf("%T does not implement PathRouter", s.Router))
+	}
+	err := s.Router.AddBackend(testBackend1)
+	c.Assert(err, check.IsNil)
+	err = s.Router.AddBackend(testBackend2)
+	c.Assert(err, check.IsNil)
+	addr, err := s.Router.Addr(testBackend2)
+	c.Assert(err, check.IsNil)
+	err = pathRouter.AddMount(testBackend1, router.Mount{Domain: addr, Path: "/billing"})
+	c.Assert(err, check.Equals, router.ErrMountDomainNotAllowed)
+	err = pathRouter.AddMount(testBackend1, router.Mount{Domain: "sub." + addr, Path: "/billing"})
+	c.Assert(err, check.Equals, router.ErrMountDomainNotAllowed)
+	err = s.Router.RemoveBackend(testBackend1)
+	c.Assert(err, check.IsNil)
+	err = s.Router.RemoveBackend(testBackend2)
+	c.Assert(err, check.IsNil)
+}
+
+func (s *RouterSuite) TestRemoveMountOfOtherBackend(c *check.C) {
+	pathRouter, ok := s.Router.(router.PathRouter)
+	if !ok {
+		c.Skip(fmt.Sprintf("%T does not implement PathRouter", s.Router))
+	}
+	err := s.Router.AddBackend(testBackend1)
+	c.Assert(err, check.IsNil)
+	err = s.Router.AddBackend(testBackend2)
+	c.Assert(err, check.IsNil)
+	mount := router.Mount{Domain: "api.mydomain.com", Path: "/billing"}
+	err = pathRouter.AddMount(testBackend1, mount)
+	c.Assert(err, check.IsNil)
+	err = pathRouter.RemoveMount(testBackend2, mount)
+	c.Assert(err, check.Equals, router.ErrMountNotFound)
+	err = pathRouter.RemoveMount(testBackend1, mount)
+	c.Assert(err, check.IsNil)
+	err = s.Router.RemoveBackend(testBackend1)
+	c.Assert(err, check.IsNil)
+	err = s.Router.RemoveBackend(testBackend2)
+	c.Assert(err, check.IsNil)
+}
+
+func (s *RouterSuite) TestSetAccessPolicy(c *check.C) {
+	policyRouter, ok := s.Router.(router.AccessPolicyRouter)
+	if !ok {
+		c.Skip(fmt.Sprintf("%T does not implement AccessPolicyRouter", s.Router))
+	}
+	err := s.Router.AddBackend(testBackend1)
+	c.Assert(err, check.IsNil)
+	policy := router.AccessPolicy{
+		Allow:     []string{"10.0.0.0/8"},
+		Deny:      []string{"10.1.0.0/16"},
+		RateLimit: 10,
+		RateBurst: 20,
+		BasicAuth: &router.BasicAuth{Username: "user", PasswordHash: "{PLAIN}secret"},
+	}
+	err = policyRouter.SetAccessPolicy(testBackend1, policy)
+	if err == router.ErrBasicAuthNotSupported {
+		policy.BasicAuth = nil
+		err = policyRouter.SetAccessPolicy(testBackend1, policy)
+	}
+	c.Assert(err, check.IsNil)
+	err = policyRouter.SetAccessPolicy(testBackend1, router.AccessPolicy{})
+	c.Assert(err, check.IsNil)
+	err = s.Router.RemoveBackend(testBackend1)
+	c.Assert(err, check.IsNil)
+	err = policyRouter.SetAccessPolicy(testBackend1, policy)
+	c.Assert(err, check.Equals, router.ErrBackendNotFound)
+}
+
+func (s *RouterSuite) TestSetUnsetMaintenance(c *check.C) {
+	maintenanceRouter, ok := s.Router.(router.MaintenanceRouter)
+	if !ok {
+		c.Skip(fmt.Sprintf("%T does not implement MaintenanceRouter", s.Router))
+	}
+	err := s.Router.AddBackend(testBackend1)
+	c.Assert(err, check.IsNil)
+	err = maintenanceRouter.SetMaintenance(testBackend1, "<h1>maintenance</h1>")
+	c.Assert(err, check.IsNil)
+	err = maintenanceRouter.SetMaintenance(testBackend1, "<h1>still in maintenance</h1>")
+	c.Assert(err, check.IsNil)
+	err = maintenanceRouter.UnsetMaintenance(testBackend1)
+	c.Assert(err, check.IsNil)
+	err = maintenanceRouter.UnsetMaintenance(testBackend1)
+	c.Assert(err, check.IsNil)
+	err = s.Router.RemoveBackend(testBackend1)
+	c.Assert(err, check.IsNil)
+	err = maintenanceRouter.SetMaintenance(testBackend1, "<h1>maintenance</h1>")
+	c.Assert(err, check.Equals, router.ErrBackendNotFound)
+}
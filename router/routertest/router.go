@@ -9,6 +9,7 @@ import (
 	"fmt"
 	"net/url"
 	"sync"
+	"time"
 
 	"github.com/tsuru/tsuru/router"
 )
@@ -33,7 +34,7 @@ func createHCRouter(name, prefix string) (router.Router, error) {
 }
 
 func newFakeRouter() fakeRouter {
-	return fakeRouter{cnames: make(map[string]string), backends: make(map[string][]string), failuresByIp: make(map[string]bool), healthcheck: make(map[string]router.HealthcheckData), mutex: &sync.Mutex{}}
+	return fakeRouter{cnames: make(map[string]string), backends: make(map[string][]string), failuresByIp: make(map[string]bool), healthcheck: make(map[string]router.HealthcheckData), certificates: make(map[string]string), mounts: make(map[string]string), policies: make(map[string]router.AccessPolicy), maintenance: make(map[string]string), activity: make(map[string]time.Time), mutex: &sync.Mutex{}}
 }
 
 type fakeRouter struct {
@@ -41,6 +42,12 @@ type fakeRouter struct {
 	cnames       map[string]string
 	failuresByIp map[string]bool
 	healthcheck  map[string]router.HealthcheckData
+	certificates map[string]string
+	mounts       map[string]string
+	policies     map[string]router.AccessPolicy
+	maintenance  map[string]string
+	activity     map[string]time.Time
+	noActivity   bool
 	mutex        *sync.Mutex
 }
 
@@ -315,6 +322,12 @@ func (r *fakeRouter) Reset() {
 	r.failuresByIp = make(map[string]bool)
 	r.cnames = make(map[string]string)
 	r.healthcheck = make(map[string]router.HealthcheckData)
+	r.certificates = make(map[string]string)
+	r.mounts = make(map[string]string)
+	r.policies = make(map[string]router.AccessPolicy)
+	r.maintenance = make(map[string]string)
+	r.activity = make(map[string]time.Time)
+	r.noActivity = false
 }
 
 func (r *fakeRouter) Routes(name string) ([]*url.URL, error) {
@@ -359,3 +372,197 @@ func (r *fakeRouter) SetHealthcheck(name string, data router.HealthcheckData) er
 	r.healthcheck[backendName] = data
 	return nil
 }
+
+func (r *fakeRouter) AddCertificate(name, cname, certificate, key string) error {
+	backendName, err := router.Retrieve(name)
+	if err != nil {
+		return err
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.certificates[backendName+"/"+cname] = certificate
+	return nil
+}
+
+func (r *fakeRouter) RemoveCertificate(name, cname string) error {
+	backendName, err := router.Retrieve(name)
+	if err != nil {
+		return err
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if _, ok := r.certificates[backendName+"/"+cname]; !ok {
+		return router.ErrCertificateNotFound
+	}
+	delete(r.certificates, backendName+"/"+cname)
+	return nil
+}
+
+func (r *fakeRouter) Certificate(name, cname string) (string, error) {
+	backendName, err := router.Retrieve(name)
+	if err != nil {
+		return "", err
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	certificate, ok := r.certificates[backendName+"/"+cname]
+	if !ok {
+		return "", router.ErrCertificateNotFound
+	}
+	return certificate, nil
+}
+
+func (r *fakeRouter) AddMount(name string, mount router.Mount) error {
+	backendName, err := router.Retrieve(name)
+	if err != nil {
+		return err
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if _, ok := r.backends[backendName]; !ok {
+		return router.ErrBackendNotFound
+	}
+	if !router.ValidCName(mount.Domain, "fakerouter.com") {
+		return router.ErrMountDomainNotAllowed
+	}
+	key := mount.Domain + mount.Path
+	if _, ok := r.mounts[key]; ok {
+		return router.ErrMountExists
+	}
+	r.mounts[key] = backendName
+	return nil
+}
+
+func (r *fakeRouter) RemoveMount(name string, mount router.Mount) error {
+	backendName, err := router.Retrieve(name)
+	if err != nil {
+		return err
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	key := mount.Domain + mount.Path
+	if r.mounts[key] != backendName {
+		return router.ErrMountNotFound
+	}
+	delete(r.mounts, key)
+	return nil
+}
+
+func (r *fakeRouter) HasMount(name, domain, path string) bool {
+	backendName, err := router.Retrieve(name)
+	if err != nil {
+		return false
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.mounts[domain+path] == backendName
+}
+
+func (r *fakeRouter) SetAccessPolicy(name string, policy router.AccessPolicy) error {
+	backendName, err := router.Retrieve(name)
+	if err != nil {
+		return err
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if _, ok := r.backends[backendName]; !ok {
+		return router.ErrBackendNotFound
+	}
+	if policy.Empty() {
+		delete(r.policies, backendName)
+		return nil
+	}
+	r.policies[backendName] = policy
+	return nil
+}
+
+func (r *fakeRouter) AccessPolicy(name string) (router.AccessPolicy, bool) {
+	backendName, err := router.Retrieve(name)
+	if err != nil {
+		return router.AccessPolicy{}, false
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	policy, ok := r.policies[backendName]
+	return policy, ok
+}
+
+func (r *fakeRouter) SetMaintenance(name string, page string) error {
+	backendName, err := router.Retrieve(name)
+	if err != nil {
+		return err
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if _, ok := r.backends[backendName]; !ok {
+		return router.ErrBackendNotFound
+	}
+	r.maintenance[backendName] = page
+	return nil
+}
+
+func (r *fakeRouter) UnsetMaintenance(name string) error {
+	backendName, err := router.Retrieve(name)
+	if err != nil {
+		return err
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if _, ok := r.backends[backendName]; !ok {
+		return router.ErrBackendNotFound
+	}
+	delete(r.maintenance, backendName)
+	return nil
+}
+
+func (r *fakeRouter) MaintenancePage(name string) (string, bool) {
+	backendName, err := router.Retrieve(name)
+	if err != nil {
+		return "", false
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	page, ok := r.maintenance[backendName]
+	return page, ok
+}
+
+func (r *fakeRouter) TracksActivity() bool {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return !r.noActivity
+}
+
+// DisableActivity makes the router stop tracking the activity of backends,
+// until the next call to Reset.
+func (r *fakeRouter) DisableActivity() {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.noActivity = true
+}
+
+func (r *fakeRouter) LastActivity(name string) (time.Time, error) {
+	backendName, err := router.Retrieve(name)
+	if err != nil {
+		return time.Time{}, err
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if r.noActivity {
+		return time.Time{}, router.ErrActivityNotTracked
+	}
+	if _, ok := r.backends[backendName]; !ok {
+		return time.Time{}, router.ErrBackendNotFound
+	}
+	return r.activity[backendName], nil
+}
+
+// SetLastActivity sets the time of the last request received by the backend.
+func (r *fakeRouter) SetLastActivity(name string, t time.Time) {
+	backendName, err := router.Retrieve(name)
+	if err != nil {
+		return
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.activity[backendName] = t
+}
@@ -9,6 +9,7 @@ import (
 
 	"github.com/tsuru/config"
 	"github.com/tsuru/tsuru/db"
+	"github.com/tsuru/tsuru/db/dbtest"
 	"gopkg.in/check.v1"
 )
 
@@ -28,6 +29,10 @@ func (s *S) SetUpSuite(c *check.C) {
 	c.Assert(err, check.IsNil)
 }
 
+func (s *S) SetUpTest(c *check.C) {
+	dbtest.ClearAllCollections(s.conn.Apps().Database)
+}
+
 func (s *S) TearDownSuite(c *check.C) {
 	s.conn.Apps().Database.DropDatabase()
 	s.conn.Close()
@@ -8,6 +8,7 @@ import (
 	"crypto/md5"
 	"fmt"
 	"net/url"
+	"regexp"
 	"strings"
 
 	"github.com/tsuru/config"
@@ -17,9 +18,13 @@ import (
 	"github.com/vulcand/vulcand/api"
 	"github.com/vulcand/vulcand/engine"
 	"github.com/vulcand/vulcand/plugin/registry"
+	"github.com/vulcand/vulcand/plugin/rewrite"
 )
 
-const routerName = "vulcand"
+const (
+	routerName  = "vulcand"
+	mountPrefix = "tsuru_mount_"
+)
 
 func init() {
 	router.Register(routerName, createRouter)
@@ -62,6 +67,10 @@ func (r *vulcandRouter) backendName(app string) string {
 	return fmt.Sprintf("tsuru_%s", app)
 }
 
+func (r *vulcandRouter) mountName(mount router.Mount) string {
+	return fmt.Sprintf("%s%x", mountPrefix, md5.Sum([]byte(mount.Domain+mount.Path)))
+}
+
 func (r *vulcandRouter) serverName(address string) string {
 	return fmt.Sprintf("tsuru_%x", md5.Sum([]byte(address)))
 }
@@ -252,6 +261,9 @@ func (r *vulcandRouter) CNames(name string) ([]*url.URL, error) {
 	address = r.backendName(address)
 	urls := []*url.URL{}
 	for _, f := range fes {
+		if strings.HasPrefix(f.Id, mountPrefix) {
+			continue
+		}
 		host := strings.Replace(f.Id, "tsuru_", "", 1)
 		if f.BackendId == backendName && f.Id != address {
 			urls = append(urls, &url.URL{Host: host})
@@ -314,6 +326,74 @@ func (r *vulcandRouter) Addr(name string) (string, error) {
 	return frontendHostname, nil
 }
 
+func (r *vulcandRouter) AddMount(name string, mount router.Mount) error {
+	usedName, err := router.Retrieve(name)
+	if err != nil {
+		return err
+	}
+	if !router.ValidCName(mount.Domain, r.domain) {
+		return router.ErrMountDomainNotAllowed
+	}
+	frontendKey := engine.FrontendKey{Id: r.mountName(mount)}
+	if found, _ := r.client.GetFrontend(frontendKey); found != nil {
+		return router.ErrMountExists
+	}
+	pathExpr := "^" + regexp.QuoteMeta(mount.Path) + "(/|$)"
+	frontend, err := engine.NewHTTPFrontend(
+		route.NewMux(),
+		frontendKey.Id,
+		r.backendName(usedName),
+		fmt.Sprintf(`Host(%q) && PathRegexp(%q)`, mount.Domain, pathExpr),
+		engine.HTTPFrontendSettings{},
+	)
+	if err != nil {
+		return &router.RouterError{Err: err, Op: "add-mount"}
+	}
+	err = r.client.UpsertFrontend(*frontend, engine.NoTTL)
+	if err != nil {
+		return &router.RouterError{Err: err, Op: "add-mount"}
+	}
+	if !mount.StripPrefix {
+		return nil
+	}
+	rw, err := rewrite.NewRewrite(`^(https?://[^/]+)`+regexp.QuoteMeta(mount.Path)+`/?(.*)$`, "$1/$2", false, false)
+	if err != nil {
+		r.client.DeleteFrontend(frontendKey)
+		return &router.RouterError{Err: err, Op: "add-mount"}
+	}
+	middleware := engine.Middleware{
+		Id:         "strip-prefix",
+		Type:       "rewrite",
+		Middleware: rw,
+	}
+	err = r.client.UpsertMiddleware(frontendKey, middleware, engine.NoTTL)
+	if err != nil {
+		r.client.DeleteFrontend(frontendKey)
+		return &router.RouterError{Err: err, Op: "add-mount"}
+	}
+	return nil
+}
+
+func (r *vulcandRouter) RemoveMount(name string, mount router.Mount) error {
+	usedName, err := router.Retrieve(name)
+	if err != nil {
+		return err
+	}
+	frontendKey := engine.FrontendKey{Id: r.mountName(mount)}
+	found, _ := r.client.GetFrontend(frontendKey)
+	if found == nil || found.BackendId != r.backendName(usedName) {
+		return router.ErrMountNotFound
+	}
+	err = r.client.DeleteFrontend(frontendKey)
+	if err != nil {
+		if _, ok := err.(*engine.NotFoundError); ok {
+			return router.ErrMountNotFound
+		}
+		return &router.RouterError{Err: err, Op: "remove-mount"}
+	}
+	return nil
+}
+
 func (r *vulcandRouter) Swap(backend1, backend2 string, cnameOnly bool) error {
 	return router.Swap(r, backend1, backend2, cnameOnly)
 }
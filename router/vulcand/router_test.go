@@ -5,6 +5,7 @@
 package vulcand
 
 import (
+	"crypto/md5"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
@@ -23,6 +24,7 @@ import (
 	"github.com/vulcand/vulcand/engine"
 	"github.com/vulcand/vulcand/engine/memng"
 	"github.com/vulcand/vulcand/plugin/registry"
+	"github.com/vulcand/vulcand/plugin/rewrite"
 	"github.com/vulcand/vulcand/supervisor"
 	"gopkg.in/check.v1"
 )
@@ -365,6 +367,71 @@ func (s *S) TestUnsetCNameNotExist(c *check.C) {
 	c.Assert(err, check.Equals, router.ErrCNameNotFound)
 }
 
+func (s *S) TestAddMount(c *check.C) {
+	vRouter, err := router.Get("vulcand")
+	c.Assert(err, check.IsNil)
+	err = vRouter.AddBackend("myapp")
+	c.Assert(err, check.IsNil)
+	pathRouter, ok := vRouter.(router.PathRouter)
+	c.Assert(ok, check.Equals, true)
+	err = pathRouter.AddMount("myapp", router.Mount{Domain: "api.example.com", Path: "/billing"})
+	c.Assert(err, check.IsNil)
+	frontend, err := s.engine.GetFrontend(engine.FrontendKey{
+		Id: fmt.Sprintf("tsuru_mount_%x", md5.Sum([]byte("api.example.com/billing"))),
+	})
+	c.Assert(err, check.IsNil)
+	c.Assert(frontend.BackendId, check.Equals, "tsuru_myapp")
+	c.Assert(frontend.Route, check.Equals, `Host("api.example.com") && PathRegexp("^/billing(/|$)")`)
+	middlewares, err := s.engine.GetMiddlewares(engine.FrontendKey{Id: frontend.Id})
+	c.Assert(err, check.IsNil)
+	c.Assert(middlewares, check.HasLen, 0)
+	cnameRouter := vRouter.(router.CNameRouter)
+	cnames, err := cnameRouter.CNames("myapp")
+	c.Assert(err, check.IsNil)
+	c.Assert(cnames, check.HasLen, 0)
+}
+
+func (s *S) TestAddMountStripPrefix(c *check.C) {
+	vRouter, err := router.Get("vulcand")
+	c.Assert(err, check.IsNil)
+	err = vRouter.AddBackend("myapp")
+	c.Assert(err, check.IsNil)
+	pathRouter := vRouter.(router.PathRouter)
+	err = pathRouter.AddMount("myapp", router.Mount{Domain: "api.example.com", Path: "/billing", StripPrefix: true})
+	c.Assert(err, check.IsNil)
+	frontendKey := engine.FrontendKey{
+		Id: fmt.Sprintf("tsuru_mount_%x", md5.Sum([]byte("api.example.com/billing"))),
+	}
+	middlewares, err := s.engine.GetMiddlewares(frontendKey)
+	c.Assert(err, check.IsNil)
+	c.Assert(middlewares, check.HasLen, 1)
+	c.Assert(middlewares[0].Type, check.Equals, "rewrite")
+	rw, ok := middlewares[0].Middleware.(*rewrite.Rewrite)
+	c.Assert(ok, check.Equals, true)
+	c.Assert(rw.Regexp, check.Equals, `^(https?://[^/]+)/billing/?(.*)$`)
+	c.Assert(rw.Replacement, check.Equals, "$1/$2")
+}
+
+func (s *S) TestRemoveMount(c *check.C) {
+	vRouter, err := router.Get("vulcand")
+	c.Assert(err, check.IsNil)
+	err = vRouter.AddBackend("myapp")
+	c.Assert(err, check.IsNil)
+	err = vRouter.AddBackend("otherapp")
+	c.Assert(err, check.IsNil)
+	pathRouter := vRouter.(router.PathRouter)
+	mount := router.Mount{Domain: "api.example.com", Path: "/billing"}
+	err = pathRouter.AddMount("myapp", mount)
+	c.Assert(err, check.IsNil)
+	err = pathRouter.RemoveMount("otherapp", mount)
+	c.Assert(err, check.Equals, router.ErrMountNotFound)
+	err = pathRouter.RemoveMount("myapp", mount)
+	c.Assert(err, check.IsNil)
+	frontends, err := s.engine.GetFrontends()
+	c.Assert(err, check.IsNil)
+	c.Assert(frontends, check.HasLen, 2)
+}
+
 func (s *S) TestAddr(c *check.C) {
 	vRouter, err := router.Get("vulcand")
 	c.Assert(err, check.IsNil)